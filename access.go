@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// trackAccess makes the recall tools count, per day, the observations and
+// entities they return, for heatmap. Each recall then costs a write.
+var trackAccess = getEnv("ENGRAM_TRACK_ACCESS", "true") == "true"
+
+// recordAccess counts one hit today on each of observationIDs, and on each
+// of entityIDs and the entities those observations belong to. It is best
+// effort: a recall is not failed because its use could not be counted.
+func recordAccess(ctx context.Context, db *sql.DB, observationIDs, entityIDs []int64) {
+	if !trackAccess || len(observationIDs)+len(entityIDs) == 0 {
+		return
+	}
+	obsArgs := make([]any, len(observationIDs))
+	for i, id := range observationIDs {
+		obsArgs[i] = id
+	}
+	entArgs := make([]any, len(entityIDs))
+	for i, id := range entityIDs {
+		entArgs[i] = id
+	}
+	// placeholders needs at least one; IN (NULL) matches nothing.
+	in := func(n int) string {
+		if n == 0 {
+			return "NULL"
+		}
+		return placeholders(n)
+	}
+
+	if len(observationIDs) > 0 {
+		if _, err := db.ExecContext(ctx, `INSERT INTO observation_access (observation_id, day, hits)
+			SELECT id, date('now'), 1 FROM observations WHERE id IN (`+in(len(obsArgs))+`)
+			ON CONFLICT (observation_id, day) DO UPDATE SET hits = hits + 1, last_at = CURRENT_TIMESTAMP`, obsArgs...); err != nil {
+			log.Printf("failed to count observation access: %v", err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO entity_access (entity_id, day, hits)
+		SELECT id, date('now'), 1 FROM entities
+		WHERE id IN (`+in(len(entArgs))+`) OR id IN (SELECT entity_id FROM observations WHERE id IN (`+in(len(obsArgs))+`))
+		ON CONFLICT (entity_id, day) DO UPDATE SET hits = hits + 1, last_at = CURRENT_TIMESTAMP`, append(entArgs, obsArgs...)...); err != nil {
+		log.Printf("failed to count entity access: %v", err)
+	}
+}
+
+// heatmapGrouping is one way heatmap groups hits. groups lists every group
+// with its members, the members returned, their hits and the last hit;
+// buckets gives the hits per group and period, with %s standing for the
+// period expression over a.day; unused counts members and the members not
+// returned. Each takes the first day counted.
+type heatmapGrouping struct {
+	members string
+	access  string
+	groups  string
+	buckets string
+	unused  string
+}
+
+var heatmapGroupings = map[string]heatmapGrouping{
+	"tag": {
+		members: "observations",
+		access:  "observation_access",
+		groups: `SELECT t.name, count(DISTINCT o.id), count(DISTINCT a.observation_id), COALESCE(SUM(a.hits), 0), COALESCE(MAX(a.last_at), '')
+			FROM tags t LEFT JOIN observation_tags ot ON ot.tag_id = t.id LEFT JOIN observations o ON o.id = ot.observation_id
+			LEFT JOIN observation_access a ON a.observation_id = o.id AND a.day >= ?
+			GROUP BY t.id`,
+		buckets: `SELECT t.name, %s, SUM(a.hits)
+			FROM observation_access a JOIN observations o ON o.id = a.observation_id
+			JOIN observation_tags ot ON ot.observation_id = o.id JOIN tags t ON t.id = ot.tag_id
+			WHERE a.day >= ? GROUP BY 1, 2`,
+		unused: `SELECT count(*), COALESCE(SUM(NOT EXISTS (SELECT 1 FROM observation_access a WHERE a.observation_id = o.id AND a.day >= ?)), 0)
+			FROM observations o`,
+	},
+	"entity_type": {
+		members: "entities",
+		access:  "entity_access",
+		groups: `SELECT e.entity_type, count(DISTINCT e.id), count(DISTINCT a.entity_id), COALESCE(SUM(a.hits), 0), COALESCE(MAX(a.last_at), '')
+			FROM entities e LEFT JOIN entity_access a ON a.entity_id = e.id AND a.day >= ?
+			GROUP BY e.entity_type`,
+		buckets: `SELECT e.entity_type, %s, SUM(a.hits)
+			FROM entity_access a JOIN entities e ON e.id = a.entity_id
+			WHERE a.day >= ? GROUP BY 1, 2`,
+		unused: `SELECT count(*), COALESCE(SUM(NOT EXISTS (SELECT 1 FROM entity_access a WHERE a.entity_id = e.id AND a.day >= ?)), 0)
+			FROM entities e`,
+	},
+	"entity": {
+		members: "entities",
+		access:  "entity_access",
+		groups: `SELECT e.name, 1, count(DISTINCT a.entity_id), COALESCE(SUM(a.hits), 0), COALESCE(MAX(a.last_at), '')
+			FROM entities e LEFT JOIN entity_access a ON a.entity_id = e.id AND a.day >= ?
+			GROUP BY e.id`,
+		buckets: `SELECT e.name, %s, SUM(a.hits)
+			FROM entity_access a JOIN entities e ON e.id = a.entity_id
+			WHERE a.day >= ? GROUP BY 1, 2`,
+		unused: `SELECT count(*), COALESCE(SUM(NOT EXISTS (SELECT 1 FROM entity_access a WHERE a.entity_id = e.id AND a.day >= ?)), 0)
+			FROM entities e`,
+	},
+}
+
+// buildHeatmap reports how often the recall tools returned each group's
+// members over the last periods, with the hits per period, most used first
+// or, with least, least used first.
+func buildHeatmap(ctx context.Context, db *sql.DB, levels []string, by, period string, periods, limit int, least bool, now time.Time) (string, error) {
+	g := heatmapGroupings[by]
+	starts := periodStarts(period, periods, now)
+	from := starts[0]
+
+	order := "DESC"
+	if least {
+		order = "ASC"
+	}
+	type group struct {
+		name               string
+		members, used, hit int64
+		last               string
+	}
+	rows, err := db.QueryContext(ctx, restrictVisibility(g.groups+" ORDER BY 4 "+order+", 1 LIMIT ?", levels), from, limit)
+	if err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+	var groups []group
+	for rows.Next() {
+		var gr group
+		if err := rows.Scan(&gr.name, &gr.members, &gr.used, &gr.hit, &gr.last); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("scan error: %v", err)
+		}
+		groups = append(groups, gr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+	if len(groups) == 0 {
+		return "nothing to report: no " + strings.ReplaceAll(by, "_", " ") + "s", nil
+	}
+
+	rows, err = db.QueryContext(ctx, restrictVisibility(fmt.Sprintf(g.buckets, fmt.Sprintf(tagPeriods[period], "a.day")), levels), from)
+	if err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+	heat := make(map[string]map[string]int64)
+	for rows.Next() {
+		var name, start string
+		var n int64
+		if err := rows.Scan(&name, &start, &n); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("scan error: %v", err)
+		}
+		if heat[name] == nil {
+			heat[name] = make(map[string]int64)
+		}
+		heat[name][start] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+
+	var total, unused int64
+	if err := db.QueryRowContext(ctx, restrictVisibility(g.unused, levels), from).Scan(&total, &unused); err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+	var since sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT MIN(day) FROM "+g.access).Scan(&since); err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "times recall returned %s per %s from %s, then per %s:\n", g.members, strings.ReplaceAll(by, "_", " "), from, period)
+	for _, gr := range groups {
+		counts := make([]string, len(starts))
+		for i, s := range starts {
+			counts[i] = fmt.Sprint(heat[gr.name][s])
+		}
+		fmt.Fprintf(&sb, "%s: %d hits", gr.name, gr.hit)
+		if by != "entity" {
+			fmt.Fprintf(&sb, " on %d of %d %s", gr.used, gr.members, g.members)
+		}
+		if gr.last != "" {
+			fmt.Fprintf(&sb, ", last %s", gr.last)
+		}
+		fmt.Fprintf(&sb, " [%s]\n", strings.Join(counts, " "))
+	}
+	fmt.Fprintf(&sb, "\n%d of %d %s were not returned since %s", unused, total, g.members, from)
+	switch {
+	case !trackAccess:
+		sb.WriteString("\naccess is not being counted (ENGRAM_TRACK_ACCESS=false)")
+	case !since.Valid:
+		sb.WriteString("\nnothing has been counted yet: search_nodes, open_nodes, ask_memory and semantic_search count what they return")
+	case since.String > from:
+		fmt.Fprintf(&sb, "\naccess has only been counted since %s", since.String)
+	}
+	return sb.String(), nil
+}
+
+// registerHeatmap adds the heatmap tool.
+func registerHeatmap(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("heatmap",
+		mcp.WithDescription(`Report how often search_nodes, open_nodes, ask_memory and semantic_search returned the observations under each tag, or the entities of each type or each entity, per week or month, with how many of them were returned at all and when last.
+
+Use it with the user to see which parts of memory agents actually use. sort 'least' lists the coldest groups first, candidates to archive or prune.`),
+		mcp.WithString("by",
+			mcp.Description("Group hits by 'tag' (default), 'entity_type' or 'entity'"),
+			mcp.Enum("tag", "entity_type", "entity"),
+		),
+		mcp.WithString("period",
+			mcp.Description("Bucket: 'month' (default) or 'week'"),
+			mcp.Enum("week", "month"),
+		),
+		mcp.WithNumber("periods",
+			mcp.Description("Number of buckets back from now (default 6, max 52)"),
+		),
+		mcp.WithString("sort",
+			mcp.Description("'most' (default) for the most returned groups first, 'least' for the least"),
+			mcp.Enum("most", "least"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum groups to return (default 20, max 500)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), heatmapHandler(db, scopes))
+}
+
+func heatmapHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		by := request.GetString("by", "tag")
+		if _, ok := heatmapGroupings[by]; !ok {
+			return toolError(codeInvalidArgument, "by must be 'tag', 'entity_type' or 'entity'"), nil
+		}
+		period := request.GetString("period", "month")
+		if _, ok := tagPeriods[period]; !ok {
+			return toolError(codeInvalidArgument, "period must be 'week' or 'month'"), nil
+		}
+		periods := request.GetInt("periods", 6)
+		if periods < 1 || periods > 52 {
+			return toolError(codeInvalidArgument, "periods must be between 1 and 52"), nil
+		}
+		limit := request.GetInt("limit", 20)
+		if limit < 1 || limit > 500 {
+			return toolError(codeInvalidArgument, "limit must be between 1 and 500"), nil
+		}
+		sort := request.GetString("sort", "most")
+		if sort != "most" && sort != "least" {
+			return toolError(codeInvalidArgument, "sort must be 'most' or 'least'"), nil
+		}
+
+		report, err := buildHeatmap(ctx, db, scopes.levels(ctx), by, period, periods, limit, sort == "least", time.Now())
+		if err != nil {
+			return toolErrorFrom(err, codeDatabase), nil
+		}
+		return mcp.NewToolResultText(report), nil
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestHeatmap_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	// Access rows outlive their observation when foreign keys are off, and
+	// a reused id would inherit them, so the test clears what it counts.
+	clearAccess := func() {
+		db.Exec("DELETE FROM observation_access WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'heatmap-test')")
+		db.Exec("DELETE FROM entity_access WHERE entity_id IN (SELECT id FROM entities WHERE name = 'heatmap-test')")
+	}
+	defer db.Exec("DELETE FROM tags WHERE name LIKE 'heatmap-%'")
+	defer db.Exec("DELETE FROM entities WHERE name = 'heatmap-test'")
+	defer clearAccess()
+
+	for _, stmt := range []string{
+		"INSERT INTO tags (name, description) VALUES ('heatmap-used', 'test'), ('heatmap-cold', 'test')",
+		"INSERT INTO entities (name, entity_type) VALUES ('heatmap-test', 'heatmap-type')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	var ids []int64
+	for _, args := range []map[string]any{
+		{"content": "heatmap used fact", "tags": "heatmap-used"},
+		{"content": "heatmap cold fact", "tags": "heatmap-cold"},
+	} {
+		args["entity"] = "heatmap-test"
+		if result, err := callTool(addObservationHandler(db, nil), "add_observation", args); err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+		var id int64
+		if err := db.QueryRow("SELECT id FROM observations WHERE content = ?", args["content"]).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	clearAccess()
+	recordAccess(ctx, db, ids[:1], nil)
+	recordAccess(ctx, db, ids[:1], nil)
+	report, err := buildHeatmap(ctx, db, visibilityLevels, "tag", "month", 2, 500, false, time.Now())
+	if err != nil {
+		t.Fatalf("buildHeatmap: %v", err)
+	}
+	for _, want := range []string{"heatmap-used: 2 hits on 1 of 1 observations, last ", "heatmap-cold: 0 hits on 0 of 1 observations [0 0]\n"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in:\n%s", want, report)
+		}
+	}
+	if line := heatmapLine(report, "heatmap-used:"); !strings.HasSuffix(line, " [0 2]") {
+		t.Errorf("expected this month's hits in %q of:\n%s", line, report)
+	}
+
+	// open_nodes counts the entity and every observation it returns.
+	if result, err := callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": []any{"heatmap-test"}}); err != nil || result.IsError {
+		t.Fatalf("open_nodes: %v %v", err, result.Content)
+	}
+	report, err = buildHeatmap(ctx, db, visibilityLevels, "tag", "week", 1, 500, true, time.Now())
+	if err != nil {
+		t.Fatalf("buildHeatmap: %v", err)
+	}
+	for _, want := range []string{"heatmap-used: 3 hits on 1 of 1 observations", "heatmap-cold: 1 hits on 1 of 1 observations"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in:\n%s", want, report)
+		}
+	}
+	report, err = buildHeatmap(ctx, db, visibilityLevels, "entity_type", "month", 1, 500, false, time.Now())
+	if err != nil {
+		t.Fatalf("buildHeatmap: %v", err)
+	}
+	if want := "heatmap-type: 3 hits on 1 of 1 entities"; !strings.Contains(report, want) {
+		t.Errorf("expected %q in:\n%s", want, report)
+	}
+
+	for _, args := range []map[string]any{{"by": "relation"}, {"period": "year"}, {"periods": 0}, {"limit": 1000}, {"sort": "hot"}} {
+		result, err := callTool(heatmapHandler(db, nil), "heatmap", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Errorf("heatmap %v: expected error, got %v", args, result.Content[0].(mcp.TextContent).Text)
+		}
+	}
+}
+
+// heatmapLine returns the line of report starting with prefix.
+func heatmapLine(report, prefix string) string {
+	for _, line := range strings.Split(report, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
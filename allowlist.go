@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// writableTables restricts which tables the execute tool may write to. Empty
+// means every table is writable.
+var writableTables = parseTableList(getEnv("ENGRAM_WRITABLE_TABLES", ""))
+
+func parseTableList(s string) map[string]bool {
+	tables := make(map[string]bool)
+	for _, t := range parseTagNames(s) {
+		tables[strings.ToLower(t)] = true
+	}
+	return tables
+}
+
+// writeTarget returns the unquoted, unqualified table an INSERT, REPLACE,
+// UPDATE or DELETE writes to, or "" if it cannot be determined.
+func writeTarget(sqlStr string) string {
+	stmt, err := parseStatement(sqlStr)
+	if err != nil {
+		return ""
+	}
+	return stmt.table
+}
+
+// checkWritable rejects a write to a table outside allowed. Reads pass.
+func checkWritable(sqlStr string, allowed map[string]bool) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	stmt, err := parseStatement(sqlStr)
+	if err != nil {
+		return err
+	}
+	if !stmt.isWrite() {
+		return nil
+	}
+	table := stmt.table
+	if table == "" {
+		return errorf(codeTableNotWritable, "could not determine the table this statement writes to")
+	}
+	if !allowed[table] {
+		names := make([]string, 0, len(allowed))
+		for t := range allowed {
+			names = append(names, t)
+		}
+		sort.Strings(names)
+		return errorf(codeTableNotWritable, "writes to %s are not allowed. Writable tables: %s", table, strings.Join(names, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWriteTarget(t *testing.T) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"INSERT INTO observations (entity_id, content) VALUES (1, 'x')", "observations"},
+		{"insert into observations(entity_id, content) values (1, 'x')", "observations"},
+		{"INSERT OR IGNORE INTO tags (name) VALUES ('x')", "tags"},
+		{`INSERT INTO "tags" (name) VALUES ('x')`, "tags"},
+		{"INSERT INTO main.tags (name) VALUES ('x')", "tags"},
+		{"UPDATE tags SET description = 'x' WHERE id = 1", "tags"},
+		{"UPDATE OR REPLACE Tags SET name = 'x' WHERE id = 1", "tags"},
+		{"  DELETE FROM relations WHERE id = 1", "relations"},
+		{"DELETE FROM [entities] WHERE id = 1", "entities"},
+		{"REPLACE INTO tags (name) VALUES ('x')", "tags"},
+		{"WITH t AS (SELECT 1) DELETE FROM relations WHERE id IN t", "relations"},
+		{"/* observations */ INSERT INTO `entities` (name) VALUES ('x')", "entities"},
+		{"SELECT * FROM tags", ""},
+	}
+
+	for _, tt := range tests {
+		if got := writeTarget(tt.sql); got != tt.expected {
+			t.Errorf("writeTarget(%q) = %q, want %q", tt.sql, got, tt.expected)
+		}
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	allowed := parseTableList("observations, Relations")
+	tests := []struct {
+		name    string
+		sql     string
+		allowed map[string]bool
+		wantErr bool
+	}{
+		{"no allowlist", "UPDATE tags SET name = 'x' WHERE id = 1", nil, false},
+		{"allowed insert", "INSERT INTO observations (entity_id, content) VALUES (1, 'x')", allowed, false},
+		{"allowed case insensitive", "DELETE FROM RELATIONS WHERE id = 1", allowed, false},
+		{"blocked update", "UPDATE tags SET name = 'x' WHERE id = 1", allowed, true},
+		{"blocked qualified", "DELETE FROM main.tags WHERE id = 1", allowed, true},
+		{"blocked after with", "WITH x AS (SELECT 1) INSERT INTO tags (name) SELECT * FROM x", allowed, true},
+		{"read passes", "SELECT * FROM tags", allowed, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWritable(tt.sql, tt.allowed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkWritable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultAskLimit = 8
+	maxAskLimit     = 30
+	maxAskTerms     = 8
+	// rrfK damps reciprocal rank fusion so the top of one list does not
+	// drown out agreement between both.
+	rrfK = 60
+)
+
+// passage is one observation ask_memory returns, cited as Cite.
+type passage struct {
+	Cite       string   `json:"cite"`
+	Entity     string   `json:"entity"`
+	EntityType string   `json:"entityType"`
+	Content    string   `json:"content"`
+	CreatedAt  string   `json:"createdAt"`
+	Tags       []string `json:"tags"`
+	Language   string   `json:"language,omitempty"`
+	MatchedBy  []string `json:"matchedBy"`
+	// VerifiedAt and VerifiedBy are set on passages a person confirmed
+	// with verify.
+	VerifiedAt string `json:"verifiedAt,omitempty"`
+	VerifiedBy string `json:"verifiedBy,omitempty"`
+	// Parent cites the observation this one corrects or follows up.
+	Parent string `json:"parent,omitempty"`
+}
+
+type askResult struct {
+	Question     string    `json:"question"`
+	Instructions string    `json:"instructions"`
+	Summary      string    `json:"summary,omitempty"`
+	Passages     []passage `json:"passages"`
+	Notes        []string  `json:"notes,omitempty"`
+	Snapshot     string    `json:"snapshot,omitempty"`
+}
+
+// citation is the stable id of an observation in ask_memory answers.
+func citation(id int64) string { return fmt.Sprintf("obs:%d", id) }
+
+// questionTerms are the words of a question worth matching, longest first.
+// Function words of every search language are dropped and the rest stemmed
+// in the question's language, so inflected forms match each other.
+func questionTerms(question string) []string {
+	lang := detectLanguage(question)
+	seen := make(map[string]bool)
+	var terms []string
+	for w := range labelWords(question) {
+		if isStopword(w) {
+			continue
+		}
+		if t := searchTerm(w, lang); utf8.RuneCountInString(t) >= 3 && !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if len(terms[i]) != len(terms[j]) {
+			return len(terms[i]) > len(terms[j])
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > maxAskTerms {
+		terms = terms[:maxAskTerms]
+	}
+	return terms
+}
+
+// keywordMatches ranks observations by how many terms their content or
+// entity name contains, as a substring or, through the full-text indexes, as
+// a word prefix regardless of case and diacritics.
+func keywordMatches(ctx context.Context, db *sql.DB, levels []string, terms []string, limit int) ([]int64, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	hits := make([]string, len(terms))
+	var args []any
+	for i, t := range terms {
+		hits[i] = `(o.content LIKE ? ESCAPE '\' OR e.name LIKE ? ESCAPE '\'
+			OR o.id IN (SELECT rowid FROM observations_fts WHERE observations_fts MATCH ?)
+			OR e.id IN (SELECT rowid FROM entities_fts WHERE entities_fts MATCH ?))`
+		pattern := "%" + likeEscaper.Replace(t) + "%"
+		args = append(args, pattern, pattern, ftsPrefix(t), ftsPrefix(t))
+	}
+	args = append(args, limit)
+	rows, err := db.QueryContext(ctx, restrictVisibility(`SELECT o.id FROM (SELECT o.id, `+strings.Join(hits, " + ")+` AS hits
+			FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.archived_at IS NULL) o
+		WHERE o.hits > 0 ORDER BY o.hits DESC, o.id DESC LIMIT ?`, levels), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ftsPrefix is an FTS5 query for words starting with term, quoted so its
+// characters are not read as query syntax.
+func ftsPrefix(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+}
+
+// fuseRankings merges ranked id lists by reciprocal rank fusion, returning
+// the ids best first and which lists found each. votes, the net feedback
+// on ids, moves them up or down; it never adds an id the lists lack.
+func fuseRankings(lists map[string][]int64, votes map[int64]int, limit int) ([]int64, map[int64][]string) {
+	scores := make(map[int64]float64)
+	found := make(map[int64][]string)
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for rank, id := range lists[name] {
+			scores[id] += 1 / float64(rrfK+rank+1)
+			found[id] = append(found[id], name)
+		}
+	}
+	ids := make([]int64, 0, len(scores))
+	for id := range scores {
+		scores[id] += feedbackBoost(votes[id])
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, found
+}
+
+// registerAskMemory adds the ask_memory tool.
+func registerAskMemory(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes, rerank sampler, embedder Embedder, vectors *vectorIndex) {
+	s.AddTool(mcp.NewTool("ask_memory",
+		mcp.WithDescription(`Recall what memory knows to answer a question. Returns the most relevant observations as passages with their entity, date, tags and a stable cite id such as obs:12.
+
+Passages are found by keyword and, with ENGRAM_EMBEDDER set, by meaning, and merged into one ranking. Answer from the passages and cite them as [obs:12] so the user can check where each fact came from.`),
+		mcp.WithString("question",
+			mcp.Required(),
+			mcp.Description("The question in natural language, e.g. 'what disks are in the NAS?'"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum passages to return (default %d, max %d)", defaultAskLimit, maxAskLimit)),
+		),
+		mcp.WithBoolean("snapshot",
+			mcp.Description("Keep the passages returned, in order, under a snapshot id for get_recall_snapshot (default: ENGRAM_RECALL_SNAPSHOTS)"),
+		),
+		mcp.WithBoolean("prefer_verified",
+			mcp.Description("Rank passages a person confirmed with verify above the others the searches found (default: ENGRAM_PREFER_VERIFIED)"),
+		),
+		mcp.WithBoolean("include_history",
+			mcp.Description("Keep passages a correction or follow-up has superseded instead of replacing them with the latest item of their thread (default false)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), askMemoryHandler(db, embedder, vectors, scopes, rerank))
+}
+
+// askMemoryHandler answers ask_memory. smp, when set, re-ranks and
+// summarises the passages with the client's model.
+func askMemoryHandler(db *sql.DB, e Embedder, idx *vectorIndex, scopes *visibilityScopes, smp sampler) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		question := strings.TrimSpace(request.GetString("question", ""))
+		if question == "" {
+			return toolError(codeInvalidArgument, "question parameter is required"), nil
+		}
+		limit := request.GetInt("limit", defaultAskLimit)
+		if limit < 1 || limit > maxAskLimit {
+			return toolErrorf(codeInvalidArgument, "limit must be between 1 and %d", maxAskLimit), nil
+		}
+		levels := scopes.levels(ctx)
+		result := askResult{
+			Question: question,
+			Instructions: "Answer the question from these passages only, citing each fact with the passage's cite in brackets, e.g. [obs:12]. " +
+				"If they do not answer it, say the memory does not know.",
+			Passages: []passage{},
+		}
+
+		lists := make(map[string][]int64)
+		terms := questionTerms(question)
+		searchCtx, sp := startSpan(ctx, "keyword search", spanKindInternal)
+		sp.set("search.terms", strings.Join(terms, " "))
+		keyword, err := keywordMatches(searchCtx, db, levels, terms, limit*2)
+		sp.set("search.hits", len(keyword))
+		sp.fail(err)
+		sp.finish()
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "search failed: %v", err), nil
+		}
+		lists["keyword"] = keyword
+		if e == nil {
+			result.Notes = append(result.Notes, "semantic search is off (ENGRAM_EMBEDDER unset), passages matched by keyword only")
+		} else {
+			searchCtx, sp := startSpan(ctx, "semantic search", spanKindInternal)
+			sp.set("embedding.model", e.Model())
+			if vectors, err := e.Embed(searchCtx, []string{question}); err != nil {
+				sp.fail(err)
+				result.Notes = append(result.Notes, fmt.Sprintf("semantic search failed, passages matched by keyword only: %v", err))
+			} else {
+				semantic, err := idx.search(searchCtx, db, levels, e.Model(), vectors[0], limit*2)
+				if err != nil {
+					sp.fail(err)
+					sp.finish()
+					return toolErrorf(errorCode(err, codeDatabase), "search failed: %v", err), nil
+				}
+				for _, r := range semantic {
+					lists["semantic"] = append(lists["semantic"], r["id"].(int64))
+				}
+				sp.set("search.hits", len(semantic))
+			}
+			sp.finish()
+		}
+
+		var candidates []int64
+		for _, l := range lists {
+			candidates = append(candidates, l...)
+		}
+		votes, err := feedbackScores(ctx, db, candidates)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read feedback: %v", err), nil
+		}
+		// respond counts the passages returned and keeps a snapshot of the
+		// answer when asked to, so what the agent was shown can be looked up
+		// later with get_recall_snapshot.
+		respond := func() *mcp.CallToolResult {
+			var returned []int64
+			for _, p := range result.Passages {
+				if id, err := parseCitation(p.Cite); err == nil {
+					returned = append(returned, id)
+				}
+			}
+			recordAccess(ctx, db, returned, nil)
+			if request.GetBool("snapshot", recallSnapshots) {
+				client, _ := clientName(ctx)
+				if id, err := saveRecallSnapshot(ctx, db, client, levels, result); err != nil {
+					result.Notes = append(result.Notes, fmt.Sprintf("failed to keep a snapshot of this answer: %v", err))
+				} else {
+					result.Snapshot = snapshotCitation(id)
+				}
+			}
+			return graphResult(result)
+		}
+		// Preferring verified passages ranks every candidate, so a verified
+		// one just past the limit can still displace an unverified one.
+		prefer := request.GetBool("prefer_verified", preferVerified)
+		fuseLimit := limit
+		if prefer {
+			fuseLimit = len(candidates)
+		}
+		ids, found := fuseRankings(lists, votes, fuseLimit)
+		if prefer {
+			verified, err := verifiedIDs(ctx, db, ids)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to read verifications: %v", err), nil
+			}
+			verifiedFirst(ids, verified)
+			if len(ids) > limit {
+				ids = ids[:limit]
+			}
+		}
+		// A passage that a correction or follow-up has superseded gives way
+		// to the latest item of its thread.
+		if !request.GetBool("include_history", false) {
+			latest, err := latestInThreads(ctx, db, levels, ids)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to read threads: %v", err), nil
+			}
+			var replaced int
+			if ids, replaced = collapseThreads(ids, latest, found); replaced > 0 {
+				result.Notes = append(result.Notes, fmt.Sprintf("%d passages were replaced by the latest correction or follow-up in their thread; pass include_history to see the earlier ones", replaced))
+			}
+		}
+		if len(ids) == 0 {
+			return respond(), nil
+		}
+		args := make([]any, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		rows, err := db.QueryContext(ctx, restrictVisibility(`SELECT o.id, e.name, e.entity_type, o.content, o.created_at,
+				COALESCE((SELECT group_concat(t.name, ',') FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), ''),
+				COALESCE((SELECT language FROM observation_languages WHERE observation_id = o.id AND language <> 'und'), ''),
+				o.verified_at, COALESCE(o.verified_by, ''), o.parent_id
+			FROM observations o JOIN entities e ON e.id = o.entity_id
+			WHERE o.id IN (`+placeholders(len(ids))+`)`, levels), args...)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "search failed: %v", err), nil
+		}
+		defer rows.Close()
+		byID := make(map[int64]passage, len(ids))
+		for rows.Next() {
+			var id int64
+			var p passage
+			var createdAt, verifiedAt any
+			var parentID sql.NullInt64
+			var tags string
+			if err := rows.Scan(&id, &p.Entity, &p.EntityType, &p.Content, &createdAt, &tags, &p.Language, &verifiedAt, &p.VerifiedBy, &parentID); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "search failed: %v", err), nil
+			}
+			p.Cite, p.CreatedAt, p.MatchedBy = citation(id), formatValue(createdAt), found[id]
+			if verifiedAt != nil {
+				p.VerifiedAt = formatValue(verifiedAt)
+			}
+			if parentID.Valid {
+				p.Parent = citation(parentID.Int64)
+			}
+			p.Tags = parseTagNames(tags)
+			sort.Strings(p.Tags)
+			if p.Tags == nil {
+				p.Tags = []string{}
+			}
+			byID[id] = p
+		}
+		if err := rows.Err(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "search failed: %v", err), nil
+		}
+		for _, id := range ids {
+			if p, ok := byID[id]; ok {
+				result.Passages = append(result.Passages, p)
+			}
+		}
+
+		if smp != nil && len(result.Passages) > 0 {
+			rerankCtx, sp := startSpan(ctx, "rerank", spanKindInternal)
+			ranked, summary, err := rerankPassages(rerankCtx, smp, question, result.Passages)
+			sp.fail(err)
+			sp.finish()
+			if err != nil {
+				result.Notes = append(result.Notes, fmt.Sprintf("passages are in search order, re-ranking by the client's model failed: %v", err))
+			} else {
+				if left := len(result.Passages) - len(ranked); left > 0 {
+					result.Notes = append(result.Notes, fmt.Sprintf("the client's model judged %d passages irrelevant and they were left out", left))
+				}
+				result.Passages, result.Summary = ranked, summary
+			}
+		}
+		return respond(), nil
+	}
+}
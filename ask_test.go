@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestQuestionTerms(t *testing.T) {
+	tests := []struct {
+		question string
+		want     []string
+	}{
+		{"What disks are in the NAS?", []string{"disk", "nas"}},
+		{"where does the user's backup go", []string{"backup", "user"}},
+		{"Nilinunua gari gani mwaka jana?", []string{"mwaka", "nunua", "gari"}},
+		{"how?", nil},
+		{"one two three four five six seven eight nine tenth", []string{"eight", "seven", "tenth", "three", "five", "four", "nine", "one"}},
+	}
+	for _, tt := range tests {
+		if got := questionTerms(tt.question); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("questionTerms(%q) = %v, want %v", tt.question, got, tt.want)
+		}
+	}
+}
+
+func TestFuseRankings(t *testing.T) {
+	lists := map[string][]int64{
+		"keyword":  {1, 2, 3},
+		"semantic": {3, 4},
+	}
+	ids, found := fuseRankings(lists, nil, 3)
+	// 3 is in both lists, so it beats 1, which tops one list alone; 4 and 2
+	// are second in one list each and tie, newest first.
+	if want := []int64{3, 1, 4}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("fuseRankings() = %v, want %v", ids, want)
+	}
+	if want := []string{"keyword", "semantic"}; !reflect.DeepEqual(found[3], want) {
+		t.Errorf("found[3] = %v, want %v", found[3], want)
+	}
+	if ids, _ := fuseRankings(nil, nil, 3); len(ids) != 0 {
+		t.Errorf("fuseRankings(nil) = %v", ids)
+	}
+}
+
+func TestAskMemory_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM observation_embeddings")
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'ask-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'ask test %'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('ask-test-nas', 'device'), ('ask-test-desk', 'furniture')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var ids []int64
+	for _, args := range []map[string]any{
+		{"entity": "ask-test-nas", "content": "ask test holds four 8TB disks in raidz1", "visibility": "public"},
+		{"entity": "ask-test-nas", "content": "ask test scrubs the pool on Sundays"},
+		{"entity": "ask-test-desk", "content": "ask test standing desk, bought 2024", "visibility": "public"},
+	} {
+		args["tags"] = "homelab"
+		result, err := callTool(addObservationHandler(db, nil), "add_observation", args)
+		if err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+		var id int64
+		if _, err := fmt.Sscanf(result.Content[0].(mcp.TextContent).Text, "success: observation %d", &id); err != nil {
+			t.Fatalf("parse id: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	e := localEmbedder{dims: 256}
+	if _, err := embedAll(ctx, db, e, 64); err != nil {
+		t.Fatalf("embedAll: %v", err)
+	}
+
+	ask := func(e Embedder, scopes *visibilityScopes, args map[string]any) askResult {
+		t.Helper()
+		result, err := callTool(askMemoryHandler(db, e, nil, scopes, nil), "ask_memory", args)
+		if err != nil || result.IsError {
+			t.Fatalf("ask_memory: %v %v", err, result.Content)
+		}
+		var got askResult
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+
+	got := ask(e, nil, map[string]any{"question": "Which disks are in the raidz1 array?", "limit": 2})
+	if len(got.Passages) != 2 {
+		t.Fatalf("got %d passages, want 2: %+v", len(got.Passages), got)
+	}
+	first := got.Passages[0]
+	if first.Cite != citation(ids[0]) || first.Entity != "ask-test-nas" || first.EntityType != "device" ||
+		!reflect.DeepEqual(first.Tags, []string{"homelab"}) || !reflect.DeepEqual(first.MatchedBy, []string{"keyword", "semantic"}) {
+		t.Errorf("first passage = %+v, want the disks observation matched both ways", first)
+	}
+	if len(first.CreatedAt) != len("2006-01-02T15:04:05Z") {
+		t.Errorf("createdAt = %q, want RFC 3339", first.CreatedAt)
+	}
+
+	public, _ := parseVisibilityScopes("public", "")
+	got = ask(nil, public, map[string]any{"question": "when is the ask-test-nas pool scrubbed"})
+	for _, p := range got.Passages {
+		if p.Cite == citation(ids[1]) {
+			t.Errorf("private passage returned to a public scope: %+v", p)
+		}
+	}
+	if len(got.Notes) != 1 {
+		t.Errorf("expected a note that semantic search is off, got %v", got.Notes)
+	}
+
+	reranked, err := callTool(askMemoryHandler(db, e, nil, nil, replyText(fmt.Sprintf(`{"order": ["%s"], "summary": "Four 8TB disks [%s]."}`, citation(ids[2]), citation(ids[0])))),
+		"ask_memory", map[string]any{"question": "Which disks are in the raidz1 array?", "limit": 2})
+	if err != nil || reranked.IsError {
+		t.Fatalf("ask_memory: %v %v", err, reranked.Content)
+	}
+	got = askResult{}
+	json.Unmarshal([]byte(reranked.Content[0].(mcp.TextContent).Text), &got)
+	if got.Summary != "Four 8TB disks [obs:"+fmt.Sprint(ids[0])+"]." || len(got.Notes) != 1 {
+		t.Errorf("reranked result = %+v, want the summary and a note on the dropped passage", got)
+	}
+
+	if got := ask(nil, nil, map[string]any{"question": "zzqx-ask-nothing"}); len(got.Passages) != 0 {
+		t.Errorf("expected no passages, got %+v", got.Passages)
+	}
+	for _, args := range []map[string]any{{}, {"question": "x", "limit": 100}} {
+		if result, _ := callTool(askMemoryHandler(db, nil, nil, nil, nil), "ask_memory", args); !result.IsError {
+			t.Errorf("ask_memory %v: expected an error", args)
+		}
+	}
+}
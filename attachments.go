@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// attachmentDir, when set, stores attachment contents as files named by their
+// SHA-256 under this directory (a local disk, or an S3 bucket mounted with
+// e.g. s3fs or mountpoint-s3) instead of as blobs in the database.
+var (
+	attachmentDir      = getEnv("ENGRAM_ATTACHMENT_DIR", "")
+	attachmentMaxBytes = getEnvInt("ENGRAM_ATTACHMENT_MAX_BYTES", 10*1024*1024)
+)
+
+// storeAttachmentData saves data per attachmentDir and returns the values for
+// the data and path columns; exactly one is non-nil.
+func storeAttachmentData(data []byte, sum string) (any, any, error) {
+	if attachmentDir == "" {
+		return data, nil, nil
+	}
+	path, err := attachmentPath(sum)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return nil, nil, err
+	}
+	return nil, path, os.Rename(tmp, path)
+}
+
+// attachmentPath is where attachmentDir keeps the file with SHA-256 sum.
+func attachmentPath(sum string) (string, error) {
+	if attachmentDir == "" {
+		return "", errorf(codeUnavailable, "ENGRAM_ATTACHMENT_DIR is not set")
+	}
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid attachment sha256 %q", sum)
+	}
+	return filepath.Join(attachmentDir, sum[:2], sum), nil
+}
+
+// readAttachmentFile reads the file stored for sum. The path column is not
+// trusted, since execute can set it to anything: the file is looked up by
+// its digest, and refused if a symlink takes it outside attachmentDir.
+func readAttachmentFile(sum string) ([]byte, error) {
+	path, err := attachmentPath(sum)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.EvalSymlinks(attachmentDir)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside ENGRAM_ATTACHMENT_DIR", path)
+	}
+	return os.ReadFile(resolved)
+}
+
+func attachmentMIMEType(name string, data []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+func isTextMIMEType(t string) bool {
+	t, _, _ = strings.Cut(t, ";")
+	return strings.HasPrefix(t, "text/") || t == "application/json" || t == "application/xml" ||
+		t == "application/yaml" || t == "application/x-yaml" || t == "application/toml"
+}
+
+// registerAttachments adds the attach and get_attachment tools.
+func registerAttachments(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("attach",
+		mcp.WithDescription(`Attach a file, image or link to an observation, e.g. a config file, a screenshot or a PDF the observation is about.
+
+Pass exactly one of text (for text files such as configs), content_base64 (for binary files such as images and PDFs) or url (to link to something stored elsewhere).`),
+		mcp.WithNumber("observation_id",
+			mcp.Required(),
+			mcp.Description("ID of the observation the attachment belongs to"),
+		),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("File name, e.g. 'nas-compose.yml'; its extension sets the MIME type when mime_type is not given"),
+		),
+		mcp.WithString("text",
+			mcp.Description("Contents of a text attachment"),
+		),
+		mcp.WithString("content_base64",
+			mcp.Description(fmt.Sprintf("Base64-encoded contents of a binary attachment, at most %d bytes decoded", attachmentMaxBytes)),
+		),
+		mcp.WithString("url",
+			mcp.Description("URL of an attachment stored elsewhere"),
+		),
+		mcp.WithString("mime_type",
+			mcp.Description("MIME type, e.g. 'image/png' (default: from the name or contents)"),
+		),
+	), attachHandler(db))
+
+	s.AddTool(mcp.NewTool("get_attachment",
+		mcp.WithDescription("Read an attachment by id. Text is returned as text, images as images and other files as an embedded resource; links return their URL. Find ids with: SELECT id, name, mime_type, size FROM attachments WHERE observation_id = ?"),
+		mcp.WithNumber("id",
+			mcp.Required(),
+			mcp.Description("ID of the attachment"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), getAttachmentHandler(db, scopes))
+}
+
+func attachHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		observationID, err := request.RequireInt("observation_id")
+		if err != nil {
+			return toolError(codeInvalidArgument, "observation_id parameter is required"), nil
+		}
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			return toolError(codeInvalidArgument, "name parameter is required, e.g. 'nas-compose.yml'"), nil
+		}
+
+		text := request.GetString("text", "")
+		encoded := request.GetString("content_base64", "")
+		link := strings.TrimSpace(request.GetString("url", ""))
+		given := 0
+		for _, v := range []string{text, encoded, link} {
+			if v != "" {
+				given++
+			}
+		}
+		if given != 1 {
+			return toolError(codeInvalidArgument, "pass exactly one of text, content_base64 or url"), nil
+		}
+
+		var exists int
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM observations WHERE id = ?", observationID).Scan(&exists); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error looking up observation %d: %v", observationID, err), nil
+		}
+		if exists == 0 {
+			return toolErrorf(codeNotFound, "observation %d does not exist", observationID), nil
+		}
+
+		mimeType := strings.TrimSpace(request.GetString("mime_type", ""))
+		if link != "" {
+			if u, err := url.Parse(link); err != nil || u.Scheme == "" || u.Host == "" {
+				return toolErrorf(codeInvalidArgument, "invalid url %q", link), nil
+			}
+			result, err := db.ExecContext(ctx, "INSERT INTO attachments (observation_id, name, mime_type, url) VALUES (?, ?, ?, ?)",
+				observationID, name, nullIfEmpty(mimeType), link)
+			if err != nil {
+				return execError(err, codeDatabase), nil
+			}
+			id, _ := result.LastInsertId()
+			return mcp.NewToolResultText(fmt.Sprintf("success: attachment %d links %s to observation %d", id, link, observationID)), nil
+		}
+
+		data := []byte(text)
+		if encoded != "" {
+			if data, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+				return toolErrorf(codeInvalidArgument, "content_base64 is not valid base64: %v", err), nil
+			}
+		}
+		if len(data) > attachmentMaxBytes {
+			return toolErrorf(codeInvalidArgument, "attachment is %d bytes, over the %d byte limit", len(data), attachmentMaxBytes), nil
+		}
+		if mimeType == "" {
+			mimeType = attachmentMIMEType(name, data)
+		}
+		tagIDs, err := observationTagIDs(ctx, db, int64(observationID))
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error looking up tags of observation %d: %v", observationID, err), nil
+		}
+		if err := checkTagQuotas(ctx, db, tagIDs, len(data)); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		sum := sha256.Sum256(data)
+		digest := hex.EncodeToString(sum[:])
+		blob, path, err := storeAttachmentData(data, digest)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to store attachment: %v", err), nil
+		}
+		result, err := db.ExecContext(ctx, `INSERT INTO attachments (observation_id, name, mime_type, size, sha256, data, path)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, observationID, name, mimeType, len(data), digest, blob, path)
+		if err != nil {
+			return execError(err, codeDatabase), nil
+		}
+		id, _ := result.LastInsertId()
+		return mcp.NewToolResultText(fmt.Sprintf("success: attachment %d (%s, %s, %d bytes) added to observation %d", id, name, mimeType, len(data), observationID)), nil
+	}
+}
+
+func getAttachmentHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, err := request.RequireInt("id")
+		if err != nil {
+			return toolError(codeInvalidArgument, "id parameter is required"), nil
+		}
+
+		var observationID int64
+		var name string
+		var mimeType, link, path, sum sql.NullString
+		var data []byte
+		err = db.QueryRowContext(ctx, restrictVisibility(`SELECT a.observation_id, a.name, a.mime_type, a.url, a.path, a.sha256, a.data
+			FROM attachments a JOIN observations o ON o.id = a.observation_id WHERE a.id = ?`, scopes.levels(ctx)), id).
+			Scan(&observationID, &name, &mimeType, &link, &path, &sum, &data)
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "attachment %d does not exist", id), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error reading attachment %d: %v", id, err), nil
+		}
+
+		header := fmt.Sprintf("attachment %d of observation %d: %s", id, observationID, name)
+		if link.Valid {
+			return mcp.NewToolResultText(fmt.Sprintf("%s\nurl: %s", header, link.String)), nil
+		}
+		if path.Valid {
+			if data, err = readAttachmentFile(sum.String); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to read attachment %d: %v", id, err), nil
+			}
+		}
+
+		header += fmt.Sprintf(" (%s, %d bytes)", mimeType.String, len(data))
+		switch {
+		case isTextMIMEType(mimeType.String):
+			return mcp.NewToolResultText(header + "\n\n" + string(data)), nil
+		case strings.HasPrefix(mimeType.String, "image/"):
+			return mcp.NewToolResultImage(header, base64.StdEncoding.EncodeToString(data), mimeType.String), nil
+		default:
+			return mcp.NewToolResultResource(header, mcp.BlobResourceContents{
+				URI:      fmt.Sprintf("memory://attachment/%d", id),
+				MIMEType: mimeType.String,
+				Blob:     base64.StdEncoding.EncodeToString(data),
+			}), nil
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestAttachmentMIMEType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"config.json", []byte("{}"), "application/json"},
+		{"notes.txt", []byte("hello"), "text/plain; charset=utf-8"},
+		{"screenshot", png, "image/png"},
+		{"unknown", []byte{0, 1, 2}, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attachmentMIMEType(tt.name, tt.data); got != tt.want {
+				t.Errorf("attachmentMIMEType(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttachments_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'attach-test-nas'")
+	defer db.Exec("DELETE FROM attachments WHERE name LIKE 'attach-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content = 'attach test nas runs compose'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('attach-test-nas', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var observationID int64
+	if err := db.QueryRow(`INSERT INTO observations (entity_id, content, visibility)
+		SELECT id, 'attach test nas runs compose', 'private' FROM entities WHERE name = 'attach-test-nas' RETURNING id`).Scan(&observationID); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	attach := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		args["observation_id"] = float64(observationID)
+		result, err := callTool(attachHandler(db), "attach", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+	get := func(name string) *mcp.CallToolResult {
+		t.Helper()
+		var id int64
+		if err := db.QueryRow("SELECT id FROM attachments WHERE name = ?", name).Scan(&id); err != nil {
+			t.Fatalf("lookup %s: %v", name, err)
+		}
+		result, err := callTool(getAttachmentHandler(db, nil), "get_attachment", map[string]any{"id": float64(id)})
+		if err != nil || result.IsError {
+			t.Fatalf("get_attachment %s: %v %v", name, err, result.Content)
+		}
+		return result
+	}
+
+	t.Run("rejects bad input", func(t *testing.T) {
+		for _, args := range []map[string]any{
+			{"name": "attach-test-none"},
+			{"name": "attach-test-both", "text": "a", "url": "https://example.com"},
+			{"name": "attach-test-url", "url": "not a url"},
+			{"name": "attach-test-b64", "content_base64": "%%%"},
+		} {
+			if result := attach(args); !result.IsError {
+				t.Errorf("%v: expected an error", args)
+			}
+		}
+		result, _ := callTool(attachHandler(db), "attach", map[string]any{"observation_id": float64(-1), "name": "attach-test-x", "text": "x"})
+		if !result.IsError {
+			t.Error("expected an error for a missing observation")
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		if result := attach(map[string]any{"name": "attach-test-compose.yml", "text": "services:\n  jellyfin: {}\n"}); result.IsError {
+			t.Fatalf("attach: %v", result.Content)
+		}
+		result := get("attach-test-compose.yml")
+		if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "jellyfin") || !strings.Contains(text, "yaml") {
+			t.Errorf("unexpected text %q", text)
+		}
+	})
+
+	t.Run("image", func(t *testing.T) {
+		png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+		attach(map[string]any{"name": "attach-test-screen", "content_base64": png})
+		result := get("attach-test-screen")
+		image, ok := result.Content[1].(mcp.ImageContent)
+		if !ok || image.MIMEType != "image/png" || image.Data != png {
+			t.Errorf("unexpected content %+v", result.Content)
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		attach(map[string]any{"name": "attach-test-manual.pdf", "content_base64": base64.StdEncoding.EncodeToString([]byte("%PDF-1.4"))})
+		result := get("attach-test-manual.pdf")
+		resource, ok := result.Content[1].(mcp.EmbeddedResource)
+		if !ok {
+			t.Fatalf("unexpected content %+v", result.Content)
+		}
+		if blob := resource.Resource.(mcp.BlobResourceContents); blob.MIMEType != "application/pdf" {
+			t.Errorf("mime type = %q", blob.MIMEType)
+		}
+	})
+
+	t.Run("url", func(t *testing.T) {
+		attach(map[string]any{"name": "attach-test-docs", "url": "https://example.com/nas"})
+		if text := get("attach-test-docs").Content[0].(mcp.TextContent).Text; !strings.Contains(text, "https://example.com/nas") {
+			t.Errorf("unexpected text %q", text)
+		}
+	})
+
+	t.Run("directory storage", func(t *testing.T) {
+		defer func(dir string) { attachmentDir = dir }(attachmentDir)
+		attachmentDir = t.TempDir()
+
+		attach(map[string]any{"name": "attach-test-on-disk.txt", "text": "stored on disk"})
+		var path string
+		if err := db.QueryRow("SELECT path FROM attachments WHERE name = 'attach-test-on-disk.txt' AND data IS NULL").Scan(&path); err != nil {
+			t.Fatalf("lookup path: %v", err)
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != "stored on disk" {
+			t.Errorf("file %s = %q, %v", path, data, err)
+		}
+		if text := get("attach-test-on-disk.txt").Content[0].(mcp.TextContent).Text; !strings.HasSuffix(text, "stored on disk") {
+			t.Errorf("unexpected text %q", text)
+		}
+
+		// The path column is not where the file is read from.
+		outside := filepath.Join(t.TempDir(), "secret")
+		os.WriteFile(outside, []byte("outside"), 0o644)
+		db.Exec("UPDATE attachments SET path = ? WHERE name = 'attach-test-on-disk.txt'", outside)
+		if text := get("attach-test-on-disk.txt").Content[0].(mcp.TextContent).Text; !strings.HasSuffix(text, "stored on disk") {
+			t.Errorf("read through the path column: %q", text)
+		}
+		// Nor does a symlink take it outside the directory.
+		os.Remove(path)
+		if err := os.Symlink(outside, path); err != nil {
+			t.Fatalf("symlink: %v", err)
+		}
+		var id int64
+		db.QueryRow("SELECT id FROM attachments WHERE name = 'attach-test-on-disk.txt'").Scan(&id)
+		if result, _ := callTool(getAttachmentHandler(db, nil), "get_attachment", map[string]any{"id": float64(id)}); !result.IsError {
+			t.Errorf("read a file outside the directory: %v", result.Content)
+		}
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		defer func(n int) { attachmentMaxBytes = n }(attachmentMaxBytes)
+		attachmentMaxBytes = 4
+		if result := attach(map[string]any{"name": "attach-test-big.txt", "text": "too big"}); !result.IsError {
+			t.Error("expected an error over the size limit")
+		}
+	})
+
+	t.Run("visibility", func(t *testing.T) {
+		scopes, err := parseVisibilityScopes("public", "")
+		if err != nil {
+			t.Fatalf("parseVisibilityScopes: %v", err)
+		}
+		var id int64
+		db.QueryRow("SELECT id FROM attachments WHERE name = 'attach-test-compose.yml'").Scan(&id)
+		result, _ := callTool(getAttachmentHandler(db, scopes), "get_attachment", map[string]any{"id": float64(id)})
+		if !result.IsError {
+			t.Error("expected a private observation's attachment to be hidden")
+		}
+	})
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// attributeTypes are the types an entity attribute can have. Numbers and
+// booleans are stored as SQLite numbers so they compare as such; the rest
+// are text in a canonical form.
+var attributeTypes = []string{"text", "number", "boolean", "date", "email", "url", "ip"}
+
+var attributeName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// normalizeAttributeName lower-cases name and joins its words with
+// underscores, so "Date of birth" and "date-of-birth" are one attribute.
+func normalizeAttributeName(name string) (string, error) {
+	n := strings.ToLower(strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_' || r == '\t'
+	}), "_"))
+	if !attributeName.MatchString(n) {
+		return "", fmt.Errorf("invalid attribute name %q: use letters, digits and underscores, starting with a letter, e.g. 'birthday' or 'ip_address'", name)
+	}
+	return n, nil
+}
+
+// inferAttributeType is the type of a value given without one.
+func inferAttributeType(value any) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case float64, int, int64:
+		return "number"
+	}
+	return "text"
+}
+
+// normalizeAttributeValue checks value against typ and returns it in the
+// form it is stored in.
+func normalizeAttributeValue(typ string, value any) (any, error) {
+	s := strings.TrimSpace(fmt.Sprint(value))
+	if s == "" {
+		return nil, fmt.Errorf("value is required")
+	}
+	invalid := func(want string) error {
+		return fmt.Errorf("invalid %s value %q: want %s", typ, s, want)
+	}
+	switch typ {
+	case "text":
+		return s, nil
+	case "number":
+		f, ok := value.(float64)
+		if !ok {
+			var err error
+			if f, err = strconv.ParseFloat(s, 64); err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+				return nil, invalid("a number, e.g. 42 or 3.5")
+			}
+		}
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f), nil
+		}
+		return f, nil
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return boolInt(b), nil
+		}
+		switch strings.ToLower(s) {
+		case "true", "yes", "1":
+			return int64(1), nil
+		case "false", "no", "0":
+			return int64(0), nil
+		}
+		return nil, invalid("true or false")
+	case "date":
+		// --MM-DD is ISO 8601 for a date without a year, such as a birthday
+		// whose year is not known.
+		if rest, ok := strings.CutPrefix(s, "--"); ok {
+			if _, err := time.Parse("2006-01-02", "2000-"+rest); err != nil {
+				return nil, invalid("YYYY-MM-DD, or --MM-DD without a year")
+			}
+			return s, nil
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, invalid("YYYY-MM-DD, or --MM-DD without a year")
+		}
+		return s, nil
+	case "email":
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Name != "" {
+			return nil, invalid("an address such as ada@example.com")
+		}
+		return strings.ToLower(addr.Address), nil
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, invalid("an absolute URL such as https://example.com")
+		}
+		return u.String(), nil
+	case "ip":
+		if addr, err := netip.ParseAddr(s); err == nil {
+			return addr.String(), nil
+		}
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			return prefix.String(), nil
+		}
+		return nil, invalid("an IPv4 or IPv6 address, or a CIDR range such as 10.0.0.0/24")
+	}
+	return nil, fmt.Errorf("unknown type %q, want one of: %s", typ, strings.Join(attributeTypes, ", "))
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// attributeValue turns a stored value back into what it means: a bool for
+// booleans, the number or text for the rest.
+func attributeValue(typ string, v any) any {
+	if typ == "boolean" {
+		n, _ := v.(int64)
+		return n != 0
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+type attribute struct {
+	Name      string `json:"name"`
+	Value     any    `json:"value"`
+	Type      string `json:"type"`
+	Source    string `json:"source,omitempty"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type profile struct {
+	Entity     string      `json:"entity"`
+	EntityType string      `json:"entityType"`
+	Attributes []attribute `json:"attributes"`
+	// Missing lists the attributes the entity type's template has that
+	// are not set.
+	Missing []string `json:"missing,omitempty"`
+}
+
+func loadProfile(ctx context.Context, db *sql.DB, entity string) (*profile, error) {
+	p := &profile{Entity: entity, Attributes: []attribute{}}
+	var id int64
+	err := db.QueryRowContext(ctx, "SELECT id, entity_type"+entityByName, entity, entity, entity).Scan(&id, &p.EntityType)
+	if err == sql.ErrNoRows {
+		return nil, errorf(codeNotFound, "entity '%s' does not exist", entity)
+	} else if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT name, value, value_type, COALESCE(source, ''), updated_at
+		FROM entity_attributes WHERE entity_id = ? ORDER BY name`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a attribute
+		var updatedAt any
+		if err := rows.Scan(&a.Name, &a.Value, &a.Type, &a.Source, &updatedAt); err != nil {
+			return nil, err
+		}
+		a.Value, a.UpdatedAt = attributeValue(a.Type, a.Value), formatValue(updatedAt)
+		p.Attributes = append(p.Attributes, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool, len(p.Attributes))
+	for _, a := range p.Attributes {
+		have[a.Name] = true
+	}
+	for _, a := range templateFor(entityTemplates, p.EntityType).missing(have, false) {
+		p.Missing = append(p.Missing, a.String())
+	}
+	return p, nil
+}
+
+// registerAttributes adds the set_attribute, get_profile and
+// attribute_history tools.
+func registerAttributes(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("set_attribute",
+		mcp.WithDescription(`Set a typed attribute of an entity, such as a person's birthday or employer or a device's IP address. An entity has one value per attribute name; setting it again replaces the value.
+
+Use attributes for stable facts that have one current value, instead of adding an observation each time they come up. Keep observations for events, opinions and anything with history.`),
+		mcp.WithString("entity",
+			mcp.Required(),
+			mcp.Description("Entity name"),
+		),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Attribute name, e.g. 'birthday', 'ip_address' or 'employer'. Stored lower-case with underscores between words"),
+		),
+		mcp.WithAny("value",
+			mcp.Description("The value: a string, number or boolean. Required unless remove is set"),
+		),
+		mcp.WithString("type",
+			mcp.Description("Value type, checked and normalized: 'text', 'number', 'boolean', 'date' (YYYY-MM-DD, or --MM-DD without a year), 'email', 'url' or 'ip'. Default: from the value, text for strings"),
+			mcp.Enum(attributeTypes...),
+		),
+		mcp.WithString("source",
+			mcp.Description("Where the value came from, e.g. 'user' or 'inferred'"),
+		),
+		mcp.WithBoolean("remove",
+			mcp.Description("Delete the attribute instead (default false)"),
+		),
+	), setAttributeHandler(db))
+
+	s.AddTool(mcp.NewTool("get_profile",
+		mcp.WithDescription("Get an entity's attributes set with set_attribute, as typed values with where they came from and when they last changed."),
+		mcp.WithString("entity",
+			mcp.Required(),
+			mcp.Description("Entity name"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), getProfileHandler(db))
+
+	s.AddTool(mcp.NewTool("attribute_history",
+		mcp.WithDescription(`Get the values an entity's attributes had before they were changed or removed, with when each was set and replaced, newest first, alongside the current value.
+
+Use it for questions about the past, such as "what was my previous address?" or "where did Ada work before?".`),
+		mcp.WithString("entity",
+			mcp.Required(),
+			mcp.Description("Entity name"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Only this attribute, e.g. 'address' (default: all of them)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), attributeHistoryHandler(db))
+}
+
+func setAttributeHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		entity := strings.TrimSpace(request.GetString("entity", ""))
+		if entity == "" {
+			return toolError(codeInvalidArgument, "entity parameter is required"), nil
+		}
+		name, err := normalizeAttributeName(request.GetString("name", ""))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		var entityID int64
+		var entityType string
+		err = db.QueryRowContext(ctx, "SELECT id, entity_type"+entityByName, entity, entity, entity).Scan(&entityID, &entityType)
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "entity '%s' does not exist", entity), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error looking up entity '%s': %v", entity, err), nil
+		}
+
+		var old any
+		var oldType string
+		err = db.QueryRowContext(ctx, "SELECT value, value_type FROM entity_attributes WHERE entity_id = ? AND name = ?", entityID, name).Scan(&old, &oldType)
+		if err != nil && err != sql.ErrNoRows {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read %s: %v", name, err), nil
+		}
+		exists := err == nil
+
+		if request.GetBool("remove", false) {
+			if !exists {
+				return toolErrorf(codeNotFound, "%s has no attribute %s", entity, name), nil
+			}
+			if _, err := db.ExecContext(ctx, "DELETE FROM entity_attributes WHERE entity_id = ? AND name = ?", entityID, name); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to remove %s: %v", name, err), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("success: removed %s of %s (was %s)", name, entity, formatValue(attributeValue(oldType, old)))), nil
+		}
+
+		raw, ok := request.GetArguments()["value"]
+		if !ok || raw == nil {
+			return toolError(codeInvalidArgument, "value parameter is required, or pass remove to delete the attribute"), nil
+		}
+		typ, err := templateFor(entityTemplates, entityType).attributeType(name, request.GetString("type", ""), raw)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		value, err := normalizeAttributeValue(typ, raw)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		if err := storeAttribute(ctx, db, entityID, name, value, typ, request.GetString("source", "")); err != nil {
+			return execError(err, codeDatabase), nil
+		}
+
+		shown := formatValue(attributeValue(typ, value))
+		switch {
+		case !exists:
+			return mcp.NewToolResultText(fmt.Sprintf("success: set %s of %s to %s", name, entity, shown)), nil
+		case formatValue(attributeValue(oldType, old)) == shown && oldType == typ:
+			return mcp.NewToolResultText(fmt.Sprintf("success: %s of %s is already %s", name, entity, shown)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("success: changed %s of %s from %s to %s", name, entity, formatValue(attributeValue(oldType, old)), shown)), nil
+	}
+}
+
+// storeAttribute sets attribute name of an entity, leaving it untouched
+// when nothing changes so its history gains no entry.
+func storeAttribute(ctx context.Context, db execer, entityID int64, name string, value any, typ, source string) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO entity_attributes (entity_id, name, value, value_type, source) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (entity_id, name) DO UPDATE SET
+			value = excluded.value, value_type = excluded.value_type, source = excluded.source, updated_at = CURRENT_TIMESTAMP
+		WHERE value IS NOT excluded.value OR value_type IS NOT excluded.value_type OR source IS NOT excluded.source`,
+		entityID, name, value, typ, nullIfEmpty(source))
+	return err
+}
+
+func getProfileHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		entity := strings.TrimSpace(request.GetString("entity", ""))
+		if entity == "" {
+			return toolError(codeInvalidArgument, "entity parameter is required"), nil
+		}
+		p, err := loadProfile(ctx, db, entity)
+		if err != nil {
+			return toolErrorFrom(err, codeDatabase), nil
+		}
+		return graphResult(p), nil
+	}
+}
+
+// attributeValueAt is a value an attribute had, from when it was set until
+// it was replaced or removed.
+type attributeValueAt struct {
+	Value  any    `json:"value"`
+	Type   string `json:"type"`
+	Source string `json:"source,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// attributeTimeline is an attribute's current value, nil once removed, and
+// the values it had before, newest first.
+type attributeTimeline struct {
+	Name     string             `json:"name"`
+	Current  *attributeValueAt  `json:"current"`
+	Previous []attributeValueAt `json:"previous"`
+}
+
+// loadAttributeHistory returns the timelines of entityID's attributes, or
+// of the one called name when it is set, by name.
+func loadAttributeHistory(ctx context.Context, db *sql.DB, entityID int64, name string) ([]attributeTimeline, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name, value, value_type, COALESCE(source, ''), updated_at, NULL, 0 AS past, 0 AS id
+			FROM entity_attributes WHERE entity_id = ?1 AND (?2 = '' OR name = ?2)
+		UNION ALL
+		SELECT name, value, value_type, COALESCE(source, ''), valid_from, valid_to, 1, id
+			FROM entity_attribute_history WHERE entity_id = ?1 AND (?2 = '' OR name = ?2)
+		ORDER BY name, past, id DESC`, entityID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var timelines []attributeTimeline
+	for rows.Next() {
+		var n string
+		var v attributeValueAt
+		var from, to any
+		var past bool
+		var id int64
+		if err := rows.Scan(&n, &v.Value, &v.Type, &v.Source, &from, &to, &past, &id); err != nil {
+			return nil, err
+		}
+		v.Value = attributeValue(v.Type, v.Value)
+		if from != nil {
+			v.From = formatValue(from)
+		}
+		if to != nil {
+			v.To = formatValue(to)
+		}
+		if len(timelines) == 0 || timelines[len(timelines)-1].Name != n {
+			timelines = append(timelines, attributeTimeline{Name: n, Previous: []attributeValueAt{}})
+		}
+		t := &timelines[len(timelines)-1]
+		if past {
+			t.Previous = append(t.Previous, v)
+		} else {
+			t.Current = &v
+		}
+	}
+	return timelines, rows.Err()
+}
+
+func attributeHistoryHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		entity := strings.TrimSpace(request.GetString("entity", ""))
+		if entity == "" {
+			return toolError(codeInvalidArgument, "entity parameter is required"), nil
+		}
+		var name string
+		if n := request.GetString("name", ""); n != "" {
+			var err error
+			if name, err = normalizeAttributeName(n); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+		}
+		entityID, err := lookupEntityID(ctx, db, entity)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		timelines, err := loadAttributeHistory(ctx, db, entityID, name)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read attribute history: %v", err), nil
+		}
+		if len(timelines) == 0 {
+			if name != "" {
+				return toolErrorf(codeNotFound, "%s has never had an attribute %s", entity, name), nil
+			}
+			timelines = []attributeTimeline{}
+		}
+		return graphResult(map[string]any{"entity": entity, "attributes": timelines}), nil
+	}
+}
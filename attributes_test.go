@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNormalizeAttributeName(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"birthday", "birthday", false},
+		{"Date of birth", "date_of_birth", false},
+		{" ip-address ", "ip_address", false},
+		{"1st_job", "", true},
+		{"e-mail!", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeAttributeName(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeAttributeName(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestNormalizeAttributeValue(t *testing.T) {
+	tests := []struct {
+		typ     string
+		in      any
+		want    any
+		wantErr bool
+	}{
+		{"text", "  Acme Corp ", "Acme Corp", false},
+		{"text", " ", nil, true},
+		{"number", float64(42), int64(42), false},
+		{"number", "3.5", 3.5, false},
+		{"number", "many", nil, true},
+		{"boolean", true, int64(1), false},
+		{"boolean", "No", int64(0), false},
+		{"boolean", "maybe", nil, true},
+		{"date", "1990-04-12", "1990-04-12", false},
+		{"date", "--04-12", "--04-12", false},
+		{"date", "12/04/1990", nil, true},
+		{"date", "--02-30", nil, true},
+		{"email", "Ada@Example.com", "ada@example.com", false},
+		{"email", "Ada <ada@example.com>", nil, true},
+		{"url", "https://example.com/a", "https://example.com/a", false},
+		{"url", "example.com", nil, true},
+		{"ip", "192.168.001.10", nil, true},
+		{"ip", "192.168.1.10", "192.168.1.10", false},
+		{"ip", "2001:DB8::1", "2001:db8::1", false},
+		{"ip", "10.0.0.0/24", "10.0.0.0/24", false},
+		{"colour", "red", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeAttributeValue(tt.typ, tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeAttributeValue(%q, %v) = %v (%T), %v; want %v", tt.typ, tt.in, got, got, err, tt.want)
+		}
+	}
+}
+
+func TestAttributes_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	defer db.Exec("DELETE FROM entities WHERE name = 'attr-test-ada'")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('attr-test-ada', 'Person')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	set := func(args map[string]any) string {
+		t.Helper()
+		args["entity"] = "attr-test-ada"
+		result, err := callTool(setAttributeHandler(db), "set_attribute", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := result.Content[0].(mcp.TextContent).Text
+		if result.IsError {
+			t.Fatalf("set_attribute %v: %s", args, text)
+		}
+		return text
+	}
+
+	if got := set(map[string]any{"name": "Birthday", "value": "--12-10", "type": "date", "source": "user"}); got != "success: set birthday of attr-test-ada to --12-10" {
+		t.Errorf("first set = %q", got)
+	}
+	set(map[string]any{"name": "employer", "value": "Analytical Engines Ltd"})
+	set(map[string]any{"name": "age", "value": float64(36)})
+	set(map[string]any{"name": "vegetarian", "value": true})
+	if got := set(map[string]any{"name": "employer", "value": "Babbage & Co"}); !strings.Contains(got, "changed employer of attr-test-ada from Analytical Engines Ltd to Babbage & Co") {
+		t.Errorf("update = %q", got)
+	}
+	if got := set(map[string]any{"name": "age", "value": "36", "type": "number"}); !strings.Contains(got, "already 36") {
+		t.Errorf("same value = %q", got)
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM entity_attributes a JOIN entities e ON e.id = a.entity_id
+		WHERE e.name = 'attr-test-ada' AND a.name = 'age' AND a.value > 30`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("numeric comparison matched %d, %v", n, err)
+	}
+
+	result, err := callTool(getProfileHandler(db), "get_profile", map[string]any{"entity": "attr-test-ada"})
+	if err != nil || result.IsError {
+		t.Fatalf("get_profile: %v %v", err, result.Content)
+	}
+	var p profile
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &p); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]any)
+	for _, a := range p.Attributes {
+		got[a.Name] = a.Value
+	}
+	want := map[string]any{"age": float64(36), "birthday": "--12-10", "employer": "Babbage & Co", "vegetarian": true}
+	if p.EntityType != "Person" || len(got) != len(want) {
+		t.Fatalf("profile = %+v", p)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v (%T), want %v", k, got[k], got[k], v)
+		}
+	}
+	if p.Attributes[1].Name != "birthday" || p.Attributes[1].Source != "user" {
+		t.Errorf("attributes not sorted by name or source lost: %+v", p.Attributes)
+	}
+
+	if got := set(map[string]any{"name": "vegetarian", "remove": true}); got != "success: removed vegetarian of attr-test-ada (was true)" {
+		t.Errorf("remove = %q", got)
+	}
+	for _, args := range []map[string]any{
+		{"entity": "attr-test-ada", "name": "birthday", "value": "soon", "type": "date"},
+		{"entity": "attr-test-ada", "name": "employer"},
+		{"entity": "attr-test-nobody", "name": "employer", "value": "x"},
+		{"entity": "attr-test-ada", "name": "vegetarian", "remove": true},
+	} {
+		if result, _ := callTool(setAttributeHandler(db), "set_attribute", args); !result.IsError {
+			t.Errorf("set_attribute %v: expected an error", args)
+		}
+	}
+	if result, _ := callTool(getProfileHandler(db), "get_profile", map[string]any{"entity": "attr-test-nobody"}); !result.IsError {
+		t.Error("get_profile of a missing entity: expected an error")
+	}
+}
+
+func TestAttributeHistory_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	defer db.Exec("DELETE FROM entity_attribute_history WHERE name LIKE 'history_test_%'")
+	defer db.Exec("DELETE FROM entities WHERE name = 'attr-history-test'")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('attr-history-test', 'Person')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	set := func(args map[string]any) {
+		t.Helper()
+		args["entity"] = "attr-history-test"
+		if result, err := callTool(setAttributeHandler(db), "set_attribute", args); err != nil || result.IsError {
+			t.Fatalf("set_attribute %v: %v %v", args, err, result.Content)
+		}
+	}
+	set(map[string]any{"name": "history_test_address", "value": "1 Old Road"})
+	set(map[string]any{"name": "history_test_address", "value": "1 Old Road"})
+	set(map[string]any{"name": "history_test_address", "value": "2 Middle Street"})
+	set(map[string]any{"name": "history_test_address", "value": "3 New Avenue"})
+	set(map[string]any{"name": "history_test_phone", "value": "555-0100"})
+	set(map[string]any{"name": "history_test_phone", "remove": true})
+
+	history := func(args map[string]any) []attributeTimeline {
+		t.Helper()
+		args["entity"] = "attr-history-test"
+		result, err := callTool(attributeHistoryHandler(db), "attribute_history", args)
+		if err != nil || result.IsError {
+			t.Fatalf("attribute_history: %v %v", err, result.Content)
+		}
+		var got struct {
+			Attributes []attributeTimeline `json:"attributes"`
+		}
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got.Attributes
+	}
+
+	got := history(map[string]any{})
+	if len(got) != 2 {
+		t.Fatalf("got %+v, want the address and the phone", got)
+	}
+	address, phone := got[0], got[1]
+	if address.Current == nil || address.Current.Value != "3 New Avenue" {
+		t.Errorf("current address = %+v", address.Current)
+	}
+	// Setting the same value again is not a change.
+	if len(address.Previous) != 2 || address.Previous[0].Value != "2 Middle Street" || address.Previous[1].Value != "1 Old Road" {
+		t.Errorf("previous addresses = %+v, want newest first", address.Previous)
+	}
+	if address.Previous[0].From == "" || address.Previous[0].To == "" {
+		t.Errorf("previous address has no validity: %+v", address.Previous[0])
+	}
+	if phone.Current != nil || len(phone.Previous) != 1 || phone.Previous[0].Value != "555-0100" {
+		t.Errorf("removed phone = %+v", phone)
+	}
+
+	if got := history(map[string]any{"name": "History test phone"}); len(got) != 1 || got[0].Name != "history_test_phone" {
+		t.Errorf("by name = %+v", got)
+	}
+	if result, _ := callTool(attributeHistoryHandler(db), "attribute_history", map[string]any{"entity": "attr-history-test", "name": "history_test_never"}); !result.IsError {
+		t.Error("attribute_history of an unknown attribute: expected an error")
+	}
+
+	// Deleting the entity takes its attributes without adding history.
+	if _, err := db.Exec("DELETE FROM entities WHERE name = 'attr-history-test'"); err != nil {
+		t.Fatalf("delete entity: %v", err)
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM entity_attribute_history WHERE name = 'history_test_address'").Scan(&n)
+	if n != 2 {
+		t.Errorf("history rows after deleting the entity = %d, want the 2 from before", n)
+	}
+}
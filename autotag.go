@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// samplingTags has observations stored without tags tagged by the client's
+// model, through MCP sampling, choosing among the existing tags. Without it,
+// or when sampling fails, missing tags are an error as before.
+var samplingTags = getEnv("ENGRAM_SAMPLING_TAGS", "") == "true"
+
+const maxAutoTags = 3
+
+const autoTagPrompt = `You file notes in a memory store under existing tags.
+Reply with the names of the tags that fit the observation, comma-separated, at most three, broadest first, and nothing else.
+Only use names from the list. If none fits, reply with: none`
+
+// autoTag asks the client's model to choose tags for an observation about
+// subject, returning them comma-separated as a tags argument would be.
+func autoTag(ctx context.Context, db *sql.DB, smp sampler, subject string) (string, error) {
+	if smp == nil {
+		return "", fmt.Errorf("automatic tagging is off")
+	}
+	rows, err := db.QueryContext(ctx, "SELECT name, COALESCE(description, '') FROM tags ORDER BY name")
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("Tags:\n")
+	known := make(map[string]string)
+	for rows.Next() {
+		var name, desc string
+		if err := rows.Scan(&name, &desc); err != nil {
+			rows.Close()
+			return "", err
+		}
+		known[strings.ToLower(name)] = name
+		if desc != "" {
+			fmt.Fprintf(&sb, "- %s: %s\n", name, desc)
+		} else {
+			fmt.Fprintf(&sb, "- %s\n", name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(known) == 0 {
+		return "", fmt.Errorf("there are no tags to choose from")
+	}
+	fmt.Fprintf(&sb, "\nObservation:\n%s\n", subject)
+
+	ctx, cancel := context.WithTimeout(ctx, rerankTimeout)
+	defer cancel()
+	result, err := smp.RequestSampling(ctx, mcp.CreateMessageRequest{CreateMessageParams: mcp.CreateMessageParams{
+		Messages:     []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.NewTextContent(sb.String())}},
+		SystemPrompt: autoTagPrompt,
+		MaxTokens:    100,
+	}})
+	if err != nil {
+		return "", err
+	}
+	var text string
+	switch c := result.Content.(type) {
+	case mcp.TextContent:
+		text = c.Text
+	case *mcp.TextContent:
+		text = c.Text
+	default:
+		return "", fmt.Errorf("the client's model returned %T, not text", result.Content)
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, t := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		name, ok := known[strings.ToLower(strings.Trim(strings.TrimSpace(t), "`'\"*-. "))]
+		if ok && !seen[name] && len(tags) < maxAutoTags {
+			tags = append(tags, name)
+			seen[name] = true
+		}
+	}
+	if len(tags) == 0 {
+		return "", fmt.Errorf("the client's model chose no existing tag (%q)", strings.TrimSpace(text))
+	}
+	return strings.Join(tags, ", "), nil
+}
+
+// tagsOrAsk returns tagsStr, or tags chosen by the client's model when it is
+// empty. The bool reports whether the model chose them; an empty result
+// means the caller should report the missing tags.
+func tagsOrAsk(ctx context.Context, db *sql.DB, smp sampler, tagsStr, subject string) (string, bool) {
+	if strings.TrimSpace(tagsStr) != "" || smp == nil {
+		return tagsStr, false
+	}
+	tags, err := autoTag(ctx, db, smp, subject)
+	if err != nil {
+		log.Printf("automatic tagging failed: %v", err)
+		return "", false
+	}
+	return tags, true
+}
+
+// autoTagNote is appended to a success message when the tags were chosen by
+// the client's model.
+func autoTagNote(auto bool) string {
+	if auto {
+		return " (chosen by the client's model, change them with execute if they do not fit)"
+	}
+	return ""
+}
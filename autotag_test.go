@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestAutoTag_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		smp     sampler
+		want    string
+		wantErr string
+	}{
+		{"one tag", replyText("homelab"), "homelab", ""},
+		{"case and punctuation", replyText("`Homelab`, CAREER.\n"), "homelab, career", ""},
+		{"unknown and repeated tags dropped", replyText("homelab, servers, homelab"), "homelab", ""},
+		{"at most three", replyText("personal, homelab, career, drinks"), "personal, homelab, career", ""},
+		{"none fits", replyText("none"), "", "no existing tag"},
+		{"declined", samplerFunc(func(mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+			return nil, errors.New("user rejected sampling request")
+		}), "", "user rejected"},
+		{"no sampler", nil, "", "off"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := autoTag(context.Background(), db, tt.smp, "nas: runs truenas")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("autoTag() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("autoTag() = %q %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	cleanup := func() { db.Exec("DELETE FROM tags WHERE name = 'autotag-test'") }
+	cleanup()
+	defer cleanup()
+	if _, err := db.Exec("INSERT INTO tags (name, description) VALUES ('autotag-test', 'Autotag test tag')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var prompt string
+	autoTag(context.Background(), db, samplerFunc(func(request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+		prompt = request.Messages[0].Content.(mcp.TextContent).Text
+		return replyText("homelab")(request)
+	}), "nas: runs truenas")
+	if !strings.Contains(prompt, "- autotag-test: Autotag test tag\n") || !strings.Contains(prompt, "nas: runs truenas") {
+		t.Errorf("prompt lacks the tags or the observation:\n%s", prompt)
+	}
+}
+
+func TestAddObservationAutoTag_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer callExecute(db, "DELETE FROM observations WHERE content LIKE 'autotag test 77881%'")
+
+	var entity string
+	if err := db.QueryRow("SELECT name FROM entities WHERE id = 1").Scan(&entity); err != nil {
+		t.Fatalf("lookup entity: %v", err)
+	}
+
+	result, err := callTool(addObservationHandler(db, replyText("homelab")), "add_observation", map[string]any{"entity": entity, "content": "autotag test 77881 a"})
+	if err != nil || result.IsError {
+		t.Fatalf("add_observation: %v %v", err, result.Content)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "with tags: homelab (chosen by the client's model") {
+		t.Errorf("unexpected result: %s", text)
+	}
+	var tags string
+	if err := db.QueryRow(`SELECT group_concat(t.name) FROM observations o JOIN observation_tags ot ON ot.observation_id = o.id JOIN tags t ON t.id = ot.tag_id
+		WHERE o.content = 'autotag test 77881 a'`).Scan(&tags); err != nil || tags != "homelab" {
+		t.Errorf("stored tags = %q %v, want homelab", tags, err)
+	}
+
+	// Given tags are used as they are, without asking.
+	asked := false
+	result, _ = callTool(addObservationHandler(db, samplerFunc(func(request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+		asked = true
+		return replyText("career")(request)
+	})), "add_observation", map[string]any{"entity": entity, "content": "autotag test 77881 b", "tags": "personal"})
+	if result.IsError || asked {
+		t.Errorf("expected personal without sampling, asked %v: %v", asked, result.Content)
+	}
+
+	// When the model cannot choose, the insert fails as it would without sampling.
+	result, _ = callTool(addObservationHandler(db, replyText("none")), "add_observation", map[string]any{"entity": entity, "content": "autotag test 77881 c"})
+	if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "tags parameter is required") {
+		t.Errorf("expected the missing tags error, got %v", result.Content)
+	}
+
+	result, err = callTool(executeHandler(db, replyText("drinks"), nil), "execute", map[string]any{
+		"sql": "INSERT INTO observations (entity_id, content) VALUES (1, 'autotag test 77881 d')",
+	})
+	if err != nil || result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "with tags: drinks (chosen") {
+		t.Errorf("execute: %v %v", err, result.Content)
+	}
+}
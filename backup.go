@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type schemaObject struct {
+	kind string
+	name string
+	sql  string
+}
+
+// writeBackup writes a SQL dump that sqlite3 or the libsql shell can replay
+// into an empty database: tables first, then their rows, then indexes,
+// triggers and views. Full-text indexes are rebuilt at the end rather than
+// dumped.
+func writeBackup(ctx context.Context, db *sql.DB, w io.Writer) error {
+	objects, err := schemaObjects(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "-- memory database backup %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintln(w, "PRAGMA foreign_keys=OFF;")
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+
+	var virtual []string
+	for _, o := range objects {
+		if o.kind == "table" && strings.HasPrefix(strings.ToUpper(o.sql), "CREATE VIRTUAL TABLE") {
+			virtual = append(virtual, o.name)
+		}
+	}
+	for _, o := range objects {
+		if o.kind != "table" || isShadowTable(o.name, virtual) {
+			continue
+		}
+		fmt.Fprintf(w, "%s;\n", o.sql)
+		if slices.Contains(virtual, o.name) {
+			continue
+		}
+		if err := dumpTable(ctx, db, w, o.name); err != nil {
+			return fmt.Errorf("dump %s: %v", o.name, err)
+		}
+	}
+	for _, o := range objects {
+		if o.kind != "table" {
+			fmt.Fprintf(w, "%s;\n", o.sql)
+		}
+	}
+	for _, name := range virtual {
+		fmt.Fprintf(w, "INSERT INTO %s(%s) VALUES ('rebuild');\n", quoteIdent(name), quoteIdent(name))
+	}
+
+	fmt.Fprintln(w, "COMMIT;")
+	return nil
+}
+
+// schemaObjects reads the tables, indexes, triggers and views of the
+// database in the order they can be created in.
+func schemaObjects(ctx context.Context, db queryer) ([]schemaObject, error) {
+	rows, err := db.QueryContext(ctx, `SELECT type, name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 WHEN 'trigger' THEN 2 ELSE 3 END, rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema: %v", err)
+	}
+	defer rows.Close()
+	var objects []schemaObject
+	for rows.Next() {
+		var o schemaObject
+		if err := rows.Scan(&o.kind, &o.name, &o.sql); err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+func dumpTable(ctx context.Context, db *sql.DB, w io.Writer, table string) error {
+	return dumpRows(ctx, db, w, table, "")
+}
+
+// dumpRows writes an INSERT for each row of table matching where, or for
+// every row when where is empty. Columns are selected as +column, an
+// expression with no declared type, so the driver hands back TIMESTAMP text
+// as stored instead of parsing it into a time.Time that prints differently.
+func dumpRows(ctx context.Context, db queryer, w io.Writer, table, where string, args ...any) error {
+	cols, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(cols))
+	selected := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = quoteIdent(c)
+		selected[i] = "+" + quoted[i]
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selected, ", "), quoteIdent(table))
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES (", quoteIdent(table), strings.Join(quoted, ", "))
+
+	values := make([]any, len(cols))
+	pointers := make([]any, len(cols))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	literals := make([]string, len(cols))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			literals[i] = sqlLiteral(v)
+		}
+		fmt.Fprintf(w, "%s%s);\n", prefix, strings.Join(literals, ", "))
+	}
+	return rows.Err()
+}
+
+// isShadowTable reports whether name is one of the tables FTS5 keeps a
+// virtual table's index in, which CREATE VIRTUAL TABLE makes itself.
+func isShadowTable(name string, virtual []string) bool {
+	for _, v := range virtual {
+		for _, suffix := range []string{"_data", "_idx", "_docsize", "_config", "_content"} {
+			if name == v+suffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02 15:04:05") + "'"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// chainFormat names the layout of chain.json.
+const chainFormat = "engram-backup-chain/1"
+
+// backupChain is the manifest of a backup directory: a full dump followed
+// by incremental ones, each covering the changes log ids after the previous.
+type backupChain struct {
+	Format  string        `json:"format"`
+	Backups []chainBackup `json:"backups"`
+}
+
+type chainBackup struct {
+	File string `json:"file"`
+	// Kind is full or incremental.
+	Kind       string `json:"kind"`
+	FromChange int64  `json:"from_change"`
+	ToChange   int64  `json:"to_change"`
+	CreatedAt  string `json:"created_at"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+}
+
+func (b chainBackup) String() string {
+	return fmt.Sprintf("%s (%s, changes %d to %d, %d bytes)", b.File, b.Kind, b.FromChange+1, b.ToChange, b.Size)
+}
+
+// readChain reads dir's chain.json; a directory without one has an empty
+// chain.
+func readChain(dir string) (*backupChain, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "chain.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &backupChain{Format: chainFormat}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var chain backupChain
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, fmt.Errorf("chain.json: %v", err)
+	}
+	if chain.Format != chainFormat {
+		return nil, fmt.Errorf("unsupported backup chain format %q, want %s", chain.Format, chainFormat)
+	}
+	return &chain, nil
+}
+
+// saveChain replaces dir's chain.json, so a crash leaves the old one.
+func saveChain(dir string, chain *backupChain) error {
+	data, err := json.MarshalIndent(chain, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "chain.json.tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "chain.json"))
+}
+
+// backupToChain adds a backup to the chain in dir: a full dump when full is
+// set or the chain is empty, otherwise an incremental one of the rows
+// changed since the last backup. It returns nil when nothing has changed.
+func backupToChain(ctx context.Context, db *sql.DB, dir string, full bool) (*chainBackup, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	chain, err := readChain(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Read before dumping: rows changed while the dump runs are taken
+	// again by the next incremental backup.
+	to, err := maxChangeID(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	b := chainBackup{Kind: "full", ToChange: to, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	if !full && len(chain.Backups) > 0 {
+		b.Kind = "incremental"
+		b.FromChange = chain.Backups[len(chain.Backups)-1].ToChange
+		if b.FromChange == to {
+			return nil, nil
+		}
+	}
+	b.File = fmt.Sprintf("%04d-%s.sql", len(chain.Backups)+1, b.Kind)
+
+	path := filepath.Join(dir, b.File)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	if b.Kind == "full" {
+		err = writeBackup(ctx, db, w)
+	} else {
+		err = writeIncremental(ctx, db, w, b.FromChange, b.ToChange)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	b.Size = info.Size()
+	b.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	chain.Backups = append(chain.Backups, b)
+	if err := saveChain(dir, chain); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// writeIncremental writes SQL that brings a database restored up to change
+// from to the state at change to. Each row the changes log touched in
+// between is deleted and, if it still exists, inserted with its current
+// values; then the log entries are copied, replacing those the replay's
+// own triggers wrote.
+func writeIncremental(ctx context.Context, db *sql.DB, w io.Writer, from, to int64) error {
+	rows, err := db.QueryContext(ctx, "SELECT id, op, table_name, row_id, payload FROM changes WHERE id > ? AND id <= ? ORDER BY id", from, to)
+	if err != nil {
+		return fmt.Errorf("read changes: %v", err)
+	}
+	type rowRef struct {
+		table, where string
+		args         []any
+	}
+	var refs []rowRef
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var c change
+		var payload string
+		if err := rows.Scan(&c.ID, &c.Op, &c.Table, &c.RowID, &payload); err != nil {
+			rows.Close()
+			return err
+		}
+		row, err := payloadRow(json.RawMessage(payload))
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("change %d: %v", c.ID, err)
+		}
+		where, args := rowKey(c, row)
+		ref := rowRef{c.Table, where, args}
+		if key := c.Table + " " + literalWhere(where, args); !seen[key] {
+			seen[key] = true
+			refs = append(refs, ref)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "-- memory database incremental backup %s, changes %d to %d\n", time.Now().UTC().Format(time.RFC3339), from+1, to)
+	fmt.Fprintln(w, "PRAGMA foreign_keys=OFF;")
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+	for _, r := range refs {
+		fmt.Fprintf(w, "DELETE FROM %s WHERE %s;\n", quoteIdent(r.table), literalWhere(r.where, r.args))
+		if err := dumpRows(ctx, db, w, r.table, r.where, r.args...); err != nil {
+			return fmt.Errorf("dump %s: %v", r.table, err)
+		}
+	}
+	// The deletes above logged changes of their own; the tail of the log
+	// is replaced with the one being backed up.
+	fmt.Fprintln(w, "DROP TRIGGER IF EXISTS changes_no_delete;")
+	fmt.Fprintf(w, "DELETE FROM changes WHERE id > %d;\n", from)
+	fmt.Fprintf(w, "%s;\n", changesNoDelete)
+	if err := dumpRows(ctx, db, w, "changes", "id > ? AND id <= ?", from, to); err != nil {
+		return fmt.Errorf("dump changes: %v", err)
+	}
+	fmt.Fprintln(w, "COMMIT;")
+	return nil
+}
+
+// literalWhere fills the placeholders of a rowKey condition with SQL
+// literals.
+func literalWhere(where string, args []any) string {
+	for _, a := range args {
+		where = strings.Replace(where, "?", sqlLiteral(a), 1)
+	}
+	return where
+}
+
+// verifyChain checks every backup in dir against chain.json and that each
+// incremental backup starts where the one before it ended. It returns the
+// files to replay, in order, to restore the latest state: the last full
+// dump and the incremental backups after it.
+func verifyChain(dir string) ([]chainBackup, error) {
+	chain, err := readChain(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain.Backups) == 0 {
+		return nil, fmt.Errorf("no backups in %s", dir)
+	}
+	var replay []chainBackup
+	for i, b := range chain.Backups {
+		switch {
+		case b.Kind == "full":
+			replay = nil
+		case b.Kind != "incremental":
+			return nil, fmt.Errorf("%s: unknown kind %q", b.File, b.Kind)
+		case i == 0:
+			return nil, fmt.Errorf("%s: the chain must start with a full backup", b.File)
+		case b.FromChange != chain.Backups[i-1].ToChange:
+			return nil, fmt.Errorf("%s starts after change %d but %s ended at %d; the chain has a gap", b.File, b.FromChange, chain.Backups[i-1].File, chain.Backups[i-1].ToChange)
+		}
+		f, err := os.Open(filepath.Join(dir, b.File))
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		size, err := io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", b.File, err)
+		}
+		if size != b.Size || hex.EncodeToString(h.Sum(nil)) != b.SHA256 {
+			return nil, fmt.Errorf("%s does not match its checksum in chain.json; the backup is corrupt or was altered", b.File)
+		}
+		replay = append(replay, b)
+	}
+	return replay, nil
+}
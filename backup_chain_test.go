@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLiteralWhere(t *testing.T) {
+	if got := literalWhere(`"observation_id" IS ? AND "tag_id" IS ?`, []any{int64(3), "it's"}); got != `"observation_id" IS 3 AND "tag_id" IS 'it''s'` {
+		t.Errorf("literalWhere = %s", got)
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := verifyChain(dir); err == nil || !strings.Contains(err.Error(), "no backups") {
+		t.Errorf("empty dir: %v", err)
+	}
+
+	write := func(name, content string) chainBackup {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return chainBackup{File: name, Size: int64(len(content)), SHA256: fmt.Sprintf("%x", sha256.Sum256([]byte(content)))}
+	}
+	full := write("0001-full.sql", "CREATE TABLE t (id);")
+	full.Kind, full.ToChange = "full", 10
+	incr := write("0002-incremental.sql", "DELETE FROM t WHERE id = 1;")
+	incr.Kind, incr.FromChange, incr.ToChange = "incremental", 10, 15
+
+	tests := []struct {
+		name    string
+		backups []chainBackup
+		wantErr string
+	}{
+		{"good", []chainBackup{full, incr}, ""},
+		{"starts incremental", []chainBackup{incr}, "must start with a full backup"},
+		{"gap", []chainBackup{full, func() chainBackup { b := incr; b.FromChange = 12; return b }()}, "has a gap"},
+		{"altered", []chainBackup{full, func() chainBackup { b := incr; b.SHA256 = full.SHA256; return b }()}, "does not match its checksum"},
+		{"missing", []chainBackup{full, func() chainBackup { b := incr; b.File = "0003-incremental.sql"; return b }()}, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := saveChain(dir, &backupChain{Format: chainFormat, Backups: tt.backups}); err != nil {
+				t.Fatal(err)
+			}
+			replay, err := verifyChain(dir)
+			if tt.wantErr == "" {
+				if err != nil || len(replay) != 2 {
+					t.Errorf("verifyChain = %v, %v", replay, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyChain error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackupChain_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'backup chain test %'")
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first, err := backupToChain(ctx, db, dir, false)
+	if err != nil || first == nil || first.Kind != "full" {
+		t.Fatalf("first backup = %v, %v", first, err)
+	}
+	if b, err := backupToChain(ctx, db, dir, false); err != nil || b != nil {
+		t.Errorf("backup without changes = %v, %v", b, err)
+	}
+
+	var entityID int64
+	if err := db.QueryRow("SELECT id FROM entities ORDER BY id LIMIT 1").Scan(&entityID); err != nil {
+		t.Skipf("no entities to test with: %v", err)
+	}
+	result, err := db.Exec("INSERT INTO observations (entity_id, content) VALUES (?, 'backup chain test kept')", entityID)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	kept, _ := result.LastInsertId()
+	result, err = db.Exec("INSERT INTO observations (entity_id, content) VALUES (?, 'backup chain test dropped')", entityID)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	dropped, _ := result.LastInsertId()
+	if _, err := db.Exec("DELETE FROM observations WHERE id = ?", dropped); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	second, err := backupToChain(ctx, db, dir, false)
+	if err != nil || second == nil || second.Kind != "incremental" || second.FromChange != first.ToChange {
+		t.Fatalf("second backup = %v, %v", second, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, second.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		"BEGIN TRANSACTION;",
+		`DELETE FROM "observations" WHERE id = ` + strconv.FormatInt(kept, 10) + ";",
+		`INSERT INTO "observations" (`,
+		"'backup chain test kept'",
+		`DELETE FROM "observations" WHERE id = ` + strconv.FormatInt(dropped, 10) + ";",
+		"DROP TRIGGER IF EXISTS changes_no_delete;",
+		"DELETE FROM changes WHERE id > " + strconv.FormatInt(first.ToChange, 10) + ";",
+		"CREATE TRIGGER IF NOT EXISTS changes_no_delete BEFORE DELETE ON changes",
+		`INSERT INTO "changes" (`,
+		"COMMIT;",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("incremental backup missing %q", want)
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, `INSERT INTO "observations"`) && strings.Contains(line, "dropped") {
+			t.Error("deleted observation was backed up as a row")
+		}
+	}
+
+	replay, err := verifyChain(dir)
+	if err != nil || len(replay) != 2 {
+		t.Errorf("verifyChain = %v, %v", replay, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, second.File), append(data, '\n'), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyChain(dir); err == nil {
+		t.Error("verifyChain accepted an altered backup")
+	}
+}
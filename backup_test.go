@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{"nil", nil, "NULL"},
+		{"int", int64(42), "42"},
+		{"float", 1.5, "1.5"},
+		{"string", "homelab", "'homelab'"},
+		{"string with quote", "it's", "'it''s'"},
+		{"blob", []byte{0xde, 0xad}, "X'dead'"},
+		{"time", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), "'2024-06-01 12:00:00'"},
+		{"bool", true, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlLiteral(tt.value); got != tt.expected {
+				t.Errorf("sqlLiteral(%v) = %q, want %q", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	if got := quoteIdent(`weird"name`); got != `"weird""name"` {
+		t.Errorf("quoteIdent() = %q", got)
+	}
+}
+
+func TestWriteBackup_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	if err := writeBackup(context.Background(), db, &buf); err != nil {
+		t.Fatalf("writeBackup: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"BEGIN TRANSACTION;", "CREATE TABLE", `INSERT INTO "tags"`, "COMMIT;"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("backup missing %q", want)
+		}
+	}
+	if strings.Contains(out, "sqlite_sequence") {
+		t.Error("backup should skip sqlite internal tables")
+	}
+	if strings.Contains(out, "observations_fts_data") || !strings.Contains(out, `INSERT INTO "observations_fts"("observations_fts") VALUES ('rebuild');`) {
+		t.Error("backup should rebuild full-text indexes instead of dumping them")
+	}
+}
+
+func TestIsShadowTable(t *testing.T) {
+	virtual := []string{"observations_fts"}
+	for name, want := range map[string]bool{"observations_fts_data": true, "observations_fts_idx": true, "observations_fts": false, "observations": false} {
+		if got := isShadowTable(name, virtual); got != want {
+			t.Errorf("isShadowTable(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultBulkDeleteSample = 5
+	maxBulkDeleteSample     = 50
+	// bulkDeleteBatch is how many ids one DELETE statement names.
+	bulkDeleteBatch = 500
+)
+
+// bulkDeleteSamples preview each kind of row bulk_delete removes, given
+// the ids, with %s standing for their placeholders.
+var bulkDeleteSamples = map[string]string{
+	"observations": `SELECT o.id, e.name AS entity, o.content,
+			COALESCE((SELECT group_concat(t.name, ',') FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), '') AS tags,
+			o.created_at
+		FROM observations o JOIN entities e ON e.id = o.entity_id WHERE o.id IN (%s) ORDER BY o.id`,
+	"entities": `SELECT e.id, e.name, e.entity_type,
+			(SELECT count(*) FROM observations x WHERE x.entity_id = e.id) AS observations,
+			(SELECT count(*) FROM relations x WHERE x.from_id = e.id OR x.to_id = e.id) AS relations,
+			e.created_at
+		FROM entities e WHERE e.id IN (%s) ORDER BY e.id`,
+	"relations": `SELECT r.id, f.name AS from_entity, r.relation_type, t.name AS to_entity, r.created_at
+		FROM relations r JOIN entities f ON f.id = r.from_id JOIN entities t ON t.id = r.to_id WHERE r.id IN (%s) ORDER BY r.id`,
+}
+
+// deletionToken names one set of rows, so a confirmed bulk_delete removes
+// exactly what its preview showed. ids are in ascending order.
+func deletionToken(what string, ids []int64) string {
+	h := sha256.New()
+	h.Write([]byte(what))
+	for _, id := range ids {
+		fmt.Fprintf(h, " %d", id)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func idArgs(ids []int64) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// registerBulkDelete adds the bulk_delete tool.
+func registerBulkDelete(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("bulk_delete",
+		mcp.WithDescription(`Delete every entity, observation or relation matching filters, in two steps.
+
+Called without confirm_token it deletes nothing: it returns how many rows match, a sample of them and a token. Show those to the user, and only if they agree call again with the same filters and that confirm_token. If the matches changed in between, nothing is deleted and a fresh preview is needed. Archived entities and what hangs off them match too. Deleting entities also deletes their observations and relations.`),
+		mcp.WithString("what",
+			mcp.Description("What to delete (default observations)"),
+			mcp.Enum("entities", "observations", "relations"),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Only observations with any of these comma-separated tags, or entities that have one"),
+		),
+		mcp.WithString("entity_type",
+			mcp.Description("Only entities of these comma-separated types, observations on them or relations from them"),
+		),
+		mcp.WithString("entity",
+			mcp.Description("Only observations on this entity, or relations from or to it"),
+		),
+		mcp.WithString("relation_type",
+			mcp.Description("Only relations of this type"),
+		),
+		mcp.WithString("since",
+			mcp.Description("Only rows created since a date ('2026-05-01') or a span back from now ('30d')"),
+		),
+		mcp.WithString("until",
+			mcp.Description("Only rows created before a date or a span back from now"),
+		),
+		mcp.WithNumber("sample",
+			mcp.Description(fmt.Sprintf("Matching rows shown in the preview (default %d, max %d)", defaultBulkDeleteSample, maxBulkDeleteSample)),
+		),
+		mcp.WithString("confirm_token",
+			mcp.Description("The token from the preview, to carry out the deletion"),
+		),
+	), bulkDeleteHandler(db, scopes))
+}
+
+func bulkDeleteHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		what := strings.TrimSpace(request.GetString("what", "observations"))
+		if _, ok := bulkDeleteSamples[what]; !ok {
+			return toolError(codeInvalidArgument, "what must be one of: observations, entities, relations"), nil
+		}
+		sample := request.GetInt("sample", defaultBulkDeleteSample)
+		if sample < 0 || sample > maxBulkDeleteSample {
+			return toolErrorf(codeInvalidArgument, "sample must be between 0 and %d", maxBulkDeleteSample), nil
+		}
+
+		// Archived entities are what usually gets cleaned out, so they match.
+		f := countFilter{
+			entityTypes:     parseTagNames(request.GetString("entity_type", "")),
+			entity:          strings.TrimSpace(request.GetString("entity", "")),
+			relationType:    strings.TrimSpace(request.GetString("relation_type", "")),
+			includeArchived: true,
+		}
+		now := time.Now()
+		var err error
+		if f.since, err = parseCountTime("since", request.GetString("since", ""), now); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if f.until, err = parseCountTime("until", request.GetString("until", ""), now); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if tags := parseTagNames(request.GetString("tags", "")); len(tags) > 0 {
+			if f.tagIDs, err = validateTags(ctx, db, tags); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+		}
+		if len(f.tagIDs) == 0 && len(f.entityTypes) == 0 && f.entity == "" && f.relationType == "" && f.since == "" && f.until == "" {
+			return toolError(codeInvalidArgument, "give at least one filter: tags, entity_type, entity, relation_type, since or until"), nil
+		}
+
+		levels := scopes.levels(ctx)
+		nsFilter := namespaces.observationFilter(ctx)
+		if what != "observations" && (restricted(levels) || nsFilter != "") {
+			// Deleting an entity takes observations this client cannot see
+			// with it.
+			return toolErrorf(codeInvalidArgument, "this client only sees some observations, so it can only bulk delete observations, not %s", what), nil
+		}
+
+		from, counted, where, args, err := countSource(what, f)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if nsFilter != "" {
+			where += " AND o." + nsFilter
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		rows, err := tx.QueryContext(ctx, restrictVisibility(fmt.Sprintf("SELECT DISTINCT %s FROM %s%s ORDER BY 1", counted, from, where), levels), args...)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to find matching %s: %v", what, err), nil
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return toolErrorf(errorCode(err, codeDatabase), "failed to find matching %s: %v", what, err), nil
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to find matching %s: %v", what, err), nil
+		}
+		if len(ids) == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("no %s match these filters, nothing to delete", what)), nil
+		}
+
+		token := deletionToken(what, ids)
+		given := strings.TrimSpace(request.GetString("confirm_token", ""))
+		if given == "" {
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "%d %s match and would be deleted", len(ids), what)
+			switch what {
+			case "observations":
+				sb.WriteString(", with their tags, attachments, reminders and feedback")
+			case "entities":
+				sb.WriteString(", with all their observations, relations, attributes and open questions")
+			}
+			sb.WriteString(". Nothing has been deleted yet.\n\n")
+			if sample > 0 {
+				shown := ids
+				if len(shown) > sample {
+					shown = shown[:sample]
+				}
+				cols, results, err := runQuery(ctx, tx, restrictVisibility(fmt.Sprintf(bulkDeleteSamples[what], placeholders(len(shown))), levels), idArgs(shown)...)
+				if err != nil {
+					return toolErrorFrom(err, codeDatabase), nil
+				}
+				fmt.Fprintf(&sb, "first %d of them:\n%s\n\n", len(shown), formatRows(cols, results))
+			}
+			fmt.Fprintf(&sb, "Show the user what would go. If they agree, call bulk_delete again with the same filters and confirm_token: %q", token)
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+		if given != token {
+			return toolErrorf(codeConflict, "the %s matching these filters are not the ones previewed with that token (now %d). Nothing was deleted; call bulk_delete without confirm_token to preview them again", what, len(ids)), nil
+		}
+
+		var deleted int64
+		for start := 0; start < len(ids); start += bulkDeleteBatch {
+			batch := ids[start:min(start+bulkDeleteBatch, len(ids))]
+			res, err := tx.ExecContext(ctx, "DELETE FROM "+what+" WHERE id IN ("+placeholders(len(batch))+")", idArgs(batch)...)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to delete %s: %v", what, err), nil
+			}
+			n, _ := res.RowsAffected()
+			deleted += n
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("deleted %d %s", deleted, what)), nil
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestDeletionToken(t *testing.T) {
+	a := deletionToken("observations", []int64{1, 2, 3})
+	if len(a) != 16 {
+		t.Errorf("deletionToken() = %q, want 16 hex digits", a)
+	}
+	if deletionToken("observations", []int64{1, 2, 3}) != a {
+		t.Error("deletionToken() differs for the same ids")
+	}
+	for _, other := range []string{
+		deletionToken("observations", []int64{1, 2}),
+		deletionToken("observations", []int64{12, 3}),
+		deletionToken("entities", []int64{1, 2, 3}),
+	} {
+		if other == a {
+			t.Errorf("deletionToken() = %q for different rows", other)
+		}
+	}
+}
+
+func TestBulkDelete_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'bulkdel-test%'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('bulkdel-test', 'test')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, content := range []string{"bulkdel-test one", "bulkdel-test two", "bulkdel-test three"} {
+		if _, err := db.Exec("INSERT INTO observations (entity_id, content) SELECT id, ? FROM entities WHERE name = 'bulkdel-test'", content); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	bulkDelete := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		args["entity"] = "bulkdel-test"
+		result, err := callTool(bulkDeleteHandler(db, nil), "bulk_delete", args)
+		if err != nil {
+			t.Fatalf("bulk_delete: %v", err)
+		}
+		return result
+	}
+	remaining := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'bulkdel-test'").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	result := bulkDelete(map[string]any{"sample": 2})
+	text := result.Content[0].(mcp.TextContent).Text
+	if result.IsError || !strings.HasPrefix(text, "3 observations match") || !strings.Contains(text, "bulkdel-test one") || strings.Contains(text, "bulkdel-test three") {
+		t.Fatalf("preview = %q", text)
+	}
+	if remaining() != 3 {
+		t.Fatal("the preview deleted observations")
+	}
+	token := regexp.MustCompile(`confirm_token: "([0-9a-f]+)"`).FindStringSubmatch(text)
+	if token == nil {
+		t.Fatalf("no token in %q", text)
+	}
+
+	// A new match makes the previewed token stale.
+	if _, err := db.Exec("INSERT INTO observations (entity_id, content) SELECT id, 'bulkdel-test four' FROM entities WHERE name = 'bulkdel-test'"); err != nil {
+		t.Fatal(err)
+	}
+	if result = bulkDelete(map[string]any{"confirm_token": token[1]}); !result.IsError || remaining() != 4 {
+		t.Fatalf("bulk_delete with a stale token = %v, %d left", result.Content, remaining())
+	}
+
+	text = bulkDelete(map[string]any{}).Content[0].(mcp.TextContent).Text
+	token = regexp.MustCompile(`confirm_token: "([0-9a-f]+)"`).FindStringSubmatch(text)
+	result = bulkDelete(map[string]any{"confirm_token": token[1]})
+	if result.IsError || result.Content[0].(mcp.TextContent).Text != "deleted 4 observations" || remaining() != 0 {
+		t.Errorf("bulk_delete = %v, %d left", result.Content, remaining())
+	}
+
+	result, err := callTool(bulkDeleteHandler(db, nil), "bulk_delete", map[string]any{"what": "observations"})
+	if err != nil || !result.IsError {
+		t.Errorf("bulk_delete without filters: expected error, got %v %v", err, result)
+	}
+}
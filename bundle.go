@@ -0,0 +1,454 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// bundleFormat names the layout of export bundles in their manifest.
+const bundleFormat = "engram-bundle/1"
+
+// bundleManifest lists the files of an export bundle with their checksums,
+// so import can tell a corrupted or altered bundle from a good one.
+type bundleManifest struct {
+	Format        string       `json:"format"`
+	CreatedAt     string       `json:"created_at"`
+	SchemaVersion int          `json:"schema_version"`
+	Files         []bundleFile `json:"files"`
+}
+
+type bundleFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type bundleEntry struct {
+	name string
+	data []byte
+}
+
+// bundleCipher runs an external tool to encrypt or decrypt a bundle; the
+// age or gpg binary needs to be on the PATH.
+type bundleCipher struct {
+	encrypt func(recipients []string) []string
+	decrypt func(identity string) []string
+	// headers are the prefixes its encrypted output starts with.
+	headers []string
+}
+
+// bundleCiphers are the export -encrypt values. Without recipients both
+// encrypt with a passphrase they prompt for.
+var bundleCiphers = map[string]bundleCipher{
+	"age": {
+		encrypt: func(recipients []string) []string {
+			if len(recipients) == 0 {
+				return []string{"--passphrase"}
+			}
+			var args []string
+			for _, r := range recipients {
+				args = append(args, "--recipient", r)
+			}
+			return args
+		},
+		decrypt: func(identity string) []string {
+			if identity == "" {
+				return []string{"--decrypt"}
+			}
+			return []string{"--decrypt", "--identity", identity}
+		},
+		headers: []string{"age-encryption.org/", "-----BEGIN AGE ENCRYPTED FILE-----"},
+	},
+	"gpg": {
+		encrypt: func(recipients []string) []string {
+			if len(recipients) == 0 {
+				return []string{"--symmetric", "--output", "-"}
+			}
+			args := []string{"--encrypt", "--output", "-"}
+			for _, r := range recipients {
+				args = append(args, "--recipient", r)
+			}
+			return args
+		},
+		decrypt: func(string) []string {
+			return []string{"--decrypt", "--output", "-"}
+		},
+		headers: []string{"-----BEGIN PGP MESSAGE-----"},
+	},
+}
+
+// writeBundle writes the export as a gzipped tar of data.json (the export
+// document, for reading), schema.sql (the statements that create the
+// database), data.sql (every row, which import restores) and manifest.json,
+// encrypted with cipher when it is set.
+func writeBundle(ctx context.Context, db *sql.DB, w io.Writer, cipher string, recipients []string) error {
+	var data bytes.Buffer
+	if err := writeExport(ctx, db, &data); err != nil {
+		return err
+	}
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	objects, err := schemaObjects(ctx, db)
+	if err != nil {
+		return err
+	}
+	var schema bytes.Buffer
+	fmt.Fprintf(&schema, "-- memory database schema version %d\n", version)
+	for _, o := range objects {
+		fmt.Fprintf(&schema, "%s;\n", o.sql)
+	}
+	var rows bytes.Buffer
+	if err := writeDataDump(ctx, db, &rows); err != nil {
+		return err
+	}
+
+	archive, err := packBundle(bundleManifest{
+		Format:        bundleFormat,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		SchemaVersion: version,
+	}, []bundleEntry{{"data.json", data.Bytes()}, {"schema.sql", schema.Bytes()}, {"data.sql", rows.Bytes()}})
+	if err != nil {
+		return err
+	}
+	if cipher == "" {
+		_, err := w.Write(archive)
+		return err
+	}
+	return runCipher(ctx, cipher, bundleCiphers[cipher].encrypt(recipients), bytes.NewReader(archive), w)
+}
+
+// packBundle fills in the manifest's file list and writes it, then the
+// files, to a gzipped tar.
+func packBundle(m bundleManifest, entries []bundleEntry) ([]byte, error) {
+	m.Files = make([]bundleFile, len(entries))
+	for i, e := range entries {
+		sum := sha256.Sum256(e.data)
+		m.Files[i] = bundleFile{Name: e.name, Size: int64(len(e.data)), SHA256: hex.EncodeToString(sum[:])}
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, e := range append([]bundleEntry{{"manifest.json", manifest}}, entries...) {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o600, Size: int64(len(e.data)), ModTime: time.Now()}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpackBundle reads a gzipped tar bundle and checks every file against the
+// manifest: each listed file must be there with its size and checksum, and
+// nothing else may be.
+func unpackBundle(r io.Reader) (map[string][]byte, *bundleManifest, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a bundle: %v", err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("bundle is truncated or corrupt: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bundle is truncated or corrupt: %v", err)
+		}
+		files[h.Name] = data
+	}
+
+	var m bundleManifest
+	raw, ok := files["manifest.json"]
+	if !ok {
+		return nil, nil, fmt.Errorf("bundle has no manifest.json")
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, nil, fmt.Errorf("manifest.json: %v", err)
+	}
+	if m.Format != bundleFormat {
+		return nil, nil, fmt.Errorf("unsupported bundle format %q, want %s", m.Format, bundleFormat)
+	}
+	delete(files, "manifest.json")
+
+	var listed []string
+	for _, f := range m.Files {
+		data, ok := files[f.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("bundle is missing %s", f.Name)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != f.Size || hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, nil, fmt.Errorf("%s does not match its checksum in manifest.json; the bundle is corrupt or was altered", f.Name)
+		}
+		listed = append(listed, f.Name)
+	}
+	for name := range files {
+		if !slices.Contains(listed, name) {
+			return nil, nil, fmt.Errorf("bundle holds %s, which manifest.json does not list", name)
+		}
+	}
+	return files, &m, nil
+}
+
+// bundleKind tells from the first bytes of r whether it holds a bundle:
+// "gzip" for a plain one, the cipher name for an encrypted one, or "" for
+// anything else.
+func bundleKind(r *bufio.Reader) string {
+	head, _ := r.Peek(64)
+	if bytes.HasPrefix(head, []byte{0x1f, 0x8b}) {
+		return "gzip"
+	}
+	for name, c := range bundleCiphers {
+		for _, h := range c.headers {
+			if bytes.HasPrefix(head, []byte(h)) {
+				return name
+			}
+		}
+	}
+	// Binary OpenPGP messages start with a packet tag, which has the high
+	// bit set; JSON never does.
+	if len(head) > 0 && head[0]&0x80 != 0 {
+		return "gpg"
+	}
+	return ""
+}
+
+// readBundle decrypts r if needed and unpacks and verifies the bundle.
+// identity is the age identity file; gpg finds its key in the keyring.
+func readBundle(ctx context.Context, r *bufio.Reader, identity string) (map[string][]byte, *bundleManifest, error) {
+	kind := bundleKind(r)
+	switch kind {
+	case "":
+		return nil, nil, fmt.Errorf("not a bundle")
+	case "gzip":
+		return unpackBundle(r)
+	}
+	var archive bytes.Buffer
+	if err := runCipher(ctx, kind, bundleCiphers[kind].decrypt(identity), r, &archive); err != nil {
+		return nil, nil, err
+	}
+	return unpackBundle(&archive)
+}
+
+// runCipher runs the named tool from stdin to stdout, leaving its prompts
+// and messages on the terminal.
+func runCipher(ctx context.Context, name string, args []string, stdin io.Reader, stdout io.Writer) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// writeDataDump writes an INSERT for every row of every table but the
+// migration log, in the order the tables were created. Full-text indexes
+// are left out; restoreDataDump rebuilds them.
+func writeDataDump(ctx context.Context, q queryer, w io.Writer) error {
+	tables, _, err := dataTables(ctx, q)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := dumpRows(ctx, q, w, t, ""); err != nil {
+			return fmt.Errorf("dump %s: %v", t, err)
+		}
+	}
+	return nil
+}
+
+// dataTables returns the tables holding rows of their own, in creation
+// order, and the full-text index tables.
+func dataTables(ctx context.Context, q queryer) (tables, virtual []string, err error) {
+	objects, err := schemaObjects(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, o := range objects {
+		if o.kind == "table" && strings.HasPrefix(strings.ToUpper(o.sql), "CREATE VIRTUAL TABLE") {
+			virtual = append(virtual, o.name)
+		}
+	}
+	for _, o := range objects {
+		if o.kind == "table" && o.name != "schema_migrations" && !slices.Contains(virtual, o.name) && !isShadowTable(o.name, virtual) {
+			tables = append(tables, o.name)
+		}
+	}
+	return tables, virtual, nil
+}
+
+// restoreDataDump replays a bundle's data.sql into tx, whose database must
+// hold no rows yet, so it ends up with exactly the rows that were exported:
+// ids, visibility, provenance, attachments, reminders, the change log and
+// the rest. Triggers are dropped while the rows go in, so nothing is logged
+// or derived twice, and put back after; foreign keys are checked at commit.
+// Tables made with define_table are created again from their user_tables
+// rows. The bundle's schema version must not be newer than the database's.
+func restoreDataDump(ctx context.Context, tx *sql.Tx, data []byte, version int) error {
+	current, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if version > current {
+		return fmt.Errorf("the bundle is from schema version %d, newer than this database's %d; upgrade memory-mcp first", version, current)
+	}
+	tables, virtual, err := dataTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		var n int
+		if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s", quoteIdent(t))).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%s already has rows: a bundle is restored into an empty database only", t)
+		}
+	}
+
+	// Each statement is one INSERT, which holds no ";" outside its strings.
+	var stmts [][2]string
+	start := 0
+	for _, tok := range tokenizeSQL(string(data)) {
+		if tok.kind != tokenPunct || tok.text != ";" {
+			continue
+		}
+		sqlStr := string(data[start:tok.pos])
+		start = tok.pos + 1
+		stmt, err := parseStatement(sqlStr)
+		if err != nil || stmt.verb != "INSERT" || stmt.table == "" {
+			return fmt.Errorf("data.sql: not an INSERT: %.80s", strings.TrimSpace(sqlStr))
+		}
+		stmts = append(stmts, [2]string{stmt.table, sqlStr})
+	}
+	if strings.TrimSpace(string(data[start:])) != "" {
+		return fmt.Errorf("data.sql ends in an unterminated statement")
+	}
+
+	if _, err := tx.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON"); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT name, sql FROM sqlite_master WHERE type = 'trigger' AND sql IS NOT NULL ORDER BY rowid")
+	if err != nil {
+		return err
+	}
+	var triggers, names []string
+	for rows.Next() {
+		var name, sqlStr string
+		if err := rows.Scan(&name, &sqlStr); err != nil {
+			rows.Close()
+			return err
+		}
+		names, triggers = append(names, name), append(triggers, sqlStr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := tx.ExecContext(ctx, "DROP TRIGGER "+quoteIdent(name)); err != nil {
+			return err
+		}
+	}
+
+	// user_tables rows say how to create the tables define_table made.
+	for _, st := range stmts {
+		if st[0] == "user_tables" {
+			if _, err := tx.ExecContext(ctx, st[1]); err != nil {
+				return fmt.Errorf("restore user_tables: %v", err)
+			}
+		}
+	}
+	rows, err = tx.QueryContext(ctx, "SELECT name, columns FROM user_tables WHERE name NOT IN (SELECT name FROM sqlite_master) ORDER BY created_at, name")
+	if err != nil {
+		return err
+	}
+	defined := make(map[string][]userColumn)
+	var order []string
+	for rows.Next() {
+		var name, raw string
+		if err := rows.Scan(&name, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		var columns []userColumn
+		if err := json.Unmarshal([]byte(raw), &columns); err != nil {
+			rows.Close()
+			return fmt.Errorf("user_tables %s: %v", name, err)
+		}
+		defined[name] = columns
+		order = append(order, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range order {
+		ddl, userTriggers, err := defineTableStatements(name, defined[name], nil)
+		if err != nil {
+			return fmt.Errorf("user table %s: %v", name, err)
+		}
+		for _, stmt := range ddl {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("user table %s: %v", name, err)
+			}
+		}
+		triggers = append(triggers, userTriggers...)
+	}
+
+	for _, st := range stmts {
+		if st[0] == "user_tables" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, st[1]); err != nil {
+			return fmt.Errorf("restore %s: %v", st[0], err)
+		}
+	}
+	for _, t := range triggers {
+		if _, err := tx.ExecContext(ctx, t); err != nil {
+			return fmt.Errorf("recreate trigger: %v", err)
+		}
+	}
+	for _, v := range virtual {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", quoteIdent(v), quoteIdent(v))); err != nil {
+			return fmt.Errorf("rebuild %s: %v", v, err)
+		}
+	}
+	return nil
+}
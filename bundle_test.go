@@ -0,0 +1,224 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// rawBundle writes entries to a gzipped tar as they are, without working
+// out a manifest.
+func rawBundle(t *testing.T, entries ...bundleEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o600, Size: int64(len(e.data))})
+		tw.Write(e.data)
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestUnpackBundle(t *testing.T) {
+	data := bundleEntry{"data.json", []byte(`{"entities": []}`)}
+	good, err := packBundle(bundleManifest{Format: bundleFormat, SchemaVersion: 7}, []bundleEntry{data})
+	if err != nil {
+		t.Fatalf("packBundle: %v", err)
+	}
+	files, m, err := unpackBundle(bytes.NewReader(good))
+	if err != nil {
+		t.Fatalf("unpackBundle: %v", err)
+	}
+	if string(files["data.json"]) != string(data.data) || m.SchemaVersion != 7 || len(m.Files) != 1 {
+		t.Errorf("unpackBundle = %q, %+v", files, m)
+	}
+
+	// manifest lists files the way packBundle would.
+	manifest := func(format string, files ...bundleEntry) bundleEntry {
+		m := bundleManifest{Format: format}
+		for _, f := range files {
+			sum := sha256.Sum256(f.data)
+			m.Files = append(m.Files, bundleFile{Name: f.name, Size: int64(len(f.data)), SHA256: hex.EncodeToString(sum[:])})
+		}
+		b, _ := json.Marshal(m)
+		return bundleEntry{"manifest.json", b}
+	}
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr string
+	}{
+		{"altered file", rawBundle(t, manifest(bundleFormat, data), bundleEntry{"data.json", []byte(`{"entities": [1]}`)}), "does not match its checksum"},
+		{"missing file", rawBundle(t, manifest(bundleFormat, data)), "missing data.json"},
+		{"extra file", rawBundle(t, manifest(bundleFormat, data), data, bundleEntry{"extra.sql", nil}), "does not list"},
+		{"no manifest", rawBundle(t, data), "no manifest.json"},
+		{"other format", rawBundle(t, manifest("other/1", data), data), "unsupported bundle format"},
+		{"truncated", good[:len(good)/2], "truncated or corrupt"},
+		{"not gzip", []byte(`{"entities": []}`), "not a bundle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := unpackBundle(bytes.NewReader(tt.archive))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("unpackBundle error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBundleKind(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"\x1f\x8b\x08\x00", "gzip"},
+		{"age-encryption.org/v1\n-> X25519 abc", "age"},
+		{"-----BEGIN AGE ENCRYPTED FILE-----\n", "age"},
+		{"-----BEGIN PGP MESSAGE-----\n", "gpg"},
+		{"\x85\x02\x0c", "gpg"},
+		{`{"type": "entity", "name": "NAS"}`, ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := bundleKind(bufio.NewReader(strings.NewReader(tt.input))); got != tt.want {
+			t.Errorf("bundleKind(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBundleGPG(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("GNUPGHOME", home)
+	gen := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "backup@example.com", "default", "default", "never")
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Skipf("gpg key generation failed: %v\n%s", err, out)
+	}
+
+	archive, err := packBundle(bundleManifest{Format: bundleFormat}, []bundleEntry{{"data.json", []byte(`{}`)}})
+	if err != nil {
+		t.Fatalf("packBundle: %v", err)
+	}
+	ctx := context.Background()
+	var encrypted bytes.Buffer
+	gpg := bundleCiphers["gpg"]
+	if err := runCipher(ctx, "gpg", append([]string{"--batch"}, gpg.encrypt([]string{"backup@example.com"})...), bytes.NewReader(archive), &encrypted); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if bytes.Contains(encrypted.Bytes(), []byte("data.json")) {
+		t.Error("encrypted bundle shows its file names")
+	}
+	files, _, err := readBundle(ctx, bufio.NewReader(&encrypted), "")
+	if err != nil {
+		t.Fatalf("readBundle: %v", err)
+	}
+	if string(files["data.json"]) != "{}" {
+		t.Errorf("data.json = %q", files["data.json"])
+	}
+}
+
+func TestBundle_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if err := writeBundle(ctx, db, &buf, "", nil); err != nil {
+		t.Fatalf("writeBundle: %v", err)
+	}
+	files, m, err := readBundle(ctx, bufio.NewReader(&buf), "")
+	if err != nil {
+		t.Fatalf("readBundle: %v", err)
+	}
+	if m.SchemaVersion == 0 || !strings.Contains(string(files["schema.sql"]), "CREATE TABLE") {
+		t.Errorf("manifest %+v, schema.sql %.60q", m, files["schema.sql"])
+	}
+	if _, ok := files["data.sql"]; !ok {
+		t.Fatal("bundle has no data.sql")
+	}
+
+	// Restore into the same database emptied inside a transaction that is
+	// rolled back, so the shared test database is left as it was.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	var entityID int64
+	if err := tx.QueryRowContext(ctx, "INSERT INTO entities (name, entity_type) VALUES ('Bundle Probe', 'test') RETURNING id").Scan(&entityID); err != nil {
+		t.Fatalf("insert entity: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO observations (entity_id, content, created_at) VALUES (?, 'Survives the trip', '2024-06-01T12:00:00.123Z')", entityID); err != nil {
+		t.Fatalf("insert observation: %v", err)
+	}
+	var before bytes.Buffer
+	if err := writeDataDump(ctx, tx, &before); err != nil {
+		t.Fatalf("writeDataDump: %v", err)
+	}
+	if !strings.Contains(before.String(), "'2024-06-01T12:00:00.123Z'") {
+		t.Error("data.sql rewrote a timestamp")
+	}
+	if err := restoreDataDump(ctx, tx, before.Bytes(), m.SchemaVersion); err == nil {
+		t.Error("restored into a database that has data")
+	}
+	if err := restoreDataDump(ctx, tx, before.Bytes(), m.SchemaVersion+1); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("newer bundle: %v", err)
+	}
+
+	tables, _, err := dataTables(ctx, tx)
+	if err != nil {
+		t.Fatalf("dataTables: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON"); err != nil {
+		t.Fatalf("defer foreign keys: %v", err)
+	}
+	// Deletes log changes and history rows; repeat until nothing is left,
+	// then clear the append-only log itself.
+	for emptied := false; !emptied; {
+		emptied = true
+		for _, table := range tables {
+			if table == "changes" {
+				continue
+			}
+			res, err := tx.ExecContext(ctx, "DELETE FROM "+quoteIdent(table))
+			if err != nil {
+				t.Fatalf("empty %s: %v", table, err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				emptied = false
+			}
+		}
+	}
+	for _, stmt := range []string{"DROP TRIGGER changes_no_delete", "DELETE FROM changes"} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if err := restoreDataDump(ctx, tx, before.Bytes(), m.SchemaVersion); err != nil {
+		t.Fatalf("restoreDataDump: %v", err)
+	}
+	var after bytes.Buffer
+	if err := writeDataDump(ctx, tx, &after); err != nil {
+		t.Fatalf("writeDataDump: %v", err)
+	}
+	if before.String() != after.String() {
+		t.Errorf("restored data differs:\n%s\nwant\n%s", after.String(), before.String())
+	}
+	var found int
+	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM observations_fts WHERE observations_fts MATCH 'survives'").Scan(&found); err != nil || found != 1 {
+		t.Errorf("search after restore = %d, %v", found, err)
+	}
+}
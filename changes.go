@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// changeTriggers returns triggers appending every insert, update and delete on
+// table to the changes table, with the row's columns as a JSON payload (the new
+// values, or the old ones for a delete). Triggers fire for writes made through
+// any tool, raw SQL and cascading deletes alike.
+func changeTriggers(table, rowID string, columns ...string) []string {
+	var stmts []string
+	for _, t := range []struct{ op, row string }{{"insert", "NEW"}, {"update", "NEW"}, {"delete", "OLD"}} {
+		stmts = append(stmts, fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS changes_%s_%s AFTER %s ON %s BEGIN
+			INSERT INTO changes (op, table_name, row_id, payload) VALUES ('%s', '%s', %s.%s, %s);
+		END`, table, t.op, strings.ToUpper(t.op), table, t.op, table, t.row, rowID, payloadObject(table, t.row+".", columns)))
+	}
+	return stmts
+}
+
+// blobColumns are the BLOB columns change payloads hold as hex text, since
+// JSON has no blob type; decodeBlobs turns them back into bytes.
+var blobColumns = map[string]map[string]bool{
+	"attachments": {"data": true},
+}
+
+// payloadObject is jsonObject for a change payload of table, with its
+// blobColumns hex-encoded.
+func payloadObject(table, prefix string, columns []string) string {
+	pairs := make([]string, len(columns))
+	for i, c := range columns {
+		value := prefix + c
+		if blobColumns[table][c] {
+			value = fmt.Sprintf("iif(%s IS NULL, NULL, hex(%s))", value, value)
+		}
+		pairs[i] = fmt.Sprintf("'%s', %s", c, value)
+	}
+	return "json_object(" + strings.Join(pairs, ", ") + ")"
+}
+
+// decodeBlobs turns the hex text payloadObject wrote for table's
+// blobColumns in row back into bytes.
+func decodeBlobs(table string, row map[string]any) error {
+	for c := range blobColumns[table] {
+		text, ok := row[c].(string)
+		if !ok {
+			continue
+		}
+		data, err := hex.DecodeString(text)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", table, c, err)
+		}
+		row[c] = data
+	}
+	return nil
+}
+
+// jsonObject returns a json_object() expression over columns, each prefixed
+// with prefix, e.g. "NEW.".
+func jsonObject(prefix string, columns []string) string {
+	pairs := make([]string, len(columns))
+	for i, c := range columns {
+		pairs[i] = fmt.Sprintf("'%s', %s%s", c, prefix, c)
+	}
+	return "json_object(" + strings.Join(pairs, ", ") + ")"
+}
+
+type change struct {
+	ID        int64           `json:"id"`
+	Op        string          `json:"op"`
+	Table     string          `json:"table"`
+	RowID     int64           `json:"rowId"`
+	Payload   json.RawMessage `json:"payload"`
+	ChangedAt string          `json:"changedAt"`
+}
+
+type changePage struct {
+	Changes   []change `json:"changes"`
+	NextSince int64    `json:"nextSince"`
+}
+
+// loadChanges returns up to limit changes after since, oldest first. Changes to
+// observations outside levels, and to their contents and attached rows, are
+// left out.
+func loadChanges(ctx context.Context, db *sql.DB, levels []string, since int64, limit int, tables []string) (changePage, error) {
+	page := changePage{Changes: []change{}, NextSince: since}
+
+	sqlStr := "SELECT id, op, table_name, row_id, payload, changed_at FROM changes WHERE id > ?"
+	args := []any{since}
+	if len(tables) > 0 {
+		sqlStr += " AND table_name IN (" + placeholders(len(tables)) + ")"
+		for _, t := range tables {
+			args = append(args, t)
+		}
+	}
+	sqlStr += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, restrictVisibility(sqlStr, levels), args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c change
+		var payload string
+		if err := rows.Scan(&c.ID, &c.Op, &c.Table, &c.RowID, &payload, &c.ChangedAt); err != nil {
+			return page, err
+		}
+		c.Payload = json.RawMessage(payload)
+		page.Changes = append(page.Changes, c)
+		page.NextSince = c.ID
+	}
+	return page, rows.Err()
+}
+
+// registerChangesSince adds the changes_since tool.
+func registerChangesSince(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("changes_since",
+		mcp.WithDescription(`List recorded changes (inserts, updates and deletes) after a change id, oldest first.
+
+Every write to entities, observations, contents, relations, tags, observation_tags, entity_tags, unknowns and tables added with define_table is logged with the row as JSON, whether it came from a tool, raw SQL or a cascading delete. Start with since: 0, then pass the returned nextSince to fetch the next batch. Use it to sync another store or replay what happened.`),
+		mcp.WithNumber("since",
+			mcp.Description("Return changes with an id greater than this (default 0, from the beginning)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum changes to return (default %d, max %d)", defaultChangesLimit, maxChangesLimit)),
+		),
+		mcp.WithString("tables",
+			mcp.Description("Only changes to these comma-separated tables, e.g. 'observations,relations'"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), changesSinceHandler(db, scopes))
+}
+
+func changesSinceHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		since := int64(request.GetFloat("since", 0))
+		if since < 0 {
+			return toolError(codeInvalidArgument, "since must be a change id, 0 or greater"), nil
+		}
+		limit := request.GetInt("limit", defaultChangesLimit)
+		if limit < 1 || limit > maxChangesLimit {
+			return toolErrorf(codeInvalidArgument, "limit must be between 1 and %d", maxChangesLimit), nil
+		}
+
+		page, err := loadChanges(ctx, db, scopes.levels(ctx), since, limit, parseTagNames(request.GetString("tables", "")))
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read changes: %v", err), nil
+		}
+		return graphResult(page), nil
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestChangeTriggers(t *testing.T) {
+	stmts := changeTriggers("observation_tags", "observation_id", "observation_id", "tag_id")
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 triggers, got %d", len(stmts))
+	}
+	for _, want := range []string{
+		"AFTER INSERT ON observation_tags",
+		"'insert', 'observation_tags', NEW.observation_id, json_object('observation_id', NEW.observation_id, 'tag_id', NEW.tag_id)",
+	} {
+		if !strings.Contains(stmts[0], want) {
+			t.Errorf("insert trigger missing %q:\n%s", want, stmts[0])
+		}
+	}
+	if !strings.Contains(stmts[2], "'delete', 'observation_tags', OLD.observation_id, json_object('observation_id', OLD.observation_id") {
+		t.Errorf("delete trigger should log the old row:\n%s", stmts[2])
+	}
+}
+
+func TestChangesSince_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'changes-test-pi'")
+
+	var since int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM changes").Scan(&since); err != nil {
+		t.Fatalf("max id: %v", err)
+	}
+
+	for _, stmt := range []string{
+		"INSERT INTO entities (name, entity_type) VALUES ('changes-test-pi', 'device')",
+		"UPDATE entities SET entity_type = 'computer' WHERE name = 'changes-test-pi'",
+		"INSERT INTO observations (entity_id, content, visibility) SELECT id, 'changes test private', 'private' FROM entities WHERE name = 'changes-test-pi'",
+		"INSERT INTO observations (entity_id, content, visibility) SELECT id, 'changes test public', 'public' FROM entities WHERE name = 'changes-test-pi'",
+		"DELETE FROM observations WHERE content = 'changes test private'",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		levels []string
+		limit  int
+		tables []string
+		want   []string
+	}{
+		{"all", visibilityLevels, 100, nil, []string{"insert entities", "update entities", "insert observations", "insert observations", "delete observations"}},
+		{"limited", visibilityLevels, 2, nil, []string{"insert entities", "update entities"}},
+		{"one table", visibilityLevels, 100, []string{"entities"}, []string{"insert entities", "update entities"}},
+		{"public only", []string{"public"}, 100, nil, []string{"insert entities", "update entities", "insert observations"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := loadChanges(context.Background(), db, tt.levels, since, tt.limit, tt.tables)
+			if err != nil {
+				t.Fatalf("loadChanges: %v", err)
+			}
+			var got []string
+			for _, c := range page.Changes {
+				got = append(got, c.Op+" "+c.Table)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+			if n := len(page.Changes); n > 0 && page.NextSince != page.Changes[n-1].ID {
+				t.Errorf("nextSince = %d, want %d", page.NextSince, page.Changes[n-1].ID)
+			}
+		})
+	}
+
+	t.Run("payload", func(t *testing.T) {
+		page, _ := loadChanges(context.Background(), db, visibilityLevels, since, 2, nil)
+		if !strings.Contains(string(page.Changes[1].Payload), `"entity_type":"computer"`) {
+			t.Errorf("update payload = %s", page.Changes[1].Payload)
+		}
+	})
+
+	t.Run("append-only", func(t *testing.T) {
+		if _, err := db.Exec("UPDATE changes SET op = 'delete' WHERE id > ?", since); err == nil {
+			t.Error("expected updating changes to fail")
+		}
+		if _, err := db.Exec("DELETE FROM changes WHERE id > ?", since); err == nil {
+			t.Error("expected deleting from changes to fail")
+		}
+	})
+
+	t.Run("tool rejects bad limit", func(t *testing.T) {
+		result, err := callTool(changesSinceHandler(db, nil), "changes_since", map[string]any{"limit": float64(5000)})
+		if err != nil || !result.IsError {
+			t.Errorf("expected a tool error, got %v %v", err, result)
+		}
+	})
+}
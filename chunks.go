@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// maxObservationBytes is the longest observation stored as one row; 0
+	// means no limit.
+	maxObservationBytes = getEnvInt("ENGRAM_MAX_OBSERVATION_BYTES", 16384)
+	// oversizedObservations is what happens to longer ones: "chunk" splits
+	// them into linked parts, "reject" refuses them.
+	oversizedObservations = getEnv("ENGRAM_OVERSIZED_OBSERVATIONS", "chunk")
+)
+
+// observationChunkBytes is the size parts are cut to, small enough to search
+// and embed well.
+const observationChunkBytes = 2000
+
+// observationParts returns content as the observations to store: itself
+// when it fits, otherwise numbered parts such as "(2/7) ...".
+func observationParts(content string) ([]string, error) {
+	if maxObservationBytes <= 0 || len(content) <= maxObservationBytes {
+		return []string{content}, nil
+	}
+	if oversizedObservations == "reject" {
+		return nil, fmt.Errorf("observation is %d bytes, over the %d byte limit (ENGRAM_MAX_OBSERVATION_BYTES); split it or attach it as a file", len(content), maxObservationBytes)
+	}
+	chunks := splitChunks(content, min(observationChunkBytes, maxObservationBytes))
+	parts := make([]string, len(chunks))
+	for i, c := range chunks {
+		parts[i] = fmt.Sprintf("(%d/%d) %s", i+1, len(chunks), c)
+	}
+	return parts, nil
+}
+
+// splitChunks cuts s into pieces of at most size bytes, preferring to cut
+// between paragraphs, then lines, then words.
+func splitChunks(s string, size int) []string {
+	var chunks []string
+	for s = strings.TrimSpace(s); len(s) > size; {
+		cut := -1
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			// Only cut in the second half, so chunks stay close to size.
+			if i := strings.LastIndex(s[:size], sep); i > size/2 {
+				cut = i
+				break
+			}
+		}
+		if cut < 0 {
+			cut = size
+			for cut > 0 && !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, strings.TrimSpace(s[:cut]))
+		s = strings.TrimSpace(s[cut:])
+	}
+	if s != "" {
+		chunks = append(chunks, s)
+	}
+	return chunks
+}
+
+// partMetadata adds the part's position, and the id of the first part, to
+// an observation's metadata, so the parts can be read back in order with:
+// WHERE id = :first OR json_extract(metadata, '$.first_id') = :first
+// ORDER BY json_extract(metadata, '$.part').
+func partMetadata(metadata any, part, parts int, firstID int64) any {
+	if parts == 1 {
+		return metadata
+	}
+	m := make(map[string]any)
+	if s, ok := metadata.(string); ok {
+		json.Unmarshal([]byte(s), &m)
+	}
+	m["part"], m["parts"] = part, parts
+	if firstID > 0 {
+		m["first_id"] = firstID
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// insertObservation stores content with insert, normalized to NFC and as
+// several observations when it is oversized. insert adds one observation and returns its id, or 0 when
+// an identical one already exists. The ids of the added observations are
+// returned.
+func insertObservation(content string, metadata any, insert func(content string, metadata any) (int64, error)) ([]int64, error) {
+	parts, err := observationParts(normalizeText(content))
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	var firstID int64
+	for i, part := range parts {
+		id, err := insert(part, partMetadata(metadata, i+1, len(parts), firstID))
+		if err != nil {
+			return ids, err
+		}
+		if i == 0 {
+			firstID = id
+		}
+		if id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
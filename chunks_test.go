@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		size int
+		want []string
+	}{
+		{"fits", "short log", 20, []string{"short log"}},
+		{"paragraphs", "first paragraph here\n\nsecond one", 25, []string{"first paragraph here", "second one"}},
+		{"lines before words", "line one is here\nline two", 20, []string{"line one is here", "line two"}},
+		{"words", "aaaa bbbb cccc dddd", 10, []string{"aaaa bbbb", "cccc dddd"}},
+		{"no spaces", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"runes kept whole", "ééééé", 3, []string{"é", "é", "é", "é", "é"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitChunks(tt.text, tt.size)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitChunks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObservationParts(t *testing.T) {
+	savedMax, savedMode := maxObservationBytes, oversizedObservations
+	defer func() { maxObservationBytes, oversizedObservations = savedMax, savedMode }()
+	maxObservationBytes, oversizedObservations = 5000, "chunk"
+
+	log := strings.Repeat("2024-05-01 12:00:00 disk sda: read error, retrying\n", 200)
+	parts, err := observationParts(log)
+	if err != nil {
+		t.Fatalf("observationParts: %v", err)
+	}
+	if len(parts) < 5 || !strings.HasPrefix(parts[0], fmt.Sprintf("(1/%d) 2024-05-01", len(parts))) {
+		t.Errorf("got %d parts starting %q", len(parts), parts[0][:20])
+	}
+	for _, p := range parts {
+		if len(p) > observationChunkBytes+10 {
+			t.Errorf("part of %d bytes", len(p))
+		}
+	}
+
+	oversizedObservations = "reject"
+	if _, err := observationParts(log); err == nil || !strings.Contains(err.Error(), "over the 5000 byte limit") {
+		t.Errorf("expected reject mode to refuse, got %v", err)
+	}
+	if parts, err := observationParts("short"); err != nil || len(parts) != 1 {
+		t.Errorf("short content = %q, %v", parts, err)
+	}
+
+	if got := partMetadata(`{"host":"nas"}`, 2, 3, 41); got != `{"first_id":41,"host":"nas","part":2,"parts":3}` {
+		t.Errorf("partMetadata() = %v", got)
+	}
+	if got := partMetadata(nil, 1, 1, 0); got != nil {
+		t.Errorf("partMetadata() of a single part = %v, want nil", got)
+	}
+}
+
+func TestAddObservationChunks_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'Chunk test server'")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Chunk test server')")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Chunk test server')")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('Chunk test server', 'Server')"); err != nil {
+		t.Fatal(err)
+	}
+
+	savedMax := maxObservationBytes
+	defer func() { maxObservationBytes = savedMax }()
+	maxObservationBytes = 4000
+
+	log := strings.Repeat("kernel: nvme0: I/O timeout, aborting\n", 150)
+	result, err := callTool(addObservationHandler(db, nil), "add_observation", map[string]any{
+		"entity": "Chunk test server", "content": log, "tags": "homelab", "metadata": `{"host": "nas"}`,
+	})
+	if err != nil || result.IsError {
+		t.Fatalf("add_observation: %v %v", err, result.Content)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "split into observations") {
+		t.Errorf("unexpected result: %s", text)
+	}
+
+	var first int64
+	var parts, tagged, hosts int
+	db.QueryRow(`SELECT min(o.id), count(*), count(ot.tag_id), sum(json_extract(o.metadata, '$.host') = 'nas') FROM observations o
+		JOIN entities e ON e.id = o.entity_id LEFT JOIN observation_tags ot ON ot.observation_id = o.id
+		WHERE e.name = 'Chunk test server'`).Scan(&first, &parts, &tagged, &hosts)
+	var linked int
+	db.QueryRow("SELECT count(*) FROM observations WHERE json_extract(metadata, '$.first_id') = ?", first).Scan(&linked)
+	if parts < 3 || tagged != parts || hosts != parts || linked != parts-1 {
+		t.Errorf("%d parts, %d tagged, %d with metadata, %d linked to %d", parts, tagged, hosts, linked, first)
+	}
+}
@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type command struct {
+	summary string
+	run     func(ctx context.Context, db *sql.DB, args []string) error
+}
+
+var commands = map[string]command{
+	"serve":           {"serve MCP over stdio (default)", serve},
+	"init":            {"set up the database, starter tags and client config, or just migrate the schema", initCommand},
+	"doctor":          {"check the connection, schema, indexes, embedder and settings, and suggest fixes", doctorCommand},
+	"backup":          {"write a SQL dump of the database, or add to an incremental backup chain", backupCommand},
+	"verify_backup":   {"check an incremental backup chain against its manifest", verifyBackupCommand},
+	"export":          {"write entities, observations, relations and tags as JSON, or observations as CSV/TSV", exportCommand},
+	"import":          {"load a @modelcontextprotocol/server-memory memory.json", importCommand},
+	"import_ics":      {"load calendar events and their attendees from .ics files", importICSCommand},
+	"import_markdown": {"load a folder of markdown notes, such as an Obsidian vault", importMarkdownCommand},
+	"stats":           {"print row counts and tag usage", statsCommand},
+	"queries":         {"print the statement shapes agents run most through the SQL tools", queriesCommand},
+	"vacuum":          {"rebuild the database to reclaim free space", vacuumCommand},
+	"repl":            {"run queries and writes interactively", replCommand},
+	"sync":            {"reconcile with another instance", syncCommand},
+	"embed":           {"embed observations missing a vector from the configured model", embedCommand},
+	"ingest":          {"pull the configured RSS/Atom feeds and mail folders once", ingestCommand},
+	"compact":         {"summarize old observations of busy entities and archive the originals", compactCommand},
+	"archive":         {"move long-archived observations to cold storage", archiveCommand},
+	"restore":         {"roll the database back to a point in time by undoing logged changes", restoreCommand},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s [command] [flags]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	names := make([]string, 0, len(commands))
+	width := 0
+	for name := range commands {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-*s %s\n", width, name, commands[name].summary)
+	}
+}
+
+// createOutput opens path for writing, or stdout when path is empty or "-".
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// writeOutput runs write against the -o destination, closing it afterwards.
+func writeOutput(path string, write func(w io.Writer) error) error {
+	w, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	if err := write(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// initCommand walks through setup when run at a terminal. Otherwise, or
+// with -no-input, it migrates the schema at -url and does only what its
+// flags ask.
+func initCommand(ctx context.Context, _ *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	url := fs.String("url", dbURL, "libSQL server URL (default $LIBSQL_URL)")
+	token := fs.String("token", dbAuthToken, "libSQL auth token (default $LIBSQL_AUTH_TOKEN)")
+	config := fs.String("config", "", "save the URL and token to this settings file (default, when asked, "+configPath()+")")
+	seed := fs.Bool("seed-tags", false, "add the ENGRAM_TAXONOMY tags, or the starter tags")
+	noInput := fs.Bool("no-input", false, "do not ask questions, even at a terminal")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := setupOptions{url: *url, token: *token, configPath: *config, seedTags: *seed, writeConfig: *config != ""}
+	if !*noInput && interactive() {
+		if opts.configPath == "" {
+			opts.configPath = configPath()
+		}
+		return runSetup(ctx, prompter{bufio.NewReader(os.Stdin), os.Stdout}, opts)
+	}
+
+	db, err := openURL(ctx, withAuthToken(opts.url, opts.token))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := reportSchema(ctx, db, os.Stdout, opts.url); err != nil {
+		return err
+	}
+	if opts.seedTags {
+		if err := seedStarterTags(ctx, db, os.Stdout); err != nil {
+			return err
+		}
+	}
+	if opts.writeConfig {
+		return finishSetup(os.Stdout, opts)
+	}
+	return nil
+}
+
+func backupCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("o", "", "output file (default stdout)")
+	dir := fs.String("dir", "", "add to the backup chain in this directory, incremental after the first")
+	full := fs.Bool("full", false, "with -dir, take a full dump even if the chain has one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		if *full {
+			return fmt.Errorf("-full needs -dir")
+		}
+		return writeOutput(*out, func(w io.Writer) error {
+			return writeBackup(ctx, db, w)
+		})
+	}
+	if *out != "" {
+		return fmt.Errorf("-o and -dir cannot be combined")
+	}
+	b, err := backupToChain(ctx, db, *dir, *full)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		fmt.Println("no changes since the last backup")
+		return nil
+	}
+	fmt.Printf("wrote %s\n", b)
+	return nil
+}
+
+func verifyBackupCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("verify_backup", flag.ContinueOnError)
+	dir := fs.String("dir", "", "backup chain directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("usage: verify_backup -dir DIR")
+	}
+	replay, err := verifyChain(*dir)
+	if err != nil {
+		return err
+	}
+	fmt.Println("backup chain verified; to restore, replay into an empty database in order:")
+	for _, b := range replay {
+		fmt.Printf("  %s\n", b)
+	}
+	return nil
+}
+
+func exportCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("o", "", "output file (default stdout)")
+	format := fs.String("format", "json", "json, csv/tsv for one row per observation, or bundle for a verifiable archive")
+	encrypt := fs.String("encrypt", "", "encrypt the bundle with age or gpg")
+	recipients := fs.String("recipient", "", "comma-separated age or gpg recipients (default: ask for a passphrase)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format == "bundle" {
+		if _, ok := bundleCiphers[*encrypt]; !ok && *encrypt != "" {
+			return fmt.Errorf("unknown -encrypt %q, want age or gpg", *encrypt)
+		}
+		if *recipients != "" && *encrypt == "" {
+			return fmt.Errorf("-recipient needs -encrypt")
+		}
+		return writeOutput(*out, func(w io.Writer) error {
+			return writeBundle(ctx, db, w, *encrypt, parseTagNames(*recipients))
+		})
+	}
+	if *encrypt != "" {
+		return fmt.Errorf("-encrypt needs -format bundle")
+	}
+	comma, ok := exportFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown -format %q, want json, csv, tsv or bundle", *format)
+	}
+	return writeOutput(*out, func(w io.Writer) error {
+		if comma == 0 {
+			return writeExport(ctx, db, w)
+		}
+		return writeExportRows(ctx, db, w, comma)
+	})
+}
+
+func importCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	tags := fs.String("tags", "", "comma-separated tags for the imported observations")
+	entityTags := fs.String("entity-tags", "", "comma-separated tags for the imported entities")
+	identity := fs.String("identity", "", "age identity file for an encrypted bundle")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [-tags t1,t2] [-entity-tags t1] [-identity key.txt] memory.json|bundle (- for stdin)")
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	br := bufio.NewReader(r)
+	if bundleKind(br) != "" {
+		if *tags != "" || *entityTags != "" {
+			return fmt.Errorf("-tags and -entity-tags do not apply to a bundle, which is restored as it was exported")
+		}
+		return importBundleCommand(ctx, db, br, *identity)
+	}
+	entities, relations, err := readMemoryFile(br)
+	if err != nil {
+		return err
+	}
+
+	observationTagIDs, err := validateTagsFor(ctx, db, "observations", parseTagNames(*tags))
+	if err != nil {
+		return err
+	}
+	if len(observationTagIDs) == 0 && requiredTags.requires("observations") {
+		return fmt.Errorf("-tags is required: the tag policy needs tags on new observations")
+	}
+	entityTagIDs, err := validateTagsFor(ctx, db, "entities", parseTagNames(*entityTags))
+	if err != nil {
+		return err
+	}
+	if len(entityTagIDs) == 0 && requiredTags.requires("entities") {
+		return fmt.Errorf("-entity-tags is required: the tag policy needs tags on new entities")
+	}
+
+	imports := make([]importEntity, len(entities))
+	for i, e := range entities {
+		imports[i] = importEntity{graphEntity: e, observationTags: observationTagIDs, entityTags: entityTagIDs}
+	}
+	counts, err := importMemory(ctx, db, imports, relations)
+	if err != nil {
+		return err
+	}
+	fmt.Println(counts)
+	return nil
+}
+
+// importBundleCommand verifies an export bundle and restores its data.sql
+// into the database, which must be empty, in one transaction.
+func importBundleCommand(ctx context.Context, db *sql.DB, r *bufio.Reader, identity string) error {
+	files, manifest, err := readBundle(ctx, r, identity)
+	if err != nil {
+		return err
+	}
+	data, ok := files["data.sql"]
+	if !ok {
+		return fmt.Errorf("the bundle has no data.sql to restore")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := restoreDataDump(ctx, tx, data, manifest.SchemaVersion); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fmt.Printf("restored bundle from %s (schema version %d)\n", manifest.CreatedAt, manifest.SchemaVersion)
+	return nil
+}
+
+func importMarkdownCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("import_markdown", flag.ContinueOnError)
+	tags := fs.String("tags", "", "comma-separated tags added to every note, on top of its frontmatter tags")
+	entityType := fs.String("type", "Note", "entity type for notes without a type in their frontmatter")
+	relationType := fs.String("relation", "links_to", "relation type for wiki-links")
+	createTags := fs.Bool("create-tags", false, "create frontmatter tags that do not exist yet instead of skipping them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import_markdown [-tags t1,t2] [-type Note] [-relation links_to] [-create-tags] DIR")
+	}
+
+	notes, err := readVault(fs.Arg(0), *entityType)
+	if err != nil {
+		return err
+	}
+	extraTags := parseTagNames(*tags)
+	if _, err := validateTags(ctx, db, extraTags); err != nil {
+		return err
+	}
+	entities, relations, unknownTags, unresolved, err := markdownImport(ctx, db, notes, *relationType, extraTags, *createTags)
+	if err != nil {
+		return err
+	}
+
+	counts, err := importMemory(ctx, db, entities, relations)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d notes: %s\n", len(notes), counts)
+	if len(unknownTags) > 0 {
+		fmt.Printf("skipped unknown tags: %s (pass -create-tags to add them)\n", strings.Join(unknownTags, ", "))
+	}
+	if len(unresolved) > 0 {
+		fmt.Printf("skipped %d links to notes that do not exist:\n", len(unresolved))
+		for _, link := range unresolved[:min(10, len(unresolved))] {
+			fmt.Printf("  %s\n", link)
+		}
+		if len(unresolved) > 10 {
+			fmt.Printf("  ... and %d more\n", len(unresolved)-10)
+		}
+	}
+	return nil
+}
+
+func importICSCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("import_ics", flag.ContinueOnError)
+	tags := fs.String("tags", "", "comma-separated tags for the imported events, people and observations")
+	me := fs.String("me", "", "comma-separated email addresses of the calendar's owner, left out of the attendees")
+	since := fs.String("since", "", "skip events starting before this date (YYYY-MM-DD)")
+	eventType := fs.String("type", "Event", "entity type for events")
+	personType := fs.String("person-type", "Person", "entity type for attendees")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: import_ics [-tags t1,t2] [-me you@example.com] [-since 2024-01-01] calendar.ics...")
+	}
+	var after time.Time
+	if *since != "" {
+		var err error
+		if after, err = time.Parse(time.DateOnly, *since); err != nil {
+			return fmt.Errorf("-since must be a date such as 2024-01-01")
+		}
+	}
+	skip := make(map[string]bool)
+	for _, email := range parseTagNames(*me) {
+		skip[strings.ToLower(email)] = true
+	}
+
+	var events []icsEvent
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		read, err := readICS(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		events = append(events, read...)
+	}
+
+	observationTagIDs, err := validateTagsFor(ctx, db, "observations", parseTagNames(*tags))
+	if err != nil {
+		return err
+	}
+	if len(observationTagIDs) == 0 && requiredTags.requires("observations") {
+		return fmt.Errorf("-tags is required: the tag policy needs tags on new observations")
+	}
+	entityTagIDs, err := validateTagsFor(ctx, db, "entities", parseTagNames(*tags))
+	if err != nil {
+		return err
+	}
+	if len(entityTagIDs) == 0 && requiredTags.requires("entities") {
+		return fmt.Errorf("-tags is required: the tag policy needs tags on new entities")
+	}
+
+	entities, relations := icsImport(events, *eventType, *personType, skip, after)
+	for i := range entities {
+		entities[i].observationTags, entities[i].entityTags = observationTagIDs, entityTagIDs
+	}
+	counts, err := importMemory(ctx, db, entities, relations)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d events: %s\n", len(events), counts)
+	return nil
+}
+
+func statsCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return writeStats(ctx, db, os.Stdout)
+}
+
+func queriesCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("queries", flag.ContinueOnError)
+	tool := fs.String("tool", "", "only shapes sent to this tool, e.g. query or execute")
+	order := fs.String("sort", "calls", "rank by calls, slowest (average time) or rows (average rows)")
+	limit := fs.Int("limit", 20, "number of shapes to print")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return writeQueryShapes(ctx, db, os.Stdout, *tool, *order, *limit)
+}
+
+func vacuumCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("vacuum", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+		return err
+	}
+	fmt.Println("vacuum complete")
+	return nil
+}
+
+func syncCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	peer := fs.String("peer", syncPeer, "libSQL URL of the other instance (default $ENGRAM_SYNC_PEER)")
+	conflict := fs.String("conflict", "lww", "resolve rows changed on both sides by last writer wins (lww) or by asking (prompt)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *peer == "" {
+		return fmt.Errorf("-peer is required")
+	}
+
+	var resolve conflictResolver
+	switch *conflict {
+	case "lww":
+		resolve = lastWriterWins
+	case "prompt":
+		resolve = promptResolver(os.Stdin, os.Stdout)
+	default:
+		return fmt.Errorf("unknown -conflict %q, want one of: %s", *conflict, strings.Join(conflictModes, ", "))
+	}
+
+	report, err := syncURL(ctx, db, *peer, resolve)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+	return nil
+}
+
+func ingestCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	since := fs.Duration("since", 24*time.Hour, "only items from this long ago or newer")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if feedsErr != nil {
+		return fmt.Errorf("invalid feeds: %v", feedsErr)
+	}
+	if len(feeds) == 0 {
+		return fmt.Errorf("ENGRAM_FEEDS is not set")
+	}
+	report, err := pullFeeds(ctx, db, feeds, time.Now().Add(-*since))
+	fmt.Print(report)
+	return err
+}
+
+func compactCommand(ctx context.Context, db *sql.DB, args []string) error {
+	p := defaultCompactPolicy()
+	fs := flag.NewFlagSet("compact", flag.ContinueOnError)
+	fs.IntVar(&p.minObservations, "min", p.minObservations, "compact entities with more old observations of one visibility than this")
+	fs.IntVar(&p.days, "days", p.days, "only observations older than this many days")
+	fs.StringVar(&p.entity, "entity", "", "only compact this entity")
+	fs.BoolVar(&p.dryRun, "dry-run", false, "report what would be compacted without changing anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if p.minObservations < 1 || p.days < 1 {
+		return fmt.Errorf("-min and -days must be at least 1")
+	}
+	chat, err := newChatSampler(summaryURL, summaryModel, summaryAPIKey)
+	if err != nil {
+		return err
+	}
+	if chat == nil && !p.dryRun {
+		return fmt.Errorf("ENGRAM_SUMMARY_URL is not set")
+	}
+	report, err := compactMemories(ctx, db, chat, p)
+	fmt.Print(report)
+	return err
+}
+
+func archiveCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	days := fs.Int("days", coldDays, "move observations archived more than this many days ago")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if coldURL == "" {
+		return fmt.Errorf("ENGRAM_COLD_URL is not set")
+	}
+	cold, err := openCold(ctx, coldURL)
+	if err != nil {
+		return err
+	}
+	defer cold.Close()
+	n, err := moveAllToCold(ctx, db, cold, *days)
+	fmt.Printf("moved %d observation(s) to cold storage\n", n)
+	return err
+}
+
+func restoreCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	to := fs.String("to", "", "time to restore to, e.g. 2024-06-01T12:00 (local time unless it has an offset)")
+	dryRun := fs.Bool("dry-run", false, "list what would be undone without writing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("usage: restore -to 2024-06-01T12:00 [-dry-run]")
+	}
+	cutoff, err := parseRestoreTime(*to)
+	if err != nil {
+		return err
+	}
+	plan, err := restoreTo(ctx, db, cutoff, *dryRun)
+	if err != nil {
+		return err
+	}
+	if plan.logStart > cutoff {
+		fmt.Printf("the change log starts at %s UTC; writes before then are not undone\n", plan.logStart)
+	}
+	if *dryRun {
+		fmt.Printf("would restore to %s UTC: %s\n", cutoff, plan)
+		return nil
+	}
+	fmt.Printf("restored to %s UTC: %s\n", cutoff, plan)
+	return nil
+}
+
+func embedCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("embed", flag.ContinueOnError)
+	batch := fs.Int("batch", embedBatch, "observations per provider request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return fmt.Errorf("-batch must be at least 1")
+	}
+	e, err := newEmbedder(embedderName, embeddingModel, embeddingURL, embeddingAPIKey, embeddingDimensions)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return fmt.Errorf("ENGRAM_EMBEDDER is not set")
+	}
+
+	stale, err := staleEmbeddings(ctx, db, e)
+	if err != nil {
+		return err
+	}
+	if stale > 0 {
+		fmt.Printf("%d observations were embedded with another model and will be re-embedded with %s\n", stale, e.Model())
+	}
+	total := 0
+	for {
+		n, err := embedPending(ctx, db, e, *batch)
+		total += n
+		if err != nil {
+			return fmt.Errorf("embedded %d observations, then: %v", total, err)
+		}
+		if n == 0 {
+			break
+		}
+		fmt.Printf("embedded %d observations\n", total)
+	}
+	fmt.Printf("done: %d observations embedded with %s\n", total, e.Model())
+	return nil
+}
+
+func writeStats(ctx context.Context, db *sql.DB, w io.Writer) error {
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "schema version: %d\n\n", version)
+
+	counts := []struct {
+		label string
+		query string
+	}{
+		{"entities", "SELECT count(*) FROM entities"},
+		{"observations", "SELECT count(*) FROM observations"},
+		{"relations", "SELECT count(*) FROM relations"},
+		{"tags", "SELECT count(*) FROM tags"},
+		{"open unknowns", "SELECT count(*) FROM unknowns WHERE resolved_at IS NULL"},
+	}
+	for _, c := range counts {
+		var n int64
+		if err := db.QueryRowContext(ctx, c.query).Scan(&n); err != nil {
+			return fmt.Errorf("%s: %v", c.label, err)
+		}
+		fmt.Fprintf(w, "%-14s %d\n", c.label+":", n)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT t.name, count(o.id)
+		FROM tags t
+		LEFT JOIN observation_tags ot ON ot.tag_id = t.id
+		LEFT JOIN observations o ON o.id = ot.observation_id
+		GROUP BY t.id ORDER BY count(o.id) DESC, t.name`)
+	if err != nil {
+		return fmt.Errorf("tag usage: %v", err)
+	}
+	defer rows.Close()
+
+	fmt.Fprintf(w, "\nobservations per tag:\n")
+	for rows.Next() {
+		var name string
+		var n int64
+		if err := rows.Scan(&name, &n); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "  %-12s %d\n", name, n)
+	}
+	return rows.Err()
+}
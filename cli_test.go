@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUsageListsCommands(t *testing.T) {
+	var buf bytes.Buffer
+	usage(&buf)
+	for name := range commands {
+		if !strings.Contains(buf.String(), name) {
+			t.Errorf("usage missing command %q", name)
+		}
+	}
+}
+
+func TestWriteStats_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	if err := writeStats(context.Background(), db, &buf); err != nil {
+		t.Fatalf("writeStats: %v", err)
+	}
+	for _, want := range []string{"schema version:", "entities:", "observations:", "observations per tag:", "homelab"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("stats missing %q:\n%s", want, buf.String())
+		}
+	}
+}
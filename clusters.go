@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultClusters        = 8
+	maxClusters            = 50
+	defaultClusterSamples  = 3
+	maxClusterSamples      = 10
+	maxClusterObservations = 5000
+)
+
+// labelStopwords are left out of cluster labels.
+var labelStopwords = func() map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(`the and for with that this from are was were has have had not but its his her their they them
+		you your our into onto over than then when what which who will would can could should about also all any each more
+		most some such only own same very just does did done been being there here uses used use via per like user
+		how why where whose whom know`) {
+		words[w] = true
+	}
+	return words
+}()
+
+type clusterPoint struct {
+	id                    int64
+	entity, content, tags string
+	v                     []float32
+}
+
+// kmeans groups unit vectors into at most k clusters by cosine similarity,
+// returning each vector's cluster. Seeding is k-means++ from a fixed seed
+// so the same memories cluster the same way on every call.
+func kmeans(vectors [][]float32, k, iterations int) ([]int, [][]float32) {
+	if k > len(vectors) {
+		k = len(vectors)
+	}
+	rng := rand.New(rand.NewSource(1))
+	centroids := [][]float32{vectors[rng.Intn(len(vectors))]}
+	dist := make([]float64, len(vectors))
+	for len(centroids) < k {
+		var total float64
+		for i, v := range vectors {
+			dist[i] = 1 - dot(v, centroids[0])
+			for _, c := range centroids[1:] {
+				dist[i] = min(dist[i], 1-dot(v, c))
+			}
+			dist[i] = max(dist[i], 0)
+			total += dist[i]
+		}
+		if total == 0 {
+			break // every vector already sits on a centroid
+		}
+		r, next := rng.Float64()*total, 0
+		for i, d := range dist {
+			if r -= d; r <= 0 {
+				next = i
+				break
+			}
+		}
+		centroids = append(centroids, vectors[next])
+	}
+
+	assign := make([]int, len(vectors))
+	for it := 0; it < iterations; it++ {
+		changed := it == 0
+		for i, v := range vectors {
+			best, bestSim := 0, dot(v, centroids[0])
+			for c := 1; c < len(centroids); c++ {
+				if s := dot(v, centroids[c]); s > bestSim {
+					best, bestSim = c, s
+				}
+			}
+			if assign[i] != best {
+				assign[i], changed = best, true
+			}
+		}
+		if !changed {
+			break
+		}
+		for c := range centroids {
+			sum := make([]float32, len(vectors[0]))
+			for i, v := range vectors {
+				if assign[i] == c {
+					for j, x := range v {
+						sum[j] += x
+					}
+				}
+			}
+			centroids[c] = normalize(sum)
+		}
+	}
+	return assign, centroids
+}
+
+func dot(a, b []float32) float64 {
+	var s float64
+	for i := range a {
+		s += float64(a[i]) * float64(b[i])
+	}
+	return s
+}
+
+// labelWords returns the distinct words of s worth labelling a cluster with.
+func labelWords(s string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '-' && r != '\''
+	}) {
+		w = strings.Trim(w, "-'")
+		if len([]rune(w)) >= 3 && !labelStopwords[w] && strings.IndexFunc(w, unicode.IsLetter) >= 0 {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// clusterLabel names a cluster by the n words its members use most often
+// relative to all observations clustered.
+func clusterLabel(members []clusterPoint, df map[string]int, total, n int) string {
+	counts := make(map[string]int)
+	for _, m := range members {
+		for w := range labelWords(m.entity + " " + m.content) {
+			counts[w]++
+		}
+	}
+	type scored struct {
+		word  string
+		score float64
+	}
+	var words []scored
+	for w, c := range counts {
+		if c < 2 && len(members) > 1 {
+			continue
+		}
+		words = append(words, scored{w, float64(c)/float64(len(members)) - float64(df[w])/float64(total)})
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].score != words[j].score {
+			return words[i].score > words[j].score
+		}
+		return words[i].word < words[j].word
+	})
+	var label []string
+	for _, w := range words {
+		if len(label) == n {
+			break
+		}
+		label = append(label, w.word)
+	}
+	if len(label) == 0 {
+		return "(no common words)"
+	}
+	return strings.Join(label, ", ")
+}
+
+// registerClusterMemories adds the cluster_memories tool.
+func registerClusterMemories(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes, embedder Embedder) {
+	s.AddTool(mcp.NewTool("cluster_memories",
+		mcp.WithDescription(`Group embedded observations by meaning and list each group with a label of its characteristic words, its tags and the observations closest to its centre.
+
+Use it to find themes the tags miss: a cluster spread over unrelated tags, or a large one inside a single broad tag, suggests a new tag. Needs ENGRAM_EMBEDDER; clusters the most recent observations up to a limit.`),
+		mcp.WithNumber("clusters",
+			mcp.Description(fmt.Sprintf("Number of groups (default %d, max %d)", defaultClusters, maxClusters)),
+		),
+		mcp.WithNumber("samples",
+			mcp.Description(fmt.Sprintf("Observations shown per group (default %d, max %d)", defaultClusterSamples, maxClusterSamples)),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Only cluster observations with any of these comma-separated tags, e.g. to split one broad tag"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), clusterMemoriesHandler(db, embedder, scopes))
+}
+
+func clusterMemoriesHandler(db *sql.DB, e Embedder, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if e == nil {
+			return toolError(codeUnavailable, "clustering needs embeddings, set ENGRAM_EMBEDDER to enable them"), nil
+		}
+		k := request.GetInt("clusters", defaultClusters)
+		if k < 2 || k > maxClusters {
+			return toolErrorf(codeInvalidArgument, "clusters must be between 2 and %d", maxClusters), nil
+		}
+		samples := request.GetInt("samples", defaultClusterSamples)
+		if samples < 1 || samples > maxClusterSamples {
+			return toolErrorf(codeInvalidArgument, "samples must be between 1 and %d", maxClusterSamples), nil
+		}
+
+		where := "x.model = ? AND e.archived_at IS NULL"
+		args := []any{e.Model()}
+		if tags := parseTagNames(request.GetString("tags", "")); len(tags) > 0 {
+			tagIDs, err := validateTags(ctx, db, tags)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			where += " AND EXISTS (SELECT 1 FROM observation_tags xt WHERE xt.observation_id = o.id AND xt.tag_id IN (" + placeholders(len(tagIDs)) + "))"
+			for _, id := range tagIDs {
+				args = append(args, id)
+			}
+		}
+		args = append(args, maxClusterObservations)
+
+		rows, err := db.QueryContext(ctx, restrictVisibility(`SELECT o.id, e.name, o.content,
+				COALESCE((SELECT group_concat(t.name, ',') FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), ''),
+				x.embedding
+			FROM observation_embeddings x JOIN observations o ON o.id = x.observation_id JOIN entities e ON e.id = o.entity_id
+			WHERE `+where+` ORDER BY o.id DESC LIMIT ?`, scopes.levels(ctx)), args...)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "query error: %v", err), nil
+		}
+		defer rows.Close()
+		var points []clusterPoint
+		for rows.Next() {
+			var p clusterPoint
+			var blob []byte
+			if err := rows.Scan(&p.id, &p.entity, &p.content, &p.tags, &blob); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "scan error: %v", err), nil
+			}
+			if p.v, err = decodeVector(blob); err != nil || len(p.v) == 0 || (len(points) > 0 && len(p.v) != len(points[0].v)) {
+				continue
+			}
+			p.v = normalize(p.v)
+			points = append(points, p)
+		}
+		if err := rows.Err(); err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "query error: %v", err), nil
+		}
+		if len(points) < 2 {
+			return mcp.NewToolResultText(fmt.Sprintf("not enough embedded observations to cluster (%d with %s)", len(points), e.Model())), nil
+		}
+
+		vectors := make([][]float32, len(points))
+		df := make(map[string]int)
+		for i, p := range points {
+			vectors[i] = p.v
+			for w := range labelWords(p.entity + " " + p.content) {
+				df[w]++
+			}
+		}
+		assign, centroids := kmeans(vectors, k, 25)
+		clusters := make([][]clusterPoint, len(centroids))
+		for i, c := range assign {
+			clusters[c] = append(clusters[c], points[i])
+		}
+		order := make([]int, 0, len(clusters))
+		for c := range clusters {
+			if len(clusters[c]) > 0 {
+				order = append(order, c)
+			}
+		}
+		sort.SliceStable(order, func(i, j int) bool { return len(clusters[order[i]]) > len(clusters[order[j]]) })
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d clusters of %d observations (%s)", len(order), len(points), e.Model())
+		if len(points) == maxClusterObservations {
+			fmt.Fprintf(&sb, ", the %d most recent", maxClusterObservations)
+		}
+		sb.WriteString("\n")
+		for n, c := range order {
+			members := clusters[c]
+			tagCounts := make(map[string]int)
+			for _, m := range members {
+				for _, t := range parseTagNames(m.tags) {
+					tagCounts[t]++
+				}
+			}
+			tags := make([]string, 0, len(tagCounts))
+			for t := range tagCounts {
+				tags = append(tags, t)
+			}
+			sort.Slice(tags, func(i, j int) bool {
+				if tagCounts[tags[i]] != tagCounts[tags[j]] {
+					return tagCounts[tags[i]] > tagCounts[tags[j]]
+				}
+				return tags[i] < tags[j]
+			})
+			for i, t := range tags {
+				tags[i] = fmt.Sprintf("%s %d", t, tagCounts[t])
+			}
+			if len(tags) == 0 {
+				tags = []string{"none"}
+			}
+
+			fmt.Fprintf(&sb, "\n## %d. %s (%d observations; tags: %s)\n", n+1, clusterLabel(members, df, len(points), 3), len(members), strings.Join(tags, ", "))
+			sort.SliceStable(members, func(i, j int) bool { return dot(members[i].v, centroids[c]) > dot(members[j].v, centroids[c]) })
+			for _, m := range members[:min(samples, len(members))] {
+				fmt.Fprintf(&sb, "- [%d] %s: %s\n", m.id, m.entity, strings.ReplaceAll(m.content, "\n", " "))
+			}
+		}
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestKmeans(t *testing.T) {
+	vectors := [][]float32{
+		normalize([]float32{1, 0.1, 0}), normalize([]float32{1, 0, 0.1}), normalize([]float32{0.9, 0.1, 0}),
+		normalize([]float32{0, 1, 0.1}), normalize([]float32{0.1, 1, 0}),
+	}
+	assign, centroids := kmeans(vectors, 2, 25)
+	if len(centroids) != 2 {
+		t.Fatalf("got %d centroids, want 2", len(centroids))
+	}
+	if assign[0] != assign[1] || assign[1] != assign[2] || assign[3] != assign[4] || assign[0] == assign[3] {
+		t.Errorf("kmeans() = %v, want the first three and last two together", assign)
+	}
+
+	again, _ := kmeans(vectors, 2, 25)
+	if !reflect.DeepEqual(assign, again) {
+		t.Errorf("kmeans is not deterministic: %v then %v", assign, again)
+	}
+
+	// More clusters than distinct vectors.
+	same := [][]float32{{1, 0}, {1, 0}, {1, 0}}
+	if assign, centroids := kmeans(same, 3, 25); len(centroids) != 1 || !reflect.DeepEqual(assign, []int{0, 0, 0}) {
+		t.Errorf("kmeans() of identical vectors = %v with %d centroids", assign, len(centroids))
+	}
+}
+
+func TestClusterLabel(t *testing.T) {
+	members := []clusterPoint{
+		{entity: "nas", content: "ZFS pool scrubbed weekly"},
+		{entity: "nas", content: "the zfs pool has 4 disks"},
+		{entity: "pi", content: "uses zfs send for backups"},
+	}
+	df := map[string]int{"zfs": 3, "pool": 2, "nas": 5, "disks": 1, "backups": 4}
+	tests := []struct {
+		name  string
+		total int
+		n     int
+		want  string
+	}{
+		{"top words", 20, 2, "zfs, pool"},
+		{"ties by name", 3, 3, "pool, zfs, nas"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clusterLabel(members, df, tt.total, tt.n); got != tt.want {
+				t.Errorf("clusterLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := labelWords("The user's NAS, 2024 and re-install"); !reflect.DeepEqual(got, map[string]bool{"user's": true, "nas": true, "re-install": true}) {
+		t.Errorf("labelWords() = %v", got)
+	}
+}
+
+func TestClusterMemories_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM observation_embeddings")
+	defer db.Exec("DELETE FROM tags WHERE name = 'cluster-test'")
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'cluster-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'cluster test %'")
+
+	for _, stmt := range []string{
+		"INSERT INTO tags (name, description) VALUES ('cluster-test', 'test')",
+		"INSERT INTO entities (name, entity_type) VALUES ('cluster-test-nas', 'device'), ('cluster-test-kitchen', 'place')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	for _, args := range []map[string]any{
+		{"entity": "cluster-test-nas", "content": "cluster test zfs pool scrub weekly"},
+		{"entity": "cluster-test-nas", "content": "cluster test zfs pool snapshots daily"},
+		{"entity": "cluster-test-nas", "content": "cluster test zfs pool replication offsite"},
+		{"entity": "cluster-test-kitchen", "content": "cluster test espresso grinder burrs"},
+		{"entity": "cluster-test-kitchen", "content": "cluster test espresso grinder settings"},
+	} {
+		args["tags"] = "cluster-test"
+		if result, err := callTool(addObservationHandler(db, nil), "add_observation", args); err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+	}
+	e := localEmbedder{dims: 512}
+	if _, err := embedAll(ctx, db, e, 64); err != nil {
+		t.Fatalf("embedAll: %v", err)
+	}
+
+	result, err := callTool(clusterMemoriesHandler(db, e, nil), "cluster_memories", map[string]any{"clusters": 2, "samples": 2, "tags": "cluster-test"})
+	if err != nil || result.IsError {
+		t.Fatalf("cluster_memories: %v %v", err, result.Content)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, want := range []string{
+		"2 clusters of 5 observations (local/hash@512)\n",
+		"\n## 1. cluster-test-nas, pool, zfs (3 observations; tags: cluster-test 3)\n",
+		"\n## 2. cluster-test-kitchen, espresso, grinder (2 observations; tags: cluster-test 2)\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in:\n%s", want, text)
+		}
+	}
+	if n := strings.Count(text, "\n- ["); n != 4 {
+		t.Errorf("got %d samples, want 4:\n%s", n, text)
+	}
+
+	for _, args := range []map[string]any{{"clusters": 1}, {"samples": 20}, {"tags": "cluster-test-nope"}} {
+		result, err := callTool(clusterMemoriesHandler(db, e, nil), "cluster_memories", args)
+		if err != nil || !result.IsError {
+			t.Errorf("cluster_memories %v: expected an error, got %v %v", args, err, result.Content)
+		}
+	}
+	if result, _ := callTool(clusterMemoriesHandler(db, nil, nil), "cluster_memories", nil); !result.IsError {
+		t.Errorf("expected an error without an embedder")
+	}
+}
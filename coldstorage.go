@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Cold storage keeps the hot database small: observations compacted into
+// archived_observations, and those of entities archived with archive_entity,
+// move to the libSQL database at coldURL once they have been archived for
+// coldDays days. unarchive brings them back. Unset coldURL keeps everything
+// in the hot database.
+var (
+	coldURL   = getEnv("ENGRAM_COLD_URL", "")
+	coldDays  = getEnvInt("ENGRAM_COLD_DAYS", 90)
+	coldHours = getEnvInt("ENGRAM_COLD_HOURS", 24)
+)
+
+// coldBatch is how many observations one pass moves to cold storage.
+const coldBatch = 500
+
+// coldSchema is the cold database's only table. Observations keep the id
+// they had and name their entity, since entity ids are the hot database's.
+var coldSchema = []string{
+	`CREATE TABLE IF NOT EXISTS cold_observations (
+		id INTEGER PRIMARY KEY,
+		entity TEXT NOT NULL,
+		entity_type TEXT NOT NULL,
+		summary_id INTEGER,
+		content TEXT NOT NULL,
+		visibility TEXT NOT NULL,
+		confidence REAL,
+		source TEXT,
+		conversation_id TEXT,
+		source_url TEXT,
+		metadata TEXT,
+		tags TEXT,
+		created_at TIMESTAMP,
+		archived_at TIMESTAMP,
+		moved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS cold_observations_entity ON cold_observations (entity)`,
+	`CREATE INDEX IF NOT EXISTS cold_observations_summary_id ON cold_observations (summary_id)`,
+}
+
+// openCold connects to the cold database at url and creates its table.
+func openCold(ctx context.Context, url string) (*sql.DB, error) {
+	db, err := sql.Open("libsql", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cold storage: %v", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping cold storage: %v", err)
+	}
+	for _, stmt := range coldSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create cold storage schema: %v", err)
+		}
+	}
+	return db, nil
+}
+
+// archivedObservation is an observation out of recall, in either tier.
+type archivedObservation struct {
+	id             int64
+	entity         string
+	entityType     string
+	summaryID      sql.NullInt64
+	content        string
+	visibility     string
+	confidence     sql.NullFloat64
+	source         sql.NullString
+	conversationID sql.NullString
+	sourceURL      sql.NullString
+	metadata       sql.NullString
+	tags           sql.NullString
+	createdAt      any
+	archivedAt     any
+}
+
+// archivedColumns are the columns of an archivedObservation, in scan order.
+const archivedColumns = "id, entity, entity_type, summary_id, content, visibility, confidence, source, conversation_id, source_url, metadata, tags, created_at, archived_at"
+
+func (a *archivedObservation) fields() []any {
+	return []any{&a.id, &a.entity, &a.entityType, &a.summaryID, &a.content, &a.visibility, &a.confidence,
+		&a.source, &a.conversationID, &a.sourceURL, &a.metadata, &a.tags, &a.createdAt, &a.archivedAt}
+}
+
+func (a *archivedObservation) values() []any {
+	return []any{a.id, a.entity, a.entityType, a.summaryID, a.content, a.visibility, a.confidence,
+		a.source, a.conversationID, a.sourceURL, a.metadata, a.tags, a.createdAt, a.archivedAt}
+}
+
+func scanArchived(rows *sql.Rows) ([]archivedObservation, error) {
+	defer rows.Close()
+	var archived []archivedObservation
+	for rows.Next() {
+		var a archivedObservation
+		if err := rows.Scan(a.fields()...); err != nil {
+			return nil, err
+		}
+		archived = append(archived, a)
+	}
+	return archived, rows.Err()
+}
+
+// hotArchived selects the hot database's archived observations as
+// archivedColumns: rows of archived_observations, and observations of
+// archived entities. where filters both, over columns aliased as x.
+func hotArchived(where string) string {
+	return `SELECT * FROM (
+		SELECT a.id, e.name AS entity, e.entity_type, a.summary_id, a.content, a.visibility, a.confidence, a.source,
+			a.conversation_id, a.source_url, a.metadata, a.tags, a.created_at, a.archived_at, 'archived_observations' AS tier
+		FROM archived_observations a JOIN entities e ON e.id = a.entity_id
+		UNION ALL
+		SELECT o.id, e.name, e.entity_type, NULL, COALESCE(c.body, o.content), o.visibility, o.confidence, o.source,
+			o.conversation_id, o.source_url, o.metadata,
+			(SELECT group_concat(t.name, ',') FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id),
+			o.created_at, e.archived_at, 'observations'
+		FROM observations o JOIN entities e ON e.id = o.entity_id LEFT JOIN contents c ON c.sha256 = o.content_sha256
+		WHERE e.archived_at IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.observation_id = o.id)
+			AND NOT EXISTS (SELECT 1 FROM reminders r WHERE r.observation_id = o.id)
+			AND NOT EXISTS (SELECT 1 FROM unknowns u WHERE u.observation_id = o.id)
+	) x WHERE ` + where
+}
+
+// dropHot removes observations from the hot database, whichever table holds
+// them, with the rows hanging off live ones.
+func dropHot(ctx context.Context, tx *sql.Tx, ids []any) error {
+	in := placeholders(len(ids))
+	for _, table := range []string{"observation_tags", "observation_embeddings", "observation_languages"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE observation_id IN ("+in+")", ids...); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM observations WHERE id IN ("+in+")", ids...); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM archived_observations WHERE id IN ("+in+")", ids...)
+	return err
+}
+
+// moveToCold moves up to coldBatch observations archived more than days ago
+// to cold, returning how many it moved. Rows are written to cold before
+// they are dropped from db, so a failure in between leaves a copy in both
+// that the next pass overwrites.
+func moveToCold(ctx context.Context, db, cold *sql.DB, days int) (int, error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02 15:04:05")
+	rows, err := db.QueryContext(ctx, "SELECT "+archivedColumns+" FROM ("+hotArchived("x.archived_at < ?")+") ORDER BY id LIMIT ?", cutoff, coldBatch)
+	if err != nil {
+		return 0, err
+	}
+	archived, err := scanArchived(rows)
+	if err != nil || len(archived) == 0 {
+		return 0, err
+	}
+
+	coldTx, err := cold.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer coldTx.Rollback()
+	ids := make([]any, len(archived))
+	for i, a := range archived {
+		if _, err := coldTx.ExecContext(ctx, "INSERT OR REPLACE INTO cold_observations ("+archivedColumns+") VALUES ("+placeholders(14)+")", a.values()...); err != nil {
+			return 0, fmt.Errorf("cold storage: %v", err)
+		}
+		ids[i] = a.id
+	}
+	if err := coldTx.Commit(); err != nil {
+		return 0, fmt.Errorf("cold storage: %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if err := dropHot(ctx, tx, ids); err != nil {
+		return 0, err
+	}
+	return len(archived), tx.Commit()
+}
+
+// moveAllToCold runs moveToCold until nothing is left to move.
+func moveAllToCold(ctx context.Context, db, cold *sql.DB, days int) (int, error) {
+	total := 0
+	for {
+		n, err := moveToCold(ctx, db, cold, days)
+		total += n
+		if err != nil || n < coldBatch {
+			return total, err
+		}
+	}
+}
+
+func moveToColdPeriodically(ctx context.Context, db *sql.DB, url string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cold, err := openCold(ctx, url)
+			if err != nil {
+				log.Printf("cold storage: %v", err)
+				continue
+			}
+			n, err := moveAllToCold(ctx, db, cold, coldDays)
+			cold.Close()
+			if err != nil {
+				log.Printf("cold storage: moved %d observation(s), then failed: %v", n, err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("cold storage: moved %d observation(s)", n)
+			}
+		}
+	}
+}
+
+// unarchiveFilter selects archived observations by the unarchive tool's
+// parameters, over archivedColumns.
+type unarchiveFilter struct {
+	entity    string
+	summaryID int64
+	ids       []int
+}
+
+func (f unarchiveFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.entity != "" {
+		conds = append(conds, "entity = ?")
+		args = append(args, f.entity)
+	}
+	if f.summaryID > 0 {
+		conds = append(conds, "summary_id = ?")
+		args = append(args, f.summaryID)
+	}
+	if len(f.ids) > 0 {
+		conds = append(conds, "id IN ("+placeholders(len(f.ids))+")")
+		for _, id := range f.ids {
+			args = append(args, id)
+		}
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// restoreObservations makes archived observations live again under their
+// old ids, recreating or unarchiving their entity, so they are not moved
+// straight back, and relinking the tags that still exist. It returns the
+// restored ids.
+func restoreObservations(ctx context.Context, tx *sql.Tx, archived []archivedObservation) ([]any, error) {
+	var ids []any
+	for _, a := range archived {
+		entityID, _, err := upsertEntity(ctx, tx, a.entity, a.entityType, "ignore")
+		if err != nil {
+			return nil, fmt.Errorf("observation %d: %v", a.id, err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE entities SET archived_at = NULL WHERE id = ? AND archived_at IS NOT NULL", entityID); err != nil {
+			return nil, fmt.Errorf("observation %d: %v", a.id, err)
+		}
+		stored, digest, err := storeContent(ctx, tx, a.content)
+		if err != nil {
+			return nil, fmt.Errorf("observation %d: %v", a.id, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO observations
+				(id, entity_id, content, content_sha256, visibility, confidence, source, conversation_id, source_url, metadata, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			a.id, entityID, stored, digest, a.visibility, a.confidence, a.source, a.conversationID, a.sourceURL, a.metadata, a.createdAt); err != nil {
+			return nil, fmt.Errorf("observation %d: %w", a.id, execFailure(err))
+		}
+		if tags := parseTagNames(a.tags.String); len(tags) > 0 {
+			args := []any{a.id}
+			for _, t := range tags {
+				args = append(args, t)
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO observation_tags (observation_id, tag_id) SELECT ?, id FROM tags WHERE name IN ("+placeholders(len(tags))+")", args...); err != nil {
+				return nil, fmt.Errorf("observation %d: %v", a.id, err)
+			}
+		}
+		ids = append(ids, a.id)
+	}
+	return ids, nil
+}
+
+// unarchive restores the archived observations f selects, from
+// archived_observations and, when cold is set, cold storage. Observations
+// of archived entities that never left the hot database are still in
+// observations; archive_entity with restore brings those back. With dryRun
+// it only reports what would be restored.
+func unarchive(ctx context.Context, db, cold *sql.DB, f unarchiveFilter, dryRun bool) (string, error) {
+	where, args := f.where()
+	rows, err := db.QueryContext(ctx, "SELECT "+archivedColumns+" FROM ("+hotArchived("x.tier = 'archived_observations' AND "+where)+") ORDER BY created_at, id", args...)
+	if err != nil {
+		return "", err
+	}
+	hot, err := scanArchived(rows)
+	if err != nil {
+		return "", err
+	}
+	var frozen []archivedObservation
+	if cold != nil {
+		rows, err := cold.QueryContext(ctx, "SELECT "+archivedColumns+" FROM cold_observations WHERE "+where+" ORDER BY created_at, id", args...)
+		if err != nil {
+			return "", fmt.Errorf("cold storage: %v", err)
+		}
+		if frozen, err = scanArchived(rows); err != nil {
+			return "", fmt.Errorf("cold storage: %v", err)
+		}
+	}
+	if len(hot)+len(frozen) == 0 {
+		return "no archived observations match", nil
+	}
+
+	var sb strings.Builder
+	if dryRun {
+		for _, a := range append(hot, frozen...) {
+			fmt.Fprintf(&sb, "%d %s [%s]: %s\n", a.id, a.entity, formatValue(a.createdAt), truncateText(a.content, 200))
+		}
+		fmt.Fprintf(&sb, "would restore %d archived and %d cold observation(s)", len(hot), len(frozen))
+		return sb.String(), nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	hotIDs, err := restoreObservations(ctx, tx, hot)
+	if err != nil {
+		return "", err
+	}
+	if len(hotIDs) > 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM archived_observations WHERE id IN ("+placeholders(len(hotIDs))+")", hotIDs...); err != nil {
+			return "", err
+		}
+	}
+	coldIDs, err := restoreObservations(ctx, tx, frozen)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	// The observations are live again; a failure here only leaves a stale
+	// cold copy, which the next move overwrites.
+	if len(coldIDs) > 0 {
+		if _, err := cold.ExecContext(ctx, "DELETE FROM cold_observations WHERE id IN ("+placeholders(len(coldIDs))+")", coldIDs...); err != nil {
+			return "", fmt.Errorf("restored %d observation(s) but failed to remove them from cold storage: %v", len(hotIDs)+len(coldIDs), err)
+		}
+	}
+	return fmt.Sprintf("restored %d archived and %d cold observation(s) under their old ids", len(hotIDs), len(coldIDs)), nil
+}
+
+// registerUnarchive adds the unarchive tool.
+func registerUnarchive(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("unarchive",
+		mcp.WithDescription(`Bring archived observations back into recall: those compact_memories folded into a summary (archived_observations) and those moved to cold storage (ENGRAM_COLD_URL) after their entity was archived. They return under their old ids, so earlier obs:N citations work again, and their entity is unarchived.
+
+Select them by entity, by the summary_id of the compaction summary that replaced them, or by id. Run with dry_run first to see what matches.`),
+		mcp.WithString("entity",
+			mcp.Description("Restore the archived observations of this entity"),
+		),
+		mcp.WithNumber("summary_id",
+			mcp.Description("Restore the observations folded into this compaction summary"),
+		),
+		mcp.WithArray("observation_ids",
+			mcp.Description("Restore these observations"),
+			mcp.WithNumberItems(),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("List what matches without restoring it (default false)"),
+		),
+	), unarchiveHandler(db, coldURL))
+}
+
+// unarchiveHandler restores archived observations, opening cold storage at
+// url for each call when it is set.
+func unarchiveHandler(db *sql.DB, url string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		f := unarchiveFilter{
+			entity:    strings.TrimSpace(request.GetString("entity", "")),
+			summaryID: int64(request.GetInt("summary_id", 0)),
+			ids:       request.GetIntSlice("observation_ids", nil),
+		}
+		if f.entity == "" && f.summaryID <= 0 && len(f.ids) == 0 {
+			return toolError(codeInvalidArgument, "pass entity, summary_id or observation_ids"), nil
+		}
+		var cold *sql.DB
+		if url != "" {
+			var err error
+			if cold, err = openCold(ctx, url); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			defer cold.Close()
+		}
+		report, err := unarchive(ctx, db, cold, f, request.GetBool("dry_run", false))
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "unarchive failed: %v", err), nil
+		}
+		return mcp.NewToolResultText(report), nil
+	}
+}
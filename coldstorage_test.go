@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnarchiveFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter unarchiveFilter
+		where  string
+		args   []any
+	}{
+		{"entity", unarchiveFilter{entity: "NAS"}, "entity = ?", []any{"NAS"}},
+		{"summary", unarchiveFilter{summaryID: 42}, "summary_id = ?", []any{int64(42)}},
+		{"ids and entity", unarchiveFilter{entity: "NAS", ids: []int{3, 4}}, "entity = ? AND id IN (?, ?)", []any{"NAS", 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.filter.where()
+			if where != tt.where || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("where() = %q %v, want %q %v", where, args, tt.where, tt.args)
+			}
+		})
+	}
+}
+
+func TestColdStorage_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cold := setupPeerDB(t)
+	defer cold.Close()
+	ctx := context.Background()
+	for _, stmt := range coldSchema {
+		if _, err := cold.Exec(stmt); err != nil {
+			t.Fatalf("cold schema: %v", err)
+		}
+	}
+	defer cold.Exec("DELETE FROM cold_observations WHERE entity = 'Cold test'")
+	defer db.Exec("DELETE FROM entities WHERE name = 'Cold test'")
+	defer db.Exec("DELETE FROM archived_observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Cold test')")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Cold test')")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Cold test')")
+
+	var entityID int64
+	if err := db.QueryRow("INSERT INTO entities (name, entity_type, archived_at) VALUES ('Cold test', 'Project', '2020-01-01 00:00:00') RETURNING id").Scan(&entityID); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, content := range []string{"Cold test kickoff", "Cold test shipped"} {
+		var id int64
+		if err := db.QueryRow("INSERT INTO observations (entity_id, content) VALUES (?, ?) RETURNING id", entityID, content).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("INSERT INTO observation_tags (observation_id, tag_id) SELECT ?, id FROM tags WHERE name = 'career'", id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := db.Exec(`INSERT INTO archived_observations (id, summary_id, entity_id, content, visibility, tags, created_at, archived_at)
+		VALUES (?, ?, ?, 'Cold test compacted note', 'private', 'career', '2019-06-01 00:00:00', '2020-01-01 00:00:00')`, ids[1]+1000000, ids[0], entityID); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := moveAllToCold(ctx, db, cold, 90)
+	if err != nil || n < 3 {
+		t.Fatalf("moveAllToCold = %d, %v; want the 3 archived observations moved", n, err)
+	}
+	var hot, frozen int
+	db.QueryRow("SELECT (SELECT count(*) FROM observations WHERE entity_id = ?) + (SELECT count(*) FROM archived_observations WHERE entity_id = ?)", entityID, entityID).Scan(&hot)
+	cold.QueryRow("SELECT count(*) FROM cold_observations WHERE entity = 'Cold test' AND tags = 'career'").Scan(&frozen)
+	if hot != 0 || frozen != 3 {
+		t.Errorf("after the move: %d hot, %d cold; want 0 and 3", hot, frozen)
+	}
+
+	report, err := unarchive(ctx, db, cold, unarchiveFilter{entity: "Cold test"}, true)
+	if err != nil || !strings.HasSuffix(report, "would restore 0 archived and 3 cold observation(s)") {
+		t.Errorf("dry run = %q, %v", report, err)
+	}
+	if report, err = unarchive(ctx, db, cold, unarchiveFilter{entity: "Cold test", ids: []int{int(ids[0])}}, false); err != nil {
+		t.Fatalf("unarchive: %v", err)
+	}
+
+	var content, tags string
+	var archivedAt any
+	db.QueryRow(`SELECT o.content, (SELECT group_concat(t.name) FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), e.archived_at
+		FROM observations o JOIN entities e ON e.id = o.entity_id WHERE o.id = ?`, ids[0]).Scan(&content, &tags, &archivedAt)
+	cold.QueryRow("SELECT count(*) FROM cold_observations WHERE entity = 'Cold test'").Scan(&frozen)
+	if content != "Cold test kickoff" || tags != "career" || archivedAt != nil || frozen != 2 {
+		t.Errorf("restored %q tags %q, entity archived_at %v, %d left cold (%s)", content, tags, archivedAt, frozen, report)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// hiddenColumns are left out of query results unless asked for by name, for
+// columns such as embeddings that are large and meaningless to a model.
+var hiddenColumns = getEnv("ENGRAM_HIDDEN_COLUMNS", "embedding,embeddings")
+
+// projection picks the result columns the query tool returns. include, when
+// set, is the exact list; otherwise every column but exclude and the hidden
+// ones is returned. Blob values are summarised unless included by name.
+type projection struct {
+	include []string
+	exclude []string
+	hidden  []string
+}
+
+func newProjection(include, exclude string) projection {
+	return projection{include: parseTagNames(include), exclude: parseTagNames(exclude), hidden: parseTagNames(hiddenColumns)}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply narrows cols and summarises blobs in results, returning the kept
+// columns and a note naming what was left out, empty when nothing was.
+func (p projection) apply(cols []string, results []map[string]any) ([]string, string, error) {
+	for _, list := range [][]string{p.include, p.exclude} {
+		for _, c := range list {
+			if !containsFold(cols, c) {
+				return nil, "", fmt.Errorf("unknown column %q, the query returns: %s", c, strings.Join(cols, ", "))
+			}
+		}
+	}
+
+	var kept, omitted []string
+	for _, c := range cols {
+		switch {
+		case len(p.include) > 0 && !containsFold(p.include, c), containsFold(p.exclude, c):
+		case len(p.include) == 0 && containsFold(p.hidden, c):
+			omitted = append(omitted, c)
+		default:
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, "", fmt.Errorf("no columns left to return, the query returns: %s", strings.Join(cols, ", "))
+	}
+
+	blobs := make(map[string]bool)
+	for _, c := range kept {
+		if containsFold(p.include, c) {
+			continue
+		}
+		for _, row := range results {
+			if b, ok := row[c].([]byte); ok {
+				row[c] = fmt.Sprintf("<blob, %d bytes>", len(b))
+				blobs[c] = true
+			}
+		}
+	}
+	for _, c := range kept {
+		if blobs[c] {
+			omitted = append(omitted, c+" (blob contents)")
+		}
+	}
+
+	if len(omitted) == 0 {
+		return kept, "", nil
+	}
+	return kept, fmt.Sprintf("omitted: %s. Name them in columns to include them.", strings.Join(omitted, ", ")), nil
+}
+
+// mergeDuplicateRows folds rows for the same observation into one. A join
+// through observation_tags returns an observation once per matching tag, and
+// each repeat costs context without saying anything new. Rows are the same
+// observation when they agree on id or observation_id and on content. Rows
+// without those columns are not observations and are left as they are, so
+// identical rows of other queries are kept. The other columns of merged
+// rows keep each distinct value, comma-separated. It returns the rows left
+// and how many were folded away.
+func mergeDuplicateRows(cols []string, results []map[string]any) ([]map[string]any, int) {
+	if !containsFold(cols, "content") || !containsFold(cols, "id") && !containsFold(cols, "observation_id") {
+		return results, 0
+	}
+	var key []string
+	for _, c := range cols {
+		if strings.EqualFold(c, "id") || strings.EqualFold(c, "observation_id") || strings.EqualFold(c, "content") {
+			key = append(key, c)
+		}
+	}
+
+	kept := results[:0]
+	first := make(map[string]int)
+	// values holds the distinct values seen per merged row and column.
+	values := make(map[int]map[string][]string)
+	for _, row := range results {
+		var k strings.Builder
+		for _, c := range key {
+			fmt.Fprintf(&k, "%T:%v\x00", row[c], row[c])
+		}
+		i, seen := first[k.String()]
+		if !seen {
+			first[k.String()] = len(kept)
+			kept = append(kept, row)
+			continue
+		}
+		if values[i] == nil {
+			values[i] = make(map[string][]string)
+		}
+		for _, c := range cols {
+			v := formatValue(row[c])
+			if v == formatValue(kept[i][c]) {
+				continue
+			}
+			if values[i][c] == nil {
+				values[i][c] = []string{formatValue(kept[i][c])}
+			}
+			if !slices.Contains(values[i][c], v) {
+				values[i][c] = append(values[i][c], v)
+			}
+		}
+	}
+	for i, merged := range values {
+		for c, vs := range merged {
+			kept[i][c] = strings.Join(vs, ", ")
+		}
+	}
+	return kept, len(results) - len(kept)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestProjectionApply(t *testing.T) {
+	cols := []string{"id", "content", "data", "embedding"}
+	tests := []struct {
+		name             string
+		include, exclude string
+		want             []string
+		wantNote         string
+		wantErr          bool
+	}{
+		{"defaults", "", "", []string{"id", "content", "data"}, "omitted: embedding, data (blob contents).", false},
+		{"include", "ID,embedding", "", []string{"id", "embedding"}, "", false},
+		{"include blob", "data", "", []string{"data"}, "", false},
+		{"exclude", "", "content, data", []string{"id"}, "omitted: embedding.", false},
+		{"unknown column", "id,body", "", nil, "", true},
+		{"nothing left", "", "id,content,data", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := []map[string]any{{"id": int64(1), "content": "nas", "data": []byte{1, 2, 3}, "embedding": "[0.1]"}}
+			p := newProjection(tt.include, tt.exclude)
+			got, note, err := p.apply(cols, results)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply() columns = %v, want %v", got, tt.want)
+			}
+			if !strings.HasPrefix(note, tt.wantNote) || (tt.wantNote == "") != (note == "") {
+				t.Errorf("apply() note = %q, want %q", note, tt.wantNote)
+			}
+			if containsFold(got, "data") && tt.include == "" {
+				if v := results[0]["data"]; v != "<blob, 3 bytes>" {
+					t.Errorf("data = %v, want a blob summary", v)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryColumns_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	const sqlStr = "SELECT 1 AS id, 'nas' AS content, X'00FF' AS data, '[0.1, 0.2]' AS embedding"
+	tests := []struct {
+		name    string
+		args    map[string]any
+		want    []string
+		wantNot []string
+		wantErr bool
+	}{
+		{"defaults", map[string]any{}, []string{"content: nas", "data: <blob, 2 bytes>", "omitted: embedding"}, []string{"[0.1"}, false},
+		{"columns", map[string]any{"columns": "content,embedding"}, []string{"content: nas", "embedding: [0.1, 0.2]"}, []string{"id:", "omitted"}, false},
+		{"exclude_columns", map[string]any{"exclude_columns": "data"}, []string{"id: 1"}, []string{"data:"}, false},
+		{"unknown column", map[string]any{"columns": "body"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args["sql"] = sqlStr
+			result, err := callTool(queryHandler(db, nil, nil), "query", tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v, want %v: %v", result.IsError, tt.wantErr, result.Content)
+			}
+			text := result.Content[0].(mcp.TextContent).Text
+			for _, w := range tt.want {
+				if !strings.Contains(text, w) {
+					t.Errorf("expected %q in %s", w, text)
+				}
+			}
+			for _, w := range tt.wantNot {
+				if strings.Contains(text, w) {
+					t.Errorf("unexpected %q in %s", w, text)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeDuplicateRows(t *testing.T) {
+	tests := []struct {
+		name       string
+		cols       []string
+		rows       []map[string]any
+		want       []map[string]any
+		wantMerged int
+	}{
+		{
+			name: "one row per tag",
+			cols: []string{"id", "content", "tag"},
+			rows: []map[string]any{
+				{"id": int64(1), "content": "nas", "tag": "homelab"},
+				{"id": int64(2), "content": "job", "tag": "career"},
+				{"id": int64(1), "content": "nas", "tag": "personal"},
+				{"id": int64(1), "content": "nas", "tag": "homelab"},
+			},
+			want: []map[string]any{
+				{"id": int64(1), "content": "nas", "tag": "homelab, personal"},
+				{"id": int64(2), "content": "job", "tag": "career"},
+			},
+			wantMerged: 2,
+		},
+		{
+			name: "identical rows without an observation id",
+			cols: []string{"entity", "content"},
+			rows: []map[string]any{
+				{"entity": "nas", "content": "runs truenas"},
+				{"entity": "nas", "content": "runs truenas"},
+				{"entity": "nas", "content": "has 4 disks"},
+			},
+			want: []map[string]any{
+				{"entity": "nas", "content": "runs truenas"},
+				{"entity": "nas", "content": "runs truenas"},
+				{"entity": "nas", "content": "has 4 disks"},
+			},
+		},
+		{
+			name: "numbers without an observation id",
+			cols: []string{"tag", "n"},
+			rows: []map[string]any{
+				{"tag": "homelab", "n": int64(2)},
+				{"tag": "homelab", "n": int64(2)},
+			},
+			want: []map[string]any{
+				{"tag": "homelab", "n": int64(2)},
+				{"tag": "homelab", "n": int64(2)},
+			},
+		},
+		{
+			// An entity id repeats across its observations: different
+			// content means different observations, kept apart.
+			name: "same id, different content",
+			cols: []string{"id", "content"},
+			rows: []map[string]any{
+				{"id": int64(7), "content": "runs truenas"},
+				{"id": int64(7), "content": "has 4 disks"},
+			},
+			want: []map[string]any{
+				{"id": int64(7), "content": "runs truenas"},
+				{"id": int64(7), "content": "has 4 disks"},
+			},
+		},
+		{
+			name: "only projected columns count",
+			cols: []string{"observation_id", "content"},
+			rows: []map[string]any{
+				{"observation_id": int64(3), "content": "nas", "tag": "homelab"},
+				{"observation_id": int64(3), "content": "nas", "tag": "career"},
+			},
+			want:       []map[string]any{{"observation_id": int64(3), "content": "nas", "tag": "homelab"}},
+			wantMerged: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, merged := mergeDuplicateRows(tt.cols, tt.rows)
+			if merged != tt.wantMerged {
+				t.Errorf("merged = %d, want %d", merged, tt.wantMerged)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryMergesDuplicates_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	const sqlStr = "SELECT 5 AS id, 'nas' AS content, t.column1 AS tag FROM (VALUES ('homelab'), ('personal')) t"
+	result, err := callTool(queryHandler(db, nil, nil), "query", map[string]any{"sql": sqlStr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := resultText(result)
+	if !strings.Contains(text, "tag: homelab, personal") || !strings.Contains(text, "merged 1 repeated row") {
+		t.Errorf("merged result = %q", text)
+	}
+
+	result, err = callTool(queryHandler(db, nil, nil), "query", map[string]any{"sql": sqlStr, "keep_duplicates": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := resultText(result); strings.Count(text, "content: nas") != 2 || strings.Contains(text, "merged") {
+		t.Errorf("keep_duplicates result = %q", text)
+	}
+}
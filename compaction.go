@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Compaction folds an entity's old observations into one summary
+// observation and moves the originals to archived_observations. It applies
+// to entities with more than compactObservations observations of one
+// visibility older than compactDays days; 0 turns background compaction off.
+// Summaries come from the OpenAI-compatible chat endpoint at summaryURL, or,
+// for the compact_memories tool, from the client's model when none is set.
+var (
+	compactObservations = getEnvInt("ENGRAM_COMPACT_OBSERVATIONS", 0)
+	compactDays         = getEnvInt("ENGRAM_COMPACT_DAYS", 180)
+	compactHours        = getEnvInt("ENGRAM_COMPACT_HOURS", 24)
+	summaryURL          = getEnv("ENGRAM_SUMMARY_URL", "")
+	summaryModel        = getEnv("ENGRAM_SUMMARY_MODEL", "")
+	summaryAPIKey       = getEnv("ENGRAM_SUMMARY_API_KEY", "")
+)
+
+const (
+	// compactBatch is the most observations folded into one summary; an
+	// entity with more is compacted over several passes.
+	compactBatch = 100
+	// defaultCompactObservations is compact_memories' threshold when
+	// ENGRAM_COMPACT_OBSERVATIONS is not set.
+	defaultCompactObservations = 50
+	maxCompactedChars          = 1000
+)
+
+// chatSampler samples from an OpenAI-compatible chat completions endpoint
+// (OpenAI, ollama's /v1, vLLM, ...), for work done with no client connected.
+type chatSampler struct {
+	url, model, key string
+}
+
+// newChatSampler returns the sampler for ENGRAM_SUMMARY_URL, or nil when it
+// is not set.
+func newChatSampler(url, model, key string) (*chatSampler, error) {
+	if url == "" {
+		return nil, nil
+	}
+	if model == "" {
+		return nil, fmt.Errorf("ENGRAM_SUMMARY_URL needs ENGRAM_SUMMARY_MODEL")
+	}
+	return &chatSampler{url: strings.TrimRight(url, "/"), model: model, key: key}, nil
+}
+
+func (c *chatSampler) RequestSampling(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	var messages []message
+	if request.SystemPrompt != "" {
+		messages = append(messages, message{"system", request.SystemPrompt})
+	}
+	for _, m := range request.Messages {
+		switch t := m.Content.(type) {
+		case mcp.TextContent:
+			messages = append(messages, message{string(m.Role), t.Text})
+		case *mcp.TextContent:
+			messages = append(messages, message{string(m.Role), t.Text})
+		default:
+			return nil, fmt.Errorf("chat endpoint takes text messages, not %T", m.Content)
+		}
+	}
+	header := http.Header{}
+	if c.key != "" {
+		header.Set("Authorization", "Bearer "+c.key)
+	}
+	var out struct {
+		Choices []struct {
+			Message message `json:"message"`
+		} `json:"choices"`
+	}
+	body := map[string]any{"model": c.model, "messages": messages, "max_tokens": request.MaxTokens}
+	if err := postJSON(ctx, c.url+"/chat/completions", header, body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("chat endpoint returned no choices")
+	}
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{Role: mcp.RoleAssistant, Content: mcp.NewTextContent(out.Choices[0].Message.Content)},
+		Model:           c.model,
+	}, nil
+}
+
+// compactable restricts observations aliased as o to those compaction may
+// archive: written before the cutoff, and not attached to, reminded of or
+// answering an unknown, which would lose their link.
+const compactable = `o.created_at < ?
+	AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.observation_id = o.id)
+	AND NOT EXISTS (SELECT 1 FROM reminders r WHERE r.observation_id = o.id)
+	AND NOT EXISTS (SELECT 1 FROM unknowns u WHERE u.observation_id = o.id)`
+
+// compactPolicy says which observations to compact: those of entity, or of
+// every entity when empty, where more than minObservations of one
+// visibility are older than days.
+type compactPolicy struct {
+	minObservations int
+	days            int
+	entity          string
+	dryRun          bool
+}
+
+func (p compactPolicy) cutoff() string {
+	return time.Now().UTC().AddDate(0, 0, -p.days).Format("2006-01-02 15:04:05")
+}
+
+// compactionGroup is one entity's old observations of one visibility.
+type compactionGroup struct {
+	entityID   int64
+	entity     string
+	visibility string
+	count      int
+}
+
+func compactionGroups(ctx context.Context, db *sql.DB, p compactPolicy) ([]compactionGroup, error) {
+	rows, err := db.QueryContext(ctx, `SELECT o.entity_id, e.name, o.visibility, count(*) FROM observations o
+		JOIN entities e ON e.id = o.entity_id
+		WHERE e.archived_at IS NULL AND (? = '' OR e.name = ?) AND `+compactable+`
+		GROUP BY o.entity_id, o.visibility HAVING count(*) > ?
+		ORDER BY count(*) DESC, e.name`, p.entity, p.entity, p.cutoff(), p.minObservations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var groups []compactionGroup
+	for rows.Next() {
+		var g compactionGroup
+		if err := rows.Scan(&g.entityID, &g.entity, &g.visibility, &g.count); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+const compactPrompt = `You consolidate old notes about one subject in a personal memory store into a single summary.
+Reply with the summary only: short plain sentences or "- " lines, keeping every fact that may still matter
+(names, numbers, dates, decisions, preferences) and noting when a later note replaced an earlier one.
+Drop repetition and small talk. Do not add anything the notes do not say.`
+
+// summarizeObservations asks smp for a summary of an entity's notes.
+func summarizeObservations(ctx context.Context, smp sampler, entity string, notes []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, rerankTimeout)
+	defer cancel()
+	prompt := fmt.Sprintf("Subject: %s\n\nNotes, oldest first:\n%s", entity, strings.Join(notes, "\n"))
+	result, err := smp.RequestSampling(ctx, mcp.CreateMessageRequest{CreateMessageParams: mcp.CreateMessageParams{
+		Messages:     []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.NewTextContent(prompt)}},
+		SystemPrompt: compactPrompt,
+		MaxTokens:    2048,
+	}})
+	if err != nil {
+		return "", err
+	}
+	var reply string
+	switch c := result.Content.(type) {
+	case mcp.TextContent:
+		reply = c.Text
+	case *mcp.TextContent:
+		reply = c.Text
+	default:
+		return "", fmt.Errorf("the model returned %T, not text", result.Content)
+	}
+	if reply = strings.TrimSpace(reply); reply == "" {
+		return "", fmt.Errorf("the model returned no summary")
+	}
+	return reply, nil
+}
+
+// compactGroup replaces up to compactBatch of a group's oldest observations
+// with a summary, returning the summary's id and how many were archived.
+// Observations a follow-up superseded are archived with the rest but kept
+// out of the summary, which holds only the latest item of each thread.
+func compactGroup(ctx context.Context, db *sql.DB, smp sampler, g compactionGroup, cutoff string) (int64, int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT o.id, COALESCE(c.body, o.content), o.created_at, NOT `+notSuperseded+` FROM observations o
+		LEFT JOIN contents c ON c.sha256 = o.content_sha256
+		WHERE o.entity_id = ? AND o.visibility = ? AND `+compactable+`
+		ORDER BY o.created_at, o.id LIMIT ?`, g.entityID, g.visibility, cutoff, compactBatch)
+	if err != nil {
+		return 0, 0, err
+	}
+	var ids []any
+	var notes []string
+	var first, last string
+	for rows.Next() {
+		var id int64
+		var content string
+		var createdAt any
+		var superseded bool
+		if err := rows.Scan(&id, &content, &createdAt, &superseded); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		day, _, _ := strings.Cut(formatValue(createdAt), "T")
+		if first == "" {
+			first = day
+		}
+		last = day
+		ids = append(ids, id)
+		if !superseded {
+			notes = append(notes, fmt.Sprintf("- [%s] %s", day, truncateText(content, maxCompactedChars)))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(ids) < 2 || len(notes) == 0 {
+		return 0, 0, nil
+	}
+
+	summary, err := summarizeObservations(ctx, smp, g.entity, notes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("summary: %v", err)
+	}
+	metadata, _ := json.Marshal(map[string]any{"compacted": len(ids), "from": first, "to": last})
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	in := placeholders(len(ids))
+	summaryIDs, err := insertObservation(summary, string(metadata), func(content string, metadata any) (int64, error) {
+		stored, digest, err := storeContent(ctx, tx, content)
+		if err != nil {
+			return 0, err
+		}
+		result, err := tx.ExecContext(ctx, `INSERT INTO observations (entity_id, content, content_sha256, visibility, source, metadata)
+			VALUES (?, ?, ?, ?, 'compaction', ?)`, g.entityID, stored, digest, g.visibility, metadata)
+		if err != nil {
+			return 0, execFailure(err)
+		}
+		id, _ := result.LastInsertId()
+		// The summary carries every tag its notes had.
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO observation_tags (observation_id, tag_id)
+			SELECT DISTINCT ?, tag_id FROM observation_tags WHERE observation_id IN (`+in+`)`, append([]any{id}, ids...)...); err != nil {
+			return 0, err
+		}
+		return id, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	summaryID := summaryIDs[0]
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO archived_observations
+			(id, summary_id, entity_id, content, visibility, confidence, source, conversation_id, source_url, metadata, tags, created_at)
+		SELECT o.id, ?, o.entity_id, COALESCE(c.body, o.content), o.visibility, o.confidence, o.source, o.conversation_id, o.source_url, o.metadata,
+			(SELECT group_concat(t.name, ',') FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id),
+			o.created_at
+		FROM observations o LEFT JOIN contents c ON c.sha256 = o.content_sha256
+		WHERE o.id IN (`+in+`)`, append([]any{summaryID}, ids...)...); err != nil {
+		return 0, 0, fmt.Errorf("archive: %v", err)
+	}
+	// Clear rows hanging off the originals explicitly, so archiving leaves
+	// nothing behind with ENGRAM_FOREIGN_KEYS=false too.
+	for _, table := range []string{"observation_tags", "observation_embeddings", "observation_languages"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE observation_id IN ("+in+")", ids...); err != nil {
+			return 0, 0, fmt.Errorf("archive: %v", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM observations WHERE id IN ("+in+")", ids...); err != nil {
+		return 0, 0, fmt.Errorf("archive: %v", err)
+	}
+	return summaryID, len(ids), tx.Commit()
+}
+
+// compactMemories applies p, summarizing with smp, and reports what it did
+// or, on a dry run, would do. A group that fails is reported and skipped.
+func compactMemories(ctx context.Context, db *sql.DB, smp sampler, p compactPolicy) (string, error) {
+	groups, err := compactionGroups(ctx, db, p)
+	if err != nil {
+		return "", err
+	}
+	if len(groups) == 0 {
+		return fmt.Sprintf("nothing to compact: no entity has more than %d observations of one visibility older than %d days\n", p.minObservations, p.days), nil
+	}
+	var sb strings.Builder
+	cutoff := p.cutoff()
+	for _, g := range groups {
+		if p.dryRun {
+			fmt.Fprintf(&sb, "%s: would compact %d %s observation(s)\n", g.entity, min(g.count, compactBatch), g.visibility)
+			continue
+		}
+		summaryID, archived, err := compactGroup(ctx, db, smp, g, cutoff)
+		if err != nil {
+			fmt.Fprintf(&sb, "%s: failed: %v\n", g.entity, err)
+			continue
+		}
+		fmt.Fprintf(&sb, "%s: %d %s observation(s) summarized as observation %d\n", g.entity, archived, g.visibility, summaryID)
+	}
+	return sb.String(), nil
+}
+
+func compactPeriodically(ctx context.Context, db *sql.DB, smp sampler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := compactMemories(ctx, db, smp, compactPolicy{minObservations: compactObservations, days: compactDays})
+			if err != nil {
+				log.Printf("compaction failed: %v", err)
+				continue
+			}
+			log.Printf("compaction complete\n%s", report)
+		}
+	}
+}
+
+// defaultCompactPolicy is the policy compact_memories and the compact
+// command start from.
+func defaultCompactPolicy() compactPolicy {
+	p := compactPolicy{minObservations: compactObservations, days: compactDays}
+	if p.minObservations <= 0 {
+		p.minObservations = defaultCompactObservations
+	}
+	return p
+}
+
+// registerCompactMemories adds compact_memories, summarizing with compactor.
+func registerCompactMemories(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes, compactor sampler) {
+	s.AddTool(mcp.NewTool("compact_memories",
+		mcp.WithDescription(fmt.Sprintf(`Fold old observations into summaries: for each entity with more than min_observations observations of one visibility older than older_than_days, up to %d of the oldest are summarized into one observation (source 'compaction', with their tags) and moved to archived_observations.
+
+Summaries come from the server's ENGRAM_SUMMARY_URL model, or from your model through sampling. Clients that only see some observations cannot compact. Run with dry_run first and only when the user asks; originals stay readable in archived_observations.`, compactBatch)),
+		mcp.WithString("entity",
+			mcp.Description("Only compact this entity (default all)"),
+		),
+		mcp.WithNumber("min_observations",
+			mcp.Description(fmt.Sprintf("Compact entities with more old observations than this (default %d)", defaultCompactPolicy().minObservations)),
+		),
+		mcp.WithNumber("older_than_days",
+			mcp.Description(fmt.Sprintf("Only observations older than this many days (default %d)", compactDays)),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Report what would be compacted without changing anything (default false)"),
+		),
+	), compactMemoriesHandler(db, scopes, compactor))
+}
+
+func compactMemoriesHandler(db *sql.DB, scopes *visibilityScopes, smp sampler) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// Compaction reads and rewrites observations of every visibility
+		// and namespace, and may send their text to the client's model.
+		if restricted(scopes.levels(ctx)) || namespaces.observationFilter(ctx) != "" {
+			return toolError(codeInvalidArgument, "this client only sees some observations, so it cannot compact them"), nil
+		}
+		p := defaultCompactPolicy()
+		p.minObservations = request.GetInt("min_observations", p.minObservations)
+		p.days = request.GetInt("older_than_days", p.days)
+		p.entity = strings.TrimSpace(request.GetString("entity", ""))
+		p.dryRun = request.GetBool("dry_run", false)
+		if p.minObservations < 1 || p.days < 1 {
+			return toolError(codeInvalidArgument, "min_observations and older_than_days must be at least 1"), nil
+		}
+		report, err := compactMemories(ctx, db, smp, p)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "compaction failed: %v", err), nil
+		}
+		return mcp.NewToolResultText(report), nil
+	}
+}
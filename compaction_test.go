@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNewChatSampler(t *testing.T) {
+	if c, err := newChatSampler("", "", ""); c != nil || err != nil {
+		t.Errorf("newChatSampler with no URL = %v, %v; want nil, nil", c, err)
+	}
+	if _, err := newChatSampler("http://localhost:11434/v1", "", ""); err == nil {
+		t.Error("newChatSampler without a model should fail")
+	}
+}
+
+func TestChatSampler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer k" || body.Model != "m" ||
+			len(body.Messages) != 2 || body.Messages[0].Role != "system" || body.Messages[1].Content != "notes" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "summary"}}]}`))
+	}))
+	defer srv.Close()
+
+	c, err := newChatSampler(srv.URL+"/v1/", "m", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.RequestSampling(context.Background(), mcp.CreateMessageRequest{CreateMessageParams: mcp.CreateMessageParams{
+		Messages:     []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.NewTextContent("notes")}},
+		SystemPrompt: "consolidate",
+	}})
+	if err != nil {
+		t.Fatalf("RequestSampling: %v", err)
+	}
+	if text, ok := result.Content.(mcp.TextContent); !ok || text.Text != "summary" {
+		t.Errorf("RequestSampling content = %#v", result.Content)
+	}
+}
+
+func TestCompactMemories_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM entities WHERE name = 'Compaction test'")
+	defer db.Exec("DELETE FROM archived_observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Compaction test')")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Compaction test')")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Compaction test')")
+	var entityID int64
+	if err := db.QueryRow("INSERT INTO entities (name, entity_type) VALUES ('Compaction test', 'Test') RETURNING id").Scan(&entityID); err != nil {
+		t.Fatal(err)
+	}
+	for i, tag := range []string{"homelab", "homelab", "drinks", "homelab"} {
+		var id int64
+		if err := db.QueryRow(`INSERT INTO observations (entity_id, content, created_at) VALUES (?, ?, ?) RETURNING id`,
+			entityID, "Compaction test note "+string(rune('a'+i)), "2020-01-0"+string(rune('1'+i))+" 12:00:00").Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("INSERT INTO observation_tags (observation_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", id, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO observations (entity_id, content) VALUES (?, 'Compaction test recent note')", entityID); err != nil {
+		t.Fatal(err)
+	}
+
+	p := compactPolicy{minObservations: 3, days: 30, entity: "Compaction test", dryRun: true}
+	report, err := compactMemories(ctx, db, nil, p)
+	if err != nil || report != "Compaction test: would compact 4 private observation(s)\n" {
+		t.Errorf("dry run = %q, %v", report, err)
+	}
+
+	var prompt string
+	smp := samplerFunc(func(request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+		prompt = request.Messages[0].Content.(mcp.TextContent).Text
+		return replyText("Compaction test summary")(request)
+	})
+	p.dryRun = false
+	if report, err = compactMemories(ctx, db, smp, p); err != nil || !strings.Contains(report, "4 private observation(s) summarized") {
+		t.Fatalf("compactMemories = %q, %v", report, err)
+	}
+	if !strings.Contains(prompt, "- [2020-01-01] Compaction test note a") || strings.Contains(prompt, "recent") {
+		t.Errorf("prompt = %q, want the four old notes only", prompt)
+	}
+
+	var remaining, archived int
+	var summary, source, tags, metadata string
+	db.QueryRow("SELECT count(*) FROM observations WHERE entity_id = ?", entityID).Scan(&remaining)
+	db.QueryRow("SELECT count(*) FROM archived_observations WHERE entity_id = ? AND summary_id IS NOT NULL", entityID).Scan(&archived)
+	db.QueryRow(`SELECT o.content, o.source, o.metadata, (SELECT group_concat(t.name, ',') FROM (SELECT t.name FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id
+		WHERE ot.observation_id = o.id ORDER BY t.name) t) FROM observations o WHERE o.entity_id = ? AND o.source = 'compaction'`, entityID).Scan(&summary, &source, &metadata, &tags)
+	if remaining != 2 || archived != 4 || summary != "Compaction test summary" || tags != "drinks,homelab" ||
+		metadata != `{"compacted":4,"from":"2020-01-01","to":"2020-01-04"}` {
+		t.Errorf("after compaction: %d observations, %d archived, summary %q (%s) tags %q metadata %s", remaining, archived, summary, source, tags, metadata)
+	}
+
+	if report, _ = compactMemories(ctx, db, smp, p); !strings.HasPrefix(report, "nothing to compact") {
+		t.Errorf("second pass = %q, want nothing left to compact", report)
+	}
+	public, err := parseVisibilityScopes("public", "")
+	if err != nil {
+		t.Fatalf("parseVisibilityScopes: %v", err)
+	}
+	prompt = ""
+	result, err := callTool(compactMemoriesHandler(db, public, smp), "compact_memories", map[string]any{"entity": "Compaction test", "min_observations": float64(1), "older_than_days": float64(1)})
+	if err != nil || !result.IsError || prompt != "" {
+		t.Errorf("restricted client compacted: %v, %v, prompt %q", result, err, prompt)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Settings come from the environment, then from the config file init
+// writes: ENGRAM_CONFIG, or engram/config.env under the user config
+// directory. Both hold the same KEY=value names, so a variable set in the
+// environment overrides the file.
+var (
+	fileSettingsOnce sync.Once
+	fileSettings     map[string]string
+)
+
+func configPath() string {
+	if p := os.Getenv("ENGRAM_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "engram", "config.env")
+}
+
+// setting returns key from the environment, or from the config file.
+func setting(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	fileSettingsOnce.Do(func() {
+		var err error
+		if fileSettings, err = readConfigFile(configPath()); err != nil {
+			log.Printf("ignoring config file: %v", err)
+		}
+	})
+	return fileSettings[key]
+}
+
+// readConfigFile reads KEY=value lines, skipping blank lines and # comments.
+// Values may be quoted and lines may start with "export ", so the file can
+// also be sourced by a shell or passed to docker --env-file. A missing file
+// has no settings.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: want KEY=value", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		settings[key] = value
+	}
+	return settings, scanner.Err()
+}
+
+// writeConfigFile sets values in the config file at path, keeping its other
+// lines, and creates it readable by the owner only: it can hold tokens.
+func writeConfigFile(path string, values map[string]string) error {
+	var lines []string
+	if data, err := os.ReadFile(path); err == nil {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	} else if !os.IsNotExist(err) {
+		return err
+	} else {
+		lines = []string{"# memory-mcp settings, written by `memory-mcp init`. The environment overrides them."}
+	}
+
+	written := make(map[string]bool)
+	for i, line := range lines {
+		key, _, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), "export "), "=")
+		key = strings.TrimSpace(key)
+		if value, set := values[key]; ok && set && !written[key] {
+			lines[i] = key + "=" + value
+			written[key] = true
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if !written[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lines = append(lines, k+"="+values[k])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file that already existed.
+	return os.Chmod(path, 0o600)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	maxUnconfirmedRows = getEnvInt("ENGRAM_CONFIRM_ROWS", 10)
+	stringLiteral      = regexp.MustCompile(`'(?:[^']|'')*'`)
+)
+
+// checkWideWrite rejects an UPDATE or DELETE without a WHERE clause of its
+// own unless the caller confirmed it. A WHERE inside a string, such as
+// 'where is it', or inside a subquery does not count.
+func checkWideWrite(sqlStr string, confirm bool) error {
+	if confirm || !updatesOrDeletes(sqlStr) {
+		return nil
+	}
+	if stmt, _ := parseStatement(sqlStr); !stmt.where {
+		return errorf(codeConfirmationRequired, "UPDATE/DELETE without a WHERE clause changes every row. Add a WHERE clause, or pass confirm: true if that is really intended")
+	}
+	return nil
+}
+
+// execConfirmed runs an UPDATE or DELETE in a transaction and rolls it back if
+// it touched more than maxUnconfirmedRows without confirmation, counting the
+// rows ON DELETE CASCADE took with it as well as its own. Other statements,
+// and confirmed ones, run directly.
+func execConfirmed(ctx context.Context, db beginner, sqlStr string, confirm bool) (sql.Result, error) {
+	if confirm || !updatesOrDeletes(sqlStr) {
+		return db.ExecContext(ctx, sqlStr)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	dependents, err := cascadeTables(ctx, tx, writeTarget(sqlStr))
+	if err != nil {
+		return nil, err
+	}
+	before, err := countRows(ctx, tx, dependents)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx, sqlStr)
+	if err != nil {
+		return nil, err
+	}
+	after, err := countRows(ctx, tx, dependents)
+	if err != nil {
+		return nil, err
+	}
+	var cascaded int64
+	for table, n := range before {
+		cascaded += max(0, n-after[table])
+	}
+	if affected, _ := result.RowsAffected(); affected+cascaded > int64(maxUnconfirmedRows) {
+		return nil, &unconfirmedError{affected: affected + cascaded, cascaded: cascaded}
+	}
+	return result, tx.Commit()
+}
+
+// cascadeTables returns the tables that lose rows through ON DELETE CASCADE
+// when rows of table are deleted, directly or further down the chain.
+func cascadeTables(ctx context.Context, q queryer, table string) ([]string, error) {
+	var tables []string
+	seen := map[string]bool{table: true}
+	for queue := []string{table}; len(queue) > 0; queue = queue[1:] {
+		rows, err := q.QueryContext(ctx, `SELECT DISTINCT m.name FROM sqlite_schema m, pragma_foreign_key_list(m.name) f
+			WHERE m.type = 'table' AND lower(f."table") = ? AND upper(f.on_delete) = 'CASCADE'`, queue[0])
+		if err != nil {
+			return nil, fmt.Errorf("tables referencing %s: %v", queue[0], err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if name = strings.ToLower(name); !seen[name] {
+				seen[name] = true
+				tables = append(tables, name)
+				queue = append(queue, name)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+// countRows returns the number of rows in each of tables.
+func countRows(ctx context.Context, q queryer, tables []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		rows, err := q.QueryContext(ctx, "SELECT count(*) FROM "+quoteIdent(table))
+		if err != nil {
+			return nil, err
+		}
+		var n int64
+		if rows.Next() {
+			err = rows.Scan(&n)
+		}
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		counts[table] = n
+	}
+	return counts, nil
+}
+
+// updatesOrDeletes reports whether sqlStr is an UPDATE or DELETE, with or
+// without a WITH clause before it.
+func updatesOrDeletes(sqlStr string) bool {
+	stmt, err := parseStatement(sqlStr)
+	return err == nil && (stmt.verb == "UPDATE" || stmt.verb == "DELETE")
+}
+
+type unconfirmedError struct {
+	affected int64
+	// cascaded is how many of affected were dependent rows deleted by
+	// ON DELETE CASCADE.
+	cascaded int64
+}
+
+func (e *unconfirmedError) Error() string {
+	if e.cascaded > 0 {
+		return fmt.Sprintf("statement would change %d rows, %d of them dependent rows deleted along with it, more than the %d allowed without confirmation. Nothing was changed; narrow the WHERE clause, or pass confirm: true if that is really intended", e.affected, e.cascaded, maxUnconfirmedRows)
+	}
+	return fmt.Sprintf("statement would change %d rows, more than the %d allowed without confirmation. Nothing was changed; narrow the WHERE clause, or pass confirm: true if that is really intended", e.affected, maxUnconfirmedRows)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCheckWideWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		confirm bool
+		wantErr bool
+	}{
+		{"delete without where blocked", "DELETE FROM observations", false, true},
+		{"update without where blocked", "UPDATE entities SET entity_type = 'Thing'", false, true},
+		{"lowercase delete blocked", "delete from observations", false, true},
+		{"where inside literal blocked", "UPDATE observations SET content = 'where is it'", false, true},
+		{"delete without where confirmed", "DELETE FROM observations", true, false},
+		{"delete with where allowed", "DELETE FROM observations WHERE id = 1", false, false},
+		{"update with where allowed", "UPDATE entities SET name = 'x' WHERE id = 1", false, false},
+		{"literal with quote then where", "UPDATE observations SET content = 'it''s' WHERE id = 1", false, false},
+		{"delete after with blocked", "WITH x AS (SELECT 1 WHERE 1) DELETE FROM observations", false, true},
+		{"where only in subquery blocked", "UPDATE entities SET name = (SELECT name FROM tags WHERE id = 1)", false, true},
+		{"insert unaffected", "INSERT INTO entities (name, entity_type) VALUES ('a', 'b')", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWideWrite(tt.sql, tt.confirm)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkWideWrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWideWriteGate_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for i := 0; i <= maxUnconfirmedRows; i++ {
+		if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES (?, 'ConfirmTest')", fmt.Sprintf("confirm_test_%d", i)); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	defer db.Exec("DELETE FROM entities WHERE entity_type = 'ConfirmTest'")
+
+	t.Run("many rows rolled back without confirm", func(t *testing.T) {
+		result, err := callExecute(db, "UPDATE entities SET entity_type = 'ConfirmTest' WHERE entity_type = 'ConfirmTest'")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error for unconfirmed wide update")
+		}
+
+		result, err = callExecute(db, "DELETE FROM entities WHERE entity_type = 'ConfirmTest'")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error for unconfirmed wide delete")
+		}
+		var n int
+		db.QueryRow("SELECT count(*) FROM entities WHERE entity_type = 'ConfirmTest'").Scan(&n)
+		if n != maxUnconfirmedRows+1 {
+			t.Fatalf("rows changed despite rejection: %d remain", n)
+		}
+	})
+
+	t.Run("confirmed delete succeeds", func(t *testing.T) {
+		result, err := callTool(executeHandler(db, nil, nil), "execute", map[string]any{"sql": "DELETE FROM entities WHERE entity_type = 'ConfirmTest'", "confirm": true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("confirmed delete failed: %v", result.Content)
+		}
+	})
+}
+
+func TestWideWriteGateCascade_Integration(t *testing.T) {
+	setup := setupTestDB(t)
+	setup.Close()
+	url := os.Getenv("LIBSQL_URL")
+	if url == "" {
+		url = "http://localhost:8080"
+	}
+	db := sql.OpenDB(&pragmaConnector{dsn: url, pragmas: []string{"PRAGMA foreign_keys = ON"}})
+	defer db.Close()
+
+	res, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('confirm_cascade_test', 'ConfirmTest')")
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	defer db.Exec("DELETE FROM entities WHERE name = 'confirm_cascade_test'")
+	id, _ := res.LastInsertId()
+	for i := 0; i < maxUnconfirmedRows; i++ {
+		if _, err := db.Exec("INSERT INTO observations (entity_id, content) VALUES (?, ?)", id, fmt.Sprintf("cascade test %d", i)); err != nil {
+			t.Fatalf("insert observation: %v", err)
+		}
+	}
+
+	// One entity row, but its observations go with it.
+	result, err := callExecute(db, "DELETE FROM entities WHERE name = 'confirm_cascade_test'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "dependent rows") {
+		t.Fatalf("expected the cascade to need confirmation, got %v", result.Content)
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM observations WHERE entity_id = ?", id).Scan(&n)
+	if n != maxUnconfirmedRows {
+		t.Fatalf("observations deleted despite rejection: %d remain", n)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// contentDedupBytes is the length from which observation content is stored
+// once in the contents table, by SHA-256, with the observation keeping a
+// preview; 0 stores every observation inline.
+var contentDedupBytes = getEnvInt("ENGRAM_CONTENT_DEDUP_BYTES", 4096)
+
+// contentPreviewRunes is how much of a stored body its observations keep, so
+// they still read, list and search sensibly.
+const contentPreviewRunes = 300
+
+// contentPreview is what observations.content holds for a stored body. It
+// names the hash, so the same body filed under one entity twice is still a
+// duplicate, and different bodies sharing a start are not.
+func contentPreview(body, digest string) string {
+	return fmt.Sprintf("%s [full text: %d bytes, sha256 %s; read it with get_content]", truncateText(body, contentPreviewRunes), len(body), digest[:12])
+}
+
+// storeContent returns the content and content_sha256 to insert into
+// observations: content itself and NULL when it is short, otherwise a
+// preview and the hash of the body, which is added to contents unless an
+// identical one is there already.
+func storeContent(ctx context.Context, db execer, content string) (string, any, error) {
+	if contentDedupBytes <= 0 || len(content) < contentDedupBytes {
+		return content, nil, nil
+	}
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+	if _, err := db.ExecContext(ctx, `INSERT INTO contents (sha256, body, size) VALUES (?, ?, ?)
+		ON CONFLICT(sha256) DO NOTHING`, digest, content, len(content)); err != nil {
+		return "", nil, err
+	}
+	return contentPreview(content, digest), digest, nil
+}
+
+// dedupeContents moves long observation content written before the contents
+// table, or through execute, into it, and drops bodies no observation
+// references any more. It returns how many observations were moved and how
+// many bodies were dropped.
+func dedupeContents(ctx context.Context, db *sql.DB) (moved, dropped int64, err error) {
+	if contentDedupBytes > 0 {
+		rows, err := db.QueryContext(ctx, "SELECT id, content FROM observations WHERE content_sha256 IS NULL AND length(CAST(content AS BLOB)) >= ?", contentDedupBytes)
+		if err != nil {
+			return 0, 0, err
+		}
+		long := make(map[int64]string)
+		for rows.Next() {
+			var id int64
+			var content string
+			if err := rows.Scan(&id, &content); err != nil {
+				rows.Close()
+				return 0, 0, err
+			}
+			long[id] = content
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, 0, err
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer tx.Rollback()
+		for id, content := range long {
+			stored, digest, err := storeContent(ctx, tx, content)
+			if err != nil {
+				return 0, 0, fmt.Errorf("observation %d: %v", id, err)
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE observations SET content = ?, content_sha256 = ? WHERE id = ?", stored, digest, id); err != nil {
+				return 0, 0, fmt.Errorf("observation %d: %v", id, err)
+			}
+			moved++
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	result, err := db.ExecContext(ctx, "DELETE FROM contents WHERE sha256 NOT IN (SELECT content_sha256 FROM observations WHERE content_sha256 IS NOT NULL)")
+	if err != nil {
+		return moved, 0, err
+	}
+	dropped, _ = result.RowsAffected()
+	return moved, dropped, nil
+}
+
+// fullContent returns an observation's full text: its stored body, or its
+// content when it has none.
+func fullContent(ctx context.Context, db *sql.DB, observationID int64, levels []string) (string, string, error) {
+	var entity, content string
+	var body sql.NullString
+	err := db.QueryRowContext(ctx, restrictVisibility(`SELECT e.name, o.content, c.body FROM observations o
+		JOIN entities e ON e.id = o.entity_id LEFT JOIN contents c ON c.sha256 = o.content_sha256
+		WHERE o.id = ?`, levels), observationID).Scan(&entity, &content, &body)
+	if err != nil {
+		return "", "", err
+	}
+	if body.Valid {
+		content = body.String
+	}
+	return entity, content, nil
+}
+
+// registerGetContent adds the get_content tool.
+func registerGetContent(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("get_content",
+		mcp.WithDescription("Read the full text of an observation. Long observations are stored once however many entities they are filed under, and their content is a preview ending in '[full text: ... read it with get_content]'; this returns the whole body and how many other entities share it."),
+		mcp.WithNumber("observation_id",
+			mcp.Required(),
+			mcp.Description("ID of the observation"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), getContentHandler(db, scopes))
+}
+
+func getContentHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, err := request.RequireInt("observation_id")
+		if err != nil {
+			return toolError(codeInvalidArgument, "observation_id parameter is required"), nil
+		}
+		entity, content, err := fullContent(ctx, db, int64(id), scopes.levels(ctx))
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "observation %d does not exist", id), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error reading observation %d: %v", id, err), nil
+		}
+
+		var others int
+		if err := db.QueryRowContext(ctx, `SELECT count(DISTINCT o2.entity_id) - 1 FROM observations o
+			JOIN observations o2 ON o2.content_sha256 = o.content_sha256 WHERE o.id = ?`, id).Scan(&others); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error reading observation %d: %v", id, err), nil
+		}
+		header := fmt.Sprintf("observation %d of %s (%d bytes)", id, entity, len(content))
+		switch {
+		case others == 1:
+			header += ", also filed under 1 other entity"
+		case others > 1:
+			header += fmt.Sprintf(", also filed under %d other entities", others)
+		}
+		return mcp.NewToolResultText(header + "\n\n" + content), nil
+	}
+}
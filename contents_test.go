@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestStoreContentShort(t *testing.T) {
+	// Short content never reaches the database, so a nil execer is safe.
+	stored, digest, err := storeContent(context.Background(), nil, "NAS runs TrueNAS")
+	if err != nil || stored != "NAS runs TrueNAS" || digest != nil {
+		t.Errorf("storeContent() = %q, %v, %v; want the content inline", stored, digest, err)
+	}
+
+	preview := contentPreview(strings.Repeat("word ", 100), strings.Repeat("ab", 32))
+	if !strings.HasPrefix(preview, "word word") || !strings.HasSuffix(preview, "[full text: 500 bytes, sha256 abababababab; read it with get_content]") {
+		t.Errorf("contentPreview() = %q", preview)
+	}
+}
+
+func TestContentDedup_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'Contents test %'")
+	defer db.Exec("DELETE FROM contents WHERE body LIKE 'Contents test body%'")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name LIKE 'Contents test %')")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name LIKE 'Contents test %')")
+	for _, name := range []string{"Contents test A", "Contents test B"} {
+		if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES (?, 'Test')", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body := "Contents test body\n" + strings.Repeat("A pasted runbook line that goes on for a while.\n", 120)
+	var ids []int64
+	for _, entity := range []string{"Contents test A", "Contents test B"} {
+		result, err := callTool(addObservationHandler(db, nil), "add_observation", map[string]any{"entity": entity, "content": body, "tags": "homelab"})
+		if err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+		var id int64
+		db.QueryRow("SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = ?", entity).Scan(&id)
+		ids = append(ids, id)
+	}
+
+	var bodies int
+	var content string
+	db.QueryRow("SELECT count(*) FROM contents WHERE body = ?", body).Scan(&bodies)
+	db.QueryRow("SELECT content FROM observations WHERE id = ?", ids[0]).Scan(&content)
+	if bodies != 1 || len(content) >= len(body) || !strings.Contains(content, "read it with get_content") {
+		t.Errorf("%d stored bodies, observation content %q; want one body and a preview", bodies, content)
+	}
+
+	result, err := callTool(getContentHandler(db, nil), "get_content", map[string]any{"observation_id": float64(ids[0])})
+	if err != nil || result.IsError {
+		t.Fatalf("get_content: %v %v", err, result.Content)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.HasSuffix(text, "\n\n"+body) || !strings.Contains(text, "also filed under 1 other entity") {
+		t.Errorf("get_content = %q", text)
+	}
+
+	// A long observation written through SQL is moved on the next pass, and a
+	// body no observation uses any more is dropped.
+	if _, err := db.Exec("UPDATE observations SET content = ?, content_sha256 = NULL WHERE id = ?", body+"edited", ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM observations WHERE id = ?", ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	moved, dropped, err := dedupeContents(ctx, db)
+	if err != nil {
+		t.Fatalf("dedupeContents: %v", err)
+	}
+	if moved < 1 || dropped < 1 {
+		t.Errorf("moved %d, dropped %d; want the edited observation moved and the old body dropped", moved, dropped)
+	}
+	if _, full, err := fullContent(ctx, db, ids[1], visibilityLevels); err != nil || full != body+"edited" {
+		t.Errorf("full content after the move = %d bytes (%v)", len(full), err)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	contextURIPrefix = "memory://context/"
+	// contextSectionLimit caps each list in a context block, keeping it
+	// small enough to read at the start of every conversation.
+	contextSectionLimit = 10
+)
+
+// templateArgument returns a resource template variable, which mcp-go
+// passes as a string or a one-element list.
+func templateArgument(request mcp.ReadResourceRequest, name string) string {
+	switch v := request.Params.Arguments[name].(type) {
+	case string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// contextLine is one bullet of a context block.
+type contextLine struct {
+	id      int64
+	entity  string
+	content string
+}
+
+func writeContextSection(b *strings.Builder, title string, lines []contextLine) {
+	if len(lines) == 0 {
+		return
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString(title + "\n")
+	for _, l := range lines {
+		content := strings.ReplaceAll(l.content, "\n", " ")
+		if l.entity != "" {
+			fmt.Fprintf(b, "- %s: %s\n", l.entity, content)
+		} else {
+			fmt.Fprintf(b, "- %s\n", content)
+		}
+	}
+}
+
+// conversationContext assembles the start-of-conversation block for
+// conversationID: pinned entities, the conversation's unexpired session
+// notes (stored under it as session_id by the calling client) and
+// observations (stored under it as conversation_id), and the other memories
+// that best match the words of those notes and observations. Session notes
+// are closed to restricted scopes, so they are left out for them.
+func conversationContext(ctx context.Context, db *sql.DB, levels []string, conversationID string) (string, error) {
+	var b strings.Builder
+	pinned, err := loadGraph(ctx, db, levels, graphQuery{filter: "e.pinned_at IS NOT NULL AND e.archived_at IS NULL", details: true})
+	if err != nil {
+		return "", fmt.Errorf("pinned entities: %v", err)
+	}
+	if len(pinned.Entities) > 0 {
+		b.WriteString("Pinned\n" + formatPinned(pinned))
+	}
+
+	var notes []contextLine
+	if !restricted(levels) {
+		notes, err = contextLines(ctx, db, `SELECT n.id, COALESCE(e.name, ''), n.content FROM session_notes n
+			LEFT JOIN entities e ON e.id = n.entity_id
+			WHERE n.session_id = ? AND n.client IS ? AND n.expires_at > CURRENT_TIMESTAMP
+			ORDER BY n.id DESC LIMIT ?`, conversationID, noteClient(ctx), contextSectionLimit)
+		if err != nil {
+			return "", fmt.Errorf("session notes: %v", err)
+		}
+	}
+	writeContextSection(&b, "Session notes", notes)
+
+	said, err := contextLines(ctx, db, restrictVisibility(`SELECT o.id, e.name, o.content FROM observations o
+		JOIN entities e ON e.id = o.entity_id
+		WHERE o.conversation_id = ?
+		ORDER BY o.id DESC LIMIT ?`, levels), conversationID, contextSectionLimit)
+	if err != nil {
+		return "", fmt.Errorf("conversation observations: %v", err)
+	}
+	writeContextSection(&b, "This conversation", said)
+
+	var text []string
+	shown := make(map[int64]bool)
+	for _, l := range notes {
+		text = append(text, l.entity, l.content)
+	}
+	for _, l := range said {
+		text = append(text, l.entity, l.content)
+		shown[l.id] = true
+	}
+	for _, e := range pinned.Entities {
+		for _, d := range e.Details {
+			shown[d.ID] = true
+		}
+	}
+	ids, err := keywordMatches(ctx, db, levels, questionTerms(strings.Join(text, " ")), contextSectionLimit+len(shown))
+	if err != nil {
+		return "", fmt.Errorf("related memories: %v", err)
+	}
+	var related []int64
+	for _, id := range ids {
+		if !shown[id] && len(related) < contextSectionLimit {
+			related = append(related, id)
+		}
+	}
+	if len(related) > 0 {
+		args := make([]any, len(related))
+		for i, id := range related {
+			args[i] = id
+		}
+		lines, err := contextLines(ctx, db, restrictVisibility(`SELECT o.id, e.name, o.content FROM observations o
+			JOIN entities e ON e.id = o.entity_id
+			WHERE o.id IN (`+placeholders(len(related))+`) AND `+notSuperseded, levels), args...)
+		if err != nil {
+			return "", fmt.Errorf("related memories: %v", err)
+		}
+		byID := make(map[int64]contextLine, len(lines))
+		for _, l := range lines {
+			byID[l.id] = l
+		}
+		ranked := make([]contextLine, 0, len(lines))
+		for _, id := range related {
+			if l, ok := byID[id]; ok {
+				ranked = append(ranked, l)
+			}
+		}
+		writeContextSection(&b, "Related memories", ranked)
+	}
+
+	if b.Len() == 0 {
+		return fmt.Sprintf("nothing stored for conversation %s yet, and no pinned entities", conversationID), nil
+	}
+	return b.String(), nil
+}
+
+func contextLines(ctx context.Context, db *sql.DB, sqlStr string, args ...any) ([]contextLine, error) {
+	rows, err := db.QueryContext(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var lines []contextLine
+	for rows.Next() {
+		var l contextLine
+		if err := rows.Scan(&l.id, &l.entity, &l.content); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+// registerConversationContext adds the conversation context template.
+func registerConversationContext(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddResourceTemplate(mcp.NewResourceTemplate(
+		contextURIPrefix+"{conversation_id}",
+		"Conversation context",
+		mcp.WithTemplateDescription("One compact block to start a conversation with: pinned entities, the conversation's session notes saved by this client (remember_for_session with this id as session_id), its observations (add_observation with this id as conversation_id) and the other memories most related to them"),
+		mcp.WithTemplateMIMEType("text/plain"),
+	), conversationContextHandler(db, scopes))
+}
+
+func conversationContextHandler(db *sql.DB, scopes *visibilityScopes) server.ResourceTemplateHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		id := templateArgument(request, "conversation_id")
+		if id == "" {
+			return nil, fmt.Errorf("conversation id missing from %s", request.Params.URI)
+		}
+		text, err := conversationContext(ctx, db, scopes.levels(ctx), id)
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "text/plain",
+				Text:     text,
+			},
+		}, nil
+	}
+}
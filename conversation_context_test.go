@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestWriteContextSection(t *testing.T) {
+	var b strings.Builder
+	writeContextSection(&b, "Empty", nil)
+	if b.Len() != 0 {
+		t.Fatalf("empty section wrote %q", b.String())
+	}
+	writeContextSection(&b, "Session notes", []contextLine{{content: "draft the\nrelease notes"}})
+	writeContextSection(&b, "This conversation", []contextLine{{entity: "Vince", content: "prefers Go"}})
+	want := "Session notes\n- draft the release notes\n\nThis conversation\n- Vince: prefers Go\n"
+	if b.String() != want {
+		t.Errorf("sections = %q, want %q", b.String(), want)
+	}
+}
+
+func TestConversationContext_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cleanup := func() {
+		db.Exec("DELETE FROM entities WHERE name = 'context-test-kestrel'")
+		db.Exec("DELETE FROM session_notes WHERE session_id LIKE 'context-test-%'")
+	}
+	cleanup()
+	defer cleanup()
+
+	result, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('context-test-kestrel', 'project')")
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	entityID, _ := result.LastInsertId()
+	for _, stmt := range []string{
+		"INSERT INTO observations (entity_id, content, conversation_id) VALUES (?, 'context test kestrel ships on fridays', 'context-test-1')",
+		"INSERT INTO observations (entity_id, content) VALUES (?, 'context test kestrel deploys through argo')",
+		"INSERT INTO session_notes (session_id, entity_id, content, expires_at) VALUES ('context-test-1', ?, 'context test reviewing kestrel rollout', datetime('now', '+1 hours'))",
+		"INSERT INTO session_notes (session_id, entity_id, content, expires_at) VALUES ('context-test-1', ?, 'context test expired note', datetime('now', '-1 hours'))",
+	} {
+		if _, err := db.Exec(stmt, entityID); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	req := mcp.ReadResourceRequest{}
+	req.Params.URI = contextURIPrefix + "context-test-1"
+	req.Params.Arguments = map[string]any{"conversation_id": []string{"context-test-1"}}
+	contents, err := conversationContextHandler(db, nil)(context.Background(), req)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	text := contents[0].(mcp.TextResourceContents).Text
+	for _, want := range []string{
+		"Session notes\n- context-test-kestrel: context test reviewing kestrel rollout\n",
+		"This conversation\n- context-test-kestrel: context test kestrel ships on fridays\n",
+		"Related memories\n",
+		"- context-test-kestrel: context test kestrel deploys through argo\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("context missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "expired note") || strings.Count(text, "ships on fridays") != 1 {
+		t.Errorf("context repeats or includes expired memories:\n%s", text)
+	}
+
+	public, err := parseVisibilityScopes("public", "")
+	if err != nil {
+		t.Fatalf("parseVisibilityScopes: %v", err)
+	}
+	for name, read := range map[string]func() ([]mcp.ResourceContents, error){
+		"another client": func() ([]mcp.ResourceContents, error) {
+			return conversationContextHandler(db, nil)(withClientName(context.Background(), "team-bot"), req)
+		},
+		"restricted scope": func() ([]mcp.ResourceContents, error) {
+			return conversationContextHandler(db, public)(context.Background(), req)
+		},
+	} {
+		contents, err := read()
+		if err != nil {
+			t.Fatalf("%s: read: %v", name, err)
+		}
+		if text := contents[0].(mcp.TextResourceContents).Text; strings.Contains(text, "Session notes") {
+			t.Errorf("%s sees the session notes:\n%s", name, text)
+		}
+	}
+
+	req.Params.Arguments = map[string]any{}
+	if _, err := conversationContextHandler(db, nil)(context.Background(), req); err == nil {
+		t.Error("expected an error without a conversation id")
+	}
+}
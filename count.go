@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// countGroups are the group_by values the count tool accepts for each kind
+// of row, with the expression each groups on.
+var countGroups = map[string]map[string]string{
+	"entities":     {"entity_type": "e.entity_type"},
+	"observations": {"entity_type": "e.entity_type", "entity": "e.name", "tag": "t.name"},
+	"relations":    {"entity_type": "e.entity_type", "entity": "e.name", "relation_type": "r.relation_type"},
+}
+
+// countFilter holds the count tool's filters; empty fields do not filter.
+type countFilter struct {
+	tagIDs          []int64
+	entityTypes     []string
+	entity          string
+	relationType    string
+	since, until    string
+	includeArchived bool
+}
+
+// buildCount returns the statement counting what, optionally grouped. e is
+// the entity counted, observed, or a relation starts at.
+func buildCount(what, groupBy string, f countFilter) (string, []any, error) {
+	groups, ok := countGroups[what]
+	if !ok {
+		return "", nil, fmt.Errorf("what must be one of: entities, observations, relations")
+	}
+	groupExpr := ""
+	if groupBy != "" {
+		if groupExpr, ok = groups[groupBy]; !ok {
+			valid := make([]string, 0, len(groups))
+			for g := range groups {
+				valid = append(valid, g)
+			}
+			sort.Strings(valid)
+			return "", nil, fmt.Errorf("%s cannot be grouped by %s, use one of: %s", what, groupBy, strings.Join(valid, ", "))
+		}
+	}
+
+	from, counted, where, args, err := countSource(what, f)
+	if err != nil {
+		return "", nil, err
+	}
+	if groupBy == "tag" {
+		from += " JOIN observation_tags ot ON ot.observation_id = o.id JOIN tags t ON t.id = ot.tag_id"
+	}
+	if groupExpr == "" {
+		return fmt.Sprintf("SELECT count(DISTINCT %s) FROM %s%s", counted, from, where), args, nil
+	}
+	return fmt.Sprintf("SELECT %s, count(DISTINCT %s) AS n FROM %s%s GROUP BY 1 ORDER BY n DESC, 1",
+		groupExpr, counted, from, where), args, nil
+}
+
+// countSource returns the rows of what f selects: the FROM clause, the id
+// column counted and the WHERE clause, if any, with its arguments.
+func countSource(what string, f countFilter) (from, counted, where string, args []any, err error) {
+	var created string
+	switch what {
+	case "entities":
+		from, counted, created = "entities e", "e.id", "e.created_at"
+	case "observations":
+		from, counted, created = "observations o JOIN entities e ON e.id = o.entity_id", "o.id", "o.created_at"
+	case "relations":
+		from, counted, created = "relations r JOIN entities e ON e.id = r.from_id", "r.id", "r.created_at"
+	}
+
+	var conds []string
+	if len(f.tagIDs) > 0 {
+		in := placeholders(len(f.tagIDs))
+		switch what {
+		case "entities":
+			conds = append(conds, "EXISTS (SELECT 1 FROM observations x JOIN observation_tags xt ON xt.observation_id = x.id WHERE x.entity_id = e.id AND xt.tag_id IN ("+in+"))")
+		case "observations":
+			conds = append(conds, "EXISTS (SELECT 1 FROM observation_tags xt WHERE xt.observation_id = o.id AND xt.tag_id IN ("+in+"))")
+		default:
+			return "", "", "", nil, fmt.Errorf("tags filter observations and entities, not relations")
+		}
+		for _, id := range f.tagIDs {
+			args = append(args, id)
+		}
+	}
+	if len(f.entityTypes) > 0 {
+		conds = append(conds, "e.entity_type IN ("+placeholders(len(f.entityTypes))+")")
+		for _, t := range f.entityTypes {
+			args = append(args, t)
+		}
+	}
+	if f.entity != "" {
+		if what == "relations" {
+			conds = append(conds, "(e.name = ? OR r.to_id IN (SELECT id FROM entities WHERE name = ?))")
+			args = append(args, f.entity, f.entity)
+		} else {
+			conds = append(conds, "e.name = ?")
+			args = append(args, f.entity)
+		}
+	}
+	if f.relationType != "" {
+		if what != "relations" {
+			return "", "", "", nil, fmt.Errorf("relation_type only filters relations")
+		}
+		conds = append(conds, "r.relation_type = ?")
+		args = append(args, f.relationType)
+	}
+	if f.since != "" {
+		conds = append(conds, created+" >= ?")
+		args = append(args, f.since)
+	}
+	if f.until != "" {
+		conds = append(conds, created+" < ?")
+		args = append(args, f.until)
+	}
+	if !f.includeArchived {
+		conds = append(conds, "e.archived_at IS NULL")
+	}
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	return from, counted, where, args, nil
+}
+
+// parseCountTime reads a since or until bound, a date or a span back from now.
+func parseCountTime(name, s string, now time.Time) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+	t, err := parseDigestSince(strings.TrimSpace(s), now)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q, use a date like '2026-05-01' or a span like '30d'", name, s)
+	}
+	return t.UTC().Format(reminderTimeForm), nil
+}
+
+// registerCount adds the count tool.
+func registerCount(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("count",
+		mcp.WithDescription(`Count entities, observations or relations, optionally filtered and grouped, returning only numbers.
+
+Use this instead of fetching rows to answer "how many notes do I have about X". Archived entities and what hangs off them are left out unless include_archived is set.`),
+		mcp.WithString("what",
+			mcp.Required(),
+			mcp.Description("What to count"),
+			mcp.Enum("entities", "observations", "relations"),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Only observations with any of these comma-separated tags, or entities that have one"),
+		),
+		mcp.WithString("entity_type",
+			mcp.Description("Only entities of these comma-separated types, observations on them or relations from them"),
+		),
+		mcp.WithString("entity",
+			mcp.Description("Only observations on this entity, or relations from or to it"),
+		),
+		mcp.WithString("relation_type",
+			mcp.Description("Only relations of this type"),
+		),
+		mcp.WithString("since",
+			mcp.Description("Only rows created since a date ('2026-05-01') or a span back from now ('30d')"),
+		),
+		mcp.WithString("until",
+			mcp.Description("Only rows created before a date or a span back from now"),
+		),
+		mcp.WithString("group_by",
+			mcp.Description("Count per entity_type, entity (observations, relations), tag (observations) or relation_type (relations)"),
+			mcp.Enum("entity_type", "entity", "tag", "relation_type"),
+		),
+		mcp.WithBoolean("include_archived",
+			mcp.Description("Also count archived entities and their observations and relations (default false)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), countHandler(db, scopes))
+}
+
+func countHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		what := strings.TrimSpace(request.GetString("what", ""))
+		groupBy := strings.TrimSpace(request.GetString("group_by", ""))
+
+		f := countFilter{
+			entityTypes:     parseTagNames(request.GetString("entity_type", "")),
+			entity:          strings.TrimSpace(request.GetString("entity", "")),
+			relationType:    strings.TrimSpace(request.GetString("relation_type", "")),
+			includeArchived: request.GetBool("include_archived", false),
+		}
+		now := time.Now()
+		var err error
+		if f.since, err = parseCountTime("since", request.GetString("since", ""), now); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if f.until, err = parseCountTime("until", request.GetString("until", ""), now); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if tags := parseTagNames(request.GetString("tags", "")); len(tags) > 0 {
+			if f.tagIDs, err = validateTags(ctx, db, tags); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+		}
+
+		sqlStr, args, err := buildCount(what, groupBy, f)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		sqlStr = restrictVisibility(sqlStr, scopes.levels(ctx))
+
+		if groupBy == "" {
+			var n int64
+			if err := db.QueryRowContext(ctx, sqlStr, args...).Scan(&n); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "count failed: %v", err), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("%s: %d", what, n)), nil
+		}
+
+		rows, err := db.QueryContext(ctx, sqlStr, args...)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "count failed: %v", err), nil
+		}
+		defer rows.Close()
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%s by %s:\n", what, groupBy)
+		var total int64
+		for rows.Next() {
+			var group any
+			var n int64
+			if err := rows.Scan(&group, &n); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "count failed: %v", err), nil
+			}
+			fmt.Fprintf(&sb, "%s: %d\n", formatValue(group), n)
+			total += n
+		}
+		if err := rows.Err(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "count failed: %v", err), nil
+		}
+		if total == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("%s: 0", what)), nil
+		}
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestBuildCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		what     string
+		groupBy  string
+		filter   countFilter
+		want     []string
+		wantArgs int
+		wantErr  bool
+	}{
+		{"entities", "entities", "", countFilter{}, []string{"SELECT count(DISTINCT e.id) FROM entities e WHERE e.archived_at IS NULL"}, 0, false},
+		{"observations by tag", "observations", "tag", countFilter{tagIDs: []int64{1, 2}, since: "2026-01-01 00:00:00"},
+			[]string{"SELECT t.name, count(DISTINCT o.id) AS n", "JOIN tags t", "xt.tag_id IN (?, ?)", "o.created_at >= ?", "GROUP BY 1"}, 3, false},
+		{"relations of an entity", "relations", "relation_type", countFilter{entity: "nas", includeArchived: true},
+			[]string{"(e.name = ? OR r.to_id IN", "GROUP BY 1"}, 2, false},
+		{"unknown kind", "tags", "", countFilter{}, nil, 0, true},
+		{"bad group", "entities", "tag", countFilter{}, nil, 0, true},
+		{"tags on relations", "relations", "", countFilter{tagIDs: []int64{1}}, nil, 0, true},
+		{"relation_type on observations", "observations", "", countFilter{relationType: "owns"}, nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args, err := buildCount(tt.what, tt.groupBy, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildCount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("expected %q in %s", w, got)
+				}
+			}
+			if len(args) != tt.wantArgs {
+				t.Errorf("buildCount() args = %v, want %d", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestCount_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'count-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'count test %'")
+
+	for _, stmt := range []string{
+		"INSERT INTO entities (name, entity_type) VALUES ('count-test-nas', 'count_test_device'), ('count-test-pi', 'count_test_device'), ('count-test-me', 'count_test_person')",
+		`INSERT INTO relations (from_id, to_id, relation_type) SELECT m.id, d.id, 'count_test_owns' FROM entities m, entities d
+			WHERE m.name = 'count-test-me' AND d.entity_type = 'count_test_device'`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	for _, args := range []map[string]any{
+		{"entity": "count-test-nas", "content": "count test runs truenas", "visibility": "public"},
+		{"entity": "count-test-nas", "content": "count test has 4 disks"},
+		{"entity": "count-test-pi", "content": "count test runs pihole", "visibility": "public"},
+	} {
+		args["tags"] = "homelab"
+		if result, err := callTool(addObservationHandler(db, nil), "add_observation", args); err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+	}
+
+	public, err := parseVisibilityScopes("public", "")
+	if err != nil {
+		t.Fatalf("parseVisibilityScopes: %v", err)
+	}
+	tests := []struct {
+		name    string
+		scopes  *visibilityScopes
+		args    map[string]any
+		want    string
+		wantErr bool
+	}{
+		{"entities of a type", nil, map[string]any{"what": "entities", "entity_type": "count_test_device"}, "entities: 2", false},
+		{"observations on an entity", nil, map[string]any{"what": "observations", "entity": "count-test-nas", "tags": "homelab"}, "observations: 2", false},
+		{"visibility", public, map[string]any{"what": "observations", "entity": "count-test-nas"}, "observations: 1", false},
+		{"grouped", nil, map[string]any{"what": "observations", "entity_type": "count_test_device", "group_by": "entity"},
+			"observations by entity:\ncount-test-nas: 2\ncount-test-pi: 1\n", false},
+		{"relations to an entity", nil, map[string]any{"what": "relations", "entity": "count-test-pi", "relation_type": "count_test_owns"}, "relations: 1", false},
+		{"since", nil, map[string]any{"what": "observations", "entity": "count-test-nas", "since": "1d"}, "observations: 2", false},
+		{"until", nil, map[string]any{"what": "observations", "entity": "count-test-nas", "until": "1d"}, "observations: 0", false},
+		{"empty group", nil, map[string]any{"what": "observations", "entity": "count-test-me", "group_by": "tag"}, "observations: 0", false},
+		{"unknown tag", nil, map[string]any{"what": "observations", "tags": "count-test-nope"}, "", true},
+		{"bad since", nil, map[string]any{"what": "observations", "since": "lately"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := callTool(countHandler(db, tt.scopes), "count", tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v, want %v: %v", result.IsError, tt.wantErr, result.Content)
+			}
+			if text := result.Content[0].(mcp.TextContent).Text; !tt.wantErr && text != tt.want {
+				t.Errorf("count = %q, want %q", text, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// duplicateRelation is one row of a set of relations with the same from, to
+// and type.
+type duplicateRelation struct {
+	id                 int64
+	from, to, relation string
+	fromID, toID       int64
+	confidence, weight sql.NullFloat64
+	properties         sql.NullString
+}
+
+// duplicateRelations returns the relations that share from, to and type with
+// another, grouped, oldest first within each group.
+func duplicateRelations(ctx context.Context, q queryer) ([][]duplicateRelation, error) {
+	rows, err := q.QueryContext(ctx, `SELECT r.id, r.from_id, r.to_id, f.name, t.name, r.relation_type, r.confidence, r.weight, r.properties
+		FROM relations r
+		JOIN entities f ON f.id = r.from_id
+		JOIN entities t ON t.id = r.to_id
+		WHERE EXISTS (SELECT 1 FROM relations d WHERE d.from_id = r.from_id AND d.to_id = r.to_id AND d.relation_type = r.relation_type AND d.id <> r.id)
+		ORDER BY r.from_id, r.to_id, r.relation_type, r.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var groups [][]duplicateRelation
+	for rows.Next() {
+		var r duplicateRelation
+		if err := rows.Scan(&r.id, &r.fromID, &r.toID, &r.from, &r.to, &r.relation, &r.confidence, &r.weight, &r.properties); err != nil {
+			return nil, err
+		}
+		if n := len(groups); n > 0 {
+			last := groups[n-1][0]
+			if last.fromID == r.fromID && last.toID == r.toID && last.relation == r.relation {
+				groups[n-1] = append(groups[n-1], r)
+				continue
+			}
+		}
+		groups = append(groups, []duplicateRelation{r})
+	}
+	return groups, rows.Err()
+}
+
+// mergeRelations folds a group of duplicates into its oldest row: the
+// highest confidence and weight win, and properties are combined with later
+// rows overriding earlier ones.
+func mergeRelations(group []duplicateRelation) (duplicateRelation, error) {
+	kept := group[0]
+	props := make(map[string]any)
+	for _, r := range group {
+		if r.confidence.Valid && (!kept.confidence.Valid || r.confidence.Float64 > kept.confidence.Float64) {
+			kept.confidence = r.confidence
+		}
+		if r.weight.Valid && (!kept.weight.Valid || r.weight.Float64 > kept.weight.Float64) {
+			kept.weight = r.weight
+		}
+		if r.properties.Valid {
+			var p map[string]any
+			if err := json.Unmarshal([]byte(r.properties.String), &p); err != nil {
+				return kept, errorf(codeConflict, "relation %d has invalid properties: %v", r.id, err)
+			}
+			for k, v := range p {
+				props[k] = v
+			}
+		}
+	}
+	if len(props) > 0 {
+		data, err := json.Marshal(props)
+		if err != nil {
+			return kept, err
+		}
+		kept.properties = sql.NullString{String: string(data), Valid: true}
+	}
+	return kept, nil
+}
+
+// registerDedupeRelations adds the dedupe_relations tool.
+func registerDedupeRelations(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("dedupe_relations",
+		mcp.WithDescription(`Merge duplicate relations, rows with the same from, to and relation type, such as a relation re-asserted in every conversation.
+
+Each set is merged into its oldest row, keeping the highest confidence and weight and combining properties, and the other rows are removed in one transaction. The report lists what was kept and removed.`),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Only report the duplicates, without merging them (default false)"),
+		),
+	), dedupeRelationsHandler(db))
+}
+
+func dedupeRelationsHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		dryRun := request.GetBool("dry_run", false)
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		groups, err := duplicateRelations(ctx, tx)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "query error: %v", err), nil
+		}
+		if len(groups) == 0 {
+			return mcp.NewToolResultText("no duplicate relations"), nil
+		}
+
+		var sb strings.Builder
+		removed := 0
+		for _, group := range groups {
+			kept, err := mergeRelations(group)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeConflict), "%v; nothing was changed", err), nil
+			}
+			ids := make([]string, 0, len(group)-1)
+			for _, r := range group[1:] {
+				ids = append(ids, fmt.Sprint(r.id))
+			}
+			fmt.Fprintf(&sb, "%s -%s-> %s: kept %d, removed %s\n", kept.from, kept.relation, kept.to, kept.id, strings.Join(ids, ", "))
+			removed += len(ids)
+			if dryRun {
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, "UPDATE relations SET confidence = ?, weight = ?, properties = ? WHERE id = ?",
+				kept.confidence, kept.weight, kept.properties, kept.id); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "merge into relation %d failed: %v; nothing was changed", kept.id, err), nil
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM relations WHERE id IN ("+strings.Join(ids, ", ")+")"); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "removing duplicates of relation %d failed: %v; nothing was changed", kept.id, err), nil
+			}
+		}
+
+		if dryRun {
+			fmt.Fprintf(&sb, "\n%d duplicate relation(s) in %d group(s). Call again without dry_run to merge them.", removed, len(groups))
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+		fmt.Fprintf(&sb, "\nremoved %d duplicate relation(s) in %d group(s)", removed, len(groups))
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestMergeRelations(t *testing.T) {
+	f := func(v float64) sql.NullFloat64 { return sql.NullFloat64{Float64: v, Valid: true} }
+	s := func(v string) sql.NullString { return sql.NullString{String: v, Valid: true} }
+	group := []duplicateRelation{
+		{id: 3, confidence: f(0.5), properties: s(`{"since": "2020", "team": "infra"}`)},
+		{id: 7, weight: f(0.4)},
+		{id: 9, confidence: f(0.9), weight: f(0.2), properties: s(`{"since": "2021"}`)},
+	}
+	kept, err := mergeRelations(group)
+	if err != nil {
+		t.Fatalf("mergeRelations: %v", err)
+	}
+	if kept.id != 3 || kept.confidence != f(0.9) || kept.weight != f(0.4) || kept.properties != s(`{"since":"2021","team":"infra"}`) {
+		t.Errorf("mergeRelations() = %+v", kept)
+	}
+
+	if _, err := mergeRelations([]duplicateRelation{{id: 1, properties: s("[1]")}}); err == nil {
+		t.Errorf("expected an error for properties that are not an object")
+	}
+}
+
+func TestDedupeRelations_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'dedupe-test-%'")
+	defer db.Exec("DELETE FROM relations WHERE relation_type LIKE 'dedupe_test_%'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('dedupe-test-ann', 'Person'), ('dedupe-test-acme', 'Company')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO relations (from_id, to_id, relation_type, confidence) SELECT a.id, c.id, 'dedupe_test_works_at', 0.6 FROM entities a, entities c WHERE a.name = 'dedupe-test-ann' AND c.name = 'dedupe-test-acme'`,
+		`INSERT INTO relations (from_id, to_id, relation_type, weight) SELECT a.id, c.id, 'dedupe_test_works_at', 0.8 FROM entities a, entities c WHERE a.name = 'dedupe-test-ann' AND c.name = 'dedupe-test-acme'`,
+		`INSERT INTO relations (from_id, to_id, relation_type) SELECT a.id, c.id, 'dedupe_test_works_at' FROM entities a, entities c WHERE a.name = 'dedupe-test-ann' AND c.name = 'dedupe-test-acme'`,
+		`INSERT INTO relations (from_id, to_id, relation_type) SELECT c.id, a.id, 'dedupe_test_works_at' FROM entities a, entities c WHERE a.name = 'dedupe-test-ann' AND c.name = 'dedupe-test-acme'`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	count := func() int {
+		var n int
+		db.QueryRow("SELECT count(*) FROM relations WHERE relation_type = 'dedupe_test_works_at'").Scan(&n)
+		return n
+	}
+
+	dedupe := func(args map[string]any) string {
+		t.Helper()
+		result, err := callTool(dedupeRelationsHandler(db), "dedupe_relations", args)
+		if err != nil || result.IsError {
+			t.Fatalf("dedupe_relations: %v %v", err, result.Content)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+
+	got := dedupe(map[string]any{"dry_run": true})
+	if !strings.Contains(got, "dedupe-test-ann -dedupe_test_works_at-> dedupe-test-acme: kept ") || count() != 4 {
+		t.Fatalf("dry run changed rows or missed the duplicates (%d rows):\n%s", count(), got)
+	}
+
+	got = dedupe(nil)
+	if !strings.Contains(got, "dedupe-test-ann -dedupe_test_works_at-> dedupe-test-acme") || !strings.Contains(got, "removed ") {
+		t.Errorf("unexpected report:\n%s", got)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("%d relations left, want the merged one and the reverse one", n)
+	}
+	var confidence, weight float64
+	err := db.QueryRow(`SELECT r.confidence, r.weight FROM relations r JOIN entities f ON f.id = r.from_id
+		WHERE r.relation_type = 'dedupe_test_works_at' AND f.name = 'dedupe-test-ann'`).Scan(&confidence, &weight)
+	if err != nil || confidence != 0.6 || weight != 0.8 {
+		t.Errorf("merged relation has confidence %v weight %v (%v), want 0.6 and 0.8", confidence, weight, err)
+	}
+
+	if got := dedupe(nil); strings.Contains(got, "dedupe-test-") {
+		t.Errorf("duplicates left after merging:\n%s", got)
+	}
+}
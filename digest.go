@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// digestDir is where digest files are written, by the digest tool's file
+// argument and by the scheduled job every digestDays days. The scheduled job
+// reads with the default visibility scope unless digestVisibility names the
+// levels it may include.
+var (
+	digestDir        = getEnv("ENGRAM_DIGEST_DIR", "")
+	digestDays       = getEnvInt("ENGRAM_DIGEST_DAYS", 0)
+	digestVisibility = getEnv("ENGRAM_DIGEST_VISIBILITY", "")
+)
+
+type digestObservation struct {
+	id            int64
+	entity, typ   string
+	content, tags string
+}
+
+type digestRelation struct {
+	from, relation, to string
+}
+
+// buildDigest renders the observations and relations created in [since,
+// until) as a markdown report, grouped by entity or by tag.
+func buildDigest(ctx context.Context, db *sql.DB, levels []string, since, until time.Time, groupBy string) (string, int, error) {
+	// Stored timestamps have whole seconds, so round the bounds up to keep a
+	// write made in the same second as until inside the period.
+	ceil := func(t time.Time) string {
+		return t.Add(time.Second - 1).Truncate(time.Second).UTC().Format(reminderTimeForm)
+	}
+	from, to := ceil(since), ceil(until)
+
+	rows, err := db.QueryContext(ctx, restrictVisibility(`SELECT o.id, e.name, e.entity_type, o.content,
+			COALESCE((SELECT group_concat(name, ', ') FROM (SELECT t.name FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id
+				WHERE ot.observation_id = o.id ORDER BY t.name)), '')
+		FROM observations o JOIN entities e ON e.id = o.entity_id
+		WHERE o.created_at >= ? AND o.created_at < ?
+		ORDER BY e.name, o.id`, levels), from, to)
+	if err != nil {
+		return "", 0, fmt.Errorf("query error: %v", err)
+	}
+	var observations []digestObservation
+	for rows.Next() {
+		var o digestObservation
+		if err := rows.Scan(&o.id, &o.entity, &o.typ, &o.content, &o.tags); err != nil {
+			rows.Close()
+			return "", 0, fmt.Errorf("scan error: %v", err)
+		}
+		observations = append(observations, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", 0, fmt.Errorf("query error: %v", err)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT f.name, r.relation_type, t.name
+		FROM relations r JOIN entities f ON f.id = r.from_id JOIN entities t ON t.id = r.to_id
+		WHERE r.created_at >= ? AND r.created_at < ?
+		ORDER BY f.name, r.id`, from, to)
+	if err != nil {
+		return "", 0, fmt.Errorf("query error: %v", err)
+	}
+	var relations []digestRelation
+	for rows.Next() {
+		var r digestRelation
+		if err := rows.Scan(&r.from, &r.relation, &r.to); err != nil {
+			rows.Close()
+			return "", 0, fmt.Errorf("scan error: %v", err)
+		}
+		relations = append(relations, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", 0, fmt.Errorf("query error: %v", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Memory digest %s to %s\n\n", since.Format("2006-01-02"), until.Format("2006-01-02"))
+	entities := map[string]bool{}
+	for _, o := range observations {
+		entities[o.entity] = true
+	}
+	fmt.Fprintf(&b, "%d new observations on %d entities, %d new relations.\n", len(observations), len(entities), len(relations))
+
+	var groups []string
+	grouped := map[string][]digestObservation{}
+	for _, o := range observations {
+		keys := []string{fmt.Sprintf("%s (%s)", o.entity, o.typ)}
+		if groupBy == "tag" {
+			keys = strings.Split(o.tags, ", ")
+			if o.tags == "" {
+				keys = []string{"untagged"}
+			}
+		}
+		for _, k := range keys {
+			if _, ok := grouped[k]; !ok {
+				groups = append(groups, k)
+			}
+			grouped[k] = append(grouped[k], o)
+		}
+	}
+	if groupBy == "tag" {
+		sort.Strings(groups)
+	}
+	for _, g := range groups {
+		fmt.Fprintf(&b, "\n## %s\n\n", g)
+		for _, o := range grouped[g] {
+			line := o.content
+			if groupBy == "tag" {
+				line = fmt.Sprintf("**%s**: %s", o.entity, o.content)
+			} else if o.tags != "" {
+				line += fmt.Sprintf(" _(%s)_", o.tags)
+			}
+			fmt.Fprintf(&b, "- %s\n", strings.ReplaceAll(line, "\n", " "))
+		}
+	}
+
+	if len(relations) > 0 {
+		b.WriteString("\n## New relations\n\n")
+		for _, r := range relations {
+			fmt.Fprintf(&b, "- %s %s %s\n", r.from, r.relation, r.to)
+		}
+	}
+	return b.String(), len(observations), nil
+}
+
+// writeDigest saves a report as name under digestDir and returns its path.
+func writeDigest(name, report string) (string, error) {
+	if digestDir == "" {
+		return "", fmt.Errorf("ENGRAM_DIGEST_DIR is not set, digests can only be returned inline")
+	}
+	if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid file name %q, want a plain name like 'digest.md'", name)
+	}
+	if err := os.MkdirAll(digestDir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(digestDir, name)
+	return path, os.WriteFile(path, []byte(report), 0o600)
+}
+
+// digestLevels returns the levels the scheduled digest reads: those set in
+// digestVisibility, or the default scope.
+func digestLevels(scopes *visibilityScopes) ([]string, error) {
+	if digestVisibility == "" {
+		return scopes.defaultLevels(), nil
+	}
+	return parseVisibilityLevels(digestVisibility)
+}
+
+func digestPeriodically(ctx context.Context, db *sql.DB, levels []string, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report, _, err := buildDigest(ctx, db, levels, now.Add(-period), now, "entity")
+			if err != nil {
+				log.Printf("digest failed: %v", err)
+				continue
+			}
+			path, err := writeDigest(fmt.Sprintf("digest-%s.md", now.Format("2006-01-02")), report)
+			if err != nil {
+				log.Printf("digest failed: %v", err)
+				continue
+			}
+			log.Printf("digest written to %s", path)
+		}
+	}
+}
+
+// registerDigest adds the digest tool.
+func registerDigest(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("digest",
+		mcp.WithDescription(`Compile the observations and relations added over a period into a markdown report, grouped by entity or tag, to review what was learned.
+
+Returned inline, or written to a file under ENGRAM_DIGEST_DIR when file is given.`),
+		mcp.WithString("since",
+			mcp.Description("Start of the period: a date ('2026-05-01') or a span back from now ('1d', '2w'). Default 7d"),
+		),
+		mcp.WithString("group_by",
+			mcp.Description("'entity' (default) or 'tag'"),
+			mcp.Enum("entity", "tag"),
+		),
+		mcp.WithString("file",
+			mcp.Description("Write the report to this file name under ENGRAM_DIGEST_DIR instead of returning it, e.g. 'week-18.md'"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), digestHandler(db, scopes))
+}
+
+func digestHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		until := time.Now()
+		since := until.Add(-7 * 24 * time.Hour)
+		if s := strings.TrimSpace(request.GetString("since", "")); s != "" {
+			t, err := parseDigestSince(s, until)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			since = t
+		}
+
+		groupBy := request.GetString("group_by", "entity")
+		if groupBy != "entity" && groupBy != "tag" {
+			return toolError(codeInvalidArgument, "group_by must be 'entity' or 'tag'"), nil
+		}
+
+		report, n, err := buildDigest(ctx, db, scopes.levels(ctx), since, until, groupBy)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		if file := strings.TrimSpace(request.GetString("file", "")); file != "" {
+			path, err := writeDigest(file, report)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to write digest: %v", err), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("success: digest of %d observations written to %s", n, path)), nil
+		}
+		return mcp.NewToolResultText(report), nil
+	}
+}
+
+// parseDigestSince reads the start of a digest period, either a date or a
+// span back from now such as "7d".
+func parseDigestSince(s string, now time.Time) (time.Time, error) {
+	for _, layout := range dueLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if d, err := parseSpan(s); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q, use a date like '2026-05-01' or a span like '7d'", s)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseDigestSince(t *testing.T) {
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"7d", now.Add(-7 * 24 * time.Hour), false},
+		{"12h", now.Add(-12 * time.Hour), false},
+		{"2026-03-01", time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), false},
+		{"0d", time.Time{}, true},
+		{"last week", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseDigestSince(tt.input, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDigestSince() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseDigestSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigest_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'digest-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'digest test %'")
+	defer db.Exec("DELETE FROM relations WHERE relation_type = 'digest_test_backs_up'")
+
+	for _, stmt := range []string{
+		"INSERT INTO entities (name, entity_type) VALUES ('digest-test-nas', 'device'), ('digest-test-laptop', 'device')",
+		`INSERT INTO relations (from_id, to_id, relation_type) SELECT l.id, n.id, 'digest_test_backs_up' FROM entities l, entities n
+			WHERE l.name = 'digest-test-laptop' AND n.name = 'digest-test-nas'`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	for _, args := range []map[string]any{
+		{"entity": "digest-test-nas", "content": "digest test runs truenas", "visibility": "public"},
+		{"entity": "digest-test-laptop", "content": "digest test has a broken hinge"},
+	} {
+		args["tags"] = "homelab"
+		if result, err := callTool(addObservationHandler(db, nil), "add_observation", args); err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+	}
+
+	digest := func(args map[string]any, scopes *visibilityScopes) *mcp.CallToolResult {
+		t.Helper()
+		result, err := callTool(digestHandler(db, scopes), "digest", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+
+	t.Run("by entity", func(t *testing.T) {
+		text := digest(map[string]any{"since": "1d"}, nil).Content[0].(mcp.TextContent).Text
+		for _, want := range []string{
+			"## digest-test-nas (device)\n\n- digest test runs truenas _(homelab)_",
+			"## digest-test-laptop (device)",
+			"- digest-test-laptop digest_test_backs_up digest-test-nas",
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("expected %q in:\n%s", want, text)
+			}
+		}
+	})
+
+	t.Run("by tag", func(t *testing.T) {
+		text := digest(map[string]any{"since": "1d", "group_by": "tag"}, nil).Content[0].(mcp.TextContent).Text
+		if !strings.Contains(text, "## homelab") || !strings.Contains(text, "- **digest-test-nas**: digest test runs truenas") {
+			t.Errorf("unexpected digest:\n%s", text)
+		}
+	})
+
+	t.Run("visibility", func(t *testing.T) {
+		scopes, err := parseVisibilityScopes("public", "")
+		if err != nil {
+			t.Fatalf("parseVisibilityScopes: %v", err)
+		}
+		text := digest(map[string]any{"since": "1d"}, scopes).Content[0].(mcp.TextContent).Text
+		if strings.Contains(text, "broken hinge") {
+			t.Errorf("private observation in digest:\n%s", text)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		defer func(dir string) { digestDir = dir }(digestDir)
+		digestDir = ""
+		if result := digest(map[string]any{"file": "week.md"}, nil); !result.IsError {
+			t.Error("expected an error without ENGRAM_DIGEST_DIR")
+		}
+
+		digestDir = t.TempDir()
+		if result := digest(map[string]any{"file": "../week.md"}, nil); !result.IsError {
+			t.Error("expected an error for a path outside the digest directory")
+		}
+		if result := digest(map[string]any{"since": "1d", "file": "week.md"}, nil); result.IsError {
+			t.Fatalf("digest: %v", result.Content)
+		}
+		data, err := os.ReadFile(filepath.Join(digestDir, "week.md"))
+		if err != nil || !strings.Contains(string(data), "digest test runs truenas") {
+			t.Errorf("file = %q, %v", data, err)
+		}
+		if info, err := os.Stat(filepath.Join(digestDir, "week.md")); err != nil {
+			t.Error(err)
+		} else if info.Mode().Perm() != 0o600 {
+			t.Errorf("file mode = %v, want -rw-------", info.Mode().Perm())
+		}
+	})
+
+	t.Run("bad input", func(t *testing.T) {
+		for _, args := range []map[string]any{{"since": "soon"}, {"group_by": "type"}} {
+			if result := digest(args, nil); !result.IsError {
+				t.Errorf("%v: expected an error", args)
+			}
+		}
+	})
+}
+
+func TestDigestLevels(t *testing.T) {
+	defer func(v string) { digestVisibility = v }(digestVisibility)
+	scopes := &visibilityScopes{defaults: []string{"shared", "public"}}
+
+	digestVisibility = ""
+	if levels, err := digestLevels(scopes); err != nil || strings.Join(levels, ",") != "shared,public" {
+		t.Errorf("default = %v, %v", levels, err)
+	}
+	digestVisibility = "private,shared,public"
+	if levels, err := digestLevels(scopes); err != nil || len(levels) != 3 {
+		t.Errorf("opted in = %v, %v", levels, err)
+	}
+	digestVisibility = "secret"
+	if _, err := digestLevels(scopes); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// doctorCheck is the outcome of one doctor check. fix says what to do about
+// a warning or failure.
+type doctorCheck struct {
+	name   string
+	status string
+	detail string
+	fix    string
+}
+
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "FAIL"
+)
+
+func doctorCommand(ctx context.Context, _ *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 15*time.Second, "give up on the database and embedder checks after this long")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if failed := runDoctor(ctx, withAuthToken(dbURL, dbAuthToken), *timeout, os.Stdout); failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// runDoctor checks the configuration and the database at url, writes a
+// line per check with a fix for each problem, and returns how many failed.
+// It reads the database but does not migrate or repair it.
+func runDoctor(ctx context.Context, url string, timeout time.Duration, w io.Writer) int {
+	checks := configChecks()
+	checks = append(checks, databaseChecks(ctx, url, timeout)...)
+
+	width, failed := 0, 0
+	for _, c := range checks {
+		width = max(width, len(c.name))
+	}
+	for _, c := range checks {
+		fmt.Fprintf(w, "%-4s  %-*s  %s\n", c.status, width, c.name, c.detail)
+		if c.fix != "" {
+			fmt.Fprintf(w, "      %-*s  fix: %s\n", width, "", c.fix)
+		}
+		if c.status == doctorFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+// configChecks parses the same settings serve does, reporting every one
+// that would stop it rather than only the first.
+func configChecks() []doctorCheck {
+	parse := []struct {
+		name string
+		err  func() error
+		fix  string
+	}{
+		{"visibility", func() error { _, err := parseVisibilityScopes(visibilityScope, clientVisibility); return err },
+			"fix ENGRAM_VISIBILITY or ENGRAM_CLIENT_VISIBILITY"},
+		{"tool access", func() error { _, err := parseToolAccess(enabledTools, disabledTools, clientTools); return err },
+			"fix ENGRAM_TOOLS, ENGRAM_DISABLED_TOOLS or ENGRAM_CLIENT_TOOLS"},
+		{"MCP keys", func() error { _, err := parseMCPKeys(mcpKeys); return err }, "fix ENGRAM_MCP_KEYS"},
+		{"secret policy", func() error { _, err := parseSecretPolicy(secretPolicyMode, forbiddenPatternsFile); return err },
+			"fix ENGRAM_SECRET_POLICY or ENGRAM_FORBIDDEN_PATTERNS_FILE"},
+		{"tag policy", func() error { return tagPolicyErr }, "fix ENGRAM_TAG_POLICY"},
+		{"inverse relations", func() error { return inverseRelationsErr }, "fix ENGRAM_INVERSE_RELATIONS"},
+		{"feeds", func() error { return feedsErr }, "fix ENGRAM_FEEDS"},
+		{"due webhook", func() error { return dueWebhookErr }, "fix ENGRAM_DUE_WEBHOOK"},
+		{"tag quotas", func() error { return tagQuotasErr }, "fix ENGRAM_TAG_QUOTAS"},
+		{"client tags", func() error { return namespacesErr }, "fix ENGRAM_CLIENT_TAGS"},
+		{"taxonomy", func() error { return taxonomyErr }, "fix the file ENGRAM_TAXONOMY names"},
+		{"entity templates", func() error { return entityTemplatesErr }, "fix the file ENGRAM_ENTITY_TEMPLATES names"},
+		{"languages", validateLanguages, "fix ENGRAM_LANGUAGES"},
+		{"summary model", func() error { _, err := newChatSampler(summaryURL, summaryModel, summaryAPIKey); return err },
+			"fix ENGRAM_SUMMARY_URL, ENGRAM_SUMMARY_MODEL or ENGRAM_SUMMARY_API_KEY"},
+		{"embedder", func() error {
+			_, err := newEmbedder(embedderName, embeddingModel, embeddingURL, embeddingAPIKey, embeddingDimensions)
+			return err
+		}, "fix ENGRAM_EMBEDDER and the ENGRAM_EMBEDDING_* settings"},
+	}
+	var problems []doctorCheck
+	for _, p := range parse {
+		if err := p.err(); err != nil {
+			problems = append(problems, doctorCheck{"config", doctorFail, fmt.Sprintf("%s: %v", p.name, err), p.fix})
+		}
+	}
+	if oversizedObservations != "chunk" && oversizedObservations != "reject" {
+		problems = append(problems, doctorCheck{"config", doctorFail,
+			fmt.Sprintf("ENGRAM_OVERSIZED_OBSERVATIONS is %q", oversizedObservations), "set it to chunk or reject"})
+	}
+	if compactObservations > 0 && compactHours > 0 && summaryURL == "" {
+		problems = append(problems, doctorCheck{"config", doctorFail,
+			"ENGRAM_COMPACT_OBSERVATIONS is set without ENGRAM_SUMMARY_URL", "set ENGRAM_SUMMARY_URL, or unset ENGRAM_COMPACT_OBSERVATIONS"})
+	}
+	if mcpAddr != "" && mcpKeys == "" && !loopbackAddr(mcpAddr) {
+		problems = append(problems, doctorCheck{"config", doctorWarn,
+			fmt.Sprintf("MCP on %s takes requests from anyone who can reach it, under whatever client name they report", mcpAddr),
+			"set ENGRAM_MCP_KEYS, or bind ENGRAM_MCP_ADDR to 127.0.0.1"})
+	}
+	if restAddr != "" && restToken == "" && oidcIssuer == "" && !loopbackAddr(restAddr) {
+		problems = append(problems, doctorCheck{"config", doctorWarn,
+			fmt.Sprintf("the REST API on %s takes requests from anyone who can reach it", restAddr),
+			"set ENGRAM_REST_TOKEN or ENGRAM_OIDC_ISSUER, or bind ENGRAM_REST_ADDR to 127.0.0.1"})
+	}
+	if grpcAddr != "" && grpcToken == "" && !loopbackAddr(grpcAddr) {
+		problems = append(problems, doctorCheck{"config", doctorWarn,
+			fmt.Sprintf("the gRPC API on %s takes calls from anyone who can reach it", grpcAddr),
+			"set ENGRAM_GRPC_TOKEN, or bind ENGRAM_GRPC_ADDR to 127.0.0.1"})
+	}
+	if len(problems) == 0 {
+		return []doctorCheck{{"config", doctorOK, "settings parse", ""}}
+	}
+	return problems
+}
+
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// redactURL drops the query, where libSQL URLs carry auth tokens.
+func redactURL(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return "(unparseable URL)"
+	}
+	u.RawQuery, u.User = "", nil
+	return u.String()
+}
+
+func databaseChecks(ctx context.Context, url string, timeout time.Duration) []doctorCheck {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	db, err := connect(ctx, url)
+	if err == nil {
+		// The HTTP driver's ping does not reach the server; a query does.
+		var one int
+		if err = db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+			db.Close()
+		}
+	}
+	if err != nil {
+		return []doctorCheck{{"connectivity", doctorFail, fmt.Sprintf("%s: %v", redactURL(url), err),
+			"start the libSQL server (sqld) or point LIBSQL_URL at it; for Turso, include ?authToken=... in the URL"}}
+	}
+	defer db.Close()
+	checks := []doctorCheck{{"connectivity", doctorOK,
+		fmt.Sprintf("%s answered in %s", redactURL(url), time.Since(start).Round(time.Millisecond)), ""}}
+
+	schema := schemaCheck(ctx, db)
+	checks = append(checks, schema...)
+	if schema[0].status == doctorFail {
+		return checks
+	}
+	checks = append(checks, foreignKeyCheck(ctx, db)...)
+	checks = append(checks, ftsChecks(ctx, db)...)
+	return append(checks, embedderCheck(ctx, db))
+}
+
+// schemaCheck compares the database's migration version with this binary's
+// and looks for the tables, indexes and triggers the applied migrations
+// should have left behind.
+func schemaCheck(ctx context.Context, db *sql.DB) []doctorCheck {
+	latest := migrations[len(migrations)-1].version
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return []doctorCheck{{"schema", doctorFail, fmt.Sprintf("no migrations applied (%v)", err),
+			"run `memory-mcp init` to create the schema"}}
+	}
+	checks := []doctorCheck{{"migrations", doctorOK, fmt.Sprintf("at version %d", version), ""}}
+	switch {
+	case version < latest:
+		checks[0] = doctorCheck{"migrations", doctorFail, fmt.Sprintf("at version %d, this binary expects %d", version, latest),
+			fmt.Sprintf("run `memory-mcp init` to apply migrations %d to %d", version+1, latest)}
+	case version > latest:
+		checks[0] = doctorCheck{"migrations", doctorWarn, fmt.Sprintf("at version %d, newer than this binary's %d", version, latest),
+			"upgrade memory-mcp; this build does not know the newest tables"}
+	}
+
+	present := make(map[string]bool)
+	rows, err := db.QueryContext(ctx, "SELECT type || ' ' || name FROM sqlite_master")
+	if err != nil {
+		return append(checks, doctorCheck{"schema", doctorFail, fmt.Sprintf("cannot read sqlite_master: %v", err), ""})
+	}
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			present[name] = true
+		}
+	}
+	rows.Close()
+
+	var missing []string
+	fixes := make(map[int]bool)
+	for object, v := range expectedSchema(version) {
+		if !present[object] {
+			missing = append(missing, object)
+			fixes[v] = true
+		}
+	}
+	if len(missing) == 0 {
+		return append(checks, doctorCheck{"schema", doctorOK, "every table, index and trigger is present", ""})
+	}
+	sort.Strings(missing)
+	versions := make([]string, 0, len(fixes))
+	for v := range fixes {
+		versions = append(versions, fmt.Sprint(v))
+	}
+	sort.Strings(versions)
+	return append(checks, doctorCheck{"schema", doctorFail, "missing " + strings.Join(missing, ", "),
+		fmt.Sprintf("they were dropped outside the migrations; recreate them with the statements of migration %s in schema.go, or restore a backup", strings.Join(versions, ", "))})
+}
+
+var schemaStatement = regexp.MustCompile(`(?is)^\s*(CREATE|DROP)\s+(?:UNIQUE\s+|VIRTUAL\s+)?(TABLE|INDEX|TRIGGER)\s+IF\s+(?:NOT\s+)?EXISTS\s+(\w+)`)
+
+// expectedSchema replays the migrations up to version and returns the
+// objects they leave, as "type name", with the migration that created each.
+func expectedSchema(version int) map[string]int {
+	objects := map[string]int{"table schema_migrations": 0}
+	for _, m := range migrations {
+		if m.version > version {
+			break
+		}
+		for _, stmt := range m.statements {
+			match := schemaStatement.FindStringSubmatch(stmt)
+			if match == nil {
+				continue
+			}
+			object := strings.ToLower(match[2]) + " " + match[3]
+			if strings.EqualFold(match[1], "CREATE") {
+				objects[object] = m.version
+			} else {
+				delete(objects, object)
+			}
+		}
+	}
+	return objects
+}
+
+func foreignKeyCheck(ctx context.Context, db *sql.DB) []doctorCheck {
+	var enforced int
+	if err := db.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enforced); err != nil {
+		return []doctorCheck{{"foreign keys", doctorFail, fmt.Sprintf("cannot read PRAGMA foreign_keys: %v", err), ""}}
+	}
+	var check doctorCheck
+	switch {
+	case !foreignKeys:
+		check = doctorCheck{"foreign keys", doctorWarn, "not enforced: ENGRAM_FOREIGN_KEYS is false",
+			"unset ENGRAM_FOREIGN_KEYS, so deleting an entity also deletes its observations and relations"}
+	case enforced == 0:
+		check = doctorCheck{"foreign keys", doctorFail, "PRAGMA foreign_keys = ON did not take on this server",
+			"use a libSQL server that honours PRAGMA foreign_keys; until then deletes leave orphaned rows"}
+	default:
+		check = doctorCheck{"foreign keys", doctorOK, "enforced", ""}
+	}
+
+	violations, err := foreignKeyViolations(ctx, db)
+	switch {
+	case err != nil:
+		return []doctorCheck{check, {"orphaned rows", doctorFail, fmt.Sprintf("foreign_key_check failed: %v", err), ""}}
+	case len(violations) > 0:
+		return []doctorCheck{check, {"orphaned rows", doctorWarn, fmt.Sprintf("%d row(s) reference missing parents", len(violations)),
+			"call the check_integrity tool to list them, then again with repair: true"}}
+	}
+	return []doctorCheck{check, {"orphaned rows", doctorOK, "none", ""}}
+}
+
+// ftsChecks runs FTS5's integrity check on each full-text index, which also
+// compares it with the table it indexes, so an index that missed writes
+// shows up here.
+func ftsChecks(ctx context.Context, db *sql.DB) []doctorCheck {
+	tables, err := ftsTables(ctx, db)
+	if err != nil {
+		return []doctorCheck{{"full-text index", doctorFail, fmt.Sprintf("cannot list indexes: %v", err), ""}}
+	}
+	var checks []doctorCheck
+	for _, t := range tables {
+		q := fmt.Sprintf("INSERT INTO %s(%s, rank) VALUES ('integrity-check', 1)", quoteIdent(t), quoteIdent(t))
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			checks = append(checks, doctorCheck{"full-text index", doctorFail, fmt.Sprintf("%s is out of date with its table: %v", t, err),
+				fmt.Sprintf("run `memory-mcp repl` and enter: INSERT INTO %s(%s) VALUES ('rebuild');", t, t)})
+			continue
+		}
+		checks = append(checks, doctorCheck{"full-text index", doctorOK, t + " matches its table", ""})
+	}
+	return checks
+}
+
+// embedderCheck embeds a short text with the configured embedder and
+// compares its size with the vectors already stored for the model.
+func embedderCheck(ctx context.Context, db *sql.DB) doctorCheck {
+	e, err := newEmbedder(embedderName, embeddingModel, embeddingURL, embeddingAPIKey, embeddingDimensions)
+	if err != nil {
+		return doctorCheck{"embedder", doctorFail, err.Error(), "fix ENGRAM_EMBEDDER and the ENGRAM_EMBEDDING_* settings"}
+	}
+	if e == nil {
+		return doctorCheck{"embedder", doctorOK, "off, semantic search is disabled (set ENGRAM_EMBEDDER to enable it)", ""}
+	}
+	vectors, err := e.Embed(ctx, []string{"memory-mcp doctor"})
+	if err != nil {
+		return doctorCheck{"embedder", doctorFail, fmt.Sprintf("%s: %v", e.Model(), err),
+			"check the embedding provider is up and ENGRAM_EMBEDDING_URL and ENGRAM_EMBEDDING_API_KEY are right"}
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return doctorCheck{"embedder", doctorFail, fmt.Sprintf("%s returned no vector", e.Model()), "check ENGRAM_EMBEDDING_MODEL names an embedding model"}
+	}
+	dims := len(vectors[0])
+
+	var stored sql.NullInt64
+	var pending int
+	if err := db.QueryRowContext(ctx, "SELECT MIN(dimensions) FROM observation_embeddings WHERE model = ? AND dimensions != ?", e.Model(), dims).Scan(&stored); err != nil {
+		return doctorCheck{"embedder", doctorFail, fmt.Sprintf("cannot read observation_embeddings: %v", err), ""}
+	}
+	if stored.Valid {
+		return doctorCheck{"embedder", doctorFail,
+			fmt.Sprintf("%s now returns %d dimensions, but stored vectors have %d", e.Model(), dims, stored.Int64),
+			fmt.Sprintf("restore ENGRAM_EMBEDDING_DIMENSIONS, or DELETE FROM observation_embeddings WHERE model = '%s' and run `memory-mcp embed`", e.Model())}
+	}
+	err = db.QueryRowContext(ctx, `SELECT count(*) FROM observations o
+		LEFT JOIN observation_embeddings x ON x.observation_id = o.id
+		WHERE x.observation_id IS NULL OR x.model != ?`, e.Model()).Scan(&pending)
+	if err != nil {
+		return doctorCheck{"embedder", doctorFail, fmt.Sprintf("cannot count pending observations: %v", err), ""}
+	}
+	detail := fmt.Sprintf("%s returns %d dimensions", e.Model(), dims)
+	if pending > 0 {
+		return doctorCheck{"embedder", doctorWarn, fmt.Sprintf("%s; %d observation(s) not embedded yet", detail, pending),
+			"serve embeds them in the background, or run `memory-mcp embed` now"}
+	}
+	return doctorCheck{"embedder", doctorOK, detail, ""}
+}
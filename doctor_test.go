@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpectedSchema(t *testing.T) {
+	objects := expectedSchema(migrations[len(migrations)-1].version)
+	for _, want := range []string{"table entities", "table observations_fts", "trigger observations_fts_insert", "index recall_feedback_observation_id", "table schema_migrations"} {
+		if _, ok := objects[want]; !ok {
+			t.Errorf("expected schema is missing %s", want)
+		}
+	}
+	if v := objects["table recall_feedback"]; v != 23 {
+		t.Errorf("recall_feedback created by migration %d, want 23", v)
+	}
+	if _, ok := expectedSchema(1)["table recall_feedback"]; ok {
+		t.Error("version 1 expects a table from a later migration")
+	}
+}
+
+func TestLoopbackAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8090": true,
+		"localhost:8090": true,
+		"[::1]:8090":     true,
+		"0.0.0.0:8090":   false,
+		":8090":          false,
+		"10.0.0.5:8090":  false,
+	}
+	for addr, want := range tests {
+		if got := loopbackAddr(addr); got != want {
+			t.Errorf("loopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+	if got := redactURL("libsql://db.example.com?authToken=secret"); got != "libsql://db.example.com" {
+		t.Errorf("redactURL = %q", got)
+	}
+}
+
+func TestDoctorUnreachable(t *testing.T) {
+	var out strings.Builder
+	failed := runDoctor(context.Background(), "http://127.0.0.1:1?authToken=secret", 5*time.Second, &out)
+	if failed == 0 || !strings.Contains(out.String(), "FAIL  connectivity") || !strings.Contains(out.String(), "fix: start the libSQL server") {
+		t.Errorf("doctor on a closed port, %d failed:\n%s", failed, out.String())
+	}
+	if strings.Contains(out.String(), "secret") {
+		t.Errorf("doctor printed the auth token:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "migrations") {
+		t.Errorf("doctor went on past a failed connection:\n%s", out.String())
+	}
+}
+
+func TestDoctor_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	db.Close()
+
+	var out strings.Builder
+	if failed := runDoctor(context.Background(), dbURL, 10*time.Second, &out); failed > 0 {
+		t.Errorf("%d check(s) failed:\n%s", failed, out.String())
+	}
+	for _, want := range []string{"ok    connectivity", "ok    migrations", "ok    schema", "observations_fts matches its table"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	// dueWebhookURL is ENGRAM_DUE_WEBHOOK: a URL serve POSTs each reminder
+	// to, as JSON, once when it comes due.
+	dueWebhookURL = getEnv("ENGRAM_DUE_WEBHOOK", "")
+	// dueWebhookSecret, when set, signs each webhook body with HMAC-SHA256
+	// in the X-Engram-Signature header.
+	dueWebhookSecret = getEnv("ENGRAM_DUE_WEBHOOK_SECRET", "")
+)
+
+// dueWebhookErr is set when ENGRAM_DUE_WEBHOOK is not an http(s) URL. serve
+// refuses to start with it.
+var dueWebhookErr = checkWebhookURL(dueWebhookURL)
+
+const (
+	dueWebhookInterval = 30 * time.Second
+	dueWebhookEvent    = "reminder.due"
+)
+
+var dueWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func checkWebhookURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q, want http:// or https://", s)
+	}
+	return nil
+}
+
+// dueReminder is a reminder that has come due, as a webhook sends it.
+type dueReminder struct {
+	ID            int64  `json:"id"`
+	ObservationID int64  `json:"observationId"`
+	Entity        string `json:"entity"`
+	Content       string `json:"content"`
+	DueAt         string `json:"dueAt"`
+	Repeats       string `json:"repeats,omitempty"`
+}
+
+type dueEvent struct {
+	Event    string      `json:"event"`
+	Reminder dueReminder `json:"reminder"`
+}
+
+// claimDue returns the open reminders due by now that no webhook has been
+// sent for, up to defaultDueLimit, and marks them as notified so another
+// server sharing the database does not send them too. Only reminders on
+// observations visible at levels are claimed.
+func claimDue(ctx context.Context, db *sql.DB, levels []string, now time.Time) ([]dueReminder, error) {
+	rows, err := db.QueryContext(ctx, restrictVisibility(`SELECT r.id, r.observation_id, e.name, o.content, r.due_at, COALESCE(r.rrule, '')
+		FROM reminders r JOIN observations o ON o.id = r.observation_id JOIN entities e ON e.id = o.entity_id
+		WHERE r.completed_at IS NULL AND r.notified_at IS NULL AND r.due_at <= ?
+		ORDER BY r.due_at, r.id LIMIT ?`, levels), now.UTC().Format(reminderTimeForm), defaultDueLimit)
+	if err != nil {
+		return nil, err
+	}
+	var due []dueReminder
+	for rows.Next() {
+		var r dueReminder
+		var dueAt any
+		if err := rows.Scan(&r.ID, &r.ObservationID, &r.Entity, &r.Content, &dueAt, &r.Repeats); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if t, err := reminderTime(dueAt); err == nil {
+			r.DueAt = t.Format(time.RFC3339)
+		} else {
+			r.DueAt = formatValue(dueAt)
+		}
+		due = append(due, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	claimed := due[:0]
+	for _, r := range due {
+		result, err := db.ExecContext(ctx, "UPDATE reminders SET notified_at = CURRENT_TIMESTAMP WHERE id = ? AND notified_at IS NULL", r.ID)
+		if err != nil {
+			return claimed, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			claimed = append(claimed, r)
+		}
+	}
+	return claimed, nil
+}
+
+// sendDueWebhook POSTs r to target as a dueEvent.
+func sendDueWebhook(ctx context.Context, target, secret string, r dueReminder) error {
+	body, err := json.Marshal(dueEvent{Event: dueWebhookEvent, Reminder: r})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Engram-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := dueWebhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyDue sends a webhook for each reminder that has come due since the
+// last run and returns how many were delivered. A reminder whose webhook
+// fails is released, so the next run tries it again.
+func notifyDue(ctx context.Context, db *sql.DB, levels []string, target, secret string, now time.Time) (int, error) {
+	due, err := claimDue(ctx, db, levels, now)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	var failed error
+	for _, r := range due {
+		if err := sendDueWebhook(ctx, target, secret, r); err != nil {
+			if _, rerr := db.ExecContext(ctx, "UPDATE reminders SET notified_at = NULL WHERE id = ?", r.ID); rerr != nil {
+				log.Printf("due webhook: releasing reminder %d: %v", r.ID, rerr)
+			}
+			if failed == nil {
+				failed = fmt.Errorf("reminder %d: %v", r.ID, err)
+			}
+			continue
+		}
+		sent++
+	}
+	return sent, failed
+}
+
+// notifyDuePeriodically runs notifyDue every interval until ctx is done.
+func notifyDuePeriodically(ctx context.Context, db *sql.DB, levels []string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sent, err := notifyDue(ctx, db, levels, dueWebhookURL, dueWebhookSecret, time.Now())
+		if err != nil {
+			log.Printf("due webhook: %v", err)
+		}
+		if sent > 0 {
+			log.Printf("due webhook: sent %d reminder(s)", sent)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckWebhookURL(t *testing.T) {
+	for _, tt := range []struct {
+		url     string
+		wantErr bool
+	}{
+		{"", false},
+		{"https://hooks.example.com/engram", false},
+		{"http://localhost:5678/webhook/due", false},
+		{"hooks.example.com", true},
+		{"ftp://example.com/due", true},
+		{"https://", true},
+	} {
+		if err := checkWebhookURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("checkWebhookURL(%q) = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+// webhookRecorder is a webhook endpoint that keeps the events it receives,
+// answering with status.
+type webhookRecorder struct {
+	mu     sync.Mutex
+	status int
+	events []dueEvent
+	sigs   []string
+	bodies [][]byte
+}
+
+func (w *webhookRecorder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var ev dueEvent
+	json.Unmarshal(body, &ev)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.events = append(w.events, ev)
+	w.sigs = append(w.sigs, r.Header.Get("X-Engram-Signature"))
+	w.bodies = append(w.bodies, body)
+	rw.WriteHeader(w.status)
+}
+
+func TestSendDueWebhook(t *testing.T) {
+	rec := &webhookRecorder{status: http.StatusNoContent}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	r := dueReminder{ID: 7, ObservationID: 42, Entity: "plants", Content: "water the plants", DueAt: "2026-05-02T09:00:00Z", Repeats: "FREQ=WEEKLY"}
+	if err := sendDueWebhook(context.Background(), srv.URL, "s3cret", r); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.events) != 1 || rec.events[0].Event != dueWebhookEvent || rec.events[0].Reminder != r {
+		t.Fatalf("events = %+v", rec.events)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(rec.bodies[0])
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); rec.sigs[0] != want {
+		t.Errorf("signature = %q, want %q", rec.sigs[0], want)
+	}
+
+	if err := sendDueWebhook(context.Background(), srv.URL, "", r); err != nil || rec.sigs[1] != "" {
+		t.Errorf("unsigned: err = %v, signature %q", err, rec.sigs[1])
+	}
+	rec.status = http.StatusBadGateway
+	if err := sendDueWebhook(context.Background(), srv.URL, "", r); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("failing endpoint: err = %v", err)
+	}
+}
+
+func TestNotifyDue_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	defer db.Exec("DELETE FROM entities WHERE name = 'webhook-test-plants'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'webhook test %'")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('webhook-test-plants', 'Chore')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	add := func(content, due string) int64 {
+		t.Helper()
+		var obs int64
+		if err := db.QueryRow(`INSERT INTO observations (entity_id, content) SELECT id, ? FROM entities WHERE name = 'webhook-test-plants' RETURNING id`, content).Scan(&obs); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		if _, err := db.Exec("INSERT INTO reminders (observation_id, due_at) VALUES (?, ?)", obs, due); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		return obs
+	}
+	now := time.Now()
+	past := now.Add(-time.Minute).UTC().Format(reminderTimeForm)
+	watered := add("webhook test water the plants", past)
+	add("webhook test repot the fern", now.Add(time.Hour).UTC().Format(reminderTimeForm))
+
+	rec := &webhookRecorder{status: http.StatusOK}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	mine := func() []dueReminder {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		var got []dueReminder
+		for _, ev := range rec.events {
+			if ev.Reminder.Entity == "webhook-test-plants" {
+				got = append(got, ev.Reminder)
+			}
+		}
+		return got
+	}
+
+	if _, err := notifyDue(context.Background(), db, visibilityLevels, srv.URL, "", now); err != nil {
+		t.Fatal(err)
+	}
+	got := mine()
+	if len(got) != 1 || got[0].ObservationID != watered || got[0].Content != "webhook test water the plants" {
+		t.Fatalf("sent %+v, want only the reminder that is due", got)
+	}
+	// Each reminder is sent once.
+	if _, err := notifyDue(context.Background(), db, visibilityLevels, srv.URL, "", now); err != nil {
+		t.Fatal(err)
+	}
+	if got := mine(); len(got) != 1 {
+		t.Errorf("sent %d times, want once", len(got))
+	}
+
+	// A failed delivery is retried on the next run.
+	rec.status = http.StatusServiceUnavailable
+	later := now.Add(2 * time.Hour)
+	if _, err := notifyDue(context.Background(), db, visibilityLevels, srv.URL, "", later); err == nil {
+		t.Error("failing endpoint: expected an error")
+	}
+	rec.status = http.StatusOK
+	if _, err := notifyDue(context.Background(), db, visibilityLevels, srv.URL, "", later); err != nil {
+		t.Fatal(err)
+	}
+	if got := mine(); len(got) != 3 || got[1].Content != "webhook test repot the fern" || got[2].Content != "webhook test repot the fern" {
+		t.Errorf("sent %+v, want the fern reminder failed once and then sent", got)
+	}
+}
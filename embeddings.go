@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// embedderName picks the embedding provider: openai, ollama, gemini or local
+// (hashed words, no network). Unset disables embeddings and semantic search.
+// The model, URL and key default per provider; embeddingDimensions asks
+// providers that support it (openai, local) for shorter vectors.
+var (
+	embedderName        = getEnv("ENGRAM_EMBEDDER", "")
+	embeddingModel      = getEnv("ENGRAM_EMBEDDING_MODEL", "")
+	embeddingURL        = getEnv("ENGRAM_EMBEDDING_URL", "")
+	embeddingAPIKey     = getEnv("ENGRAM_EMBEDDING_API_KEY", "")
+	embeddingDimensions = getEnvInt("ENGRAM_EMBEDDING_DIMENSIONS", 0)
+	embedBatch          = getEnvInt("ENGRAM_EMBED_BATCH", 64)
+)
+
+const (
+	defaultSemanticLimit = 10
+	maxSemanticLimit     = 100
+)
+
+// Embedder turns texts into vectors, one per text. Model names the provider,
+// model and any dimension setting, e.g. "openai/text-embedding-3-small".
+// Stored vectors are only compared with vectors of the same Model, so
+// switching providers re-embeds instead of comparing unrelated spaces.
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+func newEmbedder(name, model, url, key string, dims int) (Embedder, error) {
+	withDefaults := func(defModel, defURL string) (string, string) {
+		if model == "" {
+			model = defModel
+		}
+		if url == "" {
+			url = defURL
+		}
+		return model, strings.TrimRight(url, "/")
+	}
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "":
+		return nil, nil
+	case "openai":
+		if key == "" {
+			return nil, fmt.Errorf("openai embedder needs ENGRAM_EMBEDDING_API_KEY")
+		}
+		model, url := withDefaults("text-embedding-3-small", "https://api.openai.com/v1")
+		return &openAIEmbedder{url: url, model: model, key: key, dims: dims}, nil
+	case "ollama":
+		model, url := withDefaults("nomic-embed-text", "http://localhost:11434")
+		return &ollamaEmbedder{url: url, model: model}, nil
+	case "gemini":
+		if key == "" {
+			return nil, fmt.Errorf("gemini embedder needs ENGRAM_EMBEDDING_API_KEY")
+		}
+		model, url := withDefaults("text-embedding-004", "https://generativelanguage.googleapis.com/v1beta")
+		return &geminiEmbedder{url: url, model: model, key: key}, nil
+	case "local":
+		if dims == 0 {
+			dims = 256
+		}
+		return localEmbedder{dims: dims}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedder %q, want openai, ollama, gemini or local", name)
+	}
+}
+
+var embedClient = &http.Client{Timeout: 60 * time.Second}
+
+// postJSON sends body to url and decodes the JSON response into out.
+func postJSON(ctx context.Context, url string, header http.Header, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := embedClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkVectors rejects a response that does not hold one vector of a single
+// length per text.
+func checkVectors(texts []string, vectors [][]float32) ([][]float32, error) {
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(texts))
+	}
+	for _, v := range vectors {
+		if len(v) == 0 || len(v) != len(vectors[0]) {
+			return nil, fmt.Errorf("got embeddings of differing or zero length")
+		}
+	}
+	return vectors, nil
+}
+
+type openAIEmbedder struct {
+	url, model, key string
+	dims            int
+}
+
+func (e *openAIEmbedder) Model() string {
+	if e.dims > 0 {
+		return fmt.Sprintf("openai/%s@%d", e.model, e.dims)
+	}
+	return "openai/" + e.model
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body := map[string]any{"model": e.model, "input": texts}
+	if e.dims > 0 {
+		body["dimensions"] = e.dims
+	}
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := postJSON(ctx, e.url+"/embeddings", http.Header{"Authorization": {"Bearer " + e.key}}, body, &resp); err != nil {
+		return nil, fmt.Errorf("openai: %v", err)
+	}
+	vectors := make([][]float32, len(resp.Data))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("openai: embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return checkVectors(texts, vectors)
+}
+
+type ollamaEmbedder struct {
+	url, model string
+}
+
+func (e *ollamaEmbedder) Model() string { return "ollama/" + e.model }
+
+func (e *ollamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := postJSON(ctx, e.url+"/api/embed", nil, map[string]any{"model": e.model, "input": texts}, &resp); err != nil {
+		return nil, fmt.Errorf("ollama: %v", err)
+	}
+	return checkVectors(texts, resp.Embeddings)
+}
+
+type geminiEmbedder struct {
+	url, model, key string
+}
+
+func (e *geminiEmbedder) Model() string { return "gemini/" + e.model }
+
+func (e *geminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	type part struct {
+		Text string `json:"text"`
+	}
+	type content struct {
+		Parts []part `json:"parts"`
+	}
+	type request struct {
+		Model   string  `json:"model"`
+		Content content `json:"content"`
+	}
+	requests := make([]request, len(texts))
+	for i, t := range texts {
+		requests[i] = request{Model: "models/" + e.model, Content: content{Parts: []part{{Text: t}}}}
+	}
+	var resp struct {
+		Embeddings []struct {
+			Values []float32 `json:"values"`
+		} `json:"embeddings"`
+	}
+	url := fmt.Sprintf("%s/models/%s:batchEmbedContents", e.url, e.model)
+	if err := postJSON(ctx, url, http.Header{"X-Goog-Api-Key": {e.key}}, map[string]any{"requests": requests}, &resp); err != nil {
+		return nil, fmt.Errorf("gemini: %v", err)
+	}
+	vectors := make([][]float32, len(resp.Embeddings))
+	for i, emb := range resp.Embeddings {
+		vectors[i] = emb.Values
+	}
+	return checkVectors(texts, vectors)
+}
+
+// localEmbedder hashes lower-cased words into a fixed number of buckets. It
+// needs no network or model and finds shared words, not shared meaning.
+type localEmbedder struct {
+	dims int
+}
+
+func (e localEmbedder) Model() string { return fmt.Sprintf("local/hash@%d", e.dims) }
+
+func (e localEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, e.dims)
+		for _, w := range strings.FieldsFunc(strings.ToLower(t), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}) {
+			h := fnv.New32a()
+			h.Write([]byte(w))
+			sum := h.Sum32()
+			// The top bit picks the sign so colliding words tend to cancel.
+			if sum&(1<<31) != 0 {
+				v[sum%uint32(e.dims)]--
+			} else {
+				v[sum%uint32(e.dims)]++
+			}
+		}
+		vectors[i] = normalize(v)
+	}
+	return vectors, nil
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+	return v
+}
+
+// encodeVector stores a vector as little-endian float32s, the layout of
+// libSQL's F32_BLOB.
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+func decodeVector(b []byte) ([]float32, error) {
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("vector blob of %d bytes is not a float32 array", len(b))
+	}
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v, nil
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// embeddingText is what gets embedded for an observation: its entity's name
+// gives short observations like "runs truenas" their subject.
+const embeddingText = `e.name || ': ' || o.content`
+
+// embedPending embeds up to batch observations that have no embedding or one
+// from another model, and returns how many it stored.
+func embedPending(ctx context.Context, db *sql.DB, e Embedder, batch int) (int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT o.id, `+embeddingText+`
+		FROM observations o JOIN entities e ON e.id = o.entity_id
+		LEFT JOIN observation_embeddings x ON x.observation_id = o.id
+		WHERE x.observation_id IS NULL OR x.model != ?
+		ORDER BY o.id LIMIT ?`, e.Model(), batch)
+	if err != nil {
+		return 0, fmt.Errorf("query error: %v", err)
+	}
+	var ids []int64
+	var texts []string
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan error: %v", err)
+		}
+		ids = append(ids, id)
+		texts = append(texts, text)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("query error: %v", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	vectors, err := e.Embed(ctx, texts)
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if _, err := db.ExecContext(ctx, `INSERT INTO observation_embeddings (observation_id, model, dimensions, embedding)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (observation_id) DO UPDATE SET model = excluded.model, dimensions = excluded.dimensions,
+				embedding = excluded.embedding, created_at = CURRENT_TIMESTAMP`,
+			id, e.Model(), len(vectors[i]), encodeVector(vectors[i])); err != nil {
+			return i, fmt.Errorf("store embedding: %v", err)
+		}
+	}
+	return len(ids), nil
+}
+
+// embedAll embeds every pending observation, batch by batch.
+func embedAll(ctx context.Context, db *sql.DB, e Embedder, batch int) (int, error) {
+	total := 0
+	for {
+		n, err := embedPending(ctx, db, e, batch)
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+	}
+}
+
+// staleEmbeddings counts stored embeddings made by a model other than e's.
+func staleEmbeddings(ctx context.Context, db *sql.DB, e Embedder) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM observation_embeddings WHERE model != ?", e.Model()).Scan(&n)
+	return n, err
+}
+
+func embedPeriodically(ctx context.Context, db *sql.DB, e Embedder, interval time.Duration) {
+	if n, err := staleEmbeddings(ctx, db, e); err == nil && n > 0 {
+		log.Printf("embedding model is now %s: re-embedding %d observations embedded with another model", e.Model(), n)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := embedAll(ctx, db, e, embedBatch)
+		if err != nil {
+			log.Printf("embedding failed after %d observations: %v", n, err)
+		} else if n > 0 {
+			log.Printf("embedded %d observations with %s", n, e.Model())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// registerSemanticSearch adds the semantic_search tool.
+func registerSemanticSearch(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes, embedder Embedder, vectors *vectorIndex) {
+	s.AddTool(mcp.NewTool("semantic_search",
+		mcp.WithDescription(`Find observations by meaning rather than exact words, ranked by similarity to the given text.
+
+Needs ENGRAM_EMBEDDER. Observations are embedded in the background, so ones added in the last minute may not show up yet.`),
+		mcp.WithString("text",
+			mcp.Required(),
+			mcp.Description("What to look for, e.g. 'where backups are stored'"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum observations to return (default %d, max %d)", defaultSemanticLimit, maxSemanticLimit)),
+		),
+		mcp.WithBoolean("include_history",
+			mcp.Description("Also return observations a correction or follow-up has superseded (default false, only the latest item of each thread)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), semanticSearchHandler(db, embedder, vectors, scopes))
+}
+
+func semanticSearchHandler(db *sql.DB, e Embedder, idx *vectorIndex, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if e == nil {
+			return toolError(codeUnavailable, "semantic search is off, set ENGRAM_EMBEDDER to enable it"), nil
+		}
+		text := strings.TrimSpace(request.GetString("text", ""))
+		if text == "" {
+			return toolError(codeInvalidArgument, "text parameter is required"), nil
+		}
+		limit := request.GetInt("limit", defaultSemanticLimit)
+		if limit < 1 || limit > maxSemanticLimit {
+			return toolErrorf(codeInvalidArgument, "limit must be between 1 and %d", maxSemanticLimit), nil
+		}
+
+		vectors, err := e.Embed(ctx, []string{text})
+		if err != nil {
+			return toolErrorf(errorCode(err, codeUpstream), "failed to embed text: %v", err), nil
+		}
+		levels := scopes.levels(ctx)
+		results, err := idx.search(ctx, db, levels, e.Model(), vectors[0], limit)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "search failed: %v", err), nil
+		}
+		ids := make([]int64, len(results))
+		for i, r := range results {
+			r["similarity"] = math.Round(r["similarity"].(float64)*1000) / 1000
+			ids[i] = r["id"].(int64)
+		}
+		// Observations a follow-up has superseded are left out, naming the
+		// latest item of their thread instead.
+		var note string
+		if !request.GetBool("include_history", false) {
+			latest, err := latestInThreads(ctx, db, levels, ids)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to read threads: %v", err), nil
+			}
+			var kept []map[string]any
+			var newer []string
+			ids = ids[:0]
+			for _, r := range results {
+				id := r["id"].(int64)
+				if l, ok := latest[id]; ok && l != id {
+					newer = append(newer, fmt.Sprintf("%s for %d", citation(l), id))
+					continue
+				}
+				kept = append(kept, r)
+				ids = append(ids, id)
+			}
+			if len(newer) > 0 {
+				results = kept
+				note = fmt.Sprintf("\n%d superseded observations left out; their latest follow-ups are %s (pass include_history to keep them)", len(newer), strings.Join(newer, ", "))
+			}
+		}
+		recordAccess(ctx, db, ids, nil)
+		return mcp.NewToolResultText(formatRows([]string{"id", "entity", "content", "similarity"}, results) + note), nil
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNewEmbedder(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		key       string
+		dims      int
+		wantModel string
+		wantErr   bool
+	}{
+		{"off", "", "", 0, "", false},
+		{"openai", "openai", "k", 0, "openai/text-embedding-3-small", false},
+		{"openai with dimensions", "OpenAI", "k", 512, "openai/text-embedding-3-small@512", false},
+		{"openai without key", "openai", "", 0, "", true},
+		{"ollama", "ollama", "", 0, "ollama/nomic-embed-text", false},
+		{"gemini", "gemini", "k", 0, "gemini/text-embedding-004", false},
+		{"gemini without key", "gemini", "", 0, "", true},
+		{"local", "local", "", 0, "local/hash@256", false},
+		{"local with dimensions", "local", "", 64, "local/hash@64", false},
+		{"unknown", "word2vec", "", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newEmbedder(tt.provider, "", "", tt.key, tt.dims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newEmbedder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			model := ""
+			if e != nil {
+				model = e.Model()
+			}
+			if model != tt.wantModel {
+				t.Errorf("Model() = %q, want %q", model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestEmbedderProviders(t *testing.T) {
+	var got map[string]any
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")+r.Header.Get("X-Goog-Api-Key")
+		json.NewDecoder(r.Body).Decode(&got)
+		switch {
+		case r.URL.Path == "/embeddings":
+			// Out of order, as the API allows.
+			w.Write([]byte(`{"data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}]}`))
+		case r.URL.Path == "/api/embed":
+			w.Write([]byte(`{"embeddings": [[1, 0], [0, 1]]}`))
+		case strings.HasSuffix(r.URL.Path, ":batchEmbedContents"):
+			w.Write([]byte(`{"embeddings": [{"values": [1, 0]}, {"values": [0, 1]}]}`))
+		default:
+			http.Error(w, "model not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		provider string
+		wantPath string
+		wantAuth string
+		wantBody string
+	}{
+		{"openai", "/embeddings", "Bearer k", `"dimensions":8`},
+		{"ollama", "/api/embed", "", `"model":"m"`},
+		{"gemini", "/models/m:batchEmbedContents", "k", `"model":"models/m"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			e, err := newEmbedder(tt.provider, "m", srv.URL, "k", 8)
+			if err != nil {
+				t.Fatalf("newEmbedder: %v", err)
+			}
+			vectors, err := e.Embed(context.Background(), []string{"a", "b"})
+			if err != nil {
+				t.Fatalf("Embed: %v", err)
+			}
+			if want := [][]float32{{1, 0}, {0, 1}}; !reflect.DeepEqual(vectors, want) {
+				t.Errorf("Embed() = %v, want %v", vectors, want)
+			}
+			body, _ := json.Marshal(got)
+			if gotPath != tt.wantPath || gotAuth != tt.wantAuth || !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("request %s auth %q body %s, want %s auth %q body with %s", gotPath, gotAuth, body, tt.wantPath, tt.wantAuth, tt.wantBody)
+			}
+
+			if _, err := e.Embed(context.Background(), []string{"a"}); err == nil {
+				t.Errorf("expected an error for 2 embeddings of 1 text")
+			}
+		})
+	}
+
+	e, _ := newEmbedder("ollama", "m", srv.URL+"/missing", "", 0)
+	if _, err := e.Embed(context.Background(), []string{"a"}); err == nil || !strings.Contains(err.Error(), "model not found") {
+		t.Errorf("expected the provider's error, got %v", err)
+	}
+}
+
+func TestLocalEmbedder(t *testing.T) {
+	e := localEmbedder{dims: 64}
+	vectors, err := e.Embed(context.Background(), []string{"NAS runs TrueNAS", "the nas runs truenas!", "espresso beans", ""})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vectors) != 4 || len(vectors[0]) != 64 {
+		t.Fatalf("got %d vectors of %d dimensions", len(vectors), len(vectors[0]))
+	}
+	if same, other := cosine(vectors[0], vectors[1]), cosine(vectors[0], vectors[2]); same <= other {
+		t.Errorf("similar texts scored %f, unrelated %f", same, other)
+	}
+	if cosine(vectors[0], vectors[3]) != 0 {
+		t.Errorf("empty text should have a zero vector")
+	}
+}
+
+func TestVectorEncoding(t *testing.T) {
+	v := []float32{1.5, -2, 0, 3.25}
+	b := encodeVector(v)
+	if len(b) != 16 {
+		t.Fatalf("encoded %d bytes, want 16", len(b))
+	}
+	got, err := decodeVector(b)
+	if err != nil || !reflect.DeepEqual(got, v) {
+		t.Errorf("decodeVector() = %v %v, want %v", got, err, v)
+	}
+	if _, err := decodeVector([]byte{1, 2, 3}); err == nil {
+		t.Errorf("expected an error for a truncated vector")
+	}
+}
+
+func TestEmbeddings_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM observation_embeddings")
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'embed-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'embed test %'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('embed-test-nas', 'device'), ('embed-test-coffee', 'drink')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, args := range []map[string]any{
+		{"entity": "embed-test-nas", "content": "embed test backups go to the zfs pool nightly", "visibility": "public"},
+		{"entity": "embed-test-nas", "content": "embed test has four disks"},
+		{"entity": "embed-test-coffee", "content": "embed test prefers light roast beans", "visibility": "public"},
+	} {
+		args["tags"] = "homelab"
+		if result, err := callTool(addObservationHandler(db, nil), "add_observation", args); err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+	}
+
+	small := localEmbedder{dims: 128}
+	if _, err := embedAll(ctx, db, small, 2); err != nil {
+		t.Fatalf("embedAll: %v", err)
+	}
+	if n, err := embedPending(ctx, db, small, 10); err != nil || n != 0 {
+		t.Errorf("second pass embedded %d (%v), want 0", n, err)
+	}
+
+	search := func(e Embedder, scopes *visibilityScopes, text string) string {
+		t.Helper()
+		result, err := callTool(semanticSearchHandler(db, e, nil, scopes), "semantic_search", map[string]any{"text": text, "limit": 2})
+		if err != nil || result.IsError {
+			t.Fatalf("semantic_search: %v %v", err, result.Content)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+	if got := search(small, nil, "where do the nightly backups go"); !strings.Contains(got, "--- row 1 ---\nid: ") ||
+		!strings.Contains(strings.SplitN(got, "--- row 2", 2)[0], "zfs pool") {
+		t.Errorf("expected the backup observation first, got:\n%s", got)
+	}
+	public, _ := parseVisibilityScopes("public", "")
+	if got := search(small, public, "how many disks"); strings.Contains(got, "four disks") {
+		t.Errorf("private observation returned to a public scope:\n%s", got)
+	}
+
+	// A new model leaves the old vectors unused until they are re-embedded.
+	large := localEmbedder{dims: 256}
+	if n, err := staleEmbeddings(ctx, db, large); err != nil || n < 3 {
+		t.Errorf("staleEmbeddings() = %d %v, want at least 3", n, err)
+	}
+	if got := search(large, nil, "nightly backups"); got != "no results" {
+		t.Errorf("search with a new model = %q, want no results", got)
+	}
+	if _, err := embedAll(ctx, db, large, 64); err != nil {
+		t.Fatalf("embedAll: %v", err)
+	}
+	if n, _ := staleEmbeddings(ctx, db, large); n != 0 {
+		t.Errorf("%d embeddings left from the old model", n)
+	}
+	if got := search(large, nil, "nightly backups"); !strings.Contains(got, "zfs pool") {
+		t.Errorf("expected results after re-embedding, got:\n%s", got)
+	}
+
+	// Editing an observation drops its vector.
+	if _, err := db.Exec("UPDATE observations SET content = 'embed test has six disks' WHERE content = 'embed test has four disks'"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if n, err := embedPending(ctx, db, large, 64); err != nil || n != 1 {
+		t.Errorf("embedded %d (%v) after an edit, want 1", n, err)
+	}
+
+	result, _ := callTool(semanticSearchHandler(db, nil, nil, nil), "semantic_search", map[string]any{"text": "x"})
+	if !result.IsError {
+		t.Errorf("expected an error without an embedder")
+	}
+}
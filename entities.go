@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// onConflictModes are the ways a structured insert can treat an entity name
+// that already exists: keep the existing entity, update its type, or fail.
+var onConflictModes = []string{"ignore", "update", "error"}
+
+func parseOnConflict(s string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(s))
+	if mode == "" {
+		return "ignore", nil
+	}
+	for _, m := range onConflictModes {
+		if mode == m {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown on_conflict %q, want one of: %s", s, strings.Join(onConflictModes, ", "))
+}
+
+type rowExecer interface {
+	execer
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// upsertEntity inserts an entity or, when the name is taken, resolves the
+// conflict per onConflict. A former name of a renamed entity counts as taken
+// by it. It returns the entity's id and whether it was created.
+func upsertEntity(ctx context.Context, db rowExecer, name, entityType, onConflict string) (int64, bool, error) {
+	result, err := db.ExecContext(ctx, `INSERT INTO entities (name, entity_type) SELECT ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM entity_aliases WHERE alias = ?) ON CONFLICT(name) DO NOTHING`, name, entityType, name)
+	if err != nil {
+		return 0, false, execFailure(err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		id, _ := result.LastInsertId()
+		return id, true, nil
+	}
+
+	var id int64
+	var existingType string
+	if err := db.QueryRowContext(ctx, "SELECT id, entity_type"+entityByName, name, name, name).Scan(&id, &existingType); err != nil {
+		return 0, false, fmt.Errorf("error looking up entity '%s': %v", name, err)
+	}
+	switch onConflict {
+	case "error":
+		return id, false, fmt.Errorf("entity '%s' already exists with id %d and type %s", name, id, existingType)
+	case "update":
+		if existingType != entityType {
+			if _, err := db.ExecContext(ctx, "UPDATE entities SET entity_type = ? WHERE id = ?", entityType, id); err != nil {
+				return id, false, execFailure(err)
+			}
+		}
+	}
+	return id, false, nil
+}
+
+func upsertEntityHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			return toolError(codeInvalidArgument, "name parameter is required"), nil
+		}
+		entityType := strings.TrimSpace(request.GetString("entity_type", ""))
+		if entityType == "" {
+			return toolError(codeInvalidArgument, "entity_type parameter is required"), nil
+		}
+		onConflict, err := parseOnConflict(request.GetString("on_conflict", ""))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		tagsStr := request.GetString("tags", "")
+		tagIDs, err := validateTagsFor(ctx, db, "entities", parseTagNames(tagsStr))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		template := templateFor(entityTemplates, entityType)
+		attrs, err := parseAttributesArg(template, request.GetArguments()["attributes"])
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		have := make(map[string]bool, len(attrs))
+		for _, a := range attrs {
+			have[a.name] = true
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+		id, created, err := upsertEntity(ctx, tx, name, entityType, onConflict)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if created {
+			if len(tagIDs) == 0 && requiredTags.requires("entities") {
+				return toolError(codeTagRequired, "tags parameter is required for a new entity. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+			}
+			if missing := template.missing(have, true); len(missing) > 0 {
+				return toolErrorf(codeInvalidArgument, "a new %s needs the attributes %s. Pass them in attributes", template.entityType, attributeList(missing)), nil
+			}
+			if err := linkEntityTags(ctx, tx, id, tagIDs); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to link tags: %v", err), nil
+			}
+		}
+		for _, a := range attrs {
+			if err := storeAttribute(ctx, tx, id, a.name, a.value, a.typ, ""); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to set %s: %v", a.name, err), nil
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+
+		if request.GetBool("return_record", false) {
+			record, err := loadEntityRecord(ctx, db, id, created)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "entity stored but failed to read it back: %v", err), nil
+			}
+			return graphResult(record), nil
+		}
+		// Attributes the template has but the call did not give are worth
+		// asking the user about.
+		var note string
+		if len(attrs) > 0 {
+			note = fmt.Sprintf(", %d attribute(s) set", len(attrs))
+		}
+		if missing := template.missing(have, false); created && len(missing) > 0 {
+			note += fmt.Sprintf(". Not yet known for this %s: %s; set them with set_attribute when you learn them", template.entityType, attributeList(missing))
+		}
+		switch {
+		case created:
+			if len(tagIDs) > 0 {
+				return mcp.NewToolResultText(fmt.Sprintf("success: entity %d created: %s (%s) with tags: %s%s", id, name, entityType, tagsStr, note)), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("success: entity %d created: %s (%s)%s", id, name, entityType, note)), nil
+		case onConflict == "update":
+			return mcp.NewToolResultText(fmt.Sprintf("success: entity %d already existed: %s, type set to %s%s", id, name, entityType, note)), nil
+		case len(attrs) > 0:
+			return mcp.NewToolResultText(fmt.Sprintf("success: entity %d already existed: %s%s", id, name, note)), nil
+		default:
+			return mcp.NewToolResultText(fmt.Sprintf("success: entity %d already existed: %s, left unchanged", id, name)), nil
+		}
+	}
+}
+
+func archiveEntityHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			return toolError(codeInvalidArgument, "name parameter is required"), nil
+		}
+		restore := request.GetBool("restore", false)
+
+		var id int64
+		var archivedAt sql.NullString
+		err := db.QueryRowContext(ctx, "SELECT id, archived_at FROM entities WHERE name = ?", name).Scan(&id, &archivedAt)
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "entity '%s' does not exist", name), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error looking up entity '%s': %v", name, err), nil
+		}
+
+		switch {
+		case restore && !archivedAt.Valid:
+			return mcp.NewToolResultText(fmt.Sprintf("success: entity %d (%s) is not archived", id, name)), nil
+		case !restore && archivedAt.Valid:
+			return mcp.NewToolResultText(fmt.Sprintf("success: entity %d (%s) was already archived at %s", id, name, archivedAt.String)), nil
+		}
+
+		stmt, msg := "UPDATE entities SET archived_at = CURRENT_TIMESTAMP WHERE id = ?", "archived"
+		if restore {
+			stmt, msg = "UPDATE entities SET archived_at = NULL WHERE id = ?", "restored"
+		}
+		if _, err := db.ExecContext(ctx, stmt, id); err != nil {
+			return execError(err, codeDatabase), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("success: entity %d (%s) %s", id, name, msg)), nil
+	}
+}
+
+const pinnedURI = "memory://pinned"
+
+func pinEntityHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			return toolError(codeInvalidArgument, "name parameter is required"), nil
+		}
+
+		stmt, msg := "UPDATE entities SET pinned_at = COALESCE(pinned_at, CURRENT_TIMESTAMP) WHERE name = ?", "pinned"
+		if request.GetBool("unpin", false) {
+			stmt, msg = "UPDATE entities SET pinned_at = NULL WHERE name = ?", "unpinned"
+		}
+		result, err := db.ExecContext(ctx, stmt, name)
+		if err != nil {
+			return execError(err, codeDatabase), nil
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return toolErrorf(codeNotFound, "entity '%s' does not exist", name), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("success: entity %s %s", name, msg)), nil
+	}
+}
+
+// formatPinned renders pinned entities compactly for injecting at the start
+// of a conversation: each entity with its observations as bullets, then the
+// relations between them.
+func formatPinned(graph *knowledgeGraph) string {
+	if len(graph.Entities) == 0 {
+		return "no pinned entities, pin one with pin_entity"
+	}
+	var b strings.Builder
+	for i, e := range graph.Entities {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s (%s)\n", e.Name, e.EntityType)
+		for _, o := range e.Observations {
+			fmt.Fprintf(&b, "- %s\n", strings.ReplaceAll(o, "\n", " "))
+		}
+	}
+	if len(graph.Relations) > 0 {
+		b.WriteString("\n")
+		for _, r := range graph.Relations {
+			fmt.Fprintf(&b, "%s %s %s\n", r.From, r.RelationType, r.To)
+		}
+	}
+	return b.String()
+}
+
+// registerEntityTools adds the pinned entities resource and the tools that
+// create, archive and pin entities.
+func registerEntityTools(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes, guided *guideTools) {
+	s.AddResource(mcp.NewResource(
+		pinnedURI,
+		"Pinned entities",
+		mcp.WithResourceDescription("Core entities marked with pin_entity (the user, their infrastructure, their job) with their observations and the relations between them, compact enough to include at the start of every conversation"),
+		mcp.WithMIMEType("text/plain"),
+	), pinnedHandler(db, scopes))
+
+	guided.add(s, func() server.ServerTool {
+		return server.ServerTool{Tool: mcp.NewTool("upsert_entity",
+			mcp.WithDescription(`Create an entity, or get the id of the existing one with that name.
+
+Use this instead of INSERT INTO entities: a name that is already taken returns the existing id rather than a duplicate error.`),
+			mcp.WithString("name",
+				mcp.Required(),
+				mcp.Description("Entity name"),
+			),
+			mcp.WithString("entity_type",
+				mcp.Required(),
+				mcp.Description(liveGuide.entityTypeHelp()),
+			),
+			mcp.WithString("on_conflict",
+				mcp.Description("When the name exists: 'ignore' returns it unchanged (default), 'update' sets its entity_type, 'error' fails"),
+				mcp.Enum(onConflictModes...),
+			),
+			mcp.WithString("tags",
+				mcp.Description("Comma-separated tag names for a new entity. Required when the server's tag policy covers entities; ignored when the entity exists"),
+			),
+			mcp.WithObject("attributes",
+				mcp.Description(templatesHelp(entityTemplates)),
+			),
+			mcp.WithBoolean("return_record",
+				mcp.Description(returnRecord),
+			),
+		), Handler: upsertEntityHandler(db)}
+	})
+
+	s.AddTool(mcp.NewTool("archive_entity",
+		mcp.WithDescription(`Archive an entity that is no longer current, e.g. a finished project or a former employer. Its observations and relations are kept but hidden from search_nodes, read_graph, search_metadata and memory://recent unless include_archived is set. open_nodes still returns it by name, marked with archivedAt.`),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Entity name"),
+		),
+		mcp.WithBoolean("restore",
+			mcp.Description("Unarchive the entity instead (default false)"),
+		),
+	), archiveEntityHandler(db))
+
+	s.AddTool(mcp.NewTool("pin_entity",
+		mcp.WithDescription("Pin a core entity, such as the user, their infrastructure or their job, so it is included in the memory://pinned resource that clients read at the start of a conversation."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Entity name"),
+		),
+		mcp.WithBoolean("unpin",
+			mcp.Description("Unpin the entity instead (default false)"),
+		),
+	), pinEntityHandler(db))
+}
+
+func pinnedHandler(db *sql.DB, scopes *visibilityScopes) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		graph, err := loadGraph(ctx, db, scopes.levels(ctx), graphQuery{filter: "e.pinned_at IS NOT NULL AND e.archived_at IS NULL"})
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      pinnedURI,
+				MIMEType: "text/plain",
+				Text:     formatPinned(graph),
+			},
+		}, nil
+	}
+}
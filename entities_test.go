@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseOnConflict(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "ignore", false},
+		{"Update", "update", false},
+		{" error ", "error", false},
+		{"replace", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseOnConflict(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseOnConflict(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestUpsertEntity_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'upsert-test'")
+
+	var firstID int64
+	for i, tt := range []struct {
+		entityType string
+		onConflict string
+		wantType   string
+		wantErr    bool
+	}{
+		{"Device", "", "Device", false},
+		{"Server", "ignore", "Device", false},
+		{"Server", "update", "Server", false},
+		{"Device", "error", "Server", true},
+	} {
+		result, err := callTool(upsertEntityHandler(db), "upsert_entity", map[string]any{
+			"name": "upsert-test", "entity_type": tt.entityType, "on_conflict": tt.onConflict,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError != tt.wantErr {
+			t.Fatalf("on_conflict=%q: IsError = %v, content %v", tt.onConflict, result.IsError, result.Content)
+		}
+
+		var id int64
+		var got string
+		if err := db.QueryRow("SELECT id, entity_type FROM entities WHERE name = 'upsert-test'").Scan(&id, &got); err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+		if i == 0 {
+			firstID = id
+		} else if id != firstID {
+			t.Errorf("on_conflict=%q: id changed from %d to %d", tt.onConflict, firstID, id)
+		}
+		if got != tt.wantType {
+			t.Errorf("on_conflict=%q: entity_type = %s, want %s", tt.onConflict, got, tt.wantType)
+		}
+	}
+}
+
+func TestFormatExecErrorEntityHint(t *testing.T) {
+	msg := formatExecError(errors.New("UNIQUE constraint failed: entities.name"))
+	if !strings.Contains(msg, "upsert_entity") {
+		t.Errorf("expected upsert_entity hint, got %q", msg)
+	}
+}
+
+func TestArchiveEntity_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'archive-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'archive test %'")
+
+	for _, stmt := range []string{
+		"INSERT INTO entities (name, entity_type) VALUES ('archive-test-acme', 'employer'), ('archive-test-user', 'person')",
+		`INSERT INTO observations (entity_id, content, metadata) SELECT id, 'archive test worked on billing', '{"archive_test": 1}'
+			FROM entities WHERE name = 'archive-test-acme'`,
+		`INSERT INTO relations (from_id, to_id, relation_type) SELECT u.id, a.id, 'worked_at' FROM entities u, entities a
+			WHERE u.name = 'archive-test-user' AND a.name = 'archive-test-acme'`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	archive := func(args map[string]any) string {
+		t.Helper()
+		result, err := callTool(archiveEntityHandler(db), "archive_entity", args)
+		if err != nil || result.IsError {
+			t.Fatalf("archive_entity: %v %v", err, result.Content)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+	text := func(handler func() (*mcp.CallToolResult, error)) string {
+		t.Helper()
+		result, err := handler()
+		if err != nil || result.IsError {
+			t.Fatalf("unexpected error: %v %v", err, result.Content)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+	search := func(args map[string]any) string {
+		return text(func() (*mcp.CallToolResult, error) {
+			return callTool(searchNodesHandler(db, nil), "search_nodes", args)
+		})
+	}
+	readGraph := func(args map[string]any) string {
+		return text(func() (*mcp.CallToolResult, error) { return callTool(readGraphHandler(db, nil), "read_graph", args) })
+	}
+	searchMetadata := func(args map[string]any) string {
+		args["filters"] = map[string]any{"archive_test": float64(1)}
+		return text(func() (*mcp.CallToolResult, error) {
+			return callTool(searchMetadataHandler(db, nil), "search_metadata", args)
+		})
+	}
+
+	if got := archive(map[string]any{"name": "archive-test-acme"}); !strings.Contains(got, "archived") {
+		t.Errorf("archive_entity = %q", got)
+	}
+	if got := archive(map[string]any{"name": "archive-test-acme"}); !strings.Contains(got, "already archived") {
+		t.Errorf("second archive_entity = %q", got)
+	}
+	if result, _ := callTool(archiveEntityHandler(db), "archive_entity", map[string]any{"name": "archive-test-missing"}); !result.IsError {
+		t.Error("expected an error for a missing entity")
+	}
+
+	t.Run("hidden by default", func(t *testing.T) {
+		if got := search(map[string]any{"query": "archive test"}); strings.Contains(got, "archive-test-acme") {
+			t.Errorf("search_nodes returned the archived entity: %s", got)
+		}
+		if got := readGraph(map[string]any{"entity_type": "employer,person"}); strings.Contains(got, "archive-test-acme") {
+			t.Errorf("read_graph returned the archived entity or a relation to it: %s", got)
+		}
+		if got := searchMetadata(map[string]any{}); got != "no results" {
+			t.Errorf("search_metadata = %s", got)
+		}
+	})
+
+	t.Run("include_archived", func(t *testing.T) {
+		if got := search(map[string]any{"query": "archive test", "include_archived": true}); !strings.Contains(got, `"archivedAt"`) {
+			t.Errorf("search_nodes = %s", got)
+		}
+		if got := readGraph(map[string]any{"entity_type": "employer,person", "include_archived": true}); !strings.Contains(got, "worked_at") {
+			t.Errorf("read_graph = %s", got)
+		}
+		if got := searchMetadata(map[string]any{"include_archived": true}); !strings.Contains(got, "billing") {
+			t.Errorf("search_metadata = %s", got)
+		}
+	})
+
+	t.Run("open_nodes by name", func(t *testing.T) {
+		result, _ := callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": []any{"archive-test-acme"}})
+		var opened openedNodes
+		decodeResult(t, result, &opened)
+		if len(opened.Entities) != 1 || opened.Entities[0].ArchivedAt == "" {
+			t.Errorf("open_nodes = %+v", opened)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		archive(map[string]any{"name": "archive-test-acme", "restore": true})
+		if got := search(map[string]any{"query": "archive test"}); !strings.Contains(got, "archive-test-acme") {
+			t.Errorf("restored entity missing from search_nodes: %s", got)
+		}
+	})
+}
+
+func TestFormatPinned(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph knowledgeGraph
+		want  string
+	}{
+		{"empty", knowledgeGraph{}, "no pinned entities, pin one with pin_entity"},
+		{"entities and relations", knowledgeGraph{
+			Entities: []graphEntity{
+				{Name: "me", EntityType: "person", Observations: []string{"lives in Nairobi", "uses\nneovim"}},
+				{Name: "acme", EntityType: "employer", Observations: []string{}},
+			},
+			Relations: []graphRelation{{From: "me", To: "acme", RelationType: "works_at"}},
+		}, "me (person)\n- lives in Nairobi\n- uses neovim\n\nacme (employer)\n\nme works_at acme\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatPinned(&tt.graph); got != tt.want {
+				t.Errorf("formatPinned() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPinEntity_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'pin-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'pin test %'")
+
+	for _, stmt := range []string{
+		"INSERT INTO entities (name, entity_type) VALUES ('pin-test-me', 'person'), ('pin-test-nas', 'device')",
+		"INSERT INTO observations (entity_id, content, visibility) SELECT id, 'pin test prefers go', 'public' FROM entities WHERE name = 'pin-test-me'",
+		"INSERT INTO observations (entity_id, content, visibility) SELECT id, 'pin test salary is private', 'private' FROM entities WHERE name = 'pin-test-me'",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	pin := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		result, err := callTool(pinEntityHandler(db), "pin_entity", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+	read := func(scope string) string {
+		t.Helper()
+		var scopes *visibilityScopes
+		if scope != "" {
+			var err error
+			if scopes, err = parseVisibilityScopes(scope, ""); err != nil {
+				t.Fatalf("parseVisibilityScopes: %v", err)
+			}
+		}
+		contents, err := pinnedHandler(db, scopes)(context.Background(), mcp.ReadResourceRequest{})
+		if err != nil {
+			t.Fatalf("read %s: %v", pinnedURI, err)
+		}
+		return contents[0].(mcp.TextResourceContents).Text
+	}
+
+	if result := pin(map[string]any{"name": "pin-test-missing"}); !result.IsError {
+		t.Error("expected an error for a missing entity")
+	}
+	if result := pin(map[string]any{"name": "pin-test-me"}); result.IsError {
+		t.Fatalf("pin_entity: %v", result.Content)
+	}
+
+	got := read("")
+	if !strings.Contains(got, "pin-test-me (person)\n") || !strings.Contains(got, "- pin test prefers go\n") {
+		t.Errorf("pinned = %q", got)
+	}
+	if strings.Contains(got, "pin-test-nas") {
+		t.Errorf("unpinned entity in %q", got)
+	}
+	if got := read("public"); strings.Contains(got, "salary") {
+		t.Errorf("private observation in %q", got)
+	}
+
+	pin(map[string]any{"name": "pin-test-me", "unpin": true})
+	if got := read(""); strings.Contains(got, "pin-test-me") {
+		t.Errorf("unpinned entity in %q", got)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Tool error codes. Every tool error carries one, in structuredContent and
+// at the start of its text, so clients can branch on the kind of failure
+// without parsing the message. A code keeps its meaning once released;
+// new failures get new codes.
+const (
+	// A parameter is missing, malformed or out of range.
+	codeInvalidArgument = "ERR_INVALID_ARGUMENT"
+	// The entity, observation, reminder or other row named does not exist.
+	codeNotFound = "ERR_NOT_FOUND"
+	// The row is not in a state that allows the change, e.g. already done.
+	codeConflict = "ERR_CONFLICT"
+	// A tag named is not in the tags table.
+	codeUnknownTag = "ERR_UNKNOWN_TAG"
+	// The write needs tags it was not given (tag policy or the tags
+	// parameter).
+	codeTagRequired = "ERR_TAG_REQUIRED"
+	// A tag named is outside the client's namespace.
+	codeTagNotAllowed = "ERR_TAG_NOT_ALLOWED"
+	// The write would take a tag over its storage quota.
+	codeQuotaExceeded = "ERR_QUOTA_EXCEEDED"
+	// query or another read-only tool was given a write.
+	codeWriteInQuery = "ERR_WRITE_IN_QUERY"
+	// execute was given something other than a write.
+	codeReadInExecute = "ERR_READ_IN_EXECUTE"
+	// The statement uses DDL, ATTACH or another blocked operation.
+	codeForbiddenSQL = "ERR_FORBIDDEN_SQL"
+	// The statement does not parse or names missing tables or columns.
+	codeInvalidSQL = "ERR_INVALID_SQL"
+	// The statement writes to a table outside ENGRAM_WRITABLE_TABLES.
+	codeTableNotWritable = "ERR_TABLE_NOT_WRITABLE"
+	// The write touches more rows than allowed without confirm: true.
+	codeConfirmationRequired = "ERR_CONFIRMATION_REQUIRED"
+	// A UNIQUE, FOREIGN KEY, CHECK or NOT NULL constraint failed.
+	codeConstraintUnique     = "ERR_CONSTRAINT_UNIQUE"
+	codeConstraintForeignKey = "ERR_CONSTRAINT_FOREIGN_KEY"
+	codeConstraintCheck      = "ERR_CONSTRAINT_CHECK"
+	codeConstraintNotNull    = "ERR_CONSTRAINT_NOT_NULL"
+	// The content looks like it holds a secret.
+	codeSecretDetected = "ERR_SECRET_DETECTED"
+	// The tool is not enabled for this client.
+	codeToolDisabled = "ERR_TOOL_DISABLED"
+	// The feature the call needs is not configured, e.g. semantic search
+	// without an embedder.
+	codeUnavailable = "ERR_UNAVAILABLE"
+	// A page, embedder or model the call depends on failed.
+	codeUpstream = "ERR_UPSTREAM"
+	// The database failed; the call may succeed if retried.
+	codeDatabase = "ERR_DATABASE"
+)
+
+// retryable reports whether a call that failed with code may succeed if
+// made again unchanged: the database or a service it depends on failed,
+// rather than the call itself being wrong.
+func retryable(code string) bool {
+	return code == codeDatabase || code == codeUpstream
+}
+
+// transientMessages are failures the libsql driver reports as text, often
+// after the error chain is lost, that pass once the server or network
+// recovers.
+var transientMessages = []string{
+	"database is locked",
+	"SQLITE_BUSY",
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"i/o timeout",
+	"stream is closed",
+	"bad connection",
+	"deadline exceeded",
+	"unexpected EOF",
+	"error code 429",
+	"error code 502",
+	"error code 503",
+	"error code 504",
+}
+
+// transient reports whether err is a network or database hiccup rather
+// than a problem with the call.
+func transient(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// codedError is an error with a tool error code, returned by helpers whose
+// failures a handler passes on as they are.
+type codedError struct {
+	code string
+	msg  string
+}
+
+func (e *codedError) Error() string { return e.msg }
+
+func errorf(code, format string, args ...any) error {
+	return &codedError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// errorCode returns err's code: its own for a codedError, ERR_DATABASE for
+// a transient failure, the constraint's for a SQLite constraint failure,
+// otherwise fallback.
+func errorCode(err error, fallback string) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	var unconfirmed *unconfirmedError
+	if errors.As(err, &unconfirmed) {
+		return codeConfirmationRequired
+	}
+	if transient(err) {
+		return codeDatabase
+	}
+	if code := constraintCode(err); code != "" {
+		return code
+	}
+	return fallback
+}
+
+// constraintCode maps a SQLite constraint failure to its code. The libsql
+// HTTP driver passes SQLite's message on as text, so this matches on it.
+func constraintCode(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "UNIQUE constraint failed"):
+		return codeConstraintUnique
+	case strings.Contains(msg, "FOREIGN KEY constraint failed"):
+		return codeConstraintForeignKey
+	case strings.Contains(msg, "CHECK constraint failed"):
+		return codeConstraintCheck
+	case strings.Contains(msg, "NOT NULL constraint failed"):
+		return codeConstraintNotNull
+	}
+	return ""
+}
+
+// toolError is the result of a failed tool call: the code, then msg. Its
+// structured content also says whether the call is worth retrying.
+func toolError(code, msg string) *mcp.CallToolResult {
+	result := mcp.NewToolResultError(code + ": " + msg)
+	result.StructuredContent = map[string]any{"error": map[string]any{
+		"code":      code,
+		"message":   msg,
+		"retryable": retryable(code),
+	}}
+	return result
+}
+
+func toolErrorf(code, format string, args ...any) *mcp.CallToolResult {
+	return toolError(code, fmt.Sprintf(format, args...))
+}
+
+// toolErrorFrom reports err with its own code, or fallback when it has none.
+func toolErrorFrom(err error, fallback string) *mcp.CallToolResult {
+	return toolError(errorCode(err, fallback), err.Error())
+}
+
+// resultErrorCode returns the code of a failed tool result, or "" if it
+// has none.
+func resultErrorCode(result *mcp.CallToolResult) string {
+	if result == nil || !result.IsError {
+		return ""
+	}
+	if m, ok := result.StructuredContent.(map[string]any); ok {
+		if e, ok := m["error"].(map[string]any); ok {
+			code, _ := e["code"].(string)
+			return code
+		}
+	}
+	return ""
+}
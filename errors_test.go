@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"coded", errorf(codeUnknownTag, "unknown tag(s): x"), codeUnknownTag},
+		{"wrapped", fmt.Errorf("creating tag 'x': %w", errorf(codeConstraintUnique, "duplicate entry")), codeConstraintUnique},
+		{"unconfirmed", &unconfirmedError{affected: 50}, codeConfirmationRequired},
+		{"unique", errors.New("SQLite error: UNIQUE constraint failed: entities.name"), codeConstraintUnique},
+		{"foreign key", errors.New("FOREIGN KEY constraint failed"), codeConstraintForeignKey},
+		{"check", errors.New("CHECK constraint failed: length(trim(name)) > 0"), codeConstraintCheck},
+		{"not null", errors.New("NOT NULL constraint failed: observations.content"), codeConstraintNotNull},
+		{"busy", errors.New("failed to execute SQL: UPDATE tags SET name = 'x'\nSQLITE_BUSY: database is locked"), codeDatabase},
+		{"network", fmt.Errorf("query error: %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), codeDatabase},
+		{"timeout", fmt.Errorf("search failed: %w", context.DeadlineExceeded), codeDatabase},
+		{"bad gateway", errors.New("failed to execute SQL:\nerror code 502: upstream"), codeDatabase},
+		{"other", errors.New("no such column: foo"), codeInvalidSQL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err, codeInvalidSQL); got != tt.want {
+				t.Errorf("errorCode = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolError(t *testing.T) {
+	result := toolErrorFrom(execFailure(errors.New("UNIQUE constraint failed: entities.name")), codeDatabase)
+	if !result.IsError || resultErrorCode(result) != codeConstraintUnique {
+		t.Fatalf("result = %+v", result)
+	}
+	if text := resultText(result); !strings.HasPrefix(text, "ERR_CONSTRAINT_UNIQUE: duplicate entry: ") {
+		t.Errorf("text = %q", text)
+	}
+	e := result.StructuredContent.(map[string]any)["error"].(map[string]any)
+	if msg := e["message"].(string); !strings.HasPrefix(msg, "duplicate entry: ") || strings.Contains(msg, "ERR_") {
+		t.Errorf("structured error = %v", e)
+	}
+	if e["retryable"] != false {
+		t.Errorf("constraint failure retryable = %v", e["retryable"])
+	}
+
+	result = toolErrorFrom(errors.New("failed to execute SQL:\nstream is closed: driver: bad connection"), codeInvalidSQL)
+	e = result.StructuredContent.(map[string]any)["error"].(map[string]any)
+	if e["code"] != codeDatabase || e["retryable"] != true {
+		t.Errorf("transient failure = %v", e)
+	}
+}
+
+func TestValidateSQLCodes(t *testing.T) {
+	tests := []struct {
+		sql        string
+		allowWrite bool
+		want       string
+	}{
+		{"DROP TABLE tags", true, codeForbiddenSQL},
+		{"DELETE FROM tags WHERE id = 1", false, codeWriteInQuery},
+		{"SELECT 1", true, codeReadInExecute},
+	}
+	for _, tt := range tests {
+		if got := errorCode(validateSQL(tt.sql, tt.allowWrite), ""); got != tt.want {
+			t.Errorf("validateSQL(%q) code = %s, want %s", tt.sql, got, tt.want)
+		}
+	}
+	if err := checkWideWrite("DELETE FROM tags", false); errorCode(err, "") != codeConfirmationRequired {
+		t.Errorf("checkWideWrite code = %s", errorCode(err, ""))
+	}
+	if err := checkWritable("DELETE FROM tags WHERE id = 1", parseTableList("observations")); errorCode(err, "") != codeTableNotWritable {
+		t.Errorf("checkWritable code = %s", errorCode(err, ""))
+	}
+}
+
+func TestToolErrorCodes_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]any
+		want string
+	}{
+		{"unknown tag", "execute", map[string]any{
+			"sql":  "INSERT INTO observations (entity_id, content) VALUES (1, 'error code test')",
+			"tags": "no-such-tag-9931",
+		}, codeUnknownTag},
+		{"write in query", "query", map[string]any{"sql": "DELETE FROM tags WHERE id = -1"}, codeWriteInQuery},
+		{"duplicate tag", "execute", map[string]any{"sql": "INSERT INTO tags (name, description) VALUES ('homelab', 'again')"}, codeConstraintUnique},
+		{"missing column", "execute", map[string]any{"sql": "UPDATE tags SET no_such_column = 1 WHERE id = -1"}, codeInvalidSQL},
+		{"required", "query", map[string]any{}, codeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := executeHandler(db, nil, nil)
+			if tt.tool == "query" {
+				handler = queryHandler(db, nil, nil)
+			}
+			result, err := callTool(handler, tt.tool, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultErrorCode(result); got != tt.want {
+				t.Errorf("code = %q, want %s (%s)", got, tt.want, resultText(result))
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// formatPlan renders EXPLAIN QUERY PLAN rows as an indented tree, the way
+// the sqlite3 shell's .eqp does.
+func formatPlan(results []map[string]any) string {
+	depth := make(map[int64]int)
+	var sb strings.Builder
+	for _, row := range results {
+		id, _ := row["id"].(int64)
+		parent, _ := row["parent"].(int64)
+		d := 0
+		if parent != 0 {
+			d = depth[parent] + 1
+		}
+		depth[id] = d
+		fmt.Fprintf(&sb, "%s%s\n", strings.Repeat("  ", d+1), formatValue(row["detail"]))
+	}
+	return sb.String()
+}
+
+// registerValidateQuery adds the validate_query tool.
+func registerValidateQuery(s *server.MCPServer, db *sql.DB, snaps *snapshots, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("validate_query",
+		mcp.WithDescription(`Check a SELECT query without fetching any rows: reports syntax and schema errors, the columns it would return and SQLite's query plan.
+
+Use it to iterate on a complex query cheaply before running it with query. "SCAN" in the plan means a full table scan; "SEARCH ... USING INDEX" means an index is used.`),
+		mcp.WithString("sql",
+			mcp.Required(),
+			mcp.Description("SQL SELECT statement to check"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), validateQueryHandler(db, snaps, scopes))
+}
+
+func validateQueryHandler(db *sql.DB, snaps *snapshots, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sqlStr := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(request.GetString("sql", "")), ";"))
+		if sqlStr == "" {
+			return toolError(codeInvalidArgument, "sql parameter is required"), nil
+		}
+		if err := validateSQL(sqlStr, false); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		q, err := snaps.reader(ctx, db)
+		if err != nil {
+			return toolErrorFrom(err, codeDatabase), nil
+		}
+		if levels := scopes.levels(ctx); restricted(levels) {
+			scoped, err := scopeStatement(ctx, q, sqlStr, levels)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeInvalidSQL), "invalid query: %v", err), nil
+			}
+			sqlStr = scoped
+		}
+
+		// LIMIT 0 makes SQLite prepare the statement and report its columns
+		// without producing a row.
+		cols, _, err := runQuery(ctx, q, "SELECT * FROM ("+sqlStr+") LIMIT 0")
+		if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "invalid query: %v", strings.TrimPrefix(err.Error(), "query error: ")), nil
+		}
+		_, plan, err := runQuery(ctx, q, "EXPLAIN QUERY PLAN "+sqlStr)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "invalid query: %v", strings.TrimPrefix(err.Error(), "query error: ")), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("valid: the query returns %d columns: %s\n\nplan:\n%s",
+			len(cols), strings.Join(cols, ", "), formatPlan(plan))), nil
+	}
+}
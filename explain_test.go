@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestFormatPlan(t *testing.T) {
+	plan := []map[string]any{
+		{"id": int64(2), "parent": int64(0), "detail": "SCAN e"},
+		{"id": int64(5), "parent": int64(0), "detail": "CORRELATED SCALAR SUBQUERY 1"},
+		{"id": int64(9), "parent": int64(5), "detail": "SEARCH o USING INDEX observations_entity_id (entity_id=?)"},
+	}
+	want := "  SCAN e\n  CORRELATED SCALAR SUBQUERY 1\n    SEARCH o USING INDEX observations_entity_id (entity_id=?)\n"
+	if got := formatPlan(plan); got != want {
+		t.Errorf("formatPlan() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateQuery_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		sql     string
+		want    []string
+		wantErr string
+	}{
+		{"valid", "SELECT e.name, count(o.id) AS n FROM entities e LEFT JOIN observations o ON o.entity_id = e.id GROUP BY e.id;",
+			[]string{"returns 2 columns: name, n", "plan:\n", "SCAN"}, ""},
+		{"with clause", "WITH t AS (SELECT name FROM tags) SELECT name FROM t", []string{"returns 1 columns: name"}, ""},
+		{"syntax error", "SELECT name FROM entities WHERE", nil, "invalid query"},
+		{"unknown column", "SELECT nickname FROM entities", nil, "no such column"},
+		{"write", "DELETE FROM entities", nil, "write operations not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := callTool(validateQueryHandler(db, nil, nil), "validate_query", map[string]any{"sql": tt.sql})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			text := result.Content[0].(mcp.TextContent).Text
+			if result.IsError != (tt.wantErr != "") || !strings.Contains(text, tt.wantErr) {
+				t.Fatalf("IsError = %v, want error %q: %s", result.IsError, tt.wantErr, text)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(text, w) {
+					t.Errorf("expected %q in %s", w, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// exportFormats maps the export -format values to the column separator of
+// the flattened observation rows; json keeps the nested document.
+var exportFormats = map[string]rune{"json": 0, "csv": ',', "tsv": '\t'}
+
+type exportDoc struct {
+	ExportedAt string           `json:"exported_at"`
+	Tags       []exportTag      `json:"tags"`
+	Entities   []exportEntity   `json:"entities"`
+	Relations  []exportRelation `json:"relations"`
+}
+
+type exportTag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type exportEntity struct {
+	Name         string              `json:"name"`
+	EntityType   string              `json:"entity_type"`
+	CreatedAt    string              `json:"created_at,omitempty"`
+	Observations []exportObservation `json:"observations"`
+}
+
+type exportObservation struct {
+	Content        string   `json:"content"`
+	Visibility     string   `json:"visibility"`
+	Tags           []string `json:"tags"`
+	Source         string   `json:"source,omitempty"`
+	ConversationID string   `json:"conversation_id,omitempty"`
+	SourceURL      string   `json:"source_url,omitempty"`
+	CreatedAt      string   `json:"created_at,omitempty"`
+}
+
+type exportRelation struct {
+	From         string          `json:"from"`
+	To           string          `json:"to"`
+	RelationType string          `json:"relation_type"`
+	Weight       *float64        `json:"weight,omitempty"`
+	Properties   json.RawMessage `json:"properties,omitempty"`
+	CreatedAt    string          `json:"created_at,omitempty"`
+}
+
+// writeExport writes the memory graph as JSON, keyed by entity names rather
+// than ids so it can be read or re-imported independently of the database.
+func writeExport(ctx context.Context, db *sql.DB, w io.Writer) error {
+	doc, err := buildExport(ctx, db)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// writeExportRows writes one row per observation (entity, entity_type,
+// content, tags, created_at) for spreadsheets and pandas, separated by comma.
+func writeExportRows(ctx context.Context, db *sql.DB, w io.Writer, comma rune) error {
+	doc, err := buildExport(ctx, db)
+	if err != nil {
+		return err
+	}
+	return writeObservationRows(doc, w, comma)
+}
+
+func writeObservationRows(doc *exportDoc, w io.Writer, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write([]string{"entity", "entity_type", "content", "tags", "created_at"}); err != nil {
+		return err
+	}
+	for _, e := range doc.Entities {
+		for _, o := range e.Observations {
+			if err := cw.Write([]string{e.Name, e.EntityType, o.Content, strings.Join(o.Tags, ","), o.CreatedAt}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func buildExport(ctx context.Context, db *sql.DB) (*exportDoc, error) {
+	doc := &exportDoc{
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Tags:       []exportTag{},
+		Entities:   []exportEntity{},
+		Relations:  []exportRelation{},
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT name, description FROM tags ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("tags: %v", err)
+	}
+	for rows.Next() {
+		var t exportTag
+		if err := rows.Scan(&t.Name, &t.Description); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		doc.Tags = append(doc.Tags, t)
+	}
+	rows.Close()
+
+	index := make(map[int64]int)
+	rows, err = db.QueryContext(ctx, "SELECT id, name, entity_type, created_at FROM entities ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("entities: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		var e exportEntity
+		var createdAt sql.NullString
+		if err := rows.Scan(&id, &e.Name, &e.EntityType, &createdAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.CreatedAt = createdAt.String
+		e.Observations = []exportObservation{}
+		index[id] = len(doc.Entities)
+		doc.Entities = append(doc.Entities, e)
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `SELECT o.entity_id, o.content, o.visibility,
+		COALESCE(o.source, ''), COALESCE(o.conversation_id, ''), COALESCE(o.source_url, ''), o.created_at,
+		COALESCE((SELECT json_group_array(t.name) FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), '[]')
+		FROM observations o ORDER BY o.id`)
+	if err != nil {
+		return nil, fmt.Errorf("observations: %v", err)
+	}
+	for rows.Next() {
+		var entityID int64
+		var o exportObservation
+		var createdAt sql.NullString
+		var tags string
+		if err := rows.Scan(&entityID, &o.Content, &o.Visibility, &o.Source, &o.ConversationID, &o.SourceURL, &createdAt, &tags); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		o.CreatedAt = createdAt.String
+		if err := json.Unmarshal([]byte(tags), &o.Tags); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("observation tags: %v", err)
+		}
+		i, ok := index[entityID]
+		if !ok {
+			continue
+		}
+		doc.Entities[i].Observations = append(doc.Entities[i].Observations, o)
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `SELECT f.name, t.name, r.relation_type, r.weight, r.properties, r.created_at
+		FROM relations r
+		JOIN entities f ON f.id = r.from_id
+		JOIN entities t ON t.id = r.to_id
+		ORDER BY r.id`)
+	if err != nil {
+		return nil, fmt.Errorf("relations: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r exportRelation
+		var weight sql.NullFloat64
+		var properties, createdAt sql.NullString
+		if err := rows.Scan(&r.From, &r.To, &r.RelationType, &weight, &properties, &createdAt); err != nil {
+			return nil, err
+		}
+		if weight.Valid {
+			r.Weight = &weight.Float64
+		}
+		if properties.Valid {
+			r.Properties = json.RawMessage(properties.String)
+		}
+		r.CreatedAt = createdAt.String
+		doc.Relations = append(doc.Relations, r)
+	}
+	return doc, rows.Err()
+}
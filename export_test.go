@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteObservationRows(t *testing.T) {
+	doc := &exportDoc{Entities: []exportEntity{
+		{Name: "nas", EntityType: "Device", Observations: []exportObservation{
+			{Content: "Runs TrueNAS, 4x8TB", Tags: []string{"homelab", "personal"}, CreatedAt: "2024-05-01 10:00:00"},
+			{Content: "Backs up \"photos\"\tnightly", Tags: []string{}},
+		}},
+		{Name: "acme", EntityType: "Company", Observations: []exportObservation{}},
+	}}
+
+	tests := []struct {
+		name  string
+		comma rune
+		want  string
+	}{
+		{"csv", ',', "entity,entity_type,content,tags,created_at\n" +
+			"nas,Device,\"Runs TrueNAS, 4x8TB\",\"homelab,personal\",2024-05-01 10:00:00\n" +
+			"nas,Device,\"Backs up \"\"photos\"\"\tnightly\",,\n"},
+		{"tsv", '\t', "entity\tentity_type\tcontent\ttags\tcreated_at\n" +
+			"nas\tDevice\tRuns TrueNAS, 4x8TB\thomelab,personal\t2024-05-01 10:00:00\n" +
+			"nas\tDevice\t\"Backs up \"\"photos\"\"\tnightly\"\t\t\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeObservationRows(doc, &buf, tt.comma); err != nil {
+				t.Fatalf("writeObservationRows: %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("writeObservationRows() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteExport_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	result, err := callExecuteWithTags(db, "INSERT INTO observations (entity_id, content) VALUES (1, 'export test observation 86420')", "homelab,career")
+	if err != nil || result.IsError {
+		t.Fatalf("insert observation failed: %v %v", err, result)
+	}
+	defer callExecute(db, "DELETE FROM observations WHERE content = 'export test observation 86420'")
+
+	var buf bytes.Buffer
+	if err := writeExport(context.Background(), db, &buf); err != nil {
+		t.Fatalf("writeExport: %v", err)
+	}
+
+	var doc exportDoc
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if len(doc.Tags) == 0 || len(doc.Entities) == 0 {
+		t.Fatalf("export missing tags or entities: %+v", doc)
+	}
+
+	for _, e := range doc.Entities {
+		for _, o := range e.Observations {
+			if o.Content != "export test observation 86420" {
+				continue
+			}
+			if len(o.Tags) != 2 {
+				t.Errorf("expected 2 tags on exported observation, got %v", o.Tags)
+			}
+			return
+		}
+	}
+	t.Fatal("exported observation not found")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// parseCitation reads an observation id given as a cite ("obs:12") or a
+// bare number.
+func parseCitation(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	id, err := strconv.ParseInt(strings.TrimPrefix(s, "obs:"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid cite %q, want an ask_memory cite such as obs:12", s)
+	}
+	return id, nil
+}
+
+// feedbackBoost turns the net votes on an observation into a fusion score
+// adjustment. One vote is worth a first place in one search list; more
+// votes approach two, enough to lift a passage over one both searches put
+// first or to sink that one.
+func feedbackBoost(net int) float64 {
+	if net == 0 {
+		return 0
+	}
+	abs := net
+	if abs < 0 {
+		abs = -abs
+	}
+	return 2 * float64(net) / float64(abs+1) / float64(rrfK+1)
+}
+
+// feedbackScores returns the net votes (helpful minus irrelevant) on each
+// of ids that has any.
+func feedbackScores(ctx context.Context, q queryer, ids []int64) (map[int64]int, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.QueryContext(ctx, `SELECT observation_id, SUM(CASE WHEN helpful = 1 THEN 1 ELSE -1 END) FROM recall_feedback
+		WHERE observation_id IN (`+placeholders(len(ids))+`) GROUP BY observation_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	scores := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var net int
+		if err := rows.Scan(&id, &net); err != nil {
+			return nil, err
+		}
+		if net != 0 {
+			scores[id] = net
+		}
+	}
+	return scores, rows.Err()
+}
+
+// registerFeedback adds the feedback tool.
+func registerFeedback(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("feedback",
+		mcp.WithDescription(`Tell memory which ask_memory passages helped and which did not. Votes are kept and move those passages up or down in later ask_memory rankings.
+
+Give feedback after answering from the passages, using their cite ids.`),
+		mcp.WithArray("helpful",
+			mcp.Description("Cites of passages that helped answer, e.g. ['obs:12']"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("irrelevant",
+			mcp.Description("Cites of passages that did not help"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("question",
+			mcp.Description("The question the passages were recalled for, kept with the votes"),
+		),
+	), feedbackHandler(db, scopes))
+}
+
+func feedbackHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		type vote struct {
+			cite    string
+			helpful bool
+		}
+		var votes []vote
+		for _, c := range request.GetStringSlice("helpful", nil) {
+			votes = append(votes, vote{c, true})
+		}
+		for _, c := range request.GetStringSlice("irrelevant", nil) {
+			votes = append(votes, vote{c, false})
+		}
+		if len(votes) == 0 {
+			return toolError(codeInvalidArgument, "give the cites of the passages that helped in helpful, or of those that did not in irrelevant"), nil
+		}
+		question := strings.TrimSpace(request.GetString("question", ""))
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		levels := scopes.levels(ctx)
+		var sb strings.Builder
+		recorded := 0
+		for _, v := range votes {
+			id, err := parseCitation(v.cite)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			var n int
+			if err := tx.QueryRowContext(ctx, restrictVisibility("SELECT count(*) FROM observations o WHERE o.id = ?", levels), id).Scan(&n); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to look up %s: %v", citation(id), err), nil
+			}
+			if n == 0 {
+				fmt.Fprintf(&sb, "%s: not found, skipped\n", citation(id))
+				continue
+			}
+			helpful := 0
+			if v.helpful {
+				helpful = 1
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO recall_feedback (observation_id, helpful, question) VALUES (?, ?, NULLIF(?, ''))", id, helpful, question); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to record feedback on %s: %v", citation(id), err), nil
+			}
+			recorded++
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+		fmt.Fprintf(&sb, "recorded %d votes; ask_memory ranks these passages accordingly from now on", recorded)
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseCitation(t *testing.T) {
+	tests := []struct {
+		cite    string
+		want    int64
+		wantErr bool
+	}{
+		{"obs:12", 12, false},
+		{" 7 ", 7, false},
+		{"obs:", 0, true},
+		{"obs:-3", 0, true},
+		{"rel:4", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCitation(tt.cite)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseCitation(%q) = %d, %v", tt.cite, got, err)
+		}
+	}
+}
+
+func TestFuseRankingsWithFeedback(t *testing.T) {
+	lists := map[string][]int64{
+		"keyword":  {1, 2, 3},
+		"semantic": {1, 4},
+	}
+	// 1 tops both lists; two irrelevant votes sink it below 2 and 4, and a
+	// helpful vote lifts 3 from last to first.
+	ids, _ := fuseRankings(lists, map[int64]int{1: -2, 3: 1, 9: 5}, 4)
+	if want := []int64{3, 4, 2, 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("fuseRankings() = %v, want %v", ids, want)
+	}
+	if feedbackBoost(0) != 0 || feedbackBoost(-3) != -feedbackBoost(3) || feedbackBoost(100) >= 2.0/(rrfK+1) {
+		t.Error("feedbackBoost should be zero without votes, symmetric and bounded by two first places")
+	}
+}
+
+func TestFeedback_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'feedback-test-router'")
+
+	result, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('feedback-test-router', 'device')")
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	entityID, _ := result.LastInsertId()
+	var ids []int64
+	for _, content := range []string{"feedback test router firmware is 7.1", "feedback test router sits in the hallway"} {
+		result, err := db.Exec("INSERT INTO observations (entity_id, content) VALUES (?, ?)", entityID, content)
+		if err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		ids = append(ids, id)
+	}
+	defer db.Exec("DELETE FROM recall_feedback WHERE observation_id IN (?, ?)", ids[0], ids[1])
+
+	ask := func() []string {
+		t.Helper()
+		result, err := callTool(askMemoryHandler(db, nil, nil, nil, nil), "ask_memory", map[string]any{"question": "feedback-test-router firmware"})
+		if err != nil || result.IsError {
+			t.Fatalf("ask_memory: %v %v", err, result.Content)
+		}
+		var got askResult
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var cites []string
+		for _, p := range got.Passages {
+			cites = append(cites, p.Cite)
+		}
+		return cites
+	}
+	if got := ask(); len(got) < 2 || got[0] != citation(ids[0]) {
+		t.Fatalf("before feedback = %v, want %s first", got, citation(ids[0]))
+	}
+
+	result2, err := callTool(feedbackHandler(db, nil), "feedback", map[string]any{
+		"helpful":    []any{citation(ids[1]), "999999999"},
+		"irrelevant": []any{citation(ids[0])},
+		"question":   "what firmware does the router run",
+	})
+	if err != nil || result2.IsError {
+		t.Fatalf("feedback: %v %v", err, result2.Content)
+	}
+	if text := result2.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "obs:999999999: not found") || !strings.Contains(text, "recorded 2 votes") {
+		t.Errorf("feedback = %s", text)
+	}
+	if got := ask(); len(got) < 2 || got[0] != citation(ids[1]) {
+		t.Errorf("after feedback = %v, want %s first", got, citation(ids[1]))
+	}
+
+	for _, args := range []map[string]any{{}, {"helpful": []any{"obs:x"}}} {
+		if result, _ := callTool(feedbackHandler(db, nil), "feedback", args); !result.IsError {
+			t.Errorf("feedback %v: expected an error", args)
+		}
+	}
+}
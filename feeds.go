@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// feedsConfig is ENGRAM_FEEDS: comma-separated tag=URL sources pulled
+	// into memory, items from each tagged with its tag, as in
+	// "news=https://hnrss.org/frontpage,mail=imaps://me@example.com/INBOX".
+	feedsConfig = getEnv("ENGRAM_FEEDS", "")
+	// feedMinutes is how often serve pulls the feeds; 0 disables.
+	feedMinutes = getEnvInt("ENGRAM_FEED_MINUTES", 60)
+	// imapPassword is used for IMAP sources whose URL has no password.
+	imapPassword = getEnv("ENGRAM_IMAP_PASSWORD", "")
+)
+
+// feeds are the parsed ENGRAM_FEEDS. serve refuses to start when feedsErr is
+// set.
+var feeds, feedsErr = parseFeeds(feedsConfig)
+
+const (
+	// maxFeedItems caps the items taken from a source per pull, newest first.
+	maxFeedItems   = 20
+	maxFeedSummary = 400
+	feedTimeout    = 60 * time.Second
+)
+
+// feedItem is one entry pulled from a source: a feed item or an email.
+type feedItem struct {
+	id, title, summary, link, author string
+	published                        time.Time
+}
+
+// content is the observation an item is stored as.
+func (it feedItem) content() string {
+	s := it.title
+	if it.author != "" {
+		s = fmt.Sprintf("From %s: %s", it.author, s)
+	}
+	if it.summary != "" && it.summary != it.title {
+		s += " — " + it.summary
+	}
+	return truncateText(s, maxFeedSummary)
+}
+
+// feedSource is somewhere items are pulled from. entity names the entity
+// its items are stored on.
+type feedSource interface {
+	entity() (name, entityType string)
+	fetch(ctx context.Context, since time.Time) ([]feedItem, error)
+}
+
+// feedSchemes maps a source URL's scheme to the constructor for its kind of
+// source. Adding a kind of source means adding an entry here.
+var feedSchemes = map[string]func(u *url.URL) (feedSource, error){
+	"http":  newWebFeed,
+	"https": newWebFeed,
+	"imap":  newIMAPSource,
+	"imaps": newIMAPSource,
+}
+
+type feed struct {
+	tag    string
+	source feedSource
+}
+
+func parseFeeds(s string) ([]feed, error) {
+	var feeds []feed
+	for _, entry := range parseTagNames(s) {
+		tag, rawURL, ok := strings.Cut(entry, "=")
+		tag, rawURL = strings.TrimSpace(tag), strings.TrimSpace(rawURL)
+		if !ok || tag == "" || rawURL == "" {
+			return nil, fmt.Errorf("%q should be tag=URL", entry)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", tag, err)
+		}
+		newSource, ok := feedSchemes[strings.ToLower(u.Scheme)]
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported scheme %q, want http(s) for RSS and Atom or imap(s) for mail", tag, u.Scheme)
+		}
+		source, err := newSource(u)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", tag, err)
+		}
+		feeds = append(feeds, feed{tag, source})
+	}
+	return feeds, nil
+}
+
+// pullFeed stores the source's items since the last pull as observations on
+// its entity, tagged with the feed's tag. Items already stored are skipped.
+func pullFeed(ctx context.Context, db *sql.DB, f feed, since time.Time) (int, error) {
+	tagIDs, err := validateTags(ctx, db, []string{f.tag})
+	if err != nil {
+		return 0, fmt.Errorf("tag %s: %v", f.tag, err)
+	}
+	items, err := f.source.fetch(ctx, since)
+	if err != nil {
+		return 0, err
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].published.After(items[j].published) })
+	if len(items) > maxFeedItems {
+		items = items[:maxFeedItems]
+	}
+
+	size := 0
+	for _, it := range items {
+		size += len(it.content())
+	}
+	if err := checkTagQuotas(ctx, db, tagIDs, size); err != nil {
+		return 0, err
+	}
+
+	name, entityType := f.source.entity()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	entityID, created, err := upsertEntity(ctx, tx, name, entityType, "ignore")
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		if err := linkEntityTags(ctx, tx, entityID, tagIDs); err != nil {
+			return 0, err
+		}
+	}
+	added := 0
+	for _, it := range items {
+		content := normalizeText(it.content())
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		meta := map[string]string{"feed": f.tag}
+		if it.id != "" {
+			meta["id"] = it.id
+		}
+		if !it.published.IsZero() {
+			meta["published"] = it.published.UTC().Format(time.RFC3339)
+		}
+		metadata, _ := json.Marshal(meta)
+		result, err := tx.ExecContext(ctx, `INSERT INTO observations (entity_id, content, source, source_url, metadata)
+			SELECT ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM observations WHERE entity_id = ? AND content = ?)`,
+			entityID, content, "feed:"+f.tag, nullIfEmpty(it.link), string(metadata), entityID, content)
+		if err != nil {
+			return 0, execFailure(err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		added++
+		observationID, _ := result.LastInsertId()
+		if err := linkTags(ctx, tx, observationID, tagIDs); err != nil {
+			return 0, err
+		}
+	}
+	return added, tx.Commit()
+}
+
+// pullFeeds pulls every feed once, returning a line per feed.
+func pullFeeds(ctx context.Context, db *sql.DB, feeds []feed, since time.Time) (string, error) {
+	var sb strings.Builder
+	var failed int
+	for _, f := range feeds {
+		name, _ := f.source.entity()
+		n, err := pullFeed(ctx, db, f, since)
+		if err != nil {
+			failed++
+			fmt.Fprintf(&sb, "%s (%s): %v\n", name, f.tag, err)
+			continue
+		}
+		fmt.Fprintf(&sb, "%s (%s): %d new\n", name, f.tag, n)
+	}
+	if failed > 0 {
+		return sb.String(), fmt.Errorf("%d of %d feeds failed", failed, len(feeds))
+	}
+	return sb.String(), nil
+}
+
+func pullFeedsPeriodically(ctx context.Context, db *sql.DB, feeds []feed, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// Look back a day on the first pull so a restart does not miss mail.
+	since := time.Now().Add(-24 * time.Hour)
+	for {
+		now := time.Now()
+		report, err := pullFeeds(ctx, db, feeds, since)
+		if err != nil {
+			log.Printf("pulling feeds: %v\n%s", err, report)
+		} else {
+			log.Printf("pulled feeds\n%s", report)
+		}
+		since = now.Add(-interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+var feedClient = &http.Client{Timeout: feedTimeout}
+
+// webFeed is an RSS or Atom feed.
+type webFeed struct {
+	url *url.URL
+}
+
+func newWebFeed(u *url.URL) (feedSource, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("feed URL needs a host")
+	}
+	return webFeed{u}, nil
+}
+
+func (f webFeed) entity() (string, string) {
+	return "Feed " + f.url.Host + strings.TrimSuffix(f.url.Path, "/"), "Feed"
+}
+
+func (f webFeed) fetch(ctx context.Context, since time.Time) ([]feedItem, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return parseWebFeed(io.LimitReader(resp.Body, int64(ingestMaxBytes)), since)
+}
+
+// feedXML covers RSS 2.0 (channel/item), RSS 1.0 (item at the root) and
+// Atom (entry).
+type feedXML struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Summary   string `xml:"summary"`
+	Content   string `xml:"content"`
+	ID        string `xml:"id"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+	Author    struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+}
+
+// feedTimeLayouts are the date formats seen in the wild, RFC 822 variants
+// for RSS and RFC 3339 for Atom and Dublin Core.
+var feedTimeLayouts = []string{time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700", time.RFC3339}
+
+func parseFeedTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// feedText turns an HTML description into plain text.
+func feedText(s string) string {
+	_, paragraphs := extractPage(s, "text/html")
+	return strings.Join(paragraphs, " ")
+}
+
+// parseWebFeed reads an RSS or Atom document, keeping items published after
+// since (and items without a date, which dedupe takes care of).
+func parseWebFeed(r io.Reader, since time.Time) ([]feedItem, error) {
+	var doc feedXML
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("not an RSS or Atom feed: %v", err)
+	}
+	var items []feedItem
+	for _, it := range append(doc.Channel.Items, doc.Items...) {
+		published := parseFeedTime(it.PubDate)
+		if published.IsZero() {
+			published = parseFeedTime(it.Date)
+		}
+		id := it.GUID
+		if id == "" {
+			id = it.Link
+		}
+		items = append(items, feedItem{id: id, title: feedText(it.Title), summary: feedText(it.Description), link: strings.TrimSpace(it.Link), author: it.Creator, published: published})
+	}
+	for _, e := range doc.Entries {
+		link := ""
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				link = l.Href
+				break
+			}
+		}
+		summary := e.Summary
+		if summary == "" {
+			summary = e.Content
+		}
+		published := parseFeedTime(e.Published)
+		if published.IsZero() {
+			published = parseFeedTime(e.Updated)
+		}
+		items = append(items, feedItem{id: e.ID, title: feedText(e.Title), summary: feedText(summary), link: link, author: e.Author.Name, published: published})
+	}
+
+	kept := items[:0]
+	for _, it := range items {
+		if it.published.IsZero() || it.published.After(since) {
+			kept = append(kept, it)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/tursodatabase/libsql-client-go/libsql"
+)
+
+// foreignKeys turns on PRAGMA foreign_keys for every connection. SQLite leaves
+// it off by default and the setting is per connection.
+var foreignKeys = getEnv("ENGRAM_FOREIGN_KEYS", "true") == "true"
+
+// pragmaConnector opens libsql connections that run pragmas before their first
+// statement, tracing each one when tracing is on. The HTTP driver starts a new server-side stream whenever
+// database/sql resets a connection for reuse, so the pragmas are issued again
+// after every reset rather than once per connection. With a writer lock, its
+// connections take it for each write transaction and each statement run
+// outside one.
+type pragmaConnector struct {
+	dsn     string
+	pragmas []string
+	writer  writeLock
+}
+
+func (c *pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &pragmaConn{Conn: conn, pragmas: c.pragmas, pending: true, writer: c.writer}, nil
+}
+
+func (c *pragmaConnector) Driver() driver.Driver {
+	return libsql.Driver{}
+}
+
+type pragmaConn struct {
+	driver.Conn
+	pragmas []string
+	pending bool
+	writer  writeLock
+	// inTx is set while a write transaction holds the writer lock, so its
+	// statements do not wait for it again.
+	inTx bool
+}
+
+func (c *pragmaConn) unlock() {
+	c.inTx = false
+	c.writer.release()
+}
+
+func (c *pragmaConn) apply(ctx context.Context) error {
+	if !c.pending {
+		return nil
+	}
+	for _, p := range c.pragmas {
+		if err := c.exec(ctx, p); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	c.pending = false
+	return nil
+}
+
+func (c *pragmaConn) exec(ctx context.Context, query string) error {
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		return err
+	}
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+func (c *pragmaConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.apply(ctx); err != nil {
+		return nil, err
+	}
+	ctx, s := statementSpan(ctx, "exec", query)
+	defer s.finish()
+	if !c.inTx {
+		if err := c.writer.acquire(ctx); err != nil {
+			s.fail(err)
+			return nil, err
+		}
+		defer c.writer.release()
+	}
+	result, err := execer.ExecContext(ctx, query, args)
+	s.fail(err)
+	return result, err
+}
+
+func (c *pragmaConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.apply(ctx); err != nil {
+		return nil, err
+	}
+	// The HTTP driver reads the whole result before returning, so the span
+	// covers the round trip.
+	ctx, s := statementSpan(ctx, "query", query)
+	defer s.finish()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	s.fail(err)
+	return rows, err
+}
+
+func (c *pragmaConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.apply(ctx); err != nil {
+		return nil, err
+	}
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx applies the pragmas first: foreign_keys cannot be changed inside a
+// transaction.
+func (c *pragmaConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.apply(ctx); err != nil {
+		return nil, err
+	}
+	if c.writer == nil || opts.ReadOnly {
+		return c.begin(ctx, opts)
+	}
+	if err := c.writer.acquire(ctx); err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	tx, err := c.begin(ctx, opts)
+	if err != nil {
+		c.unlock()
+		return nil, err
+	}
+	return &lockedTx{Tx: tx, conn: c}, nil
+}
+
+func (c *pragmaConn) begin(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *pragmaConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *pragmaConn) ResetSession(ctx context.Context) error {
+	c.pending = true
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// foreignKeyViolation is one row of PRAGMA foreign_key_check, resolved to the
+// referencing column and its ON DELETE action.
+type foreignKeyViolation struct {
+	table    string
+	rowid    int64
+	parent   string
+	column   string
+	onDelete string
+}
+
+// foreignKeyViolations lists rows whose references point at missing parents:
+// observations of deleted entities, relations to deleted entities, dangling
+// observation_tags and the like. It works whether or not foreign keys are
+// enforced on the connection.
+func foreignKeyViolations(ctx context.Context, q queryer) ([]foreignKeyViolation, error) {
+	rows, err := q.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	type check struct {
+		table  string
+		rowid  sql.NullInt64
+		parent string
+		fkid   int64
+	}
+	var checks []check
+	for rows.Next() {
+		var c check
+		if err := rows.Scan(&c.table, &c.rowid, &c.parent, &c.fkid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	type fkey struct{ column, onDelete string }
+	keys := make(map[string]map[int64]fkey)
+	var violations []foreignKeyViolation
+	for _, c := range checks {
+		if _, ok := keys[c.table]; !ok {
+			keys[c.table] = make(map[int64]fkey)
+			rows, err := q.QueryContext(ctx, fmt.Sprintf(`SELECT id, "from", on_delete FROM pragma_foreign_key_list(%s)`, sqlLiteral(c.table)))
+			if err != nil {
+				return nil, fmt.Errorf("foreign keys of %s: %v", c.table, err)
+			}
+			for rows.Next() {
+				var id int64
+				var k fkey
+				if err := rows.Scan(&id, &k.column, &k.onDelete); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				keys[c.table][id] = k
+			}
+			rows.Close()
+		}
+		k := keys[c.table][c.fkid]
+		violations = append(violations, foreignKeyViolation{
+			table: c.table, rowid: c.rowid.Int64, parent: c.parent, column: k.column, onDelete: k.onDelete,
+		})
+	}
+	return violations, nil
+}
+
+// repairViolation applies the reference's ON DELETE action as if the parent
+// had been deleted with foreign keys on: SET NULL clears the column, anything
+// else deletes the row.
+func repairViolation(ctx context.Context, tx *sql.Tx, v foreignKeyViolation) error {
+	var err error
+	if strings.EqualFold(v.onDelete, "SET NULL") {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s = NULL WHERE rowid = ?", quoteIdent(v.table), quoteIdent(v.column)), v.rowid)
+	} else {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE rowid = ?", quoteIdent(v.table)), v.rowid)
+	}
+	return err
+}
+
+func formatViolations(violations []foreignKeyViolation) string {
+	type group struct {
+		key  string
+		rows []string
+	}
+	groups := make(map[string]*group)
+	for _, v := range violations {
+		key := fmt.Sprintf("%s.%s -> %s", v.table, v.column, v.parent)
+		if groups[key] == nil {
+			groups[key] = &group{key: key}
+		}
+		groups[key].rows = append(groups[key].rows, fmt.Sprint(v.rowid))
+	}
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		g := groups[k]
+		fmt.Fprintf(&sb, "%s: %d orphaned row(s), rowid %s\n", g.key, len(g.rows), strings.Join(g.rows, ", "))
+	}
+	return sb.String()
+}
+
+// maxRepairPasses bounds repair: deleting an orphan can orphan the rows that
+// reference it when foreign keys are not enforced, so repair re-checks.
+const maxRepairPasses = 10
+
+// registerCheckIntegrity adds the check_integrity tool.
+func registerCheckIntegrity(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("check_integrity",
+		mcp.WithDescription(`Find orphaned rows: observations or unknowns of deleted entities, relations pointing at deleted entities, and observation_tags rows whose observation or tag is gone.
+
+Reports them by default. With repair: true they are removed in one transaction, or have the reference cleared where the column is ON DELETE SET NULL (e.g. unknowns.observation_id).`),
+		mcp.WithBoolean("repair",
+			mcp.Description("Delete or fix the orphaned rows instead of only reporting them (default false)"),
+		),
+	), checkIntegrityHandler(db))
+}
+
+func checkIntegrityHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		violations, err := foreignKeyViolations(ctx, db)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "foreign_key_check failed: %v", err), nil
+		}
+		if len(violations) == 0 {
+			return mcp.NewToolResultText("no orphaned rows"), nil
+		}
+		report := formatViolations(violations)
+		if !request.GetBool("repair", false) {
+			return mcp.NewToolResultText(report + "\nCall again with repair: true to delete these rows (or clear the reference where it is ON DELETE SET NULL)."), nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		repaired := 0
+		for pass := 0; len(violations) > 0; pass++ {
+			if pass == maxRepairPasses {
+				return toolErrorf(codeConflict, "%s\nrepair did not converge after %d passes; nothing was changed", report, maxRepairPasses), nil
+			}
+			for _, v := range violations {
+				if err := repairViolation(ctx, tx, v); err != nil {
+					return toolErrorf(errorCode(err, codeDatabase), "repair %s rowid %d failed: %v; nothing was changed", v.table, v.rowid, err), nil
+				}
+				repaired++
+			}
+			if violations, err = foreignKeyViolations(ctx, tx); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "foreign_key_check failed: %v; nothing was changed", err), nil
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit repair: %v", err), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("%s\nrepaired %d row(s)", report, repaired)), nil
+	}
+}
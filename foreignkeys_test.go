@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestPragmaConnector_Integration(t *testing.T) {
+	url := os.Getenv("LIBSQL_URL")
+	if url == "" {
+		url = "http://localhost:8080"
+	}
+	db := sql.OpenDB(&pragmaConnector{dsn: url, pragmas: []string{"PRAGMA foreign_keys = ON"}})
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Skipf("skipping integration test: %v", err)
+	}
+
+	// Each statement checks a connection out of the pool again, which resets
+	// the server-side stream; the pragma must survive that.
+	for i := 0; i < 3; i++ {
+		var on int
+		if err := db.QueryRow("PRAGMA foreign_keys").Scan(&on); err != nil {
+			t.Fatalf("read pragma: %v", err)
+		}
+		if on != 1 {
+			t.Fatalf("foreign_keys = %d on use %d, want 1", on, i)
+		}
+	}
+
+	_, err := db.Exec("INSERT INTO observations (entity_id, content) VALUES (999999, 'fk test orphan')")
+	if err == nil {
+		db.Exec("DELETE FROM observations WHERE content = 'fk test orphan'")
+		t.Fatal("expected foreign key error inserting an observation for a missing entity")
+	}
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	var on int
+	if err := tx.QueryRow("PRAGMA foreign_keys").Scan(&on); err != nil || on != 1 {
+		t.Fatalf("foreign_keys in transaction = %d (%v), want 1", on, err)
+	}
+}
+
+func TestCheckIntegrity_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Other tests leave connections with foreign keys on, so the orphan is
+	// made on a connection of its own that turns them off.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	var was int
+	if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&was); err != nil {
+		t.Fatalf("read foreign_keys: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		t.Fatalf("foreign_keys off: %v", err)
+	}
+	result, err := conn.ExecContext(ctx, "INSERT INTO observations (entity_id, content) VALUES (999999, 'integrity test orphan')")
+	if err != nil {
+		t.Fatalf("insert orphan: %v", err)
+	}
+	orphanID, _ := result.LastInsertId()
+	defer db.Exec("DELETE FROM observations WHERE content = 'integrity test orphan'")
+	if _, err := conn.ExecContext(ctx, "INSERT INTO observation_tags (observation_id, tag_id) SELECT ?, id FROM tags WHERE name = 'homelab'", orphanID); err != nil {
+		t.Fatalf("tag orphan: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA foreign_keys = %d", was)); err != nil {
+		t.Fatalf("restore foreign_keys: %v", err)
+	}
+	conn.Close()
+
+	res, err := callTool(checkIntegrityHandler(db), "check_integrity", nil)
+	if err != nil || res.IsError {
+		t.Fatalf("check_integrity failed: %v %v", err, res.Content)
+	}
+	if text := res.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "observations.entity_id -> entities") {
+		t.Fatalf("expected orphaned observation in report:\n%s", text)
+	}
+
+	res, err = callTool(checkIntegrityHandler(db), "check_integrity", map[string]any{"repair": true})
+	if err != nil || res.IsError {
+		t.Fatalf("repair failed: %v %v", err, res.Content)
+	}
+
+	var n int
+	db.QueryRow("SELECT count(*) FROM observations WHERE id = ?", orphanID).Scan(&n)
+	if n != 0 {
+		t.Error("orphaned observation not removed")
+	}
+	db.QueryRow("SELECT count(*) FROM observation_tags WHERE observation_id = ?", orphanID).Scan(&n)
+	if n != 0 {
+		t.Error("observation_tags of the removed observation not removed")
+	}
+
+	violations, err := foreignKeyViolations(context.Background(), db)
+	if err != nil {
+		t.Fatalf("foreign_key_check: %v", err)
+	}
+	if len(violations) != 0 {
+		t.Errorf("violations remain after repair: %+v", violations)
+	}
+}
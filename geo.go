@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371.0088
+
+// haversineKm is the great-circle distance between two points in degrees.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func validCoordinates(lat, lon float64) error {
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return fmt.Errorf("latitude %v out of range, want -90 to 90", lat)
+	}
+	if math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return fmt.Errorf("longitude %v out of range, want -180 to 180", lon)
+	}
+	return nil
+}
+
+// boundingBox returns a condition on e.latitude and e.longitude that holds
+// for every point within km of lat, lon, so the index narrows the rows
+// haversineKm has to look at. Near a pole the box covers every longitude;
+// across the antimeridian it wraps.
+func boundingBox(lat, lon, km float64) (string, []any) {
+	dLat := km / earthRadiusKm * 180 / math.Pi
+	minLat, maxLat := lat-dLat, lat+dLat
+	cond, args := "e.latitude BETWEEN ? AND ?", []any{minLat, maxLat}
+	spread := math.Sin(km/earthRadiusKm) / math.Cos(lat*math.Pi/180)
+	if minLat <= -90 || maxLat >= 90 || spread >= 1 {
+		return cond, args
+	}
+	dLon := math.Asin(spread) * 180 / math.Pi
+	minLon, maxLon := lon-dLon, lon+dLon
+	switch {
+	case minLon < -180:
+		return cond + " AND (e.longitude >= ? OR e.longitude <= ?)", append(args, minLon+360, maxLon)
+	case maxLon > 180:
+		return cond + " AND (e.longitude >= ? OR e.longitude <= ?)", append(args, minLon, maxLon-360)
+	}
+	return cond + " AND e.longitude BETWEEN ? AND ?", append(args, minLon, maxLon)
+}
+
+// registerGeo adds the set_location and nearby tools.
+func registerGeo(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("set_location",
+		mcp.WithDescription("Set where an entity is, such as a restaurant, a city, an office or a trip destination, as latitude and longitude in decimal degrees, so nearby can find it."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Entity name"),
+		),
+		mcp.WithNumber("latitude",
+			mcp.Description("Latitude, -90 to 90, e.g. -1.2921 for Nairobi. Required unless clear is set"),
+		),
+		mcp.WithNumber("longitude",
+			mcp.Description("Longitude, -180 to 180, e.g. 36.8219 for Nairobi. Required unless clear is set"),
+		),
+		mcp.WithBoolean("clear",
+			mcp.Description("Remove the entity's location instead (default false)"),
+		),
+	), setLocationHandler(db))
+
+	s.AddTool(mcp.NewTool("nearby",
+		mcp.WithDescription(`Find entities with a location (set with set_location) within a distance of a point, nearest first, with their distance in km.
+
+Center it on an entity, e.g. entity 'Nairobi' with entity_type 'Restaurant' for restaurants near Nairobi, or on latitude and longitude. Then read what was said about them with open_nodes.`),
+		mcp.WithString("entity",
+			mcp.Description("Center on this entity's location; it is left out of the results"),
+		),
+		mcp.WithNumber("latitude",
+			mcp.Description("Center latitude, when not centering on an entity"),
+		),
+		mcp.WithNumber("longitude",
+			mcp.Description("Center longitude, when not centering on an entity"),
+		),
+		mcp.WithNumber("radius_km",
+			mcp.Description("Distance from the center in km (default 10)"),
+		),
+		mcp.WithString("entity_type",
+			mcp.Description("Only entities of this type, ignoring case"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum entities to return (default 20, max 100)"),
+		),
+		mcp.WithBoolean("include_archived",
+			mcp.Description("Include entities hidden by archive_entity (default false)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), nearbyHandler(db))
+
+	// Knowledge-graph tools compatible with @modelcontextprotocol/server-memory.
+}
+
+func setLocationHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			return toolError(codeInvalidArgument, "name parameter is required"), nil
+		}
+
+		var lat, lon any
+		msg := "location cleared"
+		if !request.GetBool("clear", false) {
+			args := request.GetArguments()
+			if args["latitude"] == nil || args["longitude"] == nil {
+				return toolError(codeInvalidArgument, "latitude and longitude are required, or pass clear to remove the location"), nil
+			}
+			la, lo := request.GetFloat("latitude", 0), request.GetFloat("longitude", 0)
+			if err := validCoordinates(la, lo); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			lat, lon, msg = la, lo, fmt.Sprintf("located at %.6g, %.6g", la, lo)
+		}
+		result, err := db.ExecContext(ctx, "UPDATE entities SET latitude = ?, longitude = ? WHERE name = ?", lat, lon, name)
+		if err != nil {
+			return execError(err, codeDatabase), nil
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return toolErrorf(codeNotFound, "entity '%s' does not exist", name), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("success: entity %s %s", name, msg)), nil
+	}
+}
+
+type nearbyEntity struct {
+	Name       string  `json:"name"`
+	EntityType string  `json:"entityType"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	DistanceKm float64 `json:"distanceKm"`
+}
+
+type nearbyResult struct {
+	Center    string         `json:"center,omitempty"`
+	Latitude  float64        `json:"latitude"`
+	Longitude float64        `json:"longitude"`
+	RadiusKm  float64        `json:"radiusKm"`
+	Entities  []nearbyEntity `json:"entities"`
+}
+
+// findNearby returns the entities located within km of lat, lon, nearest
+// first, leaving out the entity named exclude.
+func findNearby(ctx context.Context, db *sql.DB, lat, lon, km float64, entityType, exclude string, includeArchived bool, limit int) ([]nearbyEntity, error) {
+	box, args := boundingBox(lat, lon, km)
+	query := "SELECT e.name, e.entity_type, e.latitude, e.longitude FROM entities e WHERE " + box + " AND e.name != ?"
+	args = append(args, exclude)
+	if entityType != "" {
+		query += " AND e.entity_type = ? COLLATE NOCASE"
+		args = append(args, entityType)
+	}
+	if !includeArchived {
+		query += " AND e.archived_at IS NULL"
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := []nearbyEntity{}
+	for rows.Next() {
+		var e nearbyEntity
+		if err := rows.Scan(&e.Name, &e.EntityType, &e.Latitude, &e.Longitude); err != nil {
+			return nil, err
+		}
+		if d := haversineKm(lat, lon, e.Latitude, e.Longitude); d <= km {
+			e.DistanceKm = math.Round(d*100) / 100
+			found = append(found, e)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].DistanceKm < found[j].DistanceKm })
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+func nearbyHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result := nearbyResult{
+			Center:   strings.TrimSpace(request.GetString("entity", "")),
+			RadiusKm: request.GetFloat("radius_km", 10),
+		}
+		if result.RadiusKm <= 0 || result.RadiusKm > math.Pi*earthRadiusKm {
+			return toolErrorf(codeInvalidArgument, "radius_km must be between 0 and %.0f", math.Pi*earthRadiusKm), nil
+		}
+		limit := request.GetInt("limit", 20)
+		if limit < 1 || limit > 100 {
+			return toolError(codeInvalidArgument, "limit must be between 1 and 100"), nil
+		}
+
+		args := request.GetArguments()
+		switch {
+		case result.Center != "":
+			var lat, lon sql.NullFloat64
+			err := db.QueryRowContext(ctx, "SELECT latitude, longitude FROM entities WHERE name = ?", result.Center).Scan(&lat, &lon)
+			if err == sql.ErrNoRows {
+				return toolErrorf(codeNotFound, "entity '%s' does not exist", result.Center), nil
+			} else if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "error looking up entity '%s': %v", result.Center, err), nil
+			}
+			if !lat.Valid || !lon.Valid {
+				return toolErrorf(codeInvalidArgument, "entity '%s' has no location; set one with set_location or pass latitude and longitude", result.Center), nil
+			}
+			result.Latitude, result.Longitude = lat.Float64, lon.Float64
+		case args["latitude"] != nil && args["longitude"] != nil:
+			result.Latitude, result.Longitude = request.GetFloat("latitude", 0), request.GetFloat("longitude", 0)
+			if err := validCoordinates(result.Latitude, result.Longitude); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+		default:
+			return toolError(codeInvalidArgument, "pass entity, or latitude and longitude, as the center"), nil
+		}
+
+		var err error
+		result.Entities, err = findNearby(ctx, db, result.Latitude, result.Longitude, result.RadiusKm,
+			strings.TrimSpace(request.GetString("entity_type", "")), result.Center, request.GetBool("include_archived", false), limit)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to find nearby entities: %v", err), nil
+		}
+		return graphResult(result), nil
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", -1.2921, 36.8219, -1.2921, 36.8219, 0},
+		{"Nairobi to Mombasa", -1.2921, 36.8219, -4.0435, 39.6682, 440},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 344},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111},
+	}
+	for _, tt := range tests {
+		if got := haversineKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(got-tt.want) > 1 {
+			t.Errorf("%s: haversineKm = %.1f, want about %.0f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		km       float64
+		wantCond string
+	}{
+		{"ordinary", -1.2921, 36.8219, 10, "e.latitude BETWEEN ? AND ? AND e.longitude BETWEEN ? AND ?"},
+		{"wraps", 0, 179.99, 50, "e.latitude BETWEEN ? AND ? AND (e.longitude >= ? OR e.longitude <= ?)"},
+		{"reaches a pole", 89.9, 0, 50, "e.latitude BETWEEN ? AND ?"},
+	}
+	for _, tt := range tests {
+		cond, args := boundingBox(tt.lat, tt.lon, tt.km)
+		if cond != tt.wantCond {
+			t.Errorf("%s: cond = %q, want %q", tt.name, cond, tt.wantCond)
+		}
+		for _, a := range args {
+			if math.IsNaN(a.(float64)) {
+				t.Errorf("%s: args = %v", tt.name, args)
+			}
+		}
+	}
+
+	// Every point on the circle lies inside the box.
+	lat, lon, km := 60.0, 10.0, 100.0
+	_, args := boundingBox(lat, lon, km)
+	for bearing := 0.0; bearing < 360; bearing += 5 {
+		b, d := bearing*math.Pi/180, km/earthRadiusKm
+		la1 := lat * math.Pi / 180
+		la2 := math.Asin(math.Sin(la1)*math.Cos(d) + math.Cos(la1)*math.Sin(d)*math.Cos(b))
+		lo2 := lon + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(la1), math.Cos(d)-math.Sin(la1)*math.Sin(la2))*180/math.Pi
+		la2 *= 180 / math.Pi
+		if la2 < args[0].(float64)-1e-9 || la2 > args[1].(float64)+1e-9 || lo2 < args[2].(float64)-1e-9 || lo2 > args[3].(float64)+1e-9 {
+			t.Errorf("bearing %.0f: %.4f, %.4f outside box %v", bearing, la2, lo2, args)
+		}
+	}
+}
+
+func TestNearby_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'geo-test-%'")
+	for _, e := range [][2]string{
+		{"geo-test-nairobi", "City"},
+		{"geo-test-carnivore", "Restaurant"},
+		{"geo-test-talisman", "Restaurant"},
+		{"geo-test-mombasa-grill", "Restaurant"},
+		{"geo-test-unplaced", "Restaurant"},
+	} {
+		if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES (?, ?)", e[0], e[1]); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	locate := func(name string, lat, lon float64) {
+		t.Helper()
+		result, err := callTool(setLocationHandler(db), "set_location", map[string]any{"name": name, "latitude": lat, "longitude": lon})
+		if err != nil || result.IsError {
+			t.Fatalf("set_location %s: %v %v", name, err, result.Content)
+		}
+	}
+	locate("geo-test-nairobi", -1.2921, 36.8219)
+	locate("geo-test-carnivore", -1.3280, 36.8030)
+	locate("geo-test-talisman", -1.3560, 36.7120)
+	locate("geo-test-mombasa-grill", -4.0435, 39.6682)
+
+	nearby := func(args map[string]any) nearbyResult {
+		t.Helper()
+		result, err := callTool(nearbyHandler(db), "nearby", args)
+		if err != nil || result.IsError {
+			t.Fatalf("nearby %v: %v %v", args, err, result.Content)
+		}
+		var got nearbyResult
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	got := nearby(map[string]any{"entity": "geo-test-nairobi", "radius_km": float64(20), "entity_type": "restaurant"})
+	if len(got.Entities) != 2 || got.Entities[0].Name != "geo-test-carnivore" || got.Entities[1].Name != "geo-test-talisman" {
+		t.Fatalf("near Nairobi = %+v, want the two Nairobi restaurants nearest first", got.Entities)
+	}
+	if d := got.Entities[0].DistanceKm; d < 4 || d > 5 {
+		t.Errorf("distance to carnivore = %v km", d)
+	}
+
+	got = nearby(map[string]any{"latitude": -4.05, "longitude": 39.67, "radius_km": float64(5)})
+	if len(got.Entities) != 1 || got.Entities[0].Name != "geo-test-mombasa-grill" {
+		t.Errorf("near Mombasa = %+v", got.Entities)
+	}
+
+	if result, _ := callTool(setLocationHandler(db), "set_location", map[string]any{"name": "geo-test-talisman", "clear": true}); result.IsError {
+		t.Fatalf("clear: %v", result.Content)
+	}
+	if got := nearby(map[string]any{"entity": "geo-test-nairobi", "radius_km": float64(20)}); len(got.Entities) != 1 {
+		t.Errorf("after clearing = %+v", got.Entities)
+	}
+
+	for _, tc := range []struct {
+		tool string
+		args map[string]any
+		want string
+	}{
+		{"set_location", map[string]any{"name": "geo-test-carnivore", "latitude": float64(91), "longitude": float64(0)}, "latitude 91 out of range"},
+		{"set_location", map[string]any{"name": "geo-test-carnivore", "latitude": float64(1)}, "latitude and longitude are required"},
+		{"set_location", map[string]any{"name": "geo-test-nowhere", "latitude": float64(1), "longitude": float64(1)}, "does not exist"},
+		{"nearby", map[string]any{"entity": "geo-test-unplaced"}, "has no location"},
+		{"nearby", map[string]any{}, "pass entity, or latitude and longitude"},
+		{"nearby", map[string]any{"latitude": float64(0), "longitude": float64(0), "radius_km": float64(-1)}, "radius_km must be"},
+	} {
+		handler := nearbyHandler(db)
+		if tc.tool == "set_location" {
+			handler = setLocationHandler(db)
+		}
+		result, _ := callTool(handler, tc.tool, tc.args)
+		if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, tc.want) {
+			t.Errorf("%s %v = %v, want error %q", tc.tool, tc.args, result.Content, tc.want)
+		}
+	}
+}
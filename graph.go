@@ -0,0 +1,802 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The knowledge-graph tools mirror the names and JSON shapes of the reference
+// @modelcontextprotocol/server-memory server, so prompts and clients written
+// for it work unchanged. Observations written through them carry no tags.
+
+type graphEntity struct {
+	Name         string   `json:"name"`
+	EntityType   string   `json:"entityType"`
+	Observations []string `json:"observations"`
+	// ArchivedAt is set on entities hidden by archive_entity, which only show
+	// up when named or requested with include_archived.
+	ArchivedAt string `json:"archivedAt,omitempty"`
+	// Aliases are former names the entity had before rename_entity.
+	Aliases []string `json:"aliases,omitempty"`
+	// Details is filled by open_nodes only; observations stays a list of
+	// strings for clients that expect the reference shape.
+	Details []graphObservation `json:"observationDetails,omitempty"`
+}
+
+type graphObservation struct {
+	ID         int64           `json:"id"`
+	Content    string          `json:"content"`
+	Tags       []string        `json:"tags"`
+	Visibility string          `json:"visibility"`
+	Confidence *float64        `json:"confidence,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	VerifiedAt string          `json:"verifiedAt,omitempty"`
+	VerifiedBy string          `json:"verifiedBy,omitempty"`
+	ParentID   *int64          `json:"parentId,omitempty"`
+	CreatedAt  string          `json:"createdAt,omitempty"`
+}
+
+type graphRelation struct {
+	From         string          `json:"from"`
+	To           string          `json:"to"`
+	RelationType string          `json:"relationType"`
+	Weight       *float64        `json:"weight,omitempty"`
+	Properties   json.RawMessage `json:"properties,omitempty"`
+	// Implied marks the inverse of a relation stored in the other direction.
+	Implied bool `json:"implied,omitempty"`
+}
+
+type knowledgeGraph struct {
+	Entities  []graphEntity   `json:"entities"`
+	Relations []graphRelation `json:"relations"`
+	// entityIDs and observationIDs are the rows loadGraph returned, for
+	// counting their use.
+	entityIDs      []int64
+	observationIDs []int64
+}
+
+// graphResult renders v the way the reference server does: indented JSON text.
+func graphResult(v any) *mcp.CallToolResult {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return toolErrorf(errorCode(err, codeDatabase), "failed to encode result: %v", err)
+	}
+	return mcp.NewToolResultText(string(data))
+}
+
+// graphQuery selects part of the graph for loadGraph. filter is a boolean SQL
+// expression over entities aliased as e. observations, when set, further
+// restricts observations aliased as o. Relations run from the selected
+// entities to entities matching targets, or to the selected entities
+// themselves when targets is empty. details fills each entity's Details.
+// Observations a follow-up has superseded are left out unless history is
+// set.
+type graphQuery struct {
+	filter       string
+	args         []any
+	observations string
+	obsArgs      []any
+	targets      string
+	targetArgs   []any
+	details      bool
+	history      bool
+}
+
+// loadGraph returns the entities selected by q with their observations and
+// relations. Every statement goes through restrictVisibility, including any
+// observations subquery inside the filters.
+func loadGraph(ctx context.Context, db *sql.DB, levels []string, q graphQuery) (*knowledgeGraph, error) {
+	graph := &knowledgeGraph{Entities: []graphEntity{}, Relations: []graphRelation{}}
+
+	rows, err := db.QueryContext(ctx, restrictVisibility(`SELECT e.id, e.name, e.entity_type, COALESCE(e.archived_at, ''),
+		(SELECT json_group_array(a.alias) FROM entity_aliases a WHERE a.entity_id = e.id)
+		FROM entities e WHERE `+q.filter+` ORDER BY e.id`, levels), q.args...)
+	if err != nil {
+		return nil, fmt.Errorf("entities: %v", err)
+	}
+	index := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var aliases string
+		e := graphEntity{Observations: []string{}}
+		if err := rows.Scan(&id, &e.Name, &e.EntityType, &e.ArchivedAt, &aliases); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(aliases), &e.Aliases); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("entity aliases: %v", err)
+		}
+		index[id] = len(graph.Entities)
+		graph.Entities = append(graph.Entities, e)
+		graph.entityIDs = append(graph.entityIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(graph.Entities) == 0 {
+		return graph, nil
+	}
+
+	obsFilter, obsArgs := q.filter, q.args
+	if q.observations != "" {
+		obsFilter = "(" + q.filter + ") AND (" + q.observations + ")"
+		obsArgs = append(append([]any{}, q.args...), q.obsArgs...)
+	}
+	if !q.history {
+		obsFilter = "(" + obsFilter + ") AND " + notSuperseded
+	}
+	rows, err = db.QueryContext(ctx, restrictVisibility(`SELECT o.entity_id, o.id, o.content, o.visibility, o.confidence, COALESCE(o.source, ''), o.metadata, o.created_at,
+		COALESCE(o.verified_at, ''), COALESCE(o.verified_by, ''), o.parent_id,
+		COALESCE((SELECT json_group_array(t.name) FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), '[]')
+		FROM observations o
+		JOIN entities e ON e.id = o.entity_id
+		WHERE `+obsFilter+` ORDER BY o.id`, levels), obsArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("observations: %v", err)
+	}
+	for rows.Next() {
+		var entityID int64
+		var o graphObservation
+		var confidence sql.NullFloat64
+		var metadata, createdAt sql.NullString
+		var parentID sql.NullInt64
+		var tags string
+		if err := rows.Scan(&entityID, &o.ID, &o.Content, &o.Visibility, &confidence, &o.Source, &metadata, &createdAt, &o.VerifiedAt, &o.VerifiedBy, &parentID, &tags); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i, ok := index[entityID]
+		if !ok {
+			continue
+		}
+		graph.Entities[i].Observations = append(graph.Entities[i].Observations, o.Content)
+		graph.observationIDs = append(graph.observationIDs, o.ID)
+		if !q.details {
+			continue
+		}
+		if err := json.Unmarshal([]byte(tags), &o.Tags); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("observation tags: %v", err)
+		}
+		if confidence.Valid {
+			o.Confidence = &confidence.Float64
+		}
+		if metadata.Valid {
+			o.Metadata = json.RawMessage(metadata.String)
+		}
+		if parentID.Valid {
+			o.ParentID = &parentID.Int64
+		}
+		o.CreatedAt = createdAt.String
+		graph.Entities[i].Details = append(graph.Entities[i].Details, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	targets, targetArgs := q.targets, q.targetArgs
+	if targets == "" {
+		targets, targetArgs = q.filter, q.args
+	}
+	type edge struct{ from, to, relationType string }
+	seen := make(map[edge]bool)
+	loadRelations := func(sqlStr string, args []any, implied bool) error {
+		rows, err := db.QueryContext(ctx, restrictVisibility(sqlStr, levels), args...)
+		if err != nil {
+			return fmt.Errorf("relations: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r graphRelation
+			var weight sql.NullFloat64
+			var properties sql.NullString
+			if err := rows.Scan(&r.From, &r.To, &r.RelationType, &weight, &properties); err != nil {
+				return err
+			}
+			if implied {
+				r.RelationType, r.Implied = relationInverses[r.RelationType], true
+			}
+			key := edge{r.From, r.To, r.RelationType}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if weight.Valid {
+				r.Weight = &weight.Float64
+			}
+			if properties.Valid {
+				r.Properties = json.RawMessage(properties.String)
+			}
+			graph.Relations = append(graph.Relations, r)
+		}
+		return rows.Err()
+	}
+
+	// Strongest relations first, unweighted ones last in creation order.
+	if err := loadRelations(`SELECT f.name, t.name, r.relation_type, r.weight, r.properties
+		FROM relations r
+		JOIN entities f ON f.id = r.from_id
+		JOIN entities t ON t.id = r.to_id
+		WHERE r.from_id IN (SELECT e.id FROM entities e WHERE `+q.filter+`)
+		AND r.to_id IN (SELECT e.id FROM entities e WHERE `+targets+`)
+		ORDER BY r.weight IS NULL, r.weight DESC, r.id`, append(append([]any{}, q.args...), targetArgs...), false); err != nil {
+		return nil, err
+	}
+	// Relations with a configured inverse read the same from either end:
+	// one stored pointing at a selected entity is listed from it as its
+	// inverse, unless that inverse is stored too.
+	if types := inverseTypes(); len(types) > 0 {
+		args := append(append([]any{}, q.args...), targetArgs...)
+		for _, t := range types {
+			args = append(args, t)
+		}
+		if err := loadRelations(`SELECT t.name, f.name, r.relation_type, r.weight, r.properties
+			FROM relations r
+			JOIN entities f ON f.id = r.from_id
+			JOIN entities t ON t.id = r.to_id
+			WHERE r.to_id IN (SELECT e.id FROM entities e WHERE `+q.filter+`)
+			AND r.from_id IN (SELECT e.id FROM entities e WHERE `+targets+`)
+			AND r.relation_type IN (`+placeholders(len(types))+`)
+			ORDER BY r.id`, args, true); err != nil {
+			return nil, err
+		}
+		relationWeightOrder(graph.Relations)
+	}
+	return graph, nil
+}
+
+// entityIDs resolves entity names, or former names, to ids inside tx,
+// reporting every name that does not exist.
+func entityIDs(ctx context.Context, tx *sql.Tx, names []string) (map[string]int64, error) {
+	ids := make(map[string]int64)
+	var missing []string
+	for _, name := range names {
+		if _, ok := ids[name]; ok {
+			continue
+		}
+		var id int64
+		err := tx.QueryRowContext(ctx, "SELECT id"+entityByName, name, name, name).Scan(&id)
+		if err == sql.ErrNoRows {
+			missing = append(missing, name)
+			continue
+		} else if err != nil {
+			return nil, errorf(codeDatabase, "error looking up entity '%s': %v", name, err)
+		}
+		ids[name] = id
+	}
+	if len(missing) > 0 {
+		return nil, errorf(codeNotFound, "entity not found: %s. Create it first with create_entities", strings.Join(missing, ", "))
+	}
+	return ids, nil
+}
+
+// registerGraphTools adds the tools of the reference knowledge graph server.
+func registerGraphTools(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("create_entities",
+		mcp.WithDescription("Create multiple new entities in the knowledge graph. Entities whose name already exists are skipped."),
+		mcp.WithArray("entities",
+			mcp.Required(),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name":         map[string]any{"type": "string", "description": "The name of the entity"},
+					"entityType":   map[string]any{"type": "string", "description": "The type of the entity"},
+					"observations": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "An array of observation contents associated with the entity"},
+				},
+				"required": []string{"name", "entityType", "observations"},
+			}),
+		),
+	), createEntitiesHandler(db))
+
+	s.AddTool(mcp.NewTool("create_relations",
+		mcp.WithDescription("Create multiple new relations between entities in the knowledge graph. Relations should be in active voice."),
+		mcp.WithArray("relations",
+			mcp.Required(),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"from":         map[string]any{"type": "string", "description": "The name of the entity where the relation starts"},
+					"to":           map[string]any{"type": "string", "description": "The name of the entity where the relation ends"},
+					"relationType": map[string]any{"type": "string", "description": "The type of the relation"},
+					"weight":       map[string]any{"type": "number", "minimum": 0, "maximum": 1, "description": "Optional strength, 0-1: 'knows' is weak, 'works closely with daily' strong"},
+					"properties":   map[string]any{"type": "object", "description": "Optional details as a JSON object, e.g. {\"since\": \"2021\"}"},
+				},
+				"required": []string{"from", "to", "relationType"},
+			}),
+		),
+	), createRelationsHandler(db))
+
+	s.AddTool(mcp.NewTool("add_observations",
+		mcp.WithDescription("Add new observations to existing entities in the knowledge graph. Observations already recorded on the entity are skipped."),
+		mcp.WithArray("observations",
+			mcp.Required(),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"entityName": map[string]any{"type": "string", "description": "The name of the entity to add the observations to"},
+					"contents":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "An array of observation contents to add"},
+				},
+				"required": []string{"entityName", "contents"},
+			}),
+		),
+	), addObservationsHandler(db))
+
+	s.AddTool(mcp.NewTool("read_graph",
+		mcp.WithDescription(`Read the entire knowledge graph, a page of entities at a time.
+
+Each page lists entities with their observations and the relations starting at them. When more entities remain the result has nextOffset; call again with offset set to it. Filter by entity type or tag to fetch only part of the graph.`),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Entities per page (default %d, max %d). Pages also end early once they reach the size limit", defaultGraphPageSize, maxGraphPageSize)),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Entities to skip, from a previous page's nextOffset"),
+		),
+		mcp.WithString("entity_type",
+			mcp.Description("Only entities of these comma-separated types, e.g. 'person,device'"),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Only observations with these comma-separated tags, and only entities that have one"),
+		),
+		mcp.WithBoolean("include_archived",
+			mcp.Description("Also return entities hidden by archive_entity (default false)"),
+		),
+		mcp.WithBoolean("include_history",
+			mcp.Description("Also return observations a correction or follow-up has superseded (default false, only the latest item of each thread)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), readGraphHandler(db, scopes))
+
+	s.AddTool(mcp.NewTool("search_nodes",
+		mcp.WithDescription("Search for nodes in the knowledge graph based on a query"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("The search query to match against entity names, types, and observation content, ignoring case and accents"),
+		),
+		mcp.WithBoolean("include_archived",
+			mcp.Description("Also match entities hidden by archive_entity (default false)"),
+		),
+		mcp.WithBoolean("include_history",
+			mcp.Description("Also return observations a correction or follow-up has superseded (default false, only the latest item of each thread)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), searchNodesHandler(db, scopes))
+
+	s.AddTool(mcp.NewTool("open_nodes",
+		mcp.WithDescription(`Open specific nodes in the knowledge graph by their names.
+
+Returns each entity with its observations, the relations among the requested entities, and observationDetails giving every observation's id, tags, visibility, confidence and source. Names that do not exist are listed under notFound. Use it to recall several related entities in one call.`),
+		mcp.WithArray("names",
+			mcp.Required(),
+			mcp.Description("An array of entity names to retrieve"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithBoolean("include_history",
+			mcp.Description("Also return observations a correction or follow-up has superseded (default false, only the latest item of each thread)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), openNodesHandler(db, scopes))
+}
+
+func createEntitiesHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var args struct {
+			Entities []graphEntity `json:"entities"`
+		}
+		if err := request.BindArguments(&args); err != nil {
+			return toolErrorf(codeInvalidArgument, "invalid arguments: %v", err), nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		created := []graphEntity{}
+		for _, e := range args.Entities {
+			// A former name of a renamed entity is taken by it, like a name.
+			result, err := tx.ExecContext(ctx, `INSERT INTO entities (name, entity_type) SELECT ?, ?
+				WHERE NOT EXISTS (SELECT 1 FROM entity_aliases WHERE alias = ?) ON CONFLICT(name) DO NOTHING`, e.Name, e.EntityType, e.Name)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "entity '%s': %s", e.Name, formatExecError(err)), nil
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				continue
+			}
+			id, _ := result.LastInsertId()
+			for _, content := range e.Observations {
+				_, err := insertObservation(content, nil, func(content string, metadata any) (int64, error) {
+					stored, digest, err := storeContent(ctx, tx, content)
+					if err != nil {
+						return 0, err
+					}
+					result, err := tx.ExecContext(ctx, "INSERT INTO observations (entity_id, content, content_sha256, metadata) VALUES (?, ?, ?, ?)", id, stored, digest, metadata)
+					if err != nil {
+						return 0, execFailure(err)
+					}
+					return result.LastInsertId()
+				})
+				if err != nil {
+					return toolErrorf(errorCode(err, codeDatabase), "entity '%s': %v", e.Name, err), nil
+				}
+			}
+			if e.Observations == nil {
+				e.Observations = []string{}
+			}
+			created = append(created, e)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+		return graphResult(created), nil
+	}
+}
+
+func createRelationsHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var args struct {
+			Relations []graphRelation `json:"relations"`
+		}
+		if err := request.BindArguments(&args); err != nil {
+			return toolErrorf(codeInvalidArgument, "invalid arguments: %v", err), nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		var names []string
+		properties := make([]any, len(args.Relations))
+		for i, r := range args.Relations {
+			names = append(names, r.From, r.To)
+			if r.Weight != nil && (*r.Weight < 0 || *r.Weight > 1) {
+				return toolErrorf(codeInvalidArgument, "relation %s -%s-> %s: weight must be a number between 0 and 1", r.From, r.RelationType, r.To), nil
+			}
+			if len(r.Properties) > 0 && string(r.Properties) != "null" {
+				var obj map[string]any
+				if err := json.Unmarshal(r.Properties, &obj); err != nil {
+					return toolErrorf(codeInvalidArgument, "relation %s -%s-> %s: properties must be a JSON object", r.From, r.RelationType, r.To), nil
+				}
+				if properties[i], err = parseMetadata(obj); err != nil {
+					return toolErrorFrom(err, codeInvalidArgument), nil
+				}
+			}
+		}
+		ids, err := entityIDs(ctx, tx, names)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		created := []graphRelation{}
+		for i, r := range args.Relations {
+			result, err := tx.ExecContext(ctx, `INSERT INTO relations (from_id, to_id, relation_type, weight, properties)
+				SELECT ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM relations WHERE from_id = ? AND to_id = ? AND relation_type = ?)`,
+				ids[r.From], ids[r.To], r.RelationType, r.Weight, properties[i], ids[r.From], ids[r.To], r.RelationType)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "relation %s -%s-> %s: %s", r.From, r.RelationType, r.To, formatExecError(err)), nil
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				created = append(created, r)
+			}
+			if ok, err := insertInverse(ctx, tx, ids[r.From], ids[r.To], r.RelationType, r.Weight, properties[i]); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "inverse of relation %s -%s-> %s: %s", r.From, r.RelationType, r.To, formatExecError(err)), nil
+			} else if ok {
+				created = append(created, graphRelation{From: r.To, To: r.From, RelationType: relationInverses[r.RelationType], Weight: r.Weight, Properties: r.Properties})
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+		return graphResult(created), nil
+	}
+}
+
+func addObservationsHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var args struct {
+			Observations []struct {
+				EntityName string   `json:"entityName"`
+				Contents   []string `json:"contents"`
+			} `json:"observations"`
+		}
+		if err := request.BindArguments(&args); err != nil {
+			return toolErrorf(codeInvalidArgument, "invalid arguments: %v", err), nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		var names []string
+		for _, o := range args.Observations {
+			names = append(names, o.EntityName)
+		}
+		ids, err := entityIDs(ctx, tx, names)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		type added struct {
+			EntityName        string   `json:"entityName"`
+			AddedObservations []string `json:"addedObservations"`
+		}
+		results := []added{}
+		for _, o := range args.Observations {
+			a := added{EntityName: o.EntityName, AddedObservations: []string{}}
+			for _, content := range o.Contents {
+				added, err := insertObservation(content, nil, func(content string, metadata any) (int64, error) {
+					stored, digest, err := storeContent(ctx, tx, content)
+					if err != nil {
+						return 0, err
+					}
+					result, err := tx.ExecContext(ctx, `INSERT INTO observations (entity_id, content, content_sha256, metadata)
+						SELECT ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM observations WHERE entity_id = ? AND content = ?)`,
+						ids[o.EntityName], stored, digest, metadata, ids[o.EntityName], stored)
+					if err != nil {
+						return 0, execFailure(err)
+					}
+					if n, _ := result.RowsAffected(); n == 0 {
+						return 0, nil
+					}
+					return result.LastInsertId()
+				})
+				if err != nil {
+					return toolErrorf(errorCode(err, codeDatabase), "entity '%s': %v", o.EntityName, err), nil
+				}
+				if len(added) > 0 {
+					a.AddedObservations = append(a.AddedObservations, content)
+				}
+			}
+			results = append(results, a)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+		return graphResult(results), nil
+	}
+}
+
+const (
+	defaultGraphPageSize = 100
+	maxGraphPageSize     = 500
+)
+
+// graphMaxBytes caps the encoded size of a read_graph page. Pages that would
+// exceed it end early and report where to continue.
+var graphMaxBytes = getEnvInt("ENGRAM_GRAPH_MAX_BYTES", 256*1024)
+
+// graphPage is a read_graph result. NextOffset is set when more entities
+// remain; pass it back as offset to continue.
+type graphPage struct {
+	knowledgeGraph
+	NextOffset int `json:"nextOffset,omitempty"`
+}
+
+func readGraphHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		limit := request.GetInt("limit", defaultGraphPageSize)
+		if limit <= 0 {
+			limit = defaultGraphPageSize
+		}
+		if limit > maxGraphPageSize {
+			limit = maxGraphPageSize
+		}
+		offset := request.GetInt("offset", 0)
+		if offset < 0 {
+			return toolError(codeInvalidArgument, "offset must not be negative"), nil
+		}
+
+		var conds []string
+		var args []any
+		if types := parseTagNames(request.GetString("entity_type", "")); len(types) > 0 {
+			conds = append(conds, "e.entity_type IN ("+placeholders(len(types))+")")
+			for _, t := range types {
+				args = append(args, t)
+			}
+		}
+		if !request.GetBool("include_archived", false) {
+			conds = append(conds, "e.archived_at IS NULL")
+		}
+		q := graphQuery{history: request.GetBool("include_history", false)}
+		if tags := parseTagNames(request.GetString("tags", "")); len(tags) > 0 {
+			tagIDs, err := validateTags(ctx, db, tags)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			in := placeholders(len(tagIDs))
+			conds = append(conds, "EXISTS (SELECT 1 FROM observations x JOIN observation_tags ot ON ot.observation_id = x.id WHERE x.entity_id = e.id AND ot.tag_id IN ("+in+"))")
+			q.observations = "o.id IN (SELECT observation_id FROM observation_tags WHERE tag_id IN (" + in + "))"
+			for _, id := range tagIDs {
+				args = append(args, id)
+				q.obsArgs = append(q.obsArgs, id)
+			}
+		}
+		q.targets, q.targetArgs = "1", nil
+		if len(conds) > 0 {
+			q.targets, q.targetArgs = strings.Join(conds, " AND "), args
+		}
+
+		levels := scopes.levels(ctx)
+		rows, err := db.QueryContext(ctx, restrictVisibility("SELECT e.id FROM entities e WHERE "+q.targets+" ORDER BY e.id LIMIT ? OFFSET ?", levels),
+			append(append([]any{}, args...), limit+1, offset)...)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read graph: %v", err), nil
+		}
+		var ids []any
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return toolErrorf(errorCode(err, codeDatabase), "failed to read graph: %v", err), nil
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read graph: %v", err), nil
+		}
+
+		page := graphPage{knowledgeGraph: knowledgeGraph{Entities: []graphEntity{}, Relations: []graphRelation{}}}
+		if len(ids) == 0 {
+			return graphResult(page), nil
+		}
+		more := len(ids) > limit
+		if more {
+			ids = ids[:limit]
+		}
+
+		q.filter, q.args = "e.id IN ("+placeholders(len(ids))+")", ids
+		graph, err := loadGraph(ctx, db, levels, q)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read graph: %v", err), nil
+		}
+		page.knowledgeGraph = *graph
+
+		if kept := fitGraph(&page.knowledgeGraph, graphMaxBytes); kept < len(ids) {
+			page.NextOffset = offset + kept
+		} else if more {
+			page.NextOffset = offset + limit
+		}
+		return graphResult(page), nil
+	}
+}
+
+// fitGraph drops trailing entities, and the relations starting at them, until
+// the graph encodes to roughly maxBytes. The first entity is always kept so
+// paging makes progress. It returns the number of entities kept.
+func fitGraph(graph *knowledgeGraph, maxBytes int) int {
+	outgoing := make(map[string][]graphRelation)
+	for _, r := range graph.Relations {
+		outgoing[r.From] = append(outgoing[r.From], r)
+	}
+
+	size, kept := 0, 0
+	for _, e := range graph.Entities {
+		data, _ := json.Marshal(e)
+		n := len(data)
+		for _, r := range outgoing[e.Name] {
+			data, _ := json.Marshal(r)
+			n += len(data)
+		}
+		if kept > 0 && size+n > maxBytes {
+			break
+		}
+		size += n
+		kept++
+	}
+	if kept == len(graph.Entities) {
+		return kept
+	}
+
+	graph.Entities = graph.Entities[:kept]
+	keep := make(map[string]bool, kept)
+	for _, e := range graph.Entities {
+		keep[e.Name] = true
+	}
+	relations := []graphRelation{}
+	for _, r := range graph.Relations {
+		if keep[r.From] {
+			relations = append(relations, r)
+		}
+	}
+	graph.Relations = relations
+	return kept
+}
+
+// placeholders returns n comma-separated bind parameters for an IN list.
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+func searchNodesHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, err := request.RequireString("query")
+		if err != nil || strings.TrimSpace(query) == "" {
+			return toolError(codeInvalidArgument, "query parameter is required"), nil
+		}
+
+		pattern := "%" + likeEscaper.Replace(query) + "%"
+		filter := `(e.name LIKE ? ESCAPE '\' OR e.entity_type LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM observations x WHERE x.entity_id = e.id AND x.content LIKE ? ESCAPE '\')
+			OR e.id IN (SELECT rowid FROM entities_fts WHERE entities_fts MATCH ?)
+			OR e.id IN (SELECT a.entity_id FROM entity_aliases a WHERE a.alias LIKE ? ESCAPE '\')
+			OR e.id IN (SELECT x.entity_id FROM observations x
+				WHERE x.id IN (SELECT rowid FROM observations_fts WHERE observations_fts MATCH ?)))`
+		if !request.GetBool("include_archived", false) {
+			filter += " AND e.archived_at IS NULL"
+		}
+		graph, err := loadGraph(ctx, db, scopes.levels(ctx), graphQuery{
+			filter:  filter,
+			args:    []any{pattern, pattern, pattern, ftsPrefix(query), pattern, ftsPrefix(query)},
+			history: request.GetBool("include_history", false),
+		})
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to search graph: %v", err), nil
+		}
+		recordAccess(ctx, db, graph.observationIDs, graph.entityIDs)
+		return graphResult(graph), nil
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// openedNodes is an open_nodes result, listing requested names that do not
+// exist so the caller need not diff the response against its request.
+type openedNodes struct {
+	knowledgeGraph
+	NotFound []string `json:"notFound,omitempty"`
+}
+
+func openNodesHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		names := request.GetStringSlice("names", nil)
+		if len(names) == 0 {
+			return graphResult(&knowledgeGraph{Entities: []graphEntity{}, Relations: []graphRelation{}}), nil
+		}
+
+		// Former names open the entity too, under its current name.
+		args := make([]any, 2*len(names))
+		for i, n := range names {
+			args[i], args[len(names)+i] = n, n
+		}
+		in := placeholders(len(names))
+		filter := "(e.name IN (" + in + ") OR e.id IN (SELECT a.entity_id FROM entity_aliases a WHERE a.alias IN (" + in + ")))"
+		graph, err := loadGraph(ctx, db, scopes.levels(ctx), graphQuery{filter: filter, args: args, details: true, history: request.GetBool("include_history", false)})
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to open nodes: %v", err), nil
+		}
+		recordAccess(ctx, db, graph.observationIDs, graph.entityIDs)
+
+		found := make(map[string]bool, len(graph.Entities))
+		for _, e := range graph.Entities {
+			found[e.Name] = true
+			for _, a := range e.Aliases {
+				found[a] = true
+			}
+		}
+		result := openedNodes{knowledgeGraph: *graph}
+		for _, n := range names {
+			if !found[n] {
+				result.NotFound = append(result.NotFound, n)
+			}
+		}
+		return graphResult(result), nil
+	}
+}
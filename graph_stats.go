@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultGraphStatsTop = 10
+	maxGraphStatsTop     = 100
+)
+
+// degreeBuckets group entities by how many relations they take part in.
+var degreeBuckets = []struct {
+	label    string
+	min, max int
+}{
+	{"0", 0, 0}, {"1", 1, 1}, {"2", 2, 2}, {"3-5", 3, 5}, {"6-10", 6, 10}, {"11-50", 11, 50}, {"51+", 51, -1},
+}
+
+type entityDegree struct {
+	name, entityType string
+	in, out          int
+}
+
+func (d entityDegree) degree() int { return d.in + d.out }
+
+func graphStats(ctx context.Context, db *sql.DB, top int, includeArchived bool) (string, error) {
+	filter, relationFilter := "e.archived_at IS NULL", "f.archived_at IS NULL AND t.archived_at IS NULL"
+	if includeArchived {
+		filter, relationFilter = "1", "1"
+	}
+	rows, err := db.QueryContext(ctx, `SELECT e.name, e.entity_type,
+			(SELECT count(*) FROM relations r WHERE r.to_id = e.id),
+			(SELECT count(*) FROM relations r WHERE r.from_id = e.id)
+		FROM entities e WHERE `+filter+` ORDER BY e.id`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var degrees []entityDegree
+	for rows.Next() {
+		var d entityDegree
+		if err := rows.Scan(&d.name, &d.entityType, &d.in, &d.out); err != nil {
+			return "", err
+		}
+		degrees = append(degrees, d)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	var relations, types int
+	if err := db.QueryRowContext(ctx, `SELECT count(*), count(DISTINCT r.relation_type) FROM relations r
+		JOIN entities f ON f.id = r.from_id JOIN entities t ON t.id = r.to_id
+		WHERE `+relationFilter).Scan(&relations, &types); err != nil {
+		return "", err
+	}
+
+	return formatGraphStats(degrees, relations, types, top, includeArchived), nil
+}
+
+// formatGraphStats reports the degree of each entity and the number of
+// relations and relation types among them.
+func formatGraphStats(degrees []entityDegree, relations, types, top int, includeArchived bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "entities: %d", len(degrees))
+	if !includeArchived {
+		sb.WriteString(" (archived left out)")
+	}
+	fmt.Fprintf(&sb, "\nrelations: %d of %d types\n", relations, types)
+	if len(degrees) == 0 {
+		return sb.String()
+	}
+
+	total := 0
+	var isolated []entityDegree
+	counts := make([]int, len(degreeBuckets))
+	for _, d := range degrees {
+		total += d.degree()
+		if d.degree() == 0 {
+			isolated = append(isolated, d)
+		}
+		for i, b := range degreeBuckets {
+			if d.degree() >= b.min && (b.max < 0 || d.degree() <= b.max) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	fmt.Fprintf(&sb, "average degree: %.2f\n\ndegree distribution:\n", float64(total)/float64(len(degrees)))
+	for i, b := range degreeBuckets {
+		fmt.Fprintf(&sb, "  %s: %d\n", b.label, counts[i])
+	}
+
+	hubs := make([]entityDegree, 0, len(degrees))
+	for _, d := range degrees {
+		if d.degree() > 0 {
+			hubs = append(hubs, d)
+		}
+	}
+	sort.SliceStable(hubs, func(i, j int) bool { return hubs[i].degree() > hubs[j].degree() })
+	if len(hubs) > 0 {
+		sb.WriteString("\ntop hubs:\n")
+		for _, d := range hubs[:min(top, len(hubs))] {
+			fmt.Fprintf(&sb, "  %s (%s): %d relations, %d in, %d out\n", d.name, d.entityType, d.degree(), d.in, d.out)
+		}
+	}
+
+	fmt.Fprintf(&sb, "\nisolated entities: %d\n", len(isolated))
+	for _, d := range isolated[:min(top, len(isolated))] {
+		fmt.Fprintf(&sb, "  %s (%s)\n", d.name, d.entityType)
+	}
+	if len(isolated) > top {
+		fmt.Fprintf(&sb, "  ... and %d more\n", len(isolated)-top)
+	}
+	return sb.String()
+}
+
+// registerGraphStats adds the graph_stats tool.
+func registerGraphStats(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("graph_stats",
+		mcp.WithDescription(`Summarise the shape of the graph: entity and relation counts, how many relations entities take part in (degree distribution), the most connected hub entities, and isolated entities with no relations at all.
+
+Use it to find entities that were created but never wired into the graph.`),
+		mcp.WithNumber("top",
+			mcp.Description(fmt.Sprintf("How many hubs and isolated entities to list (default %d, max %d)", defaultGraphStatsTop, maxGraphStatsTop)),
+		),
+		mcp.WithBoolean("include_archived",
+			mcp.Description("Count archived entities too (default false)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), graphStatsHandler(db))
+}
+
+func graphStatsHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		top := request.GetInt("top", defaultGraphStatsTop)
+		if top < 1 || top > maxGraphStatsTop {
+			return toolErrorf(codeInvalidArgument, "top must be between 1 and %d", maxGraphStatsTop), nil
+		}
+		report, err := graphStats(ctx, db, top, request.GetBool("include_archived", false))
+		if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "query error: %v", err), nil
+		}
+		return mcp.NewToolResultText(report), nil
+	}
+}
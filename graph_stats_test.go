@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestFormatGraphStats(t *testing.T) {
+	degrees := []entityDegree{
+		{"nas", "Device", 4, 3},
+		{"ann", "Person", 1, 1},
+		{"pi", "Device", 0, 1},
+		{"old-laptop", "Device", 0, 0},
+		{"espresso", "Drink", 0, 0},
+		{"acme", "Company", 2, 0},
+	}
+	got := formatGraphStats(degrees, 7, 3, 2, false)
+	want := `entities: 6 (archived left out)
+relations: 7 of 3 types
+average degree: 2.00
+
+degree distribution:
+  0: 2
+  1: 1
+  2: 2
+  3-5: 0
+  6-10: 1
+  11-50: 0
+  51+: 0
+
+top hubs:
+  nas (Device): 7 relations, 4 in, 3 out
+  ann (Person): 2 relations, 1 in, 1 out
+
+isolated entities: 2
+  old-laptop (Device)
+  espresso (Drink)
+`
+	if got != want {
+		t.Errorf("formatGraphStats() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := formatGraphStats(nil, 0, 0, 10, true); got != "entities: 0\nrelations: 0 of 0 types\n" {
+		t.Errorf("empty graph = %q", got)
+	}
+	if got := formatGraphStats(degrees[3:5], 0, 0, 1, true); strings.Contains(got, "espresso") || !strings.Contains(got, "  ... and 1 more\n") {
+		t.Errorf("expected the isolated list cut at top:\n%s", got)
+	}
+}
+
+func TestGraphStats_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'graph-stats-test-%'")
+
+	isolated := func() int {
+		t.Helper()
+		result, err := callTool(graphStatsHandler(db), "graph_stats", map[string]any{"top": 1})
+		if err != nil || result.IsError {
+			t.Fatalf("graph_stats: %v %v", err, result.Content)
+		}
+		var n int
+		text := result.Content[0].(mcp.TextContent).Text
+		fmt.Sscanf(text[strings.Index(text, "isolated entities: "):], "isolated entities: %d", &n)
+		return n
+	}
+	before := isolated()
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('graph-stats-test-lonely', 'Thing')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if after := isolated(); after != before+1 {
+		t.Errorf("isolated entities went from %d to %d, want one more", before, after)
+	}
+
+	if result, _ := callTool(graphStatsHandler(db), "graph_stats", map[string]any{"top": 0}); !result.IsError {
+		t.Errorf("expected top 0 to be rejected")
+	}
+}
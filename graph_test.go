@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func decodeResult(t *testing.T, result *mcp.CallToolResult, v any) {
+	t.Helper()
+	if result.IsError {
+		t.Fatalf("tool failed: %v", result.Content)
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		t.Fatalf("expected text content, got %T", result.Content[0])
+	}
+	if err := json.Unmarshal([]byte(text.Text), v); err != nil {
+		t.Fatalf("decode %q: %v", text.Text, err)
+	}
+}
+
+func TestKnowledgeGraphTools_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'graph-test-%'")
+	defer db.Exec("DELETE FROM relations WHERE relation_type LIKE 'graph_test_%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'graph test %'")
+
+	t.Run("create_entities skips existing", func(t *testing.T) {
+		args := map[string]any{"entities": []any{
+			map[string]any{"name": "graph-test-alice", "entityType": "person", "observations": []any{"graph test likes tea"}},
+			map[string]any{"name": "graph-test-pi", "entityType": "device", "observations": []any{}},
+		}}
+		result, err := callTool(createEntitiesHandler(db), "create_entities", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var created []graphEntity
+		decodeResult(t, result, &created)
+		if len(created) != 2 {
+			t.Fatalf("expected 2 created, got %+v", created)
+		}
+
+		result, _ = callTool(createEntitiesHandler(db), "create_entities", args)
+		decodeResult(t, result, &created)
+		if len(created) != 0 {
+			t.Fatalf("expected existing entities skipped, got %+v", created)
+		}
+	})
+
+	t.Run("create_relations skips duplicates", func(t *testing.T) {
+		args := map[string]any{"relations": []any{
+			map[string]any{"from": "graph-test-alice", "to": "graph-test-pi", "relationType": "graph_test_uses"},
+		}}
+		var created []graphRelation
+		result, _ := callTool(createRelationsHandler(db), "create_relations", args)
+		decodeResult(t, result, &created)
+		if len(created) != 1 {
+			t.Fatalf("expected 1 relation, got %+v", created)
+		}
+		result, _ = callTool(createRelationsHandler(db), "create_relations", args)
+		decodeResult(t, result, &created)
+		if len(created) != 0 {
+			t.Fatalf("expected duplicate skipped, got %+v", created)
+		}
+	})
+
+	t.Run("create_relations unknown entity", func(t *testing.T) {
+		result, _ := callTool(createRelationsHandler(db), "create_relations", map[string]any{"relations": []any{
+			map[string]any{"from": "graph-test-alice", "to": "graph-test-nobody", "relationType": "graph_test_uses"},
+		}})
+		if !result.IsError {
+			t.Fatal("expected error for unknown entity")
+		}
+	})
+
+	t.Run("add_observations", func(t *testing.T) {
+		var added []struct {
+			EntityName        string   `json:"entityName"`
+			AddedObservations []string `json:"addedObservations"`
+		}
+		result, _ := callTool(addObservationsHandler(db), "add_observations", map[string]any{"observations": []any{
+			map[string]any{"entityName": "graph-test-pi", "contents": []any{"graph test runs pihole", "graph test runs pihole"}},
+		}})
+		decodeResult(t, result, &added)
+		if len(added) != 1 || len(added[0].AddedObservations) != 1 {
+			t.Fatalf("expected one observation added, got %+v", added)
+		}
+	})
+
+	t.Run("search_nodes", func(t *testing.T) {
+		var graph knowledgeGraph
+		result, _ := callTool(searchNodesHandler(db, nil), "search_nodes", map[string]any{"query": "PIHOLE"})
+		decodeResult(t, result, &graph)
+		if len(graph.Entities) != 1 || graph.Entities[0].Name != "graph-test-pi" {
+			t.Fatalf("expected graph-test-pi, got %+v", graph.Entities)
+		}
+		if len(graph.Relations) != 0 {
+			t.Errorf("expected no relations for a single node, got %+v", graph.Relations)
+		}
+	})
+
+	t.Run("open_nodes", func(t *testing.T) {
+		var graph knowledgeGraph
+		result, _ := callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": []any{"graph-test-alice", "graph-test-pi"}})
+		decodeResult(t, result, &graph)
+		if len(graph.Entities) != 2 || len(graph.Relations) != 1 {
+			t.Fatalf("expected 2 entities and 1 relation, got %+v", graph)
+		}
+		if len(graph.Entities[0].Observations) != 1 {
+			t.Errorf("expected alice's observation, got %+v", graph.Entities[0])
+		}
+	})
+
+	t.Run("open_nodes details and not found", func(t *testing.T) {
+		db.Exec(`INSERT INTO observation_tags (observation_id, tag_id)
+			SELECT o.id, t.id FROM observations o, tags t WHERE o.content = 'graph test likes tea' AND t.name = 'drinks'`)
+
+		var nodes openedNodes
+		result, _ := callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": []any{"graph-test-alice", "graph-test-nobody"}})
+		decodeResult(t, result, &nodes)
+		if len(nodes.NotFound) != 1 || nodes.NotFound[0] != "graph-test-nobody" {
+			t.Errorf("expected graph-test-nobody not found, got %v", nodes.NotFound)
+		}
+		if len(nodes.Entities) != 1 || len(nodes.Entities[0].Details) != 1 {
+			t.Fatalf("expected alice with one detailed observation, got %+v", nodes.Entities)
+		}
+		d := nodes.Entities[0].Details[0]
+		if len(d.Tags) != 1 || d.Tags[0] != "drinks" || d.Visibility != "private" {
+			t.Errorf("unexpected observation detail %+v", d)
+		}
+	})
+
+	t.Run("read_graph respects visibility", func(t *testing.T) {
+		scopes, err := parseVisibilityScopes("public", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var graph knowledgeGraph
+		result, _ := callTool(readGraphHandler(db, scopes), "read_graph", nil)
+		decodeResult(t, result, &graph)
+		for _, e := range graph.Entities {
+			if e.Name == "graph-test-alice" && len(e.Observations) != 0 {
+				t.Errorf("private observation leaked: %+v", e)
+			}
+		}
+	})
+
+	t.Run("weighted relations come first", func(t *testing.T) {
+		result, _ := callTool(createRelationsHandler(db), "create_relations", map[string]any{"relations": []any{
+			map[string]any{"from": "graph-test-alice", "to": "graph-test-pi", "relationType": "graph_test_knows", "weight": 0.2},
+			map[string]any{"from": "graph-test-pi", "to": "graph-test-alice", "relationType": "graph_test_works_with", "weight": 0.9,
+				"properties": map[string]any{"since": "2021"}},
+		}})
+		var created []graphRelation
+		decodeResult(t, result, &created)
+		if len(created) != 2 {
+			t.Fatalf("expected 2 relations, got %+v", created)
+		}
+
+		var graph knowledgeGraph
+		result, _ = callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": []any{"graph-test-alice", "graph-test-pi"}})
+		decodeResult(t, result, &graph)
+		var order []string
+		for _, r := range graph.Relations {
+			order = append(order, r.RelationType)
+		}
+		if strings.Join(order, " ") != "graph_test_works_with graph_test_knows graph_test_uses" {
+			t.Fatalf("relations in order %v, want strongest first and unweighted last", order)
+		}
+		var props map[string]any
+		if r := graph.Relations[0]; r.Weight == nil || *r.Weight != 0.9 || json.Unmarshal(r.Properties, &props) != nil || props["since"] != "2021" {
+			t.Errorf("unexpected weight or properties %+v", r)
+		}
+		if graph.Relations[2].Weight != nil || graph.Relations[2].Properties != nil {
+			t.Errorf("unweighted relation reported a weight or properties: %+v", graph.Relations[2])
+		}
+
+		for _, bad := range []map[string]any{
+			{"from": "graph-test-alice", "to": "graph-test-pi", "relationType": "graph_test_bad", "weight": 1.5},
+			{"from": "graph-test-alice", "to": "graph-test-pi", "relationType": "graph_test_bad", "properties": []any{"x"}},
+		} {
+			if result, _ := callTool(createRelationsHandler(db), "create_relations", map[string]any{"relations": []any{bad}}); !result.IsError {
+				t.Errorf("expected %v to be rejected", bad)
+			}
+		}
+	})
+}
+
+func TestReadGraphPaging_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'page-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'page test %'")
+
+	for _, name := range []string{"page-test-a", "page-test-b", "page-test-c"} {
+		result, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES (?, 'pagetest')", name)
+		if err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		result, err = db.Exec("INSERT INTO observations (entity_id, content) VALUES (?, ?)", id, "page test "+name)
+		if err != nil {
+			t.Fatalf("insert observation: %v", err)
+		}
+		if name == "page-test-b" {
+			obsID, _ := result.LastInsertId()
+			db.Exec("INSERT INTO observation_tags (observation_id, tag_id) SELECT ?, id FROM tags WHERE name = 'homelab'", obsID)
+		}
+	}
+
+	t.Run("pages by type", func(t *testing.T) {
+		var names []string
+		offset := 0
+		for i := 0; i < 5; i++ {
+			var page graphPage
+			result, _ := callTool(readGraphHandler(db, nil), "read_graph", map[string]any{"entity_type": "pagetest", "limit": float64(2), "offset": float64(offset)})
+			decodeResult(t, result, &page)
+			for _, e := range page.Entities {
+				names = append(names, e.Name)
+			}
+			if page.NextOffset == 0 {
+				break
+			}
+			offset = page.NextOffset
+		}
+		if len(names) != 3 {
+			t.Fatalf("expected 3 entities across pages, got %v", names)
+		}
+	})
+
+	t.Run("tag filter", func(t *testing.T) {
+		var page graphPage
+		result, _ := callTool(readGraphHandler(db, nil), "read_graph", map[string]any{"entity_type": "pagetest", "tags": "homelab"})
+		decodeResult(t, result, &page)
+		if len(page.Entities) != 1 || page.Entities[0].Name != "page-test-b" {
+			t.Fatalf("expected only page-test-b, got %+v", page.Entities)
+		}
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		result, _ := callTool(readGraphHandler(db, nil), "read_graph", map[string]any{"tags": "nonexistent-tag"})
+		if !result.IsError {
+			t.Fatal("expected error for unknown tag")
+		}
+	})
+}
+
+func TestFitGraph(t *testing.T) {
+	graph := &knowledgeGraph{
+		Entities: []graphEntity{
+			{Name: "a", EntityType: "t", Observations: []string{strings.Repeat("x", 100)}},
+			{Name: "b", EntityType: "t", Observations: []string{strings.Repeat("x", 100)}},
+			{Name: "c", EntityType: "t", Observations: []string{strings.Repeat("x", 100)}},
+		},
+		Relations: []graphRelation{{From: "a", To: "c", RelationType: "r"}, {From: "c", To: "a", RelationType: "r"}},
+	}
+	if kept := fitGraph(graph, 10); kept != 1 {
+		t.Fatalf("fitGraph kept %d, want the first entity only", kept)
+	}
+	if len(graph.Relations) != 1 || graph.Relations[0].From != "a" {
+		t.Errorf("expected only a's relation, got %+v", graph.Relations)
+	}
+	if kept := fitGraph(graph, 1<<20); kept != 1 {
+		t.Errorf("fitGraph on a fitting graph kept %d", kept)
+	}
+}
+
+func TestLikeEscaper(t *testing.T) {
+	if got := likeEscaper.Replace(`100%_a\b`); got != `100\%\_a\\b` {
+		t.Errorf("likeEscaper = %q", got)
+	}
+}
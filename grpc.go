@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	engramv1 "github.com/mrdvince/memory-mcp/proto/engram/v1"
+)
+
+// grpcAddr is ENGRAM_GRPC_ADDR: when set, serve also answers the Memory
+// service of proto/engram/v1 on this address, e.g. "127.0.0.1:9090", for
+// services that do not speak MCP. grpcToken is ENGRAM_GRPC_TOKEN: when set,
+// calls need it as a bearer token in the authorization metadata.
+var (
+	grpcAddr  = getEnv("ENGRAM_GRPC_ADDR", "")
+	grpcToken = getEnv("ENGRAM_GRPC_TOKEN", "")
+)
+
+// grpcMemory serves the Memory service through the tools registered on an
+// MCP server, wrapped in the same middleware as MCP calls, as restAPI does.
+// Callers have no client name, so they get the default visibility scope and
+// tools.
+type grpcMemory struct {
+	engramv1.UnimplementedMemoryServer
+	server     *server.MCPServer
+	middleware []server.ToolHandlerMiddleware
+}
+
+var grpcTools = []string{"search_nodes", "open_nodes", "read_graph", "add_observation", "upsert_entity", "create_relations"}
+
+func newGRPCMemory(s *server.MCPServer, middleware ...server.ToolHandlerMiddleware) (*grpcMemory, error) {
+	for _, name := range grpcTools {
+		if s.GetTool(name) == nil {
+			return nil, fmt.Errorf("tool %s is not registered", name)
+		}
+	}
+	return &grpcMemory{server: s, middleware: middleware}, nil
+}
+
+// newGRPCServer registers memory on a gRPC server that checks token, unless
+// it is empty.
+func newGRPCServer(memory *grpcMemory, token string) *grpc.Server {
+	var opts []grpc.ServerOption
+	if token != "" {
+		opts = append(opts, grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			for _, v := range md.Get("authorization") {
+				if given, ok := strings.CutPrefix(v, "Bearer "); ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+					return handler(ctx, req)
+				}
+			}
+			return nil, status.Error(codes.Unauthenticated, "missing or wrong bearer token, see ENGRAM_GRPC_TOKEN")
+		}))
+	}
+	srv := grpc.NewServer(opts...)
+	engramv1.RegisterMemoryServer(srv, memory)
+	return srv
+}
+
+func serveGRPC(ctx context.Context, ln net.Listener, srv *grpc.Server) {
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+	log.Printf("gRPC API listening on %s", ln.Addr())
+	if err := srv.Serve(ln); err != nil {
+		log.Printf("gRPC API stopped: %v", err)
+	}
+}
+
+// call runs tool with args and decodes its JSON result into out. A failed
+// tool call becomes a status with the gRPC code nearest its error code.
+func (m *grpcMemory) call(ctx context.Context, tool string, args map[string]any, out any) error {
+	registered := m.server.GetTool(tool)
+	if registered == nil {
+		return status.Errorf(codes.Unimplemented, "tool %s is not registered", tool)
+	}
+	handle := registered.Handler
+	for i := len(m.middleware) - 1; i >= 0; i-- {
+		handle = m.middleware[i](handle)
+	}
+	request := mcp.CallToolRequest{}
+	request.Params.Name = tool
+	request.Params.Arguments = args
+
+	result, err := handle(ctx, request)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	var text strings.Builder
+	for _, c := range result.Content {
+		if t, ok := c.(mcp.TextContent); ok {
+			text.WriteString(t.Text)
+		}
+	}
+	if result.IsError {
+		code := resultErrorCode(result)
+		return status.Error(grpcCode(code), strings.TrimPrefix(text.String(), code+": "))
+	}
+	if err := json.Unmarshal([]byte(text.String()), out); err != nil {
+		return status.Errorf(codes.Internal, "%s returned %q: %v", tool, text.String(), err)
+	}
+	return nil
+}
+
+// grpcCode maps a tool error code to a gRPC one, as errorStatus does to
+// HTTP statuses.
+func grpcCode(code string) codes.Code {
+	switch code {
+	case codeNotFound:
+		return codes.NotFound
+	case codeToolDisabled:
+		return codes.PermissionDenied
+	case codeConstraintUnique:
+		return codes.AlreadyExists
+	case codeConflict, codeConstraintForeignKey, codeConstraintCheck, codeConstraintNotNull:
+		return codes.FailedPrecondition
+	case codeQuotaExceeded:
+		return codes.ResourceExhausted
+	case codeUnavailable:
+		return codes.Unimplemented
+	case codeUpstream, codeDatabase:
+		return codes.Unavailable
+	}
+	return codes.InvalidArgument
+}
+
+// grpcJSONObject parses an optional JSON object parameter.
+func grpcJSONObject(name, s string) (map[string]any, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(s), &obj); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s must be a JSON object: %v", name, err)
+	}
+	return obj, nil
+}
+
+// jsonText is a JSON value from a tool result as compact text, "" for none.
+func jsonText(raw json.RawMessage) string {
+	var b bytes.Buffer
+	if len(raw) == 0 || string(raw) == "null" || json.Compact(&b, raw) != nil {
+		return string(raw)
+	}
+	return b.String()
+}
+
+func (m *grpcMemory) SearchNodes(ctx context.Context, req *engramv1.SearchNodesRequest) (*engramv1.Graph, error) {
+	var g knowledgeGraph
+	if err := m.call(ctx, "search_nodes", map[string]any{"query": req.Query, "include_archived": req.IncludeArchived}, &g); err != nil {
+		return nil, err
+	}
+	return graphProto(g), nil
+}
+
+func (m *grpcMemory) OpenNodes(ctx context.Context, req *engramv1.OpenNodesRequest) (*engramv1.Graph, error) {
+	names := make([]any, len(req.Names))
+	for i, n := range req.Names {
+		names[i] = n
+	}
+	var opened openedNodes
+	if err := m.call(ctx, "open_nodes", map[string]any{"names": names}, &opened); err != nil {
+		return nil, err
+	}
+	g := graphProto(opened.knowledgeGraph)
+	g.NotFound = opened.NotFound
+	return g, nil
+}
+
+func (m *grpcMemory) ReadGraph(ctx context.Context, req *engramv1.ReadGraphRequest) (*engramv1.Graph, error) {
+	args := map[string]any{"include_archived": req.IncludeArchived}
+	if req.Limit > 0 {
+		args["limit"] = float64(req.Limit)
+	}
+	if req.Offset > 0 {
+		args["offset"] = float64(req.Offset)
+	}
+	if req.EntityType != "" {
+		args["entity_type"] = req.EntityType
+	}
+	if req.Tags != "" {
+		args["tags"] = req.Tags
+	}
+	var page graphPage
+	if err := m.call(ctx, "read_graph", args, &page); err != nil {
+		return nil, err
+	}
+	g := graphProto(page.knowledgeGraph)
+	g.NextOffset = int32(page.NextOffset)
+	return g, nil
+}
+
+func (m *grpcMemory) AddObservation(ctx context.Context, req *engramv1.AddObservationRequest) (*engramv1.AddObservationResponse, error) {
+	args := map[string]any{"entity": req.Entity, "content": req.Content, "return_record": true}
+	for k, v := range map[string]string{"tags": req.Tags, "visibility": req.Visibility, "source": req.Source,
+		"conversation_id": req.ConversationId, "source_url": req.SourceUrl, "parent": req.Parent} {
+		if v != "" {
+			args[k] = v
+		}
+	}
+	if req.Confidence != nil {
+		args["confidence"] = *req.Confidence
+	}
+	meta, err := grpcJSONObject("metadata", req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		args["metadata"] = meta
+	}
+	// One observation comes back as an object, one split into parts as a
+	// list.
+	var raw json.RawMessage
+	if err := m.call(ctx, "add_observation", args, &raw); err != nil {
+		return nil, err
+	}
+	var records []observationRecord
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		err = json.Unmarshal(raw, &records)
+	} else {
+		records = make([]observationRecord, 1)
+		err = json.Unmarshal(raw, &records[0])
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "add_observation returned %s: %v", raw, err)
+	}
+	resp := &engramv1.AddObservationResponse{}
+	for _, r := range records {
+		resp.Observations = append(resp.Observations, &engramv1.Observation{
+			Id: r.ID, Entity: r.Entity, Content: r.Content, Tags: r.Tags, Visibility: r.Visibility,
+			Confidence: r.Confidence, Source: r.Source, ConversationId: r.ConversationID, SourceUrl: r.SourceURL,
+			Metadata: jsonText(r.Metadata), CreatedAt: r.CreatedAt, ParentId: r.ParentID,
+		})
+	}
+	return resp, nil
+}
+
+func (m *grpcMemory) UpsertEntity(ctx context.Context, req *engramv1.UpsertEntityRequest) (*engramv1.UpsertEntityResponse, error) {
+	args := map[string]any{"name": req.Name, "entity_type": req.EntityType, "return_record": true}
+	if req.OnConflict != "" {
+		args["on_conflict"] = req.OnConflict
+	}
+	if req.Tags != "" {
+		args["tags"] = req.Tags
+	}
+	attrs, err := grpcJSONObject("attributes", req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	if attrs != nil {
+		args["attributes"] = attrs
+	}
+	var r entityRecord
+	if err := m.call(ctx, "upsert_entity", args, &r); err != nil {
+		return nil, err
+	}
+	return &engramv1.UpsertEntityResponse{Id: r.ID, Name: r.Name, EntityType: r.EntityType, Tags: r.Tags, Created: r.Created, CreatedAt: r.CreatedAt}, nil
+}
+
+func (m *grpcMemory) CreateRelations(ctx context.Context, req *engramv1.CreateRelationsRequest) (*engramv1.CreateRelationsResponse, error) {
+	relations := make([]any, len(req.Relations))
+	for i, r := range req.Relations {
+		rel := map[string]any{"from": r.From, "to": r.To, "relationType": r.RelationType}
+		if r.Weight != nil {
+			rel["weight"] = *r.Weight
+		}
+		props, err := grpcJSONObject("properties", r.Properties)
+		if err != nil {
+			return nil, err
+		}
+		if props != nil {
+			rel["properties"] = props
+		}
+		relations[i] = rel
+	}
+	var created []graphRelation
+	if err := m.call(ctx, "create_relations", map[string]any{"relations": relations}, &created); err != nil {
+		return nil, err
+	}
+	resp := &engramv1.CreateRelationsResponse{}
+	for _, r := range created {
+		resp.Relations = append(resp.Relations, relationProto(r))
+	}
+	return resp, nil
+}
+
+func graphProto(g knowledgeGraph) *engramv1.Graph {
+	out := &engramv1.Graph{}
+	for _, e := range g.Entities {
+		entity := &engramv1.Entity{Name: e.Name, EntityType: e.EntityType, Observations: e.Observations, ArchivedAt: e.ArchivedAt, Aliases: e.Aliases}
+		for _, o := range e.Details {
+			entity.ObservationDetails = append(entity.ObservationDetails, &engramv1.Observation{
+				Id: o.ID, Entity: e.Name, Content: o.Content, Tags: o.Tags, Visibility: o.Visibility, Confidence: o.Confidence,
+				Source: o.Source, Metadata: jsonText(o.Metadata), CreatedAt: o.CreatedAt,
+				VerifiedAt: o.VerifiedAt, VerifiedBy: o.VerifiedBy, ParentId: o.ParentID,
+			})
+		}
+		out.Entities = append(out.Entities, entity)
+	}
+	for _, r := range g.Relations {
+		out.Relations = append(out.Relations, relationProto(r))
+	}
+	return out
+}
+
+func relationProto(r graphRelation) *engramv1.Relation {
+	return &engramv1.Relation{From: r.From, To: r.To, RelationType: r.RelationType, Weight: r.Weight, Properties: jsonText(r.Properties), Implied: r.Implied}
+}
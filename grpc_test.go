@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	engramv1 "github.com/mrdvince/memory-mcp/proto/engram/v1"
+)
+
+func grpcClient(t *testing.T, token string) engramv1.MemoryClient {
+	t.Helper()
+	weight := 0.8
+	s := server.NewMCPServer("test", "1.0.0")
+	s.AddTool(mcp.NewTool("search_nodes"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if request.GetString("query", "") == "down" {
+			return toolError(codeDatabase, "search failed: connection refused"), nil
+		}
+		return graphResult(knowledgeGraph{
+			Entities:  []graphEntity{{Name: "Home NAS", EntityType: "device", Observations: []string{"Runs ZFS"}}},
+			Relations: []graphRelation{{From: "Home NAS", To: "Alice", RelationType: "owned_by", Weight: &weight, Properties: []byte(`{"since":2021}`)}},
+		}), nil
+	})
+	s.AddTool(mcp.NewTool("open_nodes"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return graphResult(openedNodes{knowledgeGraph: knowledgeGraph{Entities: []graphEntity{}, Relations: []graphRelation{}}, NotFound: request.GetStringSlice("names", nil)}), nil
+	})
+	s.AddTool(mcp.NewTool("add_observation"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		meta, _ := args["metadata"].(map[string]any)
+		if meta["host"] != "nas" || args["return_record"] != true {
+			return toolErrorf(codeInvalidArgument, "unexpected arguments %v", args), nil
+		}
+		return graphResult(observationRecord{ID: 7, Entity: request.GetString("entity", ""), Content: request.GetString("content", ""),
+			Visibility: "private", Tags: []string{"homelab"}, Metadata: []byte(`{"host":"nas"}`)}), nil
+	})
+	for _, name := range []string{"read_graph", "upsert_entity", "create_relations"} {
+		s.AddTool(mcp.NewTool(name), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return toolError(codeToolDisabled, name+" is disabled"), nil
+		})
+	}
+	memory, err := newGRPCMemory(s)
+	if err != nil {
+		t.Fatalf("newGRPCMemory: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := newGRPCServer(memory, token)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return engramv1.NewMemoryClient(conn)
+}
+
+func TestGRPCMemory(t *testing.T) {
+	client := grpcClient(t, "")
+	ctx := context.Background()
+
+	graph, err := client.SearchNodes(ctx, &engramv1.SearchNodesRequest{Query: "nas"})
+	if err != nil {
+		t.Fatalf("SearchNodes: %v", err)
+	}
+	if len(graph.Entities) != 1 || graph.Entities[0].Name != "Home NAS" || graph.Entities[0].Observations[0] != "Runs ZFS" {
+		t.Errorf("entities = %v", graph.Entities)
+	}
+	if r := graph.Relations; len(r) != 1 || r[0].GetWeight() != 0.8 || r[0].Properties != `{"since":2021}` {
+		t.Errorf("relations = %v", r)
+	}
+
+	opened, err := client.OpenNodes(ctx, &engramv1.OpenNodesRequest{Names: []string{"Nobody"}})
+	if err != nil || len(opened.NotFound) != 1 || opened.NotFound[0] != "Nobody" {
+		t.Errorf("OpenNodes = %v, %v", opened, err)
+	}
+
+	added, err := client.AddObservation(ctx, &engramv1.AddObservationRequest{Entity: "Home NAS", Content: "Port 8080", Metadata: `{"host": "nas"}`})
+	if err != nil {
+		t.Fatalf("AddObservation: %v", err)
+	}
+	if o := added.Observations; len(o) != 1 || o[0].Id != 7 || o[0].Entity != "Home NAS" || o[0].Metadata != `{"host":"nas"}` {
+		t.Errorf("observations = %v", o)
+	}
+	if _, err := client.AddObservation(ctx, &engramv1.AddObservationRequest{Entity: "Home NAS", Content: "x", Metadata: "[1]"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("metadata that is not an object: %v", err)
+	}
+
+	for _, tc := range []struct {
+		call func() error
+		want codes.Code
+	}{
+		{func() error {
+			_, err := client.SearchNodes(ctx, &engramv1.SearchNodesRequest{Query: "down"})
+			return err
+		}, codes.Unavailable},
+		{func() error { _, err := client.ReadGraph(ctx, &engramv1.ReadGraphRequest{}); return err }, codes.PermissionDenied},
+	} {
+		if err := tc.call(); status.Code(err) != tc.want {
+			t.Errorf("error = %v, want %s", err, tc.want)
+		}
+	}
+}
+
+func TestGRPCToken(t *testing.T) {
+	client := grpcClient(t, "s3cret")
+	for token, want := range map[string]codes.Code{"": codes.Unauthenticated, "wrong": codes.Unauthenticated, "s3cret": codes.OK} {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		}
+		if _, err := client.SearchNodes(ctx, &engramv1.SearchNodesRequest{Query: "nas"}); status.Code(err) != want {
+			t.Errorf("token %q: %v, want %s", token, err, want)
+		}
+	}
+}
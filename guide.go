@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// maxGuideTags caps the tags tool descriptions list, oldest first.
+	maxGuideTags = 20
+	// maxGuideDescription truncates each tag's or table's description.
+	maxGuideDescription = 100
+	// maxGuideEntityTypes caps the entity types named, most used first.
+	maxGuideEntityTypes = 8
+)
+
+// guideItem is a tag or a user table, with its description.
+type guideItem struct {
+	name, description string
+}
+
+// guide holds what tool and resource descriptions say about the database's
+// contents: its top-level tags, its most used entity types and the tables
+// added with define_table. They are read from the database rather than
+// fixed in the code, so the guidance matches it: serve loads them on
+// startup and reloads them when they change, telling clients to fetch the
+// new descriptions.
+type guide struct {
+	mu          sync.RWMutex
+	tags        []guideItem
+	entityTypes []string
+	tables      []guideItem
+}
+
+var liveGuide guide
+
+// guideTools builds the tools whose descriptions come from the guide, so
+// serve can register them again when it changes.
+type guideTools []func() server.ServerTool
+
+// add registers the tool build returns and keeps build for rebuild.
+func (t *guideTools) add(s *server.MCPServer, build func() server.ServerTool) {
+	*t = append(*t, build)
+	s.AddTools(build())
+}
+
+// rebuild registers every tool again with the guide's current contents.
+func (t guideTools) rebuild(s *server.MCPServer) {
+	tools := make([]server.ServerTool, len(t))
+	for i, build := range t {
+		tools[i] = build()
+	}
+	s.AddTools(tools...)
+}
+
+// guideChange says which parts of the guide a reload changed.
+type guideChange struct {
+	tags, entityTypes, tables bool
+}
+
+func (c guideChange) any() bool {
+	return c.tags || c.entityTypes || c.tables
+}
+
+func (g *guide) get() (tags []guideItem, entityTypes []string, tables []guideItem) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.tags, g.entityTypes, g.tables
+}
+
+// set replaces the guide's contents and reports what changed.
+func (g *guide) set(tags []guideItem, entityTypes []string, tables []guideItem) guideChange {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	change := guideChange{
+		tags:        !reflect.DeepEqual(g.tags, tags),
+		entityTypes: !reflect.DeepEqual(g.entityTypes, entityTypes),
+		tables:      !reflect.DeepEqual(g.tables, tables),
+	}
+	g.tags, g.entityTypes, g.tables = tags, entityTypes, tables
+	return change
+}
+
+// load reads the guide from db and reports what changed.
+func (g *guide) load(ctx context.Context, db *sql.DB) (guideChange, error) {
+	tags, err := loadGuideItems(ctx, db, "SELECT name, description FROM tags WHERE parent_id IS NULL ORDER BY id LIMIT ?", maxGuideTags)
+	if err != nil {
+		return guideChange{}, fmt.Errorf("reading tags: %v", err)
+	}
+	tables, err := loadGuideItems(ctx, db, "SELECT name, description FROM user_tables ORDER BY name")
+	if err != nil {
+		return guideChange{}, fmt.Errorf("reading user_tables: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT entity_type FROM entities WHERE archived_at IS NULL
+		GROUP BY entity_type ORDER BY count(*) DESC, entity_type LIMIT ?`, maxGuideEntityTypes)
+	if err != nil {
+		return guideChange{}, fmt.Errorf("reading entity types: %v", err)
+	}
+	defer rows.Close()
+	var entityTypes []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return guideChange{}, err
+		}
+		entityTypes = append(entityTypes, t)
+	}
+	if err := rows.Err(); err != nil {
+		return guideChange{}, err
+	}
+	// Sorted, so the description changes when the set does, not whenever
+	// two types swap places by count.
+	sort.Strings(entityTypes)
+
+	return g.set(tags, entityTypes, tables), nil
+}
+
+func loadGuideItems(ctx context.Context, db *sql.DB, query string, args ...any) ([]guideItem, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []guideItem
+	for rows.Next() {
+		var item guideItem
+		if err := rows.Scan(&item.name, &item.description); err != nil {
+			return nil, err
+		}
+		item.description = truncateText(strings.TrimSpace(item.description), maxGuideDescription)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (g *guide) tagNames() []string {
+	tags, _, _ := g.get()
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.name
+	}
+	return names
+}
+
+// tagCategories is the sentence errors use to name the broad categories,
+// empty while there are no tags.
+func (g *guide) tagCategories() string {
+	names := g.tagNames()
+	if len(names) == 0 {
+		return ""
+	}
+	return "Use broad categories like: " + strings.Join(names, ", ") + ". "
+}
+
+// tagList is the execute description's list of tags, with their
+// descriptions.
+func (g *guide) tagList() string {
+	tags, _, _ := g.get()
+	if len(tags) == 0 {
+		return "There are no tags yet.\n"
+	}
+	var b strings.Builder
+	b.WriteString("Tags are broad categories. The top-level tags in this database:\n")
+	writeGuideItems(&b, tags)
+	return b.String()
+}
+
+// tagsHelp describes a tags parameter, with examples from the tags there
+// are.
+func (g *guide) tagsHelp() string {
+	names := g.tagNames()
+	switch len(names) {
+	case 0:
+		return "Comma-separated tag names"
+	case 1:
+		return fmt.Sprintf("Comma-separated tag names, e.g. '%s'", names[0])
+	}
+	return fmt.Sprintf("Comma-separated tag names, e.g. '%s' or '%s,%s'", names[0], names[0], names[1])
+}
+
+// observationTagsOption is the tags parameter of the tools that store
+// observations, required when ENGRAM_TAG_POLICY covers observations and
+// the client's model does not choose them.
+func observationTagsOption() mcp.ToolOption {
+	help := liveGuide.tagsHelp()
+	if samplingTags {
+		help += ". If omitted, the client's model chooses from the existing tags"
+	}
+	opts := []mcp.PropertyOption{mcp.Description(help)}
+	if requiredTags.requires("observations") && !samplingTags {
+		opts = append(opts, mcp.Required())
+	}
+	return mcp.WithString("tags", opts...)
+}
+
+// entityTypeHelp describes an entity_type parameter, naming the types
+// already in use so agents reuse them instead of inventing variants.
+func (g *guide) entityTypeHelp() string {
+	_, types, _ := g.get()
+	if len(types) == 0 {
+		return "Entity type, e.g. Person, Device, Project"
+	}
+	return "Entity type. Reuse one already in use where it fits: " + strings.Join(types, ", ")
+}
+
+// tableList names the tables added with define_table for the query tool,
+// empty while there are none.
+func (g *guide) tableList() string {
+	_, _, tables := g.get()
+	if len(tables) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nTables added with define_table, with their columns in memory://schema:\n")
+	writeGuideItems(&b, tables)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// schemaDescription describes memory://schema, naming the user tables so
+// the resource list changes with them.
+func (g *guide) schemaDescription() string {
+	_, _, tables := g.get()
+	if len(tables) == 0 {
+		return "Table definitions for the memory database"
+	}
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.name
+	}
+	return "Table definitions for the memory database, including the tables added with define_table: " + strings.Join(names, ", ")
+}
+
+func writeGuideItems(b *strings.Builder, items []guideItem) {
+	for _, item := range items {
+		if item.description != "" {
+			fmt.Fprintf(b, "- %s: %s\n", item.name, item.description)
+		} else {
+			fmt.Fprintf(b, "- %s\n", item.name)
+		}
+	}
+}
+
+// guideChanges reads the last logged write to tags or entities after the
+// given change id, and a stand-in for the state of user_tables, whose
+// writes are not logged: its row count and last update.
+const guideChanges = `SELECT
+	(SELECT COALESCE(MAX(id), 0) FROM changes WHERE table_name IN ('tags', 'entities') AND id > ?),
+	(SELECT count(*) || ' ' || COALESCE(MAX(updated_at), '') FROM user_tables)`
+
+// watch polls for writes that can change the guide, by this or any other
+// process sharing the database, reloads it after one, and calls changed
+// with what is different.
+func (g *guide) watch(ctx context.Context, db *sql.DB, interval time.Duration, changed func(guideChange)) {
+	var last int64
+	var tables string
+	if err := db.QueryRowContext(ctx, guideChanges, 0).Scan(&last, &tables); err != nil {
+		log.Printf("guide watcher disabled: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var id int64
+		var t string
+		if err := db.QueryRowContext(ctx, guideChanges, last).Scan(&id, &t); err != nil {
+			log.Printf("guide watcher: %v", err)
+			continue
+		}
+		if id == 0 && t == tables {
+			continue
+		}
+		change, err := g.load(ctx, db)
+		if err != nil {
+			log.Printf("guide watcher: %v", err)
+			continue
+		}
+		if id > 0 {
+			last = id
+		}
+		tables = t
+		if change.any() {
+			changed(change)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuideTags(t *testing.T) {
+	tests := []struct {
+		name       string
+		tags       []guideItem
+		help       string
+		categories string
+		list       []string
+	}{
+		{"no tags", nil, "Comma-separated tag names", "", []string{"There are no tags yet."}},
+		{"one tag", []guideItem{{"work", "Jobs"}}, "Comma-separated tag names, e.g. 'work'",
+			"Use broad categories like: work. ", []string{"- work: Jobs\n"}},
+		{"several", []guideItem{{"work", "Jobs"}, {"travel", ""}}, "Comma-separated tag names, e.g. 'work' or 'work,travel'",
+			"Use broad categories like: work, travel. ", []string{"- work: Jobs\n", "- travel\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g guide
+			g.set(tt.tags, nil, nil)
+			if got := g.tagsHelp(); got != tt.help {
+				t.Errorf("tagsHelp = %q, want %q", got, tt.help)
+			}
+			if got := g.tagCategories(); got != tt.categories {
+				t.Errorf("tagCategories = %q, want %q", got, tt.categories)
+			}
+			for _, want := range tt.list {
+				if got := g.tagList(); !strings.Contains(got, want) {
+					t.Errorf("tagList = %q, want it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGuideSet(t *testing.T) {
+	var g guide
+	tags := []guideItem{{"work", "Jobs"}}
+	if change := g.set(tags, nil, nil); change != (guideChange{tags: true}) {
+		t.Errorf("first set = %+v", change)
+	}
+	if change := g.set(tags, nil, nil); change.any() {
+		t.Errorf("same contents = %+v", change)
+	}
+	change := g.set(tags, []string{"person"}, []guideItem{{"recipes", "Dishes"}})
+	if change != (guideChange{entityTypes: true, tables: true}) {
+		t.Errorf("new types and tables = %+v", change)
+	}
+
+	if got := g.entityTypeHelp(); got != "Entity type. Reuse one already in use where it fits: person" {
+		t.Errorf("entityTypeHelp = %q", got)
+	}
+	if got := g.tableList(); !strings.Contains(got, "- recipes: Dishes") {
+		t.Errorf("tableList = %q", got)
+	}
+	if got := g.schemaDescription(); !strings.HasSuffix(got, "define_table: recipes") {
+		t.Errorf("schemaDescription = %q", got)
+	}
+
+	g.set(nil, nil, nil)
+	if got := g.entityTypeHelp(); got != "Entity type, e.g. Person, Device, Project" {
+		t.Errorf("entityTypeHelp without entities = %q", got)
+	}
+	if got := g.tableList(); got != "" {
+		t.Errorf("tableList without tables = %q", got)
+	}
+}
+
+func TestGuideWatch_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cleanup := func() {
+		db.Exec("DELETE FROM tags WHERE name = 'guide-test'")
+		db.Exec("DELETE FROM user_tables WHERE name = 'guide_test'")
+	}
+	cleanup()
+	defer cleanup()
+
+	var g guide
+	if _, err := g.load(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.tagNames()) >= maxGuideTags {
+		t.Skipf("the test database already has %d top-level tags", len(g.tagNames()))
+	}
+
+	changes := make(chan guideChange, 4)
+	go g.watch(ctx, db, 20*time.Millisecond, func(c guideChange) { changes <- c })
+	time.Sleep(50 * time.Millisecond)
+
+	wait := func(what string) guideChange {
+		t.Helper()
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(2 * time.Second):
+			t.Fatalf("watch did not report %s", what)
+		}
+		return guideChange{}
+	}
+
+	if _, err := db.Exec("INSERT INTO tags (name, description) VALUES ('guide-test', 'Added while serving')"); err != nil {
+		t.Fatal(err)
+	}
+	if c := wait("the new tag"); !c.tags {
+		t.Errorf("change = %+v", c)
+	}
+	if list := g.tagList(); !strings.Contains(list, "- guide-test: Added while serving") {
+		t.Errorf("tagList = %q", list)
+	}
+
+	// user_tables writes are not in the change log.
+	if _, err := db.Exec(`INSERT INTO user_tables (name, description, columns) VALUES ('guide_test', 'Watched', '[]')`); err != nil {
+		t.Fatal(err)
+	}
+	if c := wait("the new table"); !c.tables {
+		t.Errorf("change = %+v", c)
+	}
+	if list := g.tableList(); !strings.Contains(list, "- guide_test: Watched") {
+		t.Errorf("tableList = %q", list)
+	}
+}
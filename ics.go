@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// icsTime is a DTSTART or DTEND: a whole day, or a time in a named zone
+// ("UTC" for Z times, "" for floating times). A time in a zone Go does not
+// know is floating too, but keeps the zone's name.
+type icsTime struct {
+	t        time.Time
+	allDay   bool
+	floating bool
+	zone     string
+}
+
+func (t icsTime) String() string {
+	switch {
+	case t.allDay:
+		return t.t.Format(time.DateOnly)
+	case t.zone == "":
+		return t.t.Format("2006-01-02 15:04")
+	default:
+		return t.t.Format("2006-01-02 15:04") + " " + t.zone
+	}
+}
+
+// value is the time as stored in observation metadata.
+func (t icsTime) value() string {
+	switch {
+	case t.allDay:
+		return t.t.Format(time.DateOnly)
+	case t.floating:
+		return t.t.Format("2006-01-02T15:04:05")
+	default:
+		return t.t.Format(time.RFC3339)
+	}
+}
+
+// icsPerson is an ATTENDEE or ORGANIZER.
+type icsPerson struct {
+	name, email string
+}
+
+// label is the person's entity name: the common name, or the email address
+// without a CN.
+func (p icsPerson) label() string {
+	if p.name != "" {
+		return p.name
+	}
+	return p.email
+}
+
+type icsEvent struct {
+	uid, summary, location, description, rrule string
+	start, end                                 icsTime
+	hasEnd                                     bool
+	organizer                                  *icsPerson
+	attendees                                  []icsPerson
+}
+
+// icsProperty is one unfolded content line: NAME;PARAM=VALUE:value.
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func parseICSLine(line string) (icsProperty, bool) {
+	p := icsProperty{params: make(map[string]string)}
+	// The value starts at the first colon outside a quoted parameter value.
+	quoted, colon := false, -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return p, false
+	}
+	p.value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	p.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		k, v, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return p, true
+}
+
+// unescapeICSText undoes RFC 5545 TEXT escaping.
+var unescapeICSText = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace
+
+func parseICSTime(p icsProperty) (icsTime, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == 8 {
+		t, err := time.Parse("20060102", p.value)
+		return icsTime{t: t, allDay: true}, err
+	}
+	if v, ok := strings.CutSuffix(p.value, "Z"); ok {
+		t, err := time.Parse("20060102T150405", v)
+		return icsTime{t: t, zone: "UTC"}, err
+	}
+	zone := p.params["TZID"]
+	loc, err := time.LoadLocation(zone)
+	if zone == "" || err != nil {
+		// Floating, or a Windows zone name as Outlook writes: keep the wall time.
+		t, err := time.Parse("20060102T150405", p.value)
+		return icsTime{t: t, floating: true, zone: zone}, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", p.value, loc)
+	return icsTime{t: t, zone: zone}, err
+}
+
+func parseICSPerson(p icsProperty) icsPerson {
+	email := p.value
+	if i := strings.Index(strings.ToLower(email), "mailto:"); i >= 0 {
+		email = email[i+len("mailto:"):]
+	}
+	return icsPerson{name: strings.TrimSpace(p.params["CN"]), email: strings.TrimSpace(email)}
+}
+
+// readICS reads the VEVENTs of an iCalendar file. Alarms and other nested
+// components are skipped, and recurring events are read once with their
+// RRULE rather than expanded.
+func readICS(r io.Reader) ([]icsEvent, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []icsEvent
+	var ev *icsEvent
+	depth := 0
+	for n, line := range lines {
+		p, ok := parseICSLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT"):
+			ev, depth = &icsEvent{}, 0
+			continue
+		case ev == nil:
+			continue
+		case p.name == "BEGIN":
+			depth++
+			continue
+		case p.name == "END" && depth > 0:
+			depth--
+			continue
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT"):
+			if ev.start.t.IsZero() {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", n+1, ev.summary)
+			}
+			events = append(events, *ev)
+			ev = nil
+			continue
+		case depth > 0:
+			continue
+		}
+
+		var err error
+		switch p.name {
+		case "UID":
+			ev.uid = p.value
+		case "SUMMARY":
+			ev.summary = strings.TrimSpace(unescapeICSText(p.value))
+		case "LOCATION":
+			ev.location = strings.TrimSpace(unescapeICSText(p.value))
+		case "DESCRIPTION":
+			ev.description = strings.TrimSpace(unescapeICSText(p.value))
+		case "RRULE":
+			ev.rrule = p.value
+		case "DTSTART":
+			ev.start, err = parseICSTime(p)
+		case "DTEND":
+			ev.end, err = parseICSTime(p)
+			ev.hasEnd = true
+		case "ORGANIZER":
+			org := parseICSPerson(p)
+			ev.organizer = &org
+		case "ATTENDEE":
+			ev.attendees = append(ev.attendees, parseICSPerson(p))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s %q", n+1, p.name, p.value)
+		}
+	}
+	return events, nil
+}
+
+// name is the event's entity name: its summary and start date, so each
+// occurrence of a meeting title is its own entity.
+func (e icsEvent) name() string {
+	summary := e.summary
+	if summary == "" {
+		summary = "Event"
+	}
+	return fmt.Sprintf("%s (%s)", truncateText(summary, 150), e.start.t.Format(time.DateOnly))
+}
+
+// when describes the event's dates. All-day DTENDs are exclusive, so a
+// one-day event ends the day after it starts.
+func (e icsEvent) when() string {
+	if !e.hasEnd {
+		return "On " + e.start.String()
+	}
+	if e.start.allDay {
+		last := e.end.t.AddDate(0, 0, -1)
+		if !last.After(e.start.t) {
+			return "On " + e.start.String()
+		}
+		return fmt.Sprintf("From %s to %s", e.start.String(), last.Format(time.DateOnly))
+	}
+	if e.end.t.Format(time.DateOnly) == e.start.t.Format(time.DateOnly) && e.end.zone == e.start.zone {
+		when := fmt.Sprintf("On %s %s–%s", e.start.t.Format(time.DateOnly), e.start.t.Format("15:04"), e.end.t.Format("15:04"))
+		if e.start.zone != "" {
+			when += " " + e.start.zone
+		}
+		return when
+	}
+	return fmt.Sprintf("From %s to %s", e.start.String(), e.end.String())
+}
+
+// observations are what an event records: when and where it is, how it
+// repeats and its description.
+func (e icsEvent) observations() []string {
+	obs := []string{e.when()}
+	if e.location != "" {
+		obs = append(obs, "At "+e.location)
+	}
+	if e.rrule != "" {
+		obs = append(obs, "Repeats: "+e.rrule)
+	}
+	if e.description != "" {
+		obs = append(obs, truncateText(e.description, 1000))
+	}
+	return obs
+}
+
+// metadata scopes an event's observations to its dates, for search_metadata.
+func (e icsEvent) metadata() string {
+	m := map[string]string{"start": e.start.value()}
+	if e.hasEnd {
+		m["end"] = e.end.value()
+	}
+	if e.uid != "" {
+		m["uid"] = e.uid
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// icsImport turns events into entities and relations for importMemory:
+// each event an entity with its observations, each attendee a person who
+// attends it and the organizer one who organizes it. People whose email is
+// in skip, such as the calendar's owner, are left out, as are events
+// starting before since. The caller sets the tags.
+func icsImport(events []icsEvent, eventType, personType string, skip map[string]bool, since time.Time) ([]importEntity, []graphRelation) {
+	var entities []importEntity
+	var relations []graphRelation
+	people := make(map[string]bool)
+	addPerson := func(p icsPerson, event, relationType string) {
+		if p.label() == "" || skip[strings.ToLower(p.email)] {
+			return
+		}
+		if !people[p.label()] {
+			people[p.label()] = true
+			entities = append(entities, importEntity{graphEntity: graphEntity{Name: p.label(), EntityType: personType, Observations: []string{}}})
+		}
+		relations = append(relations, graphRelation{From: p.label(), To: event, RelationType: relationType})
+	}
+
+	for _, e := range events {
+		if e.start.t.Before(since) {
+			continue
+		}
+		name := e.name()
+		entities = append(entities, importEntity{graphEntity: graphEntity{Name: name, EntityType: eventType, Observations: e.observations()}, metadata: e.metadata()})
+		if e.organizer != nil {
+			addPerson(*e.organizer, name, "organizes")
+		}
+		for _, a := range e.attendees {
+			if e.organizer != nil && strings.EqualFold(a.email, e.organizer.email) {
+				continue
+			}
+			addPerson(a, name, "attends")
+		}
+	}
+	return entities, relations
+}
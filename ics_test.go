@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup-1@example.com\r\n" +
+	"SUMMARY:Platform standup\r\n" +
+	"DTSTART;TZID=Europe/London:20240501T093000\r\n" +
+	"DTEND;TZID=Europe/London:20240501T094500\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=WE\r\n" +
+	"LOCATION:Room 4\\, second floor\r\n" +
+	"DESCRIPTION:Agenda:\\nblockers first\\; then demos. This line is folded\r\n" +
+	"  across two lines.\r\n" +
+	"ORGANIZER;CN=Ann Lee:mailto:ann@example.com\r\n" +
+	"ATTENDEE;CN=Ann Lee;ROLE=CHAIR:mailto:ann@example.com\r\n" +
+	"ATTENDEE;CN=\"Bo: the builder\";PARTSTAT=ACCEPTED:mailto:bo@example.com\r\n" +
+	"ATTENDEE:mailto:me@example.com\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"DESCRIPTION:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Trip to Lisbon\r\n" +
+	"DTSTART;VALUE=DATE:20240610\r\n" +
+	"DTEND;VALUE=DATE:20240614\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestReadICS(t *testing.T) {
+	events, err := readICS(strings.NewReader(testICS))
+	if err != nil {
+		t.Fatalf("readICS: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	standup := events[0]
+	if standup.name() != "Platform standup (2024-05-01)" || standup.location != "Room 4, second floor" || standup.rrule != "FREQ=WEEKLY;BYDAY=WE" {
+		t.Errorf("standup = %+v", standup)
+	}
+	if standup.description != "Agenda:\nblockers first; then demos. This line is folded across two lines." {
+		t.Errorf("description = %q, want it unescaped and unfolded without the alarm's", standup.description)
+	}
+	wantAttendees := []icsPerson{{"Ann Lee", "ann@example.com"}, {"Bo: the builder", "bo@example.com"}, {"", "me@example.com"}}
+	if standup.organizer == nil || standup.organizer.email != "ann@example.com" || !reflect.DeepEqual(standup.attendees, wantAttendees) {
+		t.Errorf("organizer %+v, attendees %+v", standup.organizer, standup.attendees)
+	}
+	if got := standup.metadata(); got != `{"end":"2024-05-01T09:45:00+01:00","start":"2024-05-01T09:30:00+01:00","uid":"standup-1@example.com"}` {
+		t.Errorf("metadata = %s", got)
+	}
+
+	if _, err := readICS(strings.NewReader("BEGIN:VEVENT\nSUMMARY:No start\nEND:VEVENT\n")); err == nil || !strings.Contains(err.Error(), "no DTSTART") {
+		t.Errorf("expected an event without DTSTART to fail, got %v", err)
+	}
+	if _, err := readICS(strings.NewReader("BEGIN:VEVENT\nDTSTART:2024-05-01\nEND:VEVENT\n")); err == nil || !strings.Contains(err.Error(), "line 2: invalid DTSTART") {
+		t.Errorf("expected an invalid DTSTART to fail, got %v", err)
+	}
+}
+
+func TestICSEventWhen(t *testing.T) {
+	day := func(s string) icsTime {
+		d, _ := time.Parse(time.DateOnly, s)
+		return icsTime{t: d, allDay: true}
+	}
+	at := func(s, zone string) icsTime {
+		d, _ := time.Parse("2006-01-02 15:04", s)
+		return icsTime{t: d, zone: zone, floating: zone == ""}
+	}
+	tests := []struct {
+		name  string
+		event icsEvent
+		want  string
+	}{
+		{"one day", icsEvent{start: day("2024-06-10"), end: day("2024-06-11"), hasEnd: true}, "On 2024-06-10"},
+		{"several days", icsEvent{start: day("2024-06-10"), end: day("2024-06-14"), hasEnd: true}, "From 2024-06-10 to 2024-06-13"},
+		{"no end", icsEvent{start: at("2024-05-01 09:30", "UTC")}, "On 2024-05-01 09:30 UTC"},
+		{"same day", icsEvent{start: at("2024-05-01 09:30", "Europe/London"), end: at("2024-05-01 09:45", "Europe/London"), hasEnd: true}, "On 2024-05-01 09:30–09:45 Europe/London"},
+		{"floating overnight", icsEvent{start: at("2024-05-01 22:00", ""), end: at("2024-05-02 06:00", ""), hasEnd: true}, "From 2024-05-01 22:00 to 2024-05-02 06:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.when(); got != tt.want {
+				t.Errorf("when() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestICSImport(t *testing.T) {
+	events, err := readICS(strings.NewReader(testICS))
+	if err != nil {
+		t.Fatalf("readICS: %v", err)
+	}
+	entities, relations := icsImport(events, "Event", "Person", map[string]bool{"me@example.com": true}, time.Time{})
+
+	var names []string
+	for _, e := range entities {
+		names = append(names, e.Name+"/"+e.EntityType)
+	}
+	if want := []string{"Platform standup (2024-05-01)/Event", "Ann Lee/Person", "Bo: the builder/Person", "Trip to Lisbon (2024-06-10)/Event"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("entities = %v, want %v", names, want)
+	}
+	if want := []string{"On 2024-05-01 09:30–09:45 Europe/London", "At Room 4, second floor", "Repeats: FREQ=WEEKLY;BYDAY=WE"}; !reflect.DeepEqual(entities[0].Observations[:3], want) {
+		t.Errorf("observations = %q", entities[0].Observations)
+	}
+	wantRelations := []graphRelation{
+		{From: "Ann Lee", To: "Platform standup (2024-05-01)", RelationType: "organizes"},
+		{From: "Bo: the builder", To: "Platform standup (2024-05-01)", RelationType: "attends"},
+	}
+	if !reflect.DeepEqual(relations, wantRelations) {
+		t.Errorf("relations = %+v", relations)
+	}
+
+	since, _ := time.Parse(time.DateOnly, "2024-06-01")
+	if entities, _ := icsImport(events, "Event", "Person", nil, since); len(entities) != 1 || entities[0].Name != "Trip to Lisbon (2024-06-10)" {
+		t.Errorf("expected only the trip after -since, got %+v", entities)
+	}
+}
+
+func TestImportICS_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'ICS test %'")
+	defer db.Exec("DELETE FROM observations WHERE metadata LIKE '%ics-test-%'")
+	defer db.Exec("DELETE FROM relations WHERE relation_type = 'attends' AND to_id IN (SELECT id FROM entities WHERE name LIKE 'ICS test %')")
+
+	events, err := readICS(strings.NewReader("BEGIN:VEVENT\nUID:ics-test-1\nSUMMARY:ICS test review\nDTSTART:20240501T140000Z\nDTEND:20240501T150000Z\n" +
+		"ATTENDEE;CN=ICS test Cy:mailto:cy@example.com\nEND:VEVENT\n"))
+	if err != nil {
+		t.Fatalf("readICS: %v", err)
+	}
+	entities, relations := icsImport(events, "Event", "Person", nil, time.Time{})
+	counts, err := importMemory(context.Background(), db, entities, relations)
+	if err != nil {
+		t.Fatalf("importMemory: %v", err)
+	}
+	if want := (importCounts{entities: 2, observations: 1, relations: 1}); counts != want {
+		t.Errorf("import = %v, want %v", counts, want)
+	}
+	var content, start string
+	err = db.QueryRow(`SELECT o.content, json_extract(o.metadata, '$.start') FROM observations o JOIN entities e ON e.id = o.entity_id
+		WHERE e.name = 'ICS test review (2024-05-01)'`).Scan(&content, &start)
+	if err != nil || content != "On 2024-05-01 14:00–15:00 UTC" || start != "2024-05-01T14:00:00Z" {
+		t.Errorf("stored %q with start %q (%v)", content, start, err)
+	}
+}
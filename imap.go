@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMailBytes is how much of each message is fetched: enough for the
+// headers and the start of the body.
+const maxMailBytes = 32 * 1024
+
+// imapSource is a mail folder read over IMAP. Messages are fetched with
+// BODY.PEEK, so reading them does not mark them as seen.
+type imapSource struct {
+	tls                bool
+	host, addr, folder string
+	user, password     string
+}
+
+func newIMAPSource(u *url.URL) (feedSource, error) {
+	if u.Hostname() == "" || u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("IMAP URL needs a user and host, as in imaps://user@host/INBOX")
+	}
+	s := &imapSource{tls: strings.EqualFold(u.Scheme, "imaps"), user: u.User.Username(), folder: strings.Trim(u.Path, "/")}
+	if password, ok := u.User.Password(); ok {
+		s.password = password
+	} else {
+		s.password = imapPassword
+	}
+	if s.password == "" {
+		return nil, fmt.Errorf("no password for %s: put it in the URL or ENGRAM_IMAP_PASSWORD", s.user)
+	}
+	if s.folder == "" {
+		s.folder = "INBOX"
+	}
+	port := u.Port()
+	if port == "" {
+		port = "143"
+		if s.tls {
+			port = "993"
+		}
+	}
+	s.host, s.addr = u.Hostname(), net.JoinHostPort(u.Hostname(), port)
+	return s, nil
+}
+
+func (s *imapSource) entity() (string, string) {
+	return fmt.Sprintf("Mail %s@%s/%s", s.user, s.host, s.folder), "Mailbox"
+}
+
+func (s *imapSource) fetch(ctx context.Context, since time.Time) ([]feedItem, error) {
+	dialer := &net.Dialer{Timeout: feedTimeout}
+	var conn net.Conn
+	var err error
+	if s.tls {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.host}}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(feedTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	c := &imapConn{r: bufio.NewReader(conn), w: conn}
+	if _, err := c.readLine(); err != nil {
+		return nil, fmt.Errorf("greeting: %v", err)
+	}
+	if _, err := c.command("LOGIN %s %s", imapQuote(s.user), imapQuote(s.password)); err != nil {
+		return nil, fmt.Errorf("login: %v", err)
+	}
+	defer c.command("LOGOUT")
+	if _, err := c.command("EXAMINE %s", imapQuote(s.folder)); err != nil {
+		return nil, fmt.Errorf("folder %s: %v", s.folder, err)
+	}
+	// SEARCH SINCE has day granularity; the dates are checked below.
+	untagged, err := c.command("UID SEARCH SINCE %s", since.Format("2-Jan-2006"))
+	if err != nil {
+		return nil, fmt.Errorf("search: %v", err)
+	}
+	var uids []string
+	for _, line := range untagged {
+		if rest, ok := strings.CutPrefix(string(line), "* SEARCH"); ok {
+			uids = append(uids, strings.Fields(rest)...)
+		}
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	// UIDs ascend with arrival, so the newest messages are at the end.
+	if len(uids) > maxFeedItems {
+		uids = uids[len(uids)-maxFeedItems:]
+	}
+	untagged, err = c.command("UID FETCH %s (BODY.PEEK[]<0.%d>)", strings.Join(uids, ","), maxMailBytes)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %v", err)
+	}
+
+	var items []feedItem
+	for _, raw := range untagged {
+		message := imapLiteral(raw)
+		if message == nil {
+			continue
+		}
+		it, err := parseMail(message)
+		if err != nil || (!it.published.IsZero() && !it.published.After(since)) {
+			continue
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// imapConn speaks just enough IMAP4rev1 to log in, search and fetch.
+type imapConn struct {
+	r   *bufio.Reader
+	w   io.Writer
+	seq int
+}
+
+// imapQuote makes s an IMAP quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// readLine reads a line, following any {n} literals it ends with into the
+// lines after them, so a FETCH response and the message it carries come back
+// as one response.
+func (c *imapConn) readLine() ([]byte, error) {
+	var resp []byte
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, line...)
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if !bytes.HasSuffix(trimmed, []byte("}")) {
+			return resp, nil
+		}
+		open := bytes.LastIndexByte(trimmed, '{')
+		if open < 0 {
+			return resp, nil
+		}
+		n, err := strconv.Atoi(string(trimmed[open+1 : len(trimmed)-1]))
+		if err != nil || n < 0 {
+			return resp, nil
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return nil, err
+		}
+		resp = append(resp, literal...)
+	}
+}
+
+// imapLiteral is the message in a FETCH response: the {n} literal after
+// its first line.
+func imapLiteral(resp []byte) []byte {
+	first, rest, ok := bytes.Cut(resp, []byte("\r\n"))
+	open := bytes.LastIndexByte(first, '{')
+	if !ok || !bytes.Contains(first, []byte(" FETCH ")) || open < 0 || !bytes.HasSuffix(first, []byte("}")) {
+		return nil
+	}
+	n, err := strconv.Atoi(string(first[open+1 : len(first)-1]))
+	if err != nil || n > len(rest) {
+		return nil
+	}
+	return rest[:n]
+}
+
+// command sends a tagged command and returns its untagged responses,
+// failing unless it completes with OK.
+func (c *imapConn) command(format string, args ...any) ([][]byte, error) {
+	c.seq++
+	tag := fmt.Sprintf("a%d", c.seq)
+	if _, err := fmt.Fprintf(c.w, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+	var untagged [][]byte
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := bytes.CutPrefix(line, []byte(tag+" ")); ok {
+			status := strings.TrimSpace(string(rest))
+			if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+				return nil, fmt.Errorf("%s", status)
+			}
+			return untagged, nil
+		}
+		untagged = append(untagged, line)
+	}
+}
+
+var mailWords = new(mime.WordDecoder)
+
+// parseMail reads the headers and the start of the text of a message, which
+// may be cut off part way through.
+func parseMail(raw []byte) (feedItem, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return feedItem{}, err
+	}
+	it := feedItem{id: strings.Trim(msg.Header.Get("Message-Id"), "<> ")}
+	if it.title, err = mailWords.DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		it.title = msg.Header.Get("Subject")
+	}
+	if it.title == "" {
+		it.title = "(no subject)"
+	}
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		it.author = from.Name
+		if it.author == "" {
+			it.author = from.Address
+		}
+	}
+	it.published, _ = msg.Header.Date()
+	it.summary = mailText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	return it, nil
+}
+
+// mailText finds the plain text of a body, preferring text/plain over
+// text/html in multipart messages.
+func mailText(contentType, encoding string, body io.Reader) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var html string
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			text := mailText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if text == "" {
+				continue
+			}
+			if t, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); t == "text/html" {
+				html = text
+				continue
+			}
+			return text
+		}
+		return html
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return ""
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	// A cut-off message ends in a partial line or encoded word; keep what
+	// decoded.
+	data, _ := io.ReadAll(body)
+	_, paragraphs := extractPage(string(data), mediaType)
+	return strings.Join(paragraphs, " ")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// memoryRecord is one line of the @modelcontextprotocol/server-memory file:
+// an entity or a relation, told apart by type.
+type memoryRecord struct {
+	Type         string   `json:"type"`
+	Name         string   `json:"name"`
+	EntityType   string   `json:"entityType"`
+	Observations []string `json:"observations"`
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	RelationType string   `json:"relationType"`
+
+	// Set when the value is a whole graph, as read_graph returns it, rather
+	// than a single record.
+	Entities  []graphEntity   `json:"entities"`
+	Relations []graphRelation `json:"relations"`
+}
+
+// readMemoryFile reads the entities and relations of a server-memory file.
+// Its memory.json holds one record per line; a single {"entities": [...],
+// "relations": [...]} document is accepted too.
+func readMemoryFile(r io.Reader) ([]graphEntity, []graphRelation, error) {
+	var entities []graphEntity
+	var relations []graphRelation
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var rec memoryRecord
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			return entities, relations, nil
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("record %d: %v", n, err)
+		}
+		switch {
+		case rec.Type == "entity":
+			if strings.TrimSpace(rec.Name) == "" || strings.TrimSpace(rec.EntityType) == "" {
+				return nil, nil, fmt.Errorf("record %d: entity needs name and entityType", n)
+			}
+			entities = append(entities, graphEntity{Name: rec.Name, EntityType: rec.EntityType, Observations: rec.Observations})
+		case rec.Type == "relation":
+			if rec.From == "" || rec.To == "" || strings.TrimSpace(rec.RelationType) == "" {
+				return nil, nil, fmt.Errorf("record %d: relation needs from, to and relationType", n)
+			}
+			relations = append(relations, graphRelation{From: rec.From, To: rec.To, RelationType: rec.RelationType})
+		case rec.Type == "" && (rec.Entities != nil || rec.Relations != nil):
+			entities = append(entities, rec.Entities...)
+			relations = append(relations, rec.Relations...)
+		default:
+			return nil, nil, fmt.Errorf("record %d: unknown type %q, want entity or relation", n, rec.Type)
+		}
+	}
+}
+
+// importCounts tallies what an import added and what was already there.
+type importCounts struct {
+	entities, existingEntities         int
+	observations, existingObservations int
+	relations, existingRelations       int
+}
+
+func (c importCounts) String() string {
+	return fmt.Sprintf("imported %d entities (%d already existed), %d observations (%d already recorded), %d relations (%d already recorded)",
+		c.entities, c.existingEntities, c.observations, c.existingObservations, c.relations, c.existingRelations)
+}
+
+// importEntity is an entity to import with the tags for its new
+// observations and, if it is created, for itself, and metadata for its new
+// observations. observationTagSets, when set, gives each observation its own
+// tags in place of observationTags.
+type importEntity struct {
+	graphEntity
+	observationTags, entityTags []int64
+	observationTagSets          [][]int64
+	metadata                    any
+}
+
+// importMemory writes entities, their observations and relations in one
+// transaction, skipping what already exists the way create_entities,
+// add_observations and create_relations do. A relation whose endpoint is in
+// neither the import nor the database fails the import.
+func importMemory(ctx context.Context, db *sql.DB, entities []importEntity, relations []graphRelation) (importCounts, error) {
+	var c importCounts
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return c, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, e := range entities {
+		id, created, err := upsertEntity(ctx, tx, e.Name, e.EntityType, "ignore")
+		if err != nil {
+			return c, fmt.Errorf("entity '%s': %v", e.Name, err)
+		}
+		if created {
+			c.entities++
+			if err := linkEntityTags(ctx, tx, id, e.entityTags); err != nil {
+				return c, fmt.Errorf("entity '%s': failed to link tags: %v", e.Name, err)
+			}
+		} else {
+			c.existingEntities++
+		}
+		for i, content := range e.Observations {
+			tagIDs := e.observationTags
+			if e.observationTagSets != nil {
+				tagIDs = e.observationTagSets[i]
+			}
+			_, err := insertObservation(content, e.metadata, func(content string, metadata any) (int64, error) {
+				stored, digest, err := storeContent(ctx, tx, content)
+				if err != nil {
+					return 0, err
+				}
+				result, err := tx.ExecContext(ctx, `INSERT INTO observations (entity_id, content, content_sha256, metadata)
+					SELECT ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM observations WHERE entity_id = ? AND content = ?)`,
+					id, stored, digest, metadata, id, stored)
+				if err != nil {
+					return 0, execFailure(err)
+				}
+				if n, _ := result.RowsAffected(); n == 0 {
+					c.existingObservations++
+					return 0, nil
+				}
+				c.observations++
+				observationID, _ := result.LastInsertId()
+				if err := linkTags(ctx, tx, observationID, tagIDs); err != nil {
+					return 0, fmt.Errorf("failed to link tags: %v", err)
+				}
+				return observationID, nil
+			})
+			if err != nil {
+				return c, fmt.Errorf("entity '%s': %v", e.Name, err)
+			}
+		}
+	}
+
+	var names []string
+	for _, r := range relations {
+		names = append(names, r.From, r.To)
+	}
+	ids, err := entityIDs(ctx, tx, names)
+	if err != nil {
+		return c, err
+	}
+	for _, r := range relations {
+		result, err := tx.ExecContext(ctx, `INSERT INTO relations (from_id, to_id, relation_type)
+			SELECT ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM relations WHERE from_id = ? AND to_id = ? AND relation_type = ?)`,
+			ids[r.From], ids[r.To], r.RelationType, ids[r.From], ids[r.To], r.RelationType)
+		if err != nil {
+			return c, fmt.Errorf("relation %s -%s-> %s: %w", r.From, r.RelationType, r.To, execFailure(err))
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			c.relations++
+		} else {
+			c.existingRelations++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c, fmt.Errorf("failed to commit: %v", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadMemoryFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		wantEntities  []graphEntity
+		wantRelations []graphRelation
+		wantErr       string
+	}{
+		{
+			name: "jsonl",
+			input: `{"type":"entity","name":"ann","entityType":"person","observations":["Likes espresso"]}
+{"type":"entity","name":"acme","entityType":"company","observations":[]}
+{"type":"relation","from":"ann","to":"acme","relationType":"works_at"}
+`,
+			wantEntities:  []graphEntity{{Name: "ann", EntityType: "person", Observations: []string{"Likes espresso"}}, {Name: "acme", EntityType: "company", Observations: []string{}}},
+			wantRelations: []graphRelation{{From: "ann", To: "acme", RelationType: "works_at"}},
+		},
+		{
+			name:         "graph document",
+			input:        `{"entities":[{"name":"ann","entityType":"person","observations":["Likes espresso"]}],"relations":[]}`,
+			wantEntities: []graphEntity{{Name: "ann", EntityType: "person", Observations: []string{"Likes espresso"}}},
+		},
+		{name: "empty", input: ""},
+		{name: "unknown type", input: `{"type":"entity","name":"ann","entityType":"person"}` + "\n" + `{"type":"note"}`, wantErr: `record 2: unknown type "note"`},
+		{name: "entity without type", input: `{"type":"entity","name":"ann"}`, wantErr: "record 1: entity needs name and entityType"},
+		{name: "relation without target", input: `{"type":"relation","from":"ann","relationType":"knows"}`, wantErr: "record 1: relation needs from, to and relationType"},
+		{name: "invalid json", input: `{"type":`, wantErr: "record 1: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entities, relations, err := readMemoryFile(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readMemoryFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readMemoryFile(): %v", err)
+			}
+			if !reflect.DeepEqual(entities, tt.wantEntities) || !reflect.DeepEqual(relations, tt.wantRelations) {
+				t.Errorf("readMemoryFile() = %+v %+v, want %+v %+v", entities, relations, tt.wantEntities, tt.wantRelations)
+			}
+		})
+	}
+}
+
+func TestImportMemory_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'import-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'import test %'")
+	defer db.Exec("DELETE FROM relations WHERE relation_type = 'import_test_works_at'")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT id FROM observations WHERE content LIKE 'import test %')")
+
+	entities, relations, err := readMemoryFile(strings.NewReader(`{"type":"entity","name":"import-test-ann","entityType":"person","observations":["import test likes espresso","import test lives in Leeds"]}
+{"type":"entity","name":"import-test-acme","entityType":"company","observations":[]}
+{"type":"relation","from":"import-test-ann","to":"import-test-acme","relationType":"import_test_works_at"}
+`))
+	if err != nil {
+		t.Fatalf("readMemoryFile: %v", err)
+	}
+	tagIDs, err := validateTags(context.Background(), db, []string{"personal"})
+	if err != nil {
+		t.Fatalf("validateTags: %v", err)
+	}
+
+	imports := []importEntity{{graphEntity: entities[0], observationTags: tagIDs}, {graphEntity: entities[1], observationTags: tagIDs}}
+	counts, err := importMemory(context.Background(), db, imports, relations)
+	if err != nil {
+		t.Fatalf("importMemory: %v", err)
+	}
+	if want := (importCounts{entities: 2, observations: 2, relations: 1}); counts != want {
+		t.Errorf("first import = %v, want %v", counts, want)
+	}
+	var tagged int
+	db.QueryRow(`SELECT count(*) FROM observation_tags ot JOIN observations o ON o.id = ot.observation_id
+		WHERE o.content LIKE 'import test %'`).Scan(&tagged)
+	if tagged != 2 {
+		t.Errorf("%d imported observations tagged, want 2", tagged)
+	}
+
+	counts, err = importMemory(context.Background(), db, imports, relations)
+	if err != nil {
+		t.Fatalf("second importMemory: %v", err)
+	}
+	if want := (importCounts{existingEntities: 2, existingObservations: 2, existingRelations: 1}); counts != want {
+		t.Errorf("second import = %v, want %v", counts, want)
+	}
+
+	_, err = importMemory(context.Background(), db, nil, []graphRelation{{From: "import-test-ann", To: "import-test-nobody", RelationType: "import_test_works_at"}})
+	if err == nil || !strings.Contains(err.Error(), "import-test-nobody") {
+		t.Errorf("expected the missing endpoint to fail the import, got %v", err)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var (
+	// ingestDomains are the hosts ingest_url may fetch from; a domain also
+	// allows its subdomains. Empty refuses every URL.
+	ingestDomains = parseTableList(getEnv("ENGRAM_INGEST_DOMAINS", ""))
+	// ingestMaxBytes caps how much of a page is read; longer pages are cut.
+	ingestMaxBytes = getEnvInt("ENGRAM_INGEST_MAX_BYTES", 2*1024*1024)
+	// samplingIngest has ingest_url ask the client's model, through MCP
+	// sampling, to summarise pages when the caller gives no summary.
+	samplingIngest = getEnv("ENGRAM_SAMPLING_INGEST", "") == "true"
+)
+
+const (
+	ingestTimeout      = 30 * time.Second
+	leadParagraphs     = 3
+	minLeadParagraph   = 80
+	maxSummaryLine     = 500
+	maxSummarisedChars = 12000
+)
+
+// domainAllowed reports whether host is one of allowed or a subdomain of one.
+func domainAllowed(host string, allowed map[string]bool) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for d := range allowed {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// ingestClient follows redirects only while they stay on allowed domains.
+var ingestClient = &http.Client{
+	Timeout: ingestTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("too many redirects")
+		}
+		if !domainAllowed(req.URL.Hostname(), ingestDomains) {
+			return fmt.Errorf("redirected to %s, which is not in ENGRAM_INGEST_DOMAINS", req.URL.Hostname())
+		}
+		return nil
+	},
+}
+
+// checkIngestURL parses rawURL and refuses anything but http(s) on an
+// allowed domain.
+func checkIngestURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("url must be an http or https URL")
+	}
+	if len(ingestDomains) == 0 {
+		return nil, fmt.Errorf("ingesting URLs is off; set ENGRAM_INGEST_DOMAINS to the domains it may fetch from")
+	}
+	if !domainAllowed(u.Hostname(), ingestDomains) {
+		return nil, fmt.Errorf("%s is not in ENGRAM_INGEST_DOMAINS", u.Hostname())
+	}
+	return u, nil
+}
+
+// fetchPage downloads an HTML or plain text page, reading at most
+// ingestMaxBytes of it.
+func fetchPage(ctx context.Context, u *url.URL) (body, mediaType string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9")
+	resp, err := ingestClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("%s", resp.Status)
+	}
+	mediaType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" && mediaType != "text/plain" {
+		return "", "", fmt.Errorf("%s is not a web page or text", mediaType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(ingestMaxBytes)))
+	if err != nil {
+		return "", "", err
+	}
+	return strings.ToValidUTF8(string(data), ""), mediaType, nil
+}
+
+var (
+	htmlTitle    = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlOGTitle  = regexp.MustCompile(`(?is)<meta\s[^>]*property=["']og:title["'][^>]*content=["']([^"']*)["']`)
+	htmlMain     = regexp.MustCompile(`(?is)<(?:article|main)\b[^>]*>(.*)</(?:article|main)>`)
+	htmlComment  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlBlock    = regexp.MustCompile(`(?i)<(?:/?(?:p|div|section|li|ul|ol|h[1-6]|blockquote|pre|table|tr)\b[^>]*|br\s*/?)>`)
+	htmlTag      = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines   = regexp.MustCompile(`\n\s*\n`)
+	spaceRuns    = regexp.MustCompile(`\s+`)
+	htmlNoise    []*regexp.Regexp
+	noiseElement = []string{"script", "style", "noscript", "svg", "nav", "header", "footer", "aside", "form", "template"}
+)
+
+func init() {
+	for _, tag := range noiseElement {
+		htmlNoise = append(htmlNoise, regexp.MustCompile(`(?is)<`+tag+`\b.*?</`+tag+`\s*>`))
+	}
+}
+
+// extractPage returns a page's title and the paragraphs of its readable
+// text, preferring the <article> or <main> element and leaving out scripts,
+// navigation, headers and footers.
+func extractPage(body, mediaType string) (string, []string) {
+	if mediaType == "text/plain" {
+		paragraphs := splitParagraphs(body)
+		if len(paragraphs) == 0 {
+			return "", nil
+		}
+		return paragraphs[0], paragraphs
+	}
+
+	title := ""
+	if m := htmlOGTitle.FindStringSubmatch(body); m != nil {
+		title = m[1]
+	} else if m := htmlTitle.FindStringSubmatch(body); m != nil {
+		title = m[1]
+	}
+	title = spaceRuns.ReplaceAllString(html.UnescapeString(htmlTag.ReplaceAllString(title, "")), " ")
+
+	text := htmlComment.ReplaceAllString(body, "")
+	for _, re := range htmlNoise {
+		text = re.ReplaceAllString(text, "")
+	}
+	if m := htmlMain.FindStringSubmatch(text); m != nil {
+		text = m[1]
+	}
+	text = htmlBlock.ReplaceAllString(text, "\n\n")
+	text = html.UnescapeString(htmlTag.ReplaceAllString(text, ""))
+	return strings.TrimSpace(title), splitParagraphs(text)
+}
+
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, p := range blankLines.Split(strings.ReplaceAll(text, "\r\n", "\n"), -1) {
+		if p = strings.TrimSpace(spaceRuns.ReplaceAllString(p, " ")); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	return paragraphs
+}
+
+// truncateText cuts s to at most n runes at a word boundary, marking the cut.
+func truncateText(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	cut := string([]rune(s)[:n])
+	if i := strings.LastIndex(cut, " "); i > n/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:") + "…"
+}
+
+// leadSummary stands in for a summary when there is none: the first few
+// paragraphs long enough to be prose rather than bylines or captions.
+func leadSummary(paragraphs []string) []string {
+	var lead []string
+	for _, p := range paragraphs {
+		if utf8.RuneCountInString(p) < minLeadParagraph {
+			continue
+		}
+		lead = append(lead, truncateText(p, maxSummaryLine))
+		if len(lead) == leadParagraphs {
+			break
+		}
+	}
+	return lead
+}
+
+const summarisePrompt = `You summarise web pages for a personal memory store.
+Reply with three to five short standalone facts from the page, one per line, each starting with "- ", and nothing else.
+Each fact should make sense on its own months later, without the page.`
+
+// sampleSummary asks the client's model to summarise a page.
+func sampleSummary(ctx context.Context, smp sampler, title string, paragraphs []string) ([]string, error) {
+	text := truncateText(strings.Join(paragraphs, "\n\n"), maxSummarisedChars)
+	ctx, cancel := context.WithTimeout(ctx, rerankTimeout)
+	defer cancel()
+	result, err := smp.RequestSampling(ctx, mcp.CreateMessageRequest{CreateMessageParams: mcp.CreateMessageParams{
+		Messages:     []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.NewTextContent(fmt.Sprintf("Title: %s\n\n%s", title, text))}},
+		SystemPrompt: summarisePrompt,
+		MaxTokens:    1024,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	var reply string
+	switch c := result.Content.(type) {
+	case mcp.TextContent:
+		reply = c.Text
+	case *mcp.TextContent:
+		reply = c.Text
+	default:
+		return nil, fmt.Errorf("the client's model returned %T, not text", result.Content)
+	}
+	var facts []string
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•"))
+		if line != "" {
+			facts = append(facts, truncateText(line, maxSummaryLine))
+		}
+	}
+	if len(facts) == 0 {
+		return nil, fmt.Errorf("the client's model returned no summary")
+	}
+	return facts, nil
+}
+
+// registerIngestURL adds the ingest_url tool.
+func registerIngestURL(s *server.MCPServer, db *sql.DB, tagger, summariser sampler, guided *guideTools) {
+	guided.add(s, func() server.ServerTool {
+		return server.ServerTool{Tool: mcp.NewTool("ingest_url",
+			mcp.WithDescription(`Remember a web page: fetch it, extract its title and readable text, and store it as an entity with a Source observation linking to it and a few summary observations.
+
+Only URLs on the domains in ENGRAM_INGEST_DOMAINS are fetched. Pass summary with the facts worth keeping if you have read the page; otherwise the client's model summarises it when the server allows sampling, or its lead paragraphs are stored. Ingesting the same page again adds only new observations.`),
+			mcp.WithString("url",
+				mcp.Required(),
+				mcp.Description("http or https URL of the page"),
+			),
+			mcp.WithString("name",
+				mcp.Description("Entity name (default the page title)"),
+			),
+			mcp.WithString("entity_type",
+				mcp.Description("Entity type (default Article)"),
+			),
+			mcp.WithArray("summary",
+				mcp.Description("Summary observations, one fact each"),
+				mcp.WithStringItems(),
+			),
+			observationTagsOption(),
+		), Handler: ingestURLHandler(db, tagger, summariser)}
+	})
+}
+
+func ingestURLHandler(db *sql.DB, tagger, summariser sampler) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		u, err := checkIngestURL(request.GetString("url", ""))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		entityType := strings.TrimSpace(request.GetString("entity_type", "Article"))
+		if entityType == "" {
+			entityType = "Article"
+		}
+
+		body, mediaType, err := fetchPage(ctx, u)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeUpstream), "failed to fetch %s: %v", u, err), nil
+		}
+		title, paragraphs := extractPage(body, mediaType)
+		if len(paragraphs) == 0 {
+			return toolErrorf(codeInvalidArgument, "no readable text at %s", u), nil
+		}
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			name = title
+		}
+		if name == "" {
+			name = u.Host + u.Path
+		}
+		name = truncateText(name, 200)
+
+		var summary []string
+		for _, s := range request.GetStringSlice("summary", nil) {
+			if s = strings.TrimSpace(s); s != "" {
+				summary = append(summary, s)
+			}
+		}
+		summarisedBy := "given summary"
+		if len(summary) == 0 && summariser != nil {
+			if summary, err = sampleSummary(ctx, summariser, title, paragraphs); err != nil {
+				log.Printf("summarising %s failed: %v", u, err)
+			} else {
+				summarisedBy = "summarised by the client's model"
+			}
+		}
+		if len(summary) == 0 {
+			summary, summarisedBy = leadSummary(paragraphs), "lead paragraphs, pass summary for a better one"
+		}
+
+		tagsStr, autoTagged := tagsOrAsk(ctx, db, tagger, request.GetString("tags", ""), name+": "+strings.Join(summary, " "))
+		if strings.TrimSpace(tagsStr) == "" && requiredTags.requires("observations") {
+			return toolError(codeTagRequired, "tags parameter is required. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+		}
+		tagIDs, err := validateTagsFor(ctx, db, "observations", parseTagNames(tagsStr))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		entityTagIDs, err := validateTagsFor(ctx, db, "entities", parseTagNames(tagsStr))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		size := len("Source: " + u.String())
+		for _, s := range summary {
+			size += len(s)
+		}
+		if err := checkTagQuotas(ctx, db, tagIDs, size); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+		id, created, err := upsertEntity(ctx, tx, name, entityType, "ignore")
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if created {
+			if len(entityTagIDs) == 0 && requiredTags.requires("entities") {
+				return toolError(codeTagRequired, "tags parameter is required for a new entity. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+			}
+			if err := linkEntityTags(ctx, tx, id, entityTagIDs); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to link tags: %v", err), nil
+			}
+		}
+		added := 0
+		for _, content := range append([]string{"Source: " + u.String()}, summary...) {
+			content = normalizeText(content)
+			result, err := tx.ExecContext(ctx, `INSERT INTO observations (entity_id, content, source, source_url)
+				SELECT ?, ?, 'ingest_url', ? WHERE NOT EXISTS (SELECT 1 FROM observations WHERE entity_id = ? AND content = ?)`,
+				id, content, u.String(), id, content)
+			if err != nil {
+				return execError(err, codeDatabase), nil
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				continue
+			}
+			added++
+			observationID, _ := result.LastInsertId()
+			if err := linkTags(ctx, tx, observationID, tagIDs); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to link tags: %v", err), nil
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+
+		state := "created"
+		if !created {
+			state = "already existed"
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("success: entity %d %s: %s (%s), %d observation(s) added from %s (%s) with %s%s",
+			id, state, name, entityType, added, u, summarisedBy, tagList(tagsStr), autoTagNote(autoTagged))), nil
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestDomainAllowed(t *testing.T) {
+	allowed := map[string]bool{"example.com": true, "en.wikipedia.org": true}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"blog.example.com", true},
+		{"EXAMPLE.com.", true},
+		{"notexample.com", false},
+		{"example.com.evil.net", false},
+		{"de.wikipedia.org", false},
+		{"en.wikipedia.org", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := domainAllowed(tt.host, allowed); got != tt.want {
+				t.Errorf("domainAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractPage(t *testing.T) {
+	page := `<!DOCTYPE html><html><head>
+<title>Ignored &amp; replaced</title>
+<meta property="og:title" content="ZFS on a budget">
+<style>body { color: red }</style>
+<script>var tracking = "<p>not text</p>";</script>
+</head><body>
+<nav><a href="/">Home</a> <a href="/about">About</a></nav>
+<header><h1>Site name</h1></header>
+<article>
+  <h1>ZFS on a <em>budget</em></h1>
+  <p>By Ann, 3 min read</p>
+  <!-- <p>commented out</p> -->
+  <p>Mirrored vdevs are easier to grow than RAID-Z:
+  add two disks at a time &mdash; no resilvering of the whole pool.</p>
+  <ul><li>Use ECC memory</li><li>Scrub monthly</li></ul>
+</article>
+<footer>&copy; 2024</footer>
+</body></html>`
+	title, paragraphs := extractPage(page, "text/html")
+	if title != "ZFS on a budget" {
+		t.Errorf("title = %q", title)
+	}
+	want := []string{
+		"ZFS on a budget",
+		"By Ann, 3 min read",
+		"Mirrored vdevs are easier to grow than RAID-Z: add two disks at a time — no resilvering of the whole pool.",
+		"Use ECC memory",
+		"Scrub monthly",
+	}
+	if !reflect.DeepEqual(paragraphs, want) {
+		t.Errorf("paragraphs = %q, want %q", paragraphs, want)
+	}
+
+	title, paragraphs = extractPage("Plain notes\n\nSecond paragraph\nwrapped.\n", "text/plain")
+	if title != "Plain notes" || !reflect.DeepEqual(paragraphs, []string{"Plain notes", "Second paragraph wrapped."}) {
+		t.Errorf("plain text = %q %q", title, paragraphs)
+	}
+}
+
+func TestLeadSummary(t *testing.T) {
+	long := strings.Repeat("word ", 150)
+	paragraphs := []string{"Short byline", strings.Repeat("a", 80), long, strings.Repeat("b", 90), strings.Repeat("c", 100)}
+	got := leadSummary(paragraphs)
+	if len(got) != 3 || got[0] != paragraphs[1] || got[2] != paragraphs[3] {
+		t.Fatalf("leadSummary() = %q", got)
+	}
+	if !strings.HasSuffix(got[1], "word…") || len([]rune(got[1])) > maxSummaryLine+1 {
+		t.Errorf("long paragraph not cut at a word: %q", got[1])
+	}
+}
+
+func TestIngestURL_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'Ingest test %'")
+	defer db.Exec("DELETE FROM observations WHERE source = 'ingest_url' AND source_url LIKE 'http://127.0.0.1:%'")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT id FROM observations WHERE source = 'ingest_url' AND source_url LIKE 'http://127.0.0.1:%')")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<html><head><title>Ingest test article</title></head><body><main>
+<p>Backups follow the 3-2-1 rule: three copies, on two different media, with one copy kept offsite.</p>
+<p>Restores should be tested every quarter, otherwise the backups cannot be trusted to work.</p>
+</main></body></html>`)
+		case "/away":
+			http.Redirect(w, r, "http://example.com/", http.StatusFound)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		}
+	}))
+	defer srv.Close()
+
+	saved := ingestDomains
+	defer func() { ingestDomains = saved }()
+	ingest := func(args map[string]any) (string, bool) {
+		t.Helper()
+		result, err := callTool(ingestURLHandler(db, nil, nil), "ingest_url", args)
+		if err != nil {
+			t.Fatalf("ingest_url: %v", err)
+		}
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	ingestDomains = map[string]bool{}
+	if text, isErr := ingest(map[string]any{"url": srv.URL + "/article", "tags": "homelab"}); !isErr || !strings.Contains(text, "ENGRAM_INGEST_DOMAINS") {
+		t.Errorf("expected ingesting to be off without domains: %s", text)
+	}
+
+	ingestDomains = map[string]bool{"127.0.0.1": true}
+	text, isErr := ingest(map[string]any{"url": srv.URL + "/article", "tags": "homelab"})
+	if isErr || !strings.Contains(text, "created: Ingest test article (Article), 3 observation(s) added") || !strings.Contains(text, "lead paragraphs") {
+		t.Fatalf("unexpected result: %s", text)
+	}
+	var n int
+	db.QueryRow(`SELECT count(*) FROM observations o JOIN entities e ON e.id = o.entity_id
+		WHERE e.name = 'Ingest test article' AND o.source_url = ? AND (o.content LIKE 'Source: %' OR o.content LIKE 'Backups follow%' OR o.content LIKE 'Restores should%')`, srv.URL+"/article").Scan(&n)
+	if n != 3 {
+		t.Errorf("%d stored observations, want the source and two lead paragraphs", n)
+	}
+
+	text, isErr = ingest(map[string]any{"url": srv.URL + "/article", "tags": "homelab", "summary": []any{"Ingest test: keep one backup copy offsite"}})
+	if isErr || !strings.Contains(text, "already existed") || !strings.Contains(text, "1 observation(s) added") || !strings.Contains(text, "given summary") {
+		t.Errorf("expected only the new summary to be added: %s", text)
+	}
+
+	smp := replyText("- Ingest test: 3-2-1 means three copies\n- Ingest test: test restores quarterly\n")
+	result, err := callTool(ingestURLHandler(db, nil, smp), "ingest_url", map[string]any{"url": srv.URL + "/article", "name": "Ingest test sampled", "tags": "homelab"})
+	if err != nil || result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "3 observation(s) added") {
+		t.Errorf("expected the source and two sampled facts: %v %v", err, result.Content)
+	}
+
+	for path, want := range map[string]string{"/away": "not in ENGRAM_INGEST_DOMAINS", "/image": "image/png is not a web page"} {
+		if text, isErr := ingest(map[string]any{"url": srv.URL + path, "tags": "homelab"}); !isErr || !strings.Contains(text, want) {
+			t.Errorf("%s: expected %q, got %s", path, want, text)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// inverseRelationsConfig is ENGRAM_INVERSE_RELATIONS: comma-separated pairs
+// of relation types that describe the same edge from either end, such as
+// "parent_of:child_of,manages:reports_to". A type on its own, such as
+// "married_to", is its own inverse.
+var inverseRelationsConfig = getEnv("ENGRAM_INVERSE_RELATIONS", "")
+
+// storeInverses has create_relations and store_summary write the inverse of
+// each new relation as a row of its own. Without it, inverses are only
+// implied in graph results.
+var storeInverses = getEnv("ENGRAM_STORE_INVERSES", "") == "true"
+
+// relationInverses maps each configured relation type to its inverse. serve
+// refuses to start when inverseRelationsErr is set.
+var relationInverses, inverseRelationsErr = parseInverses(inverseRelationsConfig)
+
+func parseInverses(s string) (map[string]string, error) {
+	inverses := make(map[string]string)
+	for _, pair := range parseTagNames(s) {
+		a, b, ok := strings.Cut(pair, ":")
+		a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+		if !ok {
+			b = a
+		}
+		if a == "" || b == "" {
+			return nil, fmt.Errorf("%q is not a relation type or a pair of them", pair)
+		}
+		for _, t := range []string{a, b} {
+			if _, dup := inverses[t]; dup {
+				return nil, fmt.Errorf("%s has more than one inverse", t)
+			}
+		}
+		inverses[a], inverses[b] = b, a
+	}
+	return inverses, nil
+}
+
+// inverseTypes lists the relation types that have an inverse, sorted.
+func inverseTypes() []string {
+	types := make([]string, 0, len(relationInverses))
+	for t := range relationInverses {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// insertInverse stores the inverse of a new relation from fromID to toID,
+// when storeInverses is set and relationType has one. It reports whether a
+// row was added; an inverse that already exists is left alone.
+func insertInverse(ctx context.Context, tx *sql.Tx, fromID, toID int64, relationType string, weight, properties any) (bool, error) {
+	inverse, ok := relationInverses[relationType]
+	if !storeInverses || !ok || (inverse == relationType && fromID == toID) {
+		return false, nil
+	}
+	result, err := tx.ExecContext(ctx, `INSERT INTO relations (from_id, to_id, relation_type, weight, properties)
+		SELECT ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM relations WHERE from_id = ? AND to_id = ? AND relation_type = ?)`,
+		toID, fromID, inverse, weight, properties, toID, fromID, inverse)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// relationWeightOrder sorts relations strongest first and unweighted ones
+// last, keeping the order of equal weights.
+func relationWeightOrder(relations []graphRelation) {
+	sort.SliceStable(relations, func(i, j int) bool {
+		a, b := relations[i].Weight, relations[j].Weight
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a > *b
+	})
+}
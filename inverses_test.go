@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInverses(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"pairs and symmetric", "parent_of:child_of, married_to", map[string]string{"parent_of": "child_of", "child_of": "parent_of", "married_to": "married_to"}, false},
+		{"missing half", "parent_of:", nil, true},
+		{"two inverses", "manages:reports_to,manages:leads", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseInverses(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseInverses(%q) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseInverses(%q) = %v, want %v", tt.config, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelationWeightOrder(t *testing.T) {
+	w := func(f float64) *float64 { return &f }
+	relations := []graphRelation{
+		{RelationType: "a"}, {RelationType: "b", Weight: w(0.2)}, {RelationType: "c"}, {RelationType: "d", Weight: w(0.9)}, {RelationType: "e", Weight: w(0.2)},
+	}
+	relationWeightOrder(relations)
+	var got []string
+	for _, r := range relations {
+		got = append(got, r.RelationType)
+	}
+	if strings.Join(got, "") != "dbeac" {
+		t.Errorf("order = %v, want d b e a c", got)
+	}
+}
+
+func TestInverseRelations_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'inverse-test-%'")
+	defer db.Exec("DELETE FROM relations WHERE relation_type LIKE 'inverse_test_%'")
+
+	savedInverses, savedStore := relationInverses, storeInverses
+	defer func() { relationInverses, storeInverses = savedInverses, savedStore }()
+	relationInverses, _ = parseInverses("inverse_test_parent_of:inverse_test_child_of,inverse_test_sibling_of")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('inverse-test-ann', 'Person'), ('inverse-test-bo', 'Person'), ('inverse-test-cy', 'Person')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	create := func(from, to, relationType string) []graphRelation {
+		t.Helper()
+		result, err := callTool(createRelationsHandler(db), "create_relations", map[string]any{"relations": []any{
+			map[string]any{"from": from, "to": to, "relationType": relationType},
+		}})
+		if err != nil {
+			t.Fatalf("create_relations: %v", err)
+		}
+		var created []graphRelation
+		decodeResult(t, result, &created)
+		return created
+	}
+	open := func(names ...any) []graphRelation {
+		t.Helper()
+		var graph knowledgeGraph
+		result, _ := callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": names})
+		decodeResult(t, result, &graph)
+		return graph.Relations
+	}
+
+	// Implied: only the stored direction is written.
+	if created := create("inverse-test-ann", "inverse-test-bo", "inverse_test_parent_of"); len(created) != 1 {
+		t.Fatalf("expected only the stored relation, got %+v", created)
+	}
+	relations := open("inverse-test-ann", "inverse-test-bo")
+	if len(relations) != 2 || relations[1].From != "inverse-test-bo" || relations[1].RelationType != "inverse_test_child_of" || !relations[1].Implied {
+		t.Errorf("expected bo child_of ann implied, got %+v", relations)
+	}
+
+	// Stored: the inverse gets a row and is not listed twice.
+	storeInverses = true
+	created := create("inverse-test-bo", "inverse-test-cy", "inverse_test_sibling_of")
+	if len(created) != 2 || created[1].From != "inverse-test-cy" || created[1].RelationType != "inverse_test_sibling_of" {
+		t.Fatalf("expected the relation and its inverse, got %+v", created)
+	}
+	relations = open("inverse-test-bo", "inverse-test-cy")
+	if len(relations) != 2 || relations[0].Implied || relations[1].Implied {
+		t.Errorf("expected two stored relations, got %+v", relations)
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM relations WHERE relation_type LIKE 'inverse_test_%'").Scan(&n)
+	if n != 3 {
+		t.Errorf("%d relations stored, want 3", n)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// undeterminedLanguage is stored for observations too short or mixed to
+// tell, so they are not looked at again (the BCP 47 code for "undetermined").
+const undeterminedLanguage = "und"
+
+// searchLanguages is ENGRAM_LANGUAGES: the languages observations are
+// detected as and questions are searched in.
+var searchLanguages = parseTableList(getEnv("ENGRAM_LANGUAGES", "en,sw"))
+
+// textLanguage is what detection and search need to know about a language:
+// its function words, which say what language a text is in and are not
+// worth searching for, and how to reduce a word to a stem that matches its
+// inflected forms as a substring.
+type textLanguage struct {
+	stopwords map[string]bool
+	stem      func(string) string
+}
+
+var textLanguages = map[string]textLanguage{
+	"en": {wordSet(`the a an and or but is are was were be been am i me my we our you your he she it its they them their
+		this that these those of to in on at for with from by as not no do does did have has had will would can could should
+		there here what which who when where why how about into than then so if just also very`), stemEnglish},
+	"sw": {wordSet(`na ya wa kwa ni za la cha vya kwamba katika kama lakini pia sana tu au ili bado hii hiyo huo huu
+		hizi hayo haya ile yule kile yake wake yangu wangu yako wako yetu wetu yao wao mimi wewe yeye sisi nyinyi wao
+		leo kesho jana sasa hapa pale huko nini nani gani wapi lini vipi je ndiyo hapana sio si kuna kulikuwa alikuwa
+		nilikuwa ana nina una tuna wana kila zaidi mpaka hadi baada kabla kutoka kuhusu`), stemSwahili},
+}
+
+func wordSet(s string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		words[w] = true
+	}
+	return words
+}
+
+// validateLanguages checks ENGRAM_LANGUAGES names only languages this build
+// knows.
+func validateLanguages() error {
+	if len(searchLanguages) == 0 {
+		return fmt.Errorf("ENGRAM_LANGUAGES is empty")
+	}
+	for code := range searchLanguages {
+		if _, ok := textLanguages[code]; !ok {
+			var known []string
+			for k := range textLanguages {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown language %q in ENGRAM_LANGUAGES, want some of: %s", code, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+func textWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+}
+
+// detectLanguage guesses the language of text among searchLanguages by its
+// function words, with Swahili's habit of ending every word in a vowel as a
+// tie-breaker for short notes. It returns undeterminedLanguage when no
+// language stands out.
+func detectLanguage(text string) string {
+	words := textWords(text)
+	scores := make(map[string]float64)
+	for code := range searchLanguages {
+		l := textLanguages[code]
+		for _, w := range words {
+			if l.stopwords[w] {
+				scores[code]++
+			}
+		}
+	}
+	if searchLanguages["sw"] && len(words) >= 3 {
+		vowelFinal := 0
+		for _, w := range words {
+			if r, _ := utf8.DecodeLastRuneInString(w); strings.ContainsRune("aeiou", r) {
+				vowelFinal++
+			}
+		}
+		if float64(vowelFinal) >= 0.85*float64(len(words)) {
+			scores["sw"]++
+		}
+	}
+
+	best, bestScore, tied := undeterminedLanguage, 0.0, false
+	for code, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = code, score, false
+		case score == bestScore && score > 0:
+			tied = true
+		}
+	}
+	if bestScore < 1 || tied {
+		return undeterminedLanguage
+	}
+	return best
+}
+
+// stemEnglish strips possessives and common inflections: "backups" becomes
+// "backup" and "backing" "back", which match "backup" as a substring.
+func stemEnglish(w string) string {
+	w = strings.TrimSuffix(w, "'s")
+	for _, s := range []struct {
+		suffix string
+		min    int
+	}{{"ies", 4}, {"ing", 4}, {"ed", 4}, {"es", 4}, {"s", 4}} {
+		if strings.HasSuffix(w, s.suffix) && !strings.HasSuffix(w, "ss") && utf8.RuneCountInString(w)-len(s.suffix) >= s.min {
+			return strings.TrimSuffix(w, s.suffix)
+		}
+	}
+	return w
+}
+
+// swahiliVerbPrefix matches the subject and tense markers a Swahili verb
+// starts with ("ni-li-nunua", "a-na-soma", "wa-ta-kuja"), or the infinitive
+// "ku-".
+var swahiliVerbPrefix = regexp.MustCompile(`^(?:(?:ha|si)?(?:ni|u|a|tu|m|wa|ki|vi|li|ya|i|zi)(?:li|na|ta|me|nge|ka)|ku)`)
+
+// stemSwahili strips a verb's prefixes, so "nilinunua" (I bought) and
+// "atanunua" (she will buy) both match "nunua". The root must keep four
+// letters, which leaves nouns like "kitabu" alone.
+func stemSwahili(w string) string {
+	if loc := swahiliVerbPrefix.FindStringIndex(w); loc != nil && utf8.RuneCountInString(w[loc[1]:]) >= 4 {
+		return w[loc[1]:]
+	}
+	return w
+}
+
+// searchTerm reduces a question word to what keyword search looks for: the
+// stem in the question's language, or the shortest stem any language gives
+// when the question's language is not known.
+func searchTerm(w, lang string) string {
+	if l, ok := textLanguages[lang]; ok {
+		return l.stem(w)
+	}
+	term := w
+	for code := range searchLanguages {
+		if s := textLanguages[code].stem(w); len(s) < len(term) {
+			term = s
+		}
+	}
+	return term
+}
+
+// isStopword reports whether w is a function word in any search language.
+func isStopword(w string) bool {
+	for code := range searchLanguages {
+		if textLanguages[code].stopwords[w] {
+			return true
+		}
+	}
+	return false
+}
+
+// detectLanguages records the language of up to batch observations that
+// have none yet, returning how many it looked at.
+func detectLanguages(ctx context.Context, db *sql.DB, batch int) (int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT o.id, o.content FROM observations o
+		WHERE NOT EXISTS (SELECT 1 FROM observation_languages l WHERE l.observation_id = o.id)
+		ORDER BY o.id LIMIT ?`, batch)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		id      int64
+		content string
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.content); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, p := range todo {
+		if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO observation_languages (observation_id, language) VALUES (?, ?)",
+			p.id, detectLanguage(p.content)); err != nil {
+			return 0, err
+		}
+	}
+	return len(todo), tx.Commit()
+}
+
+// detectLanguagesPeriodically keeps observation_languages up to date until
+// ctx is done.
+func detectLanguagesPeriodically(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := detectLanguages(ctx, db, 500)
+			if err != nil {
+				log.Printf("language detection failed: %v", err)
+			}
+			if err != nil || n < 500 {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The NAS has four disks in a mirrored pool", "en"},
+		{"Mama anapenda chai ya tangawizi kila asubuhi", "sw"},
+		{"Nilinunua gari jipya mwaka jana", "sw"},
+		{"Rafiki yangu anaishi Mombasa", "sw"},
+		{"ZFS 2.3", undeterminedLanguage},
+		{"", undeterminedLanguage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := detectLanguage(tt.text); got != tt.want {
+				t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		lang, word, want string
+	}{
+		{"en", "backups", "backup"},
+		{"en", "restoring", "restor"},
+		{"en", "batteries", "batter"},
+		{"en", "glass", "glass"},
+		{"en", "used", "used"},
+		{"sw", "nilinunua", "nunua"},
+		{"sw", "atanunua", "nunua"},
+		{"sw", "wanasoma", "soma"},
+		{"sw", "kusafiri", "safiri"},
+		{"sw", "kitabu", "kitabu"},
+		{"sw", "walimu", "walimu"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang+"/"+tt.word, func(t *testing.T) {
+			if got := textLanguages[tt.lang].stem(tt.word); got != tt.want {
+				t.Errorf("stem(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLanguages(t *testing.T) {
+	saved := searchLanguages
+	defer func() { searchLanguages = saved }()
+
+	searchLanguages = parseTableList("en,SW")
+	if err := validateLanguages(); err != nil {
+		t.Errorf("validateLanguages(en,SW) = %v", err)
+	}
+	searchLanguages = parseTableList("en,fr")
+	if err := validateLanguages(); err == nil || !strings.Contains(err.Error(), `unknown language "fr"`) {
+		t.Errorf("expected fr to be rejected, got %v", err)
+	}
+}
+
+func TestDetectLanguages_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM entities WHERE name = 'Language test'")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Language test')")
+	defer db.Exec("DELETE FROM observation_languages WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Language test')")
+
+	result, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('Language test', 'Test')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entityID, _ := result.LastInsertId()
+	result, err = db.Exec("INSERT INTO observations (entity_id, content) VALUES (?, 'Nilinunua gari jipya mwaka jana')", entityID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+
+	for {
+		n, err := detectLanguages(ctx, db, 500)
+		if err != nil {
+			t.Fatalf("detectLanguages: %v", err)
+		}
+		if n < 500 {
+			break
+		}
+	}
+	var lang string
+	db.QueryRow("SELECT language FROM observation_languages WHERE observation_id = ?", id).Scan(&lang)
+	if lang != "sw" {
+		t.Errorf("language = %q, want sw", lang)
+	}
+
+	// Editing the content clears the language until the next pass.
+	db.Exec("UPDATE observations SET content = 'The NAS has four disks in a mirrored pool' WHERE id = ?", id)
+	if n, err := detectLanguages(ctx, db, 500); err != nil || n != 1 {
+		t.Fatalf("detectLanguages after the edit = %d, %v; want only the edited observation", n, err)
+	}
+	db.QueryRow("SELECT language FROM observation_languages WHERE observation_id = ?", id).Scan(&lang)
+	if lang != "en" {
+		t.Errorf("language after the edit = %q, want en", lang)
+	}
+}
@@ -3,238 +3,932 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	neturl "net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
-	_ "github.com/tursodatabase/libsql-client-go/libsql"
 )
 
 var (
 	dbURL             = getEnv("LIBSQL_URL", "http://localhost:8080")
-	dangerousOps      = regexp.MustCompile(`(?i)^\s*(DROP|TRUNCATE|ALTER|CREATE|ATTACH|DETACH)\b`)
-	writeOps          = regexp.MustCompile(`(?i)^\s*(INSERT|UPDATE|DELETE)\b`)
-	observationInsert = regexp.MustCompile(`(?i)^\s*INSERT\s+INTO\s+observations\b`)
+	dbAuthToken       = getEnv("LIBSQL_AUTH_TOKEN", "")
+	observationInsert = insertInto("observations")
+	entityInsert      = insertInto("entities")
 )
 
 func getEnv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
+	if v := setting(key); v != "" {
 		return v
 	}
 	return fallback
 }
 
+func getEnvInt(key string, fallback int) int {
+	v := setting(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("ignoring %s=%q: not an integer, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
 func main() {
-	db, err := sql.Open("libsql", dbURL)
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	if cmd == "help" || cmd == "-h" || cmd == "--help" {
+		usage(os.Stdout)
+		return
+	}
+
+	c, ok := commands[cmd]
+	if !ok {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	// doctor and init connect by themselves: doctor to say why connecting
+	// fails without touching the schema, init to the database it asks for.
+	var db *sql.DB
+	if cmd != "doctor" && cmd != "init" {
+		var err error
+		if db, err = openDB(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+	}
+
+	if err := c.run(context.Background(), db, args); err != nil {
+		log.Fatalf("%s: %v", cmd, err)
+	}
+}
+
+func openDB(ctx context.Context) (*sql.DB, error) {
+	return openURL(ctx, withAuthToken(dbURL, dbAuthToken))
+}
+
+// withAuthToken adds token to url as the authToken parameter the libSQL
+// driver reads, unless url already has one.
+func withAuthToken(url, token string) string {
+	if token == "" || strings.Contains(url, "authToken=") {
+		return url
+	}
+	if strings.Contains(url, "?") {
+		return url + "&authToken=" + neturl.QueryEscape(token)
+	}
+	return url + "?authToken=" + neturl.QueryEscape(token)
+}
+
+// openURL connects to the libSQL server at url and migrates its schema.
+func openURL(ctx context.Context, url string) (*sql.DB, error) {
+	db, err := connect(ctx, url)
 	if err != nil {
-		log.Fatalf("failed to connect to libsql: %v", err)
+		return nil, err
+	}
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %v", err)
 	}
-	defer db.Close()
+	return db, nil
+}
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("failed to ping libsql: %v", err)
+// connect opens url with the configured pragmas and writer lock, without
+// touching its schema.
+func connect(ctx context.Context, url string) (*sql.DB, error) {
+	var pragmas []string
+	if foreignKeys {
+		pragmas = append(pragmas, "PRAGMA foreign_keys = ON")
+	}
+	if busyTimeoutMS > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeoutMS))
+	}
+	var writer writeLock
+	if singleWriter {
+		writer = newWriteLock()
 	}
 
-	s := server.NewMCPServer(
-		"memory-mcp",
-		"1.0.0",
-		server.WithResourceCapabilities(true, false),
-		server.WithLogging(),
-	)
+	routeDatabase(url)
+	var db *sql.DB
+	if len(pragmas) > 0 || writer != nil || tracing != nil {
+		db = sql.OpenDB(&pragmaConnector{dsn: url, pragmas: pragmas, writer: writer})
+	} else {
+		var err error
+		if db, err = sql.Open("libsql", url); err != nil {
+			return nil, fmt.Errorf("failed to connect to libsql: %v", err)
+		}
+	}
 
-	s.AddResource(mcp.NewResource(
-		"memory://schema",
-		"Database schema",
-		mcp.WithResourceDescription("Table definitions for the memory database"),
-		mcp.WithMIMEType("text/plain"),
-	), schemaHandler())
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping libsql: %v", err)
+	}
+	return db, nil
+}
 
-	s.AddTool(mcp.NewTool("query",
-		mcp.WithDescription(`Execute a SELECT query and return results.
+func serve(ctx context.Context, db *sql.DB, args []string) error {
+	scopes, err := parseVisibilityScopes(visibilityScope, clientVisibility)
+	if err != nil {
+		return fmt.Errorf("invalid visibility config: %v", err)
+	}
 
-All observations are tagged with broad categories. Check tags first to find what you're looking for:
-  SELECT name, description FROM tags
+	access, err := parseToolAccess(enabledTools, disabledTools, clientTools)
+	if err != nil {
+		return fmt.Errorf("invalid tool config: %v", err)
+	}
 
-Then filter observations by tag via observation_tags junction table. Build whatever query you need from there.`),
-		mcp.WithString("sql",
-			mcp.Required(),
-			mcp.Description("SQL SELECT statement to execute"),
-		),
-	), queryHandler(db))
+	secrets, err := parseSecretPolicy(secretPolicyMode, forbiddenPatternsFile)
+	if err != nil {
+		return fmt.Errorf("invalid secret policy: %v", err)
+	}
 
-	s.AddTool(mcp.NewTool("execute",
-		mcp.WithDescription(`Execute INSERT, UPDATE, or DELETE statement. Use this for writing data.
+	if tagPolicyErr != nil {
+		return fmt.Errorf("invalid tag policy: %v", tagPolicyErr)
+	}
 
-IMPORTANT: When inserting observations, you MUST provide the tags parameter.
-Tags are broad categories: homelab, career, drinks, personal.
-Query 'SELECT name, description FROM tags' to see available tags.
-If you need a new tag, ask the user first before creating it.`),
-		mcp.WithString("sql",
-			mcp.Required(),
-			mcp.Description("SQL statement (INSERT, UPDATE, or DELETE)"),
-		),
-		mcp.WithString("tags",
-			mcp.Description("Required for observation inserts. Comma-separated tag names, e.g. 'homelab' or 'career,personal'"),
-		),
-	), executeHandler(db))
-
-	if err := server.ServeStdio(s); err != nil {
-		log.Fatalf("server error: %v", err)
+	if inverseRelationsErr != nil {
+		return fmt.Errorf("invalid inverse relations: %v", inverseRelationsErr)
+	}
+
+	if feedsErr != nil {
+		return fmt.Errorf("invalid feeds: %v", feedsErr)
+	}
+
+	if tagQuotasErr != nil {
+		return fmt.Errorf("invalid tag quotas: %v", tagQuotasErr)
+	}
+
+	if namespacesErr != nil {
+		return fmt.Errorf("invalid client tags: %v", namespacesErr)
+	}
+
+	if dueWebhookErr != nil {
+		return fmt.Errorf("invalid due webhook: %v", dueWebhookErr)
+	}
+
+	digestScope, err := digestLevels(scopes)
+	if err != nil {
+		return fmt.Errorf("invalid ENGRAM_DIGEST_VISIBILITY: %v", err)
+	}
+
+	if entityTemplatesErr != nil {
+		return fmt.Errorf("invalid entity templates: %v", entityTemplatesErr)
+	}
+	if taxonomyErr != nil {
+		return fmt.Errorf("invalid taxonomy: %v", taxonomyErr)
+	}
+	if added, err := applyTaxonomy(ctx, db, taxonomy); err != nil {
+		return fmt.Errorf("applying taxonomy: %v", err)
+	} else if added > 0 {
+		log.Printf("taxonomy: added %d tag(s)", added)
 	}
+
+	if oversizedObservations != "chunk" && oversizedObservations != "reject" {
+		return fmt.Errorf("invalid ENGRAM_OVERSIZED_OBSERVATIONS %q, want chunk or reject", oversizedObservations)
+	}
+
+	if err := validateLanguages(); err != nil {
+		return fmt.Errorf("invalid languages: %v", err)
+	}
+
+	chat, err := newChatSampler(summaryURL, summaryModel, summaryAPIKey)
+	if err != nil {
+		return fmt.Errorf("invalid summary config: %v", err)
+	}
+	if coldURL != "" {
+		cold, err := openCold(ctx, coldURL)
+		if err != nil {
+			return fmt.Errorf("invalid cold storage: %v", err)
+		}
+		cold.Close()
+	}
+
+	if compactObservations > 0 && compactHours > 0 && chat == nil {
+		return fmt.Errorf("invalid compaction config: ENGRAM_COMPACT_OBSERVATIONS needs ENGRAM_SUMMARY_URL, background compaction has no client to sample")
+	}
+
+	embedder, err := newEmbedder(embedderName, embeddingModel, embeddingURL, embeddingAPIKey, embeddingDimensions)
+	if err != nil {
+		return fmt.Errorf("invalid embedder config: %v", err)
+	}
+	var vectors *vectorIndex
+	if embedder != nil {
+		vectors = newVectorIndex(ctx, db)
+	}
+
+	metrics := newResultMetrics()
+	shapes := newQueryShapes()
+	slow := newSlowLog(db)
+	// Sessions turn snapshot reads on with snapshot_reads; a call to a tool
+	// not annotated read-only releases the snapshot.
+	var s *server.MCPServer
+	snaps := newSnapshots(db)
+	opts := []server.ServerOption{
+		server.WithResourceCapabilities(true, true),
+		server.WithLogging(),
+		server.WithToolFilter(access.filter),
+		server.WithToolHandlerMiddleware(tracing.middleware),
+		server.WithToolHandlerMiddleware(tracing.stage("check access", access.middleware)),
+		server.WithToolHandlerMiddleware(tracing.stage("check secrets", secrets.middleware)),
+		server.WithToolHandlerMiddleware(metrics.middleware),
+		server.WithToolHandlerMiddleware(shapes.middleware),
+		server.WithToolHandlerMiddleware(slow.middleware),
+		server.WithHooks(snaps.hooks(func(name string) bool { return readOnlyTool(s, name) })),
+	}
+
+	s = server.NewMCPServer("memory-mcp", "1.0.0", opts...)
+	var rerank, tagger, summariser sampler
+	if samplingRerank || samplingTags || samplingIngest || chat == nil {
+		s.EnableSampling()
+	}
+	// compact_memories summarizes with the configured model, or the client's.
+	var compactor sampler = clientSampler{s}
+	if chat != nil {
+		compactor = chat
+	}
+	if samplingRerank {
+		rerank = clientSampler{s}
+	}
+	if samplingIngest {
+		summariser = clientSampler{s}
+	}
+	if samplingTags {
+		tagger = clientSampler{s}
+	}
+	// Some tools and resources describe the tags, entity types and user
+	// tables in the database; they are registered through guided and
+	// schemaResource so they can be rebuilt when those change.
+	if _, err := liveGuide.load(ctx, db); err != nil {
+		return err
+	}
+	var guided guideTools
+	s.AddResource(schemaResource(), schemaHandler(db))
+	registerMetrics(s, metrics)
+	registerSlowLog(s, slow)
+	registerSubscribableResources(s, db, scopes)
+	registerEntityTools(s, db, scopes, &guided)
+	registerReminders(s, db, scopes)
+	registerConversationContext(s, db, scopes)
+	registerSQLTools(s, db, snaps, scopes, tagger, &guided)
+	registerSnapshotReads(s, snaps)
+	registerValidateQuery(s, db, snaps, scopes)
+	registerSavedQueries(s, db, snaps, scopes)
+	registerObservationTools(s, db, scopes, tagger, &guided)
+	registerReviewStale(s, db, scopes)
+	registerSessionNotes(s, db, scopes)
+	registerStoreSummary(s, db, &guided)
+	registerRenameEntity(s, db, scopes)
+	registerAttributes(s, db)
+	registerGeo(s, db)
+	registerGraphTools(s, db, scopes)
+	registerResolve(s, db)
+	registerMaintenance(s, db)
+	registerCompactMemories(s, db, scopes, compactor)
+	registerUnarchive(s, db)
+	registerCheckIntegrity(s, db)
+	registerGraphStats(s, db)
+	registerFindOrphans(s, db)
+	registerDedupeRelations(s, db)
+	registerSemanticSearch(s, db, scopes, embedder, vectors)
+	registerAskMemory(s, db, scopes, rerank, embedder, vectors)
+	registerRecallSnapshots(s, db, scopes)
+	registerFeedback(s, db, scopes)
+	registerVerify(s, db, scopes)
+	registerThread(s, db, scopes)
+	registerClusterMemories(s, db, scopes, embedder)
+	registerCount(s, db, scopes)
+	registerBulkDelete(s, db, scopes)
+	registerTagStats(s, db, scopes)
+	registerHeatmap(s, db, scopes)
+	registerQueryReport(s, db, shapes)
+	registerTagUsage(s, db, metrics)
+	registerDigest(s, db, scopes)
+	registerSearchMetadata(s, db, scopes)
+	registerIngestURL(s, db, tagger, summariser, &guided)
+	registerAttachments(s, db, scopes)
+	registerGetContent(s, db, scopes)
+	registerChangesSince(s, db, scopes)
+	if defineTables {
+		registerDefineTable(s, db)
+	}
+
+	if err := access.validate(s.ListTools()); err != nil {
+		return fmt.Errorf("invalid tool config: %v", err)
+	}
+
+	if oidcIssuer != "" && restAddr == "" {
+		return fmt.Errorf("invalid OIDC config: ENGRAM_OIDC_ISSUER needs ENGRAM_REST_ADDR")
+	}
+	// REST and gRPC calls go through the same middleware as MCP calls.
+	middleware := []server.ToolHandlerMiddleware{tracing.middleware, tracing.stage("check access", access.middleware),
+		tracing.stage("check secrets", secrets.middleware), metrics.middleware, shapes.middleware, slow.middleware}
+	if restAddr != "" {
+		var oidc *oidcProvider
+		if oidcIssuer != "" {
+			if oidc, err = newOIDCProvider(ctx, oidcIssuer, oidcClientID, oidcClientSecret, oidcRedirectURL, oidcClaim, oidcUsers); err != nil {
+				return fmt.Errorf("invalid OIDC config: %v", err)
+			}
+		}
+		api, err := newRESTAPI(s, restToken, oidc, middleware...)
+		if err != nil {
+			return fmt.Errorf("invalid REST config: %v", err)
+		}
+		ln, err := net.Listen("tcp", restAddr)
+		if err != nil {
+			return fmt.Errorf("invalid REST config: %v", err)
+		}
+		go serveREST(ctx, ln, api.handler())
+	}
+	if grpcAddr != "" {
+		memory, err := newGRPCMemory(s, middleware...)
+		if err != nil {
+			return fmt.Errorf("invalid gRPC config: %v", err)
+		}
+		ln, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			return fmt.Errorf("invalid gRPC config: %v", err)
+		}
+		go serveGRPC(ctx, ln, newGRPCServer(memory, grpcToken))
+	}
+
+	if tracing != nil {
+		go tracing.exportPeriodically(ctx, 5*time.Second)
+		defer tracing.shutdown()
+	}
+	if warmupConnections > 0 {
+		go warmupInBackground(ctx, db, scopes.defaultLevels(), warmupConnections)
+	}
+	go expireSessionNotes(ctx, db, 15*time.Minute)
+	go shapes.flushPeriodically(ctx, db, time.Minute)
+	go detectLanguagesPeriodically(ctx, db, time.Minute)
+	if maintenanceHours > 0 {
+		go maintainPeriodically(ctx, db, time.Duration(maintenanceHours)*time.Hour)
+	}
+	if digestDir != "" && digestDays > 0 {
+		go digestPeriodically(ctx, db, digestScope, time.Duration(digestDays)*24*time.Hour)
+	}
+	if embedder != nil {
+		go embedPeriodically(ctx, db, embedder, time.Minute)
+	}
+	if syncPeer != "" && syncMinutes > 0 {
+		go syncPeriodically(ctx, db, syncPeer, time.Duration(syncMinutes)*time.Minute)
+	}
+	if len(feeds) > 0 && feedMinutes > 0 {
+		go pullFeedsPeriodically(ctx, db, feeds, time.Duration(feedMinutes)*time.Minute)
+	}
+	if dueWebhookURL != "" {
+		go notifyDuePeriodically(ctx, db, scopes.defaultLevels(), dueWebhookInterval)
+	}
+	// Rebuilding the tools and resources that describe the database tells
+	// clients their lists changed, so they fetch the new descriptions.
+	subs := newSubscriptions()
+	go liveGuide.watch(ctx, db, changePollInterval, func(change guideChange) {
+		guided.rebuild(s)
+		if change.tables {
+			s.AddResource(schemaResource(), schemaHandler(db))
+			subs.notifyAll(schemaURI, notifier(s))
+		}
+	})
+	if coldURL != "" && coldHours > 0 {
+		go moveToColdPeriodically(ctx, db, coldURL, time.Duration(coldHours)*time.Hour)
+	}
+	if compactObservations > 0 && compactHours > 0 {
+		go compactPeriodically(ctx, db, chat, time.Duration(compactHours)*time.Hour)
+	}
+
+	if mcpAddr != "" {
+		return serveHTTP(ctx, s, db, subs)
+	}
+	return serveStdio(ctx, s, db, subs)
 }
 
-func schemaHandler() server.ResourceHandlerFunc {
-	schema := `-- memory database schema
+const schemaText = `-- memory database schema
 
-entities (id, name, entity_type, created_at)
-observations (id, entity_id, content, created_at)
-relations (id, from_id, to_id, relation_type, created_at)
-tags (id, name, description, created_at)
+entities (id, name, entity_type, created_at, archived_at, pinned_at, latitude, longitude)
+observations (id, entity_id, content, content_sha256, visibility, source, conversation_id, source_url, confidence, metadata, verified_at, verified_by, parent_id, created_at)
+relations (id, from_id, to_id, relation_type, confidence, weight, properties, created_at)
+tags (id, name, description, parent_id, created_at)
 observation_tags (observation_id, tag_id)
+entity_tags (entity_id, tag_id)
+unknowns (id, entity_id, question, created_at, resolved_at, observation_id)
+session_notes (id, session_id, entity_id, content, created_at, expires_at, client)
+contents (id, sha256, body, size, created_at)
+attachments (id, observation_id, name, mime_type, size, sha256, data, path, url, created_at)
+saved_queries (name, sql, description, created_at, updated_at)
+reminders (id, observation_id, due_at, completed_at, created_at, rrule, series_start, occurrence, notified_at)
+observation_embeddings (observation_id, model, dimensions, embedding, created_at)
+observation_languages (observation_id, language)
+archived_observations (id, summary_id, entity_id, content, visibility, confidence, source, conversation_id, source_url, metadata, tags, created_at, archived_at)
+recall_feedback (id, observation_id, helpful, question, created_at)
+recall_snapshots (id, question, client, levels, result, created_at)
+entity_attributes (id, entity_id, name, value, value_type, source, created_at, updated_at)
+entity_attribute_history (id, entity_id, name, value, value_type, source, valid_from, valid_to)
+entity_aliases (id, alias, entity_id, created_at)
+query_shapes (fingerprint, tool, shape, calls, errors, total_ms, total_rows, first_seen, last_seen)
+observation_access (observation_id, day, hits, last_at)
+entity_access (entity_id, day, hits, last_at)
+observation_reviews (observation_id, reviewed_at)
+observations_fts (content), entities_fts (name): full-text indexes, rowid = observations.id / entities.id
 
 All observations are categorized via tags. Query tags first to see available categories:
   SELECT name, description FROM tags
 
-When inserting observations, the 'tags' parameter is required in execute tool.
+Tags can nest: parent_id is the broader tag a subcategory belongs to, NULL for a
+top-level category.
+
+When inserting observations (and entities, if the server's tag policy asks for it),
+the 'tags' parameter is required in execute tool.
+
+Observation visibility is 'private' (default), 'shared' or 'public'. Clients only
+see observations at the levels their scope allows.
+
+Provenance: source says where an observation came from ('user' for things the user
+said, 'inferred' for agent conclusions, 'import', ...), conversation_id and source_url
+record the conversation or page it was taken from.
+
+Confidence (0-1, NULL if unscored) on observations and relations separates what the user
+said (1.0) from what an agent inferred. Filter or sort with e.g. WHERE confidence >= 0.8
+or ORDER BY confidence DESC.
+
+verified_at and verified_by are set on observations a person confirmed with the verify
+tool, the most trusted facts in memory. Editing the content clears them:
+  SELECT id, content, verified_by FROM observations WHERE verified_at IS NOT NULL
+
+parent_id names the observation an observation corrects or follows up, making a thread.
+Recall tools show only the latest item of a thread unless asked for its history; the
+thread tool lists a whole one. Leave out superseded observations yourself with e.g.
+  SELECT o.id, o.content FROM observations o
+  WHERE NOT EXISTS (SELECT 1 FROM observations f WHERE f.parent_id = o.id)
+
+metadata holds typed fields of an observation as a JSON object, e.g. {"host": "nas", "port": 8080}.
+Set it with add_observation or store_summary, find observations by field with search_metadata,
+or use SQLite JSON functions directly:
+  SELECT id, content FROM observations WHERE json_extract(metadata, '$.port') = 8080
+
+archived_at is set on entities hidden by archive_entity (finished projects, former employers).
+Exclude them from your own queries with WHERE archived_at IS NULL. pinned_at is set on
+core entities marked with pin_entity, returned by the memory://pinned resource.
+latitude and longitude (decimal degrees) locate an entity; set them with set_location and
+find entities near a place or point with nearby.
+entity_aliases holds former names of entities renamed with rename_entity. The tools that
+take an entity name accept them too; resolve one yourself with e.g.
+  SELECT e.name FROM entity_aliases a JOIN entities e ON e.id = a.entity_id WHERE a.alias = 'Acme Corp'
+
+entity_attributes holds stable facts about an entity as typed fields, one value per name
+(birthday, ip_address, employer), set with set_attribute and read with get_profile. Keep
+such facts there instead of repeating them in observations. value_type is text, number,
+boolean (1/0), date (YYYY-MM-DD, or --MM-DD without a year), email, url or ip:
+  SELECT e.name, a.value FROM entity_attributes a JOIN entities e ON e.id = a.entity_id
+  WHERE a.name = 'employer'
+When a value is changed or removed, the old one moves to entity_attribute_history, valid
+from when it was set until valid_to; attribute_history lists them.
+
+Open questions about an entity go in unknowns. Open ones have resolved_at IS NULL;
+answer them with the resolve tool, which records the answer as an observation.
+
+session_notes is short-lived working memory written by remember_for_session. Notes
+expire automatically and are not observations; use promote to keep them.
+
+attachments hold files, images and links for an observation. Add them with the attach
+tool and read them with get_attachment; select columns other than data when listing:
+  SELECT id, name, mime_type, size, url FROM attachments WHERE observation_id = 1
+
+Long observations (ENGRAM_CONTENT_DEDUP_BYTES and up) are stored once in contents, by
+SHA-256, however many entities they are filed under. Their content is a preview naming the
+hash and content_sha256 points at the body; read the full text with get_content.
+
+observation_languages holds the detected language of each observation as a code from
+ENGRAM_LANGUAGES ('en', 'sw', ...) or 'und' when it cannot tell, filled in within a minute
+of writing. Filter by language with:
+  SELECT o.id, o.content FROM observations o JOIN observation_languages l ON l.observation_id = o.id
+  WHERE l.language = 'sw'
+
+Observation content is stored in Unicode NFC. observations_fts and entities_fts match
+words regardless of case and diacritics, so 'malmo' finds "Malmö"; "word"* matches prefixes:
+  SELECT o.id, o.content FROM observations o
+  WHERE o.id IN (SELECT rowid FROM observations_fts WHERE observations_fts MATCH 'malmo')
+
+archived_observations holds observations compact_memories folded into a summary, under
+their old id, with summary_id pointing at the summary (source 'compaction') and tags as
+comma-separated names. They are out of recall; read them back with e.g.
+  SELECT created_at, content FROM archived_observations WHERE summary_id = 42 ORDER BY created_at
+With ENGRAM_COLD_URL set, these and the observations of archived entities move to a separate
+cold database after ENGRAM_COLD_DAYS; the unarchive tool restores observations from either.
+
+saved_queries holds named SELECT queries with :name placeholders, written by save_query
+and run with run_saved_query.
+
+reminders turn observations into action items with a due date (UTC). Open ones have
+completed_at IS NULL. Add them with add_reminder, list what is due with list_due and
+close them with complete.
+A repeating reminder has an rrule (e.g. FREQ=WEEKLY;BYDAY=SA) and occurrence is its
+number in the series that began at series_start; completing one inserts the next.
+notified_at is set once the ENGRAM_DUE_WEBHOOK webhook for a due reminder was sent.
+
+changes (id, op, table_name, row_id, payload, changed_at) is an append-only log of every
+insert, update and delete on the tables above except session_notes, written by triggers.
+payload is the row as JSON. Read it with the changes_since tool. sync_state tracks
+how far the sync command has exchanged changes with each peer instance.
+
+query_shapes counts the SQL sent to query, execute and the other SQL tools by shape: the
+statement with comments and values taken out, so queries differing only in values share a
+fingerprint. Find the queries that fail most with e.g.
+  SELECT tool, shape, calls, errors FROM query_shapes ORDER BY errors DESC LIMIT 10
+
+observation_access and entity_access count, per day (YYYY-MM-DD, UTC), how often
+search_nodes, open_nodes, ask_memory and semantic_search returned each observation and
+entity; last_at is the latest. The heatmap tool reports them by tag, entity type or entity.
+observation_reviews records when review_stale last found an observation still true.
 `
+
+// schemaResource describes memory://schema, listing the user tables.
+func schemaResource() mcp.Resource {
+	return mcp.NewResource(
+		schemaURI,
+		"Database schema",
+		mcp.WithResourceDescription(liveGuide.schemaDescription()),
+		mcp.WithMIMEType("text/plain"),
+	)
+}
+
+func schemaHandler(db *sql.DB) server.ResourceHandlerFunc {
 	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		userTables, err := userTablesSchema(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read user_tables: %v", err)
+		}
 		return []mcp.ResourceContents{
 			mcp.TextResourceContents{
-				URI:      "memory://schema",
+				URI:      schemaURI,
 				MIMEType: "text/plain",
-				Text:     schema,
+				Text:     schemaText + userTables,
 			},
 		}, nil
 	}
 }
 
+// validateSQL checks a statement is one the tool may run: a single
+// statement, nothing blocked, a write for execute and a read for query,
+// judged by the verb after any WITH clause, and a write only to a table
+// ENGRAM_WRITABLE_TABLES allows.
 func validateSQL(sql string, allowWrite bool) error {
-	if dangerousOps.MatchString(sql) {
-		return fmt.Errorf("dangerous operation not allowed: DROP, TRUNCATE, ALTER, CREATE, ATTACH, DETACH are blocked")
+	stmt, err := parseStatement(sql)
+	if err != nil {
+		return err
+	}
+	if blockedVerbs[stmt.verb] {
+		return errorf(codeForbiddenSQL, "dangerous operation not allowed: DROP, TRUNCATE, ALTER, CREATE, ATTACH, DETACH are blocked")
 	}
 
-	isWrite := writeOps.MatchString(sql)
+	isWrite := stmt.isWrite()
 	if isWrite && !allowWrite {
-		return fmt.Errorf("write operations not allowed in query tool, use execute tool instead")
+		return errorf(codeWriteInQuery, "write operations not allowed in query tool, use execute tool instead")
+	}
+	if stmt.with && !isWrite && stmt.verb != "SELECT" && stmt.verb != "VALUES" {
+		return errorf(codeInvalidSQL, "a WITH clause must be followed by SELECT, INSERT, UPDATE or DELETE, not %s", stmt.verb)
 	}
 	if !isWrite && allowWrite {
-		return fmt.Errorf("SELECT not allowed in execute tool, use query tool instead")
+		return errorf(codeReadInExecute, "SELECT not allowed in execute tool, use query tool instead")
 	}
 
-	return nil
+	return checkWritable(sql, writableTables)
 }
 
-func queryHandler(db *sql.DB) server.ToolHandlerFunc {
+// registerSQLTools adds query and execute, the tools that run SQL as written.
+func registerSQLTools(s *server.MCPServer, db *sql.DB, snaps *snapshots, scopes *visibilityScopes, tagger sampler, guided *guideTools) {
+	guided.add(s, func() server.ServerTool {
+		return server.ServerTool{Tool: mcp.NewTool("query",
+			mcp.WithDescription(`Execute a SELECT query and return results.
+
+All observations are tagged with broad categories. Check tags first to find what you're looking for:
+  SELECT name, description FROM tags
+
+Then filter observations by tag via observation_tags junction table. Build whatever query you need from there.`+liveGuide.tableList()),
+			mcp.WithString("sql",
+				mcp.Required(),
+				mcp.Description("SQL SELECT statement to execute"),
+			),
+			mcp.WithString("columns",
+				mcp.Description("Return only these comma-separated result columns, e.g. 'id,content'. Also the way to see hidden columns and blob contents"),
+			),
+			mcp.WithString("exclude_columns",
+				mcp.Description("Leave these comma-separated result columns out, e.g. 'created_at,metadata'"),
+			),
+			mcp.WithBoolean("keep_duplicates",
+				mcp.Description("Return every row. By default rows repeating an observation, as a join through observation_tags gives one per matching tag, are merged into one"),
+			),
+			mcp.WithReadOnlyHintAnnotation(true),
+		), Handler: queryHandler(db, snaps, scopes)}
+	})
+
+	guided.add(s, func() server.ServerTool {
+		return server.ServerTool{Tool: mcp.NewTool("execute",
+			mcp.WithDescription(`Execute INSERT, UPDATE, or DELETE statement. Use this for writing data.
+
+IMPORTANT: When inserting observations, you MUST provide the tags parameter.
+`+liveGuide.tagList()+`Query 'SELECT name, description, parent_id FROM tags' to see all tags, subcategories included.
+If you need a new tag, ask the user first before creating it.`),
+			mcp.WithString("sql",
+				mcp.Required(),
+				mcp.Description("SQL statement (INSERT, UPDATE, or DELETE)"),
+			),
+			mcp.WithString("tags",
+				mcp.Description("Required for observation inserts, and for entity inserts if the tag policy says so. On an UPDATE that rewrites observation content, replaces the changed rows' tags. "+liveGuide.tagsHelp()),
+			),
+			mcp.WithBoolean("confirm",
+				mcp.Description(fmt.Sprintf("Set true only when an UPDATE/DELETE is meant to change every row or many rows. Without it, statements lacking a WHERE clause or changing more than %d rows are rejected.", maxUnconfirmedRows)),
+			),
+		), Handler: executeHandler(db, tagger, scopes)}
+	})
+}
+
+func queryHandler(db *sql.DB, snaps *snapshots, scopes *visibilityScopes) server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		sqlStr := request.GetString("sql", "")
 		if strings.TrimSpace(sqlStr) == "" {
-			return mcp.NewToolResultError("sql parameter is required"), nil
+			return toolError(codeInvalidArgument, "sql parameter is required"), nil
 		}
 
 		if err := validateSQL(sqlStr, false); err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
+			return toolErrorFrom(err, codeInvalidArgument), nil
 		}
 
-		rows, err := db.QueryContext(ctx, sqlStr)
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("query error: %v", err)), nil
-		}
-		defer rows.Close()
+		proj := newProjection(request.GetString("columns", ""), request.GetString("exclude_columns", ""))
+		return readQuery(ctx, db, snaps, scopes, proj, request.GetBool("keep_duplicates", false), sqlStr), nil
+	}
+}
 
-		cols, err := rows.Columns()
+// readQuery runs a validated read for the query tool and saved queries,
+// limited to the observations the client's scope can see, and returns the
+// columns proj selects, with repeated rows for an observation merged unless
+// keepDuplicates is set.
+func readQuery(ctx context.Context, db *sql.DB, snaps *snapshots, scopes *visibilityScopes, proj projection, keepDuplicates bool, sqlStr string, args ...any) *mcp.CallToolResult {
+	q, err := snaps.reader(ctx, db)
+	if err != nil {
+		return toolErrorFrom(err, codeDatabase)
+	}
+	if levels := scopes.levels(ctx); restricted(levels) {
+		scoped, err := scopeStatement(ctx, q, sqlStr, levels, args...)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("columns error: %v", err)), nil
+			return toolErrorFrom(err, codeInvalidArgument)
 		}
+		sqlStr = scoped
+	}
 
-		var results []map[string]any
-		for rows.Next() {
-			values := make([]any, len(cols))
-			pointers := make([]any, len(cols))
-			for i := range values {
-				pointers[i] = &values[i]
-			}
+	cols, results, err := runQuery(ctx, q, sqlStr, args...)
+	if err != nil {
+		return toolErrorFrom(err, codeInvalidArgument)
+	}
+	noteRows(ctx, len(results))
+	if len(results) == 0 {
+		return mcp.NewToolResultText(formatRows(cols, results))
+	}
 
-			if err := rows.Scan(pointers...); err != nil {
-				return mcp.NewToolResultError(fmt.Sprintf("scan error: %v", err)), nil
-			}
+	cols, note, err := proj.apply(cols, results)
+	if err != nil {
+		return toolErrorFrom(err, codeInvalidArgument)
+	}
+	var merged int
+	if !keepDuplicates {
+		results, merged = mergeDuplicateRows(cols, results)
+	}
+	text := formatRows(cols, results)
+	if note != "" {
+		text += note + "\n"
+	}
+	if merged > 0 {
+		text += fmt.Sprintf("merged %d repeated row(s) for the same observation, e.g. one per matching tag, combining their differing values. Pass keep_duplicates to see every row.\n", merged)
+	}
+	return mcp.NewToolResultText(text)
+}
 
-			row := make(map[string]any)
-			for i, col := range cols {
-				row[col] = values[i]
-			}
-			results = append(results, row)
+// runQuery executes a read and returns its columns and rows keyed by column.
+func runQuery(ctx context.Context, q queryer, sqlStr string, args ...any) ([]string, []map[string]any, error) {
+	rows, err := q.QueryContext(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, fmt.Errorf("columns error: %v", err)
+	}
+
+	var results []map[string]any
+	for rows.Next() {
+		values := make([]any, len(cols))
+		pointers := make([]any, len(cols))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, fmt.Errorf("scan error: %v", err)
 		}
 
-		if len(results) == 0 {
-			return mcp.NewToolResultText("no results"), nil
+		row := make(map[string]any)
+		for i, col := range cols {
+			row[col] = values[i]
 		}
+		results = append(results, row)
+	}
+	return cols, results, nil
+}
+
+// formatRows renders query results the way every read tool returns them.
+func formatRows(cols []string, results []map[string]any) string {
+	if len(results) == 0 {
+		return "no results"
+	}
 
-		var sb strings.Builder
-		sb.WriteString(fmt.Sprintf("rows: %d\n\n", len(results)))
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("rows: %d\n\n", len(results)))
 
-		for i, row := range results {
-			sb.WriteString(fmt.Sprintf("--- row %d ---\n", i+1))
-			for _, col := range cols {
-				sb.WriteString(fmt.Sprintf("%s: %v\n", col, row[col]))
-			}
-			sb.WriteString("\n")
+	for i, row := range results {
+		sb.WriteString(fmt.Sprintf("--- row %d ---\n", i+1))
+		for _, col := range cols {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", col, formatValue(row[col])))
 		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
 
-		return mcp.NewToolResultText(sb.String()), nil
+// sqliteTimestamp matches CURRENT_TIMESTAMP values, which SQLite stores in UTC.
+var sqliteTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`)
+
+// formatValue renders a driver value for the model: NULL as null, text blobs
+// as text and binary ones as base64, and timestamps as RFC 3339.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return "base64:" + base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if sqliteTimestamp.MatchString(v) {
+			if t, err := time.Parse("2006-01-02 15:04:05", v); err == nil {
+				return t.Format(time.RFC3339)
+			}
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
 	}
 }
 
-func executeHandler(db *sql.DB) server.ToolHandlerFunc {
+// executeHandler runs write statements. smp, when set, lets the client's
+// model choose tags for observation inserts sent without them.
+func executeHandler(db *sql.DB, smp sampler, scopes *visibilityScopes) server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		sqlStr := request.GetString("sql", "")
 		if strings.TrimSpace(sqlStr) == "" {
-			return mcp.NewToolResultError("sql parameter is required"), nil
+			return toolError(codeInvalidArgument, "sql parameter is required"), nil
 		}
 
 		if err := validateSQL(sqlStr, true); err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		confirm := request.GetBool("confirm", false)
+		if err := checkWideWrite(sqlStr, confirm); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		// A client with a restricted scope writes through a connection that
+		// leaves observations outside it alone.
+		var target beginner = db
+		if levels := scopes.levels(ctx); restricted(levels) {
+			conn, scoped, err := openScopedConn(ctx, db, sqlStr, levels)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidSQL), nil
+			}
+			defer conn.Close()
+			target, sqlStr = conn, scoped
 		}
 
 		tagsStr := request.GetString("tags", "")
 		isObservationInsert := observationInsert.MatchString(sqlStr)
 
 		if isObservationInsert {
-			if strings.TrimSpace(tagsStr) == "" {
-				return mcp.NewToolResultError("tags parameter is required when inserting observations. Use broad categories like: homelab, career, drinks, personal. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+			var autoTagged bool
+			tagsStr, autoTagged = tagsOrAsk(ctx, db, smp, tagsStr, sqlStr)
+			if strings.TrimSpace(tagsStr) == "" && requiredTags.requires("observations") {
+				return toolError(codeTagRequired, "tags parameter is required when inserting observations. "+liveGuide.tagCategories()+"Query 'SELECT name, description FROM tags' to see all available tags."), nil
 			}
 
-			tagNames := parseTagNames(tagsStr)
-			tagIDs, err := validateTags(ctx, db, tagNames)
+			tagIDs, err := validateTagsFor(ctx, db, "observations", parseTagNames(tagsStr))
 			if err != nil {
-				return mcp.NewToolResultError(err.Error()), nil
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			// The statement's length stands in for the content's, which is
+			// somewhere inside it.
+			if err := checkTagQuotas(ctx, db, tagIDs, len(sqlStr)); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
 			}
 
-			result, err := db.ExecContext(ctx, sqlStr)
+			result, err := target.ExecContext(ctx, sqlStr)
 			if err != nil {
-				return mcp.NewToolResultError(formatExecError(err)), nil
+				return execError(err, codeInvalidSQL), nil
 			}
 
 			observationID, _ := result.LastInsertId()
 			if observationID > 0 {
-				if err := linkTags(ctx, db, observationID, tagIDs); err != nil {
-					return mcp.NewToolResultError(fmt.Sprintf("observation created but failed to link tags: %v", err)), nil
+				if err := linkTags(ctx, target, observationID, tagIDs); err != nil {
+					return toolErrorf(errorCode(err, codeDatabase), "observation created but failed to link tags: %v", err), nil
 				}
 			}
 
-			return mcp.NewToolResultText(fmt.Sprintf("success: observation %d created with tags: %s", observationID, tagsStr)), nil
+			return mcp.NewToolResultText(fmt.Sprintf("success: observation %d created with %s%s", observationID, tagList(tagsStr), autoTagNote(autoTagged))), nil
 		}
 
-		result, err := db.ExecContext(ctx, sqlStr)
-		if err != nil {
-			return mcp.NewToolResultError(formatExecError(err)), nil
+		if entityInsert.MatchString(sqlStr) && (strings.TrimSpace(tagsStr) != "" || requiredTags.requires("entities")) {
+			if strings.TrimSpace(tagsStr) == "" {
+				return toolError(codeTagRequired, "tags parameter is required when inserting entities. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+			}
+			tagIDs, err := validateTagsFor(ctx, db, "entities", parseTagNames(tagsStr))
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+
+			result, err := target.ExecContext(ctx, sqlStr)
+			if err != nil {
+				return execError(err, codeInvalidSQL), nil
+			}
+
+			entityID, _ := result.LastInsertId()
+			if entityID > 0 {
+				if err := linkEntityTags(ctx, target, entityID, tagIDs); err != nil {
+					return toolErrorf(errorCode(err, codeDatabase), "entity created but failed to link tags: %v", err), nil
+				}
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("success: entity %d created with tags: %s", entityID, tagsStr)), nil
+		}
+
+		if rewritesContent(sqlStr) {
+			var tagIDs []int64
+			if strings.TrimSpace(tagsStr) != "" {
+				var err error
+				if tagIDs, err = validateTagsFor(ctx, db, "observations", parseTagNames(tagsStr)); err != nil {
+					return toolErrorFrom(err, codeInvalidArgument), nil
+				}
+			}
+			ids, err := execContentUpdate(ctx, target, sqlStr, confirm, tagIDs)
+			var unconfirmed *unconfirmedError
+			if errors.As(err, &unconfirmed) {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			} else if err != nil {
+				return execError(err, codeInvalidSQL), nil
+			}
+			switch {
+			case len(ids) == 0:
+				return mcp.NewToolResultText("success: 0 row(s) affected"), nil
+			case tagIDs != nil:
+				return mcp.NewToolResultText(fmt.Sprintf("success: %d observation(s) updated and retagged with tags: %s", len(ids), tagsStr)), nil
+			}
+			listing, err := currentTags(ctx, db, ids)
+			if err != nil {
+				return mcp.NewToolResultText(fmt.Sprintf("success: %d observation(s) updated, but listing their tags failed: %v", len(ids), err)), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("success: %d observation(s) updated. Their content changed but their tags did not; check they still fit:\n%s\nIf they do not, run the UPDATE again with tags to replace them.", len(ids), listing)), nil
+		}
+
+		result, err := execConfirmed(ctx, target, sqlStr, confirm)
+		var unconfirmed *unconfirmedError
+		if errors.As(err, &unconfirmed) {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		} else if err != nil {
+			return execError(err, codeInvalidSQL), nil
 		}
 
 		affected, _ := result.RowsAffected()
 		lastID, _ := result.LastInsertId()
+		noteRows(ctx, int(affected))
 
 		if lastID > 0 {
 			return mcp.NewToolResultText(fmt.Sprintf("success: %d row(s) affected, last insert id: %d", affected, lastID)), nil
@@ -264,7 +958,7 @@ func validateTags(ctx context.Context, db *sql.DB, tagNames []string) ([]int64,
 		if err == sql.ErrNoRows {
 			missing = append(missing, name)
 		} else if err != nil {
-			return nil, fmt.Errorf("error checking tag '%s': %v", name, err)
+			return nil, errorf(codeDatabase, "error checking tag '%s': %v", name, err)
 		} else {
 			tagIDs = append(tagIDs, id)
 		}
@@ -273,7 +967,7 @@ func validateTags(ctx context.Context, db *sql.DB, tagNames []string) ([]int64,
 	if len(missing) > 0 {
 		rows, err := db.QueryContext(ctx, "SELECT name, description FROM tags ORDER BY name")
 		if err != nil {
-			return nil, fmt.Errorf("unknown tag(s): %s", strings.Join(missing, ", "))
+			return nil, errorf(codeUnknownTag, "unknown tag(s): %s", strings.Join(missing, ", "))
 		}
 		defer rows.Close()
 
@@ -284,14 +978,25 @@ func validateTags(ctx context.Context, db *sql.DB, tagNames []string) ([]int64,
 			available = append(available, fmt.Sprintf("%s (%s)", name, desc))
 		}
 
-		return nil, fmt.Errorf("unknown tag(s): %s\n\nAvailable tags:\n%s\n\nIf you need a new tag, ask the user first before creating it with: INSERT INTO tags (name, description) VALUES ('name', 'description')",
+		return nil, errorf(codeUnknownTag, "unknown tag(s): %s\n\nAvailable tags:\n%s\n\nIf you need a new tag, ask the user first before creating it with: INSERT INTO tags (name, description) VALUES ('name', 'description')",
 			strings.Join(missing, ", "), strings.Join(available, "\n"))
 	}
 
 	return tagIDs, nil
 }
 
-func linkTags(ctx context.Context, db *sql.DB, observationID int64, tagIDs []int64) error {
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// beginner runs statements and transactions: the database, or the
+// connection a scoped client's writes go through.
+type beginner interface {
+	execer
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+func linkTags(ctx context.Context, db execer, observationID int64, tagIDs []int64) error {
 	for _, tagID := range tagIDs {
 		_, err := db.ExecContext(ctx, "INSERT INTO observation_tags (observation_id, tag_id) VALUES (?, ?)", observationID, tagID)
 		if err != nil {
@@ -302,15 +1007,28 @@ func linkTags(ctx context.Context, db *sql.DB, observationID int64, tagIDs []int
 }
 
 func formatExecError(err error) string {
-	errMsg := err.Error()
-	if strings.Contains(errMsg, "UNIQUE constraint") {
+	switch constraintCode(err) {
+	case codeConstraintUnique:
+		if strings.Contains(err.Error(), "entities.name") {
+			return fmt.Sprintf("duplicate entry: %v. The entity already exists; use upsert_entity to get its id", err)
+		}
 		return fmt.Sprintf("duplicate entry: %v", err)
-	}
-	if strings.Contains(errMsg, "FOREIGN KEY constraint") {
+	case codeConstraintForeignKey:
 		return fmt.Sprintf("referenced entity does not exist: %v", err)
-	}
-	if strings.Contains(errMsg, "CHECK constraint") {
+	case codeConstraintCheck:
 		return fmt.Sprintf("validation failed (empty or invalid value): %v", err)
 	}
 	return fmt.Sprintf("execute error: %v", err)
 }
+
+// execFailure is formatExecError as an error that keeps the constraint's
+// code.
+func execFailure(err error) error {
+	return errorf(errorCode(err, codeDatabase), "%s", formatExecError(err))
+}
+
+// execError reports a failed write with its constraint's code, or fallback
+// when no constraint failed.
+func execError(err error, fallback string) *mcp.CallToolResult {
+	return toolError(errorCode(err, fallback), formatExecError(err))
+}
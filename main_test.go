@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
 )
 
@@ -52,6 +54,13 @@ func TestValidateSQL_ToolSeparation(t *testing.T) {
 		{"update in query blocked", "UPDATE entities SET name = 'foo' WHERE id = 1", false, true},
 		{"delete in execute allowed", "DELETE FROM entities WHERE id = 1", true, false},
 		{"delete in query blocked", "DELETE FROM entities WHERE id = 1", false, true},
+		{"replace in query blocked", "REPLACE INTO tags (name) VALUES ('x')", false, true},
+		{"with select in query allowed", "WITH x AS (SELECT 1) SELECT * FROM x", false, false},
+		{"with delete in query blocked", "WITH x AS (SELECT 1) DELETE FROM tags WHERE id IN x", false, true},
+		{"with insert in query blocked", "WITH RECURSIVE x(n) AS (SELECT 1) INSERT INTO tags (name) SELECT n FROM x", false, true},
+		{"with update in execute allowed", "WITH x AS (SELECT 1) UPDATE tags SET name = 'x' WHERE id IN x", true, false},
+		{"second statement blocked", "SELECT 1; DELETE FROM tags", false, true},
+		{"trailing semicolon allowed", "SELECT 1;", false, false},
 	}
 
 	for _, tt := range tests {
@@ -145,6 +154,32 @@ func TestParseTagNames(t *testing.T) {
 	}
 }
 
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		input any
+		want  string
+	}{
+		{"null", nil, "null"},
+		{"text blob", []byte("compose.yml"), "compose.yml"},
+		{"binary blob", []byte{0xff, 0x00, 0x01}, "base64:/wAB"},
+		{"timestamp", "2026-03-01 09:30:00", "2026-03-01T09:30:00Z"},
+		{"time", time.Date(2026, 3, 1, 12, 30, 0, 0, time.FixedZone("EAT", 3*3600)), "2026-03-01T09:30:00Z"},
+		{"plain text", "runs at 2026-03-01 09:30:00 daily", "runs at 2026-03-01 09:30:00 daily"},
+		{"integer", int64(42), "42"},
+		{"float", 1500000.0, "1500000"},
+		{"fraction", 0.85, "0.85"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatValue(tt.input); got != tt.want {
+				t.Errorf("formatValue(%v) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
 func setupTestDB(t *testing.T) *sql.DB {
 	t.Helper()
 	url := os.Getenv("LIBSQL_URL")
@@ -158,11 +193,26 @@ func setupTestDB(t *testing.T) *sql.DB {
 	if err := db.Ping(); err != nil {
 		t.Skipf("skipping integration test: %v", err)
 	}
+	if err := migrate(context.Background(), db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
 	return db
 }
 
+func mcpToolRequest(args map[string]any) mcp.CallToolRequest {
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = args
+	return req
+}
+
+func callTool(handler server.ToolHandlerFunc, name string, args map[string]any) (*mcp.CallToolResult, error) {
+	req := mcpToolRequest(args)
+	req.Params.Name = name
+	return handler(context.Background(), req)
+}
+
 func callQuery(db *sql.DB, sqlStr string) (*mcp.CallToolResult, error) {
-	handler := queryHandler(db)
+	handler := queryHandler(db, nil, nil)
 	req := mcp.CallToolRequest{}
 	req.Params.Name = "query"
 	req.Params.Arguments = map[string]any{"sql": sqlStr}
@@ -174,7 +224,7 @@ func callExecute(db *sql.DB, sqlStr string) (*mcp.CallToolResult, error) {
 }
 
 func callExecuteWithTags(db *sql.DB, sqlStr string, tags string) (*mcp.CallToolResult, error) {
-	handler := executeHandler(db)
+	handler := executeHandler(db, nil, nil)
 	req := mcp.CallToolRequest{}
 	req.Params.Name = "execute"
 	args := map[string]any{"sql": sqlStr}
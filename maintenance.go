@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maintenanceHours is the interval of the background maintenance loop; 0
+// disables it and leaves maintenance to the tool.
+var maintenanceHours = getEnvInt("ENGRAM_MAINTENANCE_HOURS", 0)
+
+// runMaintenance checks integrity, refreshes planner statistics, moves long
+// observation content into contents, optimizes full-text indexes and rebuilds
+// the file, returning a report with one line
+// per step. VACUUM is skipped when the integrity check fails so a damaged
+// database is not rewritten.
+func runMaintenance(ctx context.Context, db *sql.DB, vacuum bool) (string, error) {
+	var sb strings.Builder
+
+	before, err := databaseSize(ctx, db)
+	if err != nil {
+		return "", fmt.Errorf("size: %v", err)
+	}
+	fmt.Fprintf(&sb, "size before: %s\n", before)
+
+	problems, err := integrityCheck(ctx, db)
+	if err != nil {
+		return sb.String(), fmt.Errorf("integrity_check: %v", err)
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(&sb, "integrity_check: ok")
+	} else {
+		fmt.Fprintf(&sb, "integrity_check: %d problem(s)\n  %s\n", len(problems), strings.Join(problems, "\n  "))
+	}
+
+	if _, err := db.ExecContext(ctx, "ANALYZE"); err != nil {
+		return sb.String(), fmt.Errorf("analyze: %v", err)
+	}
+	fmt.Fprintln(&sb, "analyze: ok")
+
+	moved, dropped, err := dedupeContents(ctx, db)
+	if err != nil {
+		return sb.String(), fmt.Errorf("contents: %v", err)
+	}
+	fmt.Fprintf(&sb, "contents: moved %d long observation(s), dropped %d unused\n", moved, dropped)
+
+	tables, err := ftsTables(ctx, db)
+	if err != nil {
+		return sb.String(), fmt.Errorf("fts tables: %v", err)
+	}
+	for _, t := range tables {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s(%s) VALUES ('optimize')", quoteIdent(t), quoteIdent(t))); err != nil {
+			return sb.String(), fmt.Errorf("optimize %s: %v", t, err)
+		}
+		fmt.Fprintf(&sb, "fts optimize %s: ok\n", t)
+	}
+	if len(tables) == 0 {
+		fmt.Fprintln(&sb, "fts optimize: no full-text tables")
+	}
+
+	switch {
+	case !vacuum:
+		fmt.Fprintln(&sb, "vacuum: skipped")
+	case len(problems) > 0:
+		fmt.Fprintln(&sb, "vacuum: skipped, integrity check failed")
+	default:
+		if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+			return sb.String(), fmt.Errorf("vacuum: %v", err)
+		}
+		fmt.Fprintln(&sb, "vacuum: ok")
+	}
+
+	after, err := databaseSize(ctx, db)
+	if err != nil {
+		return sb.String(), fmt.Errorf("size: %v", err)
+	}
+	fmt.Fprintf(&sb, "size after: %s\n", after)
+	return sb.String(), nil
+}
+
+type dbSize struct {
+	pages, freePages, pageSize int64
+}
+
+func (s dbSize) String() string {
+	return fmt.Sprintf("%d bytes (%d pages, %d free)", s.pages*s.pageSize, s.pages, s.freePages)
+}
+
+func databaseSize(ctx context.Context, db *sql.DB) (dbSize, error) {
+	var s dbSize
+	for _, p := range []struct {
+		pragma string
+		dest   *int64
+	}{
+		{"page_count", &s.pages},
+		{"freelist_count", &s.freePages},
+		{"page_size", &s.pageSize},
+	} {
+		if err := db.QueryRowContext(ctx, "PRAGMA "+p.pragma).Scan(p.dest); err != nil {
+			return s, fmt.Errorf("%s: %v", p.pragma, err)
+		}
+	}
+	return s, nil
+}
+
+// integrityCheck returns the problems PRAGMA integrity_check reports, or none
+// when it answers "ok".
+func integrityCheck(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+func ftsTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND sql LIKE 'CREATE VIRTUAL TABLE%USING fts5%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// maintainPeriodically runs full maintenance on an interval until ctx is done.
+func maintainPeriodically(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := runMaintenance(ctx, db, true)
+			if err != nil {
+				log.Printf("maintenance failed: %v\n%s", err, report)
+				continue
+			}
+			log.Printf("maintenance complete\n%s", report)
+		}
+	}
+}
+
+// registerMaintenance adds the maintenance tool.
+func registerMaintenance(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("maintenance",
+		mcp.WithDescription(`Run database maintenance: PRAGMA integrity_check, ANALYZE, moving long observations into contents, full-text index optimize and VACUUM, and report the file size before and after.
+
+VACUUM rewrites the whole database and blocks writers while it runs; only call this when the user asks or the database has grown with free pages.`),
+		mcp.WithBoolean("vacuum",
+			mcp.Description("Rebuild the file to reclaim free pages (default true)"),
+		),
+	), maintenanceHandler(db))
+}
+
+func maintenanceHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		report, err := runMaintenance(ctx, db, request.GetBool("vacuum", true))
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "%smaintenance failed: %v", report, err), nil
+		}
+		return mcp.NewToolResultText(report), nil
+	}
+}
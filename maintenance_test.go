@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestMaintenance_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for _, vacuum := range []bool{false, true} {
+		result, err := callTool(maintenanceHandler(db), "maintenance", map[string]any{"vacuum": vacuum})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("maintenance failed: %v", result.Content)
+		}
+		text := result.Content[0].(mcp.TextContent).Text
+		for _, want := range []string{"integrity_check: ok", "analyze: ok", "size after:"} {
+			if !strings.Contains(text, want) {
+				t.Errorf("report missing %q:\n%s", want, text)
+			}
+		}
+		if vacuum != strings.Contains(text, "vacuum: ok") {
+			t.Errorf("vacuum=%v, report:\n%s", vacuum, text)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// markdownNote is a note read from a vault: the file name is the entity,
+// bullet points its observations and wiki-links relations to other notes.
+type markdownNote struct {
+	name, entityType string
+	tags             []string
+	observations     []string
+	links            []string
+}
+
+var (
+	// wikiLink matches [[Target]], [[Target|alias]] and [[Target#heading]],
+	// capturing the target and the alias.
+	wikiLink = regexp.MustCompile(`\[\[([^\]|#]*)(?:#[^\]|]*)?(?:\|([^\]]*))?\]\]`)
+	// bulletPrefix matches a list item marker and an optional task checkbox.
+	bulletPrefix = regexp.MustCompile(`^\s*[-*+]\s+(?:\[[ xX]\]\s+)?`)
+)
+
+// parseMarkdownNote reads one note. Frontmatter supplies tags (as a YAML
+// list, an inline [a, b] list or a comma-separated string) and the entity
+// type; every bullet, nested ones included, becomes an observation with its
+// wiki-links rendered as their text.
+func parseMarkdownNote(name, content, defaultType string) markdownNote {
+	note := markdownNote{name: name, entityType: defaultType}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		listKey := ""
+		for i := 1; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "---" {
+				lines = lines[i+1:]
+				break
+			}
+			if item, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok && listKey != "" {
+				if listKey == "tags" {
+					note.tags = append(note.tags, frontmatterValues(item)...)
+				}
+				continue
+			}
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+			listKey = ""
+			switch {
+			case value == "":
+				listKey = key
+			case key == "tags":
+				note.tags = append(note.tags, frontmatterValues(value)...)
+			case key == "type":
+				note.entityType = strings.Trim(value, `"'`)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		for _, m := range wikiLink.FindAllStringSubmatch(line, -1) {
+			target := strings.TrimSpace(m[1])
+			if i := strings.LastIndex(target, "/"); i >= 0 {
+				target = target[i+1:]
+			}
+			if target != "" && target != name && !seen[target] {
+				seen[target] = true
+				note.links = append(note.links, target)
+			}
+		}
+		loc := bulletPrefix.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		text := wikiLink.ReplaceAllStringFunc(line[loc[1]:], func(link string) string {
+			m := wikiLink.FindStringSubmatch(link)
+			if strings.TrimSpace(m[2]) != "" {
+				return strings.TrimSpace(m[2])
+			}
+			return strings.TrimSpace(m[1])
+		})
+		if text = strings.TrimSpace(text); text != "" {
+			note.observations = append(note.observations, text)
+		}
+	}
+	return note
+}
+
+// frontmatterValues splits a frontmatter value such as "[a, b]", "a, b" or
+// "'#a'" into tag names.
+func frontmatterValues(value string) []string {
+	value = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "["), "]")
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimPrefix(strings.Trim(strings.TrimSpace(v), `"'`), "#")
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// readVault parses every .md file under dir, skipping hidden directories
+// such as .obsidian and .trash.
+func readVault(dir, defaultType string) ([]markdownNote, error) {
+	var notes []markdownNote
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))
+		notes = append(notes, parseMarkdownNote(name, string(content), defaultType))
+		return nil
+	})
+	return notes, err
+}
+
+// markdownImport turns notes into entities and relations for importMemory.
+// Frontmatter tags that exist (or, with createTags, are created) tag the
+// note's entity and observations along with extraTags; the rest are
+// returned as unknown. Links resolve to notes in the vault, ignoring case
+// as Obsidian does, or to existing entities; others are returned as
+// unresolved.
+func markdownImport(ctx context.Context, db *sql.DB, notes []markdownNote, relationType string, extraTags []string, createTags bool) (entities []importEntity, relations []graphRelation, unknownTags, unresolved []string, err error) {
+	tagIDs := make(map[string]int64)
+	unknown := make(map[string]bool)
+	lookup := func(name string) (int64, bool, error) {
+		if id, ok := tagIDs[name]; ok {
+			return id, true, nil
+		}
+		if unknown[name] {
+			return 0, false, nil
+		}
+		var id int64
+		err := db.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ?", name).Scan(&id)
+		if err == sql.ErrNoRows && createTags {
+			result, err := db.ExecContext(ctx, "INSERT INTO tags (name, description) VALUES (?, 'imported from markdown')", name)
+			if err != nil {
+				return 0, false, fmt.Errorf("creating tag '%s': %w", name, execFailure(err))
+			}
+			id, _ = result.LastInsertId()
+		} else if err == sql.ErrNoRows {
+			unknown[name] = true
+			return 0, false, nil
+		} else if err != nil {
+			return 0, false, fmt.Errorf("error checking tag '%s': %v", name, err)
+		}
+		tagIDs[name] = id
+		return id, true, nil
+	}
+
+	vault := make(map[string]string)
+	for _, n := range notes {
+		vault[strings.ToLower(n.name)] = n.name
+	}
+
+	for _, n := range notes {
+		names := append(append([]string{}, extraTags...), n.tags...)
+		var ids []int64
+		var known []string
+		for _, name := range names {
+			id, ok, err := lookup(name)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if ok && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+				known = append(known, name)
+			}
+		}
+		for _, table := range []string{"observations", "entities"} {
+			if table == "observations" && len(n.observations) == 0 {
+				continue
+			}
+			if len(ids) == 0 && requiredTags.requires(table) {
+				return nil, nil, nil, nil, fmt.Errorf("note '%s' has no known tags and the tag policy needs tags on new %s; pass -tags", n.name, table)
+			}
+			if err := requiredTags.check(table, known); len(ids) > 0 && err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("note '%s': %v", n.name, err)
+			}
+		}
+		observations := n.observations
+		if observations == nil {
+			observations = []string{}
+		}
+		entities = append(entities, importEntity{graphEntity: graphEntity{Name: n.name, EntityType: n.entityType, Observations: observations}, observationTags: ids, entityTags: ids})
+
+		for _, target := range n.links {
+			if name, ok := vault[strings.ToLower(target)]; ok {
+				relations = append(relations, graphRelation{From: n.name, To: name, RelationType: relationType})
+				continue
+			}
+			var exists int
+			if err := db.QueryRowContext(ctx, "SELECT count(*) FROM entities WHERE name = ?", target).Scan(&exists); err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("error looking up entity '%s': %v", target, err)
+			}
+			if exists > 0 {
+				relations = append(relations, graphRelation{From: n.name, To: target, RelationType: relationType})
+			} else {
+				unresolved = append(unresolved, n.name+" -> "+target)
+			}
+		}
+	}
+
+	for name := range unknown {
+		unknownTags = append(unknownTags, name)
+	}
+	sort.Strings(unknownTags)
+	return entities, relations, unknownTags, unresolved, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMarkdownNote(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    markdownNote
+	}{
+		{
+			name: "frontmatter list and bullets",
+			content: `---
+type: Device
+tags:
+  - homelab
+  - "#personal"
+aliases: [nas]
+---
+# NAS
+
+Bought in 2021.
+
+- Runs TrueNAS on [[Proxmox Host|the proxmox box]]
+  * 4x8TB in RAID-Z1
+- [x] Replaced a disk, see [[Disks#WD Red]]
+- [[Projects/Backups]]
+`,
+			want: markdownNote{
+				name: "nas", entityType: "Device", tags: []string{"homelab", "personal"},
+				observations: []string{"Runs TrueNAS on the proxmox box", "4x8TB in RAID-Z1", "Replaced a disk, see Disks", "Projects/Backups"},
+				links:        []string{"Proxmox Host", "Disks", "Backups"},
+			},
+		},
+		{
+			name:    "inline tags and no bullets",
+			content: "---\ntags: [career, drinks]\n---\nJust prose linking [[Acme]] and [[nas]] itself.\n",
+			want:    markdownNote{name: "nas", entityType: "Note", tags: []string{"career", "drinks"}, links: []string{"Acme"}},
+		},
+		{
+			name:    "no frontmatter",
+			content: "- Likes espresso\n-not a bullet\n- \n",
+			want:    markdownNote{name: "nas", entityType: "Note", observations: []string{"Likes espresso"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMarkdownNote("nas", tt.content, "Note"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMarkdownNote() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportMarkdown_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'md-test-%'")
+	defer db.Exec("DELETE FROM entity_tags WHERE entity_id IN (SELECT id FROM entities WHERE name LIKE 'md-test-%')")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'md test %'")
+	defer db.Exec("DELETE FROM relations WHERE relation_type = 'md_test_links_to'")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT id FROM observations WHERE content LIKE 'md test %')")
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"md-test-ann.md":              "---\ntags: [personal, md-test-unknown]\n---\n- md test likes espresso\n- md test works at [[MD-Test-Acme]] and knows [[md-test-nobody]]\n",
+		"work/md-test-acme.md":        "---\ntype: Company\n---\n- md test makes anvils\n",
+		".obsidian/md-test-config.md": "- md test should be skipped\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notes, err := readVault(dir, "Note")
+	if err != nil || len(notes) != 2 {
+		t.Fatalf("readVault = %+v, %v; want the two notes outside .obsidian", notes, err)
+	}
+	entities, relations, unknownTags, unresolved, err := markdownImport(context.Background(), db, notes, "md_test_links_to", []string{"homelab"}, false)
+	if err != nil {
+		t.Fatalf("markdownImport: %v", err)
+	}
+	if !reflect.DeepEqual(unknownTags, []string{"md-test-unknown"}) || !reflect.DeepEqual(unresolved, []string{"md-test-ann -> md-test-nobody"}) {
+		t.Errorf("unknown tags %v, unresolved %v", unknownTags, unresolved)
+	}
+	if len(relations) != 1 || relations[0].To != "md-test-acme" {
+		t.Errorf("expected the link to resolve to md-test-acme ignoring case, got %+v", relations)
+	}
+
+	counts, err := importMemory(context.Background(), db, entities, relations)
+	if err != nil {
+		t.Fatalf("importMemory: %v", err)
+	}
+	if want := (importCounts{entities: 2, observations: 3, relations: 1}); counts != want {
+		t.Errorf("import = %v, want %v", counts, want)
+	}
+	var tags string
+	db.QueryRow(`SELECT group_concat(t.name) FROM (SELECT t.name FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id
+		JOIN observations o ON o.id = ot.observation_id WHERE o.content = 'md test likes espresso' ORDER BY t.name) t`).Scan(&tags)
+	if tags != "homelab,personal" {
+		t.Errorf("observation tags = %q, want homelab,personal", tags)
+	}
+	var entityType string
+	db.QueryRow("SELECT entity_type FROM entities WHERE name = 'md-test-acme'").Scan(&entityType)
+	if entityType != "Company" {
+		t.Errorf("entity type = %q, want the frontmatter type", entityType)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// mcpAddr is ENGRAM_MCP_ADDR: when set, serve answers MCP over Streamable
+// HTTP on this address, at mcpPath, instead of on stdio, so several agents
+// can share one server. mcpKeys is ENGRAM_MCP_KEYS, e.g.
+// "claude-ai=k1;team-bot=k2": clients then need one of the keys as a bearer
+// token, and the key's name, not the name a client reports for itself, is
+// its identity for ENGRAM_CLIENT_TOOLS, ENGRAM_CLIENT_VISIBILITY and
+// ENGRAM_CLIENT_TAGS.
+var (
+	mcpAddr = getEnv("ENGRAM_MCP_ADDR", "")
+	mcpKeys = getEnv("ENGRAM_MCP_KEYS", "")
+)
+
+const mcpPath = "/mcp"
+
+// parseMCPKeys maps each key in ENGRAM_MCP_KEYS to the client it names.
+func parseMCPKeys(s string) (map[string]string, error) {
+	entries, err := parseClientEntries(s, "key")
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for name, key := range entries {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("client %s: key must not be empty", name)
+		}
+		if other, ok := keys[key]; ok {
+			return nil, fmt.Errorf("clients %s and %s have the same key", other, name)
+		}
+		keys[key] = name
+	}
+	return keys, nil
+}
+
+// mcpHTTP is the MCP endpoint. It checks the bearer key, names the caller
+// after it, answers resource subscriptions, which mcp-go does not, and hands
+// everything else to mcp-go's Streamable HTTP server. Sessions belong to the
+// key that started them: requests carrying another key's session id are
+// refused, so one client cannot read another's notifications or end its
+// session.
+type mcpHTTP struct {
+	server *server.StreamableHTTPServer
+	subs   *subscriptions
+	keys   map[string]string // empty lets every request in, unnamed
+
+	mu     sync.Mutex
+	owners map[string]string // session id to the client it was issued to
+	ended  map[string]bool
+}
+
+func newMCPHTTP(s *server.MCPServer, keys map[string]string, subs *subscriptions) *mcpHTTP {
+	h := &mcpHTTP{subs: subs, keys: keys, owners: make(map[string]string), ended: make(map[string]bool)}
+	h.server = server.NewStreamableHTTPServer(s, server.WithEndpointPath(mcpPath), server.WithSessionIdManagerResolver(h))
+	return h
+}
+
+// authenticate returns the name of the client whose key the request
+// carries. Every key is compared, so the time taken does not tell which
+// one came close.
+func (h *mcpHTTP) authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	name, found := "", false
+	for key, client := range h.keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			name, found = client, true
+		}
+	}
+	return name, found
+}
+
+func (h *mcpHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(h.keys) > 0 {
+		name, ok := h.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or wrong bearer token, see ENGRAM_MCP_KEYS", http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(withClientName(r.Context(), name))
+	}
+
+	sessionID := r.Header.Get(server.HeaderKeySessionID)
+	ids := h.ResolveSessionIdManager(r)
+	switch {
+	case sessionID == "":
+	case r.Method == http.MethodGet:
+		// mcp-go opens a stream for any session id it is given.
+		if ended, err := ids.Validate(sessionID); err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		} else if ended {
+			http.Error(w, "Session terminated", http.StatusNotFound)
+			return
+		}
+	case r.Method == http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if ended, err := ids.Validate(sessionID); err == nil && !ended {
+			if response, ok := h.subs.handle(sessionID, body); ok {
+				writeJSON(w, http.StatusOK, response)
+				return
+			}
+		}
+	}
+	h.server.ServeHTTP(w, r)
+}
+
+// ResolveSessionIdManager returns the session ids of the calling client.
+func (h *mcpHTTP) ResolveSessionIdManager(r *http.Request) server.SessionIdManager {
+	client, _ := clientName(r.Context())
+	return mcpSessionIDs{h: h, client: client}
+}
+
+// mcpSessionIDs issues session ids to one client and accepts only those.
+type mcpSessionIDs struct {
+	h      *mcpHTTP
+	client string
+}
+
+func (m mcpSessionIDs) Generate() string {
+	id := "mcp-session-" + rand.Text()
+	m.h.mu.Lock()
+	defer m.h.mu.Unlock()
+	m.h.owners[id] = m.client
+	return id
+}
+
+func (m mcpSessionIDs) Validate(sessionID string) (bool, error) {
+	m.h.mu.Lock()
+	defer m.h.mu.Unlock()
+	if owner, ok := m.h.owners[sessionID]; ok && owner == m.client {
+		return false, nil
+	}
+	if m.h.ended[sessionID] {
+		return true, nil
+	}
+	return false, fmt.Errorf("session not found: %s", sessionID)
+}
+
+func (m mcpSessionIDs) Terminate(sessionID string) (bool, error) {
+	m.h.mu.Lock()
+	owner, ok := m.h.owners[sessionID]
+	if ok && owner != m.client {
+		m.h.mu.Unlock()
+		return false, fmt.Errorf("session not found: %s", sessionID)
+	}
+	delete(m.h.owners, sessionID)
+	m.h.ended[sessionID] = true
+	m.h.mu.Unlock()
+	m.h.subs.drop(sessionID)
+	return false, nil
+}
+
+// serveHTTP serves s over Streamable HTTP on mcpAddr until ctx ends or the
+// process is signalled, answering resource subscriptions and notifying
+// each session of new rows in db it subscribed to.
+func serveHTTP(ctx context.Context, s *server.MCPServer, db *sql.DB, subs *subscriptions) error {
+	keys, err := parseMCPKeys(mcpKeys)
+	if err != nil {
+		return fmt.Errorf("invalid ENGRAM_MCP_KEYS: %v", err)
+	}
+	ln, err := net.Listen("tcp", mcpAddr)
+	if err != nil {
+		return fmt.Errorf("invalid ENGRAM_MCP_ADDR: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	go subs.watchChanges(ctx, db, changePollInterval, notifier(s))
+	go subs.watchDue(ctx, db, changePollInterval, notifier(s))
+
+	mux := http.NewServeMux()
+	mux.Handle(mcpPath, newMCPHTTP(s, keys, subs))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	log.Printf("MCP listening on http://%s%s", ln.Addr(), mcpPath)
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
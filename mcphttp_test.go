@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestParseMCPKeys(t *testing.T) {
+	keys, err := parseMCPKeys("claude-ai=k1; team-bot = k2 ")
+	if err != nil || keys["k1"] != "claude-ai" || keys["k2"] != "team-bot" {
+		t.Errorf("keys = %v, %v", keys, err)
+	}
+	for _, bad := range []string{"bot=", "a=k;b=k", "k1"} {
+		if _, err := parseMCPKeys(bad); err == nil {
+			t.Errorf("parseMCPKeys(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestMCPHTTP(t *testing.T) {
+	access, err := parseToolAccess("", "", "team-bot=search_nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.NewMCPServer("test", "1.0.0", server.WithToolFilter(access.filter), server.WithToolHandlerMiddleware(access.middleware))
+	for _, name := range []string{"search_nodes", "query"} {
+		s.AddTool(mcp.NewTool(name), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("ok"), nil
+		})
+	}
+	subs := newSubscriptions()
+	mux := http.NewServeMux()
+	mux.Handle(mcpPath, newMCPHTTP(s, map[string]string{"k1": "team-bot", "k2": "admin"}, subs))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+
+	connect := func(key string) (*client.Client, string) {
+		t.Helper()
+		c, err := client.NewStreamableHttpClient(srv.URL+mcpPath, transport.WithHTTPHeaders(map[string]string{"Authorization": "Bearer " + key}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		if err := c.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		init := mcp.InitializeRequest{}
+		init.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+		// The reported name does not matter, the key does.
+		init.Params.ClientInfo = mcp.Implementation{Name: "admin"}
+		if _, err := c.Initialize(ctx, init); err != nil {
+			t.Fatalf("initialize with %s: %v", key, err)
+		}
+		return c, c.GetTransport().(*transport.StreamableHTTP).GetSessionId()
+	}
+	toolNames := func(c *client.Client) string {
+		t.Helper()
+		list, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, tool := range list.Tools {
+			names = append(names, tool.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	bot, botSession := connect("k1")
+	if got := toolNames(bot); got != "search_nodes" {
+		t.Errorf("team-bot tools = %s", got)
+	}
+	call := mcp.CallToolRequest{}
+	call.Params.Name = "query"
+	if result, err := bot.CallTool(ctx, call); err != nil || !result.IsError {
+		t.Errorf("team-bot called query: %v %v", result, err)
+	}
+	admin, _ := connect("k2")
+	if got := toolNames(admin); got != "query,search_nodes" {
+		t.Errorf("admin tools = %s", got)
+	}
+
+	post := func(key, session, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+mcpPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		req.Header.Set(server.HeaderKeySessionID, session)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	subscribe := `{"jsonrpc":"2.0","id":9,"method":"resources/subscribe","params":{"uri":"memory://recent"}}`
+	if code := post("", botSession, subscribe); code != http.StatusUnauthorized {
+		t.Errorf("no key: %d", code)
+	}
+	if code := post("wrong", botSession, subscribe); code != http.StatusUnauthorized {
+		t.Errorf("wrong key: %d", code)
+	}
+	if code := post("k2", botSession, subscribe); code != http.StatusBadRequest || len(subs.subscribers(recentURI)) != 0 {
+		t.Errorf("another key's session: %d, %v", code, subs.sessions)
+	}
+	if code := post("k1", botSession, subscribe); code != http.StatusOK {
+		t.Errorf("subscribe: %d", code)
+	}
+	if ids := subs.subscribers(recentURI); len(ids) != 1 || ids[0] != botSession {
+		t.Errorf("subscribers = %v", ids)
+	}
+}
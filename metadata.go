@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultMetadataLimit = 50
+	maxMetadataLimit     = 500
+)
+
+// metadataPath matches the field paths search_metadata accepts: names joined
+// by dots, with optional array indexes, e.g. "host", "ports[0]", "disk.size".
+var metadataPath = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\[[0-9]+\])*(\.[A-Za-z_][A-Za-z0-9_]*(\[[0-9]+\])*)*$`)
+
+// parseMetadata validates an observation's metadata argument, a JSON object
+// given as an object or a string, and returns it as compact JSON text, or nil
+// when absent.
+func parseMetadata(v any) (any, error) {
+	switch m := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.TrimSpace(m) == "" {
+			return nil, nil
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(m), &obj); err != nil {
+			return nil, fmt.Errorf("metadata must be a JSON object, e.g. {\"host\": \"nas\", \"port\": 8080}")
+		}
+		v = obj
+	case map[string]any:
+	default:
+		return nil, fmt.Errorf("metadata must be a JSON object, e.g. {\"host\": \"nas\", \"port\": 8080}")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "{}" {
+		return nil, nil
+	}
+	return string(data), nil
+}
+
+// metadataFilter turns field/value pairs into conditions on o.metadata.
+// Fields are compared with json_extract, so numbers match numbers and strings
+// match strings; null matches a missing field.
+func metadataFilter(filters map[string]any) (string, []any, error) {
+	fields := make([]string, 0, len(filters))
+	for f := range filters {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	var conds []string
+	var args []any
+	for _, f := range fields {
+		if !metadataPath.MatchString(f) {
+			return "", nil, fmt.Errorf("invalid metadata field %q, want a name like 'host' or 'disk.size'", f)
+		}
+		expr := fmt.Sprintf("json_extract(o.metadata, '$.%s')", f)
+		switch v := filters[f].(type) {
+		case nil:
+			conds = append(conds, expr+" IS NULL")
+		case bool:
+			conds = append(conds, expr+" = ?")
+			if v {
+				args = append(args, 1)
+			} else {
+				args = append(args, 0)
+			}
+		case string, float64:
+			conds = append(conds, expr+" = ?")
+			args = append(args, v)
+		default:
+			return "", nil, fmt.Errorf("metadata field %q: filter values must be strings, numbers, booleans or null", f)
+		}
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// registerSearchMetadata adds the search_metadata tool.
+func registerSearchMetadata(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("search_metadata",
+		mcp.WithDescription(`Find observations by their metadata fields.
+
+Every field in filters must match: strings and numbers by value, booleans as true/false, null for a missing field. Nested fields use dots, e.g. {"disk.size_tb": 4}.`),
+		mcp.WithObject("filters",
+			mcp.Required(),
+			mcp.Description(`Field values to match, e.g. {"host": "nas", "port": 8080}`),
+		),
+		mcp.WithString("entity",
+			mcp.Description("Only observations on this entity"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum rows to return (default %d, max %d)", defaultMetadataLimit, maxMetadataLimit)),
+		),
+		mcp.WithBoolean("include_archived",
+			mcp.Description("Also search observations on entities hidden by archive_entity (default false)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), searchMetadataHandler(db, scopes))
+}
+
+func searchMetadataHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		filters, ok := request.GetArguments()["filters"].(map[string]any)
+		if !ok || len(filters) == 0 {
+			return toolError(codeInvalidArgument, "filters parameter is required, e.g. {\"host\": \"nas\"}"), nil
+		}
+		limit := request.GetInt("limit", defaultMetadataLimit)
+		if limit < 1 || limit > maxMetadataLimit {
+			return toolErrorf(codeInvalidArgument, "limit must be between 1 and %d", maxMetadataLimit), nil
+		}
+
+		where, args, err := metadataFilter(filters)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if entity := strings.TrimSpace(request.GetString("entity", "")); entity != "" {
+			where += " AND e.name = ?"
+			args = append(args, entity)
+		}
+		if !request.GetBool("include_archived", false) {
+			where += " AND e.archived_at IS NULL"
+		}
+		args = append(args, limit)
+
+		sqlStr := restrictVisibility(`SELECT o.id, e.name AS entity, o.content, o.metadata
+			FROM observations o JOIN entities e ON e.id = o.entity_id
+			WHERE o.metadata IS NOT NULL AND `+where+` ORDER BY o.id LIMIT ?`, scopes.levels(ctx))
+		cols, results, err := runQuery(ctx, db, sqlStr, args...)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "search failed: %v", err), nil
+		}
+		return mcp.NewToolResultText(formatRows(cols, results)), nil
+	}
+}
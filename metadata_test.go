@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   any
+		want    any
+		wantErr bool
+	}{
+		{"absent", nil, nil, false},
+		{"object", map[string]any{"port": float64(8080), "host": "nas"}, `{"host":"nas","port":8080}`, false},
+		{"string", `{ "host": "nas" }`, `{"host":"nas"}`, false},
+		{"empty object", map[string]any{}, nil, false},
+		{"blank string", "  ", nil, false},
+		{"array", `[1, 2]`, nil, true},
+		{"not json", "host=nas", nil, true},
+		{"number", float64(1), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMetadata(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filters  map[string]any
+		want     string
+		wantArgs int
+		wantErr  bool
+	}{
+		{"values", map[string]any{"port": float64(8080), "host": "nas"},
+			"json_extract(o.metadata, '$.host') = ? AND json_extract(o.metadata, '$.port') = ?", 2, false},
+		{"nested and null", map[string]any{"disk.size": nil, "ports[0]": true},
+			"json_extract(o.metadata, '$.disk.size') IS NULL AND json_extract(o.metadata, '$.ports[0]') = ?", 1, false},
+		{"injection", map[string]any{"host') OR 1=1 --": "x"}, "", 0, true},
+		{"object value", map[string]any{"disk": map[string]any{"size": 4}}, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args, err := metadataFilter(tt.filters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("metadataFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || len(args) != tt.wantArgs {
+				t.Errorf("metadataFilter() = %q %v, want %q with %d args", got, args, tt.want, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMetadata_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'metadata-test-nas'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'metadata test %'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('metadata-test-nas', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	for _, args := range []map[string]any{
+		{"content": "metadata test jellyfin", "metadata": map[string]any{"service": "jellyfin", "port": float64(8096), "public": false}},
+		{"content": "metadata test grafana", "metadata": `{"service": "grafana", "port": 3000}`},
+	} {
+		args["entity"], args["tags"] = "metadata-test-nas", "homelab"
+		result, err := callTool(addObservationHandler(db, nil), "add_observation", args)
+		if err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+	}
+	if result, _ := callTool(addObservationHandler(db, nil), "add_observation", map[string]any{
+		"entity": "metadata-test-nas", "content": "metadata test bad", "tags": "homelab", "metadata": "port=1",
+	}); !result.IsError {
+		t.Error("expected invalid metadata to be rejected")
+	}
+
+	tests := []struct {
+		name    string
+		filters map[string]any
+		want    []string
+		wantErr bool
+	}{
+		{"number", map[string]any{"port": float64(3000)}, []string{"grafana"}, false},
+		{"string and bool", map[string]any{"service": "jellyfin", "public": false}, []string{"jellyfin"}, false},
+		{"no match", map[string]any{"port": "3000"}, nil, false},
+		{"missing filters", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]any{"entity": "metadata-test-nas"}
+			if tt.filters != nil {
+				args["filters"] = tt.filters
+			}
+			result, err := callTool(searchMetadataHandler(db, nil), "search_metadata", args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v, want %v: %v", result.IsError, tt.wantErr, result.Content)
+			}
+			text := result.Content[0].(mcp.TextContent).Text
+			for _, w := range tt.want {
+				if !strings.Contains(text, w) {
+					t.Errorf("expected %q in %s", w, text)
+				}
+			}
+			if !tt.wantErr && tt.want == nil && text != "no results" {
+				t.Errorf("expected no results, got %s", text)
+			}
+		})
+	}
+
+	t.Run("open_nodes shows metadata", func(t *testing.T) {
+		result, _ := callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": []any{"metadata-test-nas"}})
+		var opened openedNodes
+		decodeResult(t, result, &opened)
+		var got bytes.Buffer
+		if err := json.Compact(&got, opened.Entities[0].Details[1].Metadata); err != nil || got.String() != `{"port":3000,"service":"grafana"}` {
+			t.Errorf("metadata = %s, %v", got.String(), err)
+		}
+	})
+}
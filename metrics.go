@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// resultWarnBytes is the size above which a tool result gets a context budget
+// warning appended; 0 disables warnings.
+var resultWarnBytes = getEnvInt("ENGRAM_RESULT_WARN_BYTES", 32*1024)
+
+// resultMetrics tracks how many bytes each tool returns, so oversized
+// responses can be traced back to the tool and arguments producing them. It
+// also accounts request and response bytes per tag named in a call's tags
+// argument, so one namespace's traffic can be told apart from another's.
+type resultMetrics struct {
+	mu    sync.Mutex
+	tools map[string]*toolMetrics
+	tags  map[string]*tagMetrics
+}
+
+type toolMetrics struct {
+	calls, warnings int
+	total, max      int
+}
+
+type tagMetrics struct {
+	calls             int
+	request, response int64
+}
+
+func newResultMetrics() *resultMetrics {
+	return &resultMetrics{tools: make(map[string]*toolMetrics), tags: make(map[string]*tagMetrics)}
+}
+
+func (m *resultMetrics) record(tool string, size int, warned bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.tools[tool]
+	if t == nil {
+		t = &toolMetrics{}
+		m.tools[tool] = t
+	}
+	t.calls++
+	t.total += size
+	if size > t.max {
+		t.max = size
+	}
+	if warned {
+		t.warnings++
+	}
+}
+
+func (m *resultMetrics) recordTags(tags []string, request, response int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		t := m.tags[tag]
+		if t == nil {
+			t = &tagMetrics{}
+			m.tags[tag] = t
+		}
+		t.calls++
+		t.request += int64(request)
+		t.response += int64(response)
+	}
+}
+
+// tagTraffic returns a copy of the per-tag request and response totals.
+func (m *resultMetrics) tagTraffic() map[string]tagMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	traffic := make(map[string]tagMetrics, len(m.tags))
+	for tag, t := range m.tags {
+		traffic[tag] = *t
+	}
+	return traffic
+}
+
+// requestSize counts the bytes of a call's arguments as JSON.
+func requestSize(request mcp.CallToolRequest) int {
+	b, err := json.Marshal(request.GetArguments())
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// resultSize counts the text returned to the client, which is what lands in
+// the model's context.
+func resultSize(result *mcp.CallToolResult) int {
+	size := 0
+	for _, c := range result.Content {
+		if text, ok := c.(mcp.TextContent); ok {
+			size += len(text.Text)
+		}
+	}
+	return size
+}
+
+func budgetWarning(tool string, size int) string {
+	hint := "narrow the query with WHERE, select fewer columns, or add a LIMIT"
+	switch tool {
+	case "read_graph":
+		hint = "lower limit, or filter by entity_type or tags"
+	case "search_nodes", "open_nodes":
+		hint = "search for something more specific, or open fewer nodes"
+	}
+	return fmt.Sprintf("warning: this result is %d bytes, over the %d byte budget. To save context, %s.", size, resultWarnBytes, hint)
+}
+
+func (m *resultMetrics) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if err != nil || result == nil {
+			return result, err
+		}
+
+		tool := request.Params.Name
+		size := resultSize(result)
+		warned := resultWarnBytes > 0 && size > resultWarnBytes
+		m.record(tool, size, warned)
+		if tags := parseTagNames(request.GetString("tags", "")); len(tags) > 0 {
+			m.recordTags(tags, requestSize(request), size)
+		}
+		if warned {
+			log.Printf("tool %s returned %d bytes (budget %d), sql: %.200s", tool, size, resultWarnBytes, normalizeSQL(request.GetString("sql", "")))
+			result.Content = append(result.Content, mcp.NewTextContent(budgetWarning(tool, size)))
+		}
+		return result, nil
+	}
+}
+
+// report lists per-tool result sizes, largest total first.
+func (m *resultMetrics) report() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.tools) == 0 {
+		return "no tool calls yet"
+	}
+
+	names := make([]string, 0, len(m.tools))
+	for name := range m.tools {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return m.tools[names[i]].total > m.tools[names[j]].total
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-22s %6s %10s %8s %8s %8s\n", "tool", "calls", "bytes", "avg", "max", "warned")
+	for _, name := range names {
+		t := m.tools[name]
+		fmt.Fprintf(&sb, "%-22s %6d %10d %8d %8d %8d\n", name, t.calls, t.total, t.total/t.calls, t.max, t.warnings)
+	}
+	return sb.String()
+}
+
+// registerMetrics adds the memory://metrics resource.
+func registerMetrics(s *server.MCPServer, metrics *resultMetrics) {
+	s.AddResource(mcp.NewResource(
+		"memory://metrics",
+		"Tool result sizes",
+		mcp.WithResourceDescription("Calls, bytes returned and context budget warnings per tool since the server started"),
+		mcp.WithMIMEType("text/plain"),
+	), metrics.resourceHandler())
+}
+
+func (m *resultMetrics) resourceHandler() server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      "memory://metrics",
+				MIMEType: "text/plain",
+				Text:     m.report(),
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestResultMetricsMiddleware(t *testing.T) {
+	defer func(v int) { resultWarnBytes = v }(resultWarnBytes)
+	resultWarnBytes = 100
+
+	m := newResultMetrics()
+	handler := m.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(strings.Repeat("x", request.GetInt("size", 0))), nil
+	})
+
+	call := func(tool string, size int) *mcp.CallToolResult {
+		req := mcpToolRequest(map[string]any{"size": float64(size)})
+		req.Params.Name = tool
+		result, err := handler(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+
+	if result := call("query", 50); len(result.Content) != 1 {
+		t.Errorf("small result got a warning: %v", result.Content)
+	}
+	result := call("read_graph", 500)
+	if len(result.Content) != 2 {
+		t.Fatalf("expected a budget warning, got %v", result.Content)
+	}
+	if warning := result.Content[1].(mcp.TextContent).Text; !strings.Contains(warning, "500 bytes") || !strings.Contains(warning, "entity_type") {
+		t.Errorf("unexpected warning %q", warning)
+	}
+	call("query", 70)
+
+	q := m.tools["query"]
+	if q.calls != 2 || q.total != 120 || q.max != 70 || q.warnings != 0 {
+		t.Errorf("query metrics = %+v", q)
+	}
+	if g := m.tools["read_graph"]; g.warnings != 1 {
+		t.Errorf("read_graph metrics = %+v", g)
+	}
+
+	report := m.report()
+	if strings.Index(report, "read_graph") > strings.Index(report, "query") {
+		t.Errorf("expected largest total first:\n%s", report)
+	}
+}
+
+func TestResultMetricsTags(t *testing.T) {
+	m := newResultMetrics()
+	handler := m.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("0123456789"), nil
+	})
+	for _, args := range []map[string]any{{"tags": "homelab, Career"}, {"tags": "homelab"}, {"sql": "SELECT 1"}} {
+		if _, err := handler(context.Background(), mcpToolRequest(args)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	traffic := m.tagTraffic()
+	if len(traffic) != 2 {
+		t.Fatalf("traffic = %+v, want homelab and career", traffic)
+	}
+	if h := traffic["homelab"]; h.calls != 2 || h.response != 20 || h.request != int64(len(`{"tags":"homelab, Career"}`)+len(`{"tags":"homelab"}`)) {
+		t.Errorf("homelab traffic = %+v", h)
+	}
+	if c := traffic["career"]; c.calls != 1 || c.response != 10 {
+		t.Errorf("career traffic = %+v", c)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latinCompositions maps a letter and a combining mark to the precomposed
+// letter they make, for the Latin-1 Supplement, Latin Extended-A and -B and
+// Latin Extended Additional blocks, as listed in UnicodeData.txt. Letters
+// built from two marks, such as Vietnamese "ệ", compose in two steps.
+var latinCompositions = map[[2]rune]rune{
+	{'A', 0x0300}: 0x00C0, {'A', 0x0301}: 0x00C1, {'A', 0x0302}: 0x00C2, {'A', 0x0303}: 0x00C3,
+	{'A', 0x0308}: 0x00C4, {'A', 0x030A}: 0x00C5, {'C', 0x0327}: 0x00C7, {'E', 0x0300}: 0x00C8,
+	{'E', 0x0301}: 0x00C9, {'E', 0x0302}: 0x00CA, {'E', 0x0308}: 0x00CB, {'I', 0x0300}: 0x00CC,
+	{'I', 0x0301}: 0x00CD, {'I', 0x0302}: 0x00CE, {'I', 0x0308}: 0x00CF, {'N', 0x0303}: 0x00D1,
+	{'O', 0x0300}: 0x00D2, {'O', 0x0301}: 0x00D3, {'O', 0x0302}: 0x00D4, {'O', 0x0303}: 0x00D5,
+	{'O', 0x0308}: 0x00D6, {'U', 0x0300}: 0x00D9, {'U', 0x0301}: 0x00DA, {'U', 0x0302}: 0x00DB,
+	{'U', 0x0308}: 0x00DC, {'Y', 0x0301}: 0x00DD, {'a', 0x0300}: 0x00E0, {'a', 0x0301}: 0x00E1,
+	{'a', 0x0302}: 0x00E2, {'a', 0x0303}: 0x00E3, {'a', 0x0308}: 0x00E4, {'a', 0x030A}: 0x00E5,
+	{'c', 0x0327}: 0x00E7, {'e', 0x0300}: 0x00E8, {'e', 0x0301}: 0x00E9, {'e', 0x0302}: 0x00EA,
+	{'e', 0x0308}: 0x00EB, {'i', 0x0300}: 0x00EC, {'i', 0x0301}: 0x00ED, {'i', 0x0302}: 0x00EE,
+	{'i', 0x0308}: 0x00EF, {'n', 0x0303}: 0x00F1, {'o', 0x0300}: 0x00F2, {'o', 0x0301}: 0x00F3,
+	{'o', 0x0302}: 0x00F4, {'o', 0x0303}: 0x00F5, {'o', 0x0308}: 0x00F6, {'u', 0x0300}: 0x00F9,
+	{'u', 0x0301}: 0x00FA, {'u', 0x0302}: 0x00FB, {'u', 0x0308}: 0x00FC, {'y', 0x0301}: 0x00FD,
+	{'y', 0x0308}: 0x00FF, {'A', 0x0304}: 0x0100, {'a', 0x0304}: 0x0101, {'A', 0x0306}: 0x0102,
+	{'a', 0x0306}: 0x0103, {'A', 0x0328}: 0x0104, {'a', 0x0328}: 0x0105, {'C', 0x0301}: 0x0106,
+	{'c', 0x0301}: 0x0107, {'C', 0x0302}: 0x0108, {'c', 0x0302}: 0x0109, {'C', 0x0307}: 0x010A,
+	{'c', 0x0307}: 0x010B, {'C', 0x030C}: 0x010C, {'c', 0x030C}: 0x010D, {'D', 0x030C}: 0x010E,
+	{'d', 0x030C}: 0x010F, {'E', 0x0304}: 0x0112, {'e', 0x0304}: 0x0113, {'E', 0x0306}: 0x0114,
+	{'e', 0x0306}: 0x0115, {'E', 0x0307}: 0x0116, {'e', 0x0307}: 0x0117, {'E', 0x0328}: 0x0118,
+	{'e', 0x0328}: 0x0119, {'E', 0x030C}: 0x011A, {'e', 0x030C}: 0x011B, {'G', 0x0302}: 0x011C,
+	{'g', 0x0302}: 0x011D, {'G', 0x0306}: 0x011E, {'g', 0x0306}: 0x011F, {'G', 0x0307}: 0x0120,
+	{'g', 0x0307}: 0x0121, {'G', 0x0327}: 0x0122, {'g', 0x0327}: 0x0123, {'H', 0x0302}: 0x0124,
+	{'h', 0x0302}: 0x0125, {'I', 0x0303}: 0x0128, {'i', 0x0303}: 0x0129, {'I', 0x0304}: 0x012A,
+	{'i', 0x0304}: 0x012B, {'I', 0x0306}: 0x012C, {'i', 0x0306}: 0x012D, {'I', 0x0328}: 0x012E,
+	{'i', 0x0328}: 0x012F, {'I', 0x0307}: 0x0130, {'J', 0x0302}: 0x0134, {'j', 0x0302}: 0x0135,
+	{'K', 0x0327}: 0x0136, {'k', 0x0327}: 0x0137, {'L', 0x0301}: 0x0139, {'l', 0x0301}: 0x013A,
+	{'L', 0x0327}: 0x013B, {'l', 0x0327}: 0x013C, {'L', 0x030C}: 0x013D, {'l', 0x030C}: 0x013E,
+	{'N', 0x0301}: 0x0143, {'n', 0x0301}: 0x0144, {'N', 0x0327}: 0x0145, {'n', 0x0327}: 0x0146,
+	{'N', 0x030C}: 0x0147, {'n', 0x030C}: 0x0148, {'O', 0x0304}: 0x014C, {'o', 0x0304}: 0x014D,
+	{'O', 0x0306}: 0x014E, {'o', 0x0306}: 0x014F, {'O', 0x030B}: 0x0150, {'o', 0x030B}: 0x0151,
+	{'R', 0x0301}: 0x0154, {'r', 0x0301}: 0x0155, {'R', 0x0327}: 0x0156, {'r', 0x0327}: 0x0157,
+	{'R', 0x030C}: 0x0158, {'r', 0x030C}: 0x0159, {'S', 0x0301}: 0x015A, {'s', 0x0301}: 0x015B,
+	{'S', 0x0302}: 0x015C, {'s', 0x0302}: 0x015D, {'S', 0x0327}: 0x015E, {'s', 0x0327}: 0x015F,
+	{'S', 0x030C}: 0x0160, {'s', 0x030C}: 0x0161, {'T', 0x0327}: 0x0162, {'t', 0x0327}: 0x0163,
+	{'T', 0x030C}: 0x0164, {'t', 0x030C}: 0x0165, {'U', 0x0303}: 0x0168, {'u', 0x0303}: 0x0169,
+	{'U', 0x0304}: 0x016A, {'u', 0x0304}: 0x016B, {'U', 0x0306}: 0x016C, {'u', 0x0306}: 0x016D,
+	{'U', 0x030A}: 0x016E, {'u', 0x030A}: 0x016F, {'U', 0x030B}: 0x0170, {'u', 0x030B}: 0x0171,
+	{'U', 0x0328}: 0x0172, {'u', 0x0328}: 0x0173, {'W', 0x0302}: 0x0174, {'w', 0x0302}: 0x0175,
+	{'Y', 0x0302}: 0x0176, {'y', 0x0302}: 0x0177, {'Y', 0x0308}: 0x0178, {'Z', 0x0301}: 0x0179,
+	{'z', 0x0301}: 0x017A, {'Z', 0x0307}: 0x017B, {'z', 0x0307}: 0x017C, {'Z', 0x030C}: 0x017D,
+	{'z', 0x030C}: 0x017E, {'O', 0x031B}: 0x01A0, {'o', 0x031B}: 0x01A1, {'U', 0x031B}: 0x01AF,
+	{'u', 0x031B}: 0x01B0, {'A', 0x030C}: 0x01CD, {'a', 0x030C}: 0x01CE, {'I', 0x030C}: 0x01CF,
+	{'i', 0x030C}: 0x01D0, {'O', 0x030C}: 0x01D1, {'o', 0x030C}: 0x01D2, {'U', 0x030C}: 0x01D3,
+	{'u', 0x030C}: 0x01D4, {0x00DC, 0x0304}: 0x01D5, {0x00FC, 0x0304}: 0x01D6, {0x00DC, 0x0301}: 0x01D7,
+	{0x00FC, 0x0301}: 0x01D8, {0x00DC, 0x030C}: 0x01D9, {0x00FC, 0x030C}: 0x01DA, {0x00DC, 0x0300}: 0x01DB,
+	{0x00FC, 0x0300}: 0x01DC, {0x00C4, 0x0304}: 0x01DE, {0x00E4, 0x0304}: 0x01DF, {0x0226, 0x0304}: 0x01E0,
+	{0x0227, 0x0304}: 0x01E1, {0x00C6, 0x0304}: 0x01E2, {0x00E6, 0x0304}: 0x01E3, {'G', 0x030C}: 0x01E6,
+	{'g', 0x030C}: 0x01E7, {'K', 0x030C}: 0x01E8, {'k', 0x030C}: 0x01E9, {'O', 0x0328}: 0x01EA,
+	{'o', 0x0328}: 0x01EB, {0x01EA, 0x0304}: 0x01EC, {0x01EB, 0x0304}: 0x01ED, {0x01B7, 0x030C}: 0x01EE,
+	{0x0292, 0x030C}: 0x01EF, {'j', 0x030C}: 0x01F0, {'G', 0x0301}: 0x01F4, {'g', 0x0301}: 0x01F5,
+	{'N', 0x0300}: 0x01F8, {'n', 0x0300}: 0x01F9, {0x00C5, 0x0301}: 0x01FA, {0x00E5, 0x0301}: 0x01FB,
+	{0x00C6, 0x0301}: 0x01FC, {0x00E6, 0x0301}: 0x01FD, {0x00D8, 0x0301}: 0x01FE, {0x00F8, 0x0301}: 0x01FF,
+	{'A', 0x030F}: 0x0200, {'a', 0x030F}: 0x0201, {'A', 0x0311}: 0x0202, {'a', 0x0311}: 0x0203,
+	{'E', 0x030F}: 0x0204, {'e', 0x030F}: 0x0205, {'E', 0x0311}: 0x0206, {'e', 0x0311}: 0x0207,
+	{'I', 0x030F}: 0x0208, {'i', 0x030F}: 0x0209, {'I', 0x0311}: 0x020A, {'i', 0x0311}: 0x020B,
+	{'O', 0x030F}: 0x020C, {'o', 0x030F}: 0x020D, {'O', 0x0311}: 0x020E, {'o', 0x0311}: 0x020F,
+	{'R', 0x030F}: 0x0210, {'r', 0x030F}: 0x0211, {'R', 0x0311}: 0x0212, {'r', 0x0311}: 0x0213,
+	{'U', 0x030F}: 0x0214, {'u', 0x030F}: 0x0215, {'U', 0x0311}: 0x0216, {'u', 0x0311}: 0x0217,
+	{'S', 0x0326}: 0x0218, {'s', 0x0326}: 0x0219, {'T', 0x0326}: 0x021A, {'t', 0x0326}: 0x021B,
+	{'H', 0x030C}: 0x021E, {'h', 0x030C}: 0x021F, {'A', 0x0307}: 0x0226, {'a', 0x0307}: 0x0227,
+	{'E', 0x0327}: 0x0228, {'e', 0x0327}: 0x0229, {0x00D6, 0x0304}: 0x022A, {0x00F6, 0x0304}: 0x022B,
+	{0x00D5, 0x0304}: 0x022C, {0x00F5, 0x0304}: 0x022D, {'O', 0x0307}: 0x022E, {'o', 0x0307}: 0x022F,
+	{0x022E, 0x0304}: 0x0230, {0x022F, 0x0304}: 0x0231, {'Y', 0x0304}: 0x0232, {'y', 0x0304}: 0x0233,
+	{'A', 0x0325}: 0x1E00, {'a', 0x0325}: 0x1E01, {'B', 0x0307}: 0x1E02, {'b', 0x0307}: 0x1E03,
+	{'B', 0x0323}: 0x1E04, {'b', 0x0323}: 0x1E05, {'B', 0x0331}: 0x1E06, {'b', 0x0331}: 0x1E07,
+	{0x00C7, 0x0301}: 0x1E08, {0x00E7, 0x0301}: 0x1E09, {'D', 0x0307}: 0x1E0A, {'d', 0x0307}: 0x1E0B,
+	{'D', 0x0323}: 0x1E0C, {'d', 0x0323}: 0x1E0D, {'D', 0x0331}: 0x1E0E, {'d', 0x0331}: 0x1E0F,
+	{'D', 0x0327}: 0x1E10, {'d', 0x0327}: 0x1E11, {'D', 0x032D}: 0x1E12, {'d', 0x032D}: 0x1E13,
+	{0x0112, 0x0300}: 0x1E14, {0x0113, 0x0300}: 0x1E15, {0x0112, 0x0301}: 0x1E16, {0x0113, 0x0301}: 0x1E17,
+	{'E', 0x032D}: 0x1E18, {'e', 0x032D}: 0x1E19, {'E', 0x0330}: 0x1E1A, {'e', 0x0330}: 0x1E1B,
+	{0x0228, 0x0306}: 0x1E1C, {0x0229, 0x0306}: 0x1E1D, {'F', 0x0307}: 0x1E1E, {'f', 0x0307}: 0x1E1F,
+	{'G', 0x0304}: 0x1E20, {'g', 0x0304}: 0x1E21, {'H', 0x0307}: 0x1E22, {'h', 0x0307}: 0x1E23,
+	{'H', 0x0323}: 0x1E24, {'h', 0x0323}: 0x1E25, {'H', 0x0308}: 0x1E26, {'h', 0x0308}: 0x1E27,
+	{'H', 0x0327}: 0x1E28, {'h', 0x0327}: 0x1E29, {'H', 0x032E}: 0x1E2A, {'h', 0x032E}: 0x1E2B,
+	{'I', 0x0330}: 0x1E2C, {'i', 0x0330}: 0x1E2D, {0x00CF, 0x0301}: 0x1E2E, {0x00EF, 0x0301}: 0x1E2F,
+	{'K', 0x0301}: 0x1E30, {'k', 0x0301}: 0x1E31, {'K', 0x0323}: 0x1E32, {'k', 0x0323}: 0x1E33,
+	{'K', 0x0331}: 0x1E34, {'k', 0x0331}: 0x1E35, {'L', 0x0323}: 0x1E36, {'l', 0x0323}: 0x1E37,
+	{0x1E36, 0x0304}: 0x1E38, {0x1E37, 0x0304}: 0x1E39, {'L', 0x0331}: 0x1E3A, {'l', 0x0331}: 0x1E3B,
+	{'L', 0x032D}: 0x1E3C, {'l', 0x032D}: 0x1E3D, {'M', 0x0301}: 0x1E3E, {'m', 0x0301}: 0x1E3F,
+	{'M', 0x0307}: 0x1E40, {'m', 0x0307}: 0x1E41, {'M', 0x0323}: 0x1E42, {'m', 0x0323}: 0x1E43,
+	{'N', 0x0307}: 0x1E44, {'n', 0x0307}: 0x1E45, {'N', 0x0323}: 0x1E46, {'n', 0x0323}: 0x1E47,
+	{'N', 0x0331}: 0x1E48, {'n', 0x0331}: 0x1E49, {'N', 0x032D}: 0x1E4A, {'n', 0x032D}: 0x1E4B,
+	{0x00D5, 0x0301}: 0x1E4C, {0x00F5, 0x0301}: 0x1E4D, {0x00D5, 0x0308}: 0x1E4E, {0x00F5, 0x0308}: 0x1E4F,
+	{0x014C, 0x0300}: 0x1E50, {0x014D, 0x0300}: 0x1E51, {0x014C, 0x0301}: 0x1E52, {0x014D, 0x0301}: 0x1E53,
+	{'P', 0x0301}: 0x1E54, {'p', 0x0301}: 0x1E55, {'P', 0x0307}: 0x1E56, {'p', 0x0307}: 0x1E57,
+	{'R', 0x0307}: 0x1E58, {'r', 0x0307}: 0x1E59, {'R', 0x0323}: 0x1E5A, {'r', 0x0323}: 0x1E5B,
+	{0x1E5A, 0x0304}: 0x1E5C, {0x1E5B, 0x0304}: 0x1E5D, {'R', 0x0331}: 0x1E5E, {'r', 0x0331}: 0x1E5F,
+	{'S', 0x0307}: 0x1E60, {'s', 0x0307}: 0x1E61, {'S', 0x0323}: 0x1E62, {'s', 0x0323}: 0x1E63,
+	{0x015A, 0x0307}: 0x1E64, {0x015B, 0x0307}: 0x1E65, {0x0160, 0x0307}: 0x1E66, {0x0161, 0x0307}: 0x1E67,
+	{0x1E62, 0x0307}: 0x1E68, {0x1E63, 0x0307}: 0x1E69, {'T', 0x0307}: 0x1E6A, {'t', 0x0307}: 0x1E6B,
+	{'T', 0x0323}: 0x1E6C, {'t', 0x0323}: 0x1E6D, {'T', 0x0331}: 0x1E6E, {'t', 0x0331}: 0x1E6F,
+	{'T', 0x032D}: 0x1E70, {'t', 0x032D}: 0x1E71, {'U', 0x0324}: 0x1E72, {'u', 0x0324}: 0x1E73,
+	{'U', 0x0330}: 0x1E74, {'u', 0x0330}: 0x1E75, {'U', 0x032D}: 0x1E76, {'u', 0x032D}: 0x1E77,
+	{0x0168, 0x0301}: 0x1E78, {0x0169, 0x0301}: 0x1E79, {0x016A, 0x0308}: 0x1E7A, {0x016B, 0x0308}: 0x1E7B,
+	{'V', 0x0303}: 0x1E7C, {'v', 0x0303}: 0x1E7D, {'V', 0x0323}: 0x1E7E, {'v', 0x0323}: 0x1E7F,
+	{'W', 0x0300}: 0x1E80, {'w', 0x0300}: 0x1E81, {'W', 0x0301}: 0x1E82, {'w', 0x0301}: 0x1E83,
+	{'W', 0x0308}: 0x1E84, {'w', 0x0308}: 0x1E85, {'W', 0x0307}: 0x1E86, {'w', 0x0307}: 0x1E87,
+	{'W', 0x0323}: 0x1E88, {'w', 0x0323}: 0x1E89, {'X', 0x0307}: 0x1E8A, {'x', 0x0307}: 0x1E8B,
+	{'X', 0x0308}: 0x1E8C, {'x', 0x0308}: 0x1E8D, {'Y', 0x0307}: 0x1E8E, {'y', 0x0307}: 0x1E8F,
+	{'Z', 0x0302}: 0x1E90, {'z', 0x0302}: 0x1E91, {'Z', 0x0323}: 0x1E92, {'z', 0x0323}: 0x1E93,
+	{'Z', 0x0331}: 0x1E94, {'z', 0x0331}: 0x1E95, {'h', 0x0331}: 0x1E96, {'t', 0x0308}: 0x1E97,
+	{'w', 0x030A}: 0x1E98, {'y', 0x030A}: 0x1E99, {0x017F, 0x0307}: 0x1E9B, {'A', 0x0323}: 0x1EA0,
+	{'a', 0x0323}: 0x1EA1, {'A', 0x0309}: 0x1EA2, {'a', 0x0309}: 0x1EA3, {0x00C2, 0x0301}: 0x1EA4,
+	{0x00E2, 0x0301}: 0x1EA5, {0x00C2, 0x0300}: 0x1EA6, {0x00E2, 0x0300}: 0x1EA7, {0x00C2, 0x0309}: 0x1EA8,
+	{0x00E2, 0x0309}: 0x1EA9, {0x00C2, 0x0303}: 0x1EAA, {0x00E2, 0x0303}: 0x1EAB, {0x1EA0, 0x0302}: 0x1EAC,
+	{0x1EA1, 0x0302}: 0x1EAD, {0x0102, 0x0301}: 0x1EAE, {0x0103, 0x0301}: 0x1EAF, {0x0102, 0x0300}: 0x1EB0,
+	{0x0103, 0x0300}: 0x1EB1, {0x0102, 0x0309}: 0x1EB2, {0x0103, 0x0309}: 0x1EB3, {0x0102, 0x0303}: 0x1EB4,
+	{0x0103, 0x0303}: 0x1EB5, {0x1EA0, 0x0306}: 0x1EB6, {0x1EA1, 0x0306}: 0x1EB7, {'E', 0x0323}: 0x1EB8,
+	{'e', 0x0323}: 0x1EB9, {'E', 0x0309}: 0x1EBA, {'e', 0x0309}: 0x1EBB, {'E', 0x0303}: 0x1EBC,
+	{'e', 0x0303}: 0x1EBD, {0x00CA, 0x0301}: 0x1EBE, {0x00EA, 0x0301}: 0x1EBF, {0x00CA, 0x0300}: 0x1EC0,
+	{0x00EA, 0x0300}: 0x1EC1, {0x00CA, 0x0309}: 0x1EC2, {0x00EA, 0x0309}: 0x1EC3, {0x00CA, 0x0303}: 0x1EC4,
+	{0x00EA, 0x0303}: 0x1EC5, {0x1EB8, 0x0302}: 0x1EC6, {0x1EB9, 0x0302}: 0x1EC7, {'I', 0x0309}: 0x1EC8,
+	{'i', 0x0309}: 0x1EC9, {'I', 0x0323}: 0x1ECA, {'i', 0x0323}: 0x1ECB, {'O', 0x0323}: 0x1ECC,
+	{'o', 0x0323}: 0x1ECD, {'O', 0x0309}: 0x1ECE, {'o', 0x0309}: 0x1ECF, {0x00D4, 0x0301}: 0x1ED0,
+	{0x00F4, 0x0301}: 0x1ED1, {0x00D4, 0x0300}: 0x1ED2, {0x00F4, 0x0300}: 0x1ED3, {0x00D4, 0x0309}: 0x1ED4,
+	{0x00F4, 0x0309}: 0x1ED5, {0x00D4, 0x0303}: 0x1ED6, {0x00F4, 0x0303}: 0x1ED7, {0x1ECC, 0x0302}: 0x1ED8,
+	{0x1ECD, 0x0302}: 0x1ED9, {0x01A0, 0x0301}: 0x1EDA, {0x01A1, 0x0301}: 0x1EDB, {0x01A0, 0x0300}: 0x1EDC,
+	{0x01A1, 0x0300}: 0x1EDD, {0x01A0, 0x0309}: 0x1EDE, {0x01A1, 0x0309}: 0x1EDF, {0x01A0, 0x0303}: 0x1EE0,
+	{0x01A1, 0x0303}: 0x1EE1, {0x01A0, 0x0323}: 0x1EE2, {0x01A1, 0x0323}: 0x1EE3, {'U', 0x0323}: 0x1EE4,
+	{'u', 0x0323}: 0x1EE5, {'U', 0x0309}: 0x1EE6, {'u', 0x0309}: 0x1EE7, {0x01AF, 0x0301}: 0x1EE8,
+	{0x01B0, 0x0301}: 0x1EE9, {0x01AF, 0x0300}: 0x1EEA, {0x01B0, 0x0300}: 0x1EEB, {0x01AF, 0x0309}: 0x1EEC,
+	{0x01B0, 0x0309}: 0x1EED, {0x01AF, 0x0303}: 0x1EEE, {0x01B0, 0x0303}: 0x1EEF, {0x01AF, 0x0323}: 0x1EF0,
+	{0x01B0, 0x0323}: 0x1EF1, {'Y', 0x0300}: 0x1EF2, {'y', 0x0300}: 0x1EF3, {'Y', 0x0323}: 0x1EF4,
+	{'y', 0x0323}: 0x1EF5, {'Y', 0x0309}: 0x1EF6, {'y', 0x0309}: 0x1EF7, {'Y', 0x0303}: 0x1EF8,
+	{'y', 0x0303}: 0x1EF9,
+}
+
+// normalizeText composes letters typed or pasted as a base letter followed
+// by combining marks ("Malmo" + U+0308) into their precomposed form
+// ("Malmö"), as Unicode NFC does for Latin text, so the same word is stored
+// the same way whichever way it arrived. Text without combining marks is
+// returned as is.
+func normalizeText(s string) string {
+	if strings.IndexFunc(s, isCombiningMark) < 0 {
+		return s
+	}
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if n := len(out); n > 0 && isCombiningMark(r) {
+			if c, ok := latinCompositions[[2]rune{out[n-1], r}]; ok {
+				out[n-1] = c
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+func isCombiningMark(r rune) bool {
+	return unicode.Is(unicode.Mn, r)
+}
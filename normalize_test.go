@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"ascii unchanged", "NAS runs TrueNAS", "NAS runs TrueNAS"},
+		{"precomposed unchanged", "Malm\u00f6", "Malm\u00f6"},
+		{"combining diaeresis", "Malmo\u0308", "Malm\u00f6"},
+		{"two marks", "Vie\u0323\u0302t", "Vi\u1ec7t"},
+		{"uncomposable mark kept", "x\u0301", "x\u0301"},
+		{"leading mark kept", "\u0301a", "\u0301a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeText(tt.input); got != tt.expected {
+				t.Errorf("normalizeText(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFTSPrefix(t *testing.T) {
+	if got := ftsPrefix(`say "hi"`); got != `"say ""hi"""*` {
+		t.Errorf("ftsPrefix() = %q", got)
+	}
+}
+
+func TestDiacriticSearch_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM entities WHERE name = 'Diacritics test'")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Diacritics test')")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Diacritics test')")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('Diacritics test', 'Test')"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := callTool(addObservationHandler(db, nil), "add_observation", map[string]any{
+		"entity": "Diacritics test", "content": "Trip to Malmo\u0308 in June", "tags": "personal"})
+	if err != nil || result.IsError {
+		t.Fatalf("add_observation: %v %v", err, result.Content)
+	}
+	var id int64
+	var content string
+	db.QueryRow("SELECT o.id, o.content FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Diacritics test'").Scan(&id, &content)
+	if content != "Trip to Malm\u00f6 in June" {
+		t.Errorf("stored content = %q, want it composed", content)
+	}
+
+	ids, err := keywordMatches(ctx, db, visibilityLevels, []string{"malmo"}, 10)
+	if err != nil {
+		t.Fatalf("keywordMatches: %v", err)
+	}
+	found := false
+	for _, got := range ids {
+		found = found || got == id
+	}
+	if !found {
+		t.Errorf("keywordMatches(malmo) = %v, want observation %d", ids, id)
+	}
+
+	result, err = callTool(searchNodesHandler(db, nil), "search_nodes", map[string]any{"query": "MALMO"})
+	if err != nil || result.IsError {
+		t.Fatalf("search_nodes: %v %v", err, result.Content)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "Diacritics test") {
+		t.Errorf("search_nodes(MALMO) = %s, want the entity", text)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// entityByName selects an entity by its name or, failing that, by a former
+// name rename_entity kept as an alias. It takes the name three times.
+const entityByName = " FROM entities WHERE name = ? OR id = (SELECT entity_id FROM entity_aliases WHERE alias = ?) ORDER BY name = ? DESC LIMIT 1"
+
+// lookupEntityID resolves an entity name, or a former name, to its id.
+func lookupEntityID(ctx context.Context, db *sql.DB, name string) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, "SELECT id"+entityByName, name, name, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errorf(codeNotFound, "entity '%s' does not exist. Create it first with: INSERT INTO entities (name, entity_type) VALUES ('%s', 'Type')", name, name)
+	} else if err != nil {
+		return 0, errorf(codeDatabase, "error looking up entity '%s': %v", name, err)
+	}
+	return id, nil
+}
+
+// registerObservationTools adds the add_observation and
+// review_low_confidence tools.
+func registerObservationTools(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes, tagger sampler, guided *guideTools) {
+	guided.add(s, func() server.ServerTool {
+		return server.ServerTool{Tool: mcp.NewTool("add_observation",
+			mcp.WithDescription(`Add an observation to an existing entity, with tags and provenance.
+
+Prefer this over INSERT INTO observations: it records where the memory came from so it can be cited later.`),
+			mcp.WithString("entity",
+				mcp.Required(),
+				mcp.Description("Name of the entity the observation is about"),
+			),
+			mcp.WithString("content",
+				mcp.Required(),
+				mcp.Description("The observation text"),
+			),
+			observationTagsOption(),
+			mcp.WithString("visibility",
+				mcp.Description("private (default), shared or public"),
+			),
+			mcp.WithString("source",
+				mcp.Description("Where this came from: 'user' if the user said it, 'inferred' if you concluded it, or e.g. 'import', 'web'"),
+			),
+			mcp.WithNumber("confidence",
+				mcp.Description("How sure you are, 0-1. Use 1 for things the user stated, lower for inferences"),
+				mcp.Min(0),
+				mcp.Max(1),
+			),
+			mcp.WithObject("metadata",
+				mcp.Description(`Typed fields as a JSON object, e.g. {"host": "nas", "port": 8080}. Searchable with search_metadata`),
+			),
+			mcp.WithString("conversation_id",
+				mcp.Description("Identifier of the conversation this was learned in"),
+			),
+			mcp.WithString("source_url",
+				mcp.Description("URL of the page or document this was taken from"),
+			),
+			mcp.WithString("parent",
+				mcp.Description("Id or cite (obs:12) of an observation this one corrects or follows up. Recall then shows this one in its place"),
+			),
+			mcp.WithBoolean("return_record",
+				mcp.Description(returnRecord+". Content split into parts returns a list"),
+			),
+		), Handler: addObservationHandler(db, tagger)}
+	})
+
+	s.AddTool(mcp.NewTool("review_low_confidence",
+		mcp.WithDescription(`List observations and relations whose confidence is below a threshold, least certain first, for the user to confirm or correct.
+
+After the user confirms one, raise it with execute, e.g. UPDATE observations SET confidence = 1 WHERE id = 12. Delete or correct the ones they reject.`),
+		mcp.WithNumber("threshold",
+			mcp.Description("List items with confidence below this value (default 0.5)"),
+			mcp.Min(0),
+			mcp.Max(1),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of items (default 20)"),
+		),
+	), reviewLowConfidenceHandler(db, scopes))
+}
+
+// addObservationHandler stores an observation. smp, when set, lets the
+// client's model choose tags for observations sent without them.
+func addObservationHandler(db *sql.DB, smp sampler) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		entity := strings.TrimSpace(request.GetString("entity", ""))
+		if entity == "" {
+			return toolError(codeInvalidArgument, "entity parameter is required"), nil
+		}
+
+		content := request.GetString("content", "")
+		if strings.TrimSpace(content) == "" {
+			return toolError(codeInvalidArgument, "content parameter is required"), nil
+		}
+
+		tagsStr, autoTagged := tagsOrAsk(ctx, db, smp, request.GetString("tags", ""), entity+": "+content)
+		if strings.TrimSpace(tagsStr) == "" && requiredTags.requires("observations") {
+			return toolError(codeTagRequired, "tags parameter is required. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+		}
+
+		visibility := request.GetString("visibility", "private")
+		if _, err := parseVisibilityLevels(visibility); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		var confidence any
+		if _, ok := request.GetArguments()["confidence"]; ok {
+			c, err := request.RequireFloat("confidence")
+			if err != nil || c < 0 || c > 1 {
+				return toolError(codeInvalidArgument, "confidence must be a number between 0 and 1"), nil
+			}
+			confidence = c
+		}
+
+		metadata, err := parseMetadata(request.GetArguments()["metadata"])
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		entityID, err := lookupEntityID(ctx, db, entity)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		parentID, err := checkParent(ctx, db, strings.TrimSpace(request.GetString("parent", "")))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		tagIDs, err := validateTagsFor(ctx, db, "observations", parseTagNames(tagsStr))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if err := checkTagQuotas(ctx, db, tagIDs, len(content)); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to begin transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+		ids, err := insertObservation(content, metadata, func(content string, metadata any) (int64, error) {
+			stored, digest, err := storeContent(ctx, tx, content)
+			if err != nil {
+				return 0, fmt.Errorf("failed to store content: %v", err)
+			}
+			result, err := tx.ExecContext(ctx, `INSERT INTO observations (entity_id, content, content_sha256, visibility, confidence, source, conversation_id, source_url, metadata, parent_id)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				entityID, stored, digest, strings.ToLower(visibility), confidence,
+				nullIfEmpty(request.GetString("source", "")),
+				nullIfEmpty(request.GetString("conversation_id", "")),
+				nullIfEmpty(request.GetString("source_url", "")),
+				metadata, parentID)
+			if err != nil {
+				return 0, execFailure(err)
+			}
+			observationID, _ := result.LastInsertId()
+			if err := linkTags(ctx, tx, observationID, tagIDs); err != nil {
+				return 0, fmt.Errorf("observation created but failed to link tags: %v", err)
+			}
+			return observationID, nil
+		})
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+
+		if request.GetBool("return_record", false) {
+			records, err := loadObservationRecords(ctx, db, ids)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "observation stored but failed to read it back: %v", err), nil
+			}
+			if len(records) == 1 {
+				return graphResult(records[0]), nil
+			}
+			return graphResult(records), nil
+		}
+		note := autoTagNote(autoTagged)
+		if parentID.Valid {
+			note += fmt.Sprintf(", following up %s; recall shows it in that one's place", citation(parentID.Int64))
+		}
+		if len(ids) > 1 {
+			return mcp.NewToolResultText(fmt.Sprintf("success: content over %d bytes split into observations %d-%d (%d parts, linked by metadata first_id = %d) on %s with %s%s",
+				maxObservationBytes, ids[0], ids[len(ids)-1], len(ids), ids[0], entity, tagList(tagsStr), note)), nil
+		}
+		observationID := ids[0]
+		return mcp.NewToolResultText(fmt.Sprintf("success: observation %d created on %s with %s%s", observationID, entity, tagList(tagsStr), note)), nil
+	}
+}
+
+// nullIfEmpty maps an empty optional parameter to SQL NULL.
+func nullIfEmpty(s string) any {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return s
+}
+
+func reviewLowConfidenceHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		threshold := request.GetFloat("threshold", 0.5)
+		limit := request.GetInt("limit", 20)
+		if limit <= 0 {
+			limit = 20
+		}
+
+		sqlStr := restrictVisibility(`SELECT 'observation' AS kind, o.id, e.name AS entity, o.content AS detail, o.confidence AS confidence, o.source AS source, o.created_at AS created_at
+			FROM observations o JOIN entities e ON e.id = o.entity_id
+			WHERE o.confidence < ?
+			UNION ALL
+			SELECT 'relation', r.id, f.name, r.relation_type || ' -> ' || t.name, r.confidence, NULL, r.created_at
+			FROM relations r JOIN entities f ON f.id = r.from_id JOIN entities t ON t.id = r.to_id
+			WHERE r.confidence < ?
+			ORDER BY confidence, created_at
+			LIMIT ?`, scopes.levels(ctx))
+
+		cols, results, err := runQuery(ctx, db, sqlStr, threshold, threshold, limit)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		return mcp.NewToolResultText(formatRows(cols, results)), nil
+	}
+}
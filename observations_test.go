@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestAddObservationHandler_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer callExecute(db, "DELETE FROM observations WHERE content = 'add observation test 55667'")
+
+	var entity string
+	if err := db.QueryRow("SELECT name FROM entities WHERE id = 1").Scan(&entity); err != nil {
+		t.Fatalf("lookup entity: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    map[string]any
+		wantErr bool
+	}{
+		{"missing entity", map[string]any{"content": "add observation test 55667", "tags": "homelab"}, true},
+		{"unknown entity", map[string]any{"entity": "no_such_entity_55667", "content": "add observation test 55667", "tags": "homelab"}, true},
+		{"missing tags", map[string]any{"entity": entity, "content": "add observation test 55667"}, true},
+		{"invalid visibility", map[string]any{"entity": entity, "content": "add observation test 55667", "tags": "homelab", "visibility": "secret"}, true},
+		{"with provenance", map[string]any{
+			"entity": entity, "content": "add observation test 55667", "tags": "homelab",
+			"source": "user", "conversation_id": "conv-55667", "source_url": "https://example.com/55667",
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := callTool(addObservationHandler(db, nil), "add_observation", tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v, want %v: %v", result.IsError, tt.wantErr, result.Content)
+			}
+		})
+	}
+
+	var source, conversationID, sourceURL string
+	err := db.QueryRow("SELECT source, conversation_id, source_url FROM observations WHERE content = 'add observation test 55667'").Scan(&source, &conversationID, &sourceURL)
+	if err != nil {
+		t.Fatalf("lookup observation: %v", err)
+	}
+	if source != "user" || conversationID != "conv-55667" || sourceURL != "https://example.com/55667" {
+		t.Errorf("provenance not stored: %q %q %q", source, conversationID, sourceURL)
+	}
+}
+
+func TestReviewLowConfidence_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	if _, err := db.Exec(`INSERT INTO observations (entity_id, content, confidence, visibility) VALUES
+		(1, 'low confidence test 77889', 0.2, 'private'),
+		(1, 'high confidence test 77889', 0.9, 'private'),
+		(1, 'hidden low confidence test 77889', 0.1, 'private')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	defer db.Exec("DELETE FROM observations WHERE content LIKE '%confidence test 77889'")
+
+	result, err := callTool(reviewLowConfidenceHandler(db, nil), "review_low_confidence", map[string]any{"threshold": 0.5, "limit": float64(100)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(text, "low confidence test 77889") {
+		t.Errorf("expected low confidence observation listed:\n%s", text)
+	}
+	if strings.Contains(text, "high confidence test 77889") {
+		t.Errorf("high confidence observation should not be listed:\n%s", text)
+	}
+	if strings.Index(text, "hidden low confidence") > strings.Index(text, "detail: low confidence") {
+		t.Errorf("expected least confident first:\n%s", text)
+	}
+
+	result, err = callTool(addObservationHandler(db, nil), "add_observation", map[string]any{"entity": "x", "content": "x", "tags": "homelab", "confidence": 1.5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.IsError {
+		t.Error("expected error for confidence above 1")
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDC login for the REST API and web UI. ENGRAM_OIDC_ISSUER turns it on;
+// the identity in ENGRAM_OIDC_CLAIM of a verified ID token then acts as the
+// client name for ENGRAM_CLIENT_VISIBILITY, ENGRAM_CLIENT_TOOLS and
+// ENGRAM_CLIENT_TAGS. ENGRAM_OIDC_USERS, when set, lists the identities let in.
+var (
+	oidcIssuer       = getEnv("ENGRAM_OIDC_ISSUER", "")
+	oidcClientID     = getEnv("ENGRAM_OIDC_CLIENT_ID", "")
+	oidcClientSecret = getEnv("ENGRAM_OIDC_CLIENT_SECRET", "")
+	oidcRedirectURL  = getEnv("ENGRAM_OIDC_REDIRECT_URL", "")
+	oidcClaim        = getEnv("ENGRAM_OIDC_CLAIM", "email")
+	oidcUsers        = getEnv("ENGRAM_OIDC_USERS", "")
+)
+
+const (
+	// oidcLeeway absorbs clock skew between this server and the issuer.
+	oidcLeeway = time.Minute
+	// oidcKeysRefresh is the least time between JWKS fetches, which happen
+	// when a token names a key not seen yet.
+	oidcKeysRefresh = time.Minute
+
+	sessionCookie = "engram_session"
+	loginCookie   = "engram_login"
+)
+
+type oidcProvider struct {
+	issuer, clientID, clientSecret string
+	redirectURL, claim             string
+	users                          map[string]bool
+
+	authEndpoint, tokenEndpoint, jwksURI string
+	client                               *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// newOIDCProvider reads the issuer's discovery document and signing keys.
+func newOIDCProvider(ctx context.Context, issuer, clientID, clientSecret, redirectURL, claim, users string) (*oidcProvider, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("ENGRAM_OIDC_CLIENT_ID is required")
+	}
+	if u, err := url.Parse(redirectURL); redirectURL != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+		return nil, fmt.Errorf("invalid ENGRAM_OIDC_REDIRECT_URL %q", redirectURL)
+	}
+	if strings.TrimSpace(claim) == "" {
+		return nil, fmt.Errorf("ENGRAM_OIDC_CLAIM is empty")
+	}
+	p := &oidcProvider{
+		issuer: strings.TrimSuffix(issuer, "/"), clientID: clientID, clientSecret: clientSecret,
+		redirectURL: redirectURL, claim: claim, users: toolSet(users),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("discovery: %v", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("discovery names issuer %q, want %q", discovery.Issuer, p.issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery has no jwks_uri")
+	}
+	p.authEndpoint, p.tokenEndpoint, p.jwksURI = discovery.AuthorizationEndpoint, discovery.TokenEndpoint, discovery.JWKSURI
+	if err := p.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, u string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jwk is a public key from the issuer's JWKS.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func (p *oidcProvider) fetchKeys(ctx context.Context) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURI, &set); err != nil {
+		return fmt.Errorf("signing keys: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("signing keys: none usable at %s", p.jwksURI)
+	}
+	p.keys, p.fetched = keys, time.Now()
+	return nil
+}
+
+// key returns the signing key kid, fetching the JWKS again when the issuer
+// may have rotated its keys.
+func (p *oidcProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.fetched) > oidcKeysRefresh {
+		if err := p.fetchKeys(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := p.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verify checks an ID token's signature, issuer, audience and lifetime, and
+// returns the identity it carries.
+func (p *oidcProvider) verify(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("not a JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("signature: %v", err)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return "", errors.New("bad signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 ||
+			!ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return "", errors.New("bad signature")
+		}
+	default:
+		return "", fmt.Errorf("unsupported algorithm %s", header.Alg)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("claims: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return "", fmt.Errorf("issued by %q", iss)
+	}
+	if !audienceIncludes(claims["aud"], p.clientID) {
+		return "", errors.New("issued for another client")
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0).Add(oidcLeeway)) {
+		return "", errors.New("expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return "", errors.New("not valid yet")
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified && p.claim == "email" {
+		return "", errors.New("email not verified")
+	}
+	identity, _ := claims[p.claim].(string)
+	if identity == "" {
+		return "", fmt.Errorf("no %s claim", p.claim)
+	}
+	if len(p.users) > 0 && !p.users[identity] {
+		return "", fmt.Errorf("%s is not in ENGRAM_OIDC_USERS", identity)
+	}
+	return identity, nil
+}
+
+func decodeSegment(s string, out any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func audienceIncludes(aud any, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []any:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// secureCookies reports whether cookies need HTTPS, which they do when the
+// redirect URL is HTTPS.
+func (p *oidcProvider) secureCookies() bool {
+	return strings.HasPrefix(p.redirectURL, "https://")
+}
+
+// login sends the browser to the issuer, using PKCE and a state cookie.
+func (p *oidcProvider) login(w http.ResponseWriter, r *http.Request) {
+	if p.redirectURL == "" || p.authEndpoint == "" {
+		writeJSON(w, http.StatusNotFound, restError{Error: "browser login needs ENGRAM_OIDC_REDIRECT_URL"})
+		return
+	}
+	state, verifier := randomToken(), randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name: loginCookie, Value: state + "." + verifier, Path: "/auth/", MaxAge: 600,
+		HttpOnly: true, Secure: p.secureCookies(), SameSite: http.SameSiteLaxMode,
+	})
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, p.authEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// callback trades the issuer's code for an ID token and keeps it as the
+// session cookie until it expires.
+func (p *oidcProvider) callback(w http.ResponseWriter, r *http.Request) {
+	var state, verifier string
+	if c, err := r.Cookie(loginCookie); err == nil {
+		state, verifier, _ = strings.Cut(c.Value, ".")
+	}
+	if state == "" || r.URL.Query().Get("state") != state {
+		writeJSON(w, http.StatusBadRequest, restError{Error: "login expired or was started elsewhere, try again at /auth/login"})
+		return
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		writeJSON(w, http.StatusUnauthorized, restError{Error: "login failed: " + e})
+		return
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {r.URL.Query().Get("code")},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {verifier},
+	}
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, restError{Error: err.Error()})
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, restError{Error: fmt.Sprintf("token exchange: %v", err)})
+		return
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil || tokens.IDToken == "" {
+		writeJSON(w, http.StatusBadGateway, restError{Error: fmt.Sprintf("token exchange: %s %s", resp.Status, tokens.Error)})
+		return
+	}
+	if _, err := p.verify(r.Context(), tokens.IDToken); err != nil {
+		writeJSON(w, http.StatusUnauthorized, restError{Error: fmt.Sprintf("login rejected: %v", err)})
+		return
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	decodeSegment(strings.Split(tokens.IDToken, ".")[1], &claims)
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: "/auth/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: tokens.IDToken, Path: "/", Expires: time.Unix(claims.Exp, 0),
+		HttpOnly: true, Secure: p.secureCookies(), SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (p *oidcProvider) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// identity returns the verified identity of a request, from a bearer ID
+// token or the session cookie.
+func (p *oidcProvider) identity(r *http.Request) (string, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return p.verify(r.Context(), token)
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return p.verify(r.Context(), c.Value)
+	}
+	return "", errors.New("not logged in")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// fakeIssuer is an OIDC provider signing with one RSA and one EC key. Its
+// token endpoint hands out idToken for any code.
+type fakeIssuer struct {
+	*httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	idToken string
+	// verifier is the PKCE code_verifier of the last token request.
+	verifier string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ec key: %v", err)
+	}
+	f := &fakeIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer": f.URL, "jwks_uri": f.URL + "/jwks",
+			"authorization_endpoint": f.URL + "/authorize", "token_endpoint": f.URL + "/token",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kid": "rsa1", "kty": "RSA", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kid": "ec1", "kty": "EC", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kid": "enc", "kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.verifier = r.Form.Get("code_verifier")
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.idToken})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// sign makes an ID token with claims over the defaults, signed with the
+// key kid.
+func (f *fakeIssuer) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	all := map[string]any{"iss": f.URL, "aud": "engram", "exp": time.Now().Add(time.Hour).Unix(), "email": "alice@example.com"}
+	for k, v := range claims {
+		if v == nil {
+			delete(all, k)
+		} else {
+			all[k] = v
+		}
+	}
+	alg := map[string]string{"rsa1": "RS256", "ec1": "ES256"}[kid]
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(all)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	if kid == "ec1" {
+		r, s, err := ecdsa.Sign(rand.Reader, f.ecKey, digest[:])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, f.rsaKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCVerify(t *testing.T) {
+	f := newFakeIssuer(t)
+	ctx := context.Background()
+	p, err := newOIDCProvider(ctx, f.URL+"/", "engram", "", "", "email", "alice@example.com,bob@example.com")
+	if err != nil {
+		t.Fatalf("newOIDCProvider: %v", err)
+	}
+
+	tampered := strings.Split(f.sign(t, "rsa1", nil), ".")
+	other := strings.Split(f.sign(t, "rsa1", map[string]any{"email": "bob@example.com"}), ".")
+	tests := []struct {
+		name, token, want, wantErr string
+	}{
+		{"rs256", f.sign(t, "rsa1", nil), "alice@example.com", ""},
+		{"es256", f.sign(t, "ec1", map[string]any{"email": "bob@example.com"}), "bob@example.com", ""},
+		{"audience list", f.sign(t, "rsa1", map[string]any{"aud": []string{"other", "engram"}}), "alice@example.com", ""},
+		{"within leeway", f.sign(t, "rsa1", map[string]any{"exp": time.Now().Add(-30 * time.Second).Unix()}), "alice@example.com", ""},
+		{"expired", f.sign(t, "rsa1", map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}), "", "expired"},
+		{"no expiry", f.sign(t, "rsa1", map[string]any{"exp": nil}), "", "expired"},
+		{"not yet", f.sign(t, "rsa1", map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}), "", "not valid yet"},
+		{"wrong audience", f.sign(t, "rsa1", map[string]any{"aud": "other"}), "", "another client"},
+		{"wrong issuer", f.sign(t, "rsa1", map[string]any{"iss": "https://evil.example.com"}), "", "issued by"},
+		{"unverified email", f.sign(t, "rsa1", map[string]any{"email_verified": false}), "", "not verified"},
+		{"not listed", f.sign(t, "rsa1", map[string]any{"email": "eve@example.com"}), "", "ENGRAM_OIDC_USERS"},
+		{"no claim", f.sign(t, "rsa1", map[string]any{"email": nil}), "", "no email claim"},
+		{"tampered", tampered[0] + "." + other[1] + "." + tampered[2], "", "bad signature"},
+		{"unknown key", strings.Replace(f.sign(t, "rsa1", nil), tampered[0], base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"gone"}`)), 1), "", "unknown signing key"},
+		{"garbage", "not-a-token", "", "not a JWT"},
+	}
+	for _, tt := range tests {
+		got, err := p.verify(ctx, tt.token)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: verify = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestOIDCProviderConfig(t *testing.T) {
+	f := newFakeIssuer(t)
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name, issuer, clientID, redirect string
+	}{
+		{"no client id", f.URL, "", ""},
+		{"bad redirect", f.URL, "engram", "/auth/callback"},
+		{"other issuer", f.URL + "/realms/other", "engram", ""},
+	} {
+		if _, err := newOIDCProvider(ctx, tt.issuer, tt.clientID, "", tt.redirect, "email", ""); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestRESTOIDC(t *testing.T) {
+	f := newFakeIssuer(t)
+	ctx := context.Background()
+
+	s := server.NewMCPServer("test", "1.0.0")
+	for _, name := range []string{"open_nodes", "search_nodes", "read_graph", "count", "add_observation", "execute", "create_relations"} {
+		echoTool(s, mcp.NewTool(name))
+	}
+	var api *restAPI
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { api.handler().ServeHTTP(w, r) }))
+	defer srv.Close()
+	p, err := newOIDCProvider(ctx, f.URL, "engram", "secret", srv.URL+"/auth/callback", "email", "")
+	if err != nil {
+		t.Fatalf("newOIDCProvider: %v", err)
+	}
+	if api, err = newRESTAPI(s, "static", p); err != nil {
+		t.Fatalf("newRESTAPI: %v", err)
+	}
+
+	get := func(client *http.Client, path, auth string) (*http.Response, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	if resp, body := get(http.DefaultClient, "/auth/me", ""); resp.StatusCode != http.StatusUnauthorized || body["login"] != "/auth/login" {
+		t.Errorf("anonymous /auth/me = %d %v", resp.StatusCode, body)
+	}
+	if resp, body := get(http.DefaultClient, "/auth/me", f.sign(t, "ec1", nil)); resp.StatusCode != http.StatusOK || body["identity"] != "alice@example.com" {
+		t.Errorf("bearer /auth/me = %d %v", resp.StatusCode, body)
+	}
+	if resp, _ := get(http.DefaultClient, "/search?q=x", "static"); resp.StatusCode != http.StatusOK {
+		t.Errorf("static token /search = %d", resp.StatusCode)
+	}
+	if resp, _ := get(http.DefaultClient, "/search?q=x", f.sign(t, "rsa1", map[string]any{"aud": "other"})); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("foreign token /search = %d", resp.StatusCode)
+	}
+
+	// The browser flow: /auth/login sends the browser to the issuer, which
+	// comes back to /auth/callback with a code and the state.
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, _ := get(browser, "/auth/login", "")
+	authorize, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil || !strings.HasPrefix(authorize.String(), f.URL+"/authorize?") {
+		t.Fatalf("/auth/login = %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	q := authorize.Query()
+	if q.Get("client_id") != "engram" || q.Get("redirect_uri") != srv.URL+"/auth/callback" || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("authorize query = %v", q)
+	}
+
+	if resp, _ := get(browser, "/auth/callback?code=abc&state=forged", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("forged state = %d, want 400", resp.StatusCode)
+	}
+	f.idToken = f.sign(t, "rsa1", map[string]any{"email": "bob@example.com"})
+	if resp, body := get(browser, "/auth/callback?code=abc&state="+q.Get("state"), ""); resp.StatusCode != http.StatusFound {
+		t.Fatalf("callback = %d %v", resp.StatusCode, body)
+	}
+	challenge := sha256.Sum256([]byte(f.verifier))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != q.Get("code_challenge") {
+		t.Error("code_verifier does not match code_challenge")
+	}
+	if resp, body := get(browser, "/auth/me", ""); resp.StatusCode != http.StatusOK || body["identity"] != "bob@example.com" {
+		t.Errorf("session /auth/me = %d %v", resp.StatusCode, body)
+	}
+	get(browser, "/auth/logout", "")
+	if resp, _ := get(browser, "/auth/me", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("/auth/me after logout = %d", resp.StatusCode)
+	}
+}
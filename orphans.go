@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultOrphansLimit = 50
+	maxOrphansLimit     = 500
+)
+
+// orphanEntity is an entity with no observations and no relations. mergeInto
+// is set when another entity looks like the same thing under a different
+// spelling.
+type orphanEntity struct {
+	id                    int64
+	name, entityType      string
+	openUnknowns          int
+	mergeInto             string
+	mergeIntoID           int64
+	mergeIntoObservations int
+}
+
+// nameKey folds a name for duplicate detection: lower case, letters and
+// digits only, so "Home Lab", "home-lab" and "homelab" match.
+func nameKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+type mergeCandidate struct {
+	id           int64
+	name         string
+	observations int
+}
+
+// matchOrphan picks the entity an orphan most likely duplicates: an exact
+// nameKey match first, otherwise the closest-length name whose key contains
+// the orphan's or is contained in it. Keys shorter than 4 characters only
+// match exactly, as "ai" or "pi" are contained in too many names.
+func matchOrphan(name string, candidates []mergeCandidate) (mergeCandidate, bool) {
+	key := nameKey(name)
+	if key == "" {
+		return mergeCandidate{}, false
+	}
+	var best mergeCandidate
+	bestDiff := -1
+	for _, c := range candidates {
+		ck := nameKey(c.name)
+		if ck == key {
+			return c, true
+		}
+		if len(key) < 4 || len(ck) < 4 || !(strings.Contains(ck, key) || strings.Contains(key, ck)) {
+			continue
+		}
+		diff := len(ck) - len(key)
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = c, diff
+		}
+	}
+	return best, bestDiff >= 0
+}
+
+func findOrphans(ctx context.Context, db *sql.DB, includeArchived bool) ([]orphanEntity, error) {
+	filter := "e.archived_at IS NULL"
+	if includeArchived {
+		filter = "1"
+	}
+	rows, err := db.QueryContext(ctx, `SELECT e.id, e.name, e.entity_type,
+			(SELECT count(*) FROM unknowns u WHERE u.entity_id = e.id AND u.resolved_at IS NULL)
+		FROM entities e
+		WHERE `+filter+`
+			AND NOT EXISTS (SELECT 1 FROM observations o WHERE o.entity_id = e.id)
+			AND NOT EXISTS (SELECT 1 FROM relations r WHERE r.from_id = e.id OR r.to_id = e.id)
+		ORDER BY e.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var orphans []orphanEntity
+	for rows.Next() {
+		var o orphanEntity
+		if err := rows.Scan(&o.id, &o.name, &o.entityType, &o.openUnknowns); err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orphans) == 0 {
+		return nil, nil
+	}
+
+	// Only entities that carry something are worth merging into.
+	rows, err = db.QueryContext(ctx, `SELECT e.id, e.name, (SELECT count(*) FROM observations o WHERE o.entity_id = e.id)
+		FROM entities e
+		WHERE e.archived_at IS NULL
+			AND (EXISTS (SELECT 1 FROM observations o WHERE o.entity_id = e.id)
+				OR EXISTS (SELECT 1 FROM relations r WHERE r.from_id = e.id OR r.to_id = e.id))
+		ORDER BY e.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var candidates []mergeCandidate
+	for rows.Next() {
+		var c mergeCandidate
+		if err := rows.Scan(&c.id, &c.name, &c.observations); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, o := range orphans {
+		if c, ok := matchOrphan(o.name, candidates); ok {
+			orphans[i].mergeInto, orphans[i].mergeIntoID, orphans[i].mergeIntoObservations = c.name, c.id, c.observations
+		}
+	}
+	return orphans, nil
+}
+
+// orphanSuggestion is the action proposed for an orphan, with the statements
+// to run through execute where there are any.
+func orphanSuggestion(o orphanEntity) string {
+	switch {
+	case o.mergeInto != "" && o.openUnknowns > 0:
+		return fmt.Sprintf("merge into '%s' (id %d, %d observations): UPDATE unknowns SET entity_id = %d WHERE entity_id = %d; DELETE FROM entities WHERE id = %d",
+			o.mergeInto, o.mergeIntoID, o.mergeIntoObservations, o.mergeIntoID, o.id, o.id)
+	case o.mergeInto != "":
+		return fmt.Sprintf("merge into '%s' (id %d, %d observations): DELETE FROM entities WHERE id = %d",
+			o.mergeInto, o.mergeIntoID, o.mergeIntoObservations, o.id)
+	case o.openUnknowns > 0:
+		return fmt.Sprintf("keep: %d open question(s), answer them with resolve", o.openUnknowns)
+	default:
+		return fmt.Sprintf("delete: DELETE FROM entities WHERE id = %d, or add observations if it is still relevant", o.id)
+	}
+}
+
+func formatOrphans(orphans []orphanEntity, limit int) string {
+	if len(orphans) == 0 {
+		return "no orphaned entities"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d entities with no observations and no relations:\n", len(orphans))
+	for _, o := range orphans[:min(limit, len(orphans))] {
+		fmt.Fprintf(&sb, "  %d %s (%s)\n    %s\n", o.id, o.name, o.entityType, orphanSuggestion(o))
+	}
+	if len(orphans) > limit {
+		fmt.Fprintf(&sb, "  ... and %d more\n", len(orphans)-limit)
+	}
+	return sb.String()
+}
+
+// registerFindOrphans adds the find_orphans tool.
+func registerFindOrphans(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("find_orphans",
+		mcp.WithDescription(`List entities with no observations and no relations, each with a suggested action: merge into an entity whose name looks like the same thing (e.g. 'Home Lab' and 'homelab'), keep it while it has open questions, or delete it.
+
+Suggestions are statements to run with execute; nothing is changed by this tool.`),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("How many orphans to list (default %d, max %d)", defaultOrphansLimit, maxOrphansLimit)),
+		),
+		mcp.WithBoolean("include_archived",
+			mcp.Description("Also list archived entities (default false)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), findOrphansHandler(db))
+}
+
+func findOrphansHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		limit := request.GetInt("limit", defaultOrphansLimit)
+		if limit < 1 || limit > maxOrphansLimit {
+			return toolErrorf(codeInvalidArgument, "limit must be between 1 and %d", maxOrphansLimit), nil
+		}
+		orphans, err := findOrphans(ctx, db, request.GetBool("include_archived", false))
+		if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "query error: %v", err), nil
+		}
+		return mcp.NewToolResultText(formatOrphans(orphans, limit)), nil
+	}
+}
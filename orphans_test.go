@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestMatchOrphan(t *testing.T) {
+	candidates := []mergeCandidate{
+		{id: 1, name: "homelab"}, {id: 2, name: "Raspberry Pi 4"}, {id: 3, name: "pi"}, {id: 4, name: "Acme Corporation"}, {id: 5, name: "Acme Corp"},
+	}
+	tests := []struct {
+		name   string
+		orphan string
+		want   int64
+	}{
+		{"case and spacing", "Home Lab", 1},
+		{"punctuation", "home-lab", 1},
+		{"short exact", "PI", 3},
+		{"short not contained", "ai", 0},
+		{"closest containing", "Acme", 5},
+		{"no match", "espresso", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchOrphan(tt.orphan, candidates)
+			if ok != (tt.want != 0) || got.id != tt.want {
+				t.Errorf("matchOrphan(%q) = %d %v, want %d", tt.orphan, got.id, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrphanSuggestion(t *testing.T) {
+	tests := []struct {
+		name   string
+		orphan orphanEntity
+		want   string
+	}{
+		{"delete", orphanEntity{id: 7}, "delete: DELETE FROM entities WHERE id = 7, or add observations if it is still relevant"},
+		{"keep", orphanEntity{id: 7, openUnknowns: 2}, "keep: 2 open question(s), answer them with resolve"},
+		{"merge", orphanEntity{id: 7, mergeInto: "homelab", mergeIntoID: 1, mergeIntoObservations: 12}, "merge into 'homelab' (id 1, 12 observations): DELETE FROM entities WHERE id = 7"},
+		{"merge with unknowns", orphanEntity{id: 7, openUnknowns: 1, mergeInto: "homelab", mergeIntoID: 1}, "merge into 'homelab' (id 1, 0 observations): UPDATE unknowns SET entity_id = 1 WHERE entity_id = 7; DELETE FROM entities WHERE id = 7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := orphanSuggestion(tt.orphan); got != tt.want {
+				t.Errorf("orphanSuggestion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindOrphans_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'orphans-test-%' OR name LIKE 'Orphans Test %'")
+	defer db.Exec("DELETE FROM observations WHERE content = 'orphans test observation'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('orphans-test-kept', 'Thing'), ('Orphans Test Kept', 'Thing'), ('orphans-test-lonely', 'Thing')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO observations (entity_id, content) SELECT id, 'orphans test observation' FROM entities WHERE name = 'orphans-test-kept'"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	result, err := callTool(findOrphansHandler(db), "find_orphans", map[string]any{"limit": maxOrphansLimit})
+	if err != nil || result.IsError {
+		t.Fatalf("find_orphans: %v %v", err, result.Content)
+	}
+	got := result.Content[0].(mcp.TextContent).Text
+	if strings.Contains(got, " orphans-test-kept (Thing)") {
+		t.Errorf("entity with an observation listed as orphan:\n%s", got)
+	}
+	if !strings.Contains(got, "Orphans Test Kept (Thing)\n    merge into 'orphans-test-kept'") {
+		t.Errorf("expected a merge suggestion for the respelled entity:\n%s", got)
+	}
+	if !strings.Contains(got, "orphans-test-lonely (Thing)\n    delete: DELETE FROM entities WHERE id = ") {
+		t.Errorf("expected a delete suggestion for the lonely entity:\n%s", got)
+	}
+
+	if result, _ := callTool(findOrphansHandler(db), "find_orphans", map[string]any{"limit": 0}); !result.IsError {
+		t.Errorf("expected limit 0 to be rejected")
+	}
+}
@@ -0,0 +1,1214 @@
+// Memory is the gRPC counterpart of the MCP tools, for services that do not
+// speak MCP. serve answers it on ENGRAM_GRPC_ADDR; each RPC calls the tool
+// it is named after, through the same middleware as MCP calls. Messages
+// mirror the tools' parameters and the JSON they return.
+//
+// After editing this file, regenerate the Go code next to it with
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//	  proto/engram/v1/memory.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: proto/engram/v1/memory.proto
+
+package engramv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Entity struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Name               string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	EntityType         string                 `protobuf:"bytes,2,opt,name=entity_type,json=entityType,proto3" json:"entity_type,omitempty"`
+	Observations       []string               `protobuf:"bytes,3,rep,name=observations,proto3" json:"observations,omitempty"`
+	ArchivedAt         string                 `protobuf:"bytes,4,opt,name=archived_at,json=archivedAt,proto3" json:"archived_at,omitempty"`
+	ObservationDetails []*Observation         `protobuf:"bytes,5,rep,name=observation_details,json=observationDetails,proto3" json:"observation_details,omitempty"`
+	Aliases            []string               `protobuf:"bytes,6,rep,name=aliases,proto3" json:"aliases,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Entity) Reset() {
+	*x = Entity{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Entity) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Entity) ProtoMessage() {}
+
+func (x *Entity) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Entity.ProtoReflect.Descriptor instead.
+func (*Entity) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Entity) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Entity) GetEntityType() string {
+	if x != nil {
+		return x.EntityType
+	}
+	return ""
+}
+
+func (x *Entity) GetObservations() []string {
+	if x != nil {
+		return x.Observations
+	}
+	return nil
+}
+
+func (x *Entity) GetArchivedAt() string {
+	if x != nil {
+		return x.ArchivedAt
+	}
+	return ""
+}
+
+func (x *Entity) GetObservationDetails() []*Observation {
+	if x != nil {
+		return x.ObservationDetails
+	}
+	return nil
+}
+
+func (x *Entity) GetAliases() []string {
+	if x != nil {
+		return x.Aliases
+	}
+	return nil
+}
+
+type Observation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// entity is set on observations returned by AddObservation.
+	Entity         string   `protobuf:"bytes,2,opt,name=entity,proto3" json:"entity,omitempty"`
+	Content        string   `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	Tags           []string `protobuf:"bytes,4,rep,name=tags,proto3" json:"tags,omitempty"`
+	Visibility     string   `protobuf:"bytes,5,opt,name=visibility,proto3" json:"visibility,omitempty"`
+	Confidence     *float64 `protobuf:"fixed64,6,opt,name=confidence,proto3,oneof" json:"confidence,omitempty"`
+	Source         string   `protobuf:"bytes,7,opt,name=source,proto3" json:"source,omitempty"`
+	ConversationId string   `protobuf:"bytes,8,opt,name=conversation_id,json=conversationId,proto3" json:"conversation_id,omitempty"`
+	SourceUrl      string   `protobuf:"bytes,9,opt,name=source_url,json=sourceUrl,proto3" json:"source_url,omitempty"`
+	// metadata is a JSON object, as stored.
+	Metadata      string `protobuf:"bytes,10,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	CreatedAt     string `protobuf:"bytes,11,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	VerifiedAt    string `protobuf:"bytes,12,opt,name=verified_at,json=verifiedAt,proto3" json:"verified_at,omitempty"`
+	VerifiedBy    string `protobuf:"bytes,13,opt,name=verified_by,json=verifiedBy,proto3" json:"verified_by,omitempty"`
+	ParentId      *int64 `protobuf:"varint,14,opt,name=parent_id,json=parentId,proto3,oneof" json:"parent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Observation) Reset() {
+	*x = Observation{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Observation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Observation) ProtoMessage() {}
+
+func (x *Observation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Observation.ProtoReflect.Descriptor instead.
+func (*Observation) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Observation) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Observation) GetEntity() string {
+	if x != nil {
+		return x.Entity
+	}
+	return ""
+}
+
+func (x *Observation) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Observation) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Observation) GetVisibility() string {
+	if x != nil {
+		return x.Visibility
+	}
+	return ""
+}
+
+func (x *Observation) GetConfidence() float64 {
+	if x != nil && x.Confidence != nil {
+		return *x.Confidence
+	}
+	return 0
+}
+
+func (x *Observation) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Observation) GetConversationId() string {
+	if x != nil {
+		return x.ConversationId
+	}
+	return ""
+}
+
+func (x *Observation) GetSourceUrl() string {
+	if x != nil {
+		return x.SourceUrl
+	}
+	return ""
+}
+
+func (x *Observation) GetMetadata() string {
+	if x != nil {
+		return x.Metadata
+	}
+	return ""
+}
+
+func (x *Observation) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *Observation) GetVerifiedAt() string {
+	if x != nil {
+		return x.VerifiedAt
+	}
+	return ""
+}
+
+func (x *Observation) GetVerifiedBy() string {
+	if x != nil {
+		return x.VerifiedBy
+	}
+	return ""
+}
+
+func (x *Observation) GetParentId() int64 {
+	if x != nil && x.ParentId != nil {
+		return *x.ParentId
+	}
+	return 0
+}
+
+type Relation struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	From         string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To           string                 `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	RelationType string                 `protobuf:"bytes,3,opt,name=relation_type,json=relationType,proto3" json:"relation_type,omitempty"`
+	Weight       *float64               `protobuf:"fixed64,4,opt,name=weight,proto3,oneof" json:"weight,omitempty"`
+	// properties is a JSON object, as stored.
+	Properties string `protobuf:"bytes,5,opt,name=properties,proto3" json:"properties,omitempty"`
+	// implied marks the inverse of a relation stored in the other direction.
+	Implied       bool `protobuf:"varint,6,opt,name=implied,proto3" json:"implied,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Relation) Reset() {
+	*x = Relation{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Relation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Relation) ProtoMessage() {}
+
+func (x *Relation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Relation.ProtoReflect.Descriptor instead.
+func (*Relation) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Relation) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Relation) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *Relation) GetRelationType() string {
+	if x != nil {
+		return x.RelationType
+	}
+	return ""
+}
+
+func (x *Relation) GetWeight() float64 {
+	if x != nil && x.Weight != nil {
+		return *x.Weight
+	}
+	return 0
+}
+
+func (x *Relation) GetProperties() string {
+	if x != nil {
+		return x.Properties
+	}
+	return ""
+}
+
+func (x *Relation) GetImplied() bool {
+	if x != nil {
+		return x.Implied
+	}
+	return false
+}
+
+type Graph struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Entities  []*Entity              `protobuf:"bytes,1,rep,name=entities,proto3" json:"entities,omitempty"`
+	Relations []*Relation            `protobuf:"bytes,2,rep,name=relations,proto3" json:"relations,omitempty"`
+	// next_offset is the offset of ReadGraph's next page, 0 on the last.
+	NextOffset int32 `protobuf:"varint,3,opt,name=next_offset,json=nextOffset,proto3" json:"next_offset,omitempty"`
+	// not_found lists the names OpenNodes found no entity for.
+	NotFound      []string `protobuf:"bytes,4,rep,name=not_found,json=notFound,proto3" json:"not_found,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Graph) Reset() {
+	*x = Graph{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Graph) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Graph) ProtoMessage() {}
+
+func (x *Graph) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Graph.ProtoReflect.Descriptor instead.
+func (*Graph) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Graph) GetEntities() []*Entity {
+	if x != nil {
+		return x.Entities
+	}
+	return nil
+}
+
+func (x *Graph) GetRelations() []*Relation {
+	if x != nil {
+		return x.Relations
+	}
+	return nil
+}
+
+func (x *Graph) GetNextOffset() int32 {
+	if x != nil {
+		return x.NextOffset
+	}
+	return 0
+}
+
+func (x *Graph) GetNotFound() []string {
+	if x != nil {
+		return x.NotFound
+	}
+	return nil
+}
+
+type SearchNodesRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Query           string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	IncludeArchived bool                   `protobuf:"varint,2,opt,name=include_archived,json=includeArchived,proto3" json:"include_archived,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *SearchNodesRequest) Reset() {
+	*x = SearchNodesRequest{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchNodesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchNodesRequest) ProtoMessage() {}
+
+func (x *SearchNodesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchNodesRequest.ProtoReflect.Descriptor instead.
+func (*SearchNodesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SearchNodesRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchNodesRequest) GetIncludeArchived() bool {
+	if x != nil {
+		return x.IncludeArchived
+	}
+	return false
+}
+
+type OpenNodesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Names         []string               `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpenNodesRequest) Reset() {
+	*x = OpenNodesRequest{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpenNodesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpenNodesRequest) ProtoMessage() {}
+
+func (x *OpenNodesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpenNodesRequest.ProtoReflect.Descriptor instead.
+func (*OpenNodesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *OpenNodesRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+type ReadGraphRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Limit      int32                  `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset     int32                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	EntityType string                 `protobuf:"bytes,3,opt,name=entity_type,json=entityType,proto3" json:"entity_type,omitempty"`
+	// tags is comma-separated, as for the tool.
+	Tags            string `protobuf:"bytes,4,opt,name=tags,proto3" json:"tags,omitempty"`
+	IncludeArchived bool   `protobuf:"varint,5,opt,name=include_archived,json=includeArchived,proto3" json:"include_archived,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ReadGraphRequest) Reset() {
+	*x = ReadGraphRequest{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadGraphRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadGraphRequest) ProtoMessage() {}
+
+func (x *ReadGraphRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadGraphRequest.ProtoReflect.Descriptor instead.
+func (*ReadGraphRequest) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReadGraphRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ReadGraphRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *ReadGraphRequest) GetEntityType() string {
+	if x != nil {
+		return x.EntityType
+	}
+	return ""
+}
+
+func (x *ReadGraphRequest) GetTags() string {
+	if x != nil {
+		return x.Tags
+	}
+	return ""
+}
+
+func (x *ReadGraphRequest) GetIncludeArchived() bool {
+	if x != nil {
+		return x.IncludeArchived
+	}
+	return false
+}
+
+type AddObservationRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Entity  string                 `protobuf:"bytes,1,opt,name=entity,proto3" json:"entity,omitempty"`
+	Content string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	// tags is comma-separated; required while ENGRAM_TAG_POLICY covers
+	// observations.
+	Tags       string   `protobuf:"bytes,3,opt,name=tags,proto3" json:"tags,omitempty"`
+	Visibility string   `protobuf:"bytes,4,opt,name=visibility,proto3" json:"visibility,omitempty"`
+	Source     string   `protobuf:"bytes,5,opt,name=source,proto3" json:"source,omitempty"`
+	Confidence *float64 `protobuf:"fixed64,6,opt,name=confidence,proto3,oneof" json:"confidence,omitempty"`
+	// metadata is a JSON object.
+	Metadata       string `protobuf:"bytes,7,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	ConversationId string `protobuf:"bytes,8,opt,name=conversation_id,json=conversationId,proto3" json:"conversation_id,omitempty"`
+	SourceUrl      string `protobuf:"bytes,9,opt,name=source_url,json=sourceUrl,proto3" json:"source_url,omitempty"`
+	// parent is the id or cite (obs:12) of the observation this one follows
+	// up.
+	Parent        string `protobuf:"bytes,10,opt,name=parent,proto3" json:"parent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddObservationRequest) Reset() {
+	*x = AddObservationRequest{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddObservationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddObservationRequest) ProtoMessage() {}
+
+func (x *AddObservationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddObservationRequest.ProtoReflect.Descriptor instead.
+func (*AddObservationRequest) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AddObservationRequest) GetEntity() string {
+	if x != nil {
+		return x.Entity
+	}
+	return ""
+}
+
+func (x *AddObservationRequest) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *AddObservationRequest) GetTags() string {
+	if x != nil {
+		return x.Tags
+	}
+	return ""
+}
+
+func (x *AddObservationRequest) GetVisibility() string {
+	if x != nil {
+		return x.Visibility
+	}
+	return ""
+}
+
+func (x *AddObservationRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *AddObservationRequest) GetConfidence() float64 {
+	if x != nil && x.Confidence != nil {
+		return *x.Confidence
+	}
+	return 0
+}
+
+func (x *AddObservationRequest) GetMetadata() string {
+	if x != nil {
+		return x.Metadata
+	}
+	return ""
+}
+
+func (x *AddObservationRequest) GetConversationId() string {
+	if x != nil {
+		return x.ConversationId
+	}
+	return ""
+}
+
+func (x *AddObservationRequest) GetSourceUrl() string {
+	if x != nil {
+		return x.SourceUrl
+	}
+	return ""
+}
+
+func (x *AddObservationRequest) GetParent() string {
+	if x != nil {
+		return x.Parent
+	}
+	return ""
+}
+
+type AddObservationResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Observations  []*Observation         `protobuf:"bytes,1,rep,name=observations,proto3" json:"observations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddObservationResponse) Reset() {
+	*x = AddObservationResponse{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddObservationResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddObservationResponse) ProtoMessage() {}
+
+func (x *AddObservationResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddObservationResponse.ProtoReflect.Descriptor instead.
+func (*AddObservationResponse) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AddObservationResponse) GetObservations() []*Observation {
+	if x != nil {
+		return x.Observations
+	}
+	return nil
+}
+
+type UpsertEntityRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Name       string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	EntityType string                 `protobuf:"bytes,2,opt,name=entity_type,json=entityType,proto3" json:"entity_type,omitempty"`
+	// on_conflict is 'ignore' (default), 'update' or 'error'.
+	OnConflict string `protobuf:"bytes,3,opt,name=on_conflict,json=onConflict,proto3" json:"on_conflict,omitempty"`
+	Tags       string `protobuf:"bytes,4,opt,name=tags,proto3" json:"tags,omitempty"`
+	// attributes is a JSON object of attribute values.
+	Attributes    string `protobuf:"bytes,5,opt,name=attributes,proto3" json:"attributes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpsertEntityRequest) Reset() {
+	*x = UpsertEntityRequest{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpsertEntityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpsertEntityRequest) ProtoMessage() {}
+
+func (x *UpsertEntityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpsertEntityRequest.ProtoReflect.Descriptor instead.
+func (*UpsertEntityRequest) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *UpsertEntityRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UpsertEntityRequest) GetEntityType() string {
+	if x != nil {
+		return x.EntityType
+	}
+	return ""
+}
+
+func (x *UpsertEntityRequest) GetOnConflict() string {
+	if x != nil {
+		return x.OnConflict
+	}
+	return ""
+}
+
+func (x *UpsertEntityRequest) GetTags() string {
+	if x != nil {
+		return x.Tags
+	}
+	return ""
+}
+
+func (x *UpsertEntityRequest) GetAttributes() string {
+	if x != nil {
+		return x.Attributes
+	}
+	return ""
+}
+
+type UpsertEntityResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	EntityType    string                 `protobuf:"bytes,3,opt,name=entity_type,json=entityType,proto3" json:"entity_type,omitempty"`
+	Tags          []string               `protobuf:"bytes,4,rep,name=tags,proto3" json:"tags,omitempty"`
+	Created       bool                   `protobuf:"varint,5,opt,name=created,proto3" json:"created,omitempty"`
+	CreatedAt     string                 `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpsertEntityResponse) Reset() {
+	*x = UpsertEntityResponse{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpsertEntityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpsertEntityResponse) ProtoMessage() {}
+
+func (x *UpsertEntityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpsertEntityResponse.ProtoReflect.Descriptor instead.
+func (*UpsertEntityResponse) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UpsertEntityResponse) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpsertEntityResponse) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UpsertEntityResponse) GetEntityType() string {
+	if x != nil {
+		return x.EntityType
+	}
+	return ""
+}
+
+func (x *UpsertEntityResponse) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *UpsertEntityResponse) GetCreated() bool {
+	if x != nil {
+		return x.Created
+	}
+	return false
+}
+
+func (x *UpsertEntityResponse) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+type CreateRelationsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Relations     []*Relation            `protobuf:"bytes,1,rep,name=relations,proto3" json:"relations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRelationsRequest) Reset() {
+	*x = CreateRelationsRequest{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRelationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRelationsRequest) ProtoMessage() {}
+
+func (x *CreateRelationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRelationsRequest.ProtoReflect.Descriptor instead.
+func (*CreateRelationsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CreateRelationsRequest) GetRelations() []*Relation {
+	if x != nil {
+		return x.Relations
+	}
+	return nil
+}
+
+type CreateRelationsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// relations are the ones created, with inverses added for them; relations
+	// that already existed are left out.
+	Relations     []*Relation `protobuf:"bytes,1,rep,name=relations,proto3" json:"relations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRelationsResponse) Reset() {
+	*x = CreateRelationsResponse{}
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRelationsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRelationsResponse) ProtoMessage() {}
+
+func (x *CreateRelationsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_engram_v1_memory_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRelationsResponse.ProtoReflect.Descriptor instead.
+func (*CreateRelationsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_engram_v1_memory_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CreateRelationsResponse) GetRelations() []*Relation {
+	if x != nil {
+		return x.Relations
+	}
+	return nil
+}
+
+var File_proto_engram_v1_memory_proto protoreflect.FileDescriptor
+
+const file_proto_engram_v1_memory_proto_rawDesc = "" +
+	"\n" +
+	"\x1cproto/engram/v1/memory.proto\x12\tengram.v1\"\xe5\x01\n" +
+	"\x06Entity\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1f\n" +
+	"\ventity_type\x18\x02 \x01(\tR\n" +
+	"entityType\x12\"\n" +
+	"\fobservations\x18\x03 \x03(\tR\fobservations\x12\x1f\n" +
+	"\varchived_at\x18\x04 \x01(\tR\n" +
+	"archivedAt\x12G\n" +
+	"\x13observation_details\x18\x05 \x03(\v2\x16.engram.v1.ObservationR\x12observationDetails\x12\x18\n" +
+	"\aaliases\x18\x06 \x03(\tR\aaliases\"\xc4\x03\n" +
+	"\vObservation\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x16\n" +
+	"\x06entity\x18\x02 \x01(\tR\x06entity\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12\x12\n" +
+	"\x04tags\x18\x04 \x03(\tR\x04tags\x12\x1e\n" +
+	"\n" +
+	"visibility\x18\x05 \x01(\tR\n" +
+	"visibility\x12#\n" +
+	"\n" +
+	"confidence\x18\x06 \x01(\x01H\x00R\n" +
+	"confidence\x88\x01\x01\x12\x16\n" +
+	"\x06source\x18\a \x01(\tR\x06source\x12'\n" +
+	"\x0fconversation_id\x18\b \x01(\tR\x0econversationId\x12\x1d\n" +
+	"\n" +
+	"source_url\x18\t \x01(\tR\tsourceUrl\x12\x1a\n" +
+	"\bmetadata\x18\n" +
+	" \x01(\tR\bmetadata\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\v \x01(\tR\tcreatedAt\x12\x1f\n" +
+	"\vverified_at\x18\f \x01(\tR\n" +
+	"verifiedAt\x12\x1f\n" +
+	"\vverified_by\x18\r \x01(\tR\n" +
+	"verifiedBy\x12 \n" +
+	"\tparent_id\x18\x0e \x01(\x03H\x01R\bparentId\x88\x01\x01B\r\n" +
+	"\v_confidenceB\f\n" +
+	"\n" +
+	"_parent_id\"\xb5\x01\n" +
+	"\bRelation\x12\x12\n" +
+	"\x04from\x18\x01 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x02 \x01(\tR\x02to\x12#\n" +
+	"\rrelation_type\x18\x03 \x01(\tR\frelationType\x12\x1b\n" +
+	"\x06weight\x18\x04 \x01(\x01H\x00R\x06weight\x88\x01\x01\x12\x1e\n" +
+	"\n" +
+	"properties\x18\x05 \x01(\tR\n" +
+	"properties\x12\x18\n" +
+	"\aimplied\x18\x06 \x01(\bR\aimpliedB\t\n" +
+	"\a_weight\"\xa7\x01\n" +
+	"\x05Graph\x12-\n" +
+	"\bentities\x18\x01 \x03(\v2\x11.engram.v1.EntityR\bentities\x121\n" +
+	"\trelations\x18\x02 \x03(\v2\x13.engram.v1.RelationR\trelations\x12\x1f\n" +
+	"\vnext_offset\x18\x03 \x01(\x05R\n" +
+	"nextOffset\x12\x1b\n" +
+	"\tnot_found\x18\x04 \x03(\tR\bnotFound\"U\n" +
+	"\x12SearchNodesRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12)\n" +
+	"\x10include_archived\x18\x02 \x01(\bR\x0fincludeArchived\"(\n" +
+	"\x10OpenNodesRequest\x12\x14\n" +
+	"\x05names\x18\x01 \x03(\tR\x05names\"\xa0\x01\n" +
+	"\x10ReadGraphRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x05R\x06offset\x12\x1f\n" +
+	"\ventity_type\x18\x03 \x01(\tR\n" +
+	"entityType\x12\x12\n" +
+	"\x04tags\x18\x04 \x01(\tR\x04tags\x12)\n" +
+	"\x10include_archived\x18\x05 \x01(\bR\x0fincludeArchived\"\xc5\x02\n" +
+	"\x15AddObservationRequest\x12\x16\n" +
+	"\x06entity\x18\x01 \x01(\tR\x06entity\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x12\n" +
+	"\x04tags\x18\x03 \x01(\tR\x04tags\x12\x1e\n" +
+	"\n" +
+	"visibility\x18\x04 \x01(\tR\n" +
+	"visibility\x12\x16\n" +
+	"\x06source\x18\x05 \x01(\tR\x06source\x12#\n" +
+	"\n" +
+	"confidence\x18\x06 \x01(\x01H\x00R\n" +
+	"confidence\x88\x01\x01\x12\x1a\n" +
+	"\bmetadata\x18\a \x01(\tR\bmetadata\x12'\n" +
+	"\x0fconversation_id\x18\b \x01(\tR\x0econversationId\x12\x1d\n" +
+	"\n" +
+	"source_url\x18\t \x01(\tR\tsourceUrl\x12\x16\n" +
+	"\x06parent\x18\n" +
+	" \x01(\tR\x06parentB\r\n" +
+	"\v_confidence\"T\n" +
+	"\x16AddObservationResponse\x12:\n" +
+	"\fobservations\x18\x01 \x03(\v2\x16.engram.v1.ObservationR\fobservations\"\x9f\x01\n" +
+	"\x13UpsertEntityRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1f\n" +
+	"\ventity_type\x18\x02 \x01(\tR\n" +
+	"entityType\x12\x1f\n" +
+	"\von_conflict\x18\x03 \x01(\tR\n" +
+	"onConflict\x12\x12\n" +
+	"\x04tags\x18\x04 \x01(\tR\x04tags\x12\x1e\n" +
+	"\n" +
+	"attributes\x18\x05 \x01(\tR\n" +
+	"attributes\"\xa8\x01\n" +
+	"\x14UpsertEntityResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1f\n" +
+	"\ventity_type\x18\x03 \x01(\tR\n" +
+	"entityType\x12\x12\n" +
+	"\x04tags\x18\x04 \x03(\tR\x04tags\x12\x18\n" +
+	"\acreated\x18\x05 \x01(\bR\acreated\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\tR\tcreatedAt\"K\n" +
+	"\x16CreateRelationsRequest\x121\n" +
+	"\trelations\x18\x01 \x03(\v2\x13.engram.v1.RelationR\trelations\"L\n" +
+	"\x17CreateRelationsResponse\x121\n" +
+	"\trelations\x18\x01 \x03(\v2\x13.engram.v1.RelationR\trelations2\xc2\x03\n" +
+	"\x06Memory\x12>\n" +
+	"\vSearchNodes\x12\x1d.engram.v1.SearchNodesRequest\x1a\x10.engram.v1.Graph\x12:\n" +
+	"\tOpenNodes\x12\x1b.engram.v1.OpenNodesRequest\x1a\x10.engram.v1.Graph\x12:\n" +
+	"\tReadGraph\x12\x1b.engram.v1.ReadGraphRequest\x1a\x10.engram.v1.Graph\x12U\n" +
+	"\x0eAddObservation\x12 .engram.v1.AddObservationRequest\x1a!.engram.v1.AddObservationResponse\x12O\n" +
+	"\fUpsertEntity\x12\x1e.engram.v1.UpsertEntityRequest\x1a\x1f.engram.v1.UpsertEntityResponse\x12X\n" +
+	"\x0fCreateRelations\x12!.engram.v1.CreateRelationsRequest\x1a\".engram.v1.CreateRelationsResponseB9Z7github.com/mrdvince/memory-mcp/proto/engram/v1;engramv1b\x06proto3"
+
+var (
+	file_proto_engram_v1_memory_proto_rawDescOnce sync.Once
+	file_proto_engram_v1_memory_proto_rawDescData []byte
+)
+
+func file_proto_engram_v1_memory_proto_rawDescGZIP() []byte {
+	file_proto_engram_v1_memory_proto_rawDescOnce.Do(func() {
+		file_proto_engram_v1_memory_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_engram_v1_memory_proto_rawDesc), len(file_proto_engram_v1_memory_proto_rawDesc)))
+	})
+	return file_proto_engram_v1_memory_proto_rawDescData
+}
+
+var file_proto_engram_v1_memory_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_proto_engram_v1_memory_proto_goTypes = []any{
+	(*Entity)(nil),                  // 0: engram.v1.Entity
+	(*Observation)(nil),             // 1: engram.v1.Observation
+	(*Relation)(nil),                // 2: engram.v1.Relation
+	(*Graph)(nil),                   // 3: engram.v1.Graph
+	(*SearchNodesRequest)(nil),      // 4: engram.v1.SearchNodesRequest
+	(*OpenNodesRequest)(nil),        // 5: engram.v1.OpenNodesRequest
+	(*ReadGraphRequest)(nil),        // 6: engram.v1.ReadGraphRequest
+	(*AddObservationRequest)(nil),   // 7: engram.v1.AddObservationRequest
+	(*AddObservationResponse)(nil),  // 8: engram.v1.AddObservationResponse
+	(*UpsertEntityRequest)(nil),     // 9: engram.v1.UpsertEntityRequest
+	(*UpsertEntityResponse)(nil),    // 10: engram.v1.UpsertEntityResponse
+	(*CreateRelationsRequest)(nil),  // 11: engram.v1.CreateRelationsRequest
+	(*CreateRelationsResponse)(nil), // 12: engram.v1.CreateRelationsResponse
+}
+var file_proto_engram_v1_memory_proto_depIdxs = []int32{
+	1,  // 0: engram.v1.Entity.observation_details:type_name -> engram.v1.Observation
+	0,  // 1: engram.v1.Graph.entities:type_name -> engram.v1.Entity
+	2,  // 2: engram.v1.Graph.relations:type_name -> engram.v1.Relation
+	1,  // 3: engram.v1.AddObservationResponse.observations:type_name -> engram.v1.Observation
+	2,  // 4: engram.v1.CreateRelationsRequest.relations:type_name -> engram.v1.Relation
+	2,  // 5: engram.v1.CreateRelationsResponse.relations:type_name -> engram.v1.Relation
+	4,  // 6: engram.v1.Memory.SearchNodes:input_type -> engram.v1.SearchNodesRequest
+	5,  // 7: engram.v1.Memory.OpenNodes:input_type -> engram.v1.OpenNodesRequest
+	6,  // 8: engram.v1.Memory.ReadGraph:input_type -> engram.v1.ReadGraphRequest
+	7,  // 9: engram.v1.Memory.AddObservation:input_type -> engram.v1.AddObservationRequest
+	9,  // 10: engram.v1.Memory.UpsertEntity:input_type -> engram.v1.UpsertEntityRequest
+	11, // 11: engram.v1.Memory.CreateRelations:input_type -> engram.v1.CreateRelationsRequest
+	3,  // 12: engram.v1.Memory.SearchNodes:output_type -> engram.v1.Graph
+	3,  // 13: engram.v1.Memory.OpenNodes:output_type -> engram.v1.Graph
+	3,  // 14: engram.v1.Memory.ReadGraph:output_type -> engram.v1.Graph
+	8,  // 15: engram.v1.Memory.AddObservation:output_type -> engram.v1.AddObservationResponse
+	10, // 16: engram.v1.Memory.UpsertEntity:output_type -> engram.v1.UpsertEntityResponse
+	12, // 17: engram.v1.Memory.CreateRelations:output_type -> engram.v1.CreateRelationsResponse
+	12, // [12:18] is the sub-list for method output_type
+	6,  // [6:12] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_proto_engram_v1_memory_proto_init() }
+func file_proto_engram_v1_memory_proto_init() {
+	if File_proto_engram_v1_memory_proto != nil {
+		return
+	}
+	file_proto_engram_v1_memory_proto_msgTypes[1].OneofWrappers = []any{}
+	file_proto_engram_v1_memory_proto_msgTypes[2].OneofWrappers = []any{}
+	file_proto_engram_v1_memory_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_engram_v1_memory_proto_rawDesc), len(file_proto_engram_v1_memory_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_engram_v1_memory_proto_goTypes,
+		DependencyIndexes: file_proto_engram_v1_memory_proto_depIdxs,
+		MessageInfos:      file_proto_engram_v1_memory_proto_msgTypes,
+	}.Build()
+	File_proto_engram_v1_memory_proto = out.File
+	file_proto_engram_v1_memory_proto_goTypes = nil
+	file_proto_engram_v1_memory_proto_depIdxs = nil
+}
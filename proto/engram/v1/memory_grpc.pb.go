@@ -0,0 +1,338 @@
+// Memory is the gRPC counterpart of the MCP tools, for services that do not
+// speak MCP. serve answers it on ENGRAM_GRPC_ADDR; each RPC calls the tool
+// it is named after, through the same middleware as MCP calls. Messages
+// mirror the tools' parameters and the JSON they return.
+//
+// After editing this file, regenerate the Go code next to it with
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//	  proto/engram/v1/memory.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proto/engram/v1/memory.proto
+
+package engramv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Memory_SearchNodes_FullMethodName     = "/engram.v1.Memory/SearchNodes"
+	Memory_OpenNodes_FullMethodName       = "/engram.v1.Memory/OpenNodes"
+	Memory_ReadGraph_FullMethodName       = "/engram.v1.Memory/ReadGraph"
+	Memory_AddObservation_FullMethodName  = "/engram.v1.Memory/AddObservation"
+	Memory_UpsertEntity_FullMethodName    = "/engram.v1.Memory/UpsertEntity"
+	Memory_CreateRelations_FullMethodName = "/engram.v1.Memory/CreateRelations"
+)
+
+// MemoryClient is the client API for Memory service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MemoryClient interface {
+	// SearchNodes is search_nodes: entities whose name, type or observations
+	// match the query, ignoring case and accents, with relations among them.
+	SearchNodes(ctx context.Context, in *SearchNodesRequest, opts ...grpc.CallOption) (*Graph, error)
+	// OpenNodes is open_nodes: the named entities with observation details.
+	OpenNodes(ctx context.Context, in *OpenNodesRequest, opts ...grpc.CallOption) (*Graph, error)
+	// ReadGraph is read_graph: a page of the graph, optionally filtered.
+	ReadGraph(ctx context.Context, in *ReadGraphRequest, opts ...grpc.CallOption) (*Graph, error)
+	// AddObservation is add_observation. Content over the size limit is
+	// stored in parts, so several observations may come back.
+	AddObservation(ctx context.Context, in *AddObservationRequest, opts ...grpc.CallOption) (*AddObservationResponse, error)
+	// UpsertEntity is upsert_entity.
+	UpsertEntity(ctx context.Context, in *UpsertEntityRequest, opts ...grpc.CallOption) (*UpsertEntityResponse, error)
+	// CreateRelations is create_relations.
+	CreateRelations(ctx context.Context, in *CreateRelationsRequest, opts ...grpc.CallOption) (*CreateRelationsResponse, error)
+}
+
+type memoryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMemoryClient(cc grpc.ClientConnInterface) MemoryClient {
+	return &memoryClient{cc}
+}
+
+func (c *memoryClient) SearchNodes(ctx context.Context, in *SearchNodesRequest, opts ...grpc.CallOption) (*Graph, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Graph)
+	err := c.cc.Invoke(ctx, Memory_SearchNodes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memoryClient) OpenNodes(ctx context.Context, in *OpenNodesRequest, opts ...grpc.CallOption) (*Graph, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Graph)
+	err := c.cc.Invoke(ctx, Memory_OpenNodes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memoryClient) ReadGraph(ctx context.Context, in *ReadGraphRequest, opts ...grpc.CallOption) (*Graph, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Graph)
+	err := c.cc.Invoke(ctx, Memory_ReadGraph_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memoryClient) AddObservation(ctx context.Context, in *AddObservationRequest, opts ...grpc.CallOption) (*AddObservationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddObservationResponse)
+	err := c.cc.Invoke(ctx, Memory_AddObservation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memoryClient) UpsertEntity(ctx context.Context, in *UpsertEntityRequest, opts ...grpc.CallOption) (*UpsertEntityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpsertEntityResponse)
+	err := c.cc.Invoke(ctx, Memory_UpsertEntity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memoryClient) CreateRelations(ctx context.Context, in *CreateRelationsRequest, opts ...grpc.CallOption) (*CreateRelationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateRelationsResponse)
+	err := c.cc.Invoke(ctx, Memory_CreateRelations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MemoryServer is the server API for Memory service.
+// All implementations must embed UnimplementedMemoryServer
+// for forward compatibility.
+type MemoryServer interface {
+	// SearchNodes is search_nodes: entities whose name, type or observations
+	// match the query, ignoring case and accents, with relations among them.
+	SearchNodes(context.Context, *SearchNodesRequest) (*Graph, error)
+	// OpenNodes is open_nodes: the named entities with observation details.
+	OpenNodes(context.Context, *OpenNodesRequest) (*Graph, error)
+	// ReadGraph is read_graph: a page of the graph, optionally filtered.
+	ReadGraph(context.Context, *ReadGraphRequest) (*Graph, error)
+	// AddObservation is add_observation. Content over the size limit is
+	// stored in parts, so several observations may come back.
+	AddObservation(context.Context, *AddObservationRequest) (*AddObservationResponse, error)
+	// UpsertEntity is upsert_entity.
+	UpsertEntity(context.Context, *UpsertEntityRequest) (*UpsertEntityResponse, error)
+	// CreateRelations is create_relations.
+	CreateRelations(context.Context, *CreateRelationsRequest) (*CreateRelationsResponse, error)
+	mustEmbedUnimplementedMemoryServer()
+}
+
+// UnimplementedMemoryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMemoryServer struct{}
+
+func (UnimplementedMemoryServer) SearchNodes(context.Context, *SearchNodesRequest) (*Graph, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchNodes not implemented")
+}
+func (UnimplementedMemoryServer) OpenNodes(context.Context, *OpenNodesRequest) (*Graph, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OpenNodes not implemented")
+}
+func (UnimplementedMemoryServer) ReadGraph(context.Context, *ReadGraphRequest) (*Graph, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadGraph not implemented")
+}
+func (UnimplementedMemoryServer) AddObservation(context.Context, *AddObservationRequest) (*AddObservationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddObservation not implemented")
+}
+func (UnimplementedMemoryServer) UpsertEntity(context.Context, *UpsertEntityRequest) (*UpsertEntityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpsertEntity not implemented")
+}
+func (UnimplementedMemoryServer) CreateRelations(context.Context, *CreateRelationsRequest) (*CreateRelationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRelations not implemented")
+}
+func (UnimplementedMemoryServer) mustEmbedUnimplementedMemoryServer() {}
+func (UnimplementedMemoryServer) testEmbeddedByValue()                {}
+
+// UnsafeMemoryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MemoryServer will
+// result in compilation errors.
+type UnsafeMemoryServer interface {
+	mustEmbedUnimplementedMemoryServer()
+}
+
+func RegisterMemoryServer(s grpc.ServiceRegistrar, srv MemoryServer) {
+	// If the following call pancis, it indicates UnimplementedMemoryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Memory_ServiceDesc, srv)
+}
+
+func _Memory_SearchNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchNodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemoryServer).SearchNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Memory_SearchNodes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemoryServer).SearchNodes(ctx, req.(*SearchNodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Memory_OpenNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OpenNodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemoryServer).OpenNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Memory_OpenNodes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemoryServer).OpenNodes(ctx, req.(*OpenNodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Memory_ReadGraph_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadGraphRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemoryServer).ReadGraph(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Memory_ReadGraph_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemoryServer).ReadGraph(ctx, req.(*ReadGraphRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Memory_AddObservation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddObservationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemoryServer).AddObservation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Memory_AddObservation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemoryServer).AddObservation(ctx, req.(*AddObservationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Memory_UpsertEntity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpsertEntityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemoryServer).UpsertEntity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Memory_UpsertEntity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemoryServer).UpsertEntity(ctx, req.(*UpsertEntityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Memory_CreateRelations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRelationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemoryServer).CreateRelations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Memory_CreateRelations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemoryServer).CreateRelations(ctx, req.(*CreateRelationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Memory_ServiceDesc is the grpc.ServiceDesc for Memory service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Memory_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "engram.v1.Memory",
+	HandlerType: (*MemoryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SearchNodes",
+			Handler:    _Memory_SearchNodes_Handler,
+		},
+		{
+			MethodName: "OpenNodes",
+			Handler:    _Memory_OpenNodes_Handler,
+		},
+		{
+			MethodName: "ReadGraph",
+			Handler:    _Memory_ReadGraph_Handler,
+		},
+		{
+			MethodName: "AddObservation",
+			Handler:    _Memory_AddObservation_Handler,
+		},
+		{
+			MethodName: "UpsertEntity",
+			Handler:    _Memory_UpsertEntity_Handler,
+		},
+		{
+			MethodName: "CreateRelations",
+			Handler:    _Memory_CreateRelations_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/engram/v1/memory.proto",
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// queryShapes counts the SQL agents send to the tools by statement shape:
+// the normalized statement with its values taken out, so "WHERE id = 1" and
+// "WHERE id = 2" count as one. Counts build up in memory and are added to
+// the query_shapes table periodically, so the hot path does no extra write.
+type queryShapes struct {
+	mu      sync.Mutex
+	pending map[shapeKey]*shapeStats
+}
+
+type shapeKey struct {
+	fingerprint, tool string
+}
+
+type shapeStats struct {
+	shape     string
+	calls     int
+	errors    int
+	totalMs   int64
+	totalRows int64
+}
+
+// shapeRowsKey carries the row count of the SQL tool call being recorded,
+// shared by the query shapes and the slow call log.
+type shapeRowsKey struct{}
+
+// withRowCount returns the row counter of the call ctx belongs to, adding
+// one when there is none yet.
+func withRowCount(ctx context.Context) (context.Context, *int) {
+	if rows, ok := ctx.Value(shapeRowsKey{}).(*int); ok {
+		return ctx, rows
+	}
+	rows := new(int)
+	return context.WithValue(ctx, shapeRowsKey{}, rows), rows
+}
+
+// noteRows records how many rows a SQL tool call returned or changed. It
+// does nothing outside a recorded call.
+func noteRows(ctx context.Context, n int) {
+	if rows, ok := ctx.Value(shapeRowsKey{}).(*int); ok {
+		*rows = n
+	}
+}
+
+func newQueryShapes() *queryShapes {
+	return &queryShapes{pending: make(map[shapeKey]*shapeStats)}
+}
+
+func (q *queryShapes) record(tool, query string, elapsed time.Duration, rows int, failed bool) {
+	shape := sqlShape(query)
+	if shape == "" {
+		return
+	}
+	key := shapeKey{sqlFingerprint(shape), tool}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := q.pending[key]
+	if st == nil {
+		st = &shapeStats{shape: shape}
+		q.pending[key] = st
+	}
+	st.calls++
+	if failed {
+		st.errors++
+	}
+	st.totalMs += elapsed.Milliseconds()
+	st.totalRows += int64(rows)
+}
+
+func (q *queryShapes) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query := request.GetString("sql", "")
+		if query == "" {
+			return next(ctx, request)
+		}
+		ctx, rows := withRowCount(ctx)
+		start := time.Now()
+		result, err := next(ctx, request)
+		q.record(request.Params.Name, query, time.Since(start), *rows, err != nil || result == nil || result.IsError)
+		return result, err
+	}
+}
+
+// flush adds the pending counts to query_shapes. Counts that fail to write
+// are kept for the next flush.
+func (q *queryShapes) flush(ctx context.Context, db *sql.DB) error {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = make(map[shapeKey]*shapeStats)
+	q.mu.Unlock()
+
+	for key, st := range pending {
+		_, err := db.ExecContext(ctx, `INSERT INTO query_shapes (fingerprint, tool, shape, calls, errors, total_ms, total_rows)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (fingerprint, tool) DO UPDATE SET
+				calls = calls + excluded.calls,
+				errors = errors + excluded.errors,
+				total_ms = total_ms + excluded.total_ms,
+				total_rows = total_rows + excluded.total_rows,
+				last_seen = CURRENT_TIMESTAMP`,
+			key.fingerprint, key.tool, st.shape, st.calls, st.errors, st.totalMs, st.totalRows)
+		if err != nil {
+			q.mu.Lock()
+			for key, st := range pending {
+				if cur := q.pending[key]; cur != nil {
+					st.calls += cur.calls
+					st.errors += cur.errors
+					st.totalMs += cur.totalMs
+					st.totalRows += cur.totalRows
+				}
+				q.pending[key] = st
+			}
+			q.mu.Unlock()
+			return fmt.Errorf("write query_shapes: %v", err)
+		}
+		delete(pending, key)
+	}
+	return nil
+}
+
+// flushPeriodically writes the counts every interval, and once more when ctx
+// is done so a shutdown does not lose them.
+func (q *queryShapes) flushPeriodically(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := q.flush(flushCtx, db); err != nil {
+				log.Printf("query shapes: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+		if err := q.flush(ctx, db); err != nil {
+			log.Printf("query shapes: %v", err)
+		}
+	}
+}
+
+// shapeOrders are the ways writeQueryShapes can rank shapes.
+var shapeOrders = map[string]string{
+	"calls":   "calls DESC",
+	"slowest": "total_ms * 1.0 / calls DESC",
+	"rows":    "total_rows * 1.0 / max(calls - errors, 1) DESC",
+}
+
+// writeQueryShapes reports the statement shapes with the most calls, the
+// slowest on average or those returning the most rows on average, laid out
+// with prettySQL.
+func writeQueryShapes(ctx context.Context, db *sql.DB, w io.Writer, tool, order string, limit int) error {
+	orderBy, ok := shapeOrders[order]
+	if !ok {
+		return fmt.Errorf("unknown sort %q, want calls, slowest or rows", order)
+	}
+	query := `SELECT fingerprint, tool, shape, calls, errors, total_ms, total_rows, last_seen FROM query_shapes`
+	var args []any
+	if tool != "" {
+		query += ` WHERE tool = ?`
+		args = append(args, tool)
+	}
+	query += ` ORDER BY ` + orderBy + `, last_seen DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var fingerprint, tool, shape, lastSeen string
+		var calls, errors int
+		var totalMs, totalRows int64
+		if err := rows.Scan(&fingerprint, &tool, &shape, &calls, &errors, &totalMs, &totalRows, &lastSeen); err != nil {
+			return err
+		}
+		if n > 0 {
+			fmt.Fprintln(w)
+		}
+		// Failed calls return no rows, so they are left out of the row average.
+		fmt.Fprintf(w, "%s  %s  %d call(s), %d error(s), avg %dms, avg %d row(s), last %s\n",
+			fingerprint, tool, calls, errors, totalMs/int64(max(calls, 1)), totalRows/int64(max(calls-errors, 1)), lastSeen)
+		for _, line := range strings.Split(prettySQL(shape), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if n == 0 {
+		fmt.Fprintln(w, "no queries recorded yet")
+	}
+	return nil
+}
+
+// registerQueryReport adds the query_report tool.
+func registerQueryReport(s *server.MCPServer, db *sql.DB, shapes *queryShapes) {
+	s.AddTool(mcp.NewTool("query_report",
+		mcp.WithDescription(`Report the statement shapes sent to query, execute and the other SQL tools: calls, errors, average time and average rows per shape, most called, slowest or largest first.
+
+A shape is a statement with its values replaced by ?, so queries differing only in values count together. Use it to find queries agents keep rewriting, which are candidates for a saved query or a dedicated tool, and slow shapes that need an index.`),
+		mcp.WithString("sort",
+			mcp.Description("'calls' (default), 'slowest' for the highest average time or 'rows' for the most rows per call"),
+			mcp.Enum("calls", "slowest", "rows"),
+		),
+		mcp.WithString("tool",
+			mcp.Description("Only shapes sent to this tool, e.g. 'query' or 'execute'"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum shapes to return (default 10, max 100)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), queryReportHandler(db, shapes))
+}
+
+func queryReportHandler(db *sql.DB, shapes *queryShapes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		order := request.GetString("sort", "calls")
+		if _, ok := shapeOrders[order]; !ok {
+			return toolError(codeInvalidArgument, "sort must be 'calls', 'slowest' or 'rows'"), nil
+		}
+		limit := request.GetInt("limit", 10)
+		if limit < 1 || limit > 100 {
+			return toolError(codeInvalidArgument, "limit must be between 1 and 100"), nil
+		}
+
+		// Include the calls since the last periodic flush.
+		if err := shapes.flush(ctx, db); err != nil {
+			return toolErrorFrom(err, codeDatabase), nil
+		}
+		var b strings.Builder
+		if err := writeQueryShapes(ctx, db, &b, request.GetString("tool", ""), order, limit); err != nil {
+			return toolErrorFrom(err, codeDatabase), nil
+		}
+		return mcp.NewToolResultText(b.String()), nil
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestQueryShapesFlush_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		db.Exec("DELETE FROM query_shapes WHERE tool = 'shapes_test'")
+	}
+	cleanup()
+	defer cleanup()
+
+	q := newQueryShapes()
+	q.record("shapes_test", "select id from tags where name = 'work'", 10*time.Millisecond, 1, false)
+	q.record("shapes_test", "SELECT id\nFROM tags -- by name\nWHERE name = 'travel'", 30*time.Millisecond, 0, true)
+	if err := q.flush(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	q.record("shapes_test", "SELECT id FROM tags WHERE name = :name", 20*time.Millisecond, 3, false)
+	if err := q.flush(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	var shape string
+	var calls, errors int
+	var totalMs, totalRows int64
+	err := db.QueryRow("SELECT shape, calls, errors, total_ms, total_rows FROM query_shapes WHERE tool = 'shapes_test'").Scan(&shape, &calls, &errors, &totalMs, &totalRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shape != "SELECT id FROM tags WHERE name = ?" || calls != 3 || errors != 1 || totalMs != 60 || totalRows != 4 {
+		t.Errorf("got %q, %d calls, %d errors, %dms, %d rows", shape, calls, errors, totalMs, totalRows)
+	}
+
+	var out bytes.Buffer
+	if err := writeQueryShapes(ctx, db, &out, "shapes_test", "calls", 5); err != nil {
+		t.Fatal(err)
+	}
+	if want := "3 call(s), 1 error(s), avg 20ms, avg 2 row(s)"; !strings.Contains(out.String(), want) {
+		t.Errorf("report = %q, want it to contain %q", out.String(), want)
+	}
+	if want := "    SELECT id\n    FROM tags\n    WHERE name = ?\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("report = %q, want it to contain %q", out.String(), want)
+	}
+}
+
+func TestQueryReport_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cleanup := func() {
+		db.Exec("DELETE FROM query_shapes WHERE tool = 'report_test'")
+	}
+	cleanup()
+	defer cleanup()
+
+	shapes := newQueryShapes()
+	for i := 0; i < 3; i++ {
+		shapes.record("report_test", "SELECT id FROM entities WHERE id = 1", time.Millisecond, 1, false)
+	}
+	shapes.record("report_test", "SELECT * FROM observations", 900*time.Millisecond, 5000, false)
+	handler := queryReportHandler(db, shapes)
+
+	tests := []struct {
+		sort  string
+		first string
+	}{
+		{"calls", "FROM entities"},
+		{"slowest", "FROM observations"},
+		{"rows", "FROM observations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			result, err := callTool(handler, "query_report", map[string]any{"sort": tt.sort, "tool": "report_test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := result.Content[0].(mcp.TextContent).Text
+			if result.IsError {
+				t.Fatalf("query_report: %s", text)
+			}
+			if i := strings.Index(text, "\n\n"); i < 0 || !strings.Contains(text[:i], tt.first) {
+				t.Errorf("want %q first, got %q", tt.first, text)
+			}
+		})
+	}
+
+	result, _ := callTool(handler, "query_report", map[string]any{"sort": "newest"})
+	if !result.IsError {
+		t.Error("want an error for an unknown sort")
+	}
+}
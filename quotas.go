@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// tagQuotasConfig is ENGRAM_TAG_QUOTAS: storage quotas per tag, as in
+// "homelab=50MB,career=5MB". Tags are the namespaces agents write into; the
+// observations a tag is on count against it, with their attachments.
+var tagQuotasConfig = getEnv("ENGRAM_TAG_QUOTAS", "")
+
+// tagQuotas maps lowercased tag names to their quota in bytes. serve
+// refuses to start when tagQuotasErr is set.
+var tagQuotas, tagQuotasErr = parseTagQuotas(tagQuotasConfig)
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseByteSize reads a size such as "512", "64KB" or "1.5GB"; units are
+// powers of 1024.
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, want e.g. 500KB or 50MB", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+func parseTagQuotas(s string) (map[string]int64, error) {
+	quotas := make(map[string]int64)
+	for _, entry := range parseTagNames(s) {
+		tag, size, ok := strings.Cut(entry, "=")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !ok || tag == "" {
+			return nil, fmt.Errorf("invalid quota %q, want tag=size", entry)
+		}
+		n, err := parseByteSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", tag, err)
+		}
+		if _, ok := quotas[tag]; ok {
+			return nil, fmt.Errorf("%s is listed twice", tag)
+		}
+		quotas[tag] = n
+	}
+	return quotas, nil
+}
+
+// tagStorage returns the bytes stored under each tag: the full content of
+// its observations plus their attachments. With names it covers only those
+// tags. An observation with several tags counts against each.
+func tagStorage(ctx context.Context, db queryer, names []string) (map[string]int64, error) {
+	filter, args := "", []any{}
+	if len(names) > 0 {
+		filter = "WHERE lower(t.name) IN (" + placeholders(len(names)) + ")"
+		for _, n := range names {
+			args = append(args, strings.ToLower(n))
+		}
+	}
+	rows, err := db.QueryContext(ctx, `SELECT t.name, COALESCE(sum(length(CAST(COALESCE(c.body, o.content) AS BLOB))
+			+ COALESCE((SELECT sum(a.size) FROM attachments a WHERE a.observation_id = o.id), 0)), 0)
+		FROM tags t JOIN observation_tags ot ON ot.tag_id = t.id JOIN observations o ON o.id = ot.observation_id
+		LEFT JOIN contents c ON c.sha256 = o.content_sha256
+		`+filter+` GROUP BY t.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usage := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var bytes int64
+		if err := rows.Scan(&name, &bytes); err != nil {
+			return nil, err
+		}
+		usage[strings.ToLower(name)] = bytes
+	}
+	return usage, rows.Err()
+}
+
+// observationTagIDs returns the ids of the tags on an observation.
+func observationTagIDs(ctx context.Context, db queryer, id int64) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, "SELECT tag_id FROM observation_tags WHERE observation_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var tagID int64
+		if err := rows.Scan(&tagID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, tagID)
+	}
+	return ids, rows.Err()
+}
+
+// checkTagQuotas rejects a write of size bytes under the tags tagIDs when it
+// would take one of them over its quota.
+func checkTagQuotas(ctx context.Context, db queryer, tagIDs []int64, size int) error {
+	if len(tagQuotas) == 0 || len(tagIDs) == 0 {
+		return nil
+	}
+	args := make([]any, len(tagIDs))
+	for i, id := range tagIDs {
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, "SELECT name FROM tags WHERE id IN ("+placeholders(len(tagIDs))+")", args...)
+	if err != nil {
+		return errorf(codeDatabase, "checking tag quotas: %v", err)
+	}
+	var limited []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return errorf(codeDatabase, "checking tag quotas: %v", err)
+		}
+		if _, ok := tagQuotas[strings.ToLower(name)]; ok {
+			limited = append(limited, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(limited) == 0 {
+		return err
+	}
+
+	usage, err := tagStorage(ctx, db, limited)
+	if err != nil {
+		return errorf(codeDatabase, "checking tag quotas: %v", err)
+	}
+	sort.Strings(limited)
+	for _, name := range limited {
+		used, quota := usage[strings.ToLower(name)], tagQuotas[strings.ToLower(name)]
+		if used+int64(size) > quota {
+			return errorf(codeQuotaExceeded, "tag %s is over its storage quota: %d of %d bytes used, and this write adds %d (ENGRAM_TAG_QUOTAS). Nothing was stored. Delete or compact old %s observations, or ask the operator to raise the quota",
+				name, used, quota, size, name)
+		}
+	}
+	return nil
+}
+
+// registerTagUsage adds the tag_usage tool.
+func registerTagUsage(s *server.MCPServer, db *sql.DB, metrics *resultMetrics) {
+	s.AddTool(mcp.NewTool("tag_usage",
+		mcp.WithDescription(`Report the bytes stored under each tag against its quota in ENGRAM_TAG_QUOTAS, and the request and response bytes of tool calls that named the tag since the server started.
+
+Tags act as namespaces on a shared instance: writes that would take a tag over its quota are rejected. Use it to see which project's agent is using the space, and how close each tag is to its limit.`),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), tagUsageHandler(db, metrics))
+}
+
+func tagUsageHandler(db *sql.DB, metrics *resultMetrics) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		usage, err := tagStorage(ctx, db, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "query error: %v", err), nil
+		}
+		traffic := metrics.tagTraffic()
+
+		seen := make(map[string]bool)
+		var names []string
+		for _, m := range []map[string]int64{usage, tagQuotas} {
+			for name := range m {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		for name := range traffic {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return mcp.NewToolResultText("no tagged observations yet"), nil
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if usage[names[i]] != usage[names[j]] {
+				return usage[names[i]] > usage[names[j]]
+			}
+			return names[i] < names[j]
+		})
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%-16s %12s %12s %6s %6s %12s %12s\n", "tag", "stored", "quota", "used", "calls", "request", "response")
+		for _, name := range names {
+			quota, used := "-", "-"
+			if q, ok := tagQuotas[name]; ok {
+				quota = strconv.FormatInt(q, 10)
+				if q > 0 {
+					used = fmt.Sprintf("%d%%", usage[name]*100/q)
+				}
+			}
+			t := traffic[name]
+			fmt.Fprintf(&sb, "%-16s %12d %12s %6s %6d %12d %12d\n", name, usage[name], quota, used, t.calls, t.request, t.response)
+		}
+		fmt.Fprintln(&sb, "\nstored and quota in bytes; calls, request and response count tool calls naming the tag in their tags argument since the server started")
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseTagQuotas(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]int64
+		wantErr bool
+	}{
+		{"", map[string]int64{}, false},
+		{"homelab=50MB, Career=5kb", map[string]int64{"homelab": 50 << 20, "career": 5 << 10}, false},
+		{"drinks=1.5GB,personal=512", map[string]int64{"drinks": 3 << 29, "personal": 512}, false},
+		{"homelab=0B", map[string]int64{"homelab": 0}, false},
+		{"homelab", nil, true},
+		{"=5MB", nil, true},
+		{"homelab=lots", nil, true},
+		{"homelab=-1MB", nil, true},
+		{"homelab=1MB,HOMELAB=2MB", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTagQuotas(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTagQuotas(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTagQuotas(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTagQuotas_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer func(q map[string]int64) { tagQuotas = q }(tagQuotas)
+
+	defer db.Exec("DELETE FROM entities WHERE name = 'Quota test'")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Quota test')")
+	defer db.Exec("DELETE FROM attachments WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Quota test')")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Quota test')")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('Quota test', 'Test')"); err != nil {
+		t.Fatalf("insert entity: %v", err)
+	}
+
+	ctx := context.Background()
+	usage, err := tagStorage(ctx, db, []string{"drinks"})
+	if err != nil {
+		t.Fatalf("tagStorage: %v", err)
+	}
+	tagQuotas = map[string]int64{"drinks": usage["drinks"] + 100}
+
+	add := addObservationHandler(db, nil)
+	result, err := callTool(add, "add_observation", map[string]any{
+		"entity": "Quota test", "content": strings.Repeat("a", 60), "tags": "drinks,homelab"})
+	if err != nil || result.IsError {
+		t.Fatalf("write under quota failed: %v %v", err, result.Content)
+	}
+
+	result, _ = callTool(add, "add_observation", map[string]any{
+		"entity": "Quota test", "content": strings.Repeat("b", 60), "tags": "homelab,drinks"})
+	if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "tag drinks is over its storage quota") {
+		t.Errorf("write over quota: %s", result.Content[0].(mcp.TextContent).Text)
+	}
+	result, _ = callTool(add, "add_observation", map[string]any{
+		"entity": "Quota test", "content": strings.Repeat("c", 60), "tags": "homelab"})
+	if result.IsError {
+		t.Errorf("write to a tag without a quota was rejected: %s", result.Content[0].(mcp.TextContent).Text)
+	}
+
+	var observationID int64
+	if err := db.QueryRow("SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Quota test' AND o.content LIKE 'a%'").Scan(&observationID); err != nil {
+		t.Fatalf("find observation: %v", err)
+	}
+	result, _ = callTool(attachHandler(db), "attach", map[string]any{
+		"observation_id": float64(observationID), "name": "big.txt", "text": strings.Repeat("x", 50)})
+	if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "ENGRAM_TAG_QUOTAS") {
+		t.Errorf("attachment over quota: %s", result.Content[0].(mcp.TextContent).Text)
+	}
+
+	metrics := newResultMetrics()
+	metrics.recordTags([]string{"drinks"}, 30, 400)
+	result, err = callTool(tagUsageHandler(db, metrics), "tag_usage", map[string]any{})
+	if err != nil || result.IsError {
+		t.Fatalf("tag_usage failed: %v %v", err, result.Content)
+	}
+	var line string
+	for _, l := range strings.Split(result.Content[0].(mcp.TextContent).Text, "\n") {
+		if strings.HasPrefix(l, "drinks ") {
+			line = l
+		}
+	}
+	if fields := strings.Fields(line); len(fields) != 7 || fields[1] != strconv.FormatInt(usage["drinks"]+60, 10) || fields[2] != strconv.FormatInt(usage["drinks"]+100, 10) || fields[5] != "30" || fields[6] != "400" {
+		t.Errorf("drinks usage line = %q", line)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// recallSnapshots makes ask_memory keep a snapshot of every answer. Without
+// it, the snapshot parameter asks for one per call.
+var recallSnapshots = getEnv("ENGRAM_RECALL_SNAPSHOTS", "") == "true"
+
+// snapshotCitation is the id ask_memory reports for a snapshot it kept.
+func snapshotCitation(id int64) string { return fmt.Sprintf("snap:%d", id) }
+
+// parseSnapshotID reads a snapshot id given as "snap:12" or a bare number.
+func parseSnapshotID(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	id, err := strconv.ParseInt(strings.TrimPrefix(s, "snap:"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid snapshot id %q, want one ask_memory returned such as snap:12", s)
+	}
+	return id, nil
+}
+
+// saveRecallSnapshot keeps the passages result returns, in their order and
+// with their text as shown, with the visibility levels they were recalled
+// under, and returns the snapshot's id.
+func saveRecallSnapshot(ctx context.Context, db *sql.DB, client string, levels []string, result askResult) (int64, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.ExecContext(ctx, `INSERT INTO recall_snapshots (question, client, levels, result) VALUES (?, NULLIF(?, ''), ?, ?)`,
+		result.Question, client, strings.Join(levels, ","), string(data))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// recallSnapshot is a kept ask_memory answer, with what has happened to its
+// passages since.
+type recallSnapshot struct {
+	Snapshot  string    `json:"snapshot"`
+	CreatedAt string    `json:"createdAt"`
+	Client    string    `json:"client,omitempty"`
+	Question  string    `json:"question"`
+	Summary   string    `json:"summary,omitempty"`
+	Passages  []passage `json:"passages"`
+	Notes     []string  `json:"notes,omitempty"`
+	Since     []string  `json:"since,omitempty"`
+}
+
+// loadRecallSnapshot reads snapshot id. Snapshots taken under visibility
+// levels the caller lacks read as missing, as their passages would.
+func loadRecallSnapshot(ctx context.Context, db *sql.DB, levels []string, id int64) (*recallSnapshot, error) {
+	var createdAt any
+	var client sql.NullString
+	var taken, data string
+	err := db.QueryRowContext(ctx, `SELECT created_at, client, levels, result FROM recall_snapshots WHERE id = ?`, id).
+		Scan(&createdAt, &client, &taken, &data)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range strings.Split(taken, ",") {
+		if l != "" && !slices.Contains(levels, l) {
+			return nil, sql.ErrNoRows
+		}
+	}
+	var result askResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return nil, fmt.Errorf("snapshot %d is corrupt: %v", id, err)
+	}
+	snap := &recallSnapshot{
+		Snapshot:  snapshotCitation(id),
+		CreatedAt: formatValue(createdAt),
+		Client:    client.String,
+		Question:  result.Question,
+		Summary:   result.Summary,
+		Passages:  result.Passages,
+		Notes:     result.Notes,
+	}
+	if snap.Since, err = passageChanges(ctx, db, result.Passages); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// passageChanges reports the passages whose observation has since been
+// deleted, archived by compaction or edited.
+func passageChanges(ctx context.Context, db *sql.DB, passages []passage) ([]string, error) {
+	if len(passages) == 0 {
+		return nil, nil
+	}
+	args := make([]any, 0, len(passages))
+	for _, p := range passages {
+		id, err := parseCitation(p.Cite)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, id)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, content, 'observations' FROM observations WHERE id IN (`+placeholders(len(args))+`)
+		UNION ALL SELECT id, content, 'archived_observations' FROM archived_observations WHERE id IN (`+placeholders(len(args))+`)`,
+		append(args, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type current struct {
+		content  string
+		archived bool
+	}
+	now := make(map[string]current)
+	for rows.Next() {
+		var id int64
+		var content, table string
+		if err := rows.Scan(&id, &content, &table); err != nil {
+			return nil, err
+		}
+		now[citation(id)] = current{content, table == "archived_observations"}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	for _, p := range passages {
+		c, ok := now[p.Cite]
+		switch {
+		case !ok:
+			changes = append(changes, p.Cite+" has been deleted")
+		case c.archived:
+			changes = append(changes, p.Cite+" has been folded into a summary by compaction")
+		case c.content != p.Content:
+			changes = append(changes, p.Cite+" has been edited; the passage is the text as it was shown")
+		}
+	}
+	return changes, nil
+}
+
+// registerRecallSnapshots adds the get_recall_snapshot tool.
+func registerRecallSnapshots(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("get_recall_snapshot",
+		mcp.WithDescription(`Show exactly what an ask_memory call returned: the passages in their ranking, with their text as it was shown, the summary and notes.
+
+Use it to find out why an agent believed something, from the snapshot id (e.g. snap:12) ask_memory gave. It also says which passages have been edited, compacted or deleted since.`),
+		mcp.WithString("snapshot",
+			mcp.Required(),
+			mcp.Description("Snapshot id, e.g. 'snap:12'"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), getRecallSnapshotHandler(db, scopes))
+}
+
+func getRecallSnapshotHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, err := parseSnapshotID(request.GetString("snapshot", ""))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		snap, err := loadRecallSnapshot(ctx, db, scopes.levels(ctx), id)
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "snapshot %s does not exist", snapshotCitation(id)), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read snapshot: %v", err), nil
+		}
+		return graphResult(snap), nil
+	}
+}
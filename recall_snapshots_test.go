@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseSnapshotID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"snap:12", 12, false},
+		{" 7 ", 7, false},
+		{"obs:12", 0, true},
+		{"snap:0", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSnapshotID(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSnapshotID(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestRecallSnapshot_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	defer db.Exec("DELETE FROM recall_snapshots WHERE question LIKE '%snapshot-test%'")
+	defer db.Exec("DELETE FROM entities WHERE name = 'snapshot-test-nas'")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('snapshot-test-nas', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var ids []int64
+	for _, content := range []string{"snapshot-test pool has four disks", "snapshot-test pool is scrubbed weekly"} {
+		res, err := db.Exec("INSERT INTO observations (entity_id, content) SELECT id, ? FROM entities WHERE name = 'snapshot-test-nas'", content)
+		if err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		ids = append(ids, id)
+	}
+
+	result, err := callTool(askMemoryHandler(db, nil, nil, nil, nil), "ask_memory", map[string]any{"question": "what is the snapshot-test pool", "snapshot": true})
+	if err != nil || result.IsError {
+		t.Fatalf("ask_memory: %v %v", err, result.Content)
+	}
+	var asked askResult
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &asked); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(asked.Snapshot, "snap:") || len(asked.Passages) != 2 {
+		t.Fatalf("ask_memory = %+v, want two passages and a snapshot id", asked)
+	}
+
+	// Change what memory holds; the snapshot keeps what was shown.
+	if _, err := db.Exec("UPDATE observations SET content = 'snapshot-test pool has six disks' WHERE id = ?", ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM observations WHERE id = ?", ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	get := getRecallSnapshotHandler(db, nil)
+	result, err = callTool(get, "get_recall_snapshot", map[string]any{"snapshot": asked.Snapshot})
+	if err != nil || result.IsError {
+		t.Fatalf("get_recall_snapshot: %v %v", err, result.Content)
+	}
+	var snap recallSnapshot
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &snap); err != nil {
+		t.Fatal(err)
+	}
+	if snap.Question != asked.Question || len(snap.Passages) != 2 {
+		t.Fatalf("snapshot = %+v, want the question and passages asked", snap)
+	}
+	for i, p := range snap.Passages {
+		if p.Cite != asked.Passages[i].Cite || p.Content != asked.Passages[i].Content {
+			t.Errorf("passage %d = %+v, want %+v", i, p, asked.Passages[i])
+		}
+	}
+	since := strings.Join(snap.Since, "\n")
+	for _, want := range []string{citation(ids[0]) + " has been edited", citation(ids[1]) + " has been deleted"} {
+		if !strings.Contains(since, want) {
+			t.Errorf("since = %q, want %q", since, want)
+		}
+	}
+
+	// A client that could not see the passages cannot see the snapshot.
+	public, _ := parseVisibilityScopes("public", "")
+	result, _ = callTool(getRecallSnapshotHandler(db, public), "get_recall_snapshot", map[string]any{"snapshot": asked.Snapshot})
+	if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, codeNotFound) {
+		t.Errorf("public scope got %v, want not found", result.Content)
+	}
+
+	// Without snapshot or ENGRAM_RECALL_SNAPSHOTS nothing is kept.
+	result, _ = callTool(askMemoryHandler(db, nil, nil, nil, nil), "ask_memory", map[string]any{"question": "what is the snapshot-test pool"})
+	if strings.Contains(result.Content[0].(mcp.TextContent).Text, `"snapshot"`) {
+		t.Errorf("ask_memory kept a snapshot unasked: %v", result.Content)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// returnRecord describes the return_record parameter of the tools that
+// create rows.
+const returnRecord = "Set true to get the stored row back as JSON (id, fields as stored, tag names, createdAt) instead of a one-line summary, so there is no need to SELECT it to confirm the write"
+
+// observationRecord is an observation as stored, returned by add_observation
+// and add_reminder with return_record.
+type observationRecord struct {
+	ID             int64           `json:"id"`
+	Entity         string          `json:"entity"`
+	EntityID       int64           `json:"entityId"`
+	Content        string          `json:"content"`
+	ContentSHA256  string          `json:"contentSha256,omitempty"`
+	Visibility     string          `json:"visibility"`
+	Confidence     *float64        `json:"confidence,omitempty"`
+	Source         string          `json:"source,omitempty"`
+	ConversationID string          `json:"conversationId,omitempty"`
+	SourceURL      string          `json:"sourceUrl,omitempty"`
+	Metadata       json.RawMessage `json:"metadata,omitempty"`
+	ParentID       *int64          `json:"parentId,omitempty"`
+	Tags           []string        `json:"tags"`
+	CreatedAt      string          `json:"createdAt"`
+}
+
+// entityRecord is an entity as stored, returned by upsert_entity with
+// return_record.
+type entityRecord struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	EntityType string   `json:"entityType"`
+	Tags       []string `json:"tags"`
+	Created    bool     `json:"created"`
+	CreatedAt  string   `json:"createdAt"`
+}
+
+// reminderRecord is a reminder as stored, with its observation, returned by
+// add_reminder with return_record.
+type reminderRecord struct {
+	ID          int64             `json:"id"`
+	DueAt       string            `json:"dueAt"`
+	Repeats     string            `json:"repeats,omitempty"`
+	CreatedAt   string            `json:"createdAt"`
+	Observation observationRecord `json:"observation"`
+}
+
+// sortedTags splits a group_concat of tag names into a sorted, never nil list.
+func sortedTags(s string) []string {
+	tags := parseTagNames(s)
+	sort.Strings(tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return tags
+}
+
+// loadObservationRecords reads the observations with ids back, in the order
+// given.
+func loadObservationRecords(ctx context.Context, db *sql.DB, ids []int64) ([]observationRecord, error) {
+	if len(ids) == 0 {
+		return []observationRecord{}, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, `SELECT o.id, e.name, o.entity_id, o.content, o.content_sha256, o.visibility, o.confidence,
+			o.source, o.conversation_id, o.source_url, o.metadata, o.parent_id, o.created_at,
+			COALESCE((SELECT group_concat(t.name, ',') FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), '')
+		FROM observations o JOIN entities e ON e.id = o.entity_id
+		WHERE o.id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byID := make(map[int64]observationRecord, len(ids))
+	for rows.Next() {
+		var r observationRecord
+		var digest, source, conversationID, sourceURL, metadata sql.NullString
+		var confidence sql.NullFloat64
+		var parentID sql.NullInt64
+		var createdAt any
+		var tags string
+		if err := rows.Scan(&r.ID, &r.Entity, &r.EntityID, &r.Content, &digest, &r.Visibility, &confidence,
+			&source, &conversationID, &sourceURL, &metadata, &parentID, &createdAt, &tags); err != nil {
+			return nil, err
+		}
+		r.ContentSHA256, r.Source, r.ConversationID, r.SourceURL = digest.String, source.String, conversationID.String, sourceURL.String
+		if confidence.Valid {
+			r.Confidence = &confidence.Float64
+		}
+		if metadata.Valid {
+			r.Metadata = json.RawMessage(metadata.String)
+		}
+		if parentID.Valid {
+			r.ParentID = &parentID.Int64
+		}
+		r.CreatedAt, r.Tags = formatValue(createdAt), sortedTags(tags)
+		byID[r.ID] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	records := make([]observationRecord, 0, len(ids))
+	for _, id := range ids {
+		r, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("observation %d not found after writing it", id)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// loadEntityRecord reads the entity with id back.
+func loadEntityRecord(ctx context.Context, db *sql.DB, id int64, created bool) (entityRecord, error) {
+	r := entityRecord{Created: created}
+	var createdAt any
+	var tags string
+	err := db.QueryRowContext(ctx, `SELECT e.id, e.name, e.entity_type, e.created_at,
+			COALESCE((SELECT group_concat(t.name, ',') FROM entity_tags et JOIN tags t ON t.id = et.tag_id WHERE et.entity_id = e.id), '')
+		FROM entities e WHERE e.id = ?`, id).Scan(&r.ID, &r.Name, &r.EntityType, &createdAt, &tags)
+	if err != nil {
+		return r, err
+	}
+	r.CreatedAt, r.Tags = formatValue(createdAt), sortedTags(tags)
+	return r, nil
+}
+
+// loadReminderRecord reads the reminder with id, and its observation, back.
+func loadReminderRecord(ctx context.Context, db *sql.DB, id int64) (reminderRecord, error) {
+	r := reminderRecord{ID: id}
+	var observationID int64
+	var dueAt, createdAt any
+	var rule sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT observation_id, due_at, rrule, created_at FROM reminders WHERE id = ?", id).
+		Scan(&observationID, &dueAt, &rule, &createdAt); err != nil {
+		return r, err
+	}
+	r.DueAt, r.Repeats, r.CreatedAt = formatValue(dueAt), rule.String, formatValue(createdAt)
+	observations, err := loadObservationRecords(ctx, db, []int64{observationID})
+	if err != nil {
+		return r, err
+	}
+	r.Observation = observations[0]
+	return r, nil
+}
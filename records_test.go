@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestReturnRecord_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'Records test'")
+	defer db.Exec("DELETE FROM entity_tags WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Records test')")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Records test')")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Records test')")
+	defer db.Exec("DELETE FROM reminders WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Records test')")
+
+	decode := func(handler server.ToolHandlerFunc, name string, args map[string]any, v any) {
+		t.Helper()
+		result, err := callTool(handler, name, args)
+		if err != nil || result.IsError {
+			t.Fatalf("tool failed: %v %v", err, result.Content)
+		}
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), v); err != nil {
+			t.Fatalf("decode %s: %v", result.Content[0].(mcp.TextContent).Text, err)
+		}
+	}
+
+	var entity entityRecord
+	decode(upsertEntityHandler(db), "upsert_entity", map[string]any{
+		"name": "Records test", "entity_type": "Test", "tags": "personal,homelab", "return_record": true}, &entity)
+	if entity.ID == 0 || !entity.Created || entity.EntityType != "Test" || !reflect.DeepEqual(entity.Tags, []string{"homelab", "personal"}) || entity.CreatedAt == "" {
+		t.Errorf("upsert_entity record = %+v", entity)
+	}
+
+	var obs observationRecord
+	var metadata struct{ Port int }
+	decode(addObservationHandler(db, nil), "add_observation", map[string]any{
+		"entity": "Records test", "content": "Records test observation", "tags": "homelab", "confidence": 0.7,
+		"source": "user", "metadata": map[string]any{"port": 8080}, "return_record": true}, &obs)
+	if obs.ID == 0 || obs.EntityID != entity.ID || obs.Content != "Records test observation" || obs.Visibility != "private" ||
+		obs.Confidence == nil || *obs.Confidence != 0.7 || obs.Source != "user" || json.Unmarshal(obs.Metadata, &metadata) != nil || metadata.Port != 8080 ||
+		!reflect.DeepEqual(obs.Tags, []string{"homelab"}) || obs.CreatedAt == "" {
+		t.Errorf("add_observation record = %+v", obs)
+	}
+
+	var reminder reminderRecord
+	decode(addReminderHandler(db), "add_reminder", map[string]any{
+		"due": "2026-05-01", "observation_id": float64(obs.ID), "return_record": true}, &reminder)
+	if reminder.ID == 0 || reminder.DueAt == "" || reminder.Observation.ID != obs.ID {
+		t.Errorf("add_reminder record = %+v", reminder)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	dueURI           = "memory://due"
+	defaultDueLimit  = 50
+	maxDueLimit      = 500
+	reminderTimeForm = "2006-01-02 15:04:05"
+)
+
+// dueLayouts are the absolute forms add_reminder accepts for due, read in the
+// server's local time zone unless they carry an offset.
+var dueLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// parseSpan parses a relative time such as "30m", "12h", "3d" or "2w".
+func parseSpan(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		count, err := strconv.Atoi(s[:n-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		day := 24 * time.Hour
+		if s[n-1] == 'w' {
+			day *= 7
+		}
+		return time.Duration(count) * day, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// parseDue turns add_reminder's due argument, a date, a date and time or a
+// span from now, into a UTC timestamp in the format SQLite's CURRENT_TIMESTAMP
+// uses, so due times compare with stored timestamps as text.
+func parseDue(s string, now time.Time) (string, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dueLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.UTC().Format(reminderTimeForm), nil
+		}
+	}
+	if d, err := parseSpan(s); err == nil && d >= 0 {
+		return now.Add(d).UTC().Format(reminderTimeForm), nil
+	}
+	return "", fmt.Errorf("invalid due %q, use a date like '2026-05-01', a time like '2026-05-01 09:00' or a span like '3d'", s)
+}
+
+func addReminderHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		due := request.GetString("due", "")
+		if strings.TrimSpace(due) == "" {
+			return toolError(codeInvalidArgument, "due parameter is required, e.g. '2026-05-01' or '3d'"), nil
+		}
+		dueAt, err := parseDue(due, time.Now())
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		// A repeating reminder's series starts at due; its first occurrence
+		// is the first the rule allows from then on.
+		var rule, seriesStart, occurrence any
+		if repeat := strings.TrimSpace(request.GetString("repeat", "")); repeat != "" {
+			rec, err := parseRecurrence(repeat)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			start, _ := time.ParseInLocation(reminderTimeForm, dueAt, time.UTC)
+			first, n, ok := rec.after(start, start.Add(-time.Second))
+			if !ok {
+				return toolErrorf(codeInvalidArgument, "repeat %s has no occurrence from %s UTC on", rec, dueAt), nil
+			}
+			rule, seriesStart, occurrence = rec.String(), dueAt, n
+			dueAt = first.UTC().Format(reminderTimeForm)
+		}
+
+		observationID := int64(request.GetInt("observation_id", 0))
+		entity := strings.TrimSpace(request.GetString("entity", ""))
+		content := request.GetString("content", "")
+		if (observationID > 0) == (entity != "" || strings.TrimSpace(content) != "") {
+			return toolError(codeInvalidArgument, "pass either observation_id, or entity, content and tags for a new observation"), nil
+		}
+
+		if observationID > 0 {
+			var exists int
+			if err := db.QueryRowContext(ctx, "SELECT count(*) FROM observations WHERE id = ?", observationID).Scan(&exists); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "error looking up observation %d: %v", observationID, err), nil
+			}
+			if exists == 0 {
+				return toolErrorf(codeNotFound, "observation %d does not exist", observationID), nil
+			}
+		} else {
+			if entity == "" || strings.TrimSpace(content) == "" {
+				return toolError(codeInvalidArgument, "entity and content parameters are required for a new observation"), nil
+			}
+			tagsStr := request.GetString("tags", "")
+			if strings.TrimSpace(tagsStr) == "" && requiredTags.requires("observations") {
+				return toolError(codeTagRequired, "tags parameter is required for a new observation. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+			}
+			visibility := request.GetString("visibility", "private")
+			if _, err := parseVisibilityLevels(visibility); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			entityID, err := lookupEntityID(ctx, db, entity)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			tagIDs, err := validateTagsFor(ctx, db, "observations", parseTagNames(tagsStr))
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			if err := checkTagQuotas(ctx, db, tagIDs, len(content)); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+
+			result, err := db.ExecContext(ctx, "INSERT INTO observations (entity_id, content, visibility) VALUES (?, ?, ?)",
+				entityID, normalizeText(content), strings.ToLower(visibility))
+			if err != nil {
+				return execError(err, codeDatabase), nil
+			}
+			observationID, _ = result.LastInsertId()
+			if err := linkTags(ctx, db, observationID, tagIDs); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "observation created but failed to link tags: %v", err), nil
+			}
+		}
+
+		result, err := db.ExecContext(ctx, "INSERT INTO reminders (observation_id, due_at, rrule, series_start, occurrence) VALUES (?, ?, ?, ?, ?)",
+			observationID, dueAt, rule, seriesStart, occurrence)
+		if err != nil {
+			return execError(err, codeDatabase), nil
+		}
+		id, _ := result.LastInsertId()
+		if request.GetBool("return_record", false) {
+			record, err := loadReminderRecord(ctx, db, id)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "reminder stored but failed to read it back: %v", err), nil
+			}
+			return graphResult(record), nil
+		}
+		if rule != nil {
+			return mcp.NewToolResultText(fmt.Sprintf("success: reminder %d on observation %d due %s UTC, repeating %s", id, observationID, dueAt, rule)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("success: reminder %d on observation %d due %s UTC", id, observationID, dueAt)), nil
+	}
+}
+
+// loadDue lists open reminders due by the given time, oldest due first.
+func loadDue(ctx context.Context, db *sql.DB, levels []string, by time.Time, limit int) ([]string, []map[string]any, error) {
+	sqlStr := restrictVisibility(`SELECT r.id, r.observation_id, e.name AS entity, o.content, r.due_at, r.rrule AS repeats
+		FROM reminders r JOIN observations o ON o.id = r.observation_id JOIN entities e ON e.id = o.entity_id
+		WHERE r.completed_at IS NULL AND r.due_at <= ?
+		ORDER BY r.due_at, r.id LIMIT ?`, levels)
+	return runQuery(ctx, db, sqlStr, by.UTC().Format(reminderTimeForm), limit)
+}
+
+func listDueHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		limit := request.GetInt("limit", defaultDueLimit)
+		if limit < 1 || limit > maxDueLimit {
+			return toolErrorf(codeInvalidArgument, "limit must be between 1 and %d", maxDueLimit), nil
+		}
+		var within time.Duration
+		if s := strings.TrimSpace(request.GetString("within", "")); s != "" {
+			var err error
+			if within, err = parseSpan(s); err != nil || within < 0 {
+				return toolErrorf(codeInvalidArgument, "invalid within %q, use a span like '12h' or '7d'", s), nil
+			}
+		}
+
+		cols, results, err := loadDue(ctx, db, scopes.levels(ctx), time.Now().Add(within), limit)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		return mcp.NewToolResultText(formatRows(cols, results)), nil
+	}
+}
+
+// reminderTime reads a timestamp column, which the driver returns as a
+// time.Time or as text in reminderTimeForm.
+func reminderTime(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case []byte:
+		return reminderTime(string(v))
+	case string:
+		return time.ParseInLocation(reminderTimeForm, v, time.UTC)
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %v", v)
+}
+
+// nextOccurrence is the occurrence of a repeating reminder that follows one
+// due at dueAt and completed now: the first after both, so missed occurrences
+// do not pile up. ok is false when the series has ended.
+func nextOccurrence(rule string, seriesStart, dueAt, now time.Time) (next string, n int, ok bool, err error) {
+	rec, err := parseRecurrence(rule)
+	if err != nil {
+		return "", 0, false, err
+	}
+	after := dueAt
+	if now.After(after) {
+		after = now
+	}
+	t, n, ok := rec.after(seriesStart, after)
+	if !ok {
+		return "", 0, false, nil
+	}
+	return t.UTC().Format(reminderTimeForm), n, true, nil
+}
+
+func completeHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id := int64(request.GetInt("id", 0))
+		if id <= 0 {
+			return toolError(codeInvalidArgument, "id parameter is required"), nil
+		}
+
+		var completedAt, rule sql.NullString
+		var observationID int64
+		var dueAt, seriesStart any
+		var occurrence sql.NullInt64
+		err := db.QueryRowContext(ctx, "SELECT observation_id, due_at, completed_at, rrule, series_start, occurrence FROM reminders WHERE id = ?", id).
+			Scan(&observationID, &dueAt, &completedAt, &rule, &seriesStart, &occurrence)
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "reminder %d does not exist", id), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "query error: %v", err), nil
+		}
+		if completedAt.Valid {
+			return toolErrorf(codeConflict, "reminder %d was already completed at %s", id, completedAt.String), nil
+		}
+
+		var next string
+		var n int
+		var start time.Time
+		repeats := rule.Valid && !request.GetBool("stop", false)
+		if repeats {
+			due, err := reminderTime(dueAt)
+			if err != nil {
+				return toolErrorf(codeDatabase, "reminder %d: %v", id, err), nil
+			}
+			// A rule set with execute may lack series_start; the series then
+			// starts at this occurrence.
+			start = due
+			if seriesStart != nil {
+				if start, err = reminderTime(seriesStart); err != nil {
+					return toolErrorf(codeDatabase, "reminder %d: %v", id, err), nil
+				}
+			}
+			if next, n, repeats, err = nextOccurrence(rule.String, start, due, time.Now()); err != nil {
+				return toolErrorf(codeInvalidArgument, "reminder %d has an invalid repeat rule: %v", id, err), nil
+			}
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+		if _, err := tx.ExecContext(ctx, "UPDATE reminders SET completed_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+			return execError(err, codeDatabase), nil
+		}
+		var nextID int64
+		if repeats {
+			result, err := tx.ExecContext(ctx, "INSERT INTO reminders (observation_id, due_at, rrule, series_start, occurrence) VALUES (?, ?, ?, ?, ?)",
+				observationID, next, rule.String, start.Format(reminderTimeForm), n)
+			if err != nil {
+				return execError(err, codeDatabase), nil
+			}
+			nextID, _ = result.LastInsertId()
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+
+		switch {
+		case repeats:
+			msg := fmt.Sprintf("success: reminder %d completed; next due %s UTC as reminder %d", id, next, nextID)
+			if skipped := n - int(occurrence.Int64) - 1; occurrence.Valid && skipped > 0 {
+				msg += fmt.Sprintf(" (%d missed occurrence(s) skipped)", skipped)
+			}
+			return mcp.NewToolResultText(msg), nil
+		case rule.Valid && request.GetBool("stop", false):
+			return mcp.NewToolResultText(fmt.Sprintf("success: reminder %d completed and its series stopped", id)), nil
+		case rule.Valid:
+			return mcp.NewToolResultText(fmt.Sprintf("success: reminder %d completed, the last of its series", id)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("success: reminder %d completed", id)), nil
+	}
+}
+
+// registerReminders adds the due reminders resource and the tools that set,
+// list and complete reminders.
+func registerReminders(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddResource(mcp.NewResource(
+		dueURI,
+		"Due reminders",
+		mcp.WithResourceDescription("Open reminders that are due now, oldest first. Subscribe to be notified when a reminder comes due or a due one is completed"),
+		mcp.WithMIMEType("text/plain"),
+	), dueHandler(db, scopes))
+
+	s.AddTool(mcp.NewTool("add_reminder",
+		mcp.WithDescription(`Record an action item with a due date so it is surfaced later by list_due and the memory://due resource.
+
+Either pass entity, content and tags to create a new observation for the task, or observation_id to make an existing observation a reminder.
+
+For a recurring task such as "water the plants weekly", pass repeat: completing each occurrence schedules the next.`),
+		mcp.WithString("due",
+			mcp.Required(),
+			mcp.Description("When it is due: a date ('2026-05-01'), a date and time ('2026-05-01 09:00', server local time, or RFC 3339) or a span from now ('2h', '3d', '1w'). For a repeating reminder, when the series starts"),
+		),
+		mcp.WithString("repeat",
+			mcp.Description("Repeat the reminder: 'daily', 'weekly', 'weekdays', 'monthly', 'yearly' or an RRULE using FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL, e.g. 'FREQ=WEEKLY;INTERVAL=2;BYDAY=SA' or 'FREQ=MONTHLY;BYDAY=-1FR'. Occurrences keep due's time of day in server local time"),
+		),
+		mcp.WithNumber("observation_id",
+			mcp.Description("ID of an existing observation to remind about"),
+		),
+		mcp.WithString("entity",
+			mcp.Description("Entity the new task observation is about"),
+		),
+		mcp.WithString("content",
+			mcp.Description("The task, e.g. 'TODO: replace the NAS fan'"),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Comma-separated tags for the new observation"),
+		),
+		mcp.WithString("visibility",
+			mcp.Description("Visibility of the new observation: private (default), shared or public"),
+		),
+		mcp.WithBoolean("return_record",
+			mcp.Description(returnRecord+", with the reminder's observation"),
+		),
+	), addReminderHandler(db))
+
+	s.AddTool(mcp.NewTool("list_due",
+		mcp.WithDescription("List open reminders that are due, oldest first. Check this at the start of a conversation and bring up what is due."),
+		mcp.WithString("within",
+			mcp.Description("Also include reminders due within this span from now, e.g. '1d' or '1w' (default: only those due now)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum reminders to return (default %d, max %d)", defaultDueLimit, maxDueLimit)),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), listDueHandler(db, scopes))
+
+	s.AddTool(mcp.NewTool("complete",
+		mcp.WithDescription("Mark a reminder done so it no longer shows up as due. The observation itself is kept. For a repeating reminder this adds the next occurrence after now, skipping any that were missed."),
+		mcp.WithNumber("id",
+			mcp.Required(),
+			mcp.Description("ID of the reminder, as returned by list_due"),
+		),
+		mcp.WithBoolean("stop",
+			mcp.Description("For a repeating reminder, end the series instead of scheduling the next occurrence (default false)"),
+		),
+	), completeHandler(db))
+}
+
+func dueHandler(db *sql.DB, scopes *visibilityScopes) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		cols, results, err := loadDue(ctx, db, scopes.levels(ctx), time.Now(), defaultDueLimit)
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      dueURI,
+				MIMEType: "text/plain",
+				Text:     formatRows(cols, results),
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseDue(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	local := func(s string) string {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return t.UTC().Format(reminderTimeForm)
+	}
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"2026-05-01", local("2026-05-01 00:00"), false},
+		{"2026-05-01 09:30", local("2026-05-01 09:30"), false},
+		{"2026-05-01T09:30", local("2026-05-01 09:30"), false},
+		{"2026-05-01T09:30:00+02:00", "2026-05-01 07:30:00", false},
+		{"3d", "2026-03-04 12:00:00", false},
+		{"1w", "2026-03-08 12:00:00", false},
+		{"90m", "2026-03-01 13:30:00", false},
+		{"-2h", "", true},
+		{"next tuesday", "", true},
+		{"xd", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseDue(tt.input, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseDue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReminders_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'reminder-test-nas'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'reminder test %'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('reminder-test-nas', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var existingID int64
+	if err := db.QueryRow(`INSERT INTO observations (entity_id, content, visibility)
+		SELECT id, 'reminder test renew the tls cert', 'public' FROM entities WHERE name = 'reminder-test-nas' RETURNING id`).Scan(&existingID); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	add := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		result, err := callTool(addReminderHandler(db), "add_reminder", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+	text := func(result *mcp.CallToolResult) string {
+		return result.Content[0].(mcp.TextContent).Text
+	}
+
+	t.Run("rejects bad input", func(t *testing.T) {
+		for _, args := range []map[string]any{
+			{"observation_id": float64(existingID)},
+			{"observation_id": float64(existingID), "due": "soon"},
+			{"due": "1d"},
+			{"due": "1d", "observation_id": float64(existingID), "entity": "reminder-test-nas", "content": "reminder test x", "tags": "homelab"},
+			{"due": "1d", "entity": "reminder-test-nas", "content": "reminder test untagged"},
+			{"due": "1d", "observation_id": float64(-1)},
+		} {
+			if result := add(args); !result.IsError {
+				t.Errorf("%v: expected an error", args)
+			}
+		}
+	})
+
+	past := time.Now().Add(-time.Hour).Format("2006-01-02 15:04")
+	for _, args := range []map[string]any{
+		{"due": past, "observation_id": float64(existingID)},
+		{"due": "3d", "entity": "reminder-test-nas", "content": "reminder test replace the fan", "tags": "homelab"},
+		{"due": past, "entity": "reminder-test-nas", "content": "reminder test rotate keys", "tags": "homelab"},
+	} {
+		if result := add(args); result.IsError {
+			t.Fatalf("add_reminder %v: %v", args, result.Content)
+		}
+	}
+
+	listDue := func(args map[string]any, scope string) string {
+		t.Helper()
+		var scopes *visibilityScopes
+		if scope != "" {
+			var err error
+			if scopes, err = parseVisibilityScopes(scope, ""); err != nil {
+				t.Fatalf("parseVisibilityScopes: %v", err)
+			}
+		}
+		result, err := callTool(listDueHandler(db, scopes), "list_due", args)
+		if err != nil || result.IsError {
+			t.Fatalf("list_due: %v %v", err, result.Content)
+		}
+		return text(result)
+	}
+
+	tests := []struct {
+		name    string
+		args    map[string]any
+		scope   string
+		want    []string
+		wantNot []string
+	}{
+		{"due now", map[string]any{}, "", []string{"tls cert", "rotate keys"}, []string{"replace the fan"}},
+		{"within a week", map[string]any{"within": "1w"}, "", []string{"tls cert", "rotate keys", "replace the fan"}, nil},
+		{"visibility", map[string]any{}, "public", []string{"tls cert"}, []string{"rotate keys"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := listDue(tt.args, tt.scope)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("expected %q in %s", w, got)
+				}
+			}
+			for _, w := range tt.wantNot {
+				if strings.Contains(got, w) {
+					t.Errorf("unexpected %q in %s", w, got)
+				}
+			}
+		})
+	}
+
+	t.Run("complete", func(t *testing.T) {
+		var id int64
+		if err := db.QueryRow("SELECT id FROM reminders WHERE observation_id = ?", existingID).Scan(&id); err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+		complete := func() *mcp.CallToolResult {
+			result, err := callTool(completeHandler(db), "complete", map[string]any{"id": float64(id)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return result
+		}
+		if result := complete(); result.IsError {
+			t.Fatalf("complete: %v", result.Content)
+		}
+		if result := complete(); !result.IsError {
+			t.Error("expected completing twice to fail")
+		}
+		if got := listDue(map[string]any{}, ""); strings.Contains(got, "tls cert") {
+			t.Errorf("completed reminder still due: %s", got)
+		}
+	})
+
+	t.Run("repeat", func(t *testing.T) {
+		if result := add(map[string]any{"due": "1d", "repeat": "every other day", "entity": "reminder-test-nas", "content": "reminder test x", "tags": "homelab"}); !result.IsError {
+			t.Error("unsupported repeat: expected an error")
+		}
+
+		// A weekly series that started three weeks ago and was never done.
+		start := time.Now().AddDate(0, 0, -21).Format("2006-01-02 15:04")
+		result := add(map[string]any{"due": start, "repeat": "weekly", "entity": "reminder-test-nas", "content": "reminder test water the plants", "tags": "homelab"})
+		if result.IsError || !strings.Contains(text(result), "repeating FREQ=WEEKLY") {
+			t.Fatalf("add_reminder: %v", result.Content)
+		}
+		if got := listDue(map[string]any{}, ""); !strings.Contains(got, "water the plants") || !strings.Contains(got, "FREQ=WEEKLY") {
+			t.Errorf("repeating reminder not due: %s", got)
+		}
+
+		var id, observationID int64
+		if err := db.QueryRow(`SELECT r.id, r.observation_id FROM reminders r JOIN observations o ON o.id = r.observation_id
+			WHERE o.content = 'reminder test water the plants'`).Scan(&id, &observationID); err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+		complete := func(args map[string]any) string {
+			t.Helper()
+			args["id"] = float64(id)
+			result, err := callTool(completeHandler(db), "complete", args)
+			if err != nil || result.IsError {
+				t.Fatalf("complete: %v %v", err, result.Content)
+			}
+			return text(result)
+		}
+
+		// The missed weeks are skipped: the next occurrence is in the future.
+		got := complete(map[string]any{})
+		if !strings.Contains(got, "next due") || !strings.Contains(got, "missed occurrence(s) skipped") {
+			t.Fatalf("complete = %q", got)
+		}
+		var dueAt any
+		var occurrence int
+		if err := db.QueryRow("SELECT id, due_at, occurrence FROM reminders WHERE observation_id = ? AND completed_at IS NULL", observationID).
+			Scan(&id, &dueAt, &occurrence); err != nil {
+			t.Fatalf("next occurrence: %v", err)
+		}
+		if next, err := reminderTime(dueAt); err != nil || !next.After(time.Now()) || occurrence < 4 {
+			t.Errorf("next occurrence due %s, number %d", dueAt, occurrence)
+		}
+		if got := listDue(map[string]any{}, ""); strings.Contains(got, "water the plants") {
+			t.Errorf("next occurrence due already: %s", got)
+		}
+
+		if got := complete(map[string]any{"stop": true}); !strings.Contains(got, "series stopped") {
+			t.Errorf("stop = %q", got)
+		}
+		var open int
+		db.QueryRow("SELECT count(*) FROM reminders WHERE observation_id = ? AND completed_at IS NULL", observationID).Scan(&open)
+		if open != 0 {
+			t.Errorf("%d open reminders after stopping the series", open)
+		}
+	})
+
+	t.Run("resource", func(t *testing.T) {
+		contents, err := dueHandler(db, nil)(context.Background(), mcp.ReadResourceRequest{})
+		if err != nil {
+			t.Fatalf("read %s: %v", dueURI, err)
+		}
+		if got := contents[0].(mcp.TextResourceContents).Text; !strings.Contains(got, "rotate keys") {
+			t.Errorf("unexpected contents %s", got)
+		}
+	})
+}
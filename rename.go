@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxRenameReport caps the observations a rename_entity report lists.
+const maxRenameReport = 50
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// replaceMentions replaces each mention of old in content with replacement
+// and returns the result with the number replaced. A match that runs on into
+// a longer word, such as "Acme" in "Acmeville", is not a mention, nor is one
+// that is already part of the replacement, as in "Acme Inc" when renaming
+// Acme to Acme Inc.
+func replaceMentions(content, old, replacement string) (string, int) {
+	if old == "" {
+		return content, 0
+	}
+	first, _ := utf8.DecodeRuneInString(old)
+	last, _ := utf8.DecodeLastRuneInString(old)
+	within := strings.Index(replacement, old)
+	var b strings.Builder
+	n, done := 0, 0
+	for from := 0; ; {
+		i := strings.Index(content[from:], old)
+		if i < 0 {
+			break
+		}
+		i += from
+		end := i + len(old)
+		from = end
+		before, _ := utf8.DecodeLastRuneInString(content[:i])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		if (isWordRune(first) && isWordRune(before)) || (isWordRune(last) && isWordRune(after)) {
+			continue
+		}
+		if within >= 0 && i >= within && strings.HasPrefix(content[i-within:], replacement) {
+			from = i - within + len(replacement)
+			continue
+		}
+		b.WriteString(content[done:i])
+		b.WriteString(replacement)
+		done = end
+		n++
+	}
+	b.WriteString(content[done:])
+	return b.String(), n
+}
+
+// mention is an observation whose content mentions a renamed entity.
+type mention struct {
+	id       int64
+	entity   string
+	content  string
+	count    int
+	external bool
+}
+
+// findMentions returns the observations the caller can see that mention
+// name, with their content rewritten to newName. Long observations kept in
+// contents are marked external: their content is only a preview.
+func findMentions(ctx context.Context, tx *sql.Tx, levels []string, nsFilter, name, newName string) ([]mention, error) {
+	where := "instr(o.content, ?) > 0"
+	if nsFilter != "" {
+		where += " AND o." + nsFilter
+	}
+	rows, err := tx.QueryContext(ctx, restrictVisibility(`SELECT o.id, e.name, o.content, o.content_sha256 IS NOT NULL
+		FROM observations o JOIN entities e ON e.id = o.entity_id
+		WHERE `+where+` ORDER BY o.id`, levels), name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var found []mention
+	for rows.Next() {
+		var m mention
+		if err := rows.Scan(&m.id, &m.entity, &m.content, &m.external); err != nil {
+			return nil, err
+		}
+		if m.content, m.count = replaceMentions(m.content, name, newName); m.count > 0 {
+			found = append(found, m)
+		}
+	}
+	return found, rows.Err()
+}
+
+// registerRenameEntity adds the rename_entity tool.
+func registerRenameEntity(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("rename_entity",
+		mcp.WithDescription(`Rename an entity after a real-world rename, e.g. a company rebrand or a host given a new name. Its observations, relations and attributes stay attached. The old name is kept as an alias, so open_nodes, search_nodes and the tools that take an entity name still find it by either name.
+
+Observations that mention the old name are listed. rewrite_mentions replaces those mentions with the new name; run it with dry_run first to show the user the rewritten text.`),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Current entity name"),
+		),
+		mcp.WithString("new_name",
+			mcp.Required(),
+			mcp.Description("New entity name"),
+		),
+		mcp.WithBoolean("rewrite_mentions",
+			mcp.Description("Also replace the old name with the new one in observation content, matching whole words and case (default false)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Report what would change without changing anything (default false)"),
+		),
+	), renameEntityHandler(db, scopes))
+}
+
+func renameEntityHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			return toolError(codeInvalidArgument, "name parameter is required"), nil
+		}
+		newName := strings.TrimSpace(request.GetString("new_name", ""))
+		if newName == "" {
+			return toolError(codeInvalidArgument, "new_name parameter is required"), nil
+		}
+		if newName == name {
+			return toolErrorf(codeInvalidArgument, "entity '%s' already has that name", name), nil
+		}
+		rewrite := request.GetBool("rewrite_mentions", false)
+		dryRun := request.GetBool("dry_run", false)
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		var id int64
+		err = tx.QueryRowContext(ctx, "SELECT id FROM entities WHERE name = ?", name).Scan(&id)
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "entity '%s' does not exist", name), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error looking up entity '%s': %v", name, err), nil
+		}
+		// The new name may be one the entity had before, but not another
+		// entity's name or former name.
+		var other int64
+		err = tx.QueryRowContext(ctx, "SELECT id"+entityByName, newName, newName, newName).Scan(&other)
+		if err == nil && other != id {
+			return toolErrorf(codeConflict, "'%s' already names entity %d. Rename or merge that one first", newName, other), nil
+		} else if err != nil && err != sql.ErrNoRows {
+			return toolErrorf(errorCode(err, codeDatabase), "error looking up entity '%s': %v", newName, err), nil
+		}
+
+		mentions, err := findMentions(ctx, tx, scopes.levels(ctx), namespaces.observationFilter(ctx), name, normalizeText(newName))
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to find mentions of '%s': %v", name, err), nil
+		}
+		var rewritten, skipped []mention
+		total := 0
+		for _, m := range mentions {
+			if m.external {
+				skipped = append(skipped, m)
+				continue
+			}
+			rewritten = append(rewritten, m)
+			total += m.count
+		}
+
+		if !dryRun {
+			if _, err := tx.ExecContext(ctx, "UPDATE entities SET name = ? WHERE id = ?", newName, id); err != nil {
+				return execError(err, codeDatabase), nil
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM entity_aliases WHERE alias = ?", newName); err != nil {
+				return execError(err, codeDatabase), nil
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO entity_aliases (alias, entity_id) VALUES (?, ?)
+				ON CONFLICT (alias) DO UPDATE SET entity_id = excluded.entity_id`, name, id); err != nil {
+				return execError(err, codeDatabase), nil
+			}
+			if rewrite {
+				for _, m := range rewritten {
+					if _, err := tx.ExecContext(ctx, "UPDATE observations SET content = ? WHERE id = ?", m.content, m.id); err != nil {
+						return toolErrorf(errorCode(err, codeDatabase), "failed to rewrite %s: %v", citation(m.id), err), nil
+					}
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+			}
+		}
+
+		var sb strings.Builder
+		if dryRun {
+			fmt.Fprintf(&sb, "dry run, nothing was changed: entity %d would be renamed from '%s' to '%s', keeping '%s' as an alias\n", id, name, newName, name)
+		} else {
+			fmt.Fprintf(&sb, "success: entity %d renamed from '%s' to '%s'; '%s' is kept as an alias and still finds it\n", id, name, newName, name)
+		}
+		switch {
+		case len(rewritten) == 0:
+			fmt.Fprintf(&sb, "no observations mention '%s'\n", name)
+		case !rewrite:
+			fmt.Fprintf(&sb, "%d observations still mention '%s'; pass rewrite_mentions to rewrite them, with dry_run to see how first\n", len(rewritten), name)
+		default:
+			verb := "rewrote"
+			if dryRun {
+				verb = "would rewrite"
+			}
+			fmt.Fprintf(&sb, "%s %d mentions in %d observations:\n", verb, total, len(rewritten))
+			for i, m := range rewritten {
+				if i == maxRenameReport {
+					fmt.Fprintf(&sb, "... and %d more\n", len(rewritten)-i)
+					break
+				}
+				fmt.Fprintf(&sb, "%s (%s): %s\n", citation(m.id), m.entity, m.content)
+			}
+		}
+		if len(skipped) > 0 {
+			ids := make([]string, len(skipped))
+			for i, m := range skipped {
+				ids[i] = citation(m.id)
+			}
+			fmt.Fprintf(&sb, "left %d long observations kept in contents as they are: %s\n", len(skipped), strings.Join(ids, ", "))
+		}
+		return mcp.NewToolResultText(strings.TrimSuffix(sb.String(), "\n")), nil
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestReplaceMentions(t *testing.T) {
+	tests := []struct {
+		content, old, replacement, want string
+		n                               int
+	}{
+		{"Works at Acme since 2020", "Acme", "Initech", "Works at Initech since 2020", 1},
+		{"Acme, then Acme again.", "Acme", "Initech", "Initech, then Initech again.", 2},
+		{"Moved to Acmeville near NotAcme", "Acme", "Initech", "Moved to Acmeville near NotAcme", 0},
+		{"acme is lower case", "Acme", "Initech", "acme is lower case", 0},
+		{"Acme Inc bought Acme", "Acme", "Acme Inc", "Acme Inc bought Acme Inc", 1},
+		{"Malmö office, Malmöhus castle", "Malmö", "Malmo", "Malmo office, Malmöhus castle", 1},
+		{"nas.lan serves nas.lan.", "nas.lan", "vault.lan", "vault.lan serves vault.lan.", 2},
+	}
+	for _, tt := range tests {
+		got, n := replaceMentions(tt.content, tt.old, tt.replacement)
+		if got != tt.want || n != tt.n {
+			t.Errorf("replaceMentions(%q, %q, %q) = %q, %d, want %q, %d", tt.content, tt.old, tt.replacement, got, n, tt.want, tt.n)
+		}
+	}
+}
+
+func TestRenameEntity_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'rename-test%'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('rename-test-acme', 'company'), ('rename-test-vince', 'person'), ('rename-test-other', 'company')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO observations (entity_id, content) SELECT id, 'works at rename-test-acme' FROM entities WHERE name = 'rename-test-vince'`); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	rename := func(args map[string]any) string {
+		t.Helper()
+		result, err := callTool(renameEntityHandler(db, nil), "rename_entity", args)
+		if err != nil || result.IsError {
+			t.Fatalf("rename_entity %v: %v %v", args, err, result.Content)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+	content := func() string {
+		t.Helper()
+		var c string
+		if err := db.QueryRow("SELECT o.content FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'rename-test-vince'").Scan(&c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	args := map[string]any{"name": "rename-test-acme", "new_name": "rename-test-initech", "rewrite_mentions": true, "dry_run": true}
+	text := rename(args)
+	if !strings.HasPrefix(text, "dry run") || !strings.Contains(text, "(rename-test-vince): works at rename-test-initech") {
+		t.Errorf("dry run = %q", text)
+	}
+	if content() != "works at rename-test-acme" {
+		t.Fatal("the dry run rewrote the observation")
+	}
+
+	delete(args, "dry_run")
+	if text = rename(args); !strings.Contains(text, "rewrote 1 mentions in 1 observations") || content() != "works at rename-test-initech" {
+		t.Errorf("rename = %q, content %q", text, content())
+	}
+
+	// The old name still opens the entity, and creating it again does not
+	// make a second one.
+	result, err := callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": []any{"rename-test-acme"}})
+	if err != nil || result.IsError {
+		t.Fatalf("open_nodes: %v %v", err, result.Content)
+	}
+	var opened openedNodes
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &opened); err != nil {
+		t.Fatal(err)
+	}
+	if len(opened.Entities) != 1 || opened.Entities[0].Name != "rename-test-initech" || len(opened.Entities[0].Aliases) != 1 || len(opened.NotFound) != 0 {
+		t.Errorf("open_nodes by the old name = %+v", opened)
+	}
+	if _, created, err := upsertEntity(context.Background(), db, "rename-test-acme", "company", "ignore"); err != nil || created {
+		t.Errorf("upsertEntity with the old name: created %v, %v", created, err)
+	}
+
+	for _, newName := range []string{"rename-test-other", "rename-test-acme"} {
+		result, err := callTool(renameEntityHandler(db, nil), "rename_entity", map[string]any{"name": "rename-test-vince", "new_name": newName})
+		if err != nil || !result.IsError {
+			t.Errorf("rename to %s: expected error, got %v %v", newName, err, result)
+		}
+	}
+
+	// Renaming back drops the alias it returns to.
+	rename(map[string]any{"name": "rename-test-initech", "new_name": "rename-test-acme"})
+	var aliases string
+	if err := db.QueryRow(`SELECT group_concat(a.alias) FROM entity_aliases a JOIN entities e ON e.id = a.entity_id WHERE e.name = 'rename-test-acme'`).Scan(&aliases); err != nil || aliases != "rename-test-initech" {
+		t.Errorf("aliases after renaming back = %q, %v", aliases, err)
+	}
+}
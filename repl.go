@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const replHelp = `Statements end with ';' and may span lines. SELECTs print as a table;
+INSERT, UPDATE and DELETE go through the same checks as the execute tool.
+
+  .tags NAMES   tags applied to observation inserts, e.g. .tags homelab,career
+  .tags         clear tags
+  .confirm      allow the next UPDATE/DELETE to change any number of rows
+  .schema       print the schema summary
+  .help         show this help
+  .quit         exit
+`
+
+func replCommand(ctx context.Context, db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return runREPL(ctx, db, os.Stdin, os.Stdout)
+}
+
+func runREPL(ctx context.Context, db *sql.DB, in io.Reader, out io.Writer) error {
+	execute := executeHandler(db, nil, nil)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var tags string
+	var confirm bool
+	var stmt strings.Builder
+
+	fmt.Fprintf(out, "connected to %s, .help for help\n", dbURL)
+	for {
+		if stmt.Len() == 0 {
+			fmt.Fprint(out, "engram> ")
+		} else {
+			fmt.Fprint(out, "   ...> ")
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+
+		if stmt.Len() == 0 && strings.HasPrefix(line, ".") {
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch cmd {
+			case ".quit", ".exit":
+				return nil
+			case ".help":
+				fmt.Fprint(out, replHelp)
+			case ".confirm":
+				confirm = true
+				fmt.Fprintln(out, "next statement is confirmed")
+			case ".schema":
+				fmt.Fprint(out, schemaText)
+			case ".tags":
+				tags = strings.TrimSpace(arg)
+				if tags == "" {
+					fmt.Fprintln(out, "tags cleared")
+				} else {
+					fmt.Fprintf(out, "observation inserts will be tagged: %s\n", tags)
+				}
+			default:
+				fmt.Fprintf(out, "unknown command %s, .help for help\n", cmd)
+			}
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if !strings.HasSuffix(line, ";") {
+			continue
+		}
+
+		sqlStr := strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";")
+		stmt.Reset()
+
+		if stmt, err := parseStatement(sqlStr); err == nil && stmt.isWrite() {
+			req := mcp.CallToolRequest{}
+			req.Params.Name = "execute"
+			req.Params.Arguments = map[string]any{"sql": sqlStr, "tags": tags, "confirm": confirm}
+			confirm = false
+			result, err := execute(ctx, req)
+			if err != nil {
+				fmt.Fprintf(out, "error: %v\n", err)
+				continue
+			}
+			printToolResult(out, result)
+			continue
+		}
+
+		if err := validateSQL(sqlStr, false); err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+			continue
+		}
+		cols, rows, err := runQuery(ctx, db, sqlStr)
+		if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+			continue
+		}
+		printTable(out, cols, rows)
+	}
+}
+
+func printToolResult(out io.Writer, result *mcp.CallToolResult) {
+	for _, c := range result.Content {
+		if text, ok := c.(mcp.TextContent); ok {
+			if result.IsError {
+				fmt.Fprint(out, "error: ")
+			}
+			fmt.Fprintln(out, text.Text)
+		}
+	}
+}
+
+func printTable(out io.Writer, cols []string, rows []map[string]any) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	dashes := make([]string, len(cols))
+	for i, c := range cols {
+		dashes[i] = strings.Repeat("-", len(c))
+	}
+	fmt.Fprintln(tw, strings.Join(dashes, "\t"))
+
+	cells := make([]string, len(cols))
+	for _, row := range rows {
+		for i, c := range cols {
+			if row[c] == nil {
+				cells[i] = "NULL"
+			} else {
+				cells[i] = strings.ReplaceAll(fmt.Sprint(row[c]), "\n", " ")
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "(%d rows)\n", len(rows))
+}
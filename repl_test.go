@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPrintTable(t *testing.T) {
+	var buf bytes.Buffer
+	printTable(&buf, []string{"id", "name"}, []map[string]any{
+		{"id": int64(1), "name": "nas"},
+		{"id": int64(2), "name": nil},
+	})
+	want := "id  name\n--  ----\n1   nas\n2   NULL\n(2 rows)\n"
+	if buf.String() != want {
+		t.Errorf("printTable() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestREPL_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer callExecute(db, "DELETE FROM observations WHERE content = 'repl test observation 11223'")
+
+	script := strings.Join([]string{
+		".help",
+		"SELECT name",
+		"FROM tags WHERE name = 'homelab';",
+		"DROP TABLE entities;",
+		"INSERT INTO observations (entity_id, content) VALUES (1, 'repl test observation 11223');",
+		".tags homelab",
+		"INSERT INTO observations (entity_id, content) VALUES (1, 'repl test observation 11223');",
+		".quit",
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := runREPL(context.Background(), db, strings.NewReader(script), &out); err != nil {
+		t.Fatalf("runREPL: %v", err)
+	}
+
+	for _, want := range []string{
+		".tags NAMES",
+		"homelab\n(1 rows)",
+		"error: dangerous operation not allowed",
+		"error: ERR_TAG_REQUIRED: tags parameter is required",
+		"success: observation",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("repl output missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// samplingRerank has ask_memory ask the client's own model, through MCP
+// sampling, to re-rank and summarise the passages it found. The server
+// itself never calls an LLM.
+var samplingRerank = getEnv("ENGRAM_SAMPLING_RERANK", "") == "true"
+
+const rerankTimeout = 60 * time.Second
+
+// sampler sends an MCP sampling request to the calling client.
+type sampler interface {
+	RequestSampling(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+}
+
+// clientSampler samples through the server, refusing up front for clients
+// that did not declare sampling rather than waiting on a request they
+// cannot answer.
+type clientSampler struct {
+	s *server.MCPServer
+}
+
+func (c clientSampler) RequestSampling(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo)
+	if !ok || session.GetClientCapabilities().Sampling == nil {
+		return nil, fmt.Errorf("the client does not support sampling")
+	}
+	return c.s.RequestSampling(ctx, request)
+}
+
+const rerankPrompt = `You rank passages recalled from a memory store by how well they help answer a question.
+Reply with JSON only, no prose and no code fence: {"order": ["obs:3", "obs:1"], "summary": "..."}
+order lists the cite ids of the relevant passages, most useful first, leaving out passages that do not help.
+summary answers the question in one to three sentences from those passages, citing them as [obs:3], or says that they do not answer it.`
+
+// rerankPassages asks the client's model to order passages by relevance to
+// question and summarise them. Passages the model leaves out are dropped.
+func rerankPassages(ctx context.Context, smp sampler, question string, passages []passage) ([]passage, string, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Question: %s\n\nPassages:\n", question)
+	byCite := make(map[string]passage, len(passages))
+	for _, p := range passages {
+		fmt.Fprintf(&sb, "[%s] %s (%s, %s): %s\n", p.Cite, p.Entity, p.EntityType, p.CreatedAt, strings.ReplaceAll(p.Content, "\n", " "))
+		byCite[p.Cite] = p
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rerankTimeout)
+	defer cancel()
+	result, err := smp.RequestSampling(ctx, mcp.CreateMessageRequest{CreateMessageParams: mcp.CreateMessageParams{
+		Messages:     []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: mcp.NewTextContent(sb.String())}},
+		SystemPrompt: rerankPrompt,
+		MaxTokens:    1024,
+	}})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var text string
+	switch c := result.Content.(type) {
+	case mcp.TextContent:
+		text = c.Text
+	case *mcp.TextContent:
+		text = c.Text
+	default:
+		return nil, "", fmt.Errorf("the client's model returned %T, not text", result.Content)
+	}
+	// Models wrap JSON in code fences or a sentence despite being told not
+	// to, so read from the first brace to the last.
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, "", fmt.Errorf("the client's model did not return JSON")
+	}
+	var reply struct {
+		Order   []string `json:"order"`
+		Summary string   `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &reply); err != nil {
+		return nil, "", fmt.Errorf("the client's model returned invalid JSON: %v", err)
+	}
+
+	ranked := []passage{}
+	for _, cite := range reply.Order {
+		if p, ok := byCite[cite]; ok {
+			ranked = append(ranked, p)
+			delete(byCite, cite)
+		}
+	}
+	return ranked, strings.TrimSpace(reply.Summary), nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// samplerFunc answers sampling requests with a function, standing in for
+// the client's model.
+type samplerFunc func(request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+
+func (f samplerFunc) RequestSampling(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	return f(request)
+}
+
+func replyText(text string) samplerFunc {
+	return func(mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+		return &mcp.CreateMessageResult{SamplingMessage: mcp.SamplingMessage{Role: mcp.RoleAssistant, Content: mcp.NewTextContent(text)}}, nil
+	}
+}
+
+func TestRerankPassages(t *testing.T) {
+	passages := []passage{
+		{Cite: "obs:1", Entity: "nas", Content: "runs truenas"},
+		{Cite: "obs:2", Entity: "nas", Content: "has four disks"},
+		{Cite: "obs:3", Entity: "desk", Content: "standing desk"},
+	}
+	tests := []struct {
+		name        string
+		smp         sampler
+		wantCites   []string
+		wantSummary string
+		wantErr     string
+	}{
+		{"reordered", replyText(`{"order": ["obs:2", "obs:1"], "summary": "Four disks [obs:2]."}`), []string{"obs:2", "obs:1"}, "Four disks [obs:2].", ""},
+		{"fenced with unknown and repeated cites", replyText("Sure:\n```json\n{\"order\": [\"obs:3\", \"obs:9\", \"obs:3\"]}\n```"), []string{"obs:3"}, "", ""},
+		{"none relevant", replyText(`{"order": [], "summary": "They do not say."}`), []string{}, "They do not say.", ""},
+		{"prose", replyText("obs:2 is best"), nil, "", "did not return JSON"},
+		{"bad json", replyText(`{"order": "obs:2"}`), nil, "", "invalid JSON"},
+		{"image", samplerFunc(func(mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+			return &mcp.CreateMessageResult{SamplingMessage: mcp.SamplingMessage{Content: mcp.NewImageContent("", "image/png")}}, nil
+		}), nil, "", "not text"},
+		{"declined", samplerFunc(func(mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+			return nil, errors.New("user rejected sampling request")
+		}), nil, "", "user rejected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked, summary, err := rerankPassages(context.Background(), tt.smp, "how many disks?", passages)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("rerankPassages() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rerankPassages: %v", err)
+			}
+			cites := []string{}
+			for _, p := range ranked {
+				cites = append(cites, p.Cite)
+			}
+			if !reflect.DeepEqual(cites, tt.wantCites) || summary != tt.wantSummary {
+				t.Errorf("rerankPassages() = %v %q, want %v %q", cites, summary, tt.wantCites, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestRerankPrompt(t *testing.T) {
+	var got mcp.CreateMessageRequest
+	smp := samplerFunc(func(request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+		got = request
+		return replyText(`{"order": []}`)(request)
+	})
+	rerankPassages(context.Background(), smp, "where is the nas?", []passage{{Cite: "obs:7", Entity: "nas", EntityType: "device", CreatedAt: "2026-05-01T10:00:00Z", Content: "in the\ncloset"}})
+	text := got.Messages[0].Content.(mcp.TextContent).Text
+	if want := "Question: where is the nas?\n\nPassages:\n[obs:7] nas (device, 2026-05-01T10:00:00Z): in the closet\n"; text != want {
+		t.Errorf("prompt = %q, want %q", text, want)
+	}
+	if got.SystemPrompt != rerankPrompt || got.MaxTokens == 0 {
+		t.Errorf("request = %+v, want the rerank system prompt and a token limit", got.CreateMessageParams)
+	}
+}
+
+func TestClientSamplerWithoutSession(t *testing.T) {
+	smp := clientSampler{server.NewMCPServer("test", "1.0.0")}
+	if _, err := smp.RequestSampling(context.Background(), mcp.CreateMessageRequest{}); err == nil || !strings.Contains(err.Error(), "does not support sampling") {
+		t.Errorf("RequestSampling() error = %v, want a refusal", err)
+	}
+}
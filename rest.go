@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// restAddr is ENGRAM_REST_ADDR: when set, serve also answers a small REST
+// API on this address, e.g. "127.0.0.1:8090", for scripts and web UIs. It is
+// served next to MCP on stdio, by the same tool handlers.
+var restAddr = getEnv("ENGRAM_REST_ADDR", "")
+
+// webUI is the browser page served at / next to the REST API, to browse
+// and edit memory without a SQL client. It only calls the REST routes.
+//
+//go:embed webui/index.html
+var webUI []byte
+
+// restToken is ENGRAM_REST_TOKEN: when set, REST requests other than the
+// OpenAPI document need it as a bearer token.
+var restToken = getEnv("ENGRAM_REST_TOKEN", "")
+
+// restParam maps a path or query parameter onto a tool argument. typ and
+// description default to those of the argument in the tool's schema.
+type restParam struct {
+	name, in, arg    string
+	required         bool
+	typ, description string
+}
+
+// restRoute is a REST endpoint backed by a tool. Its arguments come from
+// params, or from a JSON object body, plus fixed; the tool's JSON result is
+// the response.
+type restRoute struct {
+	method, path, tool, summary string
+	params                      []restParam
+	body                        bool
+	// bodySchema describes the body when prepare turns it into arguments
+	// other than the tool's; by default the body is the tool's arguments.
+	bodySchema map[string]any
+	fixed      map[string]any
+	status     int
+	// prepare rewrites the collected arguments into the tool's.
+	prepare func(ctx context.Context, args map[string]any) error
+	// parse turns a text result into a JSON value.
+	parse func(text string) any
+	// missing reports a result that means the resource does not exist.
+	missing func(result []byte) bool
+}
+
+// observationWhere selects observation id, if it is in the caller's
+// namespace.
+func observationWhere(ctx context.Context, id int64) string {
+	where := fmt.Sprintf("id = %d", id)
+	if filter := namespaces.observationFilter(ctx); filter != "" {
+		where += " AND " + filter
+	}
+	return where
+}
+
+// observationID takes the id path parameter out of args.
+func observationID(args map[string]any) (int64, error) {
+	id, err := strconv.ParseInt(fmt.Sprint(args["id"]), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("id must be a positive integer, got %v", args["id"])
+	}
+	delete(args, "id")
+	return id, nil
+}
+
+var restRoutes = []restRoute{
+	{
+		method: http.MethodGet, path: "/entities/{name}", tool: "open_nodes",
+		summary: "Get an entity with its observations",
+		params:  []restParam{{name: "name", in: "path", arg: "names", required: true}},
+		status:  http.StatusOK,
+		missing: func(result []byte) bool {
+			var opened openedNodes
+			return json.Unmarshal(result, &opened) == nil && len(opened.NotFound) > 0
+		},
+	},
+	{
+		method: http.MethodGet, path: "/search", tool: "search_nodes",
+		summary: "Search entities by name, type and observation content",
+		params: []restParam{
+			{name: "q", in: "query", arg: "query", required: true},
+			{name: "include_archived", in: "query", arg: "include_archived"},
+		},
+		status: http.StatusOK,
+	},
+	{
+		method: http.MethodGet, path: "/graph", tool: "read_graph",
+		summary: "Read a page of entities with their observations and the relations starting at them",
+		params: []restParam{
+			{name: "limit", in: "query", arg: "limit"},
+			{name: "offset", in: "query", arg: "offset"},
+			{name: "entity_type", in: "query", arg: "entity_type"},
+			{name: "tags", in: "query", arg: "tags"},
+			{name: "include_archived", in: "query", arg: "include_archived"},
+		},
+		status: http.StatusOK,
+	},
+	{
+		method: http.MethodGet, path: "/tags", tool: "count",
+		summary: "List tags with their number of observations",
+		fixed:   map[string]any{"what": "observations", "group_by": "tag"},
+		status:  http.StatusOK,
+		parse: func(text string) any {
+			tags := []map[string]any{}
+			for _, line := range strings.Split(text, "\n")[1:] {
+				name, n, ok := strings.Cut(line, ": ")
+				if count, err := strconv.ParseInt(n, 10, 64); ok && err == nil {
+					tags = append(tags, map[string]any{"name": name, "observations": count})
+				}
+			}
+			return tags
+		},
+	},
+	{
+		method: http.MethodPost, path: "/observations", tool: "add_observation",
+		summary: "Add an observation to an entity",
+		body:    true,
+		fixed:   map[string]any{"return_record": true},
+		status:  http.StatusCreated,
+	},
+	{
+		method: http.MethodPut, path: "/observations/{id}", tool: "execute",
+		summary: "Replace an observation's content, and its tags when given",
+		params:  []restParam{{name: "id", in: "path", arg: "id", typ: "integer", description: "Observation id"}},
+		body:    true,
+		bodySchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"content": map[string]any{"type": "string", "description": "The new content"},
+				"tags":    map[string]any{"type": "string", "description": "Comma-separated tags replacing the current ones"},
+			},
+			"required": []string{"content"},
+		},
+		status: http.StatusOK,
+		prepare: func(ctx context.Context, args map[string]any) error {
+			id, err := observationID(args)
+			if err != nil {
+				return err
+			}
+			content, _ := args["content"].(string)
+			if strings.TrimSpace(content) == "" {
+				return fmt.Errorf("content is required")
+			}
+			delete(args, "content")
+			args["sql"] = fmt.Sprintf("UPDATE observations SET content = %s WHERE %s", sqlLiteral(content), observationWhere(ctx, id))
+			return nil
+		},
+	},
+	{
+		method: http.MethodDelete, path: "/observations/{id}", tool: "execute",
+		summary: "Delete an observation",
+		params:  []restParam{{name: "id", in: "path", arg: "id", typ: "integer", description: "Observation id"}},
+		status:  http.StatusOK,
+		prepare: func(ctx context.Context, args map[string]any) error {
+			id, err := observationID(args)
+			if err != nil {
+				return err
+			}
+			args["sql"] = fmt.Sprintf("DELETE FROM observations WHERE %s", observationWhere(ctx, id))
+			return nil
+		},
+	},
+	{
+		method: http.MethodPost, path: "/relations", tool: "create_relations",
+		summary: "Create relations between entities",
+		body:    true,
+		status:  http.StatusCreated,
+	},
+}
+
+// restAPI serves restRoutes through the tools registered on an MCP server,
+// wrapped in the same middleware as MCP calls, so both stay in step. Tools
+// are looked up on each request: serve rebuilds some as the database
+// changes.
+type restAPI struct {
+	server     *server.MCPServer
+	middleware []server.ToolHandlerMiddleware
+	token      string
+	oidc       *oidcProvider
+}
+
+// newRESTAPI serves the tools of s. Requests need token, or with oidc set
+// an ID token from its issuer, unless both are empty.
+func newRESTAPI(s *server.MCPServer, token string, oidc *oidcProvider, middleware ...server.ToolHandlerMiddleware) (*restAPI, error) {
+	api := &restAPI{server: s, middleware: middleware, token: token, oidc: oidc}
+	for _, route := range restRoutes {
+		if s.GetTool(route.tool) == nil {
+			return nil, fmt.Errorf("%s %s: tool %s is not registered", route.method, route.path, route.tool)
+		}
+	}
+	return api, nil
+}
+
+func (api *restAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, api.openAPI())
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webUI)
+	})
+	if api.oidc != nil {
+		mux.HandleFunc("GET /auth/login", api.oidc.login)
+		mux.HandleFunc("GET /auth/callback", api.oidc.callback)
+		mux.HandleFunc("GET /auth/logout", api.oidc.logout)
+		mux.Handle("GET /auth/me", api.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, _ := clientName(r.Context())
+			writeJSON(w, http.StatusOK, map[string]string{"identity": name})
+		})))
+	}
+	for _, route := range restRoutes {
+		mux.Handle(route.method+" "+route.path, api.authorize(api.serveRoute(route)))
+	}
+	return mux
+}
+
+// authorize lets a request through with the static token, or with an OIDC
+// identity, which then stands in for the MCP client name.
+func (api *restAPI) authorize(next http.Handler) http.Handler {
+	if api.token == "" && api.oidc == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && api.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		reason := "missing or wrong bearer token, see ENGRAM_REST_TOKEN"
+		if api.oidc != nil {
+			identity, err := api.oidc.identity(r)
+			if err == nil {
+				next.ServeHTTP(w, r.WithContext(withClientName(r.Context(), identity)))
+				return
+			}
+			reason = fmt.Sprintf("not authorized: %v", err)
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		e := restError{Error: reason}
+		if api.oidc != nil && api.oidc.redirectURL != "" {
+			e.Login = "/auth/login"
+		}
+		writeJSON(w, http.StatusUnauthorized, e)
+	})
+}
+
+type restError struct {
+	Error string `json:"error"`
+	// Code is the tool error code, e.g. ERR_NOT_FOUND.
+	Code string `json:"code,omitempty"`
+	// Retryable is set when the same request may succeed later.
+	Retryable bool `json:"retryable,omitempty"`
+	// Login is where a browser can log in, with OIDC.
+	Login string `json:"login,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeToolError answers with a failed tool result, its HTTP status chosen by
+// the result's error code. Retryable failures carry Retry-After.
+func writeToolError(w http.ResponseWriter, result *mcp.CallToolResult, text string) {
+	code := resultErrorCode(result)
+	if code == "" {
+		writeJSON(w, http.StatusBadRequest, restError{Error: text})
+		return
+	}
+	msg := strings.TrimPrefix(text, code+": ")
+	if retryable(code) {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeJSON(w, errorStatus(code), restError{Error: msg, Code: code, Retryable: retryable(code)})
+}
+
+func errorStatus(code string) int {
+	switch code {
+	case codeNotFound:
+		return http.StatusNotFound
+	case codeToolDisabled:
+		return http.StatusForbidden
+	case codeConflict, codeQuotaExceeded, codeConstraintUnique, codeConstraintForeignKey,
+		codeConstraintCheck, codeConstraintNotNull:
+		return http.StatusConflict
+	case codeUnavailable:
+		return http.StatusNotImplemented
+	case codeUpstream:
+		return http.StatusBadGateway
+	case codeDatabase:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+func (api *restAPI) serveRoute(route restRoute) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tool := api.server.GetTool(route.tool)
+		handle := tool.Handler
+		for i := len(api.middleware) - 1; i >= 0; i-- {
+			handle = api.middleware[i](handle)
+		}
+
+		args, err := route.arguments(w, r, tool.Tool.InputSchema)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, restError{Error: err.Error()})
+			return
+		}
+		request := mcp.CallToolRequest{}
+		request.Params.Name = route.tool
+		request.Params.Arguments = args
+
+		result, err := handle(r.Context(), request)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, restError{Error: err.Error()})
+			return
+		}
+		var text strings.Builder
+		for _, c := range result.Content {
+			if t, ok := c.(mcp.TextContent); ok {
+				text.WriteString(t.Text)
+			}
+		}
+		switch {
+		case result.IsError:
+			writeToolError(w, result, text.String())
+		case route.missing != nil && route.missing([]byte(text.String())):
+			writeJSON(w, http.StatusNotFound, restError{Error: fmt.Sprintf("%s not found", r.PathValue("name"))})
+		case route.parse != nil:
+			writeJSON(w, route.status, route.parse(text.String()))
+		case !json.Valid([]byte(text.String())):
+			writeJSON(w, route.status, map[string]string{"result": text.String()})
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(route.status)
+			fmt.Fprintln(w, text.String())
+		}
+	})
+}
+
+// arguments collects the tool arguments for a request. Parameters are
+// converted to the type the tool's schema gives their argument.
+func (route restRoute) arguments(w http.ResponseWriter, r *http.Request, schema mcp.ToolInputSchema) (map[string]any, error) {
+	args := make(map[string]any)
+	if route.body {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&args); err != nil {
+			return nil, fmt.Errorf("body must be a JSON object of %s arguments: %v", route.tool, err)
+		}
+	}
+	for _, p := range route.params {
+		value := r.PathValue(p.name)
+		if p.in == "query" {
+			value = r.URL.Query().Get(p.name)
+		}
+		if value == "" {
+			if p.required {
+				return nil, fmt.Errorf("%s parameter is required", p.name)
+			}
+			continue
+		}
+		typ := p.typ
+		if typ == "" {
+			typ = schemaType(schema, p.arg)
+		}
+		var err error
+		if args[p.arg], err = convertParam(value, typ); err != nil {
+			return nil, fmt.Errorf("%s: %v", p.name, err)
+		}
+	}
+	for k, v := range route.fixed {
+		args[k] = v
+	}
+	if route.prepare != nil {
+		if err := route.prepare(r.Context(), args); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func schemaType(schema mcp.ToolInputSchema, arg string) string {
+	if prop, ok := schema.Properties[arg].(map[string]any); ok {
+		if t, ok := prop["type"].(string); ok {
+			return t
+		}
+	}
+	return "string"
+}
+
+func convertParam(value, typ string) (any, error) {
+	switch typ {
+	case "boolean":
+		return strconv.ParseBool(value)
+	case "number", "integer":
+		return strconv.ParseFloat(value, 64)
+	case "array":
+		return []any{value}, nil
+	}
+	return value, nil
+}
+
+// openAPI describes restRoutes as an OpenAPI 3 document, taking parameter
+// descriptions and request bodies from the tools' input schemas.
+func (api *restAPI) openAPI() map[string]any {
+	errorResponse := map[string]any{
+		"description": "The error, as returned by the tool",
+		"content": map[string]any{"application/json": map[string]any{"schema": map[string]any{
+			"type": "object", "properties": map[string]any{
+				"error":     map[string]any{"type": "string"},
+				"code":      map[string]any{"type": "string", "description": "The tool error code, e.g. ERR_NOT_FOUND"},
+				"retryable": map[string]any{"type": "boolean", "description": "Whether the same request may succeed later"},
+			},
+		}}},
+	}
+	paths := make(map[string]any)
+	for _, route := range restRoutes {
+		tool := api.server.GetTool(route.tool).Tool
+		op := map[string]any{
+			"operationId": route.tool,
+			"summary":     route.summary,
+			"description": tool.Description,
+			"responses": map[string]any{
+				strconv.Itoa(route.status): map[string]any{
+					"description": "The " + route.tool + " result",
+					"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"type": "object"}}},
+				},
+				"400": errorResponse,
+			},
+		}
+		if route.missing != nil {
+			op["responses"].(map[string]any)["404"] = errorResponse
+		}
+		if api.token != "" {
+			op["security"] = []any{map[string]any{"bearer": []any{}}}
+			op["responses"].(map[string]any)["401"] = errorResponse
+		}
+
+		var params []any
+		for _, p := range route.params {
+			schema := map[string]any{"type": "string"}
+			description := p.description
+			if prop, ok := tool.InputSchema.Properties[p.arg].(map[string]any); ok {
+				if t := schemaType(tool.InputSchema, p.arg); t != "array" {
+					schema["type"] = t
+				}
+				if description == "" {
+					description, _ = prop["description"].(string)
+				}
+			}
+			if p.typ != "" {
+				schema["type"] = p.typ
+			}
+			params = append(params, map[string]any{
+				"name": p.name, "in": p.in, "required": p.required || p.in == "path",
+				"description": description, "schema": schema,
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if route.body {
+			schema := route.bodySchema
+			if schema == nil {
+				properties := make(map[string]any)
+				for name, prop := range tool.InputSchema.Properties {
+					if _, ok := route.fixed[name]; !ok {
+						properties[name] = prop
+					}
+				}
+				schema = map[string]any{"type": "object", "properties": properties, "required": tool.InputSchema.Required}
+			}
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schema}},
+			}
+		}
+
+		item, _ := paths[route.path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[route.path] = item
+		}
+		item[strings.ToLower(route.method)] = op
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": "memory-mcp", "version": "1.0.0"},
+		"paths":   paths,
+	}
+	if api.token != "" {
+		doc["components"] = map[string]any{"securitySchemes": map[string]any{
+			"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+		}}
+	}
+	return doc
+}
+
+// serveREST answers the REST API on ln until ctx is done.
+func serveREST(ctx context.Context, ln net.Listener, handler http.Handler) {
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	log.Printf("REST API listening on %s", ln.Addr())
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Printf("REST API stopped: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// echoTool registers a tool that returns its arguments as JSON.
+func echoTool(s *server.MCPServer, tool mcp.Tool) {
+	s.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if request.Params.Name == "count" {
+			return mcp.NewToolResultText("observations by tag:\nhomelab: 3\ncareer: 1\n"), nil
+		}
+		switch request.GetString("query", "") {
+		case "fail":
+			return mcp.NewToolResultError("query failed"), nil
+		case "down":
+			return toolError(codeDatabase, "search failed: connection refused"), nil
+		}
+		if names := request.GetStringSlice("names", nil); len(names) > 0 && names[0] == "Nobody" {
+			return graphResult(openedNodes{NotFound: names}), nil
+		}
+		return graphResult(request.GetArguments()), nil
+	})
+}
+
+func echoREST(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	s := server.NewMCPServer("test", "1.0.0")
+	echoTool(s, mcp.NewTool("open_nodes", mcp.WithArray("names", mcp.Description("Entity names"))))
+	echoTool(s, mcp.NewTool("search_nodes",
+		mcp.WithString("query", mcp.Required(), mcp.Description("Search text")),
+		mcp.WithBoolean("include_archived"),
+	))
+	echoTool(s, mcp.NewTool("add_observation",
+		mcp.WithString("entity", mcp.Required()),
+		mcp.WithString("content", mcp.Required()),
+		mcp.WithBoolean("return_record"),
+	))
+	echoTool(s, mcp.NewTool("read_graph", mcp.WithNumber("limit"), mcp.WithNumber("offset"),
+		mcp.WithString("entity_type"), mcp.WithString("tags"), mcp.WithBoolean("include_archived")))
+	echoTool(s, mcp.NewTool("count", mcp.WithString("what"), mcp.WithString("group_by")))
+	echoTool(s, mcp.NewTool("execute", mcp.WithString("sql"), mcp.WithString("tags")))
+	echoTool(s, mcp.NewTool("create_relations", mcp.WithArray("relations")))
+	api, err := newRESTAPI(s, token, nil)
+	if err != nil {
+		t.Fatalf("newRESTAPI: %v", err)
+	}
+	srv := httptest.NewServer(api.handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRESTRoutes(t *testing.T) {
+	srv := echoREST(t, "")
+	tests := []struct {
+		method, path, body string
+		status             int
+		want               map[string]any
+	}{
+		{"GET", "/entities/Home%20NAS", "", http.StatusOK, map[string]any{"names": []any{"Home NAS"}}},
+		{"GET", "/entities/Nobody", "", http.StatusNotFound, map[string]any{"error": "Nobody not found"}},
+		{"GET", "/search?q=nas&include_archived=true", "", http.StatusOK, map[string]any{"query": "nas", "include_archived": true}},
+		{"GET", "/search?q=nas&include_archived=maybe", "", http.StatusBadRequest, nil},
+		{"GET", "/search", "", http.StatusBadRequest, map[string]any{"error": "q parameter is required"}},
+		{"GET", "/search?q=fail", "", http.StatusBadRequest, map[string]any{"error": "query failed"}},
+		{"GET", "/search?q=down", "", http.StatusServiceUnavailable,
+			map[string]any{"error": "search failed: connection refused", "code": codeDatabase, "retryable": true}},
+		{"POST", "/observations", `{"entity": "Home NAS", "content": "Runs ZFS"}`, http.StatusCreated,
+			map[string]any{"entity": "Home NAS", "content": "Runs ZFS", "return_record": true}},
+		{"POST", "/observations", `["not", "an", "object"]`, http.StatusBadRequest, nil},
+		{"GET", "/graph?limit=5&tags=homelab", "", http.StatusOK, map[string]any{"limit": 5, "tags": "homelab"}},
+		{"GET", "/graph?limit=five", "", http.StatusBadRequest, nil},
+		{"PUT", "/observations/7", `{"content": "It's ZFS", "tags": "homelab"}`, http.StatusOK,
+			map[string]any{"sql": "UPDATE observations SET content = 'It''s ZFS' WHERE id = 7", "tags": "homelab", "content": nil, "id": nil}},
+		{"PUT", "/observations/7", `{"tags": "homelab"}`, http.StatusBadRequest, map[string]any{"error": "content is required"}},
+		{"DELETE", "/observations/7", "", http.StatusOK, map[string]any{"sql": "DELETE FROM observations WHERE id = 7", "id": nil}},
+		{"DELETE", "/observations/1%20OR%201", "", http.StatusBadRequest, nil},
+		{"POST", "/relations", `{"relations": [{"from": "a", "to": "b", "relationType": "knows"}]}`, http.StatusCreated,
+			map[string]any{"relations": []any{map[string]any{"from": "a", "to": "b", "relationType": "knows"}}}},
+		{"DELETE", "/observations", "", http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		var got map[string]any
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: status %d, want %d (%v)", tt.method, tt.path, resp.StatusCode, tt.status, got)
+			continue
+		}
+		for k, v := range tt.want {
+			if g, _ := json.Marshal(got[k]); string(g) != mustJSON(v) {
+				t.Errorf("%s %s: %s = %s, want %s", tt.method, tt.path, k, g, mustJSON(v))
+			}
+		}
+	}
+}
+
+func TestRESTTagsAndPage(t *testing.T) {
+	srv := echoREST(t, "")
+	resp, err := http.Get(srv.URL + "/tags")
+	if err != nil {
+		t.Fatalf("GET /tags: %v", err)
+	}
+	var tags []map[string]any
+	json.NewDecoder(resp.Body).Decode(&tags)
+	resp.Body.Close()
+	if got := mustJSON(tags); got != `[{"name":"homelab","observations":3},{"name":"career","observations":1}]` {
+		t.Errorf("GET /tags = %s", got)
+	}
+
+	resp, err = http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("GET / = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	resp, err = http.Get(srv.URL + "/nowhere")
+	if err != nil {
+		t.Fatalf("GET /nowhere: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /nowhere = %d, want 404", resp.StatusCode)
+	}
+}
+
+func mustJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestRESTToken(t *testing.T) {
+	srv := echoREST(t, "s3cret")
+	for _, tt := range []struct {
+		path, auth string
+		status     int
+	}{
+		{"/search?q=nas", "", http.StatusUnauthorized},
+		{"/search?q=nas", "Bearer wrong", http.StatusUnauthorized},
+		{"/search?q=nas", "Bearer s3cret", http.StatusOK},
+		{"/openapi.json", "", http.StatusOK},
+	} {
+		req, _ := http.NewRequest("GET", srv.URL+tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s with %q: status %d, want %d", tt.path, tt.auth, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestRESTOpenAPI(t *testing.T) {
+	srv := echoREST(t, "s3cret")
+	resp, err := http.Get(srv.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("GET /openapi.json: %v", err)
+	}
+	defer resp.Body.Close()
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name, In, Description string
+				Required              bool
+				Schema                struct{ Type string }
+			}
+			RequestBody *struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]any
+						Required   []string
+					}
+				}
+			} `json:"requestBody"`
+			Security  []any
+			Responses map[string]any
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Paths) != 7 {
+		t.Fatalf("document = %+v", doc)
+	}
+
+	search := doc.Paths["/search"]["get"]
+	if search.OperationID != "search_nodes" || len(search.Parameters) != 2 || search.Security == nil {
+		t.Errorf("/search = %+v", search)
+	}
+	if q := search.Parameters[0]; q.Name != "q" || q.Description != "Search text" || !q.Required || q.Schema.Type != "string" {
+		t.Errorf("q parameter = %+v", q)
+	}
+	if a := search.Parameters[1]; a.Schema.Type != "boolean" || a.Required {
+		t.Errorf("include_archived parameter = %+v", a)
+	}
+	if name := doc.Paths["/entities/{name}"]["get"].Parameters[0]; name.In != "path" || name.Schema.Type != "string" || !name.Required {
+		t.Errorf("name parameter = %+v", name)
+	}
+	if _, ok := doc.Paths["/entities/{name}"]["get"].Responses["404"]; !ok {
+		t.Error("/entities/{name} has no 404 response")
+	}
+
+	add := doc.Paths["/observations"]["post"]
+	if add.RequestBody == nil {
+		t.Fatal("/observations has no request body")
+	}
+	body := add.RequestBody.Content["application/json"].Schema
+	if _, ok := body.Properties["return_record"]; ok || body.Properties["content"] == nil || len(body.Required) != 2 {
+		t.Errorf("/observations body = %+v", body)
+	}
+	if _, ok := add.Responses["201"]; !ok {
+		t.Errorf("/observations responses = %v", add.Responses)
+	}
+
+	update := doc.Paths["/observations/{id}"]["put"]
+	if id := update.Parameters[0]; id.Schema.Type != "integer" || id.Description != "Observation id" {
+		t.Errorf("id parameter = %+v", id)
+	}
+	if body := update.RequestBody.Content["application/json"].Schema; body.Properties["sql"] != nil || body.Properties["content"] == nil {
+		t.Errorf("PUT /observations/{id} body = %+v", body)
+	}
+	if _, ok := doc.Paths["/observations/{id}"]["delete"]; !ok {
+		t.Error("DELETE /observations/{id} is missing")
+	}
+}
+
+func TestRESTAPIMissingTool(t *testing.T) {
+	if _, err := newRESTAPI(server.NewMCPServer("test", "1.0.0"), "", nil); err == nil {
+		t.Error("expected an error for routes without their tool")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// restoreStep undoes one logged change.
+type restoreStep struct {
+	change change
+	sql    string
+	args   []any
+}
+
+// restorePlan is what rolling back to a point in time takes: the steps,
+// newest change first, and the updates it cannot undo because the row's
+// earlier state predates the change log.
+type restorePlan struct {
+	steps    []restoreStep
+	unknown  []change
+	logStart string
+}
+
+func (p restorePlan) String() string {
+	counts := map[string]int{}
+	for _, s := range p.steps {
+		counts[s.change.Table+" "+s.change.Op]++
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d changes to undo", len(p.steps))
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n  %s: %d", k, counts[k])
+	}
+	if len(p.unknown) > 0 {
+		fmt.Fprintf(&b, "\n%d updates left as they are: their rows' earlier state predates the change log", len(p.unknown))
+	}
+	return b.String()
+}
+
+// parseRestoreTime reads the point in time to restore to, in the server's
+// local time zone unless it carries an offset, as the UTC text changed_at
+// holds.
+func parseRestoreTime(s string) (string, error) {
+	for _, layout := range dueLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.UTC().Format(time.DateTime), nil
+		}
+	}
+	return "", fmt.Errorf("invalid -to %q, use a time like '2024-06-01T12:00' or '2024-06-01T12:00:00Z'", s)
+}
+
+// planRestore reads the changes logged after cutoff, up to change id upTo,
+// and works out the statements that undo them.
+func planRestore(ctx context.Context, q queryer, cutoff string, upTo int64) (restorePlan, error) {
+	var plan restorePlan
+	rows, err := q.QueryContext(ctx, "SELECT COALESCE(MIN(changed_at), '') FROM changes")
+	if err != nil {
+		return plan, err
+	}
+	if rows.Next() {
+		rows.Scan(&plan.logStart)
+	}
+	rows.Close()
+
+	rows, err = q.QueryContext(ctx, `SELECT id, op, table_name, row_id, payload, changed_at FROM changes
+		WHERE changed_at > ? AND id <= ? ORDER BY id DESC`, cutoff, upTo)
+	if err != nil {
+		return plan, err
+	}
+	var changes []change
+	for rows.Next() {
+		var c change
+		var payload string
+		if err := rows.Scan(&c.ID, &c.Op, &c.Table, &c.RowID, &payload, &c.ChangedAt); err != nil {
+			rows.Close()
+			return plan, err
+		}
+		c.Payload = json.RawMessage(payload)
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return plan, err
+	}
+
+	for _, c := range changes {
+		row, err := payloadRow(c.Payload)
+		if err == nil {
+			err = decodeBlobs(c.Table, row)
+		}
+		if err != nil {
+			return plan, fmt.Errorf("change %d: %v", c.ID, err)
+		}
+		step := restoreStep{change: c}
+		switch c.Op {
+		case "insert":
+			where, args := rowKey(c, row)
+			step.sql = fmt.Sprintf("DELETE FROM %s WHERE %s", quoteIdent(c.Table), where)
+			step.args = args
+		case "delete":
+			cols, args := rowColumns(row)
+			quoted := make([]string, len(cols))
+			for i, col := range cols {
+				quoted[i] = quoteIdent(col)
+			}
+			step.sql = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(c.Table), strings.Join(quoted, ", "), placeholders(len(cols)))
+			step.args = args
+		case "update":
+			earlier, ok, err := earlierState(ctx, q, c)
+			if err != nil {
+				return plan, fmt.Errorf("change %d: %v", c.ID, err)
+			}
+			if !ok {
+				plan.unknown = append(plan.unknown, c)
+				continue
+			}
+			cols, args := rowColumns(earlier)
+			sets := make([]string, len(cols))
+			for i, col := range cols {
+				sets[i] = quoteIdent(col) + " = ?"
+			}
+			where, keyArgs := rowKey(c, row)
+			step.sql = fmt.Sprintf("UPDATE %s SET %s WHERE %s", quoteIdent(c.Table), strings.Join(sets, ", "), where)
+			step.args = append(args, keyArgs...)
+		default:
+			return plan, fmt.Errorf("change %d: unknown op %q", c.ID, c.Op)
+		}
+		plan.steps = append(plan.steps, step)
+	}
+	return plan, nil
+}
+
+// earlierState returns the row as the last change before c left it.
+func earlierState(ctx context.Context, q queryer, c change) (map[string]any, bool, error) {
+	rows, err := q.QueryContext(ctx, "SELECT payload FROM changes WHERE table_name = ? AND row_id = ? AND id < ? ORDER BY id DESC LIMIT 1",
+		c.Table, c.RowID, c.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, false, rows.Err()
+	}
+	var payload string
+	if err := rows.Scan(&payload); err != nil {
+		return nil, false, err
+	}
+	row, err := payloadRow(json.RawMessage(payload))
+	if err == nil {
+		err = decodeBlobs(c.Table, row)
+	}
+	return row, err == nil, err
+}
+
+// payloadRow decodes a change payload, keeping integers as int64 so ids
+// and counts are written back unchanged.
+func payloadRow(payload json.RawMessage) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var row map[string]any
+	if err := dec.Decode(&row); err != nil {
+		return nil, err
+	}
+	for k, v := range row {
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				row[k] = i
+			} else {
+				row[k], _ = n.Float64()
+			}
+		}
+	}
+	return row, nil
+}
+
+// rowColumns returns the row's columns in a stable order with their values.
+func rowColumns(row map[string]any) ([]string, []any) {
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	args := make([]any, len(cols))
+	for i, col := range cols {
+		args[i] = row[col]
+	}
+	return cols, args
+}
+
+// rowKey matches the changed row: by id for tables that have one, and by
+// every column for link tables such as observation_tags.
+func rowKey(c change, row map[string]any) (string, []any) {
+	if _, ok := row["id"]; ok {
+		return "id = ?", []any{c.RowID}
+	}
+	cols, args := rowColumns(row)
+	conds := make([]string, len(cols))
+	for i, col := range cols {
+		conds[i] = quoteIdent(col) + " IS ?"
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// restoreTo rolls the database back to cutoff by undoing, newest first,
+// every logged change made after it, in one transaction. The undo is itself
+// logged, so it can be synced or rolled back in turn. With dryRun nothing is
+// written.
+func restoreTo(ctx context.Context, db *sql.DB, cutoff string, dryRun bool) (restorePlan, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return restorePlan{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Parents and children come back in whatever order they were logged,
+	// so foreign keys are checked at commit.
+	if _, err := tx.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON"); err != nil {
+		return restorePlan{}, err
+	}
+	upTo, err := maxChangeID(ctx, tx)
+	if err != nil {
+		return restorePlan{}, err
+	}
+	plan, err := planRestore(ctx, tx, cutoff, upTo)
+	if err != nil || dryRun {
+		return plan, err
+	}
+	for _, s := range plan.steps {
+		if _, err := tx.ExecContext(ctx, s.sql, s.args...); err != nil {
+			return plan, fmt.Errorf("undo change %d (%s on %s row %d): %w", s.change.ID, s.change.Op, s.change.Table, s.change.RowID, execFailure(err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return plan, fmt.Errorf("failed to commit: %v", err)
+	}
+	return plan, nil
+}
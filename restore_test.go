@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRestoreTime(t *testing.T) {
+	tests := []struct {
+		input, want string
+		wantErr     bool
+	}{
+		{"2024-06-01T12:00:00Z", "2024-06-01 12:00:00", false},
+		{"2024-06-01T14:00:00+02:00", "2024-06-01 12:00:00", false},
+		{"2024-06-01T12:00", time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local).UTC().Format(time.DateTime), false},
+		{"2024-06-01", time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local).UTC().Format(time.DateTime), false},
+		{"yesterday", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseRestoreTime(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRestoreTime(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	row, err := payloadRow(json.RawMessage(`{"id": 7, "content": "Runs ZFS", "confidence": 0.5}`))
+	if err != nil {
+		t.Fatalf("payloadRow: %v", err)
+	}
+	if row["id"] != int64(7) || row["confidence"] != 0.5 {
+		t.Errorf("payloadRow = %#v", row)
+	}
+	if where, args := rowKey(change{RowID: 7}, row); where != "id = ?" || len(args) != 1 || args[0] != int64(7) {
+		t.Errorf("rowKey = %q %v", where, args)
+	}
+
+	link, _ := payloadRow(json.RawMessage(`{"observation_id": 3, "tag_id": 2}`))
+	if where, args := rowKey(change{RowID: 3}, link); where != `"observation_id" IS ? AND "tag_id" IS ?` || args[0] != int64(3) || args[1] != int64(2) {
+		t.Errorf("rowKey = %q %v", where, args)
+	}
+}
+
+func TestRestoreTo_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'restore test %'")
+	ctx := context.Background()
+
+	var entityID int64
+	if err := db.QueryRow("SELECT id FROM entities ORDER BY id LIMIT 1").Scan(&entityID); err != nil {
+		t.Skipf("no entities to test with: %v", err)
+	}
+	insert := func(content string) int64 {
+		t.Helper()
+		result, err := db.Exec("INSERT INTO observations (entity_id, content) VALUES (?, ?)", entityID, content)
+		if err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		return id
+	}
+	edited := insert("restore test edited")
+	deleted := insert("restore test deleted")
+	archived := insert("restore test archived")
+	if _, err := db.Exec("INSERT INTO attachments (observation_id, name, data) VALUES (?, 'restore.bin', X'00ff10')", deleted); err != nil {
+		t.Fatalf("insert attachment: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO reminders (observation_id, due_at) VALUES (?, '2030-01-01 09:00:00')", deleted); err != nil {
+		t.Fatalf("insert reminder: %v", err)
+	}
+	defer db.Exec("DELETE FROM attachments WHERE name = 'restore.bin'")
+	defer db.Exec("DELETE FROM reminders WHERE due_at = '2030-01-01 09:00:00'")
+	defer db.Exec("DELETE FROM archived_observations WHERE content LIKE 'restore test %'")
+
+	// changed_at has one-second resolution.
+	time.Sleep(1100 * time.Millisecond)
+	var cutoff string
+	if err := db.QueryRow("SELECT CURRENT_TIMESTAMP").Scan(&cutoff); err != nil {
+		t.Fatalf("read time: %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	added := insert("restore test added")
+	if _, err := db.Exec("UPDATE observations SET content = 'restore test edited twice' WHERE id = ?", edited); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	// The foreign key cascade deletes them along with the observation.
+	for _, table := range []string{"attachments", "reminders"} {
+		if _, err := db.Exec("DELETE FROM "+table+" WHERE observation_id = ?", deleted); err != nil {
+			t.Fatalf("delete %s: %v", table, err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM observations WHERE id = ?", deleted); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	// Compaction moves an observation to archived_observations under its id.
+	if _, err := db.Exec(`INSERT INTO archived_observations (id, entity_id, content, visibility, created_at)
+		SELECT id, entity_id, content, visibility, created_at FROM observations WHERE id = ?`, archived); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM observations WHERE id = ?", archived); err != nil {
+		t.Fatalf("delete archived: %v", err)
+	}
+
+	plan, err := restoreTo(ctx, db, cutoff, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(plan.steps) < 3 || !strings.Contains(plan.String(), "observations delete: 2") || !strings.Contains(plan.String(), "archived_observations insert: 1") {
+		t.Errorf("plan = %s", plan)
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM observations WHERE id = ?", added).Scan(&n)
+	if n != 1 {
+		t.Fatal("dry run wrote changes")
+	}
+
+	if _, err := restoreTo(ctx, db, cutoff, false); err != nil {
+		t.Fatalf("restoreTo: %v", err)
+	}
+	db.QueryRow("SELECT count(*) FROM observations WHERE id = ?", added).Scan(&n)
+	if n != 0 {
+		t.Error("observation added after the cutoff is still there")
+	}
+	var content string
+	if err := db.QueryRow("SELECT content FROM observations WHERE id = ?", edited).Scan(&content); err != nil || content != "restore test edited" {
+		t.Errorf("edited observation = %q, %v", content, err)
+	}
+	if err := db.QueryRow("SELECT content FROM observations WHERE id = ?", deleted).Scan(&content); err != nil || content != "restore test deleted" {
+		t.Errorf("deleted observation = %q, %v", content, err)
+	}
+	if err := db.QueryRow("SELECT content FROM observations WHERE id = ?", archived).Scan(&content); err != nil || content != "restore test archived" {
+		t.Errorf("archived observation = %q, %v", content, err)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM archived_observations WHERE id = ?", archived).Scan(&n); err != nil || n != 0 {
+		t.Errorf("archived rows left = %d, %v", n, err)
+	}
+	var data []byte
+	if err := db.QueryRow("SELECT data FROM attachments WHERE observation_id = ?", deleted).Scan(&data); err != nil || !bytes.Equal(data, []byte{0x00, 0xff, 0x10}) {
+		t.Errorf("attachment of deleted observation = %x, %v", data, err)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM reminders WHERE observation_id = ?", deleted).Scan(&n); err != nil || n != 1 {
+		t.Errorf("reminders of deleted observation = %d, %v", n, err)
+	}
+}
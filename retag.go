@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const maxRetagListed = 20
+
+var (
+	observationUpdate = regexp.MustCompile(`(?i)^\s*UPDATE(?:\s+OR\s+\w+)?\s+observations\b`)
+	setClause         = regexp.MustCompile(`(?is)\bSET\b(.*?)(?:\bWHERE\b|\bRETURNING\b|$)`)
+	contentAssignment = regexp.MustCompile(`(?i)\bcontent\s*=`)
+)
+
+// rewritesContent reports whether sqlStr is an UPDATE of observations that
+// sets their content, which may leave their tags describing the old text.
+func rewritesContent(sqlStr string) bool {
+	if !observationUpdate.MatchString(sqlStr) {
+		return false
+	}
+	m := setClause.FindStringSubmatch(stringLiteral.ReplaceAllString(sqlStr, "''"))
+	return m != nil && contentAssignment.MatchString(m[1])
+}
+
+// execContentUpdate runs an UPDATE that rewrites observation content in a
+// transaction, finding the rows it changed from the change log so any
+// statement shape works. With tagIDs set, those rows' tags are replaced.
+// Like execConfirmed, it refuses to touch more than maxUnconfirmedRows rows
+// unless confirmed.
+func execContentUpdate(ctx context.Context, db beginner, sqlStr string, confirm bool, tagIDs []int64) ([]int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var before int64
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM changes").Scan(&before); err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx, sqlStr)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := result.RowsAffected(); !confirm && affected > int64(maxUnconfirmedRows) {
+		return nil, &unconfirmedError{affected: affected}
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT DISTINCT row_id FROM changes WHERE id > ? AND table_name = 'observations' AND op = 'update' ORDER BY row_id", before)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if tagIDs != nil {
+		for _, id := range ids {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM observation_tags WHERE observation_id = ?", id); err != nil {
+				return nil, err
+			}
+			if err := linkTags(ctx, tx, id, tagIDs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ids, tx.Commit()
+}
+
+// currentTags describes the tags of rewritten observations, so the caller
+// can see whether they still fit the new content.
+func currentTags(ctx context.Context, db *sql.DB, ids []int64) (string, error) {
+	listed := ids[:min(len(ids), maxRetagListed)]
+	args := make([]any, len(listed))
+	for i, id := range listed {
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, `SELECT o.id, o.content,
+			COALESCE((SELECT group_concat(t.name, ', ') FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), '')
+		FROM observations o WHERE o.id IN (`+placeholders(len(listed))+`) ORDER BY o.id`, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	for rows.Next() {
+		var id int64
+		var content, tags string
+		if err := rows.Scan(&id, &content, &tags); err != nil {
+			return "", err
+		}
+		if tags == "" {
+			tags = "no tags"
+		}
+		fmt.Fprintf(&sb, "- observation %d (%s): %s\n", id, tags, strings.ReplaceAll(content, "\n", " "))
+	}
+	if len(ids) > len(listed) {
+		fmt.Fprintf(&sb, "- and %d more\n", len(ids)-len(listed))
+	}
+	return sb.String(), rows.Err()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestRewritesContent(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"UPDATE observations SET content = 'x' WHERE id = 1", true},
+		{"update or replace Observations set visibility = 'public', content='x' where id = 1", true},
+		{"UPDATE observations SET visibility = 'public' WHERE content = 'x'", false},
+		{"UPDATE observations\nSET content = replace(content, 'a', 'b')", true},
+		{"UPDATE observations SET visibility = 'public' WHERE id = 1", false},
+		{"UPDATE observations SET source = 'content = x' WHERE id = 1", false},
+		{"UPDATE entities SET content = 'x' WHERE id = 1", false},
+		{"DELETE FROM observations WHERE content = 'x'", false},
+	}
+
+	for _, tt := range tests {
+		if got := rewritesContent(tt.sql); got != tt.want {
+			t.Errorf("rewritesContent(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestContentUpdateTags_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'retag test %'")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT id FROM observations WHERE content LIKE 'retag test %')")
+
+	var entity string
+	if err := db.QueryRow("SELECT name FROM entities WHERE id = 1").Scan(&entity); err != nil {
+		t.Fatalf("lookup entity: %v", err)
+	}
+
+	var ids []int64
+	for _, content := range []string{"retag test espresso", "retag test grinder"} {
+		result, err := callTool(addObservationHandler(db, nil), "add_observation", map[string]any{"entity": entity, "content": content, "tags": "drinks"})
+		if err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+		var id int64
+		fmt.Sscanf(result.Content[0].(mcp.TextContent).Text, "success: observation %d", &id)
+		ids = append(ids, id)
+	}
+
+	execute := func(args map[string]any) string {
+		t.Helper()
+		result, err := callTool(executeHandler(db, nil, nil), "execute", args)
+		if err != nil || result.IsError {
+			t.Fatalf("execute: %v %v", err, result.Content)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+
+	got := execute(map[string]any{"sql": fmt.Sprintf("UPDATE observations SET content = 'retag test homelab switch' WHERE id = %d", ids[0])})
+	if !strings.Contains(got, "1 observation(s) updated") || !strings.Contains(got, fmt.Sprintf("observation %d (drinks): retag test homelab switch", ids[0])) {
+		t.Errorf("expected a warning listing the current tags, got:\n%s", got)
+	}
+
+	got = execute(map[string]any{"sql": fmt.Sprintf("UPDATE observations SET content = 'retag test homelab switch' WHERE id = %d", ids[0]), "tags": "homelab"})
+	if !strings.Contains(got, "retagged with tags: homelab") {
+		t.Errorf("expected a retag, got:\n%s", got)
+	}
+	var tags string
+	db.QueryRow("SELECT group_concat(t.name) FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = ?", ids[0]).Scan(&tags)
+	if tags != "homelab" {
+		t.Errorf("tags after retag = %q, want homelab", tags)
+	}
+	db.QueryRow("SELECT group_concat(t.name) FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = ?", ids[1]).Scan(&tags)
+	if tags != "drinks" {
+		t.Errorf("untouched observation has tags %q, want drinks", tags)
+	}
+
+	if got := execute(map[string]any{"sql": "UPDATE observations SET content = 'x' WHERE content = 'retag test nothing'"}); got != "success: 0 row(s) affected" {
+		t.Errorf("update of no rows = %q", got)
+	}
+	result, _ := callTool(executeHandler(db, nil, nil), "execute", map[string]any{
+		"sql": fmt.Sprintf("UPDATE observations SET content = 'retag test x' WHERE id = %d", ids[1]), "tags": "nonexistent_tag_xyz",
+	})
+	if !result.IsError {
+		t.Errorf("expected an unknown tag to be rejected")
+	}
+}
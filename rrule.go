@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrencePeriods bounds how far recurrence.after looks: a daily rule
+// for over a century.
+const maxRecurrencePeriods = 50000
+
+// recurrenceShorthands are the words add_reminder's repeat takes besides an
+// RRULE.
+var recurrenceShorthands = map[string]string{
+	"daily":    "FREQ=DAILY",
+	"weekly":   "FREQ=WEEKLY",
+	"weekdays": "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+	"monthly":  "FREQ=MONTHLY",
+	"yearly":   "FREQ=YEARLY",
+	"annually": "FREQ=YEARLY",
+}
+
+var rruleDays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// weekdayNum is a BYDAY entry: a weekday, and in a monthly rule optionally
+// which one of the month, e.g. 1MO for the first Monday or -1FR for the
+// last Friday. n is 0 for every such weekday.
+type weekdayNum struct {
+	n   int
+	day time.Weekday
+}
+
+func (w weekdayNum) String() string {
+	if w.n == 0 {
+		return rruleDays[w.day]
+	}
+	return strconv.Itoa(w.n) + rruleDays[w.day]
+}
+
+// recurrence is the subset of RFC 5545 recurrence rules reminders repeat
+// by: FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL. Occurrences keep
+// the first one's wall-clock time in the server's time zone.
+type recurrence struct {
+	freq       string
+	interval   int
+	byDay      []weekdayNum
+	byMonthDay []int
+	count      int
+	until      time.Time
+}
+
+// parseRecurrence reads an RRULE, with or without its "RRULE:" prefix, or
+// one of recurrenceShorthands.
+func parseRecurrence(s string) (*recurrence, error) {
+	s = strings.TrimSpace(s)
+	if rule, ok := recurrenceShorthands[strings.ToLower(s)]; ok {
+		s = rule
+	}
+	s = strings.TrimPrefix(strings.ToUpper(s), "RRULE:")
+	r := &recurrence{interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid repeat %q: want an RRULE such as FREQ=WEEKLY;BYDAY=MO, or daily, weekly, weekdays, monthly or yearly", s)
+		}
+		var err error
+		switch key {
+		case "FREQ":
+			if !slices.Contains([]string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}, value) {
+				return nil, fmt.Errorf("unsupported FREQ %s, want DAILY, WEEKLY, MONTHLY or YEARLY", value)
+			}
+			r.freq = value
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(value); err != nil || r.interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %s, want a positive number", value)
+			}
+		case "COUNT":
+			if r.count, err = strconv.Atoi(value); err != nil || r.count < 1 {
+				return nil, fmt.Errorf("invalid COUNT %s, want a positive number", value)
+			}
+		case "UNTIL":
+			if r.until, err = parseUntil(value); err != nil {
+				return nil, err
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				w, err := parseWeekdayNum(d)
+				if err != nil {
+					return nil, err
+				}
+				r.byDay = append(r.byDay, w)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %s, want 1 to 31 or -1 to -31", d)
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "WKST":
+			if value != "MO" {
+				return nil, fmt.Errorf("unsupported WKST %s, weeks start on MO", value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s; repeat supports FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL", key)
+		}
+	}
+
+	switch {
+	case r.freq == "":
+		return nil, fmt.Errorf("repeat %q has no FREQ", s)
+	case r.count > 0 && !r.until.IsZero():
+		return nil, fmt.Errorf("repeat %q has both COUNT and UNTIL; use one", s)
+	case len(r.byMonthDay) > 0 && r.freq != "MONTHLY":
+		return nil, fmt.Errorf("BYMONTHDAY needs FREQ=MONTHLY")
+	case len(r.byDay) > 0 && r.freq == "YEARLY":
+		return nil, fmt.Errorf("BYDAY is not supported with FREQ=YEARLY")
+	case len(r.byDay) > 0 && len(r.byMonthDay) > 0:
+		return nil, fmt.Errorf("use BYDAY or BYMONTHDAY, not both")
+	}
+	if r.freq != "MONTHLY" {
+		for _, w := range r.byDay {
+			if w.n != 0 {
+				return nil, fmt.Errorf("BYDAY %s counts weekdays of a month, which needs FREQ=MONTHLY", w)
+			}
+		}
+	}
+	return r, nil
+}
+
+func parseWeekdayNum(s string) (weekdayNum, error) {
+	if len(s) >= 2 {
+		if i := slices.Index(rruleDays, s[len(s)-2:]); i >= 0 {
+			w := weekdayNum{day: time.Weekday(i)}
+			if num := s[:len(s)-2]; num != "" {
+				n, err := strconv.Atoi(num)
+				if err != nil || n == 0 || n < -5 || n > 5 {
+					return w, fmt.Errorf("invalid BYDAY %s, want e.g. MO, 1MO or -1FR", s)
+				}
+				w.n = n
+			}
+			return w, nil
+		}
+	}
+	return weekdayNum{}, fmt.Errorf("invalid BYDAY %s, want e.g. MO, 1MO or -1FR", s)
+}
+
+// parseUntil reads an UNTIL date, which includes its whole day, or time.
+func parseUntil(s string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", s, time.Local); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"20060102", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.AddDate(0, 0, 1).Add(-time.Second), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %s, want a date such as 20261231", s)
+}
+
+// String is the rule in canonical RRULE form, as stored.
+func (r *recurrence) String() string {
+	parts := []string{"FREQ=" + r.freq}
+	if r.interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.interval))
+	}
+	if len(r.byDay) > 0 {
+		days := make([]string, len(r.byDay))
+		for i, w := range r.byDay {
+			days[i] = w.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.byMonthDay) > 0 {
+		days := make([]string, len(r.byMonthDay))
+		for i, d := range r.byMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.count))
+	}
+	if !r.until.IsZero() {
+		parts = append(parts, "UNTIL="+r.until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// after returns the first occurrence of a series starting at start that is
+// later than t, and its number in the series counting from 1. ok is false
+// when the series has ended by then.
+func (r *recurrence) after(start, t time.Time) (next time.Time, n int, ok bool) {
+	start = start.In(time.Local)
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		for _, c := range r.period(start, period) {
+			if c.Before(start) {
+				continue
+			}
+			n++
+			if (r.count > 0 && n > r.count) || (!r.until.IsZero() && c.After(r.until)) {
+				return time.Time{}, 0, false
+			}
+			if c.After(t) {
+				return c, n, true
+			}
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+// period returns the occurrences in the k-th period (day, week, month or
+// year, times INTERVAL) from start's, in order.
+func (r *recurrence) period(start time.Time, k int) []time.Time {
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, start.Hour(), start.Minute(), start.Second(), 0, time.Local)
+	}
+	step := k * r.interval
+	switch r.freq {
+	case "DAILY":
+		c := at(start.Year(), start.Month(), start.Day()+step)
+		if len(r.byDay) > 0 && !slices.ContainsFunc(r.byDay, func(w weekdayNum) bool { return w.day == c.Weekday() }) {
+			return nil
+		}
+		return []time.Time{c}
+	case "WEEKLY":
+		monday := start.Day() - (int(start.Weekday())+6)%7 + 7*step
+		days := []time.Weekday{start.Weekday()}
+		if len(r.byDay) > 0 {
+			days = days[:0]
+			for _, w := range r.byDay {
+				days = append(days, w.day)
+			}
+		}
+		var out []time.Time
+		for _, d := range days {
+			out = append(out, at(start.Year(), start.Month(), monday+(int(d)+6)%7))
+		}
+		return sortedTimes(out)
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, time.Local)
+		y, m := first.Year(), first.Month()
+		last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.Local).Day()
+		var days []int
+		switch {
+		case len(r.byMonthDay) > 0:
+			for _, d := range r.byMonthDay {
+				if d < 0 {
+					d += last + 1
+				}
+				if d >= 1 && d <= last {
+					days = append(days, d)
+				}
+			}
+		case len(r.byDay) > 0:
+			for _, w := range r.byDay {
+				// The first day of the month that is w.day, then every week on.
+				d := 1 + (int(w.day)-int(first.Weekday())+7)%7
+				var matches []int
+				for ; d <= last; d += 7 {
+					matches = append(matches, d)
+				}
+				switch {
+				case w.n == 0:
+					days = append(days, matches...)
+				case w.n > 0 && w.n <= len(matches):
+					days = append(days, matches[w.n-1])
+				case w.n < 0 && -w.n <= len(matches):
+					days = append(days, matches[len(matches)+w.n])
+				}
+			}
+		case start.Day() <= last:
+			days = []int{start.Day()}
+		}
+		var out []time.Time
+		for _, d := range days {
+			out = append(out, at(y, m, d))
+		}
+		return sortedTimes(out)
+	case "YEARLY":
+		// A series starting on 29 February only occurs in leap years.
+		c := at(start.Year()+step, start.Month(), start.Day())
+		if c.Day() != start.Day() {
+			return nil
+		}
+		return []time.Time{c}
+	}
+	return nil
+}
+
+func sortedTimes(ts []time.Time) []time.Time {
+	slices.SortFunc(ts, func(a, b time.Time) int { return a.Compare(b) })
+	return slices.CompactFunc(ts, func(a, b time.Time) bool { return a.Equal(b) })
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{"weekly", "FREQ=WEEKLY", ""},
+		{"Weekdays", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", ""},
+		{"RRULE:freq=monthly;bymonthday=1,-1", "FREQ=MONTHLY;BYMONTHDAY=1,-1", ""},
+		{"FREQ=WEEKLY;INTERVAL=1;BYDAY=SA;WKST=MO", "FREQ=WEEKLY;BYDAY=SA", ""},
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=6", "FREQ=MONTHLY;BYDAY=-1FR;COUNT=6", ""},
+		{"FREQ=DAILY;UNTIL=20260107T090000Z", "FREQ=DAILY;UNTIL=20260107T090000Z", ""},
+		{"fortnightly", "", "invalid repeat"},
+		{"FREQ=HOURLY", "", "unsupported FREQ HOURLY"},
+		{"FREQ=YEARLY;BYMONTH=3", "", "unsupported rule part BYMONTH"},
+		{"INTERVAL=2", "", "has no FREQ"},
+		{"FREQ=WEEKLY;BYDAY=1MO", "", "needs FREQ=MONTHLY"},
+		{"FREQ=WEEKLY;BYMONTHDAY=3", "", "BYMONTHDAY needs FREQ=MONTHLY"},
+		{"FREQ=DAILY;COUNT=3;UNTIL=20260101", "", "both COUNT and UNTIL"},
+		{"FREQ=MONTHLY;BYDAY=XX", "", "invalid BYDAY XX"},
+		{"FREQ=DAILY;INTERVAL=0", "", "invalid INTERVAL 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseRecurrence(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceAfter(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		rule  string
+		start string
+		want  []string
+		// ends is set when the series has no occurrence after want.
+		ends bool
+	}{
+		{"daily", "2026-01-05 09:00", []string{"2026-01-05", "2026-01-06", "2026-01-07"}, false},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "2026-01-05 09:00", []string{"2026-01-05", "2026-01-08", "2026-01-19", "2026-01-22"}, false},
+		// A series starting on a Saturday begins on the next weekday.
+		{"weekdays", "2026-01-10 09:00", []string{"2026-01-12", "2026-01-13", "2026-01-14"}, false},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2026-01-05 09:00", []string{"2026-01-31", "2026-02-28", "2026-03-31"}, false},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "2026-01-05 09:00", []string{"2026-01-30", "2026-02-27", "2026-03-27"}, false},
+		{"FREQ=MONTHLY;BYDAY=2TU", "2026-01-05 09:00", []string{"2026-01-13", "2026-02-10", "2026-03-10"}, false},
+		// Months without a 31st are skipped, as RFC 5545 does.
+		{"monthly", "2026-01-31 09:00", []string{"2026-01-31", "2026-03-31", "2026-05-31"}, false},
+		{"yearly", "2028-02-29 09:00", []string{"2028-02-29", "2032-02-29"}, false},
+		{"FREQ=DAILY;COUNT=2", "2026-01-05 09:00", []string{"2026-01-05", "2026-01-06"}, true},
+		{"FREQ=DAILY;UNTIL=20260107", "2026-01-05 09:00", []string{"2026-01-05", "2026-01-06", "2026-01-07"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rec, err := parseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := day(tt.start)
+			var got []string
+			for at, i := start.Add(-time.Second), 1; i <= len(tt.want)+1; i++ {
+				next, n, ok := rec.after(start, at)
+				if !ok {
+					break
+				}
+				if n != i || next.Format("15:04") != "09:00" {
+					t.Errorf("occurrence %d: n = %d at %s", i, n, next)
+				}
+				got = append(got, next.Format(time.DateOnly))
+				at = next
+			}
+			if ended := len(got) == len(tt.want); ended != tt.ends {
+				t.Errorf("got %v, want %v with ends %v", got, tt.want, tt.ends)
+			}
+			if len(got) > len(tt.want) {
+				got = got[:len(tt.want)]
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
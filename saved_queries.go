@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// parseQueryParams replaces the :name placeholders of a saved query with ?
+// and returns the parameter names in order, once per use. Placeholders inside
+// string literals, quoted identifiers and comments are left alone.
+func parseQueryParams(sqlStr string) (string, []string) {
+	var b strings.Builder
+	var names []string
+	for i := 0; i < len(sqlStr); {
+		c := sqlStr[i]
+		var end int
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end = skipPast(sqlStr, i+1, string(c))
+		case c == '[':
+			end = skipPast(sqlStr, i+1, "]")
+		case strings.HasPrefix(sqlStr[i:], "--"):
+			end = skipPast(sqlStr, i+2, "\n")
+		case strings.HasPrefix(sqlStr[i:], "/*"):
+			end = skipPast(sqlStr, i+2, "*/")
+		case c == ':' && i+1 < len(sqlStr) && isParamStart(sqlStr[i+1]):
+			j := i + 1
+			for j < len(sqlStr) && (isParamStart(sqlStr[j]) || sqlStr[j] >= '0' && sqlStr[j] <= '9') {
+				j++
+			}
+			names = append(names, sqlStr[i+1:j])
+			b.WriteByte('?')
+			i = j
+			continue
+		default:
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		b.WriteString(sqlStr[i:end])
+		i = end
+	}
+	return b.String(), names
+}
+
+// skipPast returns the index just after the first end at or after from, or
+// the length of s when an unterminated literal or comment runs to the end.
+func skipPast(s string, from int, end string) int {
+	if n := strings.Index(s[from:], end); n >= 0 {
+		return from + n + len(end)
+	}
+	return len(s)
+}
+
+func isParamStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// bindQueryParams returns the arguments for a saved query's placeholders.
+// Every placeholder needs a value and every value must be used, so a typo in
+// a parameter name fails instead of silently matching nothing.
+func bindQueryParams(names []string, params map[string]any) ([]any, error) {
+	used := make(map[string]bool, len(names))
+	var missing []string
+	args := make([]any, 0, len(names))
+	for _, name := range names {
+		v, ok := params[name]
+		if !ok {
+			if !used[name] {
+				missing = append(missing, name)
+			}
+			used[name] = true
+			continue
+		}
+		used[name] = true
+		switch v := v.(type) {
+		case nil, string:
+			args = append(args, v)
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				args = append(args, int64(v))
+			} else {
+				args = append(args, v)
+			}
+		case bool:
+			if v {
+				args = append(args, 1)
+			} else {
+				args = append(args, 0)
+			}
+		default:
+			return nil, fmt.Errorf("parameter %q: values must be strings, numbers, booleans or null", name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing parameters: %s", strings.Join(missing, ", "))
+	}
+
+	var unknown []string
+	for name := range params {
+		if !used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameters: %s", strings.Join(unknown, ", "))
+	}
+	return args, nil
+}
+
+// uniqueParams lists parameter names once each, in order of first use.
+func uniqueParams(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var unique []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// registerSavedQueries adds the save_query and run_saved_query tools.
+func registerSavedQueries(s *server.MCPServer, db *sql.DB, snaps *snapshots, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("save_query",
+		mcp.WithDescription(`Save a SELECT query under a name so a recall pattern you use often can be run with run_saved_query instead of being rewritten each conversation.
+
+Use :name placeholders for values that change between runs, e.g.
+  SELECT o.id, o.content FROM observations o
+  JOIN observation_tags ot ON ot.observation_id = o.id JOIN tags t ON t.id = ot.tag_id
+  WHERE t.name = :tag AND o.content LIKE 'TODO%'
+
+Saving under an existing name replaces that query. List saved queries with:
+  SELECT name, description, sql FROM saved_queries`),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name to run the query by, e.g. 'open-todos'"),
+		),
+		mcp.WithString("sql",
+			mcp.Required(),
+			mcp.Description("SQL SELECT statement, with :name placeholders for parameters"),
+		),
+		mcp.WithString("description",
+			mcp.Description("What the query finds, e.g. 'open TODOs with a given tag'"),
+		),
+	), saveQueryHandler(db))
+
+	s.AddTool(mcp.NewTool("run_saved_query",
+		mcp.WithDescription("Run a query saved with save_query, passing a value for each of its :name placeholders."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the saved query"),
+		),
+		mcp.WithObject("params",
+			mcp.Description(`Placeholder values by name, e.g. {"tag": "homelab"}`),
+		),
+		mcp.WithBoolean("keep_duplicates",
+			mcp.Description("Return every row instead of merging rows that repeat an observation"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), runSavedQueryHandler(db, snaps, scopes))
+}
+
+func saveQueryHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			return toolError(codeInvalidArgument, "name parameter is required, e.g. 'open-homelab-todos'"), nil
+		}
+		sqlStr := strings.TrimSpace(request.GetString("sql", ""))
+		if sqlStr == "" {
+			return toolError(codeInvalidArgument, "sql parameter is required"), nil
+		}
+		if err := validateSQL(sqlStr, false); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		_, err := db.ExecContext(ctx, `INSERT INTO saved_queries (name, sql, description) VALUES (?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET sql = excluded.sql, description = excluded.description, updated_at = CURRENT_TIMESTAMP`,
+			name, sqlStr, nullIfEmpty(strings.TrimSpace(request.GetString("description", ""))))
+		if err != nil {
+			return execError(err, codeDatabase), nil
+		}
+
+		msg := fmt.Sprintf("success: saved query '%s'", name)
+		if _, names := parseQueryParams(sqlStr); len(names) > 0 {
+			msg += fmt.Sprintf(" with parameters: %s", strings.Join(uniqueParams(names), ", "))
+		}
+		return mcp.NewToolResultText(msg), nil
+	}
+}
+
+func runSavedQueryHandler(db *sql.DB, snaps *snapshots, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := strings.TrimSpace(request.GetString("name", ""))
+		if name == "" {
+			return toolError(codeInvalidArgument, "name parameter is required"), nil
+		}
+		params, _ := request.GetArguments()["params"].(map[string]any)
+
+		var saved string
+		err := db.QueryRowContext(ctx, "SELECT sql FROM saved_queries WHERE name = ?", name).Scan(&saved)
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "saved query '%s' does not exist, list them with: SELECT name, description, sql FROM saved_queries", name), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "error reading saved query '%s': %v", name, err), nil
+		}
+		// Saved queries can be written with execute, so check them again.
+		if err := validateSQL(saved, false); err != nil {
+			return toolErrorf(errorCode(err, codeInvalidArgument), "saved query '%s': %v", name, err), nil
+		}
+
+		sqlStr, names := parseQueryParams(saved)
+		args, err := bindQueryParams(names, params)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidArgument), "saved query '%s': %v", name, err), nil
+		}
+		return readQuery(ctx, db, snaps, scopes, newProjection("", ""), request.GetBool("keep_duplicates", false), sqlStr, args...), nil
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseQueryParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       string
+		wantSQL   string
+		wantNames []string
+	}{
+		{"none", "SELECT * FROM tags", "SELECT * FROM tags", nil},
+		{"params", "SELECT * FROM tags WHERE name = :tag LIMIT :n1", "SELECT * FROM tags WHERE name = ? LIMIT ?", []string{"tag", "n1"}},
+		{"repeated", "SELECT :x, :x", "SELECT ?, ?", []string{"x", "x"}},
+		{"string literal", "SELECT ':no' || 'it''s :no', :yes", "SELECT ':no' || 'it''s :no', ?", []string{"yes"}},
+		{"quoted identifier", `SELECT ":no", [a:no] FROM t`, `SELECT ":no", [a:no] FROM t`, nil},
+		{"comments", "SELECT 1 -- :no\n, :yes /* :no */", "SELECT 1 -- :no\n, ? /* :no */", []string{"yes"}},
+		{"time literal", "SELECT '12:30', :at", "SELECT '12:30', ?", []string{"at"}},
+		{"unterminated", "SELECT ':no", "SELECT ':no", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, names := parseQueryParams(tt.sql)
+			if got != tt.wantSQL || !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("parseQueryParams() = %q %v, want %q %v", got, names, tt.wantSQL, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestBindQueryParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		params  map[string]any
+		want    []any
+		wantErr string
+	}{
+		{"values", []string{"tag", "n", "x", "tag"}, map[string]any{"tag": "homelab", "n": float64(5), "x": 0.5},
+			[]any{"homelab", int64(5), 0.5, "homelab"}, ""},
+		{"bool and null", []string{"b", "v"}, map[string]any{"b": true, "v": nil}, []any{1, nil}, ""},
+		{"missing", []string{"tag", "n", "tag"}, map[string]any{}, nil, "missing parameters: tag, n"},
+		{"unknown", []string{"tag"}, map[string]any{"tag": "a", "tga": "b"}, nil, "unknown parameters: tga"},
+		{"object", []string{"tag"}, map[string]any{"tag": map[string]any{}}, nil, "values must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bindQueryParams(tt.names, tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("bindQueryParams() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bindQueryParams() = %#v, %v, want %#v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSavedQueries_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM saved_queries WHERE name LIKE 'saved-test-%'")
+	defer db.Exec("DELETE FROM entities WHERE name = 'saved-test-nas'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE '%saved test %'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('saved-test-nas', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, args := range []map[string]any{
+		{"content": "TODO saved test replace fan", "visibility": "public"},
+		{"content": "TODO saved test rotate keys", "visibility": "private"},
+		{"content": "saved test runs truenas", "visibility": "public"},
+	} {
+		args["entity"], args["tags"] = "saved-test-nas", "homelab"
+		if result, err := callTool(addObservationHandler(db, nil), "add_observation", args); err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+	}
+
+	save := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		result, err := callTool(saveQueryHandler(db), "save_query", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+	result := save(map[string]any{
+		"name": "saved-test-todos",
+		"sql": `SELECT o.content FROM observations o JOIN entities e ON e.id = o.entity_id
+			JOIN observation_tags ot ON ot.observation_id = o.id JOIN tags t ON t.id = ot.tag_id
+			WHERE e.name = :entity AND t.name = :tag AND o.content LIKE 'TODO%' ORDER BY o.id`,
+		"description": "open TODOs on an entity",
+	})
+	if result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "with parameters: entity, tag") {
+		t.Fatalf("save_query: %v", result.Content)
+	}
+
+	t.Run("rejects writes", func(t *testing.T) {
+		if result := save(map[string]any{"name": "saved-test-delete", "sql": "DELETE FROM tags"}); !result.IsError {
+			t.Error("expected a write to be rejected")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		scope   string
+		args    map[string]any
+		want    []string
+		wantNot []string
+		wantErr bool
+	}{
+		{"all", "", map[string]any{"name": "saved-test-todos", "params": map[string]any{"entity": "saved-test-nas", "tag": "homelab"}},
+			[]string{"replace fan", "rotate keys"}, []string{"truenas"}, false},
+		{"visibility", "public", map[string]any{"name": "saved-test-todos", "params": map[string]any{"entity": "saved-test-nas", "tag": "homelab"}},
+			[]string{"replace fan"}, []string{"rotate keys"}, false},
+		{"missing params", "", map[string]any{"name": "saved-test-todos", "params": map[string]any{"entity": "saved-test-nas"}}, nil, nil, true},
+		{"unknown query", "", map[string]any{"name": "saved-test-nope"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scopes *visibilityScopes
+			if tt.scope != "" {
+				var err error
+				if scopes, err = parseVisibilityScopes(tt.scope, ""); err != nil {
+					t.Fatalf("parseVisibilityScopes: %v", err)
+				}
+			}
+			result, err := callTool(runSavedQueryHandler(db, nil, scopes), "run_saved_query", tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v, want %v: %v", result.IsError, tt.wantErr, result.Content)
+			}
+			text := result.Content[0].(mcp.TextContent).Text
+			for _, w := range tt.want {
+				if !strings.Contains(text, w) {
+					t.Errorf("expected %q in %s", w, text)
+				}
+			}
+			for _, w := range tt.wantNot {
+				if strings.Contains(text, w) {
+					t.Errorf("unexpected %q in %s", w, text)
+				}
+			}
+		})
+	}
+
+	t.Run("save replaces", func(t *testing.T) {
+		save(map[string]any{"name": "saved-test-todos", "sql": "SELECT 'replaced' AS v"})
+		result, _ := callTool(runSavedQueryHandler(db, nil, nil), "run_saved_query", map[string]any{"name": "saved-test-todos"})
+		if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "replaced") {
+			t.Errorf("unexpected result %s", text)
+		}
+	})
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type migration struct {
+	version    int
+	statements []string
+}
+
+// migrations are applied in order at startup. Append new entries; never edit
+// one that has already shipped.
+var migrations = []migration{
+	{1, []string{
+		`CREATE TABLE IF NOT EXISTS entities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE CHECK (length(trim(name)) > 0),
+			entity_type TEXT NOT NULL CHECK (length(trim(entity_type)) > 0),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS observations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			content TEXT NOT NULL CHECK (length(trim(content)) > 0),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS relations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			from_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			to_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			relation_type TEXT NOT NULL CHECK (length(trim(relation_type)) > 0),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE CHECK (length(trim(name)) > 0),
+			description TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS observation_tags (
+			observation_id INTEGER NOT NULL REFERENCES observations(id) ON DELETE CASCADE,
+			tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			PRIMARY KEY (observation_id, tag_id)
+		)`,
+	}},
+	{2, []string{
+		`CREATE TABLE IF NOT EXISTS unknowns (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			question TEXT NOT NULL CHECK (length(trim(question)) > 0),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			resolved_at TIMESTAMP,
+			observation_id INTEGER REFERENCES observations(id) ON DELETE SET NULL
+		)`,
+	}},
+	{3, []string{
+		`ALTER TABLE observations ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'shared', 'public'))`,
+	}},
+	{4, []string{
+		`ALTER TABLE observations ADD COLUMN source TEXT`,
+		`ALTER TABLE observations ADD COLUMN conversation_id TEXT`,
+		`ALTER TABLE observations ADD COLUMN source_url TEXT`,
+	}},
+	{5, []string{
+		`ALTER TABLE observations ADD COLUMN confidence REAL CHECK (confidence IS NULL OR (confidence >= 0 AND confidence <= 1))`,
+		`ALTER TABLE relations ADD COLUMN confidence REAL CHECK (confidence IS NULL OR (confidence >= 0 AND confidence <= 1))`,
+	}},
+	{6, []string{
+		`CREATE TABLE IF NOT EXISTS session_notes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id TEXT NOT NULL,
+			entity_id INTEGER REFERENCES entities(id) ON DELETE CASCADE,
+			content TEXT NOT NULL CHECK (length(trim(content)) > 0),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS session_notes_session_id ON session_notes (session_id)`,
+	}},
+	{7, changeLogStatements()},
+	{8, []string{
+		`CREATE INDEX IF NOT EXISTS changes_row ON changes (table_name, row_id)`,
+		`CREATE TABLE IF NOT EXISTS sync_state (
+			peer TEXT PRIMARY KEY,
+			pulled INTEGER NOT NULL,
+			pushed INTEGER NOT NULL,
+			synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}},
+	{9, []string{
+		`CREATE TABLE IF NOT EXISTS attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			observation_id INTEGER NOT NULL REFERENCES observations(id) ON DELETE CASCADE,
+			name TEXT NOT NULL CHECK (length(trim(name)) > 0),
+			mime_type TEXT,
+			size INTEGER,
+			sha256 TEXT,
+			data BLOB,
+			path TEXT,
+			url TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CHECK ((data IS NOT NULL) + (path IS NOT NULL) + (url IS NOT NULL) = 1)
+		)`,
+		`CREATE INDEX IF NOT EXISTS attachments_observation_id ON attachments (observation_id)`,
+	}},
+	{10, append([]string{
+		`ALTER TABLE observations ADD COLUMN metadata TEXT CHECK (metadata IS NULL OR json_valid(metadata))`,
+		// Recreate the change log triggers so payloads carry metadata.
+		`DROP TRIGGER IF EXISTS changes_observations_insert`,
+		`DROP TRIGGER IF EXISTS changes_observations_update`,
+		`DROP TRIGGER IF EXISTS changes_observations_delete`,
+	}, changeTriggers("observations", "id", "id", "entity_id", "content", "visibility", "source", "conversation_id", "source_url", "confidence", "metadata", "created_at")...)},
+	{11, []string{
+		`CREATE TABLE IF NOT EXISTS saved_queries (
+			name TEXT PRIMARY KEY CHECK (length(trim(name)) > 0),
+			sql TEXT NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}},
+	{12, []string{
+		`CREATE TABLE IF NOT EXISTS reminders (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			observation_id INTEGER NOT NULL REFERENCES observations(id) ON DELETE CASCADE,
+			due_at TIMESTAMP NOT NULL,
+			completed_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS reminders_open_due_at ON reminders (due_at) WHERE completed_at IS NULL`,
+	}},
+	{13, append([]string{
+		`ALTER TABLE entities ADD COLUMN archived_at TIMESTAMP`,
+		// Recreate the change log triggers so payloads carry archived_at.
+		`DROP TRIGGER IF EXISTS changes_entities_insert`,
+		`DROP TRIGGER IF EXISTS changes_entities_update`,
+		`DROP TRIGGER IF EXISTS changes_entities_delete`,
+	}, changeTriggers("entities", "id", "id", "name", "entity_type", "created_at", "archived_at")...)},
+	{14, append([]string{
+		`ALTER TABLE entities ADD COLUMN pinned_at TIMESTAMP`,
+		// Recreate the change log triggers so payloads carry pinned_at.
+		`DROP TRIGGER IF EXISTS changes_entities_insert`,
+		`DROP TRIGGER IF EXISTS changes_entities_update`,
+		`DROP TRIGGER IF EXISTS changes_entities_delete`,
+	}, changeTriggers("entities", "id", "id", "name", "entity_type", "created_at", "archived_at", "pinned_at")...)},
+	{15, []string{
+		`CREATE TABLE IF NOT EXISTS observation_embeddings (
+			observation_id INTEGER PRIMARY KEY REFERENCES observations(id) ON DELETE CASCADE,
+			model TEXT NOT NULL,
+			dimensions INTEGER NOT NULL,
+			embedding BLOB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS observation_embeddings_model ON observation_embeddings (model)`,
+		// An edited observation is embedded again on the next pass.
+		`CREATE TRIGGER IF NOT EXISTS observation_embeddings_stale AFTER UPDATE OF content ON observations BEGIN
+			DELETE FROM observation_embeddings WHERE observation_id = NEW.id;
+		END`,
+	}},
+	{16, append([]string{
+		`CREATE TABLE IF NOT EXISTS entity_tags (
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			PRIMARY KEY (entity_id, tag_id)
+		)`,
+	}, changeTriggers("entity_tags", "entity_id", "entity_id", "tag_id")...)},
+	{17, append([]string{
+		`ALTER TABLE relations ADD COLUMN weight REAL CHECK (weight IS NULL OR (weight >= 0 AND weight <= 1))`,
+		`ALTER TABLE relations ADD COLUMN properties TEXT CHECK (properties IS NULL OR json_valid(properties))`,
+		// Recreate the change log triggers so payloads carry weight and properties.
+		`DROP TRIGGER IF EXISTS changes_relations_insert`,
+		`DROP TRIGGER IF EXISTS changes_relations_update`,
+		`DROP TRIGGER IF EXISTS changes_relations_delete`,
+	}, changeTriggers("relations", "id", "id", "from_id", "to_id", "relation_type", "confidence", "weight", "properties", "created_at")...)},
+	{18, append(append([]string{
+		`CREATE TABLE IF NOT EXISTS contents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			sha256 TEXT NOT NULL UNIQUE,
+			body TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE observations ADD COLUMN content_sha256 TEXT REFERENCES contents(sha256)`,
+		`CREATE INDEX IF NOT EXISTS observations_content_sha256 ON observations (content_sha256) WHERE content_sha256 IS NOT NULL`,
+		// Recreate the change log triggers so payloads carry content_sha256.
+		`DROP TRIGGER IF EXISTS changes_observations_insert`,
+		`DROP TRIGGER IF EXISTS changes_observations_update`,
+		`DROP TRIGGER IF EXISTS changes_observations_delete`,
+	}, changeTriggers("observations", "id", "id", "entity_id", "content", "content_sha256", "visibility", "source", "conversation_id", "source_url", "confidence", "metadata", "created_at")...),
+		changeTriggers("contents", "id", "id", "sha256", "body", "size", "created_at")...)},
+	{19, []string{
+		`CREATE TABLE IF NOT EXISTS observation_languages (
+			observation_id INTEGER PRIMARY KEY REFERENCES observations(id) ON DELETE CASCADE,
+			language TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS observation_languages_language ON observation_languages (language)`,
+		// An edited observation is detected again on the next pass.
+		`CREATE TRIGGER IF NOT EXISTS observation_languages_stale AFTER UPDATE OF content ON observations BEGIN
+			DELETE FROM observation_languages WHERE observation_id = NEW.id;
+		END`,
+	}},
+	{20, append(ftsStatements("observations", "content"), ftsStatements("entities", "name")...)},
+	{21, []string{
+		// Observations folded into a summary by compaction, with their tag
+		// names, under the id they had.
+		`CREATE TABLE IF NOT EXISTS archived_observations (
+			id INTEGER PRIMARY KEY,
+			summary_id INTEGER REFERENCES observations(id) ON DELETE SET NULL,
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			content TEXT NOT NULL,
+			visibility TEXT NOT NULL,
+			confidence REAL,
+			source TEXT,
+			conversation_id TEXT,
+			source_url TEXT,
+			metadata TEXT,
+			tags TEXT,
+			created_at TIMESTAMP,
+			archived_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS archived_observations_summary_id ON archived_observations (summary_id)`,
+		`CREATE INDEX IF NOT EXISTS archived_observations_entity_id ON archived_observations (entity_id)`,
+	}},
+	{22, []string{
+		// Tables added with define_table, with their columns as JSON.
+		`CREATE TABLE IF NOT EXISTS user_tables (
+			name TEXT PRIMARY KEY,
+			description TEXT NOT NULL,
+			columns TEXT NOT NULL CHECK (json_valid(columns)),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}},
+	{23, []string{
+		// Votes from the feedback tool on passages ask_memory returned.
+		`CREATE TABLE IF NOT EXISTS recall_feedback (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			observation_id INTEGER NOT NULL REFERENCES observations(id) ON DELETE CASCADE,
+			helpful INTEGER NOT NULL CHECK (helpful IN (0, 1)),
+			question TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS recall_feedback_observation_id ON recall_feedback (observation_id)`,
+	}},
+	{24, append([]string{
+		// Tag hierarchy: a subcategory points at its broader tag.
+		`ALTER TABLE tags ADD COLUMN parent_id INTEGER REFERENCES tags(id) ON DELETE SET NULL`,
+		// Recreate the change log triggers so payloads carry parent_id.
+		`DROP TRIGGER IF EXISTS changes_tags_insert`,
+		`DROP TRIGGER IF EXISTS changes_tags_update`,
+		`DROP TRIGGER IF EXISTS changes_tags_delete`,
+	}, changeTriggers("tags", "id", "id", "name", "description", "parent_id", "created_at")...)},
+	{25, []string{
+		// How often each statement shape was sent to the SQL tools.
+		`CREATE TABLE IF NOT EXISTS query_shapes (
+			fingerprint TEXT NOT NULL,
+			tool TEXT NOT NULL,
+			shape TEXT NOT NULL,
+			calls INTEGER NOT NULL DEFAULT 0,
+			errors INTEGER NOT NULL DEFAULT 0,
+			total_ms INTEGER NOT NULL DEFAULT 0,
+			first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (fingerprint, tool)
+		)`,
+	}},
+	{26, []string{
+		// Rows returned by reads or changed by writes, for the average per call.
+		`ALTER TABLE query_shapes ADD COLUMN total_rows INTEGER NOT NULL DEFAULT 0`,
+	}},
+	{27, []string{
+		// ask_memory answers as returned, kept for get_recall_snapshot.
+		`CREATE TABLE IF NOT EXISTS recall_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			question TEXT NOT NULL,
+			client TEXT,
+			levels TEXT NOT NULL,
+			result TEXT NOT NULL CHECK (json_valid(result)),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}},
+	{28, append([]string{
+		// Typed facts about an entity, one value per name. value has no
+		// declared type, so numbers stay numbers.
+		`CREATE TABLE IF NOT EXISTS entity_attributes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			value NOT NULL,
+			value_type TEXT NOT NULL CHECK (value_type IN ('text', 'number', 'boolean', 'date', 'email', 'url', 'ip')),
+			source TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (entity_id, name)
+		)`,
+		`CREATE INDEX IF NOT EXISTS entity_attributes_name ON entity_attributes (name)`,
+	}, changeTriggers("entity_attributes", "id", "id", "entity_id", "name", "value", "value_type", "source", "created_at", "updated_at")...)},
+	{29, []string{
+		// Values entity attributes had before they were changed or removed,
+		// from when they were set (valid_from) until then (valid_to).
+		`CREATE TABLE IF NOT EXISTS entity_attribute_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			value NOT NULL,
+			value_type TEXT NOT NULL,
+			source TEXT,
+			valid_from TIMESTAMP,
+			valid_to TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS entity_attribute_history_entity ON entity_attribute_history (entity_id, name)`,
+		`CREATE TRIGGER IF NOT EXISTS entity_attributes_history_update AFTER UPDATE ON entity_attributes
+		WHEN OLD.value IS NOT NEW.value OR OLD.value_type IS NOT NEW.value_type BEGIN
+			INSERT INTO entity_attribute_history (entity_id, name, value, value_type, source, valid_from)
+			VALUES (OLD.entity_id, OLD.name, OLD.value, OLD.value_type, OLD.source, OLD.updated_at);
+		END`,
+		// Attributes deleted along with their entity leave no history: the
+		// entity is gone by the time its attributes are.
+		`CREATE TRIGGER IF NOT EXISTS entity_attributes_history_delete AFTER DELETE ON entity_attributes
+		WHEN EXISTS (SELECT 1 FROM entities WHERE id = OLD.entity_id) BEGIN
+			INSERT INTO entity_attribute_history (entity_id, name, value, value_type, source, valid_from)
+			VALUES (OLD.entity_id, OLD.name, OLD.value, OLD.value_type, OLD.source, OLD.updated_at);
+		END`,
+	}},
+	{30, append([]string{
+		`ALTER TABLE entities ADD COLUMN latitude REAL CHECK (latitude BETWEEN -90 AND 90)`,
+		`ALTER TABLE entities ADD COLUMN longitude REAL CHECK (longitude BETWEEN -180 AND 180)`,
+		`CREATE INDEX IF NOT EXISTS entities_location ON entities (latitude, longitude) WHERE latitude IS NOT NULL`,
+		// Recreate the change log triggers so payloads carry the location.
+		`DROP TRIGGER IF EXISTS changes_entities_insert`,
+		`DROP TRIGGER IF EXISTS changes_entities_update`,
+		`DROP TRIGGER IF EXISTS changes_entities_delete`,
+	}, changeTriggers("entities", "id", "id", "name", "entity_type", "created_at", "archived_at", "pinned_at", "latitude", "longitude")...)},
+	{31, []string{
+		// A repeating reminder's rule, when its series started and which
+		// occurrence of it the row is. Completing one adds the next.
+		`ALTER TABLE reminders ADD COLUMN rrule TEXT`,
+		`ALTER TABLE reminders ADD COLUMN series_start TIMESTAMP`,
+		`ALTER TABLE reminders ADD COLUMN occurrence INTEGER`,
+	}},
+	{32, []string{
+		// When the ENGRAM_DUE_WEBHOOK webhook for a reminder was sent.
+		`ALTER TABLE reminders ADD COLUMN notified_at TIMESTAMP`,
+	}},
+	{33, []string{
+		// How often the recall tools returned each observation and entity,
+		// per day, for heatmap.
+		`CREATE TABLE IF NOT EXISTS observation_access (
+			observation_id INTEGER NOT NULL REFERENCES observations(id) ON DELETE CASCADE,
+			day TEXT NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			last_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (observation_id, day)
+		)`,
+		`CREATE TABLE IF NOT EXISTS entity_access (
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			day TEXT NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 0,
+			last_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (entity_id, day)
+		)`,
+		`CREATE INDEX IF NOT EXISTS observation_access_day ON observation_access (day)`,
+		`CREATE INDEX IF NOT EXISTS entity_access_day ON entity_access (day)`,
+	}},
+	{34, []string{
+		// When review_stale last found an observation still true.
+		`CREATE TABLE IF NOT EXISTS observation_reviews (
+			observation_id INTEGER PRIMARY KEY REFERENCES observations(id) ON DELETE CASCADE,
+			reviewed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}},
+	{35, append([]string{
+		// Who confirmed an observation with verify, and when.
+		`ALTER TABLE observations ADD COLUMN verified_at TIMESTAMP`,
+		`ALTER TABLE observations ADD COLUMN verified_by TEXT`,
+		// An edit voids the confirmation, unless it only moved the content
+		// into contents or set the verification itself.
+		`CREATE TRIGGER IF NOT EXISTS observations_verified_stale AFTER UPDATE OF content ON observations
+		WHEN OLD.verified_at IS NOT NULL AND NEW.verified_at IS OLD.verified_at AND NEW.content_sha256 IS OLD.content_sha256 BEGIN
+			UPDATE observations SET verified_at = NULL, verified_by = NULL WHERE id = NEW.id;
+		END`,
+		// Recreate the change log triggers so payloads carry the verification.
+		`DROP TRIGGER IF EXISTS changes_observations_insert`,
+		`DROP TRIGGER IF EXISTS changes_observations_update`,
+		`DROP TRIGGER IF EXISTS changes_observations_delete`,
+	}, changeTriggers("observations", "id", "id", "entity_id", "content", "content_sha256", "visibility", "source", "conversation_id", "source_url", "confidence", "metadata", "verified_at", "verified_by", "created_at")...)},
+	{36, append([]string{
+		// Former names of entities renamed with rename_entity, which still
+		// find them.
+		`CREATE TABLE IF NOT EXISTS entity_aliases (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alias TEXT NOT NULL UNIQUE,
+			entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS entity_aliases_entity ON entity_aliases (entity_id)`,
+	}, changeTriggers("entity_aliases", "id", "id", "alias", "entity_id", "created_at")...)},
+	{37, append([]string{
+		// The observation one corrects or follows up, making a thread.
+		`ALTER TABLE observations ADD COLUMN parent_id INTEGER REFERENCES observations(id) ON DELETE SET NULL`,
+		`CREATE INDEX IF NOT EXISTS observations_parent ON observations (parent_id) WHERE parent_id IS NOT NULL`,
+		// Recreate the change log triggers so payloads carry the parent.
+		`DROP TRIGGER IF EXISTS changes_observations_insert`,
+		`DROP TRIGGER IF EXISTS changes_observations_update`,
+		`DROP TRIGGER IF EXISTS changes_observations_delete`,
+	}, changeTriggers("observations", "id", "id", "entity_id", "content", "content_sha256", "visibility", "source", "conversation_id", "source_url", "confidence", "metadata", "verified_at", "verified_by", "parent_id", "created_at")...)},
+	// Attachments and reminders go with their observation when it is
+	// deleted; logging them lets restore put them back along with it.
+	{38, append(changeTriggers("attachments", "id", "id", "observation_id", "name", "mime_type", "size", "sha256", "data", "path", "url", "created_at"),
+		changeTriggers("reminders", "id", "id", "observation_id", "due_at", "completed_at", "rrule", "series_start", "occurrence", "notified_at", "created_at")...)},
+	{39, []string{
+		// The client that saved a session note; memory://context shows a
+		// client only its own notes.
+		`ALTER TABLE session_notes ADD COLUMN client TEXT`,
+	}},
+	{40, []string{changesNoDelete}},
+	// Observations compaction archived and past attribute values, so restore
+	// puts them back with the rows whose deletion or change moved them there.
+	{41, append(changeTriggers("archived_observations", "id", "id", "summary_id", "entity_id", "content", "visibility", "confidence", "source", "conversation_id", "source_url", "metadata", "tags", "created_at", "archived_at"),
+		changeTriggers("entity_attribute_history", "id", "id", "entity_id", "name", "value", "value_type", "source", "valid_from", "valid_to")...)},
+}
+
+// ftsStatements creates a full-text index over column of table, kept up to
+// date by triggers. unicode61 with remove_diacritics folds case and accents,
+// so "malmo" matches "Malmö". The index is external-content: it stores only
+// the tokens, not a second copy of the text.
+func ftsStatements(table, column string) []string {
+	fts := table + "_fts"
+	return []string{
+		fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='id', tokenize='unicode61 remove_diacritics 2')`, fts, column, table),
+		fmt.Sprintf(`INSERT INTO %s(%s) VALUES ('rebuild')`, fts, fts),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_insert AFTER INSERT ON %s BEGIN
+			INSERT INTO %s(rowid, %s) VALUES (NEW.id, NEW.%s);
+		END`, fts, table, fts, column, column),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_delete AFTER DELETE ON %s BEGIN
+			INSERT INTO %s(%s, rowid, %s) VALUES ('delete', OLD.id, OLD.%s);
+		END`, fts, table, fts, fts, column, column),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_update AFTER UPDATE OF %s ON %s BEGIN
+			INSERT INTO %s(%s, rowid, %s) VALUES ('delete', OLD.id, OLD.%s);
+			INSERT INTO %s(rowid, %s) VALUES (NEW.id, NEW.%s);
+		END`, fts, column, table, fts, fts, column, column, fts, column, column),
+	}
+}
+
+// changesNoDelete stops rows being deleted from changes, as
+// changes_append_only stops them being updated. Replaying an incremental
+// backup drops it while it replaces the tail of the log.
+const changesNoDelete = `CREATE TRIGGER IF NOT EXISTS changes_no_delete BEFORE DELETE ON changes BEGIN
+			SELECT RAISE(ABORT, 'changes is append-only');
+		END`
+
+// changeLogStatements creates the append-only changes table and the triggers
+// feeding it. session_notes is left out: notes are short-lived by design.
+func changeLogStatements() []string {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS changes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			op TEXT NOT NULL CHECK (op IN ('insert', 'update', 'delete')),
+			table_name TEXT NOT NULL,
+			row_id INTEGER NOT NULL,
+			payload TEXT NOT NULL,
+			changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS changes_append_only BEFORE UPDATE ON changes BEGIN
+			SELECT RAISE(ABORT, 'changes is append-only');
+		END`,
+	}
+	stmts = append(stmts, changeTriggers("entities", "id", "id", "name", "entity_type", "created_at")...)
+	stmts = append(stmts, changeTriggers("observations", "id", "id", "entity_id", "content", "visibility", "source", "conversation_id", "source_url", "confidence", "created_at")...)
+	stmts = append(stmts, changeTriggers("relations", "id", "id", "from_id", "to_id", "relation_type", "confidence", "created_at")...)
+	stmts = append(stmts, changeTriggers("tags", "id", "id", "name", "description", "created_at")...)
+	stmts = append(stmts, changeTriggers("observation_tags", "observation_id", "observation_id", "tag_id")...)
+	stmts = append(stmts, changeTriggers("unknowns", "id", "id", "entity_id", "question", "created_at", "resolved_at", "observation_id")...)
+	return stmts
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %v", err)
+	}
+
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %d: %v", m.version, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES (?)", m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func schemaVersion(ctx context.Context, db interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("read schema version: %v", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// secretPolicy decides what happens to writes whose content looks like a
+// credential: "reject" (default) refuses them, "flag" stores them with a
+// warning, "off" skips the check. forbiddenPatternsFile adds rules, one
+// regular expression per line.
+var (
+	secretPolicyMode      = getEnv("ENGRAM_SECRET_POLICY", "reject")
+	forbiddenPatternsFile = getEnv("ENGRAM_FORBIDDEN_PATTERNS_FILE", "")
+)
+
+// contentTools are the tools whose arguments end up stored as memory.
+var contentTools = map[string]bool{
+	"execute": true, "add_observation": true, "add_observations": true, "create_entities": true,
+	"store_summary": true, "resolve": true, "remember_for_session": true, "add_reminder": true, "attach": true,
+	"set_attribute": true, "upsert_entity": true,
+}
+
+type secretRule struct {
+	name string
+	re   *regexp.Regexp
+	// value, when non-zero, is the submatch holding the secret itself. It must
+	// contain a digit or symbol, so "password: ask Ana" is not a secret.
+	value int
+}
+
+var secretRules = []secretRule{
+	{"a private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`), 0},
+	{"an AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`), 0},
+	{"a GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`), 0},
+	{"a Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`), 0},
+	{"a Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), 0},
+	{"an API key", regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`), 0},
+	{"a JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), 0},
+	{"credentials in a URL", regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^\s:/@]+:[^\s/@]+@`), 0},
+	{"a password", regexp.MustCompile(`(?i)(?:^|[^a-z])(password|passwd|pwd|passphrase|secret|api[_-]?key|access[_-]?token|auth[_-]?token|token)s?\s*(?:is\s+|[:=]\s*)["'` + "`" + `]?([^\s"'` + "`" + `,;)]{6,})`), 2},
+}
+
+var (
+	hasNonLetter    = regexp.MustCompile(`[^A-Za-z]`)
+	deleteStatement = regexp.MustCompile(`(?i)^\s*DELETE\b`)
+)
+
+type secretPolicy struct {
+	mode  string
+	rules []secretRule
+}
+
+func parseSecretPolicy(mode, patternsFile string) (*secretPolicy, error) {
+	p := &secretPolicy{mode: strings.ToLower(strings.TrimSpace(mode)), rules: secretRules}
+	switch p.mode {
+	case "reject", "flag", "off":
+	default:
+		return nil, fmt.Errorf("unknown secret policy %q, want reject, flag or off", mode)
+	}
+	if patternsFile == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(patternsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p.rules = append([]secretRule{}, secretRules...)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", patternsFile, n, err)
+		}
+		p.rules = append(p.rules, secretRule{fmt.Sprintf("a forbidden pattern (%s:%d)", patternsFile, n), re, 0})
+	}
+	return p, scanner.Err()
+}
+
+// match returns the names of the rules s breaks.
+func (p *secretPolicy) match(s string) []string {
+	var names []string
+	for _, r := range p.rules {
+		for _, m := range r.re.FindAllStringSubmatch(s, -1) {
+			if r.value == 0 || hasNonLetter.MatchString(m[r.value]) {
+				names = append(names, r.name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// check scans every string in a tool's arguments, including inside arrays
+// and objects, and returns the rules they break.
+func (p *secretPolicy) check(args any) []string {
+	found := make(map[string]bool)
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case string:
+			for _, name := range p.match(v) {
+				found[name] = true
+			}
+		case []any:
+			for _, x := range v {
+				walk(x)
+			}
+		case map[string]any:
+			for _, x := range v {
+				walk(x)
+			}
+		}
+	}
+	walk(args)
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *secretPolicy) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		tool := request.Params.Name
+		if p.mode == "off" || !contentTools[tool] {
+			return next(ctx, request)
+		}
+		// Deleting a stored secret must stay possible.
+		if tool == "execute" && deleteStatement.MatchString(request.GetString("sql", "")) {
+			return next(ctx, request)
+		}
+		found := p.check(request.GetArguments())
+		if len(found) == 0 {
+			return next(ctx, request)
+		}
+
+		what := strings.Join(found, ", ")
+		if p.mode == "reject" {
+			log.Printf("tool %s: rejected content that looks like %s", tool, what)
+			return toolErrorf(codeSecretDetected, "will not store secrets: the content looks like it contains %s. "+
+				"Store where the secret is kept instead (e.g. 'NAS admin password is in the password manager'), not the secret itself.", what), nil
+		}
+
+		result, err := next(ctx, request)
+		if err != nil || result == nil || result.IsError {
+			return result, err
+		}
+		log.Printf("tool %s: stored content that looks like %s", tool, what)
+		result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf(
+			"warning: the stored content looks like it contains %s. If that was not intended, delete or rewrite it.", what)))
+		return result, nil
+	}
+}
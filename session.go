@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var sessionTTLHours = getEnvInt("ENGRAM_SESSION_TTL_HOURS", 24)
+
+// sessionID returns the explicit session_id argument, falling back to the MCP
+// session. stdio has a single session for the life of the process, so clients
+// that keep one process across conversations should pass their own id.
+func sessionID(ctx context.Context, request mcp.CallToolRequest) string {
+	if id := strings.TrimSpace(request.GetString("session_id", "")); id != "" {
+		return id
+	}
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return "default"
+}
+
+// noteClient is the client recorded with a session note, nil when the
+// caller names none.
+func noteClient(ctx context.Context) any {
+	if name, ok := clientName(ctx); ok && name != "" {
+		return name
+	}
+	return nil
+}
+
+func purgeExpiredSessionNotes(ctx context.Context, db *sql.DB) (int64, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM session_notes WHERE expires_at <= CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// expireSessionNotes purges expired notes on an interval until ctx is done.
+func expireSessionNotes(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := purgeExpiredSessionNotes(ctx, db); err != nil {
+				log.Printf("failed to purge expired session notes: %v", err)
+			}
+		}
+	}
+}
+
+// registerSessionNotes adds the remember_for_session and promote tools.
+func registerSessionNotes(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("remember_for_session",
+		mcp.WithDescription(`Save a short-lived working note for this conversation, separate from long-term observations.
+
+Use it for things worth keeping in mind during the current task but not worth remembering permanently. Notes expire automatically. Read them back with:
+  SELECT id, content FROM session_notes WHERE session_id = '<session>' ORDER BY id`),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("The note"),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("Conversation or session identifier. Defaults to the MCP session; pass one if the client reuses the server across conversations"),
+		),
+		mcp.WithString("entity",
+			mcp.Description("Optional name of the entity the note is about"),
+		),
+		mcp.WithNumber("ttl_hours",
+			mcp.Description(fmt.Sprintf("Hours until the note expires (default %d)", sessionTTLHours)),
+		),
+	), rememberForSessionHandler(db))
+
+	s.AddTool(mcp.NewTool("promote",
+		mcp.WithDescription(`Turn session notes into permanent observations.
+
+At the end of a conversation, list the session's notes, decide with the user what is worth remembering, then promote those. Only this session's notes can be promoted. Promoted notes become tagged observations (source 'session') and are removed from session_notes. Promote notes with different tags or entities in separate calls.`),
+		mcp.WithArray("ids",
+			mcp.Required(),
+			mcp.Description("IDs of the session notes to promote"),
+			mcp.WithNumberItems(),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("The session_id the notes were saved with, if one was passed to remember_for_session"),
+		),
+		mcp.WithString("tags",
+			mcp.Required(),
+			mcp.Description("Comma-separated tag names for the new observations"),
+		),
+		mcp.WithString("entity",
+			mcp.Description("Entity to attach the observations to. Required for notes saved without an entity; overrides the note's entity otherwise"),
+		),
+		mcp.WithString("visibility",
+			mcp.Description("private (default), shared or public"),
+		),
+	), promoteHandler(db, scopes))
+}
+
+func rememberForSessionHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		content := request.GetString("content", "")
+		if strings.TrimSpace(content) == "" {
+			return toolError(codeInvalidArgument, "content parameter is required"), nil
+		}
+
+		ttl := request.GetInt("ttl_hours", sessionTTLHours)
+		if ttl <= 0 {
+			return toolError(codeInvalidArgument, "ttl_hours must be positive"), nil
+		}
+
+		var entityID any
+		if entity := strings.TrimSpace(request.GetString("entity", "")); entity != "" {
+			id, err := lookupEntityID(ctx, db, entity)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			entityID = id
+		}
+
+		if _, err := purgeExpiredSessionNotes(ctx, db); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to purge expired session notes: %v", err), nil
+		}
+
+		session := sessionID(ctx, request)
+		result, err := db.ExecContext(ctx, "INSERT INTO session_notes (session_id, entity_id, content, expires_at, client) VALUES (?, ?, ?, datetime('now', ?), ?)",
+			session, entityID, content, fmt.Sprintf("+%d hours", ttl), noteClient(ctx))
+		if err != nil {
+			return execError(err, codeDatabase), nil
+		}
+		id, _ := result.LastInsertId()
+
+		return mcp.NewToolResultText(fmt.Sprintf("success: session note %d saved for session %s, expires in %d hours", id, session, ttl)), nil
+	}
+}
+
+func promoteHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// session_notes is closed to restricted scopes, and the promoted
+		// observation's visibility would be the caller's to choose.
+		if restricted(scopes.levels(ctx)) {
+			return toolError(codeInvalidArgument, "this client's visibility scope cannot read session notes, so it cannot promote them"), nil
+		}
+
+		ids := request.GetIntSlice("ids", nil)
+		if len(ids) == 0 {
+			return toolError(codeInvalidArgument, "ids parameter is required: the session note ids to promote"), nil
+		}
+
+		tagsStr := request.GetString("tags", "")
+		if strings.TrimSpace(tagsStr) == "" && requiredTags.requires("observations") {
+			return toolError(codeTagRequired, "tags parameter is required, promoted notes become observations. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+		}
+
+		visibility := request.GetString("visibility", "private")
+		if _, err := parseVisibilityLevels(visibility); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		var defaultEntity sql.NullInt64
+		if entity := strings.TrimSpace(request.GetString("entity", "")); entity != "" {
+			id, err := lookupEntityID(ctx, db, entity)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			defaultEntity = sql.NullInt64{Int64: id, Valid: true}
+		}
+
+		tagIDs, err := validateTagsFor(ctx, db, "observations", parseTagNames(tagsStr))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		session := sessionID(ctx, request)
+		var sb strings.Builder
+		promoted := 0
+		for _, id := range ids {
+			var content string
+			var entityID sql.NullInt64
+			err := db.QueryRowContext(ctx, "SELECT entity_id, content FROM session_notes WHERE id = ? AND session_id = ? AND expires_at > CURRENT_TIMESTAMP", id, session).Scan(&entityID, &content)
+			if err == sql.ErrNoRows {
+				fmt.Fprintf(&sb, "note %d: not found in session %s or expired\n", id, session)
+				continue
+			} else if err != nil {
+				fmt.Fprintf(&sb, "note %d: %v\n", id, err)
+				continue
+			}
+
+			if defaultEntity.Valid {
+				entityID = defaultEntity
+			}
+			if !entityID.Valid {
+				fmt.Fprintf(&sb, "note %d: no entity, pass the entity parameter\n", id)
+				continue
+			}
+			if err := checkTagQuotas(ctx, db, tagIDs, len(content)); err != nil {
+				fmt.Fprintf(&sb, "note %d: %v\n", id, err)
+				continue
+			}
+
+			result, err := db.ExecContext(ctx, "INSERT INTO observations (entity_id, content, visibility, source, conversation_id) VALUES (?, ?, ?, 'session', ?)",
+				entityID.Int64, normalizeText(content), strings.ToLower(visibility), session)
+			if err != nil {
+				fmt.Fprintf(&sb, "note %d: %s\n", id, formatExecError(err))
+				continue
+			}
+			observationID, _ := result.LastInsertId()
+
+			if err := linkTags(ctx, db, observationID, tagIDs); err != nil {
+				fmt.Fprintf(&sb, "note %d: observation %d created but failed to link tags: %v\n", id, observationID, err)
+				continue
+			}
+			if _, err := db.ExecContext(ctx, "DELETE FROM session_notes WHERE id = ?", id); err != nil {
+				fmt.Fprintf(&sb, "note %d: promoted to observation %d but failed to remove note: %v\n", id, observationID, err)
+				promoted++
+				continue
+			}
+			fmt.Fprintf(&sb, "note %d: promoted to observation %d\n", id, observationID)
+			promoted++
+		}
+
+		summary := fmt.Sprintf("promoted %d of %d note(s) with %s\n\n", promoted, len(ids), tagList(tagsStr))
+		if promoted == 0 {
+			return toolError(codeInvalidArgument, summary+sb.String()), nil
+		}
+		return mcp.NewToolResultText(summary + sb.String()), nil
+	}
+}
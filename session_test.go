@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRememberForSession_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM session_notes WHERE session_id LIKE 'session-test-%'")
+
+	t.Run("missing content fails", func(t *testing.T) {
+		result, err := callTool(rememberForSessionHandler(db), "remember_for_session", map[string]any{"session_id": "session-test-1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error without content")
+		}
+	})
+
+	t.Run("note saved under session", func(t *testing.T) {
+		result, err := callTool(rememberForSessionHandler(db), "remember_for_session", map[string]any{
+			"session_id": "session-test-1", "content": "session note test 33445", "ttl_hours": float64(2),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("remember_for_session failed: %v", result.Content)
+		}
+
+		var n int
+		db.QueryRow("SELECT count(*) FROM session_notes WHERE session_id = 'session-test-1' AND expires_at > CURRENT_TIMESTAMP").Scan(&n)
+		if n != 1 {
+			t.Fatalf("expected 1 live note, got %d", n)
+		}
+	})
+
+	t.Run("expired notes purged", func(t *testing.T) {
+		if _, err := db.Exec("INSERT INTO session_notes (session_id, content, expires_at) VALUES ('session-test-2', 'expired', datetime('now', '-1 hours'))"); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		if _, err := purgeExpiredSessionNotes(context.Background(), db); err != nil {
+			t.Fatalf("purge: %v", err)
+		}
+		var n int
+		db.QueryRow("SELECT count(*) FROM session_notes WHERE session_id = 'session-test-2'").Scan(&n)
+		if n != 0 {
+			t.Fatalf("expected expired note purged, %d remain", n)
+		}
+	})
+}
+
+func TestSessionID(t *testing.T) {
+	req := mcpToolRequest(map[string]any{"session_id": " conv-1 "})
+	if got := sessionID(context.Background(), req); got != "conv-1" {
+		t.Errorf("sessionID() = %q, want explicit id", got)
+	}
+	if got := sessionID(sessionContext("mcp-session"), mcpToolRequest(nil)); got != "mcp-session" {
+		t.Errorf("sessionID() = %q, want MCP session id", got)
+	}
+	if got := sessionID(context.Background(), mcpToolRequest(nil)); got != "default" {
+		t.Errorf("sessionID() = %q, want default", got)
+	}
+}
+
+func TestPromote_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM session_notes WHERE session_id = 'promote-test'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'promote test %'")
+
+	var entity string
+	if err := db.QueryRow("SELECT name FROM entities WHERE id = 1").Scan(&entity); err != nil {
+		t.Fatalf("lookup entity: %v", err)
+	}
+
+	var withEntity, withoutEntity int64
+	db.QueryRow("INSERT INTO session_notes (session_id, entity_id, content, expires_at) VALUES ('promote-test', 1, 'promote test with entity', datetime('now', '+1 hours')) RETURNING id").Scan(&withEntity)
+	db.QueryRow("INSERT INTO session_notes (session_id, content, expires_at) VALUES ('promote-test', 'promote test without entity', datetime('now', '+1 hours')) RETURNING id").Scan(&withoutEntity)
+	if withEntity == 0 || withoutEntity == 0 {
+		t.Fatal("failed to insert session notes")
+	}
+
+	t.Run("note without entity needs entity parameter", func(t *testing.T) {
+		result, err := callTool(promoteHandler(db, nil), "promote", map[string]any{"ids": []any{float64(withoutEntity)}, "tags": "homelab", "session_id": "promote-test"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error promoting a note without entity")
+		}
+	})
+
+	t.Run("another session's notes are not found", func(t *testing.T) {
+		result, err := callTool(promoteHandler(db, nil), "promote", map[string]any{"ids": []any{float64(withEntity)}, "tags": "homelab", "session_id": "other-session"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("promoted a note from another session")
+		}
+	})
+
+	t.Run("restricted scope is refused", func(t *testing.T) {
+		public, err := parseVisibilityScopes("public", "")
+		if err != nil {
+			t.Fatalf("parseVisibilityScopes: %v", err)
+		}
+		result, err := callTool(promoteHandler(db, public), "promote", map[string]any{"ids": []any{float64(withEntity)}, "tags": "homelab", "session_id": "promote-test"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("restricted client promoted a session note")
+		}
+	})
+
+	t.Run("promote both", func(t *testing.T) {
+		result, err := callTool(promoteHandler(db, nil), "promote", map[string]any{
+			"ids": []any{float64(withEntity), float64(withoutEntity)}, "tags": "homelab", "entity": entity, "session_id": "promote-test",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("promote failed: %v", result.Content)
+		}
+
+		var notes, observations int
+		db.QueryRow("SELECT count(*) FROM session_notes WHERE session_id = 'promote-test'").Scan(&notes)
+		db.QueryRow("SELECT count(*) FROM observations WHERE content LIKE 'promote test %' AND source = 'session' AND conversation_id = 'promote-test'").Scan(&observations)
+		if notes != 0 || observations != 2 {
+			t.Fatalf("expected notes moved to observations, got %d notes and %d observations", notes, observations)
+		}
+	})
+}
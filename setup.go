@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// starterTags are the broad categories init offers to create when there is
+// no ENGRAM_TAXONOMY.
+var starterTags = []taxonomyTag{
+	{name: "homelab", description: "Servers, network, self-hosted services and home automation"},
+	{name: "career", description: "Work, jobs, colleagues, skills and professional goals"},
+	{name: "personal", description: "Family, friends, health, preferences and life admin"},
+	{name: "drinks", description: "Coffee, tea, beer, wine and spirits tried, liked or avoided"},
+}
+
+// seedTags returns the tags init offers: the taxonomy, or the starter tags.
+func seedTags() ([]taxonomyTag, error) {
+	if taxonomyErr != nil {
+		return nil, fmt.Errorf("invalid taxonomy: %v", taxonomyErr)
+	}
+	if taxonomy != nil {
+		return taxonomy, nil
+	}
+	return starterTags, nil
+}
+
+type setupOptions struct {
+	url        string
+	token      string
+	configPath string
+	seedTags   bool
+	// writeConfig saves url and token to configPath.
+	writeConfig bool
+}
+
+// prompter asks questions on out and reads the answers from in.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask returns the answer, or def when it is blank or input has ended.
+func (p prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, _ := p.in.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+func (p prompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	switch strings.ToLower(p.ask(question+" ("+hint+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// runSetup is the interactive init: it asks for the database, helps start a
+// local server when none answers, applies the schema, offers the starter
+// tags and saves the settings, then prints a client config to paste.
+func runSetup(ctx context.Context, p prompter, opts setupOptions) error {
+	fmt.Fprintln(p.out, "Set up memory-mcp. Press Enter to keep the value in brackets.")
+	opts.url = p.ask("libSQL server URL (a Turso database is libsql://NAME.turso.io)", opts.url)
+	keep := ""
+	if opts.token != "" {
+		keep = "keep current"
+	}
+	if token := p.ask("Auth token, blank for none", keep); token != keep {
+		opts.token = token
+	}
+
+	db, err := openURL(ctx, withAuthToken(opts.url, opts.token))
+	if err != nil && localURL(opts.url) {
+		fmt.Fprintf(p.out, "No libSQL server answers at %s: %v\n", redactURL(opts.url), err)
+		if p.confirm("Keep the database in a local directory, served by sqld?", true) {
+			db, err = startLocal(ctx, p, opts)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", redactURL(opts.url), err)
+	}
+	defer db.Close()
+	if err := reportSchema(ctx, db, p.out, opts.url); err != nil {
+		return err
+	}
+
+	var tags int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM tags").Scan(&tags); err != nil {
+		return err
+	}
+	seed, err := seedTags()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, t := range seed {
+		if t.parent == "" {
+			names = append(names, t.name)
+		}
+	}
+	question := fmt.Sprintf("Add the starter tags %s?", strings.Join(names, ", "))
+	if taxonomy != nil {
+		question = fmt.Sprintf("Add the tags from %s (%s, ...)?", taxonomyFile, strings.Join(names, ", "))
+	}
+	if p.confirm(question, tags == 0) {
+		if err := seedStarterTags(ctx, db, p.out); err != nil {
+			return err
+		}
+	}
+
+	opts.configPath = p.ask("Save these settings to (- to skip)", opts.configPath)
+	opts.writeConfig = opts.configPath != "-" && opts.configPath != ""
+	return finishSetup(p.out, opts)
+}
+
+// startLocal makes a data directory for a sqld server on the URL's port,
+// shows how to start one, and waits until it answers.
+func startLocal(ctx context.Context, p prompter, opts setupOptions) (*sql.DB, error) {
+	dir := "memory-data"
+	if home, err := os.UserHomeDir(); err == nil {
+		dir = filepath.Join(home, ".local", "share", "engram")
+	}
+	dir = p.ask("Data directory", dir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	port := "8080"
+	if u, err := neturl.Parse(opts.url); err == nil && u.Port() != "" {
+		port = u.Port()
+	}
+	fmt.Fprintf(p.out, `This build talks to libSQL over HTTP, so start a server on %s with either of:
+
+  sqld --db-path %s --http-listen-addr 127.0.0.1:%s
+  docker run -d --name libsql -p 127.0.0.1:%s:8080 -v %s:/var/lib/sqld ghcr.io/tursodatabase/libsql-server:latest
+
+`, dir, filepath.Join(dir, "memory.sqld"), port, port, dir)
+	for {
+		if p.ask("Press Enter once it is running, or q to stop", "") == "q" {
+			return nil, fmt.Errorf("no server started")
+		}
+		db, err := openURL(ctx, withAuthToken(opts.url, opts.token))
+		if err == nil {
+			return db, nil
+		}
+		fmt.Fprintf(p.out, "Still no answer: %v\n", err)
+		if _, err := p.in.Peek(1); err == io.EOF {
+			return nil, fmt.Errorf("no server started")
+		}
+	}
+}
+
+func localURL(url string) bool {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return false
+	}
+	if u.Hostname() == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
+
+func reportSchema(ctx context.Context, db *sql.DB, w io.Writer, url string) error {
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "schema ready at version %d (%s)\n", version, redactURL(url))
+	return nil
+}
+
+// seedStarterTags adds the taxonomy's tags, or the starter tags, that do
+// not exist yet.
+func seedStarterTags(ctx context.Context, db *sql.DB, w io.Writer) error {
+	seed, err := seedTags()
+	if err != nil {
+		return err
+	}
+	added, err := applyTaxonomy(ctx, db, seed)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "added %d tag(s)\n", added)
+	return nil
+}
+
+// finishSetup saves the settings when asked to and prints the client
+// config. Without a config file the snippet carries the settings itself.
+func finishSetup(w io.Writer, opts setupOptions) error {
+	env := map[string]string{"LIBSQL_URL": opts.url}
+	if opts.token != "" {
+		env["LIBSQL_AUTH_TOKEN"] = opts.token
+	}
+	if opts.writeConfig {
+		if err := writeConfigFile(opts.configPath, env); err != nil {
+			return fmt.Errorf("writing %s: %v", opts.configPath, err)
+		}
+		fmt.Fprintf(w, "settings saved to %s\n", opts.configPath)
+		env = map[string]string{"ENGRAM_CONFIG": opts.configPath}
+	}
+
+	command, err := os.Executable()
+	if err != nil {
+		command = "memory-mcp"
+	}
+	snippet, err := json.MarshalIndent(map[string]any{"mcpServers": map[string]any{
+		"memory": map[string]any{"command": command, "env": env},
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nAdd this to your MCP client's config, e.g. claude_desktop_config.json:\n\n%s\n", snippet)
+	return nil
+}
+
+// interactive reports whether init can ask questions: stdin and stdout are
+// both character devices, which /dev/null alone, as under cron or systemd,
+// does not pass for.
+func interactive() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		fi, err := f.Stat()
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
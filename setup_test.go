@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engram", "config.env")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	existing := "# mine\nexport ENGRAM_TOOLS=\"query,execute\"\nLIBSQL_URL=http://old:8080\n"
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeConfigFile(path, map[string]string{"LIBSQL_URL": "http://new:8080", "LIBSQL_AUTH_TOKEN": "tok"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "# mine\nexport ENGRAM_TOOLS=\"query,execute\"\nLIBSQL_URL=http://new:8080\nLIBSQL_AUTH_TOKEN=tok\n"
+	if string(data) != want {
+		t.Errorf("config file =\n%s\nwant\n%s", data, want)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	settings, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings["ENGRAM_TOOLS"] != "query,execute" || settings["LIBSQL_URL"] != "http://new:8080" || settings["LIBSQL_AUTH_TOKEN"] != "tok" {
+		t.Errorf("settings = %v", settings)
+	}
+
+	if settings, err := readConfigFile(filepath.Join(t.TempDir(), "missing.env")); err != nil || settings != nil {
+		t.Errorf("missing file = %v, %v", settings, err)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.env")
+	os.WriteFile(bad, []byte("LIBSQL_URL\n"), 0o600)
+	if _, err := readConfigFile(bad); err == nil || !strings.Contains(err.Error(), "bad.env:1") {
+		t.Errorf("malformed file error = %v", err)
+	}
+}
+
+func TestSettingPrecedence(t *testing.T) {
+	setting("LIBSQL_URL")
+	saved := fileSettings
+	defer func() { fileSettings = saved }()
+	fileSettings = map[string]string{"ENGRAM_TEST_SETTING": "file"}
+
+	if got := getEnv("ENGRAM_TEST_SETTING", "default"); got != "file" {
+		t.Errorf("from the file = %q", got)
+	}
+	t.Setenv("ENGRAM_TEST_SETTING", "env")
+	if got := getEnv("ENGRAM_TEST_SETTING", "default"); got != "env" {
+		t.Errorf("with the variable set = %q", got)
+	}
+	if got := getEnv("ENGRAM_TEST_UNSET", "default"); got != "default" {
+		t.Errorf("unset = %q", got)
+	}
+}
+
+func TestWithAuthToken(t *testing.T) {
+	tests := []struct{ url, token, want string }{
+		{"http://localhost:8080", "", "http://localhost:8080"},
+		{"libsql://db.turso.io", "a+b", "libsql://db.turso.io?authToken=a%2Bb"},
+		{"libsql://db.turso.io?tls=1", "t", "libsql://db.turso.io?tls=1&authToken=t"},
+		{"libsql://db.turso.io?authToken=own", "t", "libsql://db.turso.io?authToken=own"},
+	}
+	for _, tt := range tests {
+		if got := withAuthToken(tt.url, tt.token); got != tt.want {
+			t.Errorf("withAuthToken(%q, %q) = %q, want %q", tt.url, tt.token, got, tt.want)
+		}
+	}
+}
+
+func answers(lines ...string) prompter {
+	return prompter{bufio.NewReader(strings.NewReader(strings.Join(lines, "\n") + "\n")), &strings.Builder{}}
+}
+
+func TestRunSetupLocalServerMissing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	p := answers("http://127.0.0.1:1", "", "y", dir, "q")
+	err := runSetup(context.Background(), p, setupOptions{})
+	out := p.out.(*strings.Builder).String()
+	if err == nil || !strings.Contains(err.Error(), "no server started") {
+		t.Errorf("err = %v", err)
+	}
+	if !strings.Contains(out, "sqld --db-path "+filepath.Join(dir, "memory.sqld")+" --http-listen-addr 127.0.0.1:1") {
+		t.Errorf("output has no sqld command:\n%s", out)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("data directory not created: %v", err)
+	}
+}
+
+func TestRunSetup_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	db.Close()
+
+	config := filepath.Join(t.TempDir(), "config.env")
+	p := answers(dbURL, "", "n", config)
+	if err := runSetup(context.Background(), p, setupOptions{url: "http://unused:1"}); err != nil {
+		t.Fatal(err)
+	}
+	out := p.out.(*strings.Builder).String()
+	for _, want := range []string{"schema ready at version", "settings saved to " + config, `"ENGRAM_CONFIG": "` + config + `"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	settings, err := readConfigFile(config)
+	if err != nil || settings["LIBSQL_URL"] != dbURL {
+		t.Errorf("saved settings = %v, %v", settings, err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// slowCallMs is the duration above which a tool call is logged as slow and
+// kept for memory://slow; 0 disables the slow call log.
+var slowCallMs = getEnvInt("ENGRAM_SLOW_MS", 1000)
+
+const (
+	slowURI = "memory://slow"
+	// maxSlowCalls is how many slow calls memory://slow keeps, newest first.
+	maxSlowCalls = 50
+)
+
+// slowCall is a tool call that took longer than slowCallMs. sql, plan and
+// scans are empty for tools that take no SQL.
+type slowCall struct {
+	at      time.Time
+	tool    string
+	elapsed time.Duration
+	failed  bool
+	rows    int
+	sql     string
+	plan    string
+	scans   []string
+}
+
+// slowLog logs slow tool calls with the SQL they ran, its query plan and
+// the tables the plan reads in full, and keeps the latest for memory://slow.
+// The driver does not report how many rows a statement read, so the tables
+// scanned stand in for it. The plan is fetched after the call returns, so
+// the call itself is not slowed down further.
+type slowLog struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	calls []slowCall
+}
+
+func newSlowLog(db *sql.DB) *slowLog {
+	return &slowLog{db: db}
+}
+
+func (l *slowLog) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if slowCallMs <= 0 {
+			return next(ctx, request)
+		}
+		ctx, rows := withRowCount(ctx)
+		start := time.Now()
+		result, err := next(ctx, request)
+		elapsed := time.Since(start)
+		if elapsed < time.Duration(slowCallMs)*time.Millisecond {
+			return result, err
+		}
+		call := slowCall{
+			at:      start,
+			tool:    request.Params.Name,
+			elapsed: elapsed,
+			failed:  err != nil || result == nil || result.IsError,
+			rows:    *rows,
+			sql:     request.GetString("sql", ""),
+		}
+		go l.record(context.WithoutCancel(ctx), call)
+		return result, err
+	}
+}
+
+// record explains the call's SQL, then logs the call and keeps it.
+func (l *slowLog) record(ctx context.Context, call slowCall) {
+	if call.sql != "" {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		sqlStr := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(call.sql), ";"))
+		if _, plan, err := runQuery(ctx, l.db, "EXPLAIN QUERY PLAN "+sqlStr); err != nil {
+			call.plan = fmt.Sprintf("  unavailable: %v\n", err)
+		} else {
+			call.plan = formatPlan(plan)
+			call.scans = planScans(plan)
+		}
+	}
+	log.Print(call.summary())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, call)
+	if len(l.calls) > maxSlowCalls {
+		l.calls = l.calls[len(l.calls)-maxSlowCalls:]
+	}
+}
+
+// planScans names the tables a plan reads in full, from its "SCAN t"
+// steps. Covering index scans are included: they still visit every row.
+func planScans(plan []map[string]any) []string {
+	var scans []string
+	for _, row := range plan {
+		detail := formatValue(row["detail"])
+		if rest, ok := strings.CutPrefix(detail, "SCAN "); ok {
+			if table, _, _ := strings.Cut(rest, " "); table != "" {
+				scans = append(scans, table)
+			}
+		}
+	}
+	return scans
+}
+
+func (c slowCall) summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "slow tool call: %s took %dms", c.tool, c.elapsed.Milliseconds())
+	if c.failed {
+		b.WriteString(" and failed")
+	}
+	if c.sql != "" {
+		fmt.Fprintf(&b, ", %d row(s)", c.rows)
+		if len(c.scans) > 0 {
+			fmt.Fprintf(&b, ", full scan of %s", strings.Join(c.scans, ", "))
+		}
+		fmt.Fprintf(&b, ", sql: %.200s", normalizeSQL(c.sql))
+	}
+	return b.String()
+}
+
+// report lists the slow calls kept, newest first, with their plans.
+func (l *slowLog) report() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if slowCallMs <= 0 {
+		return "the slow call log is off; set ENGRAM_SLOW_MS to enable it"
+	}
+	if len(l.calls) == 0 {
+		return fmt.Sprintf("no tool call has taken over %dms", slowCallMs)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "tool calls over %dms, newest first\n", slowCallMs)
+	for i := len(l.calls) - 1; i >= 0; i-- {
+		c := l.calls[i]
+		fmt.Fprintf(&b, "\n%s %s\n", c.at.UTC().Format(time.RFC3339), c.summary())
+		if c.plan != "" {
+			fmt.Fprintf(&b, "plan:\n%s", c.plan)
+		}
+	}
+	return b.String()
+}
+
+// registerSlowLog adds the resource listing the slow tool calls.
+func registerSlowLog(s *server.MCPServer, slow *slowLog) {
+	s.AddResource(mcp.NewResource(
+		slowURI,
+		"Slow tool calls",
+		mcp.WithResourceDescription("The latest tool calls over ENGRAM_SLOW_MS, with their SQL, query plan, rows and the tables scanned in full"),
+		mcp.WithMIMEType("text/plain"),
+	), slow.resourceHandler())
+}
+
+func (l *slowLog) resourceHandler() server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      slowURI,
+				MIMEType: "text/plain",
+				Text:     l.report(),
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestSlowLogMiddleware(t *testing.T) {
+	defer func(v int) { slowCallMs = v }(slowCallMs)
+	slowCallMs = 20
+
+	l := newSlowLog(nil)
+	handler := l.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		time.Sleep(time.Duration(request.GetInt("ms", 0)) * time.Millisecond)
+		return mcp.NewToolResultText("done"), nil
+	})
+	call := func(tool string, ms int) {
+		req := mcpToolRequest(map[string]any{"ms": float64(ms)})
+		req.Params.Name = tool
+		if _, err := handler(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	call("graph_stats", 0)
+	call("read_graph", 30)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(l.report(), "read_graph") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	report := l.report()
+	if !strings.Contains(report, "slow tool call: read_graph took") {
+		t.Errorf("report = %q, want the slow read_graph call", report)
+	}
+	if strings.Contains(report, "graph_stats") {
+		t.Errorf("report = %q, want the fast call left out", report)
+	}
+}
+
+func TestPlanScans(t *testing.T) {
+	plan := []map[string]any{
+		{"id": int64(2), "parent": int64(0), "detail": "SCAN o"},
+		{"id": int64(3), "parent": int64(0), "detail": "SEARCH t USING INTEGER PRIMARY KEY (rowid=?)"},
+		{"id": int64(4), "parent": int64(0), "detail": "SCAN tags USING COVERING INDEX sqlite_autoindex_tags_1"},
+		{"id": int64(5), "parent": int64(0), "detail": "USE TEMP B-TREE FOR ORDER BY"},
+	}
+	if got, want := planScans(plan), []string{"o", "tags"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("planScans = %v, want %v", got, want)
+	}
+}
+
+func TestSlowLogRecord_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	l := newSlowLog(db)
+	l.record(context.Background(), slowCall{
+		at:      time.Now(),
+		tool:    "query",
+		elapsed: 1500 * time.Millisecond,
+		rows:    3,
+		sql:     "select id from observations where content like '%x%';",
+	})
+	report := l.report()
+	for _, want := range []string{"query took 1500ms, 3 row(s), full scan of observations", "sql: SELECT id FROM observations", "plan:\n  SCAN observations"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report = %q, want it to contain %q", report, want)
+		}
+	}
+
+	for i := 0; i < maxSlowCalls+5; i++ {
+		l.record(context.Background(), slowCall{at: time.Now(), tool: "read_graph"})
+	}
+	if len(l.calls) != maxSlowCalls || l.calls[0].tool != "read_graph" {
+		t.Errorf("kept %d calls, oldest %q", len(l.calls), l.calls[0].tool)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// snapshotKeepalive must stay below the libsql server's idle stream timeout,
+// otherwise the pinned read transaction is dropped between tool calls.
+const snapshotKeepalive = 5 * time.Second
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// snapshots pins the reads of each session that turns snapshot reads on to
+// a read transaction, so a long session sees a consistent view of memory
+// while other clients write. A nil *snapshots disables pinning.
+type snapshots struct {
+	db *sql.DB
+	mu sync.Mutex
+	// sessions has an entry for each session with snapshot reads on: its
+	// snapshot, or nil after a write until its next read takes a new one.
+	sessions map[string]*snapshot
+}
+
+type snapshot struct {
+	tx   *sql.Tx
+	done chan struct{}
+	once sync.Once
+	// lost is why the transaction was dropped, set under snapshots.mu.
+	lost error
+}
+
+func (snap *snapshot) close() {
+	snap.once.Do(func() {
+		close(snap.done)
+		snap.tx.Rollback()
+	})
+}
+
+func newSnapshots(db *sql.DB) *snapshots {
+	return &snapshots{db: db, sessions: make(map[string]*snapshot)}
+}
+
+// errSnapshotLost is returned for reads of a session whose snapshot was
+// dropped. A newer snapshot would show the session data its earlier reads
+// did not, so the reads fail until the session releases it.
+type errSnapshotLost struct{ err error }
+
+func (e errSnapshotLost) Error() string {
+	return fmt.Sprintf("this session's snapshot was lost (%v), so its reads can no longer see the data they saw before; call snapshot_reads to take a fresh snapshot or turn snapshot reads off", e.err)
+}
+
+// reader returns the session's pinned transaction, taking the snapshot if it
+// was released, or db when the session has snapshot reads off or there is
+// no session. It fails with errSnapshotLost when the pinned transaction was
+// dropped.
+func (s *snapshots) reader(ctx context.Context, db *sql.DB) (queryer, error) {
+	if s == nil {
+		return db, nil
+	}
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return db, nil
+	}
+	tx, err := s.pin(ctx, session.SessionID())
+	var lost errSnapshotLost
+	if errors.As(err, &lost) {
+		return nil, err
+	} else if err != nil {
+		log.Printf("snapshot for session %s unavailable, reading live: %v", session.SessionID(), err)
+		return db, nil
+	} else if tx == nil {
+		return db, nil
+	}
+	return tx, nil
+}
+
+// pin returns the session's snapshot, taking one if a write released it,
+// or nil when the session has snapshot reads off.
+func (s *snapshots) pin(ctx context.Context, sessionID string) (*sql.Tx, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, nil
+	}
+	if snap != nil {
+		if snap.lost != nil {
+			return nil, errSnapshotLost{snap.lost}
+		}
+		return snap.tx, nil
+	}
+	snap, err := s.take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions[sessionID] = snap
+	return snap.tx, nil
+}
+
+// take opens a read transaction and reads from it once, since SQLite only
+// fixes the snapshot on the first read after BEGIN.
+func (s *snapshots) take(ctx context.Context) (*snapshot, error) {
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	snap := &snapshot{tx: tx, done: make(chan struct{})}
+	go s.keepalive(snap)
+	return snap, nil
+}
+
+func (s *snapshots) keepalive(snap *snapshot) {
+	ticker := time.NewTicker(snapshotKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-snap.done:
+			return
+		case <-ticker.C:
+			var n int
+			if err := snap.tx.QueryRow("SELECT 1").Scan(&n); err != nil {
+				// The snapshot stays registered, marked lost, so the
+				// session's next read fails instead of quietly taking a
+				// newer one.
+				log.Printf("snapshot keepalive failed: %v", err)
+				s.mu.Lock()
+				snap.lost = err
+				s.mu.Unlock()
+				snap.close()
+				return
+			}
+		}
+	}
+}
+
+// start turns snapshot reads on for the session with a snapshot taken now,
+// dropping any earlier one.
+func (s *snapshots) start(ctx context.Context, sessionID string) error {
+	s.end(sessionID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, err := s.take(ctx)
+	if err != nil {
+		return err
+	}
+	s.sessions[sessionID] = snap
+	return nil
+}
+
+// release drops the session's snapshot; its next read takes a fresh one.
+func (s *snapshots) release(sessionID string) {
+	s.mu.Lock()
+	snap, ok := s.sessions[sessionID]
+	if ok {
+		s.sessions[sessionID] = nil
+	}
+	s.mu.Unlock()
+	if snap != nil {
+		snap.close()
+	}
+}
+
+// end turns snapshot reads off for the session.
+func (s *snapshots) end(sessionID string) {
+	s.mu.Lock()
+	snap := s.sessions[sessionID]
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+	if snap != nil {
+		snap.close()
+	}
+}
+
+// readOnlyTool reports whether the tool named is annotated read-only.
+func readOnlyTool(s *server.MCPServer, name string) bool {
+	tool := s.GetTool(name)
+	return tool != nil && tool.Tool.Annotations.ReadOnlyHint != nil && *tool.Tool.Annotations.ReadOnlyHint
+}
+
+// hooks ends a session's snapshot reads when the session ends. A call to a
+// tool that readOnly does not vouch for may have written, so the snapshot
+// is released after it to let the session see its own writes.
+func (s *snapshots) hooks(readOnly func(name string) bool) *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		s.end(session.SessionID())
+	})
+	hooks.AddAfterCallTool(func(ctx context.Context, id any, message *mcp.CallToolRequest, result *mcp.CallToolResult) {
+		if readOnly(message.Params.Name) {
+			return
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			s.release(session.SessionID())
+		}
+	})
+	return hooks
+}
+
+// registerSnapshotReads adds the snapshot_reads tool.
+func registerSnapshotReads(s *server.MCPServer, snaps *snapshots) {
+	s.AddTool(mcp.NewTool("snapshot_reads",
+		mcp.WithDescription(`Turn snapshot reads on or off for this session.
+
+While on, query, validate_query and run_saved_query read from a snapshot taken when you turn it on, so other clients' writes do not change results mid-task. Read-only tools keep the snapshot; a call to any tool that may write releases it, and the next read takes a new one that includes the write. Calling it again takes a fresh snapshot. Holding a snapshot delays WAL checkpoints, so turn it off when done.`),
+		mcp.WithBoolean("enabled",
+			mcp.Description("true takes a snapshot now (default), false reads the latest data again"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), snapshotReadsHandler(snaps))
+}
+
+func snapshotReadsHandler(snaps *snapshots) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		session := server.ClientSessionFromContext(ctx)
+		if session == nil {
+			return toolError(codeInvalidArgument, "snapshot reads need an MCP session"), nil
+		}
+		if !request.GetBool("enabled", true) {
+			snaps.end(session.SessionID())
+			return mcp.NewToolResultText("success: snapshot reads off, reads see the latest data"), nil
+		}
+		if err := snaps.start(ctx, session.SessionID()); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to take a snapshot: %v", err), nil
+		}
+		return mcp.NewToolResultText("success: snapshot reads on, reads see the data as of now until this session writes or turns them off"), nil
+	}
+}
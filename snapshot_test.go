@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type testSession struct {
+	id string
+}
+
+func (s *testSession) Initialize()       {}
+func (s *testSession) Initialized() bool { return true }
+func (s *testSession) SessionID() string { return s.id }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return make(chan mcp.JSONRPCNotification, 10)
+}
+
+func sessionContext(id string) context.Context {
+	return server.NewMCPServer("test", "0.0.0").WithContext(context.Background(), &testSession{id: id})
+}
+
+func TestSnapshots_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	snaps := newSnapshots(db)
+	ctx := sessionContext("snapshot-test")
+	defer snaps.end("snapshot-test")
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'snapshot_test_1357%'")
+
+	handler := queryHandler(db, snaps, nil)
+	query := func(name string) string {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "query"
+		req.Params.Arguments = map[string]any{"sql": "SELECT name FROM entities WHERE name = '" + name + "'"}
+		result, err := handler(ctx, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+	insert := func(name string) {
+		t.Helper()
+		if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES (?, 'Test')", name); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	readOnly := map[string]bool{"query": true, "search_nodes": true}
+	afterCall := func(tool string) {
+		req := &mcp.CallToolRequest{}
+		req.Params.Name = tool
+		for _, hook := range snaps.hooks(func(name string) bool { return readOnly[name] }).OnAfterCallTool {
+			hook(ctx, 1, req, nil)
+		}
+	}
+
+	t.Run("off by default", func(t *testing.T) {
+		insert("snapshot_test_13571")
+		if text := query("snapshot_test_13571"); !strings.Contains(text, "snapshot_test_13571") {
+			t.Fatalf("expected a live read, got %q", text)
+		}
+	})
+
+	result, err := callTool(snapshotReadsHandler(snaps), "snapshot_reads", nil)
+	if err != nil || !result.IsError {
+		t.Errorf("snapshot_reads without a session: %v %v", result, err)
+	}
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "snapshot_reads"
+	if result, err := snapshotReadsHandler(snaps)(ctx, req); err != nil || result.IsError {
+		t.Fatalf("snapshot_reads: %v %v", result, err)
+	}
+	insert("snapshot_test_13579")
+
+	t.Run("pinned read does not see concurrent write", func(t *testing.T) {
+		if text := query("snapshot_test_13579"); text != "no results" {
+			t.Fatalf("expected no results from snapshot, got %q", text)
+		}
+	})
+
+	t.Run("read-only tools keep the snapshot", func(t *testing.T) {
+		afterCall("search_nodes")
+		if text := query("snapshot_test_13579"); text != "no results" {
+			t.Fatalf("expected no results after a read-only tool, got %q", text)
+		}
+	})
+
+	t.Run("a write releases the snapshot", func(t *testing.T) {
+		afterCall("add_observation")
+		if text := query("snapshot_test_13579"); !strings.Contains(text, "snapshot_test_13579") {
+			t.Fatalf("expected row after a write, got %q", text)
+		}
+		insert("snapshot_test_13577")
+		if text := query("snapshot_test_13577"); text != "no results" {
+			t.Fatalf("expected the next read to take a new snapshot, got %q", text)
+		}
+	})
+
+	t.Run("lost snapshot fails instead of re-taking", func(t *testing.T) {
+		snaps.mu.Lock()
+		snap := snaps.sessions["snapshot-test"]
+		snap.lost = errors.New("stream expired")
+		snaps.mu.Unlock()
+		snap.close()
+
+		if text := query("snapshot_test_13579"); !strings.Contains(text, "snapshot was lost") {
+			t.Fatalf("expected lost snapshot error, got %q", text)
+		}
+		afterCall("search_nodes")
+		if text := query("snapshot_test_13579"); !strings.Contains(text, "snapshot was lost") {
+			t.Fatalf("a read-only tool re-took a lost snapshot: %q", text)
+		}
+	})
+
+	t.Run("turned off reads live", func(t *testing.T) {
+		req.Params.Arguments = map[string]any{"enabled": false}
+		if result, err := snapshotReadsHandler(snaps)(ctx, req); err != nil || result.IsError {
+			t.Fatalf("snapshot_reads off: %v %v", result, err)
+		}
+		if text := query("snapshot_test_13577"); !strings.Contains(text, "snapshot_test_13577") {
+			t.Fatalf("expected a live read, got %q", text)
+		}
+	})
+}
+
+func TestReadOnlyTool(t *testing.T) {
+	s := server.NewMCPServer("test", "1.0.0")
+	noop := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) { return nil, nil }
+	s.AddTool(mcp.NewTool("count", mcp.WithReadOnlyHintAnnotation(true)), noop)
+	s.AddTool(mcp.NewTool("execute"), noop)
+	for name, want := range map[string]bool{"count": true, "execute": false, "missing": false} {
+		if got := readOnlyTool(s, name); got != want {
+			t.Errorf("readOnlyTool(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// sqlKeywords are upper-cased by normalizeSQL; other words, such as table
+// and column names, keep their case.
+var sqlKeywords = make(map[string]bool)
+
+func init() {
+	for _, k := range strings.Fields(`ABORT ALL ALTER ALWAYS AND AS ASC ATTACH AUTOINCREMENT BEGIN BETWEEN BY CASCADE CASE
+		CAST CHECK COLLATE COMMIT CONFLICT CONSTRAINT CREATE CROSS CURRENT_DATE CURRENT_TIME CURRENT_TIMESTAMP
+		DEFAULT DEFERRED DELETE DESC DETACH DISTINCT DO DROP EACH ELSE END ESCAPE EXCEPT EXCLUSIVE EXISTS EXPLAIN
+		FAIL FILTER FIRST FOLLOWING FOR FOREIGN FROM FULL GLOB GROUP GROUPS HAVING IF IGNORE IMMEDIATE IN INDEX
+		INDEXED INNER INSERT INSTEAD INTERSECT INTO IS ISNULL JOIN KEY LAST LEFT LIKE LIMIT MATCH MATERIALIZED
+		NATURAL NO NOT NOTHING NOTNULL NULL NULLS OF OFFSET ON OR ORDER OUTER OVER PARTITION PLAN PRAGMA
+		PRECEDING PRIMARY QUERY RANGE RECURSIVE REFERENCES REGEXP REINDEX RELEASE RENAME REPLACE RESTRICT
+		RETURNING RIGHT ROLLBACK ROW ROWS SAVEPOINT SELECT SET TABLE TEMP TEMPORARY THEN TO TRANSACTION TRIGGER
+		UNBOUNDED UNION UNIQUE UPDATE USING VACUUM VALUES VIEW VIRTUAL WHEN WHERE WINDOW WITH WITHOUT`) {
+		sqlKeywords[k] = true
+	}
+}
+
+type sqlTokenKind int
+
+const (
+	tokenWord sqlTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenBlob
+	tokenParam
+	tokenQuoted
+	tokenPunct
+)
+
+// sqlToken is one token of a statement. space is set when whitespace or a
+// comment came before it; pos is its byte offset in the statement.
+type sqlToken struct {
+	kind  sqlTokenKind
+	text  string
+	space bool
+	pos   int
+}
+
+// tokenizeSQL splits SQLite SQL into tokens, dropping comments and
+// whitespace. It never fails: an unterminated string or comment runs to the
+// end of the input.
+func tokenizeSQL(s string) []sqlToken {
+	var tokens []sqlToken
+	space := false
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			space = true
+			continue
+		case strings.HasPrefix(s[i:], "--"):
+			if n := strings.IndexByte(s[i:], '\n'); n >= 0 {
+				i += n + 1
+			} else {
+				i = len(s)
+			}
+			space = true
+			continue
+		case strings.HasPrefix(s[i:], "/*"):
+			if n := strings.Index(s[i+2:], "*/"); n >= 0 {
+				i += n + 4
+			} else {
+				i = len(s)
+			}
+			space = true
+			continue
+		case (c == 'x' || c == 'X') && i+1 < len(s) && s[i+1] == '\'':
+			i = quotedEnd(s, i+1, '\'')
+			tokens = append(tokens, sqlToken{tokenBlob, s[start:i], space, start})
+		case c == '\'':
+			i = quotedEnd(s, i, '\'')
+			tokens = append(tokens, sqlToken{tokenString, s[start:i], space, start})
+		case c == '"' || c == '`':
+			i = quotedEnd(s, i, c)
+			tokens = append(tokens, sqlToken{tokenQuoted, s[start:i], space, start})
+		case c == '[':
+			if n := strings.IndexByte(s[i:], ']'); n >= 0 {
+				i += n + 1
+			} else {
+				i = len(s)
+			}
+			tokens = append(tokens, sqlToken{tokenQuoted, s[start:i], space, start})
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			i++
+			for i < len(s) && (isWordByte(s[i]) || s[i] == '.' || (s[i] == '+' || s[i] == '-') && (s[i-1] == 'e' || s[i-1] == 'E')) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenNumber, s[start:i], space, start})
+		case c == '?' || c == ':' || c == '@' || c == '$':
+			i++
+			for i < len(s) && isWordByte(s[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenParam, s[start:i], space, start})
+		case isWordByte(c) || c >= 0x80:
+			for i < len(s) && (isWordByte(s[i]) || s[i] >= 0x80) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenWord, s[start:i], space, start})
+		default:
+			i++
+			// Two-character operators stay together.
+			if i < len(s) && strings.Contains("|| <= >= <> != == << >> ->", s[start:i+1]) && strings.TrimSpace(s[start:i+1]) == s[start:i+1] {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenPunct, s[start:i], space, start})
+		}
+		space = false
+	}
+	return tokens
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// quotedEnd returns the index after the quote closing the one at i, where a
+// doubled quote is an escaped one.
+func quotedEnd(s string, i int, quote byte) int {
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == quote {
+			if j+1 < len(s) && s[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// joinTokens writes tokens on one line, a single space wherever the input
+// had whitespace or a comment, keywords upper-cased.
+func joinTokens(tokens []sqlToken) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && t.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tokenText(t))
+	}
+	return b.String()
+}
+
+func tokenText(t sqlToken) string {
+	if t.kind == tokenWord {
+		if upper := strings.ToUpper(t.text); sqlKeywords[upper] {
+			return upper
+		}
+	}
+	return t.text
+}
+
+// normalizeSQL is sql for logs and traces: comments stripped, whitespace
+// collapsed to single spaces and keywords upper-cased, so the same statement
+// reads the same however an agent laid it out.
+func normalizeSQL(sql string) string {
+	return joinTokens(tokenizeSQL(sql))
+}
+
+// sqlShape is sql with its values taken out: literals and parameters become
+// ?, and lists of them, such as IN (1, 2, 3) or several VALUES rows,
+// collapse to one, so statements differing only in values share a shape.
+func sqlShape(sql string) string {
+	var out []sqlToken
+	for _, t := range tokenizeSQL(sql) {
+		switch t.kind {
+		case tokenString, tokenNumber, tokenBlob, tokenParam:
+			// A negative number is one value.
+			if n := len(out); n >= 2 && out[n-1].text == "-" && !t.space && startsOperand(out[n-2]) {
+				t.space = out[n-1].space
+				out = out[:n-1]
+			}
+			t = sqlToken{tokenParam, "?", t.space, t.pos}
+		}
+		// "?, ?" becomes "?".
+		if n := len(out); t.text == "?" && n >= 2 && out[n-1].text == "," && out[n-2].text == "?" {
+			out = out[:n-1]
+			continue
+		}
+		out = append(out, t)
+	}
+	return joinTokens(collapseValueRows(out))
+}
+
+// startsOperand reports whether a value can follow t, so a "-" after it is
+// a sign rather than a subtraction.
+func startsOperand(t sqlToken) bool {
+	switch t.kind {
+	case tokenPunct:
+		return t.text != ")"
+	case tokenWord:
+		return sqlKeywords[strings.ToUpper(t.text)]
+	}
+	return false
+}
+
+// isValueList reports whether out ends with a parenthesised list of values,
+// "(?)" after collapsing.
+func isValueList(out []sqlToken) bool {
+	n := len(out)
+	return n >= 3 && out[n-1].text == ")" && out[n-2].text == "?" && out[n-3].text == "("
+}
+
+// collapseValueRows drops the repeats in "(?), (?), (?)" left by sqlShape.
+func collapseValueRows(tokens []sqlToken) []sqlToken {
+	var out []sqlToken
+	for i := 0; i < len(tokens); i++ {
+		n := len(out)
+		if tokens[i].text == "," && n >= 3 && isValueList(out) &&
+			i+3 < len(tokens) && tokens[i+1].text == "(" && tokens[i+2].text == "?" && tokens[i+3].text == ")" {
+			i += 3
+			continue
+		}
+		out = append(out, tokens[i])
+	}
+	return out
+}
+
+// sqlFingerprint identifies a statement shape.
+func sqlFingerprint(shape string) string {
+	sum := sha256.Sum256([]byte(shape))
+	return hex.EncodeToString(sum[:8])
+}
+
+// clauseKeywords start a new line in prettySQL.
+var clauseKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true,
+	"JOIN": true, "LEFT": true, "INNER": true, "CROSS": true, "NATURAL": true, "UNION": true, "INTERSECT": true,
+	"EXCEPT": true, "VALUES": true, "SET": true, "RETURNING": true, "WINDOW": true,
+}
+
+// prettySQL lays sql out one clause per line, indented by nesting, for
+// reports people read.
+func prettySQL(sql string) string {
+	tokens := tokenizeSQL(sql)
+	var b strings.Builder
+	depth := 0
+	for i, t := range tokens {
+		text := tokenText(t)
+		breaks := t.kind == tokenWord && clauseKeywords[text] && i > 0 && !clauseContinues(tokens[i-1], text)
+		switch {
+		case breaks:
+			b.WriteString("\n" + strings.Repeat("  ", depth))
+		case i > 0 && t.space:
+			b.WriteByte(' ')
+		}
+		b.WriteString(text)
+		switch text {
+		case "(":
+			depth++
+		case ")":
+			depth = max(0, depth-1)
+		}
+	}
+	return strings.TrimRightFunc(b.String(), unicode.IsSpace)
+}
+
+// clauseContinues reports whether keyword continues the clause prev is part
+// of, as JOIN does after LEFT, or FROM after DELETE.
+func clauseContinues(prev sqlToken, keyword string) bool {
+	p := strings.ToUpper(prev.text)
+	switch keyword {
+	case "JOIN":
+		return p == "LEFT" || p == "INNER" || p == "CROSS" || p == "OUTER" || p == "NATURAL" || p == "RIGHT" || p == "FULL"
+	case "LEFT", "INNER", "CROSS":
+		return p == "NATURAL"
+	case "FROM":
+		return p == "DELETE" || p == "DISTINCT"
+	case "SELECT":
+		return p == "(" || p == "AS" || p == "ALL"
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestNormalizeSQL(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"casing and whitespace", "select  id,\n\tname\nfrom entities   where id = 1", "SELECT id, name FROM entities WHERE id = 1"},
+		{"line comment", "SELECT 1 -- why\nFROM tags", "SELECT 1 FROM tags"},
+		{"block comment", "SELECT/* all */* FROM tags", "SELECT * FROM tags"},
+		{"strings kept", "select 'Select -- not a comment' from tags", "SELECT 'Select -- not a comment' FROM tags"},
+		{"escaped quote", "select 'it''s' /* x */ from tags", "SELECT 'it''s' FROM tags"},
+		{"quoted identifiers kept", `select "from", [where] from t`, `SELECT "from", [where] FROM t`},
+		{"names keep case", "select Name from Entities", "SELECT Name FROM Entities"},
+		{"unterminated comment", "SELECT 1 /* open", "SELECT 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeSQL(tt.input); got != tt.want {
+				t.Errorf("normalizeSQL(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLShape(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"literals", "select * from observations where id = 42 and content like 'TODO%'", "SELECT * FROM observations WHERE id = ? AND content LIKE ?"},
+		{"params", "SELECT * FROM tags WHERE name = :tag OR id = ?2", "SELECT * FROM tags WHERE name = ? OR id = ?"},
+		{"in list", "SELECT * FROM tags WHERE id IN (1, 2, 3)", "SELECT * FROM tags WHERE id IN (?)"},
+		{"value rows", "INSERT INTO tags (name, description) VALUES ('a', 'b'), ('c', 'd')", "INSERT INTO tags (name, description) VALUES (?)"},
+		{"negative", "SELECT * FROM t WHERE x > -5", "SELECT * FROM t WHERE x > ?"},
+		{"negative after keyword", "SELECT -5, a FROM t", "SELECT ?, a FROM t"},
+		{"subtraction", "SELECT a-1 FROM t", "SELECT a-? FROM t"},
+		{"columns kept", "SELECT id, name FROM tags", "SELECT id, name FROM tags"},
+		{"blob", "SELECT X'00ff'", "SELECT ?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlShape(tt.input); got != tt.want {
+				t.Errorf("sqlShape(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	a := sqlFingerprint(sqlShape("select * from tags where id = 1"))
+	b := sqlFingerprint(sqlShape("SELECT *\nFROM tags -- one tag\nWHERE id = 7"))
+	if a != b || len(a) != 16 {
+		t.Errorf("fingerprints %q and %q, want the same 16 characters", a, b)
+	}
+}
+
+func TestPrettySQL(t *testing.T) {
+	got := prettySQL("select o.id from observations o left join observation_tags ot on ot.observation_id = o.id where o.id in (select observation_id from observation_tags) order by o.id limit 5")
+	want := `SELECT o.id
+FROM observations o
+LEFT JOIN observation_tags ot ON ot.observation_id = o.id
+WHERE o.id IN (SELECT observation_id
+  FROM observation_tags)
+ORDER BY o.id
+LIMIT 5`
+	if got != want {
+		t.Errorf("prettySQL =\n%s\nwant\n%s", got, want)
+	}
+}
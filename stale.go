@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultStaleMonths = 6
+	defaultStaleBatch  = 10
+	maxStaleBatch      = 50
+)
+
+// staleFilter selects observations, aliased o, written before the cutoff
+// that nothing has touched since: recall has not returned them, no review
+// has found them still true, they have not been edited and their entity is
+// not archived, which already took them out of recall. It takes the cutoff
+// four times.
+const staleFilter = `o.created_at < ?
+	AND NOT EXISTS (SELECT 1 FROM observation_access a WHERE a.observation_id = o.id AND a.day >= date(?))
+	AND NOT EXISTS (SELECT 1 FROM observation_reviews r WHERE r.observation_id = o.id AND r.reviewed_at >= ?)
+	AND NOT EXISTS (SELECT 1 FROM changes c WHERE c.table_name = 'observations' AND c.row_id = o.id AND c.op = 'update' AND c.changed_at >= ?)
+	AND o.entity_id IN (SELECT id FROM entities WHERE archived_at IS NULL)`
+
+// markReviewed records that the user confirmed ids are still true, so they
+// leave the stale queue until they go unused for another period. Ids the
+// caller cannot see are skipped; it returns how many were recorded.
+func markReviewed(ctx context.Context, db *sql.DB, levels []string, ids []int64) (int64, error) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	res, err := db.ExecContext(ctx, restrictVisibility(`INSERT INTO observation_reviews (observation_id)
+		SELECT id FROM observations WHERE id IN (`+placeholders(len(ids))+`)
+		ON CONFLICT (observation_id) DO UPDATE SET reviewed_at = CURRENT_TIMESTAMP`, levels), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// registerReviewStale adds the review_stale tool.
+func registerReviewStale(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("review_stale",
+		mcp.WithDescription(`List old observations nothing has used in months, oldest first, a batch at a time, for a periodic "is this still true?" review with the user.
+
+An observation is stale when it is older than months and since then no recall tool has returned it, no review has confirmed it and it has not been edited. Observations of archived entities are left out. Pass the ones the user confirms as still_true on the next call, which also lists the next batch; correct or delete the rest with execute.`),
+		mcp.WithNumber("months",
+			mcp.Description(fmt.Sprintf("How long an observation must have gone unused (default %d)", defaultStaleMonths)),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Observations per batch (default %d, max %d)", defaultStaleBatch, maxStaleBatch)),
+		),
+		mcp.WithArray("still_true",
+			mcp.Description("IDs of observations from the previous batch the user confirmed; they leave the queue until they go unused for another months"),
+			mcp.WithNumberItems(),
+		),
+	), reviewStaleHandler(db, scopes))
+}
+
+func reviewStaleHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		months := request.GetInt("months", defaultStaleMonths)
+		if months < 1 || months > 120 {
+			return toolError(codeInvalidArgument, "months must be between 1 and 120"), nil
+		}
+		limit := request.GetInt("limit", defaultStaleBatch)
+		if limit < 1 || limit > maxStaleBatch {
+			return toolErrorf(codeInvalidArgument, "limit must be between 1 and %d", maxStaleBatch), nil
+		}
+		levels := scopes.levels(ctx)
+
+		var sb strings.Builder
+		if raw := request.GetIntSlice("still_true", nil); len(raw) > 0 {
+			ids := make([]int64, len(raw))
+			for i, id := range raw {
+				ids[i] = int64(id)
+			}
+			n, err := markReviewed(ctx, db, levels, ids)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to record review: %v", err), nil
+			}
+			fmt.Fprintf(&sb, "marked %d observations still true\n\n", n)
+		}
+
+		cutoff := time.Now().UTC().AddDate(0, -months, 0).Format("2006-01-02 15:04:05")
+		cutoffs := []any{cutoff, cutoff, cutoff, cutoff}
+		var total int
+		if err := db.QueryRowContext(ctx, restrictVisibility("SELECT count(*) FROM observations o WHERE "+staleFilter, levels), cutoffs...).Scan(&total); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to count stale observations: %v", err), nil
+		}
+		if total == 0 {
+			fmt.Fprintf(&sb, "no stale observations: everything older than %d months has been recalled, reviewed or edited since", months)
+			return mcp.NewToolResultText(sb.String()), nil
+		}
+
+		cols, results, err := runQuery(ctx, db, restrictVisibility(`SELECT o.id, e.name AS entity, o.content,
+				COALESCE((SELECT group_concat(t.name, ',') FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE ot.observation_id = o.id), '') AS tags,
+				o.source, o.created_at,
+				(SELECT MAX(a.last_at) FROM observation_access a WHERE a.observation_id = o.id) AS last_returned
+			FROM observations o JOIN entities e ON e.id = o.entity_id
+			WHERE `+staleFilter+`
+			ORDER BY o.created_at, o.id
+			LIMIT ?`, levels), append(cutoffs, limit)...)
+		if err != nil {
+			return toolErrorFrom(err, codeDatabase), nil
+		}
+		fmt.Fprintf(&sb, "%d observations older than %d months have not been recalled, reviewed or edited since; the oldest %d follow.\n", total, months, len(results))
+		sb.WriteString("Ask the user whether each is still true. Pass the ones that are as still_true on the next call; correct or delete the others with execute.\n\n")
+		sb.WriteString(formatRows(cols, results))
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+}
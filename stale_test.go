@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestReviewStale_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'stale-test%'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('stale-test', 'test'), ('stale-test-archived', 'test')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	ids := make(map[string]int64)
+	for _, o := range []struct{ entity, content, createdAt string }{
+		{"stale-test", "stale-test forgotten fact", "2000-01-01 00:00:00"},
+		{"stale-test", "stale-test recalled fact", "2000-01-02 00:00:00"},
+		{"stale-test", "stale-test new fact", "2999-01-01 00:00:00"},
+		{"stale-test-archived", "stale-test archived fact", "2000-01-01 00:00:00"},
+	} {
+		res, err := db.Exec("INSERT INTO observations (entity_id, content, created_at) SELECT id, ?, ? FROM entities WHERE name = ?", o.content, o.createdAt, o.entity)
+		if err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		ids[o.content], _ = res.LastInsertId()
+	}
+	if _, err := db.Exec("UPDATE entities SET archived_at = CURRENT_TIMESTAMP WHERE name = 'stale-test-archived'"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	recordAccess(ctx, db, []int64{ids["stale-test recalled fact"]}, nil)
+
+	review := func(args map[string]any) string {
+		t.Helper()
+		args["limit"] = maxStaleBatch
+		result, err := callTool(reviewStaleHandler(db, nil), "review_stale", args)
+		if err != nil || result.IsError {
+			t.Fatalf("review_stale: %v %v", err, result.Content)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+	text := review(map[string]any{})
+	if !strings.Contains(text, "content: stale-test forgotten fact\n") {
+		t.Errorf("expected the forgotten fact in:\n%s", text)
+	}
+	for _, content := range []string{"stale-test recalled fact", "stale-test new fact", "stale-test archived fact"} {
+		if strings.Contains(text, content) {
+			t.Errorf("did not expect %q in:\n%s", content, text)
+		}
+	}
+
+	text = review(map[string]any{"still_true": []any{float64(ids["stale-test forgotten fact"])}})
+	if !strings.HasPrefix(text, "marked 1 observations still true") || strings.Contains(text, "stale-test forgotten fact") {
+		t.Errorf("expected the forgotten fact to leave the queue, got:\n%s", text)
+	}
+
+	for _, args := range []map[string]any{{"months": 0}, {"limit": 1000}} {
+		result, err := callTool(reviewStaleHandler(db, nil), "review_stale", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Errorf("review_stale %v: expected error, got %v", args, result.Content[0].(mcp.TextContent).Text)
+		}
+	}
+}
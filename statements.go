@@ -0,0 +1,202 @@
+package main
+
+import "strings"
+
+// sqlStatement is what the SQL tools need to know about a statement before
+// running it: the verb that decides what it does, after any WITH clause,
+// and for a write the table it writes to.
+type sqlStatement struct {
+	// verb is the statement's first keyword after a leading WITH clause,
+	// upper-cased: SELECT, INSERT, UPDATE and so on.
+	verb string
+	// table is the table an INSERT, REPLACE, UPDATE or DELETE writes to,
+	// unquoted, unqualified and lower-cased; "" for other statements.
+	table string
+	// where is set when an UPDATE or DELETE has a WHERE clause of its own,
+	// not just one inside a subquery.
+	where bool
+	// with is set when the statement starts with a WITH clause.
+	with bool
+}
+
+// writeVerbs change rows; the execute tool takes only these, query none.
+var writeVerbs = map[string]bool{"INSERT": true, "REPLACE": true, "UPDATE": true, "DELETE": true}
+
+// blockedVerbs are rejected by both SQL tools.
+var blockedVerbs = map[string]bool{"DROP": true, "TRUNCATE": true, "ALTER": true, "CREATE": true, "ATTACH": true, "DETACH": true}
+
+func (s sqlStatement) isWrite() bool { return writeVerbs[s.verb] }
+
+// parseStatement reads sqlStr far enough to classify it. It works on tokens,
+// so keywords inside strings, quoted names and comments do not count, and it
+// rejects more than one statement: the libsql driver runs them all.
+func parseStatement(sqlStr string) (sqlStatement, error) {
+	tokens := tokenizeSQL(sqlStr)
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return sqlStatement{}, errorf(codeInvalidSQL, "empty statement")
+	}
+	for _, t := range tokens {
+		if t.kind == tokenPunct && t.text == ";" {
+			return sqlStatement{}, errorf(codeForbiddenSQL, "one statement at a time: run each statement in its own call")
+		}
+	}
+
+	var stmt sqlStatement
+	i := 0
+	if isKeyword(tokens[0], "WITH") {
+		stmt.with = true
+		var ok bool
+		if i, ok = skipWith(tokens); !ok {
+			return sqlStatement{}, errorf(codeInvalidSQL, "could not read the WITH clause")
+		}
+	}
+	if i >= len(tokens) || tokens[i].kind != tokenWord {
+		return sqlStatement{}, errorf(codeInvalidSQL, "the statement does not start with a keyword such as SELECT or INSERT")
+	}
+	stmt.verb = strings.ToUpper(tokens[i].text)
+
+	rest := tokens[i+1:]
+	switch stmt.verb {
+	case "INSERT", "REPLACE":
+		if len(rest) >= 2 && isKeyword(rest[0], "OR") {
+			rest = rest[2:]
+		}
+		if len(rest) > 0 && isKeyword(rest[0], "INTO") {
+			stmt.table, _ = tableName(rest[1:])
+		}
+	case "UPDATE":
+		if len(rest) >= 2 && isKeyword(rest[0], "OR") {
+			rest = rest[2:]
+		}
+		var n int
+		stmt.table, n = tableName(rest)
+		stmt.where = hasTopLevel(rest[n:], "WHERE")
+	case "DELETE":
+		if len(rest) > 0 && isKeyword(rest[0], "FROM") {
+			var n int
+			stmt.table, n = tableName(rest[1:])
+			stmt.where = hasTopLevel(rest[1+n:], "WHERE")
+		}
+	}
+	return stmt, nil
+}
+
+// skipWith returns the index of the token after the WITH clause tokens
+// start with, and false if it is malformed:
+// WITH [RECURSIVE] name [(columns)] AS [NOT] [MATERIALIZED] (select) [, ...].
+func skipWith(tokens []sqlToken) (int, bool) {
+	i := 1
+	if i < len(tokens) && isKeyword(tokens[i], "RECURSIVE") {
+		i++
+	}
+	for {
+		if i >= len(tokens) || (tokens[i].kind != tokenWord && tokens[i].kind != tokenQuoted) {
+			return 0, false
+		}
+		i++
+		if i < len(tokens) && tokens[i].text == "(" {
+			if i = closingParen(tokens, i); i < 0 {
+				return 0, false
+			}
+		}
+		if i >= len(tokens) || !isKeyword(tokens[i], "AS") {
+			return 0, false
+		}
+		i++
+		if i < len(tokens) && isKeyword(tokens[i], "NOT") {
+			i++
+		}
+		if i < len(tokens) && isKeyword(tokens[i], "MATERIALIZED") {
+			i++
+		}
+		if i >= len(tokens) || tokens[i].text != "(" {
+			return 0, false
+		}
+		if i = closingParen(tokens, i); i < 0 {
+			return 0, false
+		}
+		if i < len(tokens) && tokens[i].text == "," {
+			i++
+			continue
+		}
+		return i, true
+	}
+}
+
+// closingParen returns the index after the ")" matching the "(" at i, or -1
+// if it is never closed.
+func closingParen(tokens []sqlToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// tableName reads a possibly schema-qualified table name at the start of
+// tokens and returns it unquoted, unqualified and lower-cased, with the
+// number of tokens it took.
+func tableName(tokens []sqlToken) (string, int) {
+	if len(tokens) == 0 || (tokens[0].kind != tokenWord && tokens[0].kind != tokenQuoted) {
+		return "", 0
+	}
+	n := 1
+	name := tokens[0]
+	if len(tokens) >= 3 && tokens[1].text == "." && (tokens[2].kind == tokenWord || tokens[2].kind == tokenQuoted) {
+		name = tokens[2]
+		n = 3
+	}
+	return strings.ToLower(unquoteName(name)), n
+}
+
+// unquoteName strips the quotes from a "name", `name` or [name].
+func unquoteName(t sqlToken) string {
+	if t.kind != tokenQuoted || len(t.text) < 2 {
+		return t.text
+	}
+	switch q := t.text[0]; q {
+	case '"', '`':
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], string([]byte{q, q}), string(q))
+	}
+	return t.text[1 : len(t.text)-1]
+}
+
+// hasTopLevel reports whether keyword appears in tokens outside parentheses.
+func hasTopLevel(tokens []sqlToken, keyword string) bool {
+	depth := 0
+	for _, t := range tokens {
+		switch {
+		case t.text == "(":
+			depth++
+		case t.text == ")":
+			depth--
+		case depth == 0 && isKeyword(t, keyword):
+			return true
+		}
+	}
+	return false
+}
+
+func isKeyword(t sqlToken, keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// insertInto matches an INSERT or REPLACE into the named table, with or
+// without a WITH clause before it.
+type insertInto string
+
+func (t insertInto) MatchString(sqlStr string) bool {
+	stmt, err := parseStatement(sqlStr)
+	return err == nil && (stmt.verb == "INSERT" || stmt.verb == "REPLACE") && stmt.table == string(t)
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		sql   string
+		want  sqlStatement
+		error string
+	}{
+		{sql: "select 1", want: sqlStatement{verb: "SELECT"}},
+		{sql: "WITH a AS (SELECT 1), b AS NOT MATERIALIZED (SELECT 2) SELECT * FROM a, b", want: sqlStatement{verb: "SELECT", with: true}},
+		{sql: `WITH "a;b"(x) AS (SELECT ';') DELETE FROM "Tags" WHERE id IN "a;b"`, want: sqlStatement{verb: "DELETE", table: "tags", where: true, with: true}},
+		{sql: "INSERT OR REPLACE INTO main.[tags] (name) VALUES ('where')", want: sqlStatement{verb: "INSERT", table: "tags"}},
+		{sql: "UPDATE OR IGNORE tags SET name = 'x' -- WHERE id = 1", want: sqlStatement{verb: "UPDATE", table: "tags"}},
+		{sql: "DELETE FROM tags;\n", want: sqlStatement{verb: "DELETE", table: "tags"}},
+		{sql: "SELECT 1; SELECT 2", error: codeForbiddenSQL},
+		{sql: "WITH x AS SELECT 1", error: codeInvalidSQL},
+		{sql: " ; ", error: codeInvalidSQL},
+	}
+	for _, tt := range tests {
+		got, err := parseStatement(tt.sql)
+		if tt.error != "" {
+			if code := errorCode(err, ""); code != tt.error {
+				t.Errorf("parseStatement(%q) error code = %q, want %s", tt.sql, code, tt.error)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseStatement(%q) = %+v, %v, want %+v", tt.sql, got, err, tt.want)
+		}
+	}
+}
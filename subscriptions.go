@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	schemaURI          = "memory://schema"
+	recentURI          = "memory://recent"
+	entityURIPrefix    = "memory://entity/"
+	recentLimit        = 20
+	changePollInterval = 2 * time.Second
+
+	// mcp-go has no constants for these, as it does not implement them.
+	methodSubscribe   = "resources/subscribe"
+	methodUnsubscribe = "resources/unsubscribe"
+)
+
+func entityURI(name string) string {
+	return entityURIPrefix + url.PathEscape(name)
+}
+
+// stdioSessionID is the id mcp-go gives the one session on stdio.
+const stdioSessionID = "stdio"
+
+// subscriptions holds the resource URIs each session subscribed to. mcp-go
+// advertises the subscribe capability but does not handle resources/subscribe,
+// so the requests are answered here, in front of the stdio or HTTP server.
+type subscriptions struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]bool
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{sessions: make(map[string]map[string]bool)}
+}
+
+// subscribers returns the ids of the sessions subscribed to uri.
+func (s *subscriptions) subscribers(uri string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for id, uris := range s.sessions {
+		if uris[uri] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (s *subscriptions) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions) == 0
+}
+
+// drop forgets the subscriptions of a session that ended.
+func (s *subscriptions) drop(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+}
+
+// notifier returns the notify function for the watchers, which tells one
+// session of s that uri changed.
+func notifier(s *server.MCPServer) func(sessionID, uri string) {
+	return func(sessionID, uri string) {
+		// The session may have ended or, on HTTP, have no stream open to
+		// receive it; the client reads the resource when it is back.
+		s.SendNotificationToSpecificClient(sessionID, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+	}
+}
+
+// normalizeURI accepts memory://recent, memory://due and
+// memory://entity/{name}, with the name escaped or not, and returns the
+// canonical form notifications use.
+func normalizeURI(uri string) (string, error) {
+	if uri == recentURI || uri == dueURI {
+		return uri, nil
+	}
+	if name, ok := strings.CutPrefix(uri, entityURIPrefix); ok && name != "" {
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+		return entityURI(name), nil
+	}
+	return "", fmt.Errorf("cannot subscribe to %s: subscribe to %s, %s or %s{name}", uri, recentURI, dueURI, entityURIPrefix)
+}
+
+// handle answers a resources/subscribe or resources/unsubscribe request of
+// the session. It returns false for every other message, which goes on to
+// the MCP server.
+func (s *subscriptions) handle(sessionID string, line []byte) (mcp.JSONRPCMessage, bool) {
+	var msg struct {
+		ID     mcp.RequestId `json:"id"`
+		Method string        `json:"method"`
+		Params struct {
+			URI string `json:"uri"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return nil, false
+	}
+	if msg.Method != methodSubscribe && msg.Method != methodUnsubscribe {
+		return nil, false
+	}
+
+	uri, err := normalizeURI(msg.Params.URI)
+	if err != nil {
+		return mcp.NewJSONRPCError(msg.ID, mcp.INVALID_PARAMS, err.Error(), nil), true
+	}
+	s.mu.Lock()
+	uris := s.sessions[sessionID]
+	if msg.Method == methodSubscribe {
+		if uris == nil {
+			uris = make(map[string]bool)
+			s.sessions[sessionID] = uris
+		}
+		uris[uri] = true
+	} else if delete(uris, uri); len(uris) == 0 {
+		delete(s.sessions, sessionID)
+	}
+	s.mu.Unlock()
+	return mcp.NewJSONRPCResultResponse(msg.ID, mcp.EmptyResult{}), true
+}
+
+// intercept returns a reader of stdin with the stdio session's subscription
+// requests removed; their responses are written to out directly.
+func (s *subscriptions) intercept(in io.Reader, out io.Writer) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				if response, ok := s.handle(stdioSessionID, line); ok {
+					data, _ := json.Marshal(response)
+					fmt.Fprintf(out, "%s\n", data)
+				} else if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+// lockedWriter serializes writes so subscription responses and the stdio
+// server's own messages do not interleave. Both write one message per call.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// watchChanges polls for observations and relations added since the last poll,
+// by this or any other process sharing the database, and calls notify for
+// each session subscribed to a URI they affect.
+func (s *subscriptions) watchChanges(ctx context.Context, db *sql.DB, interval time.Duration, notify func(sessionID, uri string)) {
+	var lastObservation, lastRelation int64
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM observations").Scan(&lastObservation); err != nil {
+		log.Printf("change watcher disabled: %v", err)
+		return
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM relations").Scan(&lastRelation); err != nil {
+		log.Printf("change watcher disabled: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed := make(map[string]bool)
+		var err error
+		lastObservation, err = collectChanges(ctx, db, changed, lastObservation,
+			"SELECT o.id, e.name, e.name FROM observations o JOIN entities e ON e.id = o.entity_id WHERE o.id > ? ORDER BY o.id")
+		if err != nil {
+			log.Printf("change watcher: observations: %v", err)
+			continue
+		}
+		lastRelation, err = collectChanges(ctx, db, changed, lastRelation,
+			"SELECT r.id, f.name, t.name FROM relations r JOIN entities f ON f.id = r.from_id JOIN entities t ON t.id = r.to_id WHERE r.id > ? ORDER BY r.id")
+		if err != nil {
+			log.Printf("change watcher: relations: %v", err)
+			continue
+		}
+		if len(changed) == 0 || s.empty() {
+			continue
+		}
+
+		s.notifyAll(recentURI, notify)
+		for name := range changed {
+			s.notifyAll(entityURI(name), notify)
+		}
+	}
+}
+
+// watchDue notifies subscribers of memory://due when the reminders due
+// change: one comes due, is completed, or is added already due.
+func (s *subscriptions) watchDue(ctx context.Context, db *sql.DB, interval time.Duration, notify func(sessionID, uri string)) {
+	var last string
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if len(s.subscribers(dueURI)) == 0 {
+			last = ""
+			continue
+		}
+
+		var due sql.NullString
+		if err := db.QueryRowContext(ctx, `SELECT group_concat(id) FROM (SELECT id FROM reminders
+			WHERE completed_at IS NULL AND due_at <= ? ORDER BY id)`, time.Now().UTC().Format(reminderTimeForm)).Scan(&due); err != nil {
+			log.Printf("due watcher: %v", err)
+			continue
+		}
+		if due.String != last {
+			last = due.String
+			s.notifyAll(dueURI, notify)
+		}
+	}
+}
+
+// notifyAll calls notify for each session subscribed to uri.
+func (s *subscriptions) notifyAll(uri string, notify func(sessionID, uri string)) {
+	for _, id := range s.subscribers(uri) {
+		notify(id, uri)
+	}
+}
+
+// collectChanges adds the entity names of rows after last to changed and
+// returns the new high-water id.
+func collectChanges(ctx context.Context, db *sql.DB, changed map[string]bool, last int64, query string) (int64, error) {
+	rows, err := db.QueryContext(ctx, query, last)
+	if err != nil {
+		return last, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var a, b string
+		if err := rows.Scan(&id, &a, &b); err != nil {
+			return last, err
+		}
+		changed[a], changed[b] = true, true
+		last = id
+	}
+	return last, rows.Err()
+}
+
+// registerSubscribableResources adds the recent observations resource and
+// the entity template, whose readers are notified of new rows.
+func registerSubscribableResources(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddResource(mcp.NewResource(
+		recentURI,
+		"Recent observations",
+		mcp.WithResourceDescription(fmt.Sprintf("The %d most recent observations. Subscribe to be notified when any client stores new ones", recentLimit)),
+		mcp.WithMIMEType("text/plain"),
+	), recentHandler(db, scopes))
+
+	s.AddResourceTemplate(mcp.NewResourceTemplate(
+		entityURIPrefix+"{name}",
+		"Entity",
+		mcp.WithTemplateDescription("An entity with its observations and relations. Subscribe to be notified when any client adds observations or relations to it"),
+		mcp.WithTemplateMIMEType("application/json"),
+	), entityResourceHandler(db, scopes))
+}
+
+func recentHandler(db *sql.DB, scopes *visibilityScopes) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		sqlStr := restrictVisibility(`SELECT o.id, e.name AS entity, o.content, o.created_at
+			FROM observations o JOIN entities e ON e.id = o.entity_id
+			WHERE e.archived_at IS NULL
+			ORDER BY o.id DESC LIMIT ?`, scopes.levels(ctx))
+		cols, results, err := runQuery(ctx, db, sqlStr, recentLimit)
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      recentURI,
+				MIMEType: "text/plain",
+				Text:     formatRows(cols, results),
+			},
+		}, nil
+	}
+}
+
+func entityResourceHandler(db *sql.DB, scopes *visibilityScopes) server.ResourceTemplateHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		name := templateArgument(request, "name")
+		if name == "" {
+			return nil, fmt.Errorf("entity name missing from %s", request.Params.URI)
+		}
+
+		graph, err := loadGraph(ctx, db, scopes.levels(ctx), graphQuery{filter: "e.name = ?", args: []any{name}, details: true})
+		if err != nil {
+			return nil, err
+		}
+		if len(graph.Entities) == 0 {
+			return nil, fmt.Errorf("entity '%s' does not exist", name)
+		}
+		data, err := json.MarshalIndent(graph, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(data),
+			},
+		}, nil
+	}
+}
+
+// serveStdio serves s over stdin/stdout like server.ServeStdio, answering
+// resource subscriptions and notifying subscribers of new rows in db.
+func serveStdio(ctx context.Context, s *server.MCPServer, db *sql.DB, subs *subscriptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	go subs.watchChanges(ctx, db, changePollInterval, notifier(s))
+	go subs.watchDue(ctx, db, changePollInterval, notifier(s))
+
+	out := &lockedWriter{w: os.Stdout}
+	return server.NewStdioServer(s).Listen(ctx, subs.intercept(os.Stdin, out), out)
+}
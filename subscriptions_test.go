@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNormalizeURI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		{"memory://recent", "memory://recent", false},
+		{"memory://due", "memory://due", false},
+		{"memory://entity/pi", "memory://entity/pi", false},
+		{"memory://entity/home lab", "memory://entity/home%20lab", false},
+		{"memory://entity/home%20lab", "memory://entity/home%20lab", false},
+		{"memory://entity/", "", true},
+		{"memory://schema", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			got, err := normalizeURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeURI(%q) error = %v, wantErr %v", tt.uri, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeURI(%q) = %q, want %q", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionsIntercept(t *testing.T) {
+	subs := newSubscriptions()
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"memory://entity/pi"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"resources/subscribe","params":{"uri":"memory://schema"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"resources/subscribe","params":{"uri":"memory://recent"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"resources/unsubscribe","params":{"uri":"memory://recent"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/list"}`,
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+	forwarded, err := io.ReadAll(subs.intercept(strings.NewReader(in), &out))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	if got := string(forwarded); !strings.Contains(got, `"initialize"`) || !strings.Contains(got, `"tools/list"`) || strings.Contains(got, "resources/") {
+		t.Errorf("forwarded:\n%s", got)
+	}
+	responses := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(responses) != 4 {
+		t.Fatalf("expected 4 responses, got:\n%s", out.String())
+	}
+	if !strings.Contains(responses[0], `"id":2,"result":{}`) {
+		t.Errorf("subscribe response = %s", responses[0])
+	}
+	if !strings.Contains(responses[1], `"id":3`) || !strings.Contains(responses[1], `"code":-32602`) {
+		t.Errorf("invalid uri response = %s", responses[1])
+	}
+	if len(subs.subscribers("memory://entity/pi")) != 1 || len(subs.subscribers(recentURI)) != 0 {
+		t.Errorf("subscriptions = %v", subs.sessions)
+	}
+}
+
+func TestWatchChanges_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'watch-test-%'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'watch test %'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('watch-test-pi', 'device'), ('watch-test-nas', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	subs := newSubscriptions()
+	subs.handle("a", []byte(`{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"memory://entity/watch-test-pi"}}`))
+	subs.handle("a", []byte(`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"memory://recent"}}`))
+	subs.handle("b", []byte(`{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"memory://entity/watch-test-nas"}}`))
+	subs.drop("b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notified := make(chan string, 10)
+	go subs.watchChanges(ctx, db, 50*time.Millisecond, func(sessionID, uri string) {
+		if sessionID == "a" {
+			notified <- uri
+		} else {
+			t.Errorf("notified session %s of %s", sessionID, uri)
+		}
+	})
+
+	// Let the watcher record its starting point before writing.
+	time.Sleep(200 * time.Millisecond)
+	for _, name := range []string{"watch-test-pi", "watch-test-nas"} {
+		result, err := callTool(addObservationHandler(db, nil), "add_observation", map[string]any{
+			"entity": name, "content": "watch test " + name, "tags": "homelab",
+		})
+		if err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result)
+		}
+	}
+
+	// The two writes can fall in different polls, so memory://recent may
+	// be notified more than once; only the URIs matter.
+	want := map[string]bool{recentURI: true, "memory://entity/watch-test-pi": true}
+	got := make(map[string]bool)
+	timeout := time.After(2 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case uri := <-notified:
+			if !want[uri] {
+				t.Errorf("unexpected notification %s", uri)
+			}
+			got[uri] = true
+		case <-timeout:
+			t.Fatalf("notifications = %v", got)
+		}
+	}
+	quiet := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case uri := <-notified:
+			if !want[uri] {
+				t.Errorf("unexpected notification %s", uri)
+			}
+		case <-quiet:
+			return
+		}
+	}
+}
+
+func TestWatchDue_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'watch-due-test'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'watch due test %'")
+
+	var obs int64
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('watch-due-test', 'Chore')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := db.QueryRow(`INSERT INTO observations (entity_id, content) SELECT id, 'watch due test feed the cat' FROM entities WHERE name = 'watch-due-test' RETURNING id`).Scan(&obs); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	subs := newSubscriptions()
+	subs.handle(stdioSessionID, []byte(`{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"memory://due"}}`))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notified := make(chan string, 10)
+	go subs.watchDue(ctx, db, 50*time.Millisecond, func(sessionID, uri string) { notified <- uri })
+
+	// Reminders other tests left due are reported once, on the first poll.
+	time.Sleep(200 * time.Millisecond)
+	for len(notified) > 0 {
+		<-notified
+	}
+	expect := func(what string) {
+		t.Helper()
+		select {
+		case uri := <-notified:
+			if uri != dueURI {
+				t.Errorf("%s: notified %s", what, uri)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: no notification", what)
+		}
+	}
+
+	var id int64
+	if err := db.QueryRow("INSERT INTO reminders (observation_id, due_at) VALUES (?, ?) RETURNING id", obs,
+		time.Now().Add(-time.Minute).UTC().Format(reminderTimeForm)).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	expect("reminder added due")
+	if _, err := db.Exec("UPDATE reminders SET completed_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+		t.Fatal(err)
+	}
+	expect("reminder completed")
+	select {
+	case uri := <-notified:
+		t.Errorf("unexpected notification %s", uri)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestEntityResource_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'watch-test-resource'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('watch-test-resource', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	handler := entityResourceHandler(db, nil)
+	req := mcp.ReadResourceRequest{}
+	req.Params.URI = "memory://entity/watch-test-resource"
+	req.Params.Arguments = map[string]any{"name": []string{"watch-test-resource"}}
+	contents, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if text := contents[0].(mcp.TextResourceContents).Text; !strings.Contains(text, `"entityType": "device"`) {
+		t.Errorf("unexpected contents %s", text)
+	}
+
+	req.Params.Arguments = map[string]any{"name": []string{"watch-test-missing"}}
+	if _, err := handler(context.Background(), req); err == nil {
+		t.Error("expected an error for a missing entity")
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// conversationSummary is the store_summary payload. Entities, facts and
+// relations refer to entities by name; names not yet in the database must be
+// listed under entities so they can be created with a type.
+type conversationSummary struct {
+	Entities []struct {
+		Name       string `json:"name"`
+		EntityType string `json:"entity_type"`
+		Tags       string `json:"tags"`
+	} `json:"entities"`
+	Facts []struct {
+		Entity     string         `json:"entity"`
+		Content    string         `json:"content"`
+		Tags       string         `json:"tags"`
+		Confidence *float64       `json:"confidence"`
+		Metadata   map[string]any `json:"metadata"`
+	} `json:"facts"`
+	Relations []struct {
+		From         string   `json:"from"`
+		To           string   `json:"to"`
+		RelationType string   `json:"relation_type"`
+		Confidence   *float64 `json:"confidence"`
+	} `json:"relations"`
+	Tags           string `json:"tags"`
+	Visibility     string `json:"visibility"`
+	ConversationID string `json:"conversation_id"`
+	OnConflict     string `json:"on_conflict"`
+}
+
+// validate checks the payload before anything is written, so that a bad fact
+// late in a long summary is reported without a round trip to the database.
+func (s *conversationSummary) validate() error {
+	if len(s.Entities) == 0 && len(s.Facts) == 0 && len(s.Relations) == 0 {
+		return fmt.Errorf("summary is empty: pass entities, facts and/or relations")
+	}
+	for i, e := range s.Entities {
+		if strings.TrimSpace(e.Name) == "" || strings.TrimSpace(e.EntityType) == "" {
+			return fmt.Errorf("entities[%d]: name and entity_type are required", i)
+		}
+	}
+	for i, f := range s.Facts {
+		if strings.TrimSpace(f.Entity) == "" || strings.TrimSpace(f.Content) == "" {
+			return fmt.Errorf("facts[%d]: entity and content are required", i)
+		}
+		if strings.TrimSpace(f.Tags) == "" && strings.TrimSpace(s.Tags) == "" && requiredTags.requires("observations") {
+			return fmt.Errorf("facts[%d]: tags are required, per fact or as the top-level tags default. Query 'SELECT name, description FROM tags' to see all available tags.", i)
+		}
+		if f.Confidence != nil && (*f.Confidence < 0 || *f.Confidence > 1) {
+			return fmt.Errorf("facts[%d]: confidence must be a number between 0 and 1", i)
+		}
+	}
+	for i, r := range s.Relations {
+		if strings.TrimSpace(r.From) == "" || strings.TrimSpace(r.To) == "" || strings.TrimSpace(r.RelationType) == "" {
+			return fmt.Errorf("relations[%d]: from, to and relation_type are required", i)
+		}
+		if r.Confidence != nil && (*r.Confidence < 0 || *r.Confidence > 1) {
+			return fmt.Errorf("relations[%d]: confidence must be a number between 0 and 1", i)
+		}
+	}
+	if s.Visibility == "" {
+		s.Visibility = "private"
+	}
+	if _, err := parseVisibilityLevels(s.Visibility); err != nil {
+		return err
+	}
+	mode, err := parseOnConflict(s.OnConflict)
+	s.OnConflict = mode
+	return err
+}
+
+// registerStoreSummary adds the store_summary tool.
+func registerStoreSummary(s *server.MCPServer, db *sql.DB, guided *guideTools) {
+	guided.add(s, func() server.ServerTool {
+		return server.ServerTool{Tool: mcp.NewTool("store_summary",
+			mcp.WithDescription(`Store an end-of-conversation summary in one call: new entities, facts about them and relations between them.
+
+Everything is written in a single transaction; if any part is invalid nothing is stored. Entities that already exist are reused, so list every entity you mention with its type. Facts become observations with source 'summary'.`),
+			mcp.WithArray("entities",
+				mcp.Description("Entities to create if missing"),
+				mcp.Items(map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":        map[string]any{"type": "string"},
+						"entity_type": map[string]any{"type": "string", "description": liveGuide.entityTypeHelp()},
+						"tags":        map[string]any{"type": "string", "description": "Comma-separated tag names for a new entity, if the tag policy requires them"},
+					},
+					"required": []string{"name", "entity_type"},
+				}),
+			),
+			mcp.WithArray("facts",
+				mcp.Description("Observations to add"),
+				mcp.Items(map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"entity":     map[string]any{"type": "string", "description": "Entity name"},
+						"content":    map[string]any{"type": "string"},
+						"tags":       map[string]any{"type": "string", "description": "Comma-separated tag names; defaults to the top-level tags"},
+						"confidence": map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+						"metadata":   map[string]any{"type": "object", "description": "Typed fields, e.g. {\"host\": \"nas\", \"port\": 8080}"},
+					},
+					"required": []string{"entity", "content"},
+				}),
+			),
+			mcp.WithArray("relations",
+				mcp.Description("Relations to add between entities"),
+				mcp.Items(map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"from":          map[string]any{"type": "string", "description": "Entity name"},
+						"to":            map[string]any{"type": "string", "description": "Entity name"},
+						"relation_type": map[string]any{"type": "string", "description": "e.g. owns, works_at"},
+						"confidence":    map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+					},
+					"required": []string{"from", "to", "relation_type"},
+				}),
+			),
+			mcp.WithString("tags",
+				mcp.Description("Default comma-separated tag names for facts that do not set their own"),
+			),
+			mcp.WithString("visibility",
+				mcp.Description("Visibility of the stored facts: private (default), shared or public"),
+			),
+			mcp.WithString("conversation_id",
+				mcp.Description("Identifier of the conversation being summarized"),
+			),
+			mcp.WithString("on_conflict",
+				mcp.Description("When a listed entity already exists: 'ignore' keeps it as is (default), 'update' sets its entity_type, 'error' stores nothing"),
+				mcp.Enum(onConflictModes...),
+			),
+		), Handler: storeSummaryHandler(db)}
+	})
+}
+
+func storeSummaryHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var summary conversationSummary
+		if err := request.BindArguments(&summary); err != nil {
+			return toolErrorf(codeInvalidArgument, "invalid summary: %v", err), nil
+		}
+		if err := summary.validate(); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		// Resolve tags up front; validateTags lists the available ones on a miss.
+		tagIDs := make(map[string][]int64)
+		for _, f := range summary.Facts {
+			tags := f.Tags
+			if strings.TrimSpace(tags) == "" {
+				tags = summary.Tags
+			}
+			if _, ok := tagIDs[tags]; ok {
+				continue
+			}
+			ids, err := validateTagsFor(ctx, db, "observations", parseTagNames(tags))
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			tagIDs[tags] = ids
+		}
+		incoming := make(map[int64]int)
+		for _, f := range summary.Facts {
+			tags := f.Tags
+			if strings.TrimSpace(tags) == "" {
+				tags = summary.Tags
+			}
+			for _, id := range tagIDs[tags] {
+				incoming[id] += len(f.Content)
+			}
+		}
+		for id, size := range incoming {
+			if err := checkTagQuotas(ctx, db, []int64{id}, size); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+		}
+		entityTagIDs := make([][]int64, len(summary.Entities))
+		for i, e := range summary.Entities {
+			if strings.TrimSpace(e.Tags) == "" {
+				continue
+			}
+			ids, err := validateTagsFor(ctx, db, "entities", parseTagNames(e.Tags))
+			if err != nil {
+				return toolErrorf(errorCode(err, codeInvalidArgument), "entities[%d]: %v", i, err), nil
+			}
+			entityTagIDs[i] = ids
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		created := 0
+		entityIDs := make(map[string]int64)
+		for i, e := range summary.Entities {
+			name := strings.TrimSpace(e.Name)
+			id, ok, err := upsertEntity(ctx, tx, name, strings.TrimSpace(e.EntityType), summary.OnConflict)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "entity '%s': %v. Nothing was stored", e.Name, err), nil
+			}
+			if ok {
+				if entityTagIDs[i] == nil && requiredTags.requires("entities") {
+					return toolErrorf(codeTagRequired, "entities[%d]: tags are required for new entities. Nothing was stored", i), nil
+				}
+				if err := linkEntityTags(ctx, tx, id, entityTagIDs[i]); err != nil {
+					return toolErrorf(errorCode(err, codeDatabase), "entities[%d]: failed to link tags: %v. Nothing was stored", i, err), nil
+				}
+				created++
+			}
+			entityIDs[name] = id
+		}
+
+		entityID := func(name string) (int64, error) {
+			name = strings.TrimSpace(name)
+			if id, ok := entityIDs[name]; ok {
+				return id, nil
+			}
+			var id int64
+			err := tx.QueryRowContext(ctx, "SELECT id"+entityByName, name, name, name).Scan(&id)
+			if err == sql.ErrNoRows {
+				return 0, errorf(codeNotFound, "entity '%s' does not exist; list it under entities with an entity_type to create it", name)
+			} else if err != nil {
+				return 0, errorf(codeDatabase, "error looking up entity '%s': %v", name, err)
+			}
+			entityIDs[name] = id
+			return id, nil
+		}
+
+		for i, f := range summary.Facts {
+			id, err := entityID(f.Entity)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeInvalidArgument), "facts[%d]: %v. Nothing was stored", i, err), nil
+			}
+			metadata, err := parseMetadata(f.Metadata)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeInvalidArgument), "facts[%d]: %v. Nothing was stored", i, err), nil
+			}
+			result, err := tx.ExecContext(ctx, `INSERT INTO observations (entity_id, content, visibility, confidence, source, conversation_id, metadata)
+				VALUES (?, ?, ?, ?, 'summary', ?, ?)`,
+				id, normalizeText(f.Content), strings.ToLower(summary.Visibility), f.Confidence, nullIfEmpty(summary.ConversationID), metadata)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "facts[%d]: %s. Nothing was stored", i, formatExecError(err)), nil
+			}
+			observationID, _ := result.LastInsertId()
+
+			tags := f.Tags
+			if strings.TrimSpace(tags) == "" {
+				tags = summary.Tags
+			}
+			if err := linkTags(ctx, tx, observationID, tagIDs[tags]); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "facts[%d]: failed to link tags: %v. Nothing was stored", i, err), nil
+			}
+		}
+
+		for i, r := range summary.Relations {
+			from, err := entityID(r.From)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeInvalidArgument), "relations[%d]: %v. Nothing was stored", i, err), nil
+			}
+			to, err := entityID(r.To)
+			if err != nil {
+				return toolErrorf(errorCode(err, codeInvalidArgument), "relations[%d]: %v. Nothing was stored", i, err), nil
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO relations (from_id, to_id, relation_type, confidence) VALUES (?, ?, ?, ?)",
+				from, to, strings.TrimSpace(r.RelationType), r.Confidence); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "relations[%d]: %s. Nothing was stored", i, formatExecError(err)), nil
+			}
+			if _, err := insertInverse(ctx, tx, from, to, strings.TrimSpace(r.RelationType), nil, nil); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "relations[%d]: inverse: %s. Nothing was stored", i, formatExecError(err)), nil
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit summary: %v. Nothing was stored", err), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("success: summary stored, %d entities created (%d already existed), %d facts, %d relations",
+			created, len(summary.Entities)-created, len(summary.Facts), len(summary.Relations))), nil
+	}
+}
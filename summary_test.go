@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStoreSummary_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'summary-test-%'")
+	defer db.Exec("DELETE FROM relations WHERE relation_type = 'summary_test_rel'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'summary test %'")
+
+	var existing string
+	if err := db.QueryRow("SELECT name FROM entities WHERE id = 1").Scan(&existing); err != nil {
+		t.Fatalf("lookup entity: %v", err)
+	}
+
+	t.Run("stores everything", func(t *testing.T) {
+		result, err := callTool(storeSummaryHandler(db), "store_summary", map[string]any{
+			"entities": []any{
+				map[string]any{"name": "summary-test-router", "entity_type": "Device"},
+				map[string]any{"name": existing, "entity_type": "Person"},
+			},
+			"facts": []any{
+				map[string]any{"entity": "summary-test-router", "content": "summary test runs openwrt"},
+				map[string]any{"entity": existing, "content": "summary test bought a router", "tags": "personal", "confidence": 0.8},
+			},
+			"relations": []any{
+				map[string]any{"from": existing, "to": "summary-test-router", "relation_type": "summary_test_rel"},
+			},
+			"tags":            "homelab",
+			"conversation_id": "summary-conv",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("store_summary failed: %v", result.Content)
+		}
+
+		var n int
+		db.QueryRow(`SELECT count(*) FROM observations o
+			JOIN observation_tags ot ON ot.observation_id = o.id
+			JOIN tags t ON t.id = ot.tag_id
+			WHERE o.content LIKE 'summary test %' AND o.source = 'summary' AND o.conversation_id = 'summary-conv'
+			AND ((o.content LIKE '%openwrt' AND t.name = 'homelab') OR (o.content LIKE '%router' AND t.name = 'personal'))`).Scan(&n)
+		if n != 2 {
+			t.Errorf("expected 2 tagged summary observations, got %d", n)
+		}
+		db.QueryRow("SELECT count(*) FROM relations WHERE relation_type = 'summary_test_rel'").Scan(&n)
+		if n != 1 {
+			t.Errorf("expected 1 relation, got %d", n)
+		}
+	})
+
+	t.Run("unknown entity stores nothing", func(t *testing.T) {
+		result, err := callTool(storeSummaryHandler(db), "store_summary", map[string]any{
+			"entities": []any{map[string]any{"name": "summary-test-partial", "entity_type": "Thing"}},
+			"facts": []any{
+				map[string]any{"entity": "summary-test-partial", "content": "summary test partial"},
+				map[string]any{"entity": "summary-test-missing", "content": "summary test missing"},
+			},
+			"tags": "homelab",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error for unlisted entity")
+		}
+
+		var n int
+		db.QueryRow("SELECT count(*) FROM entities WHERE name = 'summary-test-partial'").Scan(&n)
+		if n != 0 {
+			t.Errorf("expected rollback of entity, found %d", n)
+		}
+	})
+
+	t.Run("unknown tag rejected", func(t *testing.T) {
+		result, err := callTool(storeSummaryHandler(db), "store_summary", map[string]any{
+			"facts": []any{map[string]any{"entity": existing, "content": "summary test bad tag", "tags": "nonexistent-tag"}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error for unknown tag")
+		}
+	})
+}
+
+func TestConversationSummaryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]any
+		wantErr bool
+	}{
+		{"empty", map[string]any{}, true},
+		{"entity without type", map[string]any{"entities": []any{map[string]any{"name": "x"}}}, true},
+		{"fact without tags", map[string]any{"facts": []any{map[string]any{"entity": "x", "content": "y"}}}, true},
+		{"fact with default tags", map[string]any{"facts": []any{map[string]any{"entity": "x", "content": "y"}}, "tags": "homelab"}, false},
+		{"confidence out of range", map[string]any{"facts": []any{map[string]any{"entity": "x", "content": "y", "confidence": 2.0}}, "tags": "homelab"}, true},
+		{"relation without type", map[string]any{"relations": []any{map[string]any{"from": "x", "to": "y"}}}, true},
+		{"bad visibility", map[string]any{"entities": []any{map[string]any{"name": "x", "entity_type": "T"}}, "visibility": "secret"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s conversationSummary
+			if err := mcpToolRequest(tt.args).BindArguments(&s); err != nil {
+				t.Fatalf("bind: %v", err)
+			}
+			if err := s.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
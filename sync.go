@@ -0,0 +1,715 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// syncPeer is the libSQL URL of another engram instance to reconcile with.
+// With syncMinutes set, serve syncs with it in the background using
+// last-writer-wins; the sync command runs it on demand.
+var (
+	syncPeer    = getEnv("ENGRAM_SYNC_PEER", "")
+	syncMinutes = getEnvInt("ENGRAM_SYNC_MINUTES", 0)
+)
+
+var conflictModes = []string{"lww", "prompt"}
+
+// syncColumn is a column copied between instances. Id columns referencing
+// another table (ref) travel as that row's natural key instead, since ids
+// differ between instances.
+type syncColumn struct {
+	name string
+	ref  string
+}
+
+// syncTable lists the columns identifying a row (key) and the ones copied
+// along with it (values).
+type syncTable struct {
+	name   string
+	key    []syncColumn
+	values []syncColumn
+}
+
+func (t syncTable) columns() []string {
+	var cols []string
+	for _, c := range append(append([]syncColumn{}, t.key...), t.values...) {
+		cols = append(cols, c.name)
+	}
+	return cols
+}
+
+// syncTables are the synced tables, parents first.
+var syncTables = []syncTable{
+	{"tags", []syncColumn{{"name", ""}}, []syncColumn{{"description", ""}, {"created_at", ""}}},
+	{"entities", []syncColumn{{"name", ""}}, []syncColumn{{"entity_type", ""}, {"created_at", ""}, {"archived_at", ""}, {"pinned_at", ""}, {"latitude", ""}, {"longitude", ""}}},
+	{"entity_tags", []syncColumn{{"entity_id", "entities"}, {"tag_id", "tags"}}, nil},
+	{"entity_aliases", []syncColumn{{"alias", ""}}, []syncColumn{{"entity_id", "entities"}, {"created_at", ""}}},
+	{"contents", []syncColumn{{"sha256", ""}}, []syncColumn{{"body", ""}, {"size", ""}, {"created_at", ""}}},
+	{"observations",
+		[]syncColumn{{"entity_id", "entities"}, {"content", ""}},
+		[]syncColumn{{"content_sha256", ""}, {"visibility", ""}, {"source", ""}, {"conversation_id", ""}, {"source_url", ""}, {"confidence", ""}, {"metadata", ""}, {"verified_at", ""}, {"verified_by", ""}, {"parent_id", "observations"}, {"created_at", ""}}},
+	{"observation_tags", []syncColumn{{"observation_id", "observations"}, {"tag_id", "tags"}}, nil},
+	{"relations",
+		[]syncColumn{{"from_id", "entities"}, {"to_id", "entities"}, {"relation_type", ""}},
+		[]syncColumn{{"confidence", ""}, {"weight", ""}, {"properties", ""}, {"created_at", ""}}},
+	{"unknowns",
+		[]syncColumn{{"entity_id", "entities"}, {"question", ""}},
+		[]syncColumn{{"created_at", ""}, {"resolved_at", ""}, {"observation_id", "observations"}}},
+	{"entity_attributes",
+		[]syncColumn{{"entity_id", "entities"}, {"name", ""}},
+		[]syncColumn{{"value", ""}, {"value_type", ""}, {"source", ""}, {"created_at", ""}, {"updated_at", ""}}},
+}
+
+func syncTableNamed(name string) (syncTable, bool) {
+	for _, t := range syncTables {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return syncTable{}, false
+}
+
+// syncChange is a change in a form both instances understand. oldKey is set
+// on updates that changed the row's key.
+type syncChange struct {
+	op        string
+	table     string
+	key       []any
+	oldKey    []any
+	values    []any
+	changedAt string
+}
+
+func rowID(table string, key []any) string {
+	data, _ := json.Marshal(key)
+	return table + " " + string(data)
+}
+
+func (c syncChange) ids() []string {
+	ids := []string{rowID(c.table, c.key)}
+	if c.oldKey != nil {
+		ids = append(ids, rowID(c.table, c.oldKey))
+	}
+	return ids
+}
+
+func (c syncChange) String() string {
+	if c.op == "delete" {
+		return fmt.Sprintf("deleted at %s", c.changedAt)
+	}
+	data, _ := json.Marshal(c.values)
+	return fmt.Sprintf("%s at %s: %s", c.op, c.changedAt, data)
+}
+
+// sameState reports whether two changes leave the row the same, as when one
+// is the other copied over by an earlier sync.
+func sameState(a, b syncChange) bool {
+	if a.op == "delete" || b.op == "delete" {
+		return a.op == b.op
+	}
+	ka, _ := json.Marshal(a.key)
+	kb, _ := json.Marshal(b.key)
+	va, _ := json.Marshal(a.values)
+	vb, _ := json.Marshal(b.values)
+	return string(ka) == string(kb) && string(va) == string(vb)
+}
+
+// syncSource reads one instance's changes in portable form.
+type syncSource struct {
+	db   *sql.DB
+	refs map[string]any
+}
+
+func newSyncSource(db *sql.DB) *syncSource {
+	return &syncSource{db: db, refs: make(map[string]any)}
+}
+
+// preload caches the natural keys of every entity, tag and observation, so a
+// full snapshot does not look them up one row at a time.
+func (s *syncSource) preload(ctx context.Context) error {
+	for _, q := range []struct{ table, sql string }{
+		{"entities", "SELECT id, name FROM entities"},
+		{"tags", "SELECT id, name FROM tags"},
+	} {
+		rows, err := s.db.QueryContext(ctx, q.sql)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return err
+			}
+			s.refs[fmt.Sprintf("%s/%d", q.table, id)] = name
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT o.id, e.name, o.content FROM observations o JOIN entities e ON e.id = o.entity_id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var entity, content string
+		if err := rows.Scan(&id, &entity, &content); err != nil {
+			return err
+		}
+		s.refs[fmt.Sprintf("observations/%d", id)] = []any{entity, content}
+	}
+	return rows.Err()
+}
+
+// rowPayload returns a row as the change log records it as of change asOf,
+// or else as the table holds it now, or else as the log last recorded it.
+func (s *syncSource) rowPayload(ctx context.Context, table string, id, asOf int64) (map[string]any, error) {
+	var payload string
+	err := sql.ErrNoRows
+	if asOf > 0 {
+		err = s.db.QueryRowContext(ctx, "SELECT payload FROM changes WHERE table_name = ? AND row_id = ? AND id <= ? ORDER BY id DESC LIMIT 1",
+			table, id, asOf).Scan(&payload)
+	}
+	if err == sql.ErrNoRows {
+		t, _ := syncTableNamed(table)
+		err = s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", jsonObject("", t.columns()), table), id).Scan(&payload)
+	}
+	if err == sql.ErrNoRows {
+		err = s.db.QueryRowContext(ctx, "SELECT payload FROM changes WHERE table_name = ? AND row_id = ? ORDER BY id DESC LIMIT 1",
+			table, id).Scan(&payload)
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var p map[string]any
+	return p, json.Unmarshal([]byte(payload), &p)
+}
+
+// ref returns the natural key of the row with the given id: a name for
+// entities and tags, entity name and content for observations. It is nil when
+// the row cannot be found.
+func (s *syncSource) ref(ctx context.Context, table string, id, asOf int64) (any, error) {
+	cacheKey := fmt.Sprintf("%s/%d", table, id)
+	if asOf == 0 {
+		if v, ok := s.refs[cacheKey]; ok {
+			return v, nil
+		}
+	}
+	p, err := s.rowPayload(ctx, table, id, asOf)
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	var v any
+	if table == "observations" {
+		entity, err := s.ref(ctx, "entities", payloadID(p["entity_id"]), asOf)
+		if err != nil || entity == nil {
+			return nil, err
+		}
+		v = []any{entity, p["content"]}
+	} else {
+		v = p["name"]
+	}
+	if asOf == 0 {
+		s.refs[cacheKey] = v
+	}
+	return v, nil
+}
+
+func payloadID(v any) int64 {
+	f, _ := v.(float64)
+	return int64(f)
+}
+
+// portable converts payload columns to portable values, replacing ids with
+// natural keys as of change asOf.
+func (s *syncSource) portable(ctx context.Context, cols []syncColumn, p map[string]any, asOf int64) ([]any, error) {
+	out := make([]any, len(cols))
+	for i, c := range cols {
+		v := p[c.name]
+		if c.ref != "" && v != nil {
+			var err error
+			if v, err = s.ref(ctx, c.ref, payloadID(v), asOf); err != nil {
+				return nil, err
+			}
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (s *syncSource) change(ctx context.Context, t syncTable, op string, p map[string]any, changedAt string, asOf int64) (syncChange, error) {
+	c := syncChange{op: op, table: t.name, changedAt: changedAt}
+	var err error
+	if c.key, err = s.portable(ctx, t.key, p, asOf); err != nil {
+		return c, err
+	}
+	if op != "delete" {
+		c.values, err = s.portable(ctx, t.values, p, asOf)
+	}
+	return c, err
+}
+
+// snapshot returns every synced row as an insert, for a first sync.
+func (s *syncSource) snapshot(ctx context.Context) ([]syncChange, error) {
+	if err := s.preload(ctx); err != nil {
+		return nil, err
+	}
+	var changes []syncChange
+	for _, t := range syncTables {
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY rowid", jsonObject("", t.columns()), t.name))
+		if err != nil {
+			return nil, err
+		}
+		var payloads []map[string]any
+		for rows.Next() {
+			var payload string
+			var p map[string]any
+			if err := rows.Scan(&payload); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if err := json.Unmarshal([]byte(payload), &p); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			payloads = append(payloads, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, p := range payloads {
+			changedAt, _ := p["created_at"].(string)
+			c, err := s.change(ctx, t, "insert", p, changedAt, 0)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// changes returns the logged changes with ids in (from, to].
+func (s *syncSource) changes(ctx context.Context, from, to int64) ([]syncChange, error) {
+	var logged []change
+	for from < to {
+		page, err := loadChanges(ctx, s.db, visibilityLevels, from, maxChangesLimit, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Changes) == 0 {
+			break
+		}
+		for _, c := range page.Changes {
+			if c.ID <= to {
+				logged = append(logged, c)
+			}
+		}
+		from = page.NextSince
+	}
+
+	var changes []syncChange
+	for _, l := range logged {
+		t, ok := syncTableNamed(l.Table)
+		if !ok {
+			continue
+		}
+		var p map[string]any
+		if err := json.Unmarshal(l.Payload, &p); err != nil {
+			return nil, fmt.Errorf("change %d: %v", l.ID, err)
+		}
+		c, err := s.change(ctx, t, l.Op, p, l.ChangedAt, l.ID)
+		if err != nil {
+			return nil, fmt.Errorf("change %d: %v", l.ID, err)
+		}
+		if l.Op == "update" {
+			var previous string
+			err := s.db.QueryRowContext(ctx, "SELECT payload FROM changes WHERE table_name = ? AND row_id = ? AND id < ? ORDER BY id DESC LIMIT 1",
+				l.Table, l.RowID, l.ID).Scan(&previous)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, fmt.Errorf("change %d: %v", l.ID, err)
+			}
+			if err == nil {
+				var old map[string]any
+				if err := json.Unmarshal([]byte(previous), &old); err != nil {
+					return nil, fmt.Errorf("change %d: %v", l.ID, err)
+				}
+				oldKey, err := s.portable(ctx, t.key, old, l.ID-1)
+				if err != nil {
+					return nil, fmt.Errorf("change %d: %v", l.ID, err)
+				}
+				if rowID(t.name, oldKey) != rowID(t.name, c.key) {
+					c.oldKey = oldKey
+				}
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// syncTarget applies portable changes inside a transaction.
+type syncTarget struct {
+	tx *sql.Tx
+}
+
+// id looks up the id of the row with the given natural key.
+func (t *syncTarget) id(ctx context.Context, table string, ref any) (int64, bool, error) {
+	var id int64
+	var err error
+	switch table {
+	case "observations":
+		key, ok := ref.([]any)
+		if !ok || len(key) != 2 {
+			return 0, false, nil
+		}
+		err = t.tx.QueryRowContext(ctx, `SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id
+			WHERE e.name = ? AND o.content = ? ORDER BY o.id LIMIT 1`, key[0], key[1]).Scan(&id)
+	default:
+		err = t.tx.QueryRowContext(ctx, fmt.Sprintf("SELECT id FROM %s WHERE name = ?", table), ref).Scan(&id)
+	}
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return id, err == nil, err
+}
+
+// resolve maps portable values to this instance's ids. It reports false when
+// a referenced row does not exist here.
+func (t *syncTarget) resolve(ctx context.Context, cols []syncColumn, values []any) ([]any, bool, error) {
+	out := make([]any, len(values))
+	for i, c := range cols {
+		out[i] = values[i]
+		if c.ref == "" || values[i] == nil {
+			continue
+		}
+		id, ok, err := t.id(ctx, c.ref, values[i])
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		out[i] = id
+	}
+	return out, true, nil
+}
+
+func (t *syncTarget) find(ctx context.Context, table syncTable, key []any) (int64, bool, error) {
+	if key == nil {
+		return 0, false, nil
+	}
+	ids, ok, err := t.resolve(ctx, table.key, key)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	conds := make([]string, len(table.key))
+	for i, c := range table.key {
+		conds[i] = c.name + " IS ?"
+	}
+	var rowid int64
+	err = t.tx.QueryRowContext(ctx, fmt.Sprintf("SELECT rowid FROM %s WHERE %s ORDER BY rowid LIMIT 1", table.name, strings.Join(conds, " AND ")),
+		ids...).Scan(&rowid)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return rowid, err == nil, err
+}
+
+// apply makes the row match the change. Rows already in that state are left
+// alone, so applying a change copied back from the other side logs nothing
+// new. It reports false when the change refers to a row missing here.
+func (t *syncTarget) apply(ctx context.Context, c syncChange) (bool, error) {
+	table, _ := syncTableNamed(c.table)
+	rowid, found, err := t.find(ctx, table, c.oldKey)
+	if err == nil && !found {
+		rowid, found, err = t.find(ctx, table, c.key)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if c.op == "delete" {
+		if found {
+			_, err = t.tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE rowid = ?", table.name), rowid)
+		}
+		return true, err
+	}
+
+	key, ok, err := t.resolve(ctx, table.key, c.key)
+	if err != nil || !ok {
+		return false, err
+	}
+	values, _, err := t.resolve(ctx, table.values, c.values)
+	if err != nil {
+		return false, err
+	}
+	cols := table.columns()
+	args := append(key, values...)
+
+	if !found {
+		_, err = t.tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.name, strings.Join(cols, ", "), placeholders(len(cols))), args...)
+		return true, err
+	}
+
+	sets := make([]string, len(cols))
+	same := make([]string, len(cols))
+	for i, col := range cols {
+		sets[i] = col + " = ?"
+		same[i] = col + " IS ?"
+	}
+	updateArgs := append(append(append([]any{}, args...), rowid), args...)
+	_, err = t.tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE rowid = ? AND NOT (%s)", table.name, strings.Join(sets, ", "), strings.Join(same, " AND ")),
+		updateArgs...)
+	return true, err
+}
+
+type syncConflict struct {
+	local, peer syncChange
+}
+
+// conflictResolver decides a row changed on both sides since the last sync,
+// returning true to keep the local version.
+type conflictResolver func(c syncConflict) (bool, error)
+
+// lastWriterWins keeps the most recent change; the peer wins ties so both
+// sides pick the same version.
+func lastWriterWins(c syncConflict) (bool, error) {
+	return c.local.changedAt > c.peer.changedAt, nil
+}
+
+// promptResolver asks which version to keep.
+func promptResolver(in io.Reader, out io.Writer) conflictResolver {
+	reader := bufio.NewReader(in)
+	return func(c syncConflict) (bool, error) {
+		data, _ := json.Marshal(c.local.key)
+		fmt.Fprintf(out, "conflict in %s %s\n  local: %s\n  peer:  %s\n", c.local.table, data, c.local, c.peer)
+		for {
+			fmt.Fprint(out, "keep [l]ocal or [p]eer? ")
+			line, err := reader.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "l", "local":
+				return true, nil
+			case "p", "peer":
+				return false, nil
+			}
+			if err != nil {
+				return false, fmt.Errorf("no answer for conflict in %s %s", c.local.table, data)
+			}
+		}
+	}
+}
+
+// resolveConflicts finds rows whose last local and last peer changes leave
+// them different, and returns which side keeps each, keyed by row.
+func resolveConflicts(local, peer []syncChange, resolve conflictResolver) (map[string]bool, int, error) {
+	lastLocal := make(map[string]syncChange)
+	for _, c := range local {
+		for _, id := range c.ids() {
+			lastLocal[id] = c
+		}
+	}
+	lastPeer := make(map[string]syncChange)
+	var order []string
+	for _, c := range peer {
+		for _, id := range c.ids() {
+			if _, ok := lastPeer[id]; !ok {
+				order = append(order, id)
+			}
+			lastPeer[id] = c
+		}
+	}
+
+	keepLocal := make(map[string]bool)
+	conflicts := 0
+	for _, id := range order {
+		l, ok := lastLocal[id]
+		if !ok || sameState(l, lastPeer[id]) {
+			continue
+		}
+		keep, err := resolve(syncConflict{local: l, peer: lastPeer[id]})
+		if err != nil {
+			return nil, conflicts, err
+		}
+		conflicts++
+		for _, other := range append(l.ids(), lastPeer[id].ids()...) {
+			keepLocal[other] = keep
+		}
+	}
+	return keepLocal, conflicts, nil
+}
+
+type syncReport struct {
+	pulled, pushed, skipped, conflicts int
+}
+
+func (r syncReport) String() string {
+	return fmt.Sprintf("pulled %d changes, pushed %d, %d conflicts resolved, %d skipped (referenced rows missing)",
+		r.pulled, r.pushed, r.conflicts, r.skipped)
+}
+
+func maxChangeID(ctx context.Context, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM changes").Scan(&id)
+	return id, err
+}
+
+// applyChanges applies changes to db in one transaction, skipping rows whose
+// conflict went the other way (keepLocal[id] == skipIf). It returns the number
+// applied and skipped, and the change log ids before and after, which bound
+// the copies it logged.
+func applyChanges(ctx context.Context, db *sql.DB, changes []syncChange, keepLocal map[string]bool, skipIf bool) (applied, skipped int, before, after int64, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	defer tx.Rollback()
+
+	if before, err = maxChangeID(ctx, tx); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	target := &syncTarget{tx: tx}
+	for _, c := range changes {
+		lost := false
+		for _, id := range c.ids() {
+			if keep, ok := keepLocal[id]; ok && keep == skipIf {
+				lost = true
+			}
+		}
+		if lost {
+			continue
+		}
+		ok, err := target.apply(ctx, c)
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("%s %s: %v", c.op, rowID(c.table, c.key), err)
+		}
+		if ok {
+			applied++
+		} else {
+			skipped++
+		}
+	}
+	if after, err = maxChangeID(ctx, tx); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return applied, skipped, before, after, tx.Commit()
+}
+
+// syncWithPeer reconciles local and peer: peer changes since the last sync are
+// applied locally and local ones on the peer, with resolve deciding rows
+// changed on both sides. The first sync with a peer merges every row. Progress
+// is recorded in the local sync_state table under peerName.
+func syncWithPeer(ctx context.Context, local, peer *sql.DB, peerName string, resolve conflictResolver) (syncReport, error) {
+	var report syncReport
+	var pulled, pushed int64
+	err := local.QueryRowContext(ctx, "SELECT pulled, pushed FROM sync_state WHERE peer = ?", peerName).Scan(&pulled, &pushed)
+	first := err == sql.ErrNoRows
+	if err != nil && !first {
+		return report, fmt.Errorf("read sync state: %v", err)
+	}
+
+	localEnd, err := maxChangeID(ctx, local)
+	if err != nil {
+		return report, fmt.Errorf("local: %v", err)
+	}
+	peerEnd, err := maxChangeID(ctx, peer)
+	if err != nil {
+		return report, fmt.Errorf("peer: %v", err)
+	}
+
+	var localChanges, peerChanges []syncChange
+	if first {
+		localChanges, err = newSyncSource(local).snapshot(ctx)
+	} else {
+		localChanges, err = newSyncSource(local).changes(ctx, pushed, localEnd)
+	}
+	if err != nil {
+		return report, fmt.Errorf("read local changes: %v", err)
+	}
+	if first {
+		peerChanges, err = newSyncSource(peer).snapshot(ctx)
+	} else {
+		peerChanges, err = newSyncSource(peer).changes(ctx, pulled, peerEnd)
+	}
+	if err != nil {
+		return report, fmt.Errorf("read peer changes: %v", err)
+	}
+
+	keepLocal, conflicts, err := resolveConflicts(localChanges, peerChanges, resolve)
+	report.conflicts = conflicts
+	if err != nil {
+		return report, err
+	}
+
+	applied, skipped, before, after, err := applyChanges(ctx, local, peerChanges, keepLocal, true)
+	if err != nil {
+		return report, fmt.Errorf("pull: %v", err)
+	}
+	report.pulled, report.skipped = applied, skipped
+	// The copies just logged locally need not go back to the peer, unless
+	// other writes landed in between.
+	if before == localEnd {
+		localEnd = after
+	}
+
+	applied, skipped, before, after, err = applyChanges(ctx, peer, localChanges, keepLocal, false)
+	if err != nil {
+		return report, fmt.Errorf("push: %v", err)
+	}
+	report.pushed, report.skipped = applied, report.skipped+skipped
+	if before == peerEnd {
+		peerEnd = after
+	}
+
+	if _, err := local.ExecContext(ctx, `INSERT INTO sync_state (peer, pulled, pushed, synced_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(peer) DO UPDATE SET pulled = excluded.pulled, pushed = excluded.pushed, synced_at = excluded.synced_at`,
+		peerName, peerEnd, localEnd); err != nil {
+		return report, fmt.Errorf("save sync state: %v", err)
+	}
+	return report, nil
+}
+
+// syncURL connects to the peer at peerURL and syncs db with it.
+func syncURL(ctx context.Context, db *sql.DB, peerURL string, resolve conflictResolver) (syncReport, error) {
+	peer, err := openURL(ctx, peerURL)
+	if err != nil {
+		return syncReport{}, err
+	}
+	defer peer.Close()
+	return syncWithPeer(ctx, db, peer, peerURL, resolve)
+}
+
+func syncPeriodically(ctx context.Context, db *sql.DB, peerURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := syncURL(ctx, db, peerURL, lastWriterWins)
+			if err != nil {
+				log.Printf("sync with %s failed: %v", peerURL, err)
+				continue
+			}
+			log.Printf("sync with %s: %s", peerURL, report)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveConflicts(t *testing.T) {
+	entity := func(typ, at string) syncChange {
+		return syncChange{op: "update", table: "entities", key: []any{"pi"}, values: []any{typ, "2026-01-01 00:00:00"}, changedAt: at}
+	}
+	deleted := syncChange{op: "delete", table: "entities", key: []any{"pi"}, changedAt: "2026-03-01 00:00:00"}
+
+	tests := []struct {
+		name          string
+		local, peer   syncChange
+		wantConflict  bool
+		wantKeepLocal bool
+	}{
+		{"same state", entity("device", "2026-02-01 00:00:00"), entity("device", "2026-02-02 00:00:00"), false, false},
+		{"local newer", entity("computer", "2026-02-02 00:00:00"), entity("device", "2026-02-01 00:00:00"), true, true},
+		{"peer newer", entity("computer", "2026-02-01 00:00:00"), entity("device", "2026-02-02 00:00:00"), true, false},
+		{"tie goes to peer", entity("computer", "2026-02-01 00:00:00"), entity("device", "2026-02-01 00:00:00"), true, false},
+		{"delete vs update", deleted, entity("device", "2026-02-01 00:00:00"), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := syncChange{op: "insert", table: "entities", key: []any{"nas"}, values: []any{"device", nil}}
+			keepLocal, conflicts, err := resolveConflicts([]syncChange{tt.local}, []syncChange{other, tt.peer}, lastWriterWins)
+			if err != nil {
+				t.Fatalf("resolveConflicts: %v", err)
+			}
+			if got := conflicts == 1; got != tt.wantConflict {
+				t.Fatalf("conflicts = %d, want conflict %v", conflicts, tt.wantConflict)
+			}
+			keep, ok := keepLocal[rowID("entities", []any{"pi"})]
+			if ok != tt.wantConflict || keep != tt.wantKeepLocal {
+				t.Errorf("keepLocal = %v (decided %v), want %v", keep, ok, tt.wantKeepLocal)
+			}
+			if _, ok := keepLocal[rowID("entities", []any{"nas"})]; ok {
+				t.Error("row changed on one side only should not be decided")
+			}
+		})
+	}
+}
+
+func TestPromptResolver(t *testing.T) {
+	c := syncConflict{
+		local: syncChange{op: "update", table: "entities", key: []any{"pi"}, values: []any{"computer"}},
+		peer:  syncChange{op: "delete", table: "entities", key: []any{"pi"}},
+	}
+	tests := []struct {
+		input   string
+		want    bool
+		wantErr bool
+	}{
+		{"l\n", true, false},
+		{"what\npeer\n", false, false},
+		{"", false, true},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		got, err := promptResolver(strings.NewReader(tt.input), &out)(c)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("input %q: got %v, %v; want %v, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+		if !strings.Contains(out.String(), `conflict in entities ["pi"]`) {
+			t.Errorf("prompt = %q", out.String())
+		}
+	}
+}
+
+// setupPeerDB opens the second database at LIBSQL_PEER_URL, which the sync
+// tests use as the peer and the cold storage tests as the cold store, and
+// skips the test when there is none.
+func setupPeerDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("LIBSQL_PEER_URL")
+	if url == "" {
+		url = "http://localhost:8081"
+	}
+	db, err := sql.Open("libsql", url)
+	if err != nil {
+		t.Skipf("skipping, no second database: %v", err)
+	}
+	// The libsql HTTP driver does not implement driver.Pinger, so only a
+	// statement tells whether the peer is there.
+	if _, err := db.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		db.Close()
+		t.Skipf("skipping, no second database at %s (LIBSQL_PEER_URL): %v", url, err)
+	}
+	if err := migrate(context.Background(), db); err != nil {
+		t.Fatalf("migrate peer: %v", err)
+	}
+	return db
+}
+
+func TestSyncWithPeer_Integration(t *testing.T) {
+	local := setupTestDB(t)
+	defer local.Close()
+	peer := setupPeerDB(t)
+	defer peer.Close()
+
+	ctx := context.Background()
+	const peerName = "sync-test-peer"
+	cleanup := func() {
+		for _, db := range []*sql.DB{local, peer} {
+			db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT id FROM observations WHERE content LIKE 'sync test %')")
+			db.Exec("DELETE FROM observations WHERE content LIKE 'sync test %'")
+			db.Exec("DELETE FROM relations WHERE relation_type = 'sync_test_backs_up'")
+			db.Exec("DELETE FROM entities WHERE name LIKE 'sync-test-%'")
+		}
+		local.Exec("DELETE FROM sync_state WHERE peer = ?", peerName)
+	}
+	cleanup()
+	defer cleanup()
+
+	exec := func(db *sql.DB, stmts ...string) {
+		t.Helper()
+		for _, stmt := range stmts {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("%s: %v", stmt, err)
+			}
+		}
+	}
+	value := func(db *sql.DB, query string) string {
+		t.Helper()
+		var v sql.NullString
+		if err := db.QueryRow(query).Scan(&v); err != nil && err != sql.ErrNoRows {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return v.String
+	}
+	sync := func() syncReport {
+		t.Helper()
+		report, err := syncWithPeer(ctx, local, peer, peerName, lastWriterWins)
+		if err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+		return report
+	}
+
+	exec(local,
+		"INSERT INTO entities (name, entity_type) VALUES ('sync-test-laptop', 'device')",
+		"INSERT INTO observations (entity_id, content) SELECT id, 'sync test has a usb-c charger' FROM entities WHERE name = 'sync-test-laptop'",
+		`INSERT INTO observation_tags (observation_id, tag_id) SELECT o.id, t.id FROM observations o, tags t
+			WHERE o.content = 'sync test has a usb-c charger' AND t.name = 'homelab'`,
+	)
+	exec(peer, "INSERT INTO entities (name, entity_type) VALUES ('sync-test-server', 'device')")
+
+	t.Run("first sync merges both sides", func(t *testing.T) {
+		sync()
+		if got := value(peer, `SELECT t.name FROM observation_tags ot JOIN observations o ON o.id = ot.observation_id
+			JOIN tags t ON t.id = ot.tag_id WHERE o.content = 'sync test has a usb-c charger'`); got != "homelab" {
+			t.Errorf("peer observation tag = %q", got)
+		}
+		if got := value(local, "SELECT entity_type FROM entities WHERE name = 'sync-test-server'"); got != "device" {
+			t.Errorf("local sync-test-server type = %q", got)
+		}
+	})
+
+	t.Run("changes flow both ways", func(t *testing.T) {
+		exec(local,
+			"UPDATE observations SET content = 'sync test has a 65W usb-c charger' WHERE content = 'sync test has a usb-c charger'",
+			`INSERT INTO relations (from_id, to_id, relation_type) SELECT l.id, s.id, 'sync_test_backs_up' FROM entities l, entities s
+				WHERE l.name = 'sync-test-laptop' AND s.name = 'sync-test-server'`,
+		)
+		exec(peer, "UPDATE entities SET entity_type = 'computer' WHERE name = 'sync-test-server'")
+
+		if report := sync(); report.conflicts != 0 {
+			t.Errorf("unexpected conflicts: %s", report)
+		}
+		if got := value(peer, "SELECT count(*) FROM observations WHERE content LIKE 'sync test %charger'"); got != "1" {
+			t.Errorf("peer charger observations = %s, want the old one renamed", got)
+		}
+		if got := value(peer, "SELECT count(*) FROM relations WHERE relation_type = 'sync_test_backs_up'"); got != "1" {
+			t.Errorf("peer relations = %s", got)
+		}
+		if got := value(local, "SELECT entity_type FROM entities WHERE name = 'sync-test-server'"); got != "computer" {
+			t.Errorf("local sync-test-server type = %q", got)
+		}
+	})
+
+	t.Run("copies are not synced back", func(t *testing.T) {
+		report := sync()
+		if report.conflicts != 0 || report.pulled != 0 || report.pushed != 0 {
+			t.Errorf("expected nothing to sync, got %s", report)
+		}
+	})
+
+	t.Run("last writer wins", func(t *testing.T) {
+		exec(peer, "UPDATE entities SET entity_type = 'laptop' WHERE name = 'sync-test-laptop'")
+		time.Sleep(1100 * time.Millisecond)
+		exec(local, "UPDATE entities SET entity_type = 'workstation' WHERE name = 'sync-test-laptop'")
+
+		if report := sync(); report.conflicts != 1 {
+			t.Errorf("expected one conflict, got %s", report)
+		}
+		for name, db := range map[string]*sql.DB{"local": local, "peer": peer} {
+			if got := value(db, "SELECT entity_type FROM entities WHERE name = 'sync-test-laptop'"); got != "workstation" {
+				t.Errorf("%s type = %q, want the later local write", name, got)
+			}
+		}
+	})
+
+	t.Run("deletes propagate", func(t *testing.T) {
+		exec(peer,
+			"DELETE FROM relations WHERE relation_type = 'sync_test_backs_up'",
+			"DELETE FROM entities WHERE name = 'sync-test-server'",
+		)
+		sync()
+		if got := value(local, "SELECT count(*) FROM entities WHERE name = 'sync-test-server'"); got != "0" {
+			t.Errorf("local still has sync-test-server")
+		}
+		if got := value(local, "SELECT count(*) FROM relations WHERE relation_type = 'sync_test_backs_up'"); got != "0" {
+			t.Errorf("local still has the relation")
+		}
+	})
+}
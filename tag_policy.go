@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tagPolicyConfig is ENGRAM_TAG_POLICY: the tables whose new rows need tags,
+// comma-separated, each optionally followed by the tags that count, as in
+// "observations,entities:person|project". "none" requires tags nowhere.
+var tagPolicyConfig = getEnv("ENGRAM_TAG_POLICY", "observations")
+
+// requiredTags is the parsed tag policy. serve refuses to start when
+// tagPolicyErr is set.
+var requiredTags, tagPolicyErr = parseTagPolicy(tagPolicyConfig)
+
+// clientTagsConfig is ENGRAM_CLIENT_TAGS: per-client namespaces, keyed by
+// MCP client name or OIDC identity, e.g.
+// "alice@example.com=homelab,personal;team-bot=career". A client with a
+// namespace can only tag new rows with its tags, and needs one of them on
+// new observations.
+var clientTagsConfig = getEnv("ENGRAM_CLIENT_TAGS", "")
+
+// namespaces is the parsed ENGRAM_CLIENT_TAGS. serve refuses to start when
+// namespacesErr is set.
+var namespaces, namespacesErr = parseNamespaces(clientTagsConfig)
+
+// tagJunctions are the tables that can be tagged and the junction table and
+// column linking their rows to tags.
+var tagJunctions = map[string]struct{ table, column string }{
+	"observations": {"observation_tags", "observation_id"},
+	"entities":     {"entity_tags", "entity_id"},
+}
+
+// tagPolicy maps each table whose new rows need tags to the tags that
+// satisfy it. An empty list accepts any tag.
+type tagPolicy map[string][]string
+
+func parseTagPolicy(s string) (tagPolicy, error) {
+	policy := make(tagPolicy)
+	if strings.EqualFold(strings.TrimSpace(s), "none") {
+		return policy, nil
+	}
+	for _, entry := range parseTagNames(s) {
+		table, categories, _ := strings.Cut(entry, ":")
+		table = strings.ToLower(strings.TrimSpace(table))
+		if _, ok := tagJunctions[table]; !ok {
+			return nil, fmt.Errorf("%s cannot be tagged, tags can be required on: %s", table, strings.Join(taggableTables(), ", "))
+		}
+		if _, ok := policy[table]; ok {
+			return nil, fmt.Errorf("%s is listed twice", table)
+		}
+		policy[table] = []string{}
+		for _, c := range strings.Split(categories, "|") {
+			if c = strings.TrimSpace(c); c != "" {
+				policy[table] = append(policy[table], c)
+			}
+		}
+	}
+	return policy, nil
+}
+
+func taggableTables() []string {
+	tables := make([]string, 0, len(tagJunctions))
+	for t := range tagJunctions {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// requires reports whether new rows of table need tags.
+func (p tagPolicy) requires(table string) bool {
+	_, ok := p[table]
+	return ok
+}
+
+// check rejects tags for a new row of table that include none of the tags
+// the policy asks for.
+func (p tagPolicy) check(table string, tagNames []string) error {
+	categories := p[table]
+	if len(categories) == 0 {
+		return nil
+	}
+	for _, name := range tagNames {
+		for _, c := range categories {
+			if strings.EqualFold(name, c) {
+				return nil
+			}
+		}
+	}
+	return errorf(codeTagRequired, "new %s need at least one of these tags: %s", table, strings.Join(categories, ", "))
+}
+
+// tagNamespaces maps client names to the lowercased tags they may write.
+type tagNamespaces map[string]map[string]bool
+
+func parseNamespaces(s string) (tagNamespaces, error) {
+	entries, err := parseClientEntries(s, "tag")
+	if err != nil {
+		return nil, err
+	}
+	n := make(tagNamespaces)
+	for name, list := range entries {
+		tags := make(map[string]bool)
+		for _, t := range parseTagNames(list) {
+			tags[strings.ToLower(t)] = true
+		}
+		if len(tags) == 0 {
+			return nil, fmt.Errorf("client %s: namespace must include at least one tag", name)
+		}
+		n[name] = tags
+	}
+	return n, nil
+}
+
+// of returns the calling client's namespace, or nil when it has none.
+func (n tagNamespaces) of(ctx context.Context) map[string]bool {
+	if name, ok := clientName(ctx); ok {
+		return n[name]
+	}
+	return nil
+}
+
+func (n tagNamespaces) list(ns map[string]bool) string {
+	tags := make([]string, 0, len(ns))
+	for t := range ns {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ", ")
+}
+
+// check rejects tags for a new row of table outside the caller's namespace.
+func (n tagNamespaces) check(ctx context.Context, table string, tagNames []string) error {
+	ns := n.of(ctx)
+	if ns == nil {
+		return nil
+	}
+	if len(tagNames) == 0 && table == "observations" {
+		return errorf(codeTagRequired, "new observations need one of your tags: %s", n.list(ns))
+	}
+	for _, name := range tagNames {
+		if !ns[strings.ToLower(name)] {
+			return errorf(codeTagNotAllowed, "tag %s is outside your namespace, use one of: %s", name, n.list(ns))
+		}
+	}
+	return nil
+}
+
+// observationFilter returns a condition, to AND onto a WHERE clause on
+// observations, that keeps the caller to observations in its namespace.
+// It is empty for callers without one.
+func (n tagNamespaces) observationFilter(ctx context.Context) string {
+	ns := n.of(ctx)
+	if ns == nil {
+		return ""
+	}
+	tags := make([]string, 0, len(ns))
+	for t := range ns {
+		tags = append(tags, sqlLiteral(t))
+	}
+	sort.Strings(tags)
+	return "id IN (SELECT ot.observation_id FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id WHERE lower(t.name) IN (" + strings.Join(tags, ", ") + "))"
+}
+
+// validateTagsFor resolves the tags given for a new row of table, applying
+// the caller's namespace and the tag policy's categories. Callers report
+// missing tags themselves.
+func validateTagsFor(ctx context.Context, db *sql.DB, table string, tagNames []string) ([]int64, error) {
+	if err := namespaces.check(ctx, table, tagNames); err != nil {
+		return nil, err
+	}
+	if len(tagNames) == 0 {
+		return nil, nil
+	}
+	if err := requiredTags.check(table, tagNames); err != nil {
+		return nil, err
+	}
+	return validateTags(ctx, db, tagNames)
+}
+
+// linkEntityTags tags a new entity.
+func linkEntityTags(ctx context.Context, db execer, entityID int64, tagIDs []int64) error {
+	for _, tagID := range tagIDs {
+		if _, err := db.ExecContext(ctx, "INSERT INTO entity_tags (entity_id, tag_id) VALUES (?, ?)", entityID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagList describes the tags a row was stored with in a success message.
+func tagList(tagsStr string) string {
+	if strings.TrimSpace(tagsStr) == "" {
+		return "no tags"
+	}
+	return "tags: " + tagsStr
+}
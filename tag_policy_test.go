@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseTagPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    tagPolicy
+		wantErr bool
+	}{
+		{"default", "observations", tagPolicy{"observations": {}}, false},
+		{"none", "None", tagPolicy{}, false},
+		{"empty", "", tagPolicy{}, false},
+		{"entities with categories", "observations, Entities: person | project", tagPolicy{"observations": {}, "entities": {"person", "project"}}, false},
+		{"untaggable table", "relations", nil, true},
+		{"listed twice", "entities,entities:person", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTagPolicy(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTagPolicy(%q) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTagPolicy(%q) = %v, want %v", tt.config, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagPolicyCheck(t *testing.T) {
+	policy := tagPolicy{"observations": {}, "entities": {"person", "project"}}
+	tests := []struct {
+		table   string
+		tags    []string
+		wantErr bool
+	}{
+		{"observations", []string{"homelab"}, false},
+		{"entities", []string{"homelab", "Project"}, false},
+		{"entities", []string{"homelab"}, true},
+		{"relations", []string{"anything"}, false},
+	}
+
+	for _, tt := range tests {
+		if err := policy.check(tt.table, tt.tags); (err != nil) != tt.wantErr {
+			t.Errorf("check(%s, %v) error = %v, wantErr %v", tt.table, tt.tags, err, tt.wantErr)
+		}
+	}
+	if !policy.requires("entities") || (tagPolicy{}).requires("observations") {
+		t.Errorf("requires() does not follow the policy")
+	}
+}
+
+func TestTagPolicy_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name LIKE 'tag-policy-test-%'")
+	defer db.Exec("DELETE FROM entity_tags WHERE entity_id IN (SELECT id FROM entities WHERE name LIKE 'tag-policy-test-%')")
+	defer db.Exec("DELETE FROM observations WHERE content = 'tag policy test untagged'")
+
+	saved := requiredTags
+	defer func() { requiredTags = saved }()
+
+	call := func(handler string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		var result *mcp.CallToolResult
+		var err error
+		switch handler {
+		case "upsert_entity":
+			result, err = callTool(upsertEntityHandler(db), handler, args)
+		case "execute":
+			result, err = callTool(executeHandler(db, nil, nil), handler, args)
+		case "add_observation":
+			result, err = callTool(addObservationHandler(db, nil), handler, args)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", handler, err)
+		}
+		return result
+	}
+
+	requiredTags = tagPolicy{"observations": {}, "entities": {"homelab", "career"}}
+	if result := call("upsert_entity", map[string]any{"name": "tag-policy-test-nas", "entity_type": "Device"}); !result.IsError {
+		t.Errorf("expected an untagged entity to be rejected")
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM entities WHERE name = 'tag-policy-test-nas'").Scan(&n)
+	if n != 0 {
+		t.Errorf("rejected entity was stored")
+	}
+	if result := call("upsert_entity", map[string]any{"name": "tag-policy-test-nas", "entity_type": "Device", "tags": "personal"}); !result.IsError ||
+		!strings.Contains(result.Content[0].(mcp.TextContent).Text, "homelab, career") {
+		t.Errorf("expected the policy's categories in the error, got %v", result.Content)
+	}
+	if result := call("upsert_entity", map[string]any{"name": "tag-policy-test-nas", "entity_type": "Device", "tags": "homelab"}); result.IsError {
+		t.Fatalf("upsert_entity: %v", result.Content)
+	}
+	// An existing entity needs no tags.
+	if result := call("upsert_entity", map[string]any{"name": "tag-policy-test-nas", "entity_type": "Device"}); result.IsError {
+		t.Errorf("upsert_entity of an existing entity: %v", result.Content)
+	}
+
+	if result := call("execute", map[string]any{"sql": "INSERT INTO entities (name, entity_type) VALUES ('tag-policy-test-job', 'Company')"}); !result.IsError {
+		t.Errorf("expected an untagged entity insert to be rejected")
+	}
+	if result := call("execute", map[string]any{"sql": "INSERT INTO entities (name, entity_type) VALUES ('tag-policy-test-job', 'Company')", "tags": "career"}); result.IsError {
+		t.Fatalf("execute: %v", result.Content)
+	}
+	var tags string
+	if err := db.QueryRow(`SELECT group_concat(t.name) FROM entities e JOIN entity_tags et ON et.entity_id = e.id JOIN tags t ON t.id = et.tag_id
+		WHERE e.name LIKE 'tag-policy-test-%' ORDER BY e.name`).Scan(&tags); err != nil || (tags != "homelab,career" && tags != "career,homelab") {
+		t.Errorf("entity tags = %q %v, want homelab and career", tags, err)
+	}
+
+	requiredTags = tagPolicy{}
+	result := call("add_observation", map[string]any{"entity": "tag-policy-test-nas", "content": "tag policy test untagged"})
+	if result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "with no tags") {
+		t.Errorf("expected an untagged observation without a policy, got %v", result.Content)
+	}
+	if result := call("execute", map[string]any{"sql": "INSERT INTO entities (name, entity_type) VALUES ('tag-policy-test-misc', 'Thing')"}); result.IsError {
+		t.Errorf("execute without a policy: %v", result.Content)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	n, err := parseNamespaces("alice@example.com=Homelab, personal;team-bot=career")
+	if err != nil {
+		t.Fatalf("parseNamespaces: %v", err)
+	}
+	if !reflect.DeepEqual(n["alice@example.com"], map[string]bool{"homelab": true, "personal": true}) {
+		t.Errorf("alice namespace = %v", n["alice@example.com"])
+	}
+	for _, bad := range []string{"alice", "alice=", "=homelab"} {
+		if _, err := parseNamespaces(bad); err == nil {
+			t.Errorf("parseNamespaces(%q): expected an error", bad)
+		}
+	}
+
+	alice := withClientName(context.Background(), "alice@example.com")
+	tests := []struct {
+		ctx     context.Context
+		table   string
+		tags    []string
+		wantErr string
+	}{
+		{context.Background(), "observations", nil, ""},
+		{withClientName(context.Background(), "carol"), "observations", []string{"drinks"}, ""},
+		{alice, "observations", []string{"HOMELAB", "personal"}, ""},
+		{alice, "observations", []string{"homelab", "career"}, "tag career is outside your namespace, use one of: homelab, personal"},
+		{alice, "observations", nil, "new observations need one of your tags"},
+		{alice, "entities", nil, ""},
+		{alice, "entities", []string{"drinks"}, "outside your namespace"},
+	}
+	for _, tt := range tests {
+		err := n.check(tt.ctx, tt.table, tt.tags)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("check(%s, %v) = %v, want %q", tt.table, tt.tags, err, tt.wantErr)
+		}
+	}
+
+	if f := n.observationFilter(context.Background()); f != "" {
+		t.Errorf("filter without a namespace = %q", f)
+	}
+	if f := n.observationFilter(alice); !strings.Contains(f, "IN ('homelab', 'personal')") {
+		t.Errorf("alice filter = %q", f)
+	}
+}
+
+func TestNamespaceEdits_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer func(n tagNamespaces) { namespaces = n }(namespaces)
+	namespaces = tagNamespaces{"alice@example.com": {"homelab": true}}
+
+	defer db.Exec("DELETE FROM entities WHERE name = 'Namespace test'")
+	defer db.Exec("DELETE FROM observations WHERE entity_id IN (SELECT id FROM entities WHERE name = 'Namespace test')")
+	defer db.Exec("DELETE FROM observation_tags WHERE observation_id IN (SELECT o.id FROM observations o JOIN entities e ON e.id = o.entity_id WHERE e.name = 'Namespace test')")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('Namespace test', 'Test')"); err != nil {
+		t.Fatalf("insert entity: %v", err)
+	}
+
+	alice := withClientName(context.Background(), "alice@example.com")
+	add := addObservationHandler(db, nil)
+	result, _ := add(alice, mcpToolRequest(map[string]any{"entity": "Namespace test", "content": "Namespace career note", "tags": "career"}))
+	if !result.IsError {
+		t.Fatal("alice wrote outside her namespace")
+	}
+	ids := map[string]int64{}
+	for _, tag := range []string{"homelab", "career"} {
+		result, err := callTool(add, "add_observation", map[string]any{"entity": "Namespace test", "content": "Namespace " + tag + " note", "tags": tag})
+		if err != nil || result.IsError {
+			t.Fatalf("add %s: %v %v", tag, err, result.Content)
+		}
+		var id int64
+		if err := db.QueryRow("SELECT id FROM observations WHERE content = ?", "Namespace "+tag+" note").Scan(&id); err != nil {
+			t.Fatalf("find %s note: %v", tag, err)
+		}
+		ids[tag] = id
+	}
+
+	// The REST edit routes run these statements through execute.
+	execute := executeHandler(db, nil, nil)
+	for tag, want := range map[string]string{"career": "0 row(s)", "homelab": "1 observation(s) updated"} {
+		sqlStr := "UPDATE observations SET content = 'Namespace edited' WHERE " + observationWhere(alice, ids[tag])
+		result, err := callTool(execute, "execute", map[string]any{"sql": sqlStr})
+		if err != nil || result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, want) {
+			t.Errorf("%s: %v %v, want %s", sqlStr, err, result.Content, want)
+		}
+	}
+	for tag, want := range map[string]string{"career": "0 row(s)", "homelab": "1 row(s)"} {
+		sqlStr := "DELETE FROM observations WHERE " + observationWhere(alice, ids[tag])
+		result, err := callTool(execute, "execute", map[string]any{"sql": sqlStr})
+		if err != nil || result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, want) {
+			t.Errorf("%s: %v %v, want %s", sqlStr, err, result.Content, want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// tagPeriods are the growth buckets tag_stats and heatmap accept, with the
+// SQLite expression giving the date the bucket of the timestamp in the %s
+// column starts on.
+var tagPeriods = map[string]string{
+	"week":  "date(%s, 'weekday 0', '-6 days')",
+	"month": "strftime('%%Y-%%m-01', %s)",
+}
+
+// periodStarts returns the start dates of the last n buckets up to now,
+// oldest first, in the form tagPeriods produces. Weeks start on Monday.
+func periodStarts(period string, n int, now time.Time) []string {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if period == "week" {
+		start = time.Date(now.Year(), now.Month(), now.Day()-(int(now.Weekday())+6)%7, 0, 0, 0, 0, time.UTC)
+	}
+	starts := make([]string, n)
+	for i := n - 1; i >= 0; i-- {
+		starts[i] = start.Format("2006-01-02")
+		if period == "week" {
+			start = start.AddDate(0, 0, -7)
+		} else {
+			start = start.AddDate(0, -1, 0)
+		}
+	}
+	return starts
+}
+
+// buildTagStats reports observation counts per tag, new observations per
+// period and the tags most often used together. tagIDs, when set, limits the
+// report to those tags and the pairs they are part of.
+func buildTagStats(ctx context.Context, db *sql.DB, levels []string, tagIDs []int64, period string, periods, limit int, now time.Time) (string, error) {
+	var filter string
+	var filterArgs []any
+	if len(tagIDs) > 0 {
+		filter = "t.id IN (" + placeholders(len(tagIDs)) + ")"
+		for _, id := range tagIDs {
+			filterArgs = append(filterArgs, id)
+		}
+	}
+	where := func(cond string) string {
+		if cond == "" {
+			return ""
+		}
+		return " WHERE " + cond
+	}
+
+	rows, err := db.QueryContext(ctx, restrictVisibility(`SELECT t.name, count(o.id)
+		FROM tags t LEFT JOIN observation_tags ot ON ot.tag_id = t.id LEFT JOIN observations o ON o.id = ot.observation_id`+
+		where(filter)+` GROUP BY t.id ORDER BY 2 DESC, 1`, levels), filterArgs...)
+	if err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+	var names []string
+	totals := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var n int64
+		if err := rows.Scan(&name, &n); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("scan error: %v", err)
+		}
+		names = append(names, name)
+		totals[name] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+	if len(names) == 0 {
+		return "no tags", nil
+	}
+
+	starts := periodStarts(period, periods, now)
+	cond := "o.created_at >= ?"
+	if filter != "" {
+		cond += " AND " + filter
+	}
+	rows, err = db.QueryContext(ctx, restrictVisibility(`SELECT t.name, `+fmt.Sprintf(tagPeriods[period], "o.created_at")+`, count(*)
+		FROM observation_tags ot JOIN tags t ON t.id = ot.tag_id JOIN observations o ON o.id = ot.observation_id`+
+		where(cond)+` GROUP BY 1, 2`, levels), append([]any{starts[0]}, filterArgs...)...)
+	if err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+	growth := make(map[string]map[string]int64)
+	for rows.Next() {
+		var name, start string
+		var n int64
+		if err := rows.Scan(&name, &start, &n); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("scan error: %v", err)
+		}
+		if growth[name] == nil {
+			growth[name] = make(map[string]int64)
+		}
+		growth[name][start] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+
+	pairCond := ""
+	pairArgs := append([]any{}, filterArgs...)
+	if filter != "" {
+		pairCond = strings.ReplaceAll(filter, "t.id", "a.id") + " OR " + strings.ReplaceAll(filter, "t.id", "b.id")
+		pairArgs = append(pairArgs, filterArgs...)
+	}
+	rows, err = db.QueryContext(ctx, restrictVisibility(`SELECT a.name, b.name, count(*)
+		FROM observation_tags x JOIN observation_tags y ON y.observation_id = x.observation_id AND y.tag_id > x.tag_id
+		JOIN observations o ON o.id = x.observation_id JOIN tags a ON a.id = x.tag_id JOIN tags b ON b.id = y.tag_id`+
+		where(pairCond)+` GROUP BY x.tag_id, y.tag_id ORDER BY 3 DESC, 1, 2 LIMIT ?`, levels), append(pairArgs, limit)...)
+	if err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+	var pairs []string
+	for rows.Next() {
+		var a, b string
+		var n int64
+		if err := rows.Scan(&a, &b, &n); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("scan error: %v", err)
+		}
+		// The share of each tag's observations that carry the other tag; a
+		// pair near 100% on one side is a subset worth its own tag, or not.
+		pairs = append(pairs, fmt.Sprintf("%s + %s: %d (%d%% of %s, %d%% of %s)", a, b, n, percent(n, totals[a]), a, percent(n, totals[b]), b))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("query error: %v", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "observations per tag, then new ones per %s from %s:\n", period, starts[0])
+	for _, name := range names {
+		counts := make([]string, len(starts))
+		for i, s := range starts {
+			counts[i] = fmt.Sprint(growth[name][s])
+		}
+		fmt.Fprintf(&sb, "%s: %d [%s]\n", name, totals[name], strings.Join(counts, " "))
+	}
+	sb.WriteString("\ntags used together (shared observations):\n")
+	if len(pairs) == 0 {
+		sb.WriteString("none\n")
+	}
+	for _, p := range pairs {
+		sb.WriteString(p + "\n")
+	}
+	return sb.String(), nil
+}
+
+func percent(n, total int64) int64 {
+	if total == 0 {
+		return 0
+	}
+	return n * 100 / total
+}
+
+// registerTagStats adds the tag_stats tool.
+func registerTagStats(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("tag_stats",
+		mcp.WithDescription(`Report observations per tag, how many each tag gained per week or month, and which tags are most often used together.
+
+Use it to decide when a broad tag should be split: a tag that grows fast and keeps appearing with the same other tag is a candidate. Pairs show the share of each tag's observations that carry the other.`),
+		mcp.WithString("tags",
+			mcp.Description("Only these comma-separated tags and the pairs they are part of (default: all tags)"),
+		),
+		mcp.WithString("period",
+			mcp.Description("Growth bucket: 'month' (default) or 'week'"),
+			mcp.Enum("week", "month"),
+		),
+		mcp.WithNumber("periods",
+			mcp.Description("Number of buckets back from now (default 6, max 52)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum tag pairs to return (default 20, max 500)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), tagStatsHandler(db, scopes))
+}
+
+func tagStatsHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		period := request.GetString("period", "month")
+		if _, ok := tagPeriods[period]; !ok {
+			return toolError(codeInvalidArgument, "period must be 'week' or 'month'"), nil
+		}
+		periods := request.GetInt("periods", 6)
+		if periods < 1 || periods > 52 {
+			return toolError(codeInvalidArgument, "periods must be between 1 and 52"), nil
+		}
+		limit := request.GetInt("limit", 20)
+		if limit < 1 || limit > 500 {
+			return toolError(codeInvalidArgument, "limit must be between 1 and 500"), nil
+		}
+
+		var tagIDs []int64
+		if tags := parseTagNames(request.GetString("tags", "")); len(tags) > 0 {
+			var err error
+			if tagIDs, err = validateTags(ctx, db, tags); err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+		}
+
+		report, err := buildTagStats(ctx, db, scopes.levels(ctx), tagIDs, period, periods, limit, time.Now())
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		return mcp.NewToolResultText(report), nil
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestPeriodStarts(t *testing.T) {
+	now := time.Date(2026, 3, 4, 15, 0, 0, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		name   string
+		period string
+		n      int
+		want   []string
+	}{
+		{"months", "month", 3, []string{"2026-01-01", "2026-02-01", "2026-03-01"}},
+		{"across a year", "month", 4, []string{"2025-12-01", "2026-01-01", "2026-02-01", "2026-03-01"}},
+		{"weeks", "week", 2, []string{"2026-02-23", "2026-03-02"}},
+		{"one week", "week", 1, []string{"2026-03-02"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := periodStarts(tt.period, tt.n, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("periodStarts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	sunday := time.Date(2026, 3, 8, 23, 0, 0, 0, time.UTC)
+	if got := periodStarts("week", 1, sunday); got[0] != "2026-03-02" {
+		t.Errorf("week of a Sunday starts %s, want 2026-03-02", got[0])
+	}
+}
+
+func TestTagStats_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM tags WHERE name LIKE 'tagstats-%'")
+	defer db.Exec("DELETE FROM entities WHERE name = 'tagstats-test'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'tag stats %'")
+
+	for _, stmt := range []string{
+		"INSERT INTO tags (name, description) VALUES ('tagstats-broad', 'test'), ('tagstats-narrow', 'test'), ('tagstats-unused', 'test')",
+		"INSERT INTO entities (name, entity_type) VALUES ('tagstats-test', 'test')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	for _, args := range []map[string]any{
+		{"content": "tag stats one", "tags": "tagstats-broad, tagstats-narrow", "visibility": "public"},
+		{"content": "tag stats two", "tags": "tagstats-broad, tagstats-narrow"},
+		{"content": "tag stats three", "tags": "tagstats-broad"},
+		{"content": "tag stats four", "tags": "tagstats-broad", "visibility": "public"},
+	} {
+		args["entity"] = "tagstats-test"
+		if result, err := callTool(addObservationHandler(db, nil), "add_observation", args); err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+	}
+
+	tagIDs, err := validateTags(ctx, db, []string{"tagstats-broad", "tagstats-narrow", "tagstats-unused"})
+	if err != nil {
+		t.Fatalf("validateTags: %v", err)
+	}
+	report, err := buildTagStats(ctx, db, visibilityLevels, tagIDs, "month", 2, 20, time.Now())
+	if err != nil {
+		t.Fatalf("buildTagStats: %v", err)
+	}
+	for _, want := range []string{
+		"tagstats-broad: 4 [0 4]\ntagstats-narrow: 2 [0 2]\ntagstats-unused: 0 [0 0]\n",
+		"tagstats-broad + tagstats-narrow: 2 (50% of tagstats-broad, 100% of tagstats-narrow)\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in:\n%s", want, report)
+		}
+	}
+
+	report, err = buildTagStats(ctx, db, []string{"public"}, tagIDs, "week", 1, 20, time.Now())
+	if err != nil {
+		t.Fatalf("buildTagStats: %v", err)
+	}
+	if want := "tagstats-broad + tagstats-narrow: 1 (50% of tagstats-broad, 100% of tagstats-narrow)"; !strings.Contains(report, want) {
+		t.Errorf("expected %q in:\n%s", want, report)
+	}
+
+	report, err = buildTagStats(ctx, db, visibilityLevels, tagIDs[2:], "month", 1, 20, time.Now())
+	if err != nil {
+		t.Fatalf("buildTagStats: %v", err)
+	}
+	if want := "tagstats-unused: 0 [0]\n\ntags used together (shared observations):\nnone\n"; !strings.HasSuffix(report, want) {
+		t.Errorf("expected suffix %q in:\n%s", want, report)
+	}
+
+	for _, args := range []map[string]any{{"period": "year"}, {"periods": 0}, {"limit": 1000}, {"tags": "tagstats-nope"}} {
+		result, err := callTool(tagStatsHandler(db, nil), "tag_stats", args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Errorf("tag_stats %v: expected error, got %v", args, result.Content[0].(mcp.TextContent).Text)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// taxonomyFile is ENGRAM_TAXONOMY: a file declaring the deployment's tags,
+// one "name: description" per line. A line indented under another is a
+// subcategory of it:
+//
+//	homelab: Servers, network and self-hosted services
+//	  network: Routers, VLANs, DNS and Wi-Fi
+//	career: Work, jobs and professional goals
+//
+// serve creates the tags that do not exist yet on startup. Tags already in
+// the database keep their description and parent.
+var taxonomyFile = getEnv("ENGRAM_TAXONOMY", "")
+
+// taxonomy is the parsed ENGRAM_TAXONOMY, parents before their children.
+// serve refuses to start when taxonomyErr is set.
+var taxonomy, taxonomyErr = loadTaxonomy(taxonomyFile)
+
+type taxonomyTag struct {
+	name, description string
+	// parent is the name of the tag this one is a subcategory of.
+	parent string
+}
+
+func loadTaxonomy(path string) ([]taxonomyTag, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tags, err := parseTaxonomy(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", path, err)
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("%s: no tags declared", path)
+	}
+	return tags, nil
+}
+
+// parseTaxonomy reads the taxonomy format, skipping blank lines and #
+// comments. Errors start with the line number.
+func parseTaxonomy(r io.Reader) ([]taxonomyTag, error) {
+	type level struct {
+		indent int
+		name   string
+	}
+	var (
+		tags  []taxonomyTag
+		stack []level
+		seen  = make(map[string]bool)
+	)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		name, description, _ := strings.Cut(trimmed, ":")
+		name, description = strings.TrimSpace(name), strings.TrimSpace(description)
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("%d: want name: description", n)
+		case strings.Contains(name, ","):
+			return nil, fmt.Errorf("%d: tag name %q has a comma, which separates tags", n, name)
+		case seen[name]:
+			return nil, fmt.Errorf("%d: tag %q declared twice", n, name)
+		}
+		seen[name] = true
+
+		indent := len(line) - len(trimmed)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		tag := taxonomyTag{name: name, description: description}
+		if len(stack) > 0 {
+			tag.parent = stack[len(stack)-1].name
+		}
+		tags = append(tags, tag)
+		stack = append(stack, level{indent, name})
+	}
+	return tags, scanner.Err()
+}
+
+// applyTaxonomy creates the tags in tags that do not exist yet, under their
+// parents, and returns how many it added.
+func applyTaxonomy(ctx context.Context, db *sql.DB, tags []taxonomyTag) (int, error) {
+	added := 0
+	for _, t := range tags {
+		result, err := db.ExecContext(ctx,
+			"INSERT OR IGNORE INTO tags (name, description, parent_id) VALUES (?, ?, (SELECT id FROM tags WHERE name = ?))",
+			t.name, t.description, t.parent)
+		if err != nil {
+			return added, fmt.Errorf("creating tag '%s': %w", t.name, execFailure(err))
+		}
+		n, _ := result.RowsAffected()
+		added += int(n)
+	}
+	return added, nil
+}
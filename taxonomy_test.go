@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTaxonomy(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []taxonomyTag
+		wantErr string
+	}{
+		{
+			name: "hierarchy",
+			input: `# tags for this deployment
+work: Jobs and colleagues
+  projects: Things being built
+    launches: Release dates
+
+  meetings
+travel: Trips and places
+`,
+			want: []taxonomyTag{
+				{"work", "Jobs and colleagues", ""},
+				{"projects", "Things being built", "work"},
+				{"launches", "Release dates", "projects"},
+				{"meetings", "", "work"},
+				{"travel", "Trips and places", ""},
+			},
+		},
+		{name: "tabs", input: "work: Jobs\n\tmeetings: Calls\n", want: []taxonomyTag{{"work", "Jobs", ""}, {"meetings", "Calls", "work"}}},
+		{name: "duplicate", input: "work: a\n  work: b\n", wantErr: `2: tag "work" declared twice`},
+		{name: "comma", input: "work, travel: both\n", wantErr: "1: tag name \"work, travel\" has a comma"},
+		{name: "no name", input: "work: a\n: b\n", wantErr: "2: want name: description"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTaxonomy(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTaxonomy_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	tags := []taxonomyTag{
+		{"taxonomy-test-parent", "Broad", ""},
+		{"taxonomy-test-child", "Narrow", "taxonomy-test-parent"},
+	}
+	cleanup := func() {
+		db.Exec("DELETE FROM tags WHERE name LIKE 'taxonomy-test-%'")
+	}
+	cleanup()
+	defer cleanup()
+
+	added, err := applyTaxonomy(ctx, db, tags)
+	if err != nil || added != 2 {
+		t.Fatalf("applyTaxonomy = %d, %v", added, err)
+	}
+	var parent string
+	if err := db.QueryRow(`SELECT p.name FROM tags c JOIN tags p ON p.id = c.parent_id WHERE c.name = 'taxonomy-test-child'`).Scan(&parent); err != nil || parent != "taxonomy-test-parent" {
+		t.Errorf("parent = %q, %v", parent, err)
+	}
+
+	// A tag already there keeps its description.
+	if _, err := db.Exec("UPDATE tags SET description = 'Edited' WHERE name = 'taxonomy-test-parent'"); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := applyTaxonomy(ctx, db, tags); err != nil || added != 0 {
+		t.Fatalf("second applyTaxonomy = %d, %v", added, err)
+	}
+	var description string
+	if err := db.QueryRow("SELECT description FROM tags WHERE name = 'taxonomy-test-parent'").Scan(&description); err != nil || description != "Edited" {
+		t.Errorf("description = %q, %v", description, err)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// entityTemplatesFile is ENGRAM_ENTITY_TEMPLATES: a file declaring the
+// attributes entities of a type are expected to have. An entity type starts
+// a line; its attributes are indented under it as "name: type", with
+// ", required" for those a new entity must be given:
+//
+//	Person
+//	  birthday: date
+//	  relationship: text, required
+//	Server
+//	  ip_address: ip, required
+//	  os
+//
+// An attribute without a type is text.
+var entityTemplatesFile = getEnv("ENGRAM_ENTITY_TEMPLATES", "")
+
+// entityTemplates is the parsed ENGRAM_ENTITY_TEMPLATES. serve refuses to
+// start when entityTemplatesErr is set.
+var entityTemplates, entityTemplatesErr = loadEntityTemplates(entityTemplatesFile)
+
+type entityTemplate struct {
+	entityType string
+	attributes []templateAttribute
+}
+
+type templateAttribute struct {
+	name, typ string
+	required  bool
+}
+
+func (a templateAttribute) String() string {
+	if a.required {
+		return fmt.Sprintf("%s (%s, required)", a.name, a.typ)
+	}
+	return fmt.Sprintf("%s (%s)", a.name, a.typ)
+}
+
+func loadEntityTemplates(path string) ([]entityTemplate, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	templates, err := parseEntityTemplates(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", path, err)
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("%s: no entity types declared", path)
+	}
+	return templates, nil
+}
+
+// parseEntityTemplates reads the template format, skipping blank lines and
+// # comments. Errors start with the line number.
+func parseEntityTemplates(r io.Reader) ([]entityTemplate, error) {
+	var templates []entityTemplate
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if trimmed == line {
+			entityType := strings.TrimSpace(strings.TrimSuffix(trimmed, ":"))
+			if entityType == "" {
+				return nil, fmt.Errorf("%d: want an entity type", n)
+			}
+			if templateFor(templates, entityType) != nil {
+				return nil, fmt.Errorf("%d: entity type %q declared twice", n, entityType)
+			}
+			templates = append(templates, entityTemplate{entityType: entityType})
+			continue
+		}
+		if len(templates) == 0 {
+			return nil, fmt.Errorf("%d: attribute before any entity type", n)
+		}
+
+		spec, flags, _ := strings.Cut(trimmed, ",")
+		rawName, typ, _ := strings.Cut(spec, ":")
+		name, err := normalizeAttributeName(rawName)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", n, err)
+		}
+		a := templateAttribute{name: name, typ: strings.ToLower(strings.TrimSpace(typ))}
+		if a.typ == "" {
+			a.typ = "text"
+		}
+		if !slices.Contains(attributeTypes, a.typ) {
+			return nil, fmt.Errorf("%d: unknown type %q, want one of: %s", n, a.typ, strings.Join(attributeTypes, ", "))
+		}
+		switch flag := strings.TrimSpace(flags); flag {
+		case "":
+		case "required":
+			a.required = true
+		default:
+			return nil, fmt.Errorf("%d: unknown option %q, want required", n, flag)
+		}
+
+		t := &templates[len(templates)-1]
+		if t.attribute(a.name) != nil {
+			return nil, fmt.Errorf("%d: attribute %q declared twice for %s", n, a.name, t.entityType)
+		}
+		t.attributes = append(t.attributes, a)
+	}
+	return templates, scanner.Err()
+}
+
+// templateFor returns the template for entityType, matched ignoring case,
+// or nil when it has none.
+func templateFor(templates []entityTemplate, entityType string) *entityTemplate {
+	for i := range templates {
+		if strings.EqualFold(templates[i].entityType, entityType) {
+			return &templates[i]
+		}
+	}
+	return nil
+}
+
+func (t *entityTemplate) attribute(name string) *templateAttribute {
+	if t == nil {
+		return nil
+	}
+	for i := range t.attributes {
+		if t.attributes[i].name == name {
+			return &t.attributes[i]
+		}
+	}
+	return nil
+}
+
+// missing returns the template's attributes not in have, required or all.
+func (t *entityTemplate) missing(have map[string]bool, requiredOnly bool) []templateAttribute {
+	if t == nil {
+		return nil
+	}
+	var out []templateAttribute
+	for _, a := range t.attributes {
+		if !have[a.name] && (a.required || !requiredOnly) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// attributeType is the type a value of attribute name gets: the one the
+// template declares, else the one given, else the one the value suggests.
+// A given type that contradicts the template is an error.
+func (t *entityTemplate) attributeType(name, given string, value any) (string, error) {
+	given = strings.ToLower(strings.TrimSpace(given))
+	a := t.attribute(name)
+	switch {
+	case a == nil && given != "":
+		return given, nil
+	case a == nil:
+		return inferAttributeType(value), nil
+	case given != "" && given != a.typ:
+		return "", fmt.Errorf("%s of a %s is a %s attribute, not %s", name, t.entityType, a.typ, given)
+	}
+	return a.typ, nil
+}
+
+// templatesHelp describes the templates for upsert_entity's attributes
+// parameter, so agents know what to fill in.
+func templatesHelp(templates []entityTemplate) string {
+	help := `Typed attributes to set, by name, e.g. {"birthday": "1990-04-12"}; see set_attribute`
+	if len(templates) == 0 {
+		return help
+	}
+	var b strings.Builder
+	b.WriteString(help + ". Entity types with a template, and their attributes:")
+	for _, t := range templates {
+		fmt.Fprintf(&b, "\n- %s: %s", t.entityType, attributeList(t.attributes))
+	}
+	return b.String()
+}
+
+func attributeList(attrs []templateAttribute) string {
+	s := make([]string, len(attrs))
+	for i, a := range attrs {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// attributeInput is an attribute given to upsert_entity, checked and in the
+// form it is stored in.
+type attributeInput struct {
+	name, typ string
+	value     any
+}
+
+// parseAttributesArg checks the attributes object passed to upsert_entity
+// against t, which may be nil, and returns them sorted by name.
+func parseAttributesArg(t *entityTemplate, arg any) ([]attributeInput, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	m, ok := arg.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf(`attributes must be an object of values by name, e.g. {"birthday": "1990-04-12"}`)
+	}
+	var out []attributeInput
+	seen := make(map[string]bool, len(m))
+	for raw, v := range m {
+		name, err := normalizeAttributeName(raw)
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("attribute %s given twice", name)
+		}
+		seen[name] = true
+		if v == nil {
+			return nil, fmt.Errorf("attribute %s has no value", name)
+		}
+		typ, err := t.attributeType(name, "", v)
+		if err != nil {
+			return nil, err
+		}
+		value, err := normalizeAttributeValue(typ, v)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %v", name, err)
+		}
+		out = append(out, attributeInput{name, typ, value})
+	}
+	slices.SortFunc(out, func(a, b attributeInput) int { return strings.Compare(a.name, b.name) })
+	return out, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseEntityTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []entityTemplate
+		wantErr string
+	}{
+		{
+			name: "templates",
+			input: `# what we record about things
+Person
+  birthday: date
+  Relationship: text, required
+
+Server:
+	ip address: IP, required
+	os
+`,
+			want: []entityTemplate{
+				{"Person", []templateAttribute{{"birthday", "date", false}, {"relationship", "text", true}}},
+				{"Server", []templateAttribute{{"ip_address", "ip", true}, {"os", "text", false}}},
+			},
+		},
+		{name: "no attributes", input: "Project\n", want: []entityTemplate{{entityType: "Project"}}},
+		{name: "duplicate type", input: "Person\nperson\n", wantErr: `2: entity type "person" declared twice`},
+		{name: "duplicate attribute", input: "Person\n  birthday: date\n  Birthday\n", wantErr: `3: attribute "birthday" declared twice for Person`},
+		{name: "unknown type", input: "Server\n  ip: address\n", wantErr: `2: unknown type "address"`},
+		{name: "unknown option", input: "Server\n  ip: ip, unique\n", wantErr: `2: unknown option "unique"`},
+		{name: "orphan attribute", input: "  birthday: date\n", wantErr: "1: attribute before any entity type"},
+		{name: "bad name", input: "Person\n  2nd name\n", wantErr: "2: invalid attribute name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEntityTemplates(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAttributesArg(t *testing.T) {
+	templates, err := parseEntityTemplates(strings.NewReader("Server\n  ip_address: ip, required\n  port: number\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := templateFor(templates, "server")
+
+	tests := []struct {
+		name    string
+		t       *entityTemplate
+		arg     any
+		want    []attributeInput
+		wantErr string
+	}{
+		{name: "none", t: server, arg: nil},
+		{
+			name: "template types",
+			t:    server,
+			arg:  map[string]any{"IP address": "10.0.0.5", "port": "8080", "rack": float64(3)},
+			want: []attributeInput{{"ip_address", "ip", "10.0.0.5"}, {"port", "number", int64(8080)}, {"rack", "number", int64(3)}},
+		},
+		{name: "no template", t: nil, arg: map[string]any{"port": "8080"}, want: []attributeInput{{"port", "text", "8080"}}},
+		{name: "invalid for template", t: server, arg: map[string]any{"ip_address": "nas.local"}, wantErr: "attribute ip_address: invalid ip value"},
+		{name: "same name twice", t: server, arg: map[string]any{"ip address": "10.0.0.5", "ip_address": "10.0.0.5"}, wantErr: "given twice"},
+		{name: "not an object", t: server, arg: "ip=10.0.0.5", wantErr: "attributes must be an object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAttributesArg(tt.t, tt.arg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := server.attributeType("port", "text", "8080"); err == nil || !strings.Contains(err.Error(), "port of a Server is a number attribute") {
+		t.Errorf("contradicting type: err = %v", err)
+	}
+}
+
+func TestEntityTemplates_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	defer func(v []entityTemplate) { entityTemplates = v }(entityTemplates)
+	var err error
+	entityTemplates, err = parseEntityTemplates(strings.NewReader("TemplateTestServer\n  ip_address: ip, required\n  os\n  role\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM entities WHERE name = 'template-test-nas'")
+
+	upsert := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		args["name"], args["entity_type"], args["tags"] = "template-test-nas", "TemplateTestServer", "homelab"
+		result, err := callTool(upsertEntityHandler(db), "upsert_entity", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if result := upsert(map[string]any{"attributes": map[string]any{"os": "Debian"}}); !result.IsError ||
+		!strings.Contains(result.Content[0].(mcp.TextContent).Text, "needs the attributes ip_address (ip, required)") {
+		t.Errorf("missing required attribute: %v", result.Content)
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM entities WHERE name = 'template-test-nas'").Scan(&n)
+	if n != 0 {
+		t.Fatal("entity created without its required attribute")
+	}
+
+	result := upsert(map[string]any{"attributes": map[string]any{"IP address": "192.168.1.20", "os": "Debian"}})
+	text := result.Content[0].(mcp.TextContent).Text
+	if result.IsError || !strings.Contains(text, "2 attribute(s) set") || !strings.Contains(text, "Not yet known for this TemplateTestServer: role (text)") {
+		t.Fatalf("create = %q", text)
+	}
+
+	if result, _ := callTool(setAttributeHandler(db), "set_attribute", map[string]any{
+		"entity": "template-test-nas", "name": "ip_address", "value": "192.168.1.21", "type": "text",
+	}); !result.IsError {
+		t.Error("set_attribute with a type contradicting the template: expected an error")
+	}
+
+	result, err = callTool(getProfileHandler(db), "get_profile", map[string]any{"entity": "template-test-nas"})
+	if err != nil || result.IsError {
+		t.Fatalf("get_profile: %v %v", err, result.Content)
+	}
+	var p profile
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Attributes) != 2 || p.Attributes[0].Type != "ip" || !reflect.DeepEqual(p.Missing, []string{"role (text)"}) {
+		t.Errorf("profile = %+v", p)
+	}
+
+	// An existing entity takes new attributes without the required check.
+	if result := upsert(map[string]any{"attributes": map[string]any{"role": "storage"}}); result.IsError ||
+		!strings.Contains(result.Content[0].(mcp.TextContent).Text, "already existed: template-test-nas, 1 attribute(s) set") {
+		t.Errorf("existing entity: %v", result.Content)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// An observation's parent_id names the observation it corrects or follows
+// up, making a thread of them. Recall shows only the latest item of each
+// thread unless history is asked for.
+
+// notSuperseded keeps observations, aliased o, that no follow-up the caller
+// can see has superseded: the latest items of threads, and observations in
+// none.
+const notSuperseded = "NOT EXISTS (SELECT 1 FROM observations f WHERE f.parent_id = o.id)"
+
+// latestInThreads maps each of ids the caller can see to the latest item of
+// its thread: itself when nothing follows it up, otherwise the newest
+// follow-up descended from it.
+func latestInThreads(ctx context.Context, q queryer, levels []string, ids []int64) (map[int64]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.QueryContext(ctx, restrictVisibility(`WITH RECURSIVE thread(root, id) AS (
+			SELECT id, id FROM observations WHERE id IN (`+placeholders(len(ids))+`)
+			UNION
+			SELECT t.root, o.id FROM thread t JOIN observations o ON o.parent_id = t.id
+		)
+		SELECT t.root, MAX(t.id) FROM thread t
+		WHERE NOT EXISTS (SELECT 1 FROM observations f WHERE f.parent_id = t.id)
+		GROUP BY t.root`, levels), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	latest := make(map[int64]int64, len(ids))
+	for rows.Next() {
+		var root, id int64
+		if err := rows.Scan(&root, &id); err != nil {
+			return nil, err
+		}
+		latest[root] = id
+	}
+	return latest, rows.Err()
+}
+
+// collapseThreads replaces each of the ranked ids with the latest item of
+// its thread, keeping the first place any item of a thread reached. The
+// latest item takes over the searches that matched the ones it replaced.
+// It returns the ids and how many were replaced.
+func collapseThreads(ids []int64, latest map[int64]int64, found map[int64][]string) ([]int64, int) {
+	seen := make(map[int64]bool, len(ids))
+	var out []int64
+	replaced := 0
+	for _, id := range ids {
+		l, ok := latest[id]
+		if !ok {
+			l = id
+		}
+		if l != id {
+			replaced++
+			for _, by := range found[id] {
+				if !slices.Contains(found[l], by) {
+					found[l] = append(found[l], by)
+				}
+			}
+		}
+		if !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	return out, replaced
+}
+
+// checkParent resolves the cite of the observation a new one follows up,
+// which must exist. No cite gives a NULL parent.
+func checkParent(ctx context.Context, db *sql.DB, cite string) (sql.NullInt64, error) {
+	if cite == "" {
+		return sql.NullInt64{}, nil
+	}
+	id, err := parseCitation(cite)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM observations WHERE id = ?", id).Scan(&n); err != nil {
+		return sql.NullInt64{}, errorf(codeDatabase, "error looking up parent %s: %v", citation(id), err)
+	}
+	if n == 0 {
+		return sql.NullInt64{}, errorf(codeNotFound, "parent observation %s does not exist", citation(id))
+	}
+	return sql.NullInt64{Int64: id, Valid: true}, nil
+}
+
+// registerThread adds the thread tool.
+func registerThread(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("thread",
+		mcp.WithDescription(`Show the history of an observation: every observation in its thread of corrections and follow-ups, oldest first, with which are the latest.
+
+Recall tools show only the latest item of a thread. Use this when the user asks what a fact used to be or how it changed. Start a thread by passing parent to add_observation.`),
+		mcp.WithString("observation",
+			mcp.Required(),
+			mcp.Description("Id or cite of any observation in the thread, e.g. 'obs:12'"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), threadHandler(db, scopes))
+}
+
+func threadHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, err := parseCitation(request.GetString("observation", ""))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		// Walk up to the first item the caller can see, then down through
+		// every follow-up of it.
+		cols, results, err := runQuery(ctx, db, restrictVisibility(`WITH RECURSIVE up(id, parent_id) AS (
+				SELECT id, parent_id FROM observations WHERE id = ?
+				UNION
+				SELECT o.id, o.parent_id FROM observations o JOIN up ON o.id = up.parent_id
+			), thread(id) AS (
+				SELECT id FROM up WHERE parent_id IS NULL OR parent_id NOT IN (SELECT id FROM observations)
+				UNION
+				SELECT o.id FROM observations o JOIN thread t ON o.parent_id = t.id
+			)
+			SELECT o.id, o.parent_id, e.name AS entity, o.content, o.source, o.created_at,
+				`+notSuperseded+` AS latest
+			FROM thread JOIN observations o ON o.id = thread.id JOIN entities e ON e.id = o.entity_id
+			ORDER BY o.created_at, o.id`, scopes.levels(ctx)), id)
+		if err != nil {
+			return toolErrorFrom(err, codeDatabase), nil
+		}
+		if len(results) == 0 {
+			return toolErrorf(codeNotFound, "observation %s does not exist", citation(id)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("thread of %s, oldest first; latest = 1 marks what recall shows\n%s", citation(id), formatRows(cols, results))), nil
+	}
+}
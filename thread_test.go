@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCollapseThreads(t *testing.T) {
+	// 3 follows up 1, and 7 follows up 5; 2 is in no thread.
+	latest := map[int64]int64{1: 3, 2: 2, 3: 3, 5: 7}
+	found := map[int64][]string{1: {"keyword"}, 2: {"keyword"}, 3: {"semantic"}, 5: {"keyword", "semantic"}}
+	ids, replaced := collapseThreads([]int64{1, 2, 3, 5}, latest, found)
+	if want := []int64{3, 2, 7}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("collapseThreads() = %v, want %v", ids, want)
+	}
+	if replaced != 2 {
+		t.Errorf("replaced = %d, want 2", replaced)
+	}
+	if want := []string{"semantic", "keyword"}; !reflect.DeepEqual(found[3], want) {
+		t.Errorf("found[3] = %v, want %v", found[3], want)
+	}
+	if want := []string{"keyword", "semantic"}; !reflect.DeepEqual(found[7], want) {
+		t.Errorf("found[7] = %v, want %v", found[7], want)
+	}
+}
+
+func TestThread_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM entities WHERE name = 'thread-test-nas'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('thread-test-nas', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	add := func(content, parent string) int64 {
+		t.Helper()
+		args := map[string]any{"entity": "thread-test-nas", "content": content, "tags": "homelab", "return_record": true}
+		if parent != "" {
+			args["parent"] = parent
+		}
+		result, err := callTool(addObservationHandler(db, nil), "add_observation", args)
+		if err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+		var record observationRecord
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &record); err != nil {
+			t.Fatal(err)
+		}
+		return record.ID
+	}
+	first := add("threadtest nas holds four spindles", "")
+	second := add("threadtest nas holds six spindles now", citation(first))
+
+	open := func(history bool) []graphObservation {
+		t.Helper()
+		result, err := callTool(openNodesHandler(db, nil), "open_nodes", map[string]any{"names": []any{"thread-test-nas"}, "include_history": history})
+		if err != nil || result.IsError {
+			t.Fatalf("open_nodes: %v %v", err, result.Content)
+		}
+		var opened openedNodes
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &opened); err != nil {
+			t.Fatal(err)
+		}
+		if len(opened.Entities) != 1 {
+			t.Fatalf("open_nodes = %+v", opened)
+		}
+		return opened.Entities[0].Details
+	}
+	if details := open(false); len(details) != 1 || details[0].ID != second || details[0].ParentID == nil || *details[0].ParentID != first {
+		t.Errorf("open_nodes = %+v, want only the follow-up", details)
+	}
+	if details := open(true); len(details) != 2 {
+		t.Errorf("open_nodes with history = %+v, want both", details)
+	}
+
+	// The first matches the question better, but the follow-up answers it.
+	result, err := callTool(askMemoryHandler(db, nil, nil, nil, nil), "ask_memory", map[string]any{"question": "threadtest four spindles"})
+	if err != nil || result.IsError {
+		t.Fatalf("ask_memory: %v %v", err, result.Content)
+	}
+	var asked askResult
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &asked); err != nil {
+		t.Fatal(err)
+	}
+	var followUp bool
+	for _, p := range asked.Passages {
+		if p.Cite == citation(first) {
+			t.Errorf("ask_memory returned the superseded item: %+v", asked.Passages)
+		}
+		followUp = followUp || p.Cite == citation(second) && p.Parent == citation(first)
+	}
+	if !followUp {
+		t.Errorf("ask_memory = %+v, want the follow-up in place of the first item", asked.Passages)
+	}
+
+	result, err = callTool(threadHandler(db, nil), "thread", map[string]any{"observation": citation(second)})
+	if err != nil || result.IsError {
+		t.Fatalf("thread: %v %v", err, result.Content)
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(text, "rows: 2") || strings.Index(text, "four spindles") > strings.Index(text, "six spindles") {
+		t.Errorf("thread = %q, want both items oldest first", text)
+	}
+
+	result, err = callTool(addObservationHandler(db, nil), "add_observation", map[string]any{"entity": "thread-test-nas", "content": "orphan", "tags": "homelab", "parent": "obs:999999999"})
+	if err != nil || !result.IsError {
+		t.Errorf("add_observation with a missing parent: expected error, got %v %v", err, result)
+	}
+}
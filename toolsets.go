@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// enabledTools, when set, is the tool set of clients without an entry in
+// clientTools. ENGRAM_CLIENT_TOOLS gives named MCP clients their own set, e.g.
+// "claude-ai=query,execute;team-bot=search_nodes,open_nodes,add_observation".
+// disabledTools are removed for everyone. The names are those clientName
+// returns: only an ENGRAM_MCP_KEYS key or an OIDC login vouches for one, so
+// without them the sets shape what each agent sees but keep none out.
+var (
+	enabledTools  = getEnv("ENGRAM_TOOLS", "")
+	disabledTools = getEnv("ENGRAM_DISABLED_TOOLS", "")
+	clientTools   = getEnv("ENGRAM_CLIENT_TOOLS", "")
+)
+
+type toolAccess struct {
+	defaults map[string]bool // nil allows every tool
+	disabled map[string]bool
+	clients  map[string]map[string]bool
+}
+
+func parseToolAccess(enabled, disabled, clients string) (*toolAccess, error) {
+	a := &toolAccess{
+		disabled: toolSet(disabled),
+		clients:  make(map[string]map[string]bool),
+	}
+	if strings.TrimSpace(enabled) != "" {
+		a.defaults = toolSet(enabled)
+	}
+
+	entries, err := parseClientEntries(clients, "tool")
+	if err != nil {
+		return nil, err
+	}
+	for name, list := range entries {
+		tools := toolSet(list)
+		if len(tools) == 0 {
+			return nil, fmt.Errorf("client %s: tool set must include at least one tool", name)
+		}
+		a.clients[name] = tools
+	}
+	return a, nil
+}
+
+func toolSet(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range parseTagNames(list) {
+		set[name] = true
+	}
+	return set
+}
+
+// validate rejects tool names that are not registered, so a typo does not
+// silently hide a tool or leave one exposed.
+func (a *toolAccess) validate(registered map[string]*server.ServerTool) error {
+	check := func(setting string, set map[string]bool) error {
+		var unknown []string
+		for name := range set {
+			if _, ok := registered[name]; !ok {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) == 0 {
+			return nil
+		}
+		sort.Strings(unknown)
+		return fmt.Errorf("%s: unknown tool(s) %s", setting, strings.Join(unknown, ", "))
+	}
+
+	if err := check("ENGRAM_TOOLS", a.defaults); err != nil {
+		return err
+	}
+	if err := check("ENGRAM_DISABLED_TOOLS", a.disabled); err != nil {
+		return err
+	}
+	for client, set := range a.clients {
+		if err := check("ENGRAM_CLIENT_TOOLS "+client, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowed reports whether the calling client may see and call the tool.
+// Disabled tools are off for everyone; otherwise the client's own set, then
+// the default set, decide.
+func (a *toolAccess) allowed(ctx context.Context, tool string) bool {
+	if a.disabled[tool] {
+		return false
+	}
+	if name, ok := clientName(ctx); ok {
+		if tools, ok := a.clients[name]; ok {
+			return tools[tool]
+		}
+	}
+	return a.defaults == nil || a.defaults[tool]
+}
+
+// filter hides tools the client may not call from tools/list.
+func (a *toolAccess) filter(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	var visible []mcp.Tool
+	for _, t := range tools {
+		if a.allowed(ctx, t.Name) {
+			visible = append(visible, t)
+		}
+	}
+	return visible
+}
+
+// middleware rejects calls to hidden tools, for clients that call a tool
+// without listing first.
+func (a *toolAccess) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !a.allowed(ctx, request.Params.Name) {
+			return toolErrorf(codeToolDisabled, "tool %s is not enabled for this client", request.Params.Name), nil
+		}
+		return next(ctx, request)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type clientSession struct {
+	testSession
+	info mcp.Implementation
+}
+
+func (s *clientSession) GetClientInfo() mcp.Implementation     { return s.info }
+func (s *clientSession) SetClientInfo(info mcp.Implementation) { s.info = info }
+func (s *clientSession) GetClientCapabilities() mcp.ClientCapabilities {
+	return mcp.ClientCapabilities{}
+}
+func (s *clientSession) SetClientCapabilities(_ mcp.ClientCapabilities) {}
+
+func clientContext(name string) context.Context {
+	session := &clientSession{testSession: testSession{id: name}, info: mcp.Implementation{Name: name}}
+	return server.NewMCPServer("test", "0.0.0").WithContext(context.Background(), session)
+}
+
+func TestToolAccess(t *testing.T) {
+	a, err := parseToolAccess("query,search_nodes", "execute", "admin=query,execute,add_observation")
+	if err != nil {
+		t.Fatalf("parseToolAccess: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		tool string
+		want bool
+	}{
+		{"default set allows listed tool", context.Background(), "query", true},
+		{"default set hides unlisted tool", context.Background(), "add_observation", false},
+		{"unknown client uses default set", clientContext("other"), "search_nodes", true},
+		{"client set allows its tool", clientContext("admin"), "add_observation", true},
+		{"client set replaces default set", clientContext("admin"), "search_nodes", false},
+		{"disabled wins over client set", clientContext("admin"), "execute", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.allowed(tt.ctx, tt.tool); got != tt.want {
+				t.Errorf("allowed(%s) = %v, want %v", tt.tool, got, tt.want)
+			}
+		})
+	}
+
+	tools := a.filter(clientContext("admin"), []mcp.Tool{{Name: "query"}, {Name: "execute"}, {Name: "read_graph"}})
+	if len(tools) != 1 || tools[0].Name != "query" {
+		t.Errorf("filter = %v, want only query", tools)
+	}
+
+	called := false
+	handler := a.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = true
+		return mcp.NewToolResultText("ok"), nil
+	})
+	req := mcpToolRequest(nil)
+	req.Params.Name = "add_observation"
+	result, err := handler(context.Background(), req)
+	if err != nil || !result.IsError || called {
+		t.Errorf("expected hidden tool call rejected, got %v %v called=%v", result, err, called)
+	}
+}
+
+func TestToolAccessAllowsAllByDefault(t *testing.T) {
+	a, err := parseToolAccess("", "", "")
+	if err != nil {
+		t.Fatalf("parseToolAccess: %v", err)
+	}
+	if !a.allowed(clientContext("anyone"), "execute") {
+		t.Error("expected every tool allowed without config")
+	}
+}
+
+func TestToolAccessValidate(t *testing.T) {
+	registered := map[string]*server.ServerTool{"query": {}, "execute": {}}
+
+	tests := []struct {
+		name                       string
+		enabled, disabled, clients string
+		wantErr                    bool
+	}{
+		{"known tools", "query", "execute", "bot=query", false},
+		{"unknown default tool", "qeury", "", "", true},
+		{"unknown disabled tool", "", "exec", "", true},
+		{"unknown client tool", "", "", "bot=search", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := parseToolAccess(tt.enabled, tt.disabled, tt.clients)
+			if err != nil {
+				t.Fatalf("parseToolAccess: %v", err)
+			}
+			if err := a.validate(registered); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := parseToolAccess("", "", "bot"); err == nil {
+		t.Error("expected error for entry without tools")
+	}
+}
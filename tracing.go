@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// tracing exports a span for every tool call, its validation and search
+// stages and each database statement to the OTLP/HTTP collector at
+// OTEL_EXPORTER_OTLP_ENDPOINT (Tempo, Jaeger, an OpenTelemetry Collector),
+// as OTLP JSON. It is nil, and every span a no-op, when that is unset.
+var tracing = newTracer(
+	getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+	getEnv("OTEL_EXPORTER_OTLP_HEADERS", ""),
+	getEnv("OTEL_SERVICE_NAME", "memory-mcp"),
+)
+
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	// traceBatch is how many finished spans are sent in one request.
+	traceBatch = 512
+	// maxPendingSpans bounds the spans held while the collector is
+	// unreachable; older ones are dropped.
+	maxPendingSpans = 8192
+	// maxStatementAttr truncates db.statement attributes.
+	maxStatementAttr = 1000
+)
+
+type tracer struct {
+	url     string
+	headers map[string]string
+	service string
+	client  *http.Client
+
+	mu      sync.Mutex
+	pending []*span
+	dropped int
+}
+
+// newTracer returns nil when endpoint is empty. headers is a comma-separated
+// list of key=value pairs sent with every export, e.g. an auth token.
+func newTracer(endpoint, headers, service string) *tracer {
+	if endpoint == "" {
+		return nil
+	}
+	t := &tracer{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		headers: make(map[string]string),
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, h := range strings.Split(headers, ",") {
+		if k, v, ok := strings.Cut(h, "="); ok {
+			t.headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return t
+}
+
+// span is one timed operation. A nil span, from a nil tracer, ignores every
+// call.
+type span struct {
+	tracer   *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs map[string]any
+	err   string
+}
+
+type spanKey struct{}
+
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
+
+// startSpan starts a span named name as a child of the span in ctx, or of
+// nothing, and returns a context carrying it. Finish it with finish.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	return tracing.start(ctx, name, kind)
+}
+
+func (t *tracer) start(ctx context.Context, name string, kind int) (context.Context, *span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: make(map[string]any)}
+	if parent := spanFromContext(ctx); parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *span) set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// fail marks the span as failed with err's message.
+func (s *span) fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// finish ends the span and queues it for export. Later calls do nothing.
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	t := s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) >= maxPendingSpans {
+		t.pending = t.pending[1:]
+		t.dropped++
+	}
+	t.pending = append(t.pending, s)
+}
+
+// otlpAttributes encodes attributes as OTLP JSON key-value pairs.
+func otlpAttributes(attrs map[string]any) []map[string]any {
+	out := make([]map[string]any, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]any{"key": k, "value": value})
+	}
+	return out
+}
+
+// otlpRequest builds an OTLP/JSON ExportTraceServiceRequest for spans.
+func (t *tracer) otlpRequest(spans []*span) map[string]any {
+	encoded := make([]map[string]any, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		e := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			e["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != "" {
+			e["status"] = map[string]any{"code": 2, "message": s.err}
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, e)
+	}
+	return map[string]any{"resourceSpans": []map[string]any{{
+		"resource":   map[string]any{"attributes": otlpAttributes(map[string]any{"service.name": t.service})},
+		"scopeSpans": []map[string]any{{"scope": map[string]any{"name": "memory-mcp"}, "spans": encoded}},
+	}}}
+}
+
+// flush sends the finished spans, a batch at a time. Spans of a batch the
+// collector refuses are dropped rather than retried.
+func (t *tracer) flush(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		n := min(len(t.pending), traceBatch)
+		batch := t.pending[:n]
+		t.pending = t.pending[n:]
+		dropped := t.dropped
+		t.dropped = 0
+		t.mu.Unlock()
+		if dropped > 0 {
+			log.Printf("tracing: dropped %d spans the collector did not take in time", dropped)
+		}
+		if n == 0 {
+			return nil
+		}
+
+		body, err := json.Marshal(t.otlpRequest(batch))
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range t.headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("export %d spans: %v", n, err)
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("export %d spans: %s: %s", n, resp.Status, bytes.TrimSpace(msg))
+		}
+	}
+}
+
+// exportPeriodically flushes every interval until ctx ends.
+func (t *tracer) exportPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.flush(ctx); err != nil {
+				log.Printf("tracing: %v", err)
+			}
+		}
+	}
+}
+
+// shutdown sends the spans still queued, giving up after a few seconds so
+// an unreachable collector does not hold up exit.
+func (t *tracer) shutdown() {
+	if t == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t.flush(ctx); err != nil {
+		log.Printf("tracing: %v", err)
+	}
+}
+
+// middleware wraps each tool call in a server span named after the tool.
+// Results with IsError set mark the span failed with their text.
+func (t *tracer) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, s := t.start(ctx, "tools/call "+request.Params.Name, spanKindServer)
+		defer s.finish()
+		s.set("mcp.tool.name", request.Params.Name)
+		if name, ok := clientName(ctx); ok {
+			s.set("mcp.client", name)
+		}
+		result, err := next(ctx, request)
+		s.fail(err)
+		if result != nil && result.IsError {
+			s.fail(fmt.Errorf("%.200s", resultText(result)))
+		}
+		return result, err
+	}
+}
+
+// stage traces the time mw spends before handing the call on, such as
+// access or secret checks, as its own span under the call's.
+func (t *tracer) stage(name string, mw server.ToolHandlerMiddleware) server.ToolHandlerMiddleware {
+	if t == nil {
+		return mw
+	}
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			parent := spanFromContext(ctx)
+			ctx, s := t.start(ctx, name, spanKindInternal)
+			defer s.finish()
+			return mw(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				s.finish()
+				return next(context.WithValue(ctx, spanKey{}, parent), request)
+			})(ctx, request)
+		}
+	}
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	var parts []string
+	for _, c := range result.Content {
+		if text, ok := c.(mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// statementSpan starts a client span for a database statement.
+func statementSpan(ctx context.Context, op, query string) (context.Context, *span) {
+	ctx, s := startSpan(ctx, "db "+op, spanKindClient)
+	if s != nil {
+		query = normalizeSQL(query)
+		if len(query) > maxStatementAttr {
+			query = query[:maxStatementAttr] + "..."
+		}
+		s.set("db.system", "sqlite")
+		s.set("db.statement", query)
+	}
+	return ctx, s
+}
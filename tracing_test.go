@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type otlpSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Attributes   []struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	} `json:"attributes"`
+	Status *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+func TestTracer(t *testing.T) {
+	var spans []otlpSpan
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		spans = append(spans, body.ResourceSpans[0].ScopeSpans[0].Spans...)
+	}))
+	defer collector.Close()
+
+	tr := newTracer(collector.URL+"/", "Authorization=Bearer secret", "memory-test")
+	saved := tracing
+	tracing = tr
+	defer func() { tracing = saved }()
+
+	deny := func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if request.Params.Name == "execute" {
+				return mcp.NewToolResultError("execute is disabled"), nil
+			}
+			return next(ctx, request)
+		}
+	}
+	handler := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		_, s := statementSpan(ctx, "query", "SELECT  id\n FROM tags")
+		s.fail(errors.New("no such table"))
+		s.finish()
+		return mcp.NewToolResultText("ok"), nil
+	}
+	call := tr.middleware(tr.stage("check access", deny)(handler))
+	for _, name := range []string{"query", "execute"} {
+		request := mcp.CallToolRequest{}
+		request.Params.Name = name
+		if _, err := call(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	if auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	byName := make(map[string][]otlpSpan)
+	for _, s := range spans {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	query, stages, db := byName["tools/call query"], byName["check access"], byName["db query"]
+	if len(query) != 1 || len(stages) != 2 || len(db) != 1 || len(byName["tools/call execute"]) != 1 {
+		t.Fatalf("spans = %+v", spans)
+	}
+	if query[0].Kind != spanKindServer || query[0].ParentSpanID != "" || query[0].Status != nil {
+		t.Errorf("tool span = %+v", query[0])
+	}
+	// The statement runs after the access check, so it hangs off the call.
+	if db[0].ParentSpanID != query[0].SpanID || db[0].TraceID != query[0].TraceID {
+		t.Errorf("db span parent = %s, want the tool span %s", db[0].ParentSpanID, query[0].SpanID)
+	}
+	if db[0].Status == nil || db[0].Status.Message != "no such table" {
+		t.Errorf("db span = %+v", db[0])
+	}
+	for _, a := range db[0].Attributes {
+		if a.Key == "db.statement" && a.Value["stringValue"] != "SELECT id FROM tags" {
+			t.Errorf("db.statement = %v", a.Value)
+		}
+	}
+	if denied := byName["tools/call execute"][0]; denied.Status == nil || denied.Status.Message != "execute is disabled" {
+		t.Errorf("denied call span = %+v", denied)
+	}
+
+	if err := tr.flush(context.Background()); err != nil || len(spans) != 5 {
+		t.Errorf("second flush = %v, %d spans, want nothing resent", err, len(spans))
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tr *tracer
+	ctx, s := tr.start(context.Background(), "x", spanKindInternal)
+	s.set("k", 1)
+	s.fail(errors.New("x"))
+	s.finish()
+	if spanFromContext(ctx) != nil {
+		t.Error("nil tracer put a span in the context")
+	}
+	mw := func(next server.ToolHandlerFunc) server.ToolHandlerFunc { return next }
+	if tr.stage("x", mw) == nil {
+		t.Error("nil tracer dropped the middleware")
+	}
+	tr.shutdown()
+}
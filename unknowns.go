@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// registerResolve adds the resolve tool.
+func registerResolve(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("resolve",
+		mcp.WithDescription(`Answer an open question from the unknowns table, storing the answer as an observation.
+
+Open questions are recorded with the execute tool:
+  INSERT INTO unknowns (entity_id, question) VALUES (1, 'When is their birthday?')
+
+List open questions with:
+  SELECT id, entity_id, question FROM unknowns WHERE resolved_at IS NULL
+
+Once the answer is known, call resolve with the unknown's id. The answer becomes an observation on the same entity and the unknown is marked resolved.`),
+		mcp.WithNumber("id",
+			mcp.Required(),
+			mcp.Description("ID of the unknown to resolve"),
+		),
+		mcp.WithString("answer",
+			mcp.Required(),
+			mcp.Description("Observation content answering the question, e.g. 'Birthday is 12 March'"),
+		),
+		mcp.WithString("tags",
+			mcp.Required(),
+			mcp.Description("Comma-separated tag names for the new observation, e.g. 'personal'"),
+		),
+	), resolveHandler(db))
+}
+
+func resolveHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id := int64(request.GetInt("id", 0))
+		if id <= 0 {
+			return toolError(codeInvalidArgument, "id parameter is required"), nil
+		}
+
+		answer := request.GetString("answer", "")
+		if strings.TrimSpace(answer) == "" {
+			return toolError(codeInvalidArgument, "answer parameter is required"), nil
+		}
+
+		tagsStr := request.GetString("tags", "")
+		if strings.TrimSpace(tagsStr) == "" && requiredTags.requires("observations") {
+			return toolError(codeTagRequired, "tags parameter is required, the answer is stored as an observation. Query 'SELECT name, description FROM tags' to see all available tags."), nil
+		}
+
+		// The answer and the resolution commit together, and the update only
+		// takes an unknown that is still open, so two concurrent answers
+		// cannot both resolve it.
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		var entityID int64
+		var resolvedAt sql.NullString
+		var observationID sql.NullInt64
+		err = tx.QueryRowContext(ctx, "SELECT entity_id, resolved_at, observation_id FROM unknowns WHERE id = ?", id).Scan(&entityID, &resolvedAt, &observationID)
+		if err == sql.ErrNoRows {
+			return toolErrorf(codeNotFound, "unknown %d does not exist", id), nil
+		} else if err != nil {
+			return toolErrorf(errorCode(err, codeInvalidSQL), "query error: %v", err), nil
+		}
+		if resolvedAt.Valid {
+			return alreadyResolved(id, observationID), nil
+		}
+
+		tagIDs, err := validateTagsFor(ctx, db, "observations", parseTagNames(tagsStr))
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+		if err := checkTagQuotas(ctx, tx, tagIDs, len(answer)); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		result, err := tx.ExecContext(ctx, "INSERT INTO observations (entity_id, content) VALUES (?, ?)", entityID, normalizeText(answer))
+		if err != nil {
+			return execError(err, codeDatabase), nil
+		}
+		newID, _ := result.LastInsertId()
+
+		if err := linkTags(ctx, tx, newID, tagIDs); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to link tags: %v", err), nil
+		}
+
+		result, err = tx.ExecContext(ctx, "UPDATE unknowns SET resolved_at = CURRENT_TIMESTAMP, observation_id = ? WHERE id = ? AND resolved_at IS NULL", newID, id)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to mark unknown resolved: %v", err), nil
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to mark unknown resolved: %v", err), nil
+		} else if n == 0 {
+			if err := db.QueryRowContext(ctx, "SELECT observation_id FROM unknowns WHERE id = ?", id).Scan(&observationID); err != nil {
+				observationID = sql.NullInt64{}
+			}
+			return alreadyResolved(id, observationID), nil
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("success: unknown %d resolved as observation %d with %s", id, newID, tagList(tagsStr))), nil
+	}
+}
+
+// alreadyResolved is the error for resolving an unknown that has
+// resolved_at set, which may have been closed without an observation.
+func alreadyResolved(id int64, observationID sql.NullInt64) *mcp.CallToolResult {
+	if observationID.Valid {
+		return toolErrorf(codeConflict, "unknown %d is already resolved by observation %d", id, observationID.Int64)
+	}
+	return toolErrorf(codeConflict, "unknown %d is already resolved", id)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func callResolve(db *sql.DB, args map[string]any) (*mcp.CallToolResult, error) {
+	handler := resolveHandler(db)
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "resolve"
+	req.Params.Arguments = args
+	return handler(context.Background(), req)
+}
+
+func TestResolveHandler_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	result, err := callExecute(db, "INSERT INTO unknowns (entity_id, question) VALUES (1, 'unknown test question 24680')")
+	if err != nil || result.IsError {
+		t.Fatalf("insert unknown failed: %v %v", err, result)
+	}
+	var id int64
+	if err := db.QueryRow("SELECT id FROM unknowns WHERE question = 'unknown test question 24680'").Scan(&id); err != nil {
+		t.Fatalf("lookup unknown: %v", err)
+	}
+	defer callExecute(db, "DELETE FROM observations WHERE content = 'unknown test answer 24680'")
+	defer callExecute(db, "DELETE FROM unknowns WHERE question = 'unknown test question 24680'")
+
+	t.Run("missing tags fails", func(t *testing.T) {
+		result, err := callResolve(db, map[string]any{"id": float64(id), "answer": "unknown test answer 24680"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error when resolving without tags")
+		}
+	})
+
+	t.Run("nonexistent unknown fails", func(t *testing.T) {
+		result, err := callResolve(db, map[string]any{"id": 999999999, "answer": "x", "tags": "personal"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error for nonexistent unknown")
+		}
+	})
+
+	t.Run("resolve creates observation", func(t *testing.T) {
+		result, err := callResolve(db, map[string]any{"id": float64(id), "answer": "unknown test answer 24680", "tags": "homelab"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("resolve failed: %v", result.Content)
+		}
+
+		var observationID sql.NullInt64
+		var resolvedAt sql.NullString
+		if err := db.QueryRow("SELECT observation_id, resolved_at FROM unknowns WHERE id = ?", id).Scan(&observationID, &resolvedAt); err != nil {
+			t.Fatalf("lookup unknown: %v", err)
+		}
+		if !observationID.Valid || !resolvedAt.Valid {
+			t.Fatalf("unknown not marked resolved: observation_id=%v resolved_at=%v", observationID, resolvedAt)
+		}
+	})
+
+	t.Run("resolve twice fails", func(t *testing.T) {
+		result, err := callResolve(db, map[string]any{"id": float64(id), "answer": "unknown test answer 24680", "tags": "homelab"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error when resolving an already resolved unknown")
+		}
+	})
+
+	t.Run("closed without an answer fails", func(t *testing.T) {
+		if _, err := db.Exec("INSERT INTO unknowns (entity_id, question, resolved_at) VALUES (1, 'unknown test question 13579', CURRENT_TIMESTAMP)"); err != nil {
+			t.Fatalf("insert unknown: %v", err)
+		}
+		defer db.Exec("DELETE FROM unknowns WHERE question = 'unknown test question 13579'")
+		var closed int64
+		if err := db.QueryRow("SELECT id FROM unknowns WHERE question = 'unknown test question 13579'").Scan(&closed); err != nil {
+			t.Fatalf("lookup unknown: %v", err)
+		}
+		result, err := callResolve(db, map[string]any{"id": float64(closed), "answer": "unknown test answer 24680", "tags": "homelab"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Fatal("expected error when resolving an unknown closed without an observation")
+		}
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM unknowns WHERE id = ? AND observation_id IS NULL", closed).Scan(&n); err != nil || n != 1 {
+			t.Errorf("closed unknown changed: %d, %v", n, err)
+		}
+	})
+}
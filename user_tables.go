@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// defineTables registers the define_table tool, which lets clients add
+// their own tables (recipes, servers) built from vetted templates. The
+// execute tool still blocks every CREATE, ALTER and DROP.
+var defineTables = getEnv("ENGRAM_DEFINE_TABLES", "") == "true"
+
+var userTableName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// userColumnTypes maps the column types define_table offers to their
+// column definitions; %s is the column name.
+var userColumnTypes = map[string]string{
+	"text":      "TEXT",
+	"integer":   "INTEGER",
+	"real":      "REAL",
+	"boolean":   "INTEGER CHECK (%s IN (0, 1))",
+	"timestamp": "TIMESTAMP",
+	"json":      "TEXT CHECK (%s IS NULL OR json_valid(%s))",
+	"entity":    "INTEGER REFERENCES entities(id) ON DELETE CASCADE",
+}
+
+// userColumn is one column of a user-defined table as define_table takes
+// it and user_tables stores it.
+type userColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required,omitempty"`
+	Unique      bool   `json:"unique,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// definition returns the column's definition in CREATE TABLE or ADD COLUMN.
+func (c userColumn) definition() string {
+	def := c.Name + " " + strings.ReplaceAll(userColumnTypes[c.Type], "%s", c.Name)
+	if c.Required {
+		def += " NOT NULL"
+	}
+	if c.Unique {
+		def += " UNIQUE"
+	}
+	return def
+}
+
+func validateUserColumns(columns []userColumn) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("columns must list at least one column")
+	}
+	seen := make(map[string]bool)
+	for _, c := range columns {
+		if !userTableName.MatchString(c.Name) {
+			return fmt.Errorf("invalid column name %q: use lowercase letters, digits and underscores, starting with a letter", c.Name)
+		}
+		if c.Name == "id" || c.Name == "created_at" {
+			return fmt.Errorf("column %s is added to every table, leave it out", c.Name)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("column %s is listed twice", c.Name)
+		}
+		seen[c.Name] = true
+		if _, ok := userColumnTypes[c.Type]; !ok {
+			return fmt.Errorf("column %s: unknown type %q, want one of: text, integer, real, boolean, timestamp, json, entity", c.Name, c.Type)
+		}
+	}
+	return nil
+}
+
+// defineTableStatements returns the statements that create table, or that
+// evolve it when existing holds its current columns: new columns are
+// added, while changing or dropping existing ones is refused. The triggers
+// (re)create the change log triggers over every column.
+func defineTableStatements(table string, columns, existing []userColumn) (ddl, triggers []string, err error) {
+	names := []string{"id"}
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	names = append(names, "created_at")
+
+	if existing == nil {
+		defs := []string{"id INTEGER PRIMARY KEY AUTOINCREMENT"}
+		for _, c := range columns {
+			defs = append(defs, c.definition())
+		}
+		defs = append(defs, "created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP")
+		ddl = append(ddl, fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", table, strings.Join(defs, ",\n\t")))
+	} else {
+		current := make(map[string]userColumn)
+		for _, c := range existing {
+			current[c.Name] = c
+		}
+		listed := make(map[string]bool)
+		for _, c := range columns {
+			listed[c.Name] = true
+			old, ok := current[c.Name]
+			if ok {
+				if old.Type != c.Type || old.Required != c.Required || old.Unique != c.Unique {
+					return nil, nil, fmt.Errorf("column %s is already %s; existing columns cannot be changed", c.Name, old.definition())
+				}
+				continue
+			}
+			if c.Required || c.Unique {
+				return nil, nil, fmt.Errorf("column %s: columns added to an existing table cannot be required or unique", c.Name)
+			}
+			ddl = append(ddl, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, c.definition()))
+		}
+		for _, c := range existing {
+			if !listed[c.Name] {
+				return nil, nil, fmt.Errorf("column %s is missing; columns cannot be dropped, list every existing column", c.Name)
+			}
+		}
+		for _, op := range []string{"insert", "update", "delete"} {
+			triggers = append(triggers, fmt.Sprintf("DROP TRIGGER IF EXISTS changes_%s_%s", table, op))
+		}
+	}
+	for _, c := range columns {
+		if c.Type == "entity" && !slices.ContainsFunc(existing, func(e userColumn) bool { return e.Name == c.Name }) {
+			ddl = append(ddl, fmt.Sprintf("CREATE INDEX %s_%s ON %s (%s)", table, c.Name, table, c.Name))
+		}
+	}
+	return ddl, append(triggers, changeTriggers(table, "id", names...)...), nil
+}
+
+// userTableColumns returns the columns of the user-defined table, or nil
+// with ok false when table is not one.
+func userTableColumns(ctx context.Context, q queryer, table string) ([]userColumn, bool, error) {
+	rows, err := q.QueryContext(ctx, "SELECT columns FROM user_tables WHERE name = ?", table)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, false, rows.Err()
+	}
+	var raw string
+	if err := rows.Scan(&raw); err != nil {
+		return nil, false, err
+	}
+	var columns []userColumn
+	if err := json.Unmarshal([]byte(raw), &columns); err != nil {
+		return nil, false, fmt.Errorf("user_tables %s: %v", table, err)
+	}
+	return columns, true, nil
+}
+
+// registerDefineTable adds the define_table tool.
+func registerDefineTable(s *server.MCPServer, db *sql.DB) {
+	s.AddTool(mcp.NewTool("define_table",
+		mcp.WithDescription(`Create a table for structured data that does not fit observations, such as recipes or servers, or add columns to one created earlier.
+
+The table gets an id primary key and created_at, plus the columns given. Column types: text, integer, real, boolean, timestamp, json (validated) and entity (an entities id; rows go when the entity is deleted). Writes are logged like the built-in tables, and memory://schema lists the table. Existing columns cannot be changed or dropped; columns added later cannot be required or unique. Use dry_run first to see the SQL, and ask the user before creating a table.`),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Table name: lowercase letters, digits and underscores, e.g. 'recipes'"),
+		),
+		mcp.WithString("description",
+			mcp.Required(),
+			mcp.Description("What the table holds, shown in memory://schema"),
+		),
+		mcp.WithArray("columns",
+			mcp.Required(),
+			mcp.Description("Every column but id and created_at; to add columns, list the existing ones too"),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name":        map[string]any{"type": "string", "description": "Column name"},
+					"type":        map[string]any{"type": "string", "enum": []string{"text", "integer", "real", "boolean", "timestamp", "json", "entity"}},
+					"required":    map[string]any{"type": "boolean", "description": "NOT NULL"},
+					"unique":      map[string]any{"type": "boolean", "description": "No two rows may share a value"},
+					"description": map[string]any{"type": "string", "description": "What the column holds"},
+				},
+				"required": []string{"name", "type"},
+			}),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Return the SQL without running it"),
+		),
+	), defineTableHandler(db))
+}
+
+func defineTableHandler(db *sql.DB) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var args struct {
+			Name        string       `json:"name"`
+			Description string       `json:"description"`
+			Columns     []userColumn `json:"columns"`
+			DryRun      bool         `json:"dry_run"`
+		}
+		if err := request.BindArguments(&args); err != nil {
+			return toolErrorf(codeInvalidArgument, "invalid arguments: %v", err), nil
+		}
+		if !userTableName.MatchString(args.Name) || strings.HasPrefix(args.Name, "sqlite_") {
+			return toolErrorf(codeInvalidArgument, "invalid table name %q: use lowercase letters, digits and underscores, starting with a letter", args.Name), nil
+		}
+		if strings.TrimSpace(args.Description) == "" {
+			return toolError(codeInvalidArgument, "description is required: say what the table holds, it is shown in memory://schema"), nil
+		}
+		if err := validateUserColumns(args.Columns); err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		existing, ok, err := userTableColumns(ctx, tx, args.Name)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to read user_tables: %v", err), nil
+		}
+		if !ok {
+			var n int
+			if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE name = ?", args.Name).Scan(&n); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to check the schema: %v", err), nil
+			}
+			if n > 0 {
+				return toolErrorf(codeInvalidArgument, "%s is part of the built-in schema and cannot be redefined; pick another name", args.Name), nil
+			}
+		}
+		ddl, triggers, err := defineTableStatements(args.Name, args.Columns, existing)
+		if err != nil {
+			return toolErrorFrom(err, codeInvalidArgument), nil
+		}
+
+		var text string
+		switch {
+		case !ok:
+			text = fmt.Sprintf("created table %s:\n\n%s;\n", args.Name, strings.Join(ddl, ";\n"))
+		case len(ddl) > 0:
+			text = fmt.Sprintf("updated table %s:\n\n%s;\n", args.Name, strings.Join(ddl, ";\n"))
+		default:
+			text = fmt.Sprintf("updated the description of table %s\n", args.Name)
+		}
+		if args.DryRun {
+			return mcp.NewToolResultText("dry run, nothing changed. Would have " + text), nil
+		}
+
+		for _, stmt := range append(ddl, triggers...) {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to define %s: %v", args.Name, err), nil
+			}
+		}
+		columns, _ := json.Marshal(args.Columns)
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_tables (name, description, columns) VALUES (?, ?, ?)
+			ON CONFLICT(name) DO UPDATE SET description = excluded.description, columns = excluded.columns, updated_at = CURRENT_TIMESTAMP`,
+			args.Name, args.Description, string(columns)); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to record %s: %v", args.Name, err), nil
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+		return mcp.NewToolResultText(text + "\nWrite to it with execute and read it with query."), nil
+	}
+}
+
+// userTablesSchema describes the user-defined tables for memory://schema.
+func userTablesSchema(ctx context.Context, db *sql.DB) (string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, description, columns FROM user_tables ORDER BY name")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var b strings.Builder
+	for rows.Next() {
+		var name, description, raw string
+		if err := rows.Scan(&name, &description, &raw); err != nil {
+			return "", err
+		}
+		var columns []userColumn
+		if err := json.Unmarshal([]byte(raw), &columns); err != nil {
+			return "", fmt.Errorf("user_tables %s: %v", name, err)
+		}
+		names := []string{"id"}
+		for _, c := range columns {
+			names = append(names, c.Name)
+		}
+		fmt.Fprintf(&b, "%s (%s, created_at) -- %s\n", name, strings.Join(names, ", "), description)
+		for _, c := range columns {
+			fmt.Fprintf(&b, "  %s %s", c.Name, c.Type)
+			if c.Type == "entity" {
+				b.WriteString(", an entities id")
+			}
+			if c.Required {
+				b.WriteString(", required")
+			}
+			if c.Unique {
+				b.WriteString(", unique")
+			}
+			if c.Description != "" {
+				b.WriteString(": " + c.Description)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if err := rows.Err(); err != nil || b.Len() == 0 {
+		return "", err
+	}
+	return "\nUser-defined tables, added with define_table:\n\n" + b.String(), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestValidateUserColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []userColumn
+		wantErr string
+	}{
+		{"valid", []userColumn{{Name: "title", Type: "text", Required: true}, {Name: "entity_id", Type: "entity"}}, ""},
+		{"none", nil, "at least one column"},
+		{"bad name", []userColumn{{Name: "Title; DROP", Type: "text"}}, "invalid column name"},
+		{"reserved", []userColumn{{Name: "id", Type: "integer"}}, "added to every table"},
+		{"duplicate", []userColumn{{Name: "a", Type: "text"}, {Name: "a", Type: "real"}}, "listed twice"},
+		{"bad type", []userColumn{{Name: "a", Type: "varchar(10)"}}, "unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUserColumns(tt.columns)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("validateUserColumns() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefineTableStatements(t *testing.T) {
+	columns := []userColumn{{Name: "title", Type: "text", Required: true, Unique: true}, {Name: "entity_id", Type: "entity"}, {Name: "vegan", Type: "boolean"}}
+	ddl, triggers, err := defineTableStatements("recipes", columns, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	want := "CREATE TABLE recipes (\n\tid INTEGER PRIMARY KEY AUTOINCREMENT,\n\ttitle TEXT NOT NULL UNIQUE,\n\tentity_id INTEGER REFERENCES entities(id) ON DELETE CASCADE,\n\tvegan INTEGER CHECK (vegan IN (0, 1)),\n\tcreated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP\n)"
+	if len(ddl) != 2 || ddl[0] != want || ddl[1] != "CREATE INDEX recipes_entity_id ON recipes (entity_id)" {
+		t.Errorf("ddl = %q", ddl)
+	}
+	if len(triggers) != 3 || !strings.Contains(triggers[0], "'vegan', NEW.vegan, 'created_at', NEW.created_at") {
+		t.Errorf("triggers = %q", triggers)
+	}
+
+	evolved := append(append([]userColumn{}, columns...), userColumn{Name: "cuisine", Type: "text"})
+	ddl, triggers, err = defineTableStatements("recipes", evolved, columns)
+	if err != nil {
+		t.Fatalf("evolve: %v", err)
+	}
+	if len(ddl) != 1 || ddl[0] != "ALTER TABLE recipes ADD COLUMN cuisine TEXT" {
+		t.Errorf("evolve ddl = %q", ddl)
+	}
+	if len(triggers) != 6 || !strings.HasPrefix(triggers[0], "DROP TRIGGER IF EXISTS changes_recipes_insert") || !strings.Contains(triggers[3], "NEW.cuisine") {
+		t.Errorf("evolve triggers = %q", triggers)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		columns []userColumn
+		wantErr string
+	}{
+		{"changed type", []userColumn{{Name: "title", Type: "json", Required: true, Unique: true}, columns[1], columns[2]}, "cannot be changed"},
+		{"dropped", columns[:2], "cannot be dropped"},
+		{"required addition", append(append([]userColumn{}, columns...), userColumn{Name: "serves", Type: "integer", Required: true}), "cannot be required or unique"},
+	} {
+		if _, _, err := defineTableStatements("recipes", tt.columns, columns); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDefineTable_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cleanup := func() {
+		for _, op := range []string{"insert", "update", "delete"} {
+			db.Exec("DROP TRIGGER IF EXISTS changes_test_recipes_" + op)
+		}
+		db.Exec("DROP TABLE IF EXISTS test_recipes")
+		db.Exec("DELETE FROM user_tables WHERE name = 'test_recipes'")
+	}
+	cleanup()
+	defer cleanup()
+
+	handler := defineTableHandler(db)
+	define := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		result, err := callTool(handler, "define_table", args)
+		if err != nil {
+			t.Fatalf("define_table: %v", err)
+		}
+		return result
+	}
+	columns := []any{
+		map[string]any{"name": "title", "type": "text", "required": true},
+		map[string]any{"name": "entity_id", "type": "entity", "description": "the cook"},
+	}
+
+	result := define(map[string]any{"name": "test_recipes", "description": "recipes worth repeating", "columns": columns, "dry_run": true})
+	if result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "dry run") {
+		t.Fatalf("dry run = %v", result.Content)
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'test_recipes'").Scan(&n)
+	if n != 0 {
+		t.Fatal("dry run created the table")
+	}
+
+	result = define(map[string]any{"name": "test_recipes", "description": "recipes worth repeating", "columns": columns})
+	if result.IsError {
+		t.Fatalf("define_table: %v", result.Content)
+	}
+	before, err := maxChangeID(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO test_recipes (title) VALUES ('Pilau')"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	db.QueryRow("SELECT count(*) FROM changes WHERE table_name = 'test_recipes' AND op = 'insert' AND id > ?", before).Scan(&n)
+	if n != 1 {
+		t.Errorf("logged inserts = %d, want 1", n)
+	}
+
+	result = define(map[string]any{"name": "test_recipes", "description": "recipes worth repeating", "columns": append(columns, map[string]any{"name": "serves", "type": "integer"})})
+	if result.IsError {
+		t.Fatalf("add column: %v", result.Content)
+	}
+	if _, err := db.Exec("UPDATE test_recipes SET serves = 4 WHERE title = 'Pilau'"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	var payload string
+	db.QueryRow("SELECT payload FROM changes WHERE table_name = 'test_recipes' ORDER BY id DESC LIMIT 1").Scan(&payload)
+	if !strings.Contains(payload, `"serves":4`) {
+		t.Errorf("update payload = %s", payload)
+	}
+
+	schema, err := schemaHandler(db)(context.Background(), mcp.ReadResourceRequest{})
+	if err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	text := schema[0].(mcp.TextResourceContents).Text
+	if !strings.Contains(text, "test_recipes (id, title, entity_id, serves, created_at) -- recipes worth repeating") || !strings.Contains(text, "entity_id entity, an entities id: the cook") {
+		t.Errorf("schema = %s", text)
+	}
+
+	for _, args := range []map[string]any{
+		{"name": "observations", "description": "x", "columns": columns},
+		{"name": "test_recipes", "description": "x", "columns": columns[:1]},
+	} {
+		if result := define(args); !result.IsError {
+			t.Errorf("define_table(%v) should fail", args["name"])
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// vectorIndex ranks observations for semantic_search. On a libSQL server with
+// vector support it mirrors the current model's embeddings into an
+// F32_BLOB column with a vector index and asks vector_top_k for neighbours;
+// elsewhere it compares every stored vector in Go.
+type vectorIndex struct {
+	native bool
+
+	mu    sync.Mutex
+	ready string // model@dimensions observation_vectors holds, once checked
+}
+
+// newVectorIndex detects whether the server has libSQL's vector functions.
+func newVectorIndex(ctx context.Context, db *sql.DB) *vectorIndex {
+	var s string
+	if err := db.QueryRowContext(ctx, "SELECT vector_extract(vector32('[1]'))").Scan(&s); err != nil {
+		log.Printf("vector search: libSQL vector functions unavailable, ranking in Go (%v)", err)
+		return &vectorIndex{}
+	}
+	return &vectorIndex{native: true}
+}
+
+// vectorLiteral renders v as the text vector32() parses.
+func vectorLiteral(v []float32) string {
+	parts := make([]string, len(v))
+	for i, x := range v {
+		parts[i] = strconv.FormatFloat(float64(x), 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// vectorTableStatements rebuild observation_vectors for one model and
+// dimension count, with triggers that keep it in step with
+// observation_embeddings.
+func vectorTableStatements(model string, dims int) []string {
+	when := fmt.Sprintf("NEW.model = '%s' AND NEW.dimensions = %d", strings.ReplaceAll(model, "'", "''"), dims)
+	return []string{
+		`DROP TRIGGER IF EXISTS observation_vectors_insert`,
+		`DROP TRIGGER IF EXISTS observation_vectors_update`,
+		`DROP TRIGGER IF EXISTS observation_vectors_delete`,
+		`DROP INDEX IF EXISTS observation_vectors_idx`,
+		`DROP TABLE IF EXISTS observation_vectors`,
+		fmt.Sprintf(`CREATE TABLE observation_vectors (
+			observation_id INTEGER PRIMARY KEY,
+			embedding F32_BLOB(%d) NOT NULL
+		)`, dims),
+		`CREATE INDEX observation_vectors_idx ON observation_vectors (libsql_vector_idx(embedding, 'metric=cosine'))`,
+		`CREATE TRIGGER observation_vectors_insert AFTER INSERT ON observation_embeddings BEGIN
+			INSERT OR REPLACE INTO observation_vectors (observation_id, embedding)
+				SELECT NEW.observation_id, NEW.embedding WHERE ` + when + `;
+		END`,
+		`CREATE TRIGGER observation_vectors_update AFTER UPDATE ON observation_embeddings BEGIN
+			DELETE FROM observation_vectors WHERE observation_id = OLD.observation_id;
+			INSERT INTO observation_vectors (observation_id, embedding)
+				SELECT NEW.observation_id, NEW.embedding WHERE ` + when + `;
+		END`,
+		`CREATE TRIGGER observation_vectors_delete AFTER DELETE ON observation_embeddings BEGIN
+			DELETE FROM observation_vectors WHERE observation_id = OLD.observation_id;
+		END`,
+		`INSERT INTO observation_vectors (observation_id, embedding)
+			SELECT observation_id, embedding FROM observation_embeddings WHERE model = ? AND dimensions = ?`,
+		`DELETE FROM observation_vectors_model`,
+		`INSERT INTO observation_vectors_model (model, dimensions) VALUES (?, ?)`,
+	}
+}
+
+// prepare makes sure observation_vectors holds model's vectors of dims
+// dimensions, rebuilding it after a switch of model.
+func (x *vectorIndex) prepare(ctx context.Context, db *sql.DB, model string, dims int) error {
+	key := fmt.Sprintf("%s@%d", model, dims)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.ready == key {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS observation_vectors_model (
+		model TEXT NOT NULL,
+		dimensions INTEGER NOT NULL
+	)`); err != nil {
+		return err
+	}
+	var have string
+	var haveDims int
+	err := db.QueryRowContext(ctx, "SELECT model, dimensions FROM observation_vectors_model").Scan(&have, &haveDims)
+	if err == nil && have == model && haveDims == dims {
+		x.ready = key
+		return nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range vectorTableStatements(model, dims) {
+		var args []any
+		if strings.Contains(stmt, "?") {
+			args = []any{model, dims}
+		}
+		if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+			return fmt.Errorf("build vector index: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("vector search: built libSQL vector index for %s", key)
+	x.ready = key
+	return nil
+}
+
+// search returns up to limit observations most similar to want, as id,
+// entity, content and similarity rows, most similar first.
+func (x *vectorIndex) search(ctx context.Context, db *sql.DB, levels []string, model string, want []float32, limit int) ([]map[string]any, error) {
+	if x != nil && x.native {
+		if err := x.prepare(ctx, db, model, len(want)); err != nil {
+			return nil, err
+		}
+		// The index knows nothing of visibility or archiving, so ask for
+		// more neighbours than needed and filter them afterwards.
+		lit := vectorLiteral(want)
+		_, results, err := runQuery(ctx, db, restrictVisibility(`SELECT o.id, e.name AS entity, o.content,
+				1 - vector_distance_cos(v.embedding, vector32(?)) AS similarity
+			FROM vector_top_k('observation_vectors_idx', vector32(?), ?) k
+			JOIN observation_vectors v ON v.observation_id = k.id
+			JOIN observations o ON o.id = v.observation_id JOIN entities e ON e.id = o.entity_id
+			WHERE e.archived_at IS NULL
+			ORDER BY similarity DESC LIMIT ?`, levels), lit, lit, limit*5, limit)
+		return results, err
+	}
+
+	rows, err := db.QueryContext(ctx, restrictVisibility(`SELECT o.id, e.name, o.content, x.embedding
+		FROM observation_embeddings x JOIN observations o ON o.id = x.observation_id JOIN entities e ON e.id = o.entity_id
+		WHERE x.model = ? AND x.dimensions = ? AND e.archived_at IS NULL`, levels), model, len(want))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []map[string]any
+	for rows.Next() {
+		var id int64
+		var entity, content string
+		var blob []byte
+		if err := rows.Scan(&id, &entity, &content, &blob); err != nil {
+			return nil, err
+		}
+		v, err := decodeVector(blob)
+		if err != nil || len(v) != len(want) {
+			continue
+		}
+		results = append(results, map[string]any{"id": id, "entity": entity, "content": content, "similarity": cosine(want, v)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i]["similarity"].(float64) > results[j]["similarity"].(float64)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
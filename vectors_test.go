@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestVectorLiteral(t *testing.T) {
+	tests := []struct {
+		v    []float32
+		want string
+	}{
+		{nil, "[]"},
+		{[]float32{1}, "[1]"},
+		{[]float32{0.25, -1.5, 0}, "[0.25,-1.5,0]"},
+		{[]float32{0.1}, "[0.1]"},
+	}
+	for _, tt := range tests {
+		if got := vectorLiteral(tt.v); got != tt.want {
+			t.Errorf("vectorLiteral(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestVectorTableStatements(t *testing.T) {
+	stmts := strings.Join(vectorTableStatements("ollama/it's", 768), "\n")
+	for _, want := range []string{
+		"embedding F32_BLOB(768) NOT NULL",
+		"libsql_vector_idx(embedding, 'metric=cosine')",
+		"WHERE NEW.model = 'ollama/it''s' AND NEW.dimensions = 768",
+	} {
+		if !strings.Contains(stmts, want) {
+			t.Errorf("expected %q in:\n%s", want, stmts)
+		}
+	}
+}
+
+func TestVectorIndex_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	defer db.Exec("DELETE FROM observation_embeddings")
+	defer db.Exec("DELETE FROM entities WHERE name = 'vector-test'")
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'vector test %'")
+
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('vector-test', 'test')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, content := range []string{"vector test grafana dashboards on port 3000", "vector test sourdough starter feeding"} {
+		args := map[string]any{"entity": "vector-test", "content": content, "tags": "homelab"}
+		if result, err := callTool(addObservationHandler(db, nil), "add_observation", args); err != nil || result.IsError {
+			t.Fatalf("add_observation: %v %v", err, result.Content)
+		}
+	}
+	e := localEmbedder{dims: 32}
+	if _, err := embedAll(ctx, db, e, 64); err != nil {
+		t.Fatalf("embedAll: %v", err)
+	}
+
+	// Whichever path the server supports must rank the same way.
+	idx := newVectorIndex(ctx, db)
+	t.Logf("native vectors: %v", idx.native)
+	want, _ := e.Embed(ctx, []string{"grafana dashboards"})
+	for i := 0; i < 2; i++ {
+		results, err := idx.search(ctx, db, visibilityLevels, e.Model(), want[0], 1)
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		if len(results) != 1 || !strings.Contains(results[0]["content"].(string), "grafana") {
+			t.Errorf("search() = %v, want the grafana observation", results)
+		}
+	}
+	if idx.native {
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM observation_vectors").Scan(&n); err != nil || n < 2 {
+			t.Errorf("observation_vectors holds %d rows (%v), want the embedded observations", n, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// preferVerified makes ask_memory rank passages a person has confirmed with
+// verify above the rest by default. Without it, prefer_verified asks for it
+// per call.
+var preferVerified = getEnv("ENGRAM_PREFER_VERIFIED", "") == "true"
+
+// verifiedIDs returns which of ids have been confirmed with verify.
+func verifiedIDs(ctx context.Context, q queryer, ids []int64) (map[int64]bool, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.QueryContext(ctx, `SELECT id FROM observations WHERE verified_at IS NOT NULL AND id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	verified := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		verified[id] = true
+	}
+	return verified, rows.Err()
+}
+
+// verifiedFirst moves the verified ids ahead of the others, keeping the
+// order within each.
+func verifiedFirst(ids []int64, verified map[int64]bool) {
+	sort.SliceStable(ids, func(i, j int) bool {
+		return verified[ids[i]] && !verified[ids[j]]
+	})
+}
+
+// registerVerify adds the verify tool.
+func registerVerify(s *server.MCPServer, db *sql.DB, scopes *visibilityScopes) {
+	s.AddTool(mcp.NewTool("verify",
+		mcp.WithDescription(`Mark observations as confirmed by a person, recording when and by whom (verified_at, verified_by), to tell what the user vouched for from what a model inferred.
+
+Only call it when the user confirms the fact, e.g. after review_stale or review_low_confidence, not on your own judgement. ask_memory passages and open_nodes details then carry verifiedAt, and ask_memory with prefer_verified ranks them first. Editing an observation's content clears its verification.`),
+		mcp.WithArray("observations",
+			mcp.Required(),
+			mcp.Description("Observation ids or ask_memory cites, e.g. ['obs:12', '40']"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("by",
+			mcp.Description("Who confirmed them (default 'user')"),
+		),
+		mcp.WithBoolean("unverify",
+			mcp.Description("Clear the verification instead, e.g. when the user takes it back (default false)"),
+		),
+	), verifyHandler(db, scopes))
+}
+
+func verifyHandler(db *sql.DB, scopes *visibilityScopes) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		cites := request.GetStringSlice("observations", nil)
+		if len(cites) == 0 {
+			return toolError(codeInvalidArgument, "give the observations to verify, as ids or ask_memory cites such as obs:12"), nil
+		}
+		by := strings.TrimSpace(request.GetString("by", "user"))
+		if by == "" {
+			return toolError(codeInvalidArgument, "by must name who confirmed the observations"), nil
+		}
+		unverify := request.GetBool("unverify", false)
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to start transaction: %v", err), nil
+		}
+		defer tx.Rollback()
+
+		levels := scopes.levels(ctx)
+		var sb strings.Builder
+		changed := 0
+		for _, c := range cites {
+			id, err := parseCitation(c)
+			if err != nil {
+				return toolErrorFrom(err, codeInvalidArgument), nil
+			}
+			var n int
+			if err := tx.QueryRowContext(ctx, restrictVisibility("SELECT count(*) FROM observations o WHERE o.id = ?", levels), id).Scan(&n); err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to look up %s: %v", citation(id), err), nil
+			}
+			if n == 0 {
+				fmt.Fprintf(&sb, "%s: not found, skipped\n", citation(id))
+				continue
+			}
+			if unverify {
+				_, err = tx.ExecContext(ctx, "UPDATE observations SET verified_at = NULL, verified_by = NULL WHERE id = ?", id)
+			} else {
+				_, err = tx.ExecContext(ctx, "UPDATE observations SET verified_at = CURRENT_TIMESTAMP, verified_by = ? WHERE id = ?", by, id)
+			}
+			if err != nil {
+				return toolErrorf(errorCode(err, codeDatabase), "failed to update %s: %v", citation(id), err), nil
+			}
+			changed++
+		}
+		if err := tx.Commit(); err != nil {
+			return toolErrorf(errorCode(err, codeDatabase), "failed to commit: %v", err), nil
+		}
+		if unverify {
+			fmt.Fprintf(&sb, "cleared the verification of %d observations", changed)
+		} else {
+			fmt.Fprintf(&sb, "verified %d observations as confirmed by %s", changed, by)
+		}
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+}
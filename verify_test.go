@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestVerifiedFirst(t *testing.T) {
+	ids := []int64{5, 3, 8, 1, 9}
+	verifiedFirst(ids, map[int64]bool{8: true, 9: true})
+	if want := []int64{8, 9, 5, 3, 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("verifiedFirst() = %v, want %v", ids, want)
+	}
+}
+
+func TestVerify_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	defer db.Exec("DELETE FROM entities WHERE name = 'verify-test-nas'")
+	if _, err := db.Exec("INSERT INTO entities (name, entity_type) VALUES ('verify-test-nas', 'device')"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var ids []int64
+	// The first matches more of the question, so it ranks first unless the
+	// verified second is preferred.
+	for _, content := range []string{"verifytest zpool has four spindles", "verifytest zpool is mirrored"} {
+		res, err := db.Exec("INSERT INTO observations (entity_id, content) SELECT id, ? FROM entities WHERE name = 'verify-test-nas'", content)
+		if err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		ids = append(ids, id)
+	}
+
+	result, err := callTool(verifyHandler(db, nil), "verify", map[string]any{"observations": []any{citation(ids[1]), "999999999"}, "by": "vince"})
+	if err != nil || result.IsError {
+		t.Fatalf("verify: %v %v", err, result.Content)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "obs:999999999: not found") || !strings.HasSuffix(text, "verified 1 observations as confirmed by vince") {
+		t.Errorf("verify = %q", text)
+	}
+
+	ask := func(args map[string]any) askResult {
+		t.Helper()
+		args["question"] = "verifytest zpool spindles"
+		result, err := callTool(askMemoryHandler(db, nil, nil, nil, nil), "ask_memory", args)
+		if err != nil || result.IsError {
+			t.Fatalf("ask_memory: %v %v", err, result.Content)
+		}
+		var asked askResult
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &asked); err != nil {
+			t.Fatal(err)
+		}
+		if len(asked.Passages) != 2 {
+			t.Fatalf("ask_memory = %+v, want two passages", asked)
+		}
+		return asked
+	}
+	asked := ask(map[string]any{})
+	if asked.Passages[0].Cite != citation(ids[0]) || asked.Passages[1].VerifiedBy != "vince" || asked.Passages[1].VerifiedAt == "" {
+		t.Errorf("ask_memory = %+v, want the verified passage second and marked", asked.Passages)
+	}
+	asked = ask(map[string]any{"prefer_verified": true})
+	if asked.Passages[0].Cite != citation(ids[1]) {
+		t.Errorf("ask_memory prefer_verified = %+v, want the verified passage first", asked.Passages)
+	}
+
+	// Editing the content voids the confirmation.
+	if _, err := db.Exec("UPDATE observations SET content = 'verifytest zpool is a raidz2' WHERE id = ?", ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	var verifiedAt any
+	if err := db.QueryRow("SELECT verified_at FROM observations WHERE id = ?", ids[1]).Scan(&verifiedAt); err != nil || verifiedAt != nil {
+		t.Errorf("verified_at after an edit = %v, %v, want NULL", verifiedAt, err)
+	}
+
+	result, err = callTool(verifyHandler(db, nil), "verify", map[string]any{"observations": []any{"obs:x"}})
+	if err != nil || !result.IsError {
+		t.Errorf("verify with a bad cite: expected error, got %v %v", err, result)
+	}
+}
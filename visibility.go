@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var visibilityLevels = []string{"private", "shared", "public"}
+
+// scopedTables hold what a client with a restricted visibility scope must
+// not see in full. visible picks the rows it may see, with %[1]s standing
+// for the quoted list of its levels and %[2]s for the row, "" or "OLD.". Its
+// statements read each table through a CTE of the same name holding those
+// rows, and its writes pass over the others.
+var scopedTables = []struct{ name, visible string }{
+	{"observations", "%[2]svisibility IN (%[1]s)"},
+	{"archived_observations", "%[2]svisibility IN (%[1]s)"},
+	{"attachments", "%[2]sobservation_id IN (SELECT id FROM main.observations WHERE visibility IN (%[1]s))"},
+	{"contents", "%[2]ssha256 IN (SELECT content_sha256 FROM main.observations WHERE visibility IN (%[1]s))"},
+	{"changes", "(%[2]stable_name IN ('observations', 'archived_observations') AND json_extract(%[2]spayload, '$.visibility') IN (%[1]s)" +
+		" OR %[2]stable_name = 'contents' AND json_extract(%[2]spayload, '$.sha256') IN (SELECT content_sha256 FROM main.observations WHERE visibility IN (%[1]s))" +
+		" OR %[2]stable_name NOT IN ('observations', 'archived_observations', 'contents') AND coalesce(json_extract(%[2]spayload, '$.observation_id') IN (SELECT id FROM main.observations WHERE visibility IN (%[1]s)), 1))"},
+}
+
+// deniedTables are closed to a client with a restricted scope: they hold
+// observation text with nothing to filter it by, as the full-text index
+// does, or other sessions' notes and recalls.
+var deniedTables = []string{
+	"session_notes", "recall_snapshots",
+	"observations_fts", "observations_fts_data", "observations_fts_idx", "observations_fts_docsize", "observations_fts_config",
+}
+
+// visibilityScope lists the levels readable by clients without an entry in
+// clientVisibility. ENGRAM_CLIENT_VISIBILITY maps MCP client names to their own
+// scope, e.g. "claude-ai=private,shared,public;team-bot=shared,public".
+var (
+	visibilityScope  = getEnv("ENGRAM_VISIBILITY", strings.Join(visibilityLevels, ","))
+	clientVisibility = getEnv("ENGRAM_CLIENT_VISIBILITY", "")
+)
+
+type visibilityScopes struct {
+	defaults []string
+	clients  map[string][]string
+}
+
+func parseVisibilityScopes(defaults, clients string) (*visibilityScopes, error) {
+	levels, err := parseVisibilityLevels(defaults)
+	if err != nil {
+		return nil, err
+	}
+	scopes := &visibilityScopes{defaults: levels, clients: make(map[string][]string)}
+
+	entries, err := parseClientEntries(clients, "level")
+	if err != nil {
+		return nil, err
+	}
+	for name, list := range entries {
+		levels, err := parseVisibilityLevels(list)
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %v", name, err)
+		}
+		scopes.clients[name] = levels
+	}
+	return scopes, nil
+}
+
+// parseClientEntries splits a per-client setting such as
+// "claude-ai=a,b;team-bot=c" into client names and their raw value lists.
+func parseClientEntries(s, item string) (map[string]string, error) {
+	entries := make(map[string]string)
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, list, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid client entry %q, want name=%s,%s", entry, item, item)
+		}
+		entries[strings.TrimSpace(name)] = list
+	}
+	return entries, nil
+}
+
+type clientNameKey struct{}
+
+// withClientName names the caller after an authenticated identity, such as
+// the OIDC login of a REST call or the key of an MCP call over HTTP.
+func withClientName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, clientNameKey{}, name)
+}
+
+// clientName returns the name given by withClientName or, failing that,
+// the name the calling session's client reported for itself, if known.
+func clientName(ctx context.Context) (string, bool) {
+	if name, ok := ctx.Value(clientNameKey{}).(string); ok {
+		return name, true
+	}
+	if session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo); ok {
+		return session.GetClientInfo().Name, true
+	}
+	return "", false
+}
+
+func parseVisibilityLevels(s string) ([]string, error) {
+	var levels []string
+	for _, l := range parseTagNames(s) {
+		l = strings.ToLower(l)
+		valid := false
+		for _, v := range visibilityLevels {
+			if l == v {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown visibility level %q, want one of: %s", l, strings.Join(visibilityLevels, ", "))
+		}
+		levels = append(levels, l)
+	}
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("visibility scope must include at least one level")
+	}
+	return levels, nil
+}
+
+// levels returns the visibility levels the calling client may read. A nil
+// *visibilityScopes allows everything.
+func (v *visibilityScopes) levels(ctx context.Context) []string {
+	if v == nil {
+		return visibilityLevels
+	}
+	if name, ok := clientName(ctx); ok {
+		if levels, ok := v.clients[name]; ok {
+			return levels
+		}
+	}
+	return v.defaults
+}
+
+// defaultLevels returns the levels of a caller that names no client, the
+// ones background jobs such as warmup and the due webhook read with.
+func (v *visibilityScopes) defaultLevels() []string {
+	if v == nil {
+		return visibilityLevels
+	}
+	return v.defaults
+}
+
+func restricted(levels []string) bool {
+	for _, v := range visibilityLevels {
+		found := false
+		for _, l := range levels {
+			if l == v {
+				found = true
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictVisibility shadows the scoped tables, observations among them,
+// with CTEs of the same names that only hold the rows visible at the given
+// levels. CTEs are visible to every subquery of the statement, so joins and
+// nested selects are filtered too.
+func restrictVisibility(sqlStr string, levels []string) string {
+	if !restricted(levels) {
+		return sqlStr
+	}
+	quoted := quotedLevels(levels)
+	ctes := make([]string, len(scopedTables))
+	for i, t := range scopedTables {
+		ctes[i] = fmt.Sprintf("%s AS (SELECT * FROM main.%s WHERE %s)", t.name, t.name, fmt.Sprintf(t.visible, quoted, ""))
+	}
+	return withCTEs(sqlStr, strings.Join(ctes, ", "))
+}
+
+func quotedLevels(levels []string) string {
+	return "'" + strings.Join(levels, "', '") + "'"
+}
+
+// withCTEs puts ctes first in sqlStr's WITH clause, adding one if it has
+// none.
+func withCTEs(sqlStr, ctes string) string {
+	tokens := tokenizeSQL(sqlStr)
+	if len(tokens) == 0 || !isKeyword(tokens[0], "WITH") {
+		return "WITH " + ctes + " " + sqlStr
+	}
+	with := tokens[0]
+	if len(tokens) > 1 && isKeyword(tokens[1], "RECURSIVE") {
+		with = tokens[1]
+	}
+	end := with.pos + len(with.text)
+	return sqlStr[:end] + " " + ctes + "," + sqlStr[end:]
+}
+
+// scopeStatement readies a client's statement to run under a restricted
+// scope: it refuses one that reaches a scoped table other than by its bare
+// name, which the CTEs would not catch, or that touches a denied table, then
+// shadows the scoped tables. Statements other than reads and writes, such as
+// PRAGMA, are refused.
+func scopeStatement(ctx context.Context, q queryer, sqlStr string, levels []string, args ...any) (string, error) {
+	stmt, err := parseStatement(sqlStr)
+	if err != nil {
+		return "", err
+	}
+	if stmt.verb != "SELECT" && stmt.verb != "VALUES" && !stmt.isWrite() {
+		return "", errorf(codeForbiddenSQL, "%s is not available to clients with a restricted visibility scope", stmt.verb)
+	}
+	if err := checkScopedReads(ctx, q, sqlStr, args...); err != nil {
+		return "", err
+	}
+	return restrictVisibility(sqlStr, levels), nil
+}
+
+// checkScopedReads compiles sqlStr with every scoped table shadowed by an
+// empty stand-in, and refuses it if the program still opens one of them or
+// its indexes for reading, or opens a denied table at all. A read of a
+// scoped table got past its name, as main.observations or a view over it
+// does. A write's own target is left to the triggers of openScopedConn.
+// Foreign key checks open tables too, so writes are checked with them off.
+//
+// A virtual table has no pages to spot in the program, so a denied one,
+// the full-text index, is refused wherever its name appears.
+func checkScopedReads(ctx context.Context, q queryer, sqlStr string, args ...any) error {
+	var stubs, names []string
+	for _, t := range scopedTables {
+		cols, err := tableColumns(ctx, q, t.name)
+		if err != nil {
+			return err
+		}
+		nulls := make([]string, len(cols))
+		for j, c := range cols {
+			cols[j], nulls[j] = quoteIdent(c), "NULL"
+		}
+		stubs = append(stubs, fmt.Sprintf("%s(%s) AS (SELECT %s WHERE 0)", t.name, strings.Join(cols, ", "), strings.Join(nulls, ", ")))
+		names = append(names, sqlLiteral(t.name))
+	}
+	denied := make(map[string]bool)
+	for _, t := range deniedTables {
+		denied[t] = true
+		names = append(names, sqlLiteral(t))
+	}
+
+	roots := make(map[int64]string)
+	virtual := make(map[string]bool)
+	rows, err := q.QueryContext(ctx, "SELECT rootpage, lower(tbl_name) FROM sqlite_schema WHERE type IN ('table', 'index') AND lower(tbl_name) IN ("+strings.Join(names, ", ")+")")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var page int64
+		var table string
+		if err := rows.Scan(&page, &table); err != nil {
+			rows.Close()
+			return err
+		}
+		if page > 0 {
+			roots[page] = table
+		} else if denied[table] {
+			virtual[table] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, t := range tokenizeSQL(sqlStr) {
+		if name := strings.ToLower(unquoteName(t)); (t.kind == tokenWord || t.kind == tokenQuoted) && virtual[name] {
+			return errorf(codeForbiddenSQL, "%s is not available to clients with a restricted visibility scope", name)
+		}
+	}
+
+	rows, err = q.QueryContext(ctx, "EXPLAIN "+withCTEs(sqlStr, strings.Join(stubs, ", ")), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type open struct {
+		cursor int64
+		table  string
+	}
+	var reads []open
+	writes := make(map[int64]bool)
+	prev := int64(-1)
+	for rows.Next() {
+		var addr, p1, p2, p3 sql.NullInt64
+		var opcode string
+		var p4, p5, comment any
+		if err := rows.Scan(&addr, &opcode, &p1, &p2, &p3, &p4, &p5, &comment); err != nil {
+			return err
+		}
+		// Trigger programs follow the statement's own, numbered from 0
+		// again. They come from the schema, not the client.
+		if addr.Int64 <= prev {
+			break
+		}
+		prev = addr.Int64
+		table, ok := roots[p2.Int64]
+		if !ok || p3.Int64 != 0 {
+			continue
+		}
+		switch opcode {
+		case "OpenWrite":
+			if denied[table] {
+				return errorf(codeForbiddenSQL, "%s is not available to clients with a restricted visibility scope", table)
+			}
+			writes[p1.Int64] = true
+		case "OpenRead", "ReopenIdx":
+			if denied[table] {
+				return errorf(codeForbiddenSQL, "%s is not available to clients with a restricted visibility scope", table)
+			}
+			reads = append(reads, open{p1.Int64, table})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// An UPDATE or DELETE may scan its target before writing it, on the
+	// same cursor; any other read of a scoped table is the client's.
+	for _, r := range reads {
+		if !writes[r.cursor] {
+			return errorf(codeForbiddenSQL, "this client's visibility scope only lets it read %s by its bare name, not schema-qualified or through a view", r.table)
+		}
+	}
+	return nil
+}
+
+func tableColumns(ctx context.Context, q queryer, table string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, rows.Err()
+}
+
+// scopedConn is a connection for the writes of a client with a restricted
+// visibility scope. Temporary triggers on it skip updates and deletes of
+// rows of the scoped tables the client cannot see and of rows hanging off
+// hidden observations, and inserts that would replace a hidden observation,
+// so those rows stay as they are and count as untouched, just as they are
+// absent from the client's reads.
+type scopedConn struct {
+	*sql.Conn
+	triggers []string
+	// broken is set when the connection was left in a state it must not go
+	// back to the pool in, such as with foreign keys off.
+	broken bool
+}
+
+// openScopedConn checks sqlStr as checkScopedReads does and returns it with
+// the scoped tables shadowed, along with a connection to run it on. Close
+// drops the triggers before the connection goes back to the pool.
+func openScopedConn(ctx context.Context, db *sql.DB, sqlStr string, levels []string) (*scopedConn, string, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	c := &scopedConn{Conn: conn}
+	scoped, err := c.scope(ctx, sqlStr, levels)
+	if err != nil {
+		c.Close()
+		return nil, "", err
+	}
+	return c, scoped, nil
+}
+
+func (c *scopedConn) scope(ctx context.Context, sqlStr string, levels []string) (string, error) {
+	var foreignKeys bool
+	if err := c.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return "", err
+	}
+	if foreignKeys {
+		if _, err := c.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return "", err
+		}
+	}
+	scoped, err := scopeStatement(ctx, c, sqlStr, levels)
+	if foreignKeys {
+		if _, err := c.ExecContext(ctx, "PRAGMA foreign_keys = ON"); err != nil {
+			c.broken = true
+			return "", err
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	quoted := quotedLevels(levels)
+	guards := map[string][]string{"observations": {
+		"INSERT", fmt.Sprintf("EXISTS (SELECT 1 FROM main.observations WHERE id = NEW.id AND visibility NOT IN (%s))", quoted),
+	}}
+	for _, t := range scopedTables {
+		hidden := fmt.Sprintf("NOT (%s)", fmt.Sprintf(t.visible, quoted, "OLD."))
+		guards[t.name] = append(guards[t.name], "UPDATE", hidden, "DELETE", hidden)
+	}
+	rows, err := c.QueryContext(ctx, `SELECT m.name FROM sqlite_schema m, pragma_table_info(m.name) col
+		WHERE m.type = 'table' AND col.name = 'observation_id' AND m.sql NOT LIKE 'CREATE VIRTUAL TABLE%' ORDER BY m.name`)
+	if err != nil {
+		return "", err
+	}
+	hidden := fmt.Sprintf("EXISTS (SELECT 1 FROM main.observations WHERE id = %%s AND visibility NOT IN (%s))", quoted)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return "", err
+		}
+		if _, ok := guards[table]; ok {
+			continue
+		}
+		guards[table] = []string{
+			"UPDATE", fmt.Sprintf(hidden, "OLD.observation_id") + " OR " + fmt.Sprintf(hidden, "NEW.observation_id"),
+			"DELETE", fmt.Sprintf(hidden, "OLD.observation_id"),
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	for table, ops := range guards {
+		for i := 0; i < len(ops); i += 2 {
+			name := fmt.Sprintf("engram_scope_%s_%s", table, strings.ToLower(ops[i]))
+			if _, err := c.ExecContext(ctx, fmt.Sprintf("CREATE TEMP TRIGGER %s BEFORE %s ON main.%s WHEN %s BEGIN SELECT RAISE(IGNORE); END",
+				quoteIdent(name), ops[i], quoteIdent(table), ops[i+1])); err != nil {
+				return "", err
+			}
+			c.triggers = append(c.triggers, name)
+		}
+	}
+	return scoped, nil
+}
+
+// Close drops the triggers and returns the connection to the pool, or
+// discards it if they could not all be dropped.
+func (c *scopedConn) Close() error {
+	ctx := context.Background()
+	for _, name := range c.triggers {
+		if _, err := c.ExecContext(ctx, "DROP TRIGGER IF EXISTS temp."+quoteIdent(name)); err != nil {
+			c.broken = true
+		}
+	}
+	if c.broken {
+		c.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseVisibilityScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults string
+		clients  string
+		wantErr  bool
+	}{
+		{"all levels", "private,shared,public", "", false},
+		{"single level", "public", "", false},
+		{"mixed case", "Shared, PUBLIC", "", false},
+		{"unknown level", "secret", "", true},
+		{"empty scope", "", "", true},
+		{"client scopes", "private,shared,public", "team-bot=shared,public;other=public", false},
+		{"client missing name", "public", "=public", true},
+		{"client missing levels", "public", "team-bot", true},
+		{"client unknown level", "public", "team-bot=secret", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseVisibilityScopes(tt.defaults, tt.clients)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseVisibilityScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestrictVisibility(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    string
+		levels []string
+		prefix string
+		suffix string
+	}{
+		{"all levels unchanged", "SELECT * FROM observations", []string{"private", "shared", "public"}, "SELECT * FROM observations", "SELECT * FROM observations"},
+		{"plain select", "SELECT * FROM observations", []string{"public"},
+			"WITH observations AS (SELECT * FROM main.observations WHERE visibility IN ('public')), ", ") SELECT * FROM observations"},
+		{"existing with", "WITH x AS (SELECT 1) SELECT * FROM x", []string{"shared", "public"},
+			"WITH observations AS (SELECT * FROM main.observations WHERE visibility IN ('shared', 'public')), ", "), x AS (SELECT 1) SELECT * FROM x"},
+		{"recursive with", "with recursive x AS (SELECT 1) SELECT * FROM x", []string{"public"},
+			"with recursive observations AS (SELECT * FROM main.observations WHERE visibility IN ('public')), ", "), x AS (SELECT 1) SELECT * FROM x"},
+		{"with after comment", "/* WITH */ WITH x AS (SELECT 1) SELECT * FROM x", []string{"public"},
+			"/* WITH */ WITH observations AS (", "), x AS (SELECT 1) SELECT * FROM x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := restrictVisibility(tt.sql, tt.levels)
+			if !strings.HasPrefix(got, tt.prefix) || !strings.HasSuffix(got, tt.suffix) {
+				t.Errorf("restrictVisibility(%q) = %q, want %q...%q", tt.sql, got, tt.prefix, tt.suffix)
+			}
+			for _, table := range scopedTables {
+				if restricted(tt.levels) && !strings.Contains(got, table.name+" AS (SELECT * FROM main."+table.name+" WHERE ") {
+					t.Errorf("restrictVisibility(%q) does not shadow %s", tt.sql, table.name)
+				}
+			}
+		})
+	}
+}
+
+func TestRestrictVisibility_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT INTO observations (entity_id, content, visibility) VALUES (1, 'visibility private 97531', 'private'), (1, 'visibility public 97531', 'public')"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'visibility % 97531'")
+
+	var n int
+	query := restrictVisibility("SELECT count(*) FROM entities e WHERE EXISTS (SELECT 1 FROM observations o WHERE o.entity_id = e.id AND o.content LIKE 'visibility % 97531')", []string{"public"})
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected entity visible through public observation, got %d", n)
+	}
+
+	query = restrictVisibility("SELECT count(*) FROM observations WHERE content LIKE 'visibility % 97531'", []string{"shared", "public"})
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected only the public observation, got %d", n)
+	}
+}
+
+func TestScopeStatement_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	public := []string{"public"}
+
+	for _, sqlStr := range []string{
+		"SELECT * FROM main.observations",
+		`SELECT * FROM "main".observations`,
+		"SELECT * FROM [main].[observations]",
+		"SELECT * FROM main/**/.observations",
+		"SELECT (SELECT content FROM main.observations LIMIT 1)",
+		"SELECT count(*) FROM entities e JOIN main.observations o ON o.entity_id = e.id",
+		"WITH x AS (SELECT entity_id FROM main.observations) SELECT * FROM x",
+		"SELECT payload FROM main.changes",
+		"SELECT body FROM main.contents",
+		"SELECT content FROM main.archived_observations",
+		"SELECT data FROM main.attachments",
+		"SELECT * FROM session_notes",
+		"SELECT result FROM recall_snapshots",
+		"SELECT rowid FROM observations_fts WHERE observations_fts MATCH 'x'",
+		`SELECT * FROM main."observations_fts"`,
+		"SELECT block FROM observations_fts_data",
+		"DELETE FROM session_notes WHERE content LIKE 'x%'",
+	} {
+		if _, err := scopeStatement(ctx, db, sqlStr, public); errorCode(err, "") != codeForbiddenSQL {
+			t.Errorf("scopeStatement(%q) error = %v, want %s", sqlStr, err, codeForbiddenSQL)
+		}
+	}
+	for _, sqlStr := range []string{
+		"SELECT * FROM observations",
+		"SELECT * FROM entities e JOIN observations o ON o.entity_id = e.id WHERE o.id > ?",
+		"WITH x AS (SELECT 1) SELECT * FROM x, observations",
+		"SELECT payload FROM changes WHERE id > ?",
+		"SELECT body FROM contents c JOIN observations o ON o.content_sha256 = c.sha256 WHERE o.id > ?",
+		"SELECT * FROM archived_observations a, attachments b WHERE a.id > ?",
+		"SELECT value FROM json_each('[1, 2]') WHERE value > ?",
+	} {
+		if _, err := scopeStatement(ctx, db, sqlStr, public, 0); err != nil {
+			t.Errorf("scopeStatement(%q) error = %v", sqlStr, err)
+		}
+	}
+	if _, err := scopeStatement(ctx, db, "PRAGMA table_info(observations)", public); errorCode(err, "") != codeForbiddenSQL {
+		t.Errorf("expected PRAGMA to be refused, got %v", err)
+	}
+}
+
+func TestScopedExecute_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer db.Exec("DELETE FROM observations WHERE content LIKE 'scoped execute % 86420'")
+	defer db.Exec("DELETE FROM entities WHERE name = 'scoped-execute-86420'")
+
+	var private, public int64
+	if err := db.QueryRow("INSERT INTO observations (entity_id, content, visibility) VALUES (1, 'scoped execute private 86420', 'private') RETURNING id").Scan(&private); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := db.QueryRow("INSERT INTO observations (entity_id, content, visibility) VALUES (1, 'scoped execute public 86420', 'public') RETURNING id").Scan(&public); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO observation_tags (observation_id, tag_id) SELECT ?, id FROM tags WHERE name = 'homelab'", private); err != nil {
+		t.Fatalf("tag: %v", err)
+	}
+	execute := executeHandler(db, nil, &visibilityScopes{defaults: []string{"public"}})
+	run := func(sqlStr string) string {
+		t.Helper()
+		result, err := callTool(execute, "execute", map[string]any{"sql": sqlStr})
+		if err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+		return resultErrorCode(result) + result.Content[0].(mcp.TextContent).Text
+	}
+
+	if got := run("UPDATE observations SET visibility = 'public' WHERE content LIKE 'scoped execute % 86420'"); !strings.HasPrefix(got, "success: 1 row(s) affected") {
+		t.Errorf("update = %q, want only the public observation changed", got)
+	}
+	run("DELETE FROM observation_tags WHERE observation_id = " + fmt.Sprint(private))
+	run(fmt.Sprintf("REPLACE INTO observations (id, entity_id, content, visibility) VALUES (%d, 1, 'scoped execute replaced 86420', 'public')", private))
+	var visibility, content string
+	var tags int
+	db.QueryRow("SELECT visibility, content, (SELECT count(*) FROM observation_tags WHERE observation_id = observations.id) FROM observations WHERE id = ?", private).Scan(&visibility, &content, &tags)
+	if visibility != "private" || content != "scoped execute private 86420" || tags != 1 {
+		t.Errorf("private observation changed by a public client: %s, %q, %d tags", visibility, content, tags)
+	}
+
+	if got := run("INSERT INTO entities (name, entity_type) SELECT 'scoped-execute-86420', content FROM main.observations WHERE id = " + fmt.Sprint(private)); !strings.HasPrefix(got, codeForbiddenSQL) {
+		t.Errorf("insert from main.observations = %q, want %s", got, codeForbiddenSQL)
+	}
+	run("INSERT INTO entities (name, entity_type) SELECT 'scoped-execute-86420', count(*) FROM observations WHERE content LIKE 'scoped execute % 86420'")
+	var copied string
+	db.QueryRow("SELECT entity_type FROM entities WHERE name = 'scoped-execute-86420'").Scan(&copied)
+	if copied != "1" {
+		t.Errorf("insert ... select saw %s observations, want only the public one", copied)
+	}
+
+	// The triggers go with the connection.
+	if got := run("DELETE FROM observations WHERE id = " + fmt.Sprint(public)); !strings.HasPrefix(got, "success: 1 row(s) affected") {
+		t.Errorf("delete = %q", got)
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM sqlite_temp_master WHERE type = 'trigger'").Scan(&n)
+	if n != 0 {
+		t.Errorf("%d temporary triggers left behind", n)
+	}
+}
+
+func TestScopedTables_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	marker := fmt.Sprint(time.Now().UnixNano())
+	defer db.Exec("DELETE FROM contents WHERE body LIKE ?", "% "+marker)
+	defer db.Exec("DELETE FROM archived_observations WHERE content LIKE ?", "% "+marker)
+	defer db.Exec("DELETE FROM observations WHERE content LIKE ?", "% "+marker)
+
+	for _, v := range []string{"private", "public"} {
+		sha := "scoped-tables-" + v + "-" + marker
+		if _, err := db.Exec("INSERT INTO contents (sha256, body, size) VALUES (?, ?, 1)", sha, "scoped tables body "+v+" "+marker); err != nil {
+			t.Fatalf("insert content: %v", err)
+		}
+		if _, err := db.Exec("INSERT INTO observations (entity_id, content, visibility, content_sha256) VALUES (1, ?, ?, ?)", "scoped tables "+v+" "+marker, v, sha); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		if _, err := db.Exec("INSERT INTO archived_observations (id, entity_id, content, visibility) VALUES (abs(random() % 1000000000) + 1000000000, 1, ?, ?)", "scoped tables archived "+v+" "+marker, v); err != nil {
+			t.Fatalf("insert archived: %v", err)
+		}
+	}
+
+	query := queryHandler(db, nil, &visibilityScopes{defaults: []string{"public"}})
+	count := func(sqlStr string) string {
+		t.Helper()
+		result, err := callTool(query, "query", map[string]any{"sql": sqlStr})
+		if err != nil || result.IsError {
+			t.Fatalf("query %q: %v %v", sqlStr, err, result.Content)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+	for _, tc := range []struct{ sql, table string }{
+		{"SELECT count(*) AS n FROM changes WHERE table_name = '%[1]s' AND payload LIKE '%%%[2]s %[3]s%%'", "observations"},
+		{"SELECT count(*) AS n FROM changes WHERE table_name = '%[1]s' AND payload LIKE '%%%[2]s %[3]s%%'", "contents"},
+		{"SELECT count(*) AS n FROM changes WHERE table_name = '%[1]s' AND payload LIKE '%%%[2]s %[3]s%%'", "archived_observations"},
+		{"SELECT count(*) AS n FROM %[1]s WHERE body LIKE '%% %[2]s %[3]s'", "contents"},
+		{"SELECT count(*) AS n FROM %[1]s WHERE content LIKE '%% %[2]s %[3]s'", "archived_observations"},
+	} {
+		if got, want := count(fmt.Sprintf(tc.sql, tc.table, "public", marker)), count("SELECT 1 AS n"); got != want {
+			t.Errorf("%s: public rows = %q, want %q", tc.table, got, want)
+		}
+		if got, want := count(fmt.Sprintf(tc.sql, tc.table, "private", marker)), count("SELECT 0 AS n"); got != want {
+			t.Errorf("%s: private rows = %q, want %q", tc.table, got, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+)
+
+// warmupConnections is how many database connections serve opens, checks
+// and keeps idle at startup, so the first tool calls of a conversation do
+// not each pay a TLS handshake and a cold database. 0 turns warmup off.
+var warmupConnections = getEnvInt("ENGRAM_WARMUP_CONNECTIONS", 2)
+
+const warmupTimeout = 30 * time.Second
+
+// databaseTransport carries the libsql driver's requests to the database
+// hosts connect opens, keeping idle connections enough for a warmed-up pool.
+// The driver sends through http.DefaultClient and takes no client of its
+// own, so routeDatabase has that client send requests for those hosts here
+// and every other request through http.DefaultTransport, left as it is.
+var (
+	databaseTransport = newDatabaseTransport()
+	databaseHosts     sync.Map
+	databaseRouting   sync.Once
+)
+
+func newDatabaseTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = max(warmupConnections, 2)
+	return t
+}
+
+// databaseRouter sends requests for databaseHosts through
+// databaseTransport and the rest through next.
+type databaseRouter struct {
+	next http.RoundTripper
+}
+
+func (r databaseRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := databaseHosts.Load(req.URL.Host); ok {
+		return databaseTransport.RoundTrip(req)
+	}
+	return r.next.RoundTrip(req)
+}
+
+// routeDatabase sends the driver's HTTP requests for url's host through
+// databaseTransport. WebSocket and file URLs do not use it.
+func routeDatabase(url string) {
+	u, err := neturl.Parse(url)
+	if err != nil || u.Host == "" || (u.Scheme != "libsql" && u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+	databaseHosts.Store(u.Host, true)
+	databaseRouting.Do(func() {
+		next := http.DefaultClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		http.DefaultClient.Transport = databaseRouter{next: next}
+	})
+}
+
+// prePing opens n connections at once and runs SELECT 1 on each, then
+// returns them to the pool, raising its idle limit to keep them; the HTTP
+// connections under them stay open in databaseTransport. The libsql HTTP
+// driver does not implement driver.Pinger, so db.Ping alone never reaches
+// the server.
+func prePing(ctx context.Context, db *sql.DB, n int) error {
+	db.SetMaxIdleConns(max(n, 2))
+
+	conns := make([]*sql.Conn, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := db.Conn(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			conns[i] = c
+			_, errs[i] = c.ExecContext(ctx, "SELECT 1")
+		}(i)
+	}
+	wg.Wait()
+	for _, c := range conns {
+		if c != nil {
+			c.Close()
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warmup pre-pings the pool and runs the reads most conversations start
+// with, so the server has them parsed and planned: the tag lookups that
+// every write validates against, schema introspection, the pinned
+// entities and the keyword search of ask_memory. They run with the same
+// text and visibility levels the handlers use.
+func warmup(ctx context.Context, db *sql.DB, levels []string, conns int) error {
+	if err := prePing(ctx, db, conns); err != nil {
+		return fmt.Errorf("pre-ping: %v", err)
+	}
+	drain := func(rows *sql.Rows, err error) error {
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return rows.Err()
+	}
+	steps := map[string]func() error{
+		"tag lookup": func() error {
+			return drain(db.QueryContext(ctx, "SELECT id FROM tags WHERE name = ?", ""))
+		},
+		"tag list": func() error {
+			return drain(db.QueryContext(ctx, "SELECT name, description FROM tags ORDER BY name"))
+		},
+		"schema": func() error {
+			_, err := userTablesSchema(ctx, db)
+			return err
+		},
+		"pinned entities": func() error {
+			_, err := loadGraph(ctx, db, levels, graphQuery{filter: "e.pinned_at IS NOT NULL AND e.archived_at IS NULL"})
+			return err
+		},
+		"keyword search": func() error {
+			_, err := keywordMatches(ctx, db, levels, []string{"warmup"}, defaultAskLimit)
+			return err
+		},
+	}
+	var mu sync.Mutex
+	var failed error
+	var wg sync.WaitGroup
+	for name, run := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := run(); err != nil {
+				mu.Lock()
+				failed = fmt.Errorf("%s: %v", name, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return failed
+}
+
+// warmupInBackground warms db while serve starts answering, logging how
+// long it took or why it failed.
+func warmupInBackground(ctx context.Context, db *sql.DB, levels []string, conns int) {
+	ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := warmup(ctx, db, levels, conns); err != nil {
+		log.Printf("database warmup failed: %v", err)
+		return
+	}
+	log.Printf("database warmup: %d connections ready in %s", conns, time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWarmup_Integration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	if err := warmup(context.Background(), db, []string{"public"}, 3); err != nil {
+		t.Fatalf("warmup: %v", err)
+	}
+	if stats := db.Stats(); stats.Idle != 3 {
+		t.Errorf("idle connections after warmup = %d, want 3", stats.Idle)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestDatabaseRouter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	idle := http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost
+	routeDatabase(srv.URL)
+	if got := http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost; got != idle {
+		t.Errorf("http.DefaultTransport MaxIdleConnsPerHost = %d, want %d", got, idle)
+	}
+
+	var passed []string
+	router := databaseRouter{next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		passed = append(passed, req.URL.Host)
+		return &http.Response{StatusCode: http.StatusTeapot, Body: http.NoBody}, nil
+	})}
+	for _, url := range []string{srv.URL, "http://elsewhere.invalid"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := router.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: %v", url, err)
+		}
+		resp.Body.Close()
+	}
+	if len(passed) != 1 || passed[0] != "elsewhere.invalid" {
+		t.Errorf("requests passed on = %v, want only elsewhere.invalid", passed)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+var (
+	// singleWriter lets one write (a transaction or a statement outside
+	// one) run at a time per database, queueing the rest in the process
+	// instead of letting SQLite turn them away with SQLITE_BUSY when the
+	// REST API or several sessions call tools at once.
+	singleWriter = getEnv("ENGRAM_SINGLE_WRITER", "") == "true"
+	// busyTimeoutMS sets PRAGMA busy_timeout on every connection, so a
+	// write that finds the database locked retries for that long before
+	// failing. 0 leaves the server's setting.
+	busyTimeoutMS = getEnvInt("ENGRAM_BUSY_TIMEOUT_MS", 0)
+)
+
+// writeLock admits one writer at a time, in arrival order, and gives up
+// when the caller's context ends. A nil writeLock admits everyone.
+type writeLock chan struct{}
+
+func newWriteLock() writeLock {
+	return make(writeLock, 1)
+}
+
+func (l writeLock) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l writeLock) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// lockedTx holds its connection's write lock until it ends.
+type lockedTx struct {
+	driver.Tx
+	conn *pragmaConn
+}
+
+func (t *lockedTx) Commit() error {
+	defer t.conn.unlock()
+	return t.Tx.Commit()
+}
+
+func (t *lockedTx) Rollback() error {
+	defer t.conn.unlock()
+	return t.Tx.Rollback()
+}
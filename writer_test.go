@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriteLock(t *testing.T) {
+	var none writeLock
+	if err := none.acquire(context.Background()); err != nil {
+		t.Fatalf("nil lock: %v", err)
+	}
+	none.release()
+
+	l := newWriteLock()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second acquire = %v, want to wait until the context ends", err)
+	}
+	l.release()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Errorf("acquire after release: %v", err)
+	}
+}
+
+func TestSingleWriter_Integration(t *testing.T) {
+	url := os.Getenv("LIBSQL_URL")
+	if url == "" {
+		url = "http://localhost:8080"
+	}
+	db := sql.OpenDB(&pragmaConnector{dsn: url, pragmas: []string{"PRAGMA busy_timeout = 1000"}, writer: newWriteLock()})
+	defer db.Close()
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		t.Skipf("skipping integration test: %v", err)
+	}
+	defer db.Exec("DELETE FROM tags WHERE name LIKE 'writer-test-%'")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO tags (name, description) VALUES ('writer-test-a', 'x')"); err != nil {
+		t.Fatalf("insert in transaction: %v", err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM tags").Scan(&n); err != nil {
+		t.Errorf("reads should not wait for the writer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, "INSERT INTO tags (name, description) VALUES ('writer-test-b', 'x')"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("write during a transaction = %v, want it to wait", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := db.Exec("INSERT INTO tags (name, description) VALUES ('writer-test-c', 'x')")
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("queued write after commit: %v", err)
+	}
+}